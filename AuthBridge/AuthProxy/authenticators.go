@@ -0,0 +1,130 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/lestrrat-go/jwx/v2/jwk"
+	"gopkg.in/yaml.v3"
+
+	"github.com/kagenti/kagenti-extensions/AuthBridge/AuthProxy/internal/middleware"
+)
+
+// Authenticators selectable with PROXY_AUTHENTICATORS.
+const (
+	authenticatorJWT           = "jwt"
+	authenticatorIntrospection = "introspection"
+	authenticatorAPIKey        = "api_key"
+	authenticatorMTLS          = "mtls"
+)
+
+// authenticators builds the authenticators of PROXY_AUTHENTICATORS, in
+// order. They are validated by proxyConfig.Validate.
+func authenticators(cfg *proxyConfig) ([]middleware.Authenticator, error) {
+	var list []middleware.Authenticator
+	for _, name := range cfg.Authenticators {
+		switch name {
+		case authenticatorJWT:
+			cache := jwk.NewCache(context.Background())
+			if err := cache.Register(cfg.AuthJWKSURL); err != nil {
+				return nil, fmt.Errorf("register JWKS URL: %w", err)
+			}
+			list = append(list, &middleware.BearerAuthenticator{Validator: &middleware.JWKSValidator{
+				Cache:    cache,
+				JWKSURL:  cfg.AuthJWKSURL,
+				Issuer:   cfg.AuthIssuer,
+				Audience: cfg.AuthAudience,
+			}})
+		case authenticatorIntrospection:
+			list = append(list, &middleware.BearerAuthenticator{Validator: &middleware.IntrospectionValidator{
+				Endpoint:     cfg.IntrospectionURL,
+				ClientID:     cfg.IntrospectionClientID,
+				ClientSecret: cfg.IntrospectionClientSecret,
+				Audience:     cfg.AuthAudience,
+				Client:       &http.Client{Timeout: 10 * time.Second},
+			}})
+		case authenticatorAPIKey:
+			keys, err := loadAPIKeys(cfg.APIKeysFile)
+			if err != nil {
+				return nil, err
+			}
+			a, err := middleware.NewAPIKeyAuthenticator(cfg.APIKeyHeader, keys)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", cfg.APIKeysFile, err)
+			}
+			list = append(list, a)
+		case authenticatorMTLS:
+			list = append(list, middleware.MTLSAuthenticator{})
+		}
+	}
+	return list, nil
+}
+
+// loadAPIKeys reads a YAML map of client names to API keys.
+func loadAPIKeys(path string) (map[string]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read API keys: %w", err)
+	}
+	var keys map[string]string
+	if err := yaml.Unmarshal(data, &keys); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("%s: no API keys", path)
+	}
+	return keys, nil
+}
+
+// authenticated requires one of the configured credentials for requests to
+// h and strips the API key header, so keys don't reach the target. Without
+// authenticators, h is returned unchanged.
+func authenticated(h http.Handler, list []middleware.Authenticator, cfg *proxyConfig) http.Handler {
+	if len(list) == 0 {
+		return h
+	}
+	log.Printf("Authenticators: %v", cfg.Authenticators)
+	strip := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.Header.Del(cfg.APIKeyHeader)
+		h.ServeHTTP(w, r)
+	})
+	return middleware.Authenticate(list...)(strip)
+}
+
+// proxyTLSConfig returns the server TLS settings, or nil without
+// PROXY_TLS_CERT_FILE. Client certificates are requested when
+// PROXY_CLIENT_CA_FILE is set, and required when mtls is the only
+// authenticator.
+func proxyTLSConfig(cfg *proxyConfig) (*tls.Config, error) {
+	if cfg.TLSCertFile == "" {
+		return nil, nil
+	}
+	cert, err := tls.LoadX509KeyPair(cfg.TLSCertFile, cfg.TLSKeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("load certificate: %w", err)
+	}
+	tlsCfg := &tls.Config{Certificates: []tls.Certificate{cert}}
+	if cfg.ClientCAFile == "" {
+		return tlsCfg, nil
+	}
+	caPEM, err := os.ReadFile(cfg.ClientCAFile)
+	if err != nil {
+		return nil, fmt.Errorf("read client CA: %w", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(caPEM) {
+		return nil, fmt.Errorf("no certificates found in %s", cfg.ClientCAFile)
+	}
+	tlsCfg.ClientCAs = pool
+	tlsCfg.ClientAuth = tls.VerifyClientCertIfGiven
+	if len(cfg.Authenticators) == 1 && cfg.Authenticators[0] == authenticatorMTLS {
+		tlsCfg.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	return tlsCfg, nil
+}
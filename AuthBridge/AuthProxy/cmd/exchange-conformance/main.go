@@ -0,0 +1,72 @@
+// exchange-conformance checks that an IdP's token endpoint supports the token
+// exchanges AuthBridge performs. It is configured with the ext proc's
+// environment variables plus CONFORMANCE_* ones (see -config-schema), and
+// exits non-zero if any scenario fails.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"text/tabwriter"
+
+	"github.com/kagenti/kagenti-extensions/AuthBridge/AuthProxy/internal/conformance"
+	"github.com/kagenti/kagenti-extensions/configschema"
+)
+
+func main() {
+	output := flag.String("o", "table", "Output format: table or json")
+	printSchema := flag.Bool("config-schema", false, "Print the JSON Schema of the environment variables and exit")
+	flag.Parse()
+
+	if *printSchema {
+		schema, err := configschema.EnvSchema(conformance.Config{}, "AuthBridge exchange conformance")
+		if err != nil {
+			fail("%v", err)
+		}
+		os.Stdout.Write(append(schema, '\n'))
+		return
+	}
+
+	var cfg conformance.Config
+	if err := configschema.DecodeEnv(os.LookupEnv, &cfg); err != nil {
+		fail("invalid configuration: %v", err)
+	}
+	report := conformance.Run(context.Background(), &cfg, nil)
+
+	switch *output {
+	case "json":
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(report); err != nil {
+			fail("%v", err)
+		}
+	case "table":
+		printTable(os.Stdout, report)
+	default:
+		fail("unknown output format %q", *output)
+	}
+	if !report.Compliant() {
+		os.Exit(1)
+	}
+}
+
+func printTable(out io.Writer, report *conformance.Report) {
+	fmt.Fprintf(out, "Token endpoint: %s\nAudience:       %s\n\n", report.TokenURL, report.Audience)
+	w := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "SCENARIO\tSTATUS\tDETAIL")
+	for _, res := range report.Results {
+		fmt.Fprintf(w, "%s\t%s\t%s\n", res.Scenario, res.Status, res.Detail)
+	}
+	w.Flush()
+	fmt.Fprintf(out, "\n%d passed, %d warnings, %d failed, %d skipped\n",
+		report.Count(conformance.Pass), report.Count(conformance.Warn), report.Count(conformance.Fail), report.Count(conformance.Skip))
+}
+
+func fail(format string, args ...any) {
+	fmt.Fprintf(os.Stderr, "exchange-conformance: "+format+"\n", args...)
+	os.Exit(2)
+}
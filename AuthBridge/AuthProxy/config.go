@@ -0,0 +1,129 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/kagenti/kagenti-extensions/AuthBridge/AuthProxy/internal/mcpauth"
+)
+
+// proxyConfig is the proxy configuration, read from the environment with
+// configschema.DecodeEnv. `auth-proxy -config-schema` prints it as JSON
+// Schema.
+type proxyConfig struct {
+	TargetServiceURL      string `env:"TARGET_SERVICE_URL" default:"http://demo-app-service:8081" doc:"Target for plain HTTP requests"`
+	TargetServiceHTTPSURL string `env:"TARGET_SERVICE_HTTPS_URL" default:"https://demo-app-service:8443" doc:"Target for requests under /tls-test"`
+
+	RateLimitRPS   float64 `env:"RATE_LIMIT_RPS" doc:"Shared rate limit in requests per second; 0 disables it"`
+	RateLimitBurst int     `env:"RATE_LIMIT_BURST" doc:"Rate limit burst; defaults to RATE_LIMIT_RPS rounded up"`
+	RateLimitKey   string  `env:"RATE_LIMIT_KEY" default:"global" doc:"What the rate limit applies to: global (all callers together) or identity (each caller)"`
+	// Replicas fronting one tool share their limits through Redis
+	RateLimitRedisAddress  string        `env:"RATE_LIMIT_REDIS_ADDRESS" doc:"Redis host:port to keep rate limits in, so they hold across replicas"`
+	RateLimitRedisPassword string        `env:"RATE_LIMIT_REDIS_PASSWORD" doc:"Password of RATE_LIMIT_REDIS_ADDRESS"`
+	RateLimitRedisPrefix   string        `env:"RATE_LIMIT_REDIS_PREFIX" default:"authproxy:ratelimit:" doc:"Prefix of the Redis keys; replicas with the same prefix share limits"`
+	RateLimitRedisTimeout  time.Duration `env:"RATE_LIMIT_REDIS_TIMEOUT" default:"100ms" doc:"Time Redis has to answer before the replica limits on its own"`
+
+	MaxConnections    int           `env:"PROXY_MAX_CONNECTIONS" default:"1024" doc:"Concurrent client connections; 0 disables the limit"`
+	ReadHeaderTimeout time.Duration `env:"PROXY_READ_HEADER_TIMEOUT" default:"10s" doc:"Time a client has to send its request headers"`
+	ReadTimeout       time.Duration `env:"PROXY_READ_TIMEOUT" doc:"Time to read a whole request; 0 disables it"`
+	WriteTimeout      time.Duration `env:"PROXY_WRITE_TIMEOUT" doc:"Time to write a whole response; 0 disables it"`
+	IdleTimeout       time.Duration `env:"PROXY_IDLE_TIMEOUT" default:"2m" doc:"Keep-alive connections idle this long are closed"`
+	MaxHeaderBytes    int           `env:"PROXY_MAX_HEADER_BYTES" default:"1048576" doc:"Largest request header block accepted"`
+
+	LoadBalancing bool          `env:"UPSTREAM_LOAD_BALANCING" default:"true" doc:"Balance across every address the target hostname resolves to"`
+	DNSRefresh    time.Duration `env:"UPSTREAM_DNS_REFRESH" doc:"How often target addresses are re-resolved"`
+	MaxFailures   int           `env:"UPSTREAM_MAX_FAILURES" doc:"Consecutive failures before an address is ejected"`
+	EjectTime     time.Duration `env:"UPSTREAM_EJECT_TIME" doc:"How long an ejected address is skipped"`
+
+	StreamsPerIdentity   int      `env:"PROXY_STREAMS_PER_IDENTITY" doc:"SSE and WebSocket streams each identity may hold open; 0 disables the limit"`
+	StreamLimitOverrides []string `env:"PROXY_STREAM_LIMIT_OVERRIDES" doc:"Per-identity stream caps as identity=count, e.g. spiffe://example.org/ns/batch/sa/agent=20"`
+	MetricsAddress       string   `env:"PROXY_METRICS_ADDRESS" doc:"Serve Prometheus metrics on this address, e.g. :9091"`
+
+	// Authenticators are off by default: the inbound ext proc validates tokens
+	Authenticators   []string `env:"PROXY_AUTHENTICATORS" doc:"Authenticators tried in order: jwt, introspection, api_key, mtls; empty disables authentication"`
+	AuthJWKSURL      string   `env:"AUTH_JWKS_URL" doc:"JWKS of the jwt authenticator"`
+	AuthIssuer       string   `env:"AUTH_ISSUER" doc:"Required issuer of the jwt authenticator"`
+	AuthAudience     string   `env:"AUTH_AUDIENCE" doc:"Required audience of the jwt and introspection authenticators"`
+	IntrospectionURL string   `env:"AUTH_INTROSPECTION_URL" doc:"RFC 7662 endpoint of the introspection authenticator"`
+	// IntrospectionClientID and IntrospectionClientSecret authenticate to it
+	IntrospectionClientID     string `env:"AUTH_INTROSPECTION_CLIENT_ID" doc:"Client of the introspection authenticator"`
+	IntrospectionClientSecret string `env:"AUTH_INTROSPECTION_CLIENT_SECRET" doc:"Secret of AUTH_INTROSPECTION_CLIENT_ID"`
+	APIKeysFile               string `env:"AUTH_API_KEYS_FILE" doc:"YAML map of client names to API keys for the api_key authenticator"`
+	APIKeyHeader              string `env:"AUTH_API_KEY_HEADER" default:"X-API-Key" doc:"Header carrying API keys; removed before forwarding"`
+	TLSCertFile               string `env:"PROXY_TLS_CERT_FILE" doc:"Serve TLS with this certificate"`
+	TLSKeyFile                string `env:"PROXY_TLS_KEY_FILE" doc:"Key of PROXY_TLS_CERT_FILE"`
+	ClientCAFile              string `env:"PROXY_CLIENT_CA_FILE" doc:"CAs of client certificates for the mtls authenticator"`
+
+	// MCPAuth serves the protected resource metadata of an MCP target
+	MCPAuth mcpauth.Env
+	Issuer  string `env:"ISSUER" doc:"Authorization server advertised in MCP authorization mode when MCP_AUTHORIZATION_SERVERS is unset"`
+}
+
+// Validate implements configschema.Validator.
+func (c *proxyConfig) Validate() error {
+	if c.RateLimitRPS < 0 || c.RateLimitBurst < 0 {
+		return errors.New("RATE_LIMIT_RPS and RATE_LIMIT_BURST must not be negative")
+	}
+	if c.RateLimitRedisAddress != "" && c.RateLimitRedisTimeout == 0 {
+		return errors.New("RATE_LIMIT_REDIS_TIMEOUT must be positive")
+	}
+	if c.RateLimitKey != rateLimitGlobal && c.RateLimitKey != rateLimitIdentity {
+		return fmt.Errorf("unknown RATE_LIMIT_KEY %q, want %s or %s", c.RateLimitKey, rateLimitGlobal, rateLimitIdentity)
+	}
+	for _, n := range []int{c.MaxConnections, c.MaxHeaderBytes, c.MaxFailures, c.StreamsPerIdentity} {
+		if n < 0 {
+			return errors.New("PROXY_MAX_CONNECTIONS, PROXY_MAX_HEADER_BYTES, UPSTREAM_MAX_FAILURES and PROXY_STREAMS_PER_IDENTITY must not be negative")
+		}
+	}
+	if _, err := parseStreamOverrides(c.StreamLimitOverrides); err != nil {
+		return err
+	}
+	for _, d := range []time.Duration{c.ReadHeaderTimeout, c.ReadTimeout, c.WriteTimeout, c.IdleTimeout, c.DNSRefresh, c.EjectTime, c.RateLimitRedisTimeout} {
+		if d < 0 {
+			return errors.New("durations must not be negative")
+		}
+	}
+	if (c.TLSCertFile == "") != (c.TLSKeyFile == "") {
+		return errors.New("PROXY_TLS_CERT_FILE and PROXY_TLS_KEY_FILE must be set together")
+	}
+	return c.validateAuthenticators()
+}
+
+// validateAuthenticators checks that each authenticator is known, listed
+// once and configured.
+func (c *proxyConfig) validateAuthenticators() error {
+	seen := make(map[string]bool)
+	for _, name := range c.Authenticators {
+		if seen[name] {
+			return fmt.Errorf("authenticator %q listed twice", name)
+		}
+		seen[name] = true
+		switch name {
+		case authenticatorJWT:
+			if c.AuthJWKSURL == "" || c.AuthIssuer == "" {
+				return errors.New("the jwt authenticator needs AUTH_JWKS_URL and AUTH_ISSUER")
+			}
+		case authenticatorIntrospection:
+			if c.IntrospectionURL == "" || c.IntrospectionClientID == "" {
+				return errors.New("the introspection authenticator needs AUTH_INTROSPECTION_URL and AUTH_INTROSPECTION_CLIENT_ID")
+			}
+		case authenticatorAPIKey:
+			if c.APIKeysFile == "" {
+				return errors.New("the api_key authenticator needs AUTH_API_KEYS_FILE")
+			}
+		case authenticatorMTLS:
+			if c.TLSCertFile == "" || c.ClientCAFile == "" {
+				return errors.New("the mtls authenticator needs PROXY_TLS_CERT_FILE, PROXY_TLS_KEY_FILE and PROXY_CLIENT_CA_FILE")
+			}
+		default:
+			return fmt.Errorf("unknown authenticator %q, want %s, %s, %s or %s", name,
+				authenticatorJWT, authenticatorIntrospection, authenticatorAPIKey, authenticatorMTLS)
+		}
+	}
+	if seen[authenticatorJWT] && seen[authenticatorIntrospection] {
+		// Both read the Authorization header; the first would always decide
+		return errors.New("the jwt and introspection authenticators are exclusive")
+	}
+	return nil
+}
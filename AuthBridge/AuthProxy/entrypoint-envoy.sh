@@ -8,6 +8,22 @@ GO_PROCESSOR_PID=$!
 # Give go-processor a moment to start
 sleep 2
 
-# Start Envoy in the foreground
+# Start Envoy in the background so this script keeps receiving SIGTERM
 echo "Starting Envoy..."
-exec /usr/local/bin/envoy -c /etc/envoy/envoy.yaml --service-cluster auth-proxy --service-node auth-proxy --log-level debug
+/usr/local/bin/envoy -c /etc/envoy/envoy.yaml --service-cluster auth-proxy --service-node auth-proxy --log-level "${LOG_LEVEL:-debug}" &
+ENVOY_PID=$!
+
+# On SIGTERM, let the go-processor drain its ext_proc streams first. Envoy keeps
+# serving meanwhile, so in-flight requests are not failed for lack of ext_proc.
+shutdown() {
+  echo "Draining go-processor..."
+  kill -TERM "$GO_PROCESSOR_PID" 2>/dev/null
+  wait "$GO_PROCESSOR_PID"
+  echo "Stopping Envoy..."
+  kill -TERM "$ENVOY_PID" 2>/dev/null
+}
+trap shutdown TERM INT
+
+wait "$ENVOY_PID"
+# wait returns early when a trapped signal arrives; wait for Envoy to exit
+wait "$ENVOY_PID"
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+)
+
+// Where the RFC 8693 actor token comes from (ACTOR_TOKEN_SOURCE). With an
+// actor token, the IdP can add an act claim naming the agent that acts on
+// behalf of the user.
+const (
+	actorSourceNone = "none"
+	// actorSourceSVID uses the JWT-SVID from the SPIFFE Workload API.
+	actorSourceSVID = "svid"
+	// actorSourceFile reads a mounted token, e.g. the JWT-SVID spiffe-helper
+	// writes. It is re-read for every exchange, so rotations apply.
+	actorSourceFile = "file"
+)
+
+var (
+	actorTokenSource = actorSourceNone
+	actorTokenFile   = defaultSVIDPath
+	actorTokenType   = tokenTypeJWT
+)
+
+// actorTokenEnv configures the actor token of exchanges.
+type actorTokenEnv struct {
+	Source string `env:"ACTOR_TOKEN_SOURCE" doc:"Actor token sent in exchanges: none, svid or file; defaults to svid with SPIFFE_TOKEN_ROLE=actor, else none"`
+	File   string `env:"ACTOR_TOKEN_FILE" default:"/opt/jwt_svid.token" doc:"Actor token of the file source"`
+	Type   string `env:"ACTOR_TOKEN_TYPE" default:"urn:ietf:params:oauth:token-type:jwt" doc:"actor_token_type sent with the actor token"`
+}
+
+func loadActorTokenConfig(env actorTokenEnv) {
+	actorTokenSource = env.Source
+	if actorTokenSource == "" {
+		actorTokenSource = actorSourceNone
+		if svidTokenRole == svidRoleActor {
+			actorTokenSource = actorSourceSVID
+		}
+	}
+	actorTokenFile = env.File
+	actorTokenType = env.Type
+
+	switch actorTokenSource {
+	case actorSourceNone:
+		return
+	case actorSourceSVID:
+		if workloadSVIDs == nil {
+			fatal("ACTOR_TOKEN_SOURCE=svid needs SPIFFE_ENDPOINT_SOCKET")
+		}
+	case actorSourceFile:
+		if _, err := os.Stat(actorTokenFile); err != nil {
+			// spiffe-helper may not have written it yet
+			exchangeLog.Warn("Actor token file not available yet", "path", actorTokenFile, "error", err)
+		}
+	default:
+		fatal("Invalid ACTOR_TOKEN_SOURCE", "value", actorTokenSource)
+	}
+	exchangeLog.Info("Sending actor tokens in exchanges", "source", actorTokenSource, "token_type", actorTokenType)
+}
+
+// actorToken returns the current actor token, or "" when none is configured.
+func actorToken(ctx context.Context) (string, error) {
+	switch actorTokenSource {
+	case actorSourceSVID:
+		svid, err := workloadSVIDs.JWTSVID(ctx, svidAudience)
+		if err != nil {
+			return "", err
+		}
+		return svid.Token, nil
+	case actorSourceFile:
+		token, err := os.ReadFile(actorTokenFile)
+		if err != nil {
+			return "", err
+		}
+		return strings.TrimSpace(string(token)), nil
+	}
+	return "", nil
+}
+
+// setActorToken adds the actor token to a token exchange form. It is left out
+// when the subject token is the actor token itself, e.g. when the workload
+// exchanges its own SVID.
+func setActorToken(ctx context.Context, form url.Values) error {
+	token, err := actorToken(ctx)
+	if err != nil {
+		return fmt.Errorf("actor token: %w", err)
+	}
+	if token == "" || token == form.Get("subject_token") {
+		return nil
+	}
+	form.Set("actor_token", token)
+	form.Set("actor_token_type", actorTokenType)
+	return nil
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+
+	"github.com/kagenti/kagenti-extensions/AuthBridge/AuthProxy/go-processor/internal/resolver"
+)
+
+// cacheStats is what the admin server reports of a token cache.
+type cacheStats struct {
+	Enabled    bool   `json:"enabled"`
+	Entries    int    `json:"entries"`
+	MaxEntries int    `json:"max_entries,omitempty"`
+	Hits       uint64 `json:"hits"`
+	Misses     uint64 `json:"misses"`
+}
+
+// adminRoute is a route as listed by the admin server. Values of added
+// headers may be credentials and are redacted.
+type adminRoute struct {
+	Host   string                `json:"host"`
+	Config resolver.TargetConfig `json:"config"`
+}
+
+// startAdminServer serves debugging endpoints for live pods on addr
+// (ADMIN_ADDRESS, e.g. "127.0.0.1:9092"). It is off when addr is empty, and
+// only listens on loopback addresses, since anyone reaching it can flush
+// caches:
+//   - GET /routes: the routes in effect, in match order
+//   - GET /caches: entries, hits and misses of the token caches
+//   - GET /breakers: state of the token endpoint circuit breakers
+//   - POST /cache/flush: drops every cached token
+func startAdminServer(addr string) {
+	if addr == "" {
+		return
+	}
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		fatal("Invalid ADMIN_ADDRESS", "value", addr, "error", err)
+	}
+	if ip := net.ParseIP(host); host != "localhost" && (ip == nil || !ip.IsLoopback()) {
+		fatal("ADMIN_ADDRESS must be a loopback address", "value", addr)
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /routes", func(w http.ResponseWriter, _ *http.Request) {
+		routes := []adminRoute{}
+		if r, ok := globalResolver.(interface{ Routes() []resolver.Route }); ok {
+			for _, route := range r.Routes() {
+				add := make([]resolver.HeaderValue, len(route.Config.RequestHeaders.Add))
+				for i, h := range route.Config.RequestHeaders.Add {
+					add[i] = resolver.HeaderValue{Name: h.Name, Value: redacted}
+				}
+				route.Config.RequestHeaders.Add = add
+				routes = append(routes, adminRoute{Host: route.Host, Config: route.Config})
+			}
+		}
+		writeAdminJSON(w, routes)
+	})
+	mux.HandleFunc("GET /caches", func(w http.ResponseWriter, _ *http.Request) {
+		writeAdminJSON(w, map[string]cacheStats{
+			"exchange":        exchangeCache.stats(),
+			"workload_tokens": workloadTokens.stats(),
+		})
+	})
+	mux.HandleFunc("GET /breakers", func(w http.ResponseWriter, _ *http.Request) {
+		writeAdminJSON(w, exchangeBreakers.Snapshot())
+	})
+	mux.HandleFunc("POST /cache/flush", func(w http.ResponseWriter, _ *http.Request) {
+		flushed := map[string]int{
+			"exchange":        exchangeCache.flush(),
+			"workload_tokens": workloadTokens.flush(),
+		}
+		rootLogger.Info("Token caches flushed through the admin server",
+			"exchange", flushed["exchange"], "workload_tokens", flushed["workload_tokens"])
+		writeAdminJSON(w, flushed)
+	})
+	go func() {
+		rootLogger.Info("Serving admin endpoints", "address", addr)
+		if err := http.ListenAndServe(addr, mux); err != nil {
+			fatal("Admin server failed", "error", err)
+		}
+	}()
+}
+
+func writeAdminJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(v); err != nil {
+		rootLogger.Debug("Cannot write admin response", "error", err)
+	}
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	core "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
+	als "github.com/envoyproxy/go-control-plane/envoy/service/accesslog/v3"
+	"google.golang.org/grpc"
+
+	"github.com/kagenti/kagenti-extensions/AuthBridge/AuthProxy/go-processor/internal/accesslog"
+)
+
+// defaultALSJournalTTL is how long exchanges wait in the journal for their
+// Envoy access log entry.
+const defaultALSJournalTTL = 5 * time.Minute
+
+// alsEnv configures the access log service.
+type alsEnv struct {
+	Enabled     bool `env:"ALS_ENABLED" doc:"Serve the Envoy access log service, joining access log entries with exchange decisions"`
+	JournalSize int  `env:"ALS_JOURNAL_SIZE" default:"10000" doc:"Exchange decisions kept for joining with access log entries"`
+}
+
+// exchangeJournal is nil unless the access log service is enabled via
+// ALS_ENABLED=true.
+var exchangeJournal *accesslog.Journal
+
+func loadALSConfig(env alsEnv) {
+	if !env.Enabled {
+		return
+	}
+	if env.JournalSize <= 0 {
+		fatal("Invalid ALS_JOURNAL_SIZE", "value", env.JournalSize)
+	}
+	exchangeJournal = accesslog.NewJournal(env.JournalSize, defaultALSJournalTTL)
+	alsLog.Info("Access log service enabled", "journal_size", env.JournalSize)
+}
+
+// registerALS adds the access log service to the processor's gRPC server.
+func registerALS(server *grpc.Server) {
+	if exchangeJournal == nil {
+		return
+	}
+	als.RegisterAccessLogServiceServer(server, &accesslog.Server{
+		Journal: exchangeJournal,
+		Logf: func(format string, args ...interface{}) {
+			alsLog.Info(fmt.Sprintf(format, args...))
+		},
+	})
+}
+
+// recordExchange notes the exchange decision for the request so it can be
+// joined with Envoy's access log entry, and writes it to the audit log.
+func recordExchange(ctx context.Context, headers []*core.HeaderValue, host, audience, scopes, outcome string) {
+	writeAudit(ctx, headers, host, audience, scopes, outcome)
+	if exchangeJournal == nil {
+		return
+	}
+	exchangeJournal.Record(accesslog.ExchangeEvent{
+		RequestID: getHeaderValue(headers, "x-request-id"),
+		Host:      host,
+		Audience:  audience,
+		Scopes:    scopes,
+		Outcome:   outcome,
+	})
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	core "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
+	"github.com/lestrrat-go/jwx/v2/jwt"
+
+	"github.com/kagenti/kagenti-extensions/AuthBridge/AuthProxy/go-processor/internal/audit"
+)
+
+var (
+	auditLog = rootLogger.With("component", "audit")
+	// auditSinks receive a record of every exchange decision; empty unless
+	// AUDIT_LOG_FILE or AUDIT_OTLP_ENDPOINT is set.
+	auditSinks []audit.Sink
+	// auditFailures counts records a sink could not take
+	auditFailures atomic.Uint64
+)
+
+// auditEnv configures the audit sinks.
+type auditEnv struct {
+	LogFile      string `env:"AUDIT_LOG_FILE" doc:"File audit records are appended to as JSON lines"`
+	OTLPEndpoint string `env:"AUDIT_OTLP_ENDPOINT" doc:"OTLP/HTTP collector audit records are exported to as log records, e.g. http://otel-collector:4318"`
+	OTLPHeaders  string `env:"AUDIT_OTLP_HEADERS" doc:"Comma-separated name=value headers sent to AUDIT_OTLP_ENDPOINT"`
+	ServiceName  string `env:"OTEL_SERVICE_NAME" default:"authbridge-ext-proc" doc:"service.name of exported audit records"`
+}
+
+func loadAuditConfig(env auditEnv) {
+	if path := env.LogFile; path != "" {
+		s, err := audit.OpenFile(path)
+		if err != nil {
+			fatal("Cannot open AUDIT_LOG_FILE", "path", path, "error", err)
+		}
+		auditSinks = append(auditSinks, s)
+		auditLog.Info("Audit log enabled", "file", path)
+	}
+	if endpoint := env.OTLPEndpoint; endpoint != "" {
+		headers, err := parseAuditHeaders(env.OTLPHeaders)
+		if err != nil {
+			fatal("Invalid AUDIT_OTLP_HEADERS", "error", err)
+		}
+		auditSinks = append(auditSinks, audit.NewOTLPSink(audit.OTLPConfig{
+			Endpoint:    endpoint,
+			ServiceName: env.ServiceName,
+			Headers:     headers,
+			OnError: func(err error) {
+				auditFailures.Add(1)
+				auditLog.Error("Audit export failed", "error", err)
+			},
+		}))
+		auditLog.Info("Audit export enabled", "endpoint", endpoint)
+	}
+}
+
+func parseAuditHeaders(s string) (map[string]string, error) {
+	if s == "" {
+		return nil, nil
+	}
+	headers := make(map[string]string)
+	for _, pair := range strings.Split(s, ",") {
+		name, value, ok := strings.Cut(pair, "=")
+		if !ok || strings.TrimSpace(name) == "" {
+			return nil, fmt.Errorf("%q is not name=value", pair)
+		}
+		headers[strings.TrimSpace(name)] = strings.TrimSpace(value)
+	}
+	return headers, nil
+}
+
+// closeAudit flushes and closes the sinks.
+func closeAudit() {
+	for _, s := range auditSinks {
+		if err := s.Close(); err != nil {
+			auditLog.Error("Closing audit sink failed", "error", err)
+		}
+	}
+}
+
+// auditEntry collects the details of one exchange decision as it is made.
+// Its methods do nothing on a nil entry, i.e. when auditing is off.
+type auditEntry struct {
+	start       time.Time
+	subject     string
+	issuer      string
+	clientID    string
+	subjectHash string
+	issuedHash  string
+}
+
+type auditKey struct{}
+
+// startAudit returns ctx carrying a new entry if auditing is on.
+func startAudit(ctx context.Context) context.Context {
+	if len(auditSinks) == 0 {
+		return ctx
+	}
+	return context.WithValue(ctx, auditKey{}, &auditEntry{start: time.Now()})
+}
+
+func auditFrom(ctx context.Context) *auditEntry {
+	e, _ := ctx.Value(auditKey{}).(*auditEntry)
+	return e
+}
+
+// subjectToken notes the token being exchanged and the client exchanging
+// it. Its claims are read without verification: the record states what was
+// presented, and the IdP or local validation decides whether it is genuine.
+func (e *auditEntry) subjectToken(token, clientID string) {
+	if e == nil {
+		return
+	}
+	e.clientID = clientID
+	e.subjectHash = audit.HashToken(token)
+	if t, err := jwt.ParseInsecure([]byte(token)); err == nil {
+		e.subject, e.issuer = t.Subject(), t.Issuer()
+	}
+}
+
+// issuedToken notes the token the request is forwarded with.
+func (e *auditEntry) issuedToken(token string) {
+	if e != nil {
+		e.issuedHash = audit.HashToken(token)
+	}
+}
+
+// writeAudit records a decision in every sink.
+func writeAudit(ctx context.Context, headers []*core.HeaderValue, host, audience, scopes, decision string) {
+	e := auditFrom(ctx)
+	if e == nil {
+		return
+	}
+	r := audit.Record{
+		Time:             time.Now(),
+		RequestID:        getHeaderValue(headers, "x-request-id"),
+		Host:             host,
+		Subject:          e.subject,
+		Issuer:           e.issuer,
+		ClientID:         e.clientID,
+		Audience:         audience,
+		Scopes:           scopes,
+		Decision:         decision,
+		Latency:          time.Since(e.start),
+		SubjectTokenHash: e.subjectHash,
+		IssuedTokenHash:  e.issuedHash,
+	}
+	for _, s := range auditSinks {
+		if err := s.Write(r); err != nil {
+			auditFailures.Add(1)
+			auditLog.Error("Cannot write audit record", "host", host, "request_id", r.RequestID, "error", err)
+		}
+	}
+}
+
+// writeAuditMetrics writes the failure counter in Prometheus text format.
+func writeAuditMetrics(w io.Writer) {
+	if len(auditSinks) == 0 {
+		return
+	}
+	fmt.Fprintf(w, "# HELP authbridge_audit_failures_total Audit records that could not be written and failed exports.\n")
+	fmt.Fprintf(w, "# TYPE authbridge_audit_failures_total counter\n")
+	fmt.Fprintf(w, "authbridge_audit_failures_total %d\n", auditFailures.Load())
+}
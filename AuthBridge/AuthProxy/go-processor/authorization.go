@@ -0,0 +1,73 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// errNotAuthorized is returned when the IdP denies the authorization check.
+var errNotAuthorized = errors.New("not authorized")
+
+// checkAuthorization asks the IdP whether the subject may access audience
+// before its token is exchanged, using a Keycloak UMA decision request
+// (grant_type uma-ticket, response_mode decision). permissions holds
+// space-separated "resource#scope" entries; when empty, access to any
+// resource of the audience is checked.
+//
+// A denial returns errNotAuthorized; any other error means the check could
+// not be made. Both must deny the request, since the route requires the check.
+func checkAuthorization(ctx context.Context, clientID, clientSecret, tokenURL, subjectToken, audience, permissions string) error {
+	exchangeLog.Debug("Checking authorization", "token_url", tokenURL, "audience", audience, "permissions", permissions)
+
+	data := url.Values{}
+	if err := setClientAuth(ctx, data, clientID, clientSecret, tokenURL); err != nil {
+		return err
+	}
+	data.Set("grant_type", "urn:ietf:params:oauth:grant-type:uma-ticket")
+	data.Set("subject_token", subjectToken)
+	data.Set("audience", audience)
+	data.Set("response_mode", "decision")
+	for _, p := range strings.Fields(permissions) {
+		data.Add("permission", p)
+	}
+
+	cb := exchangeBreakers.Get(tokenURL)
+	if !cb.Allow() {
+		return errCircuitOpen
+	}
+	resp, err := postTokenRequest(ctx, tokenURL, data)
+	switch {
+	case ctx.Err() != nil:
+	case err != nil || resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500:
+		cb.Failure()
+	default:
+		cb.Success()
+	}
+	if err != nil {
+		return fmt.Errorf("authorization request failed: %w", err)
+	}
+
+	// Keycloak answers a denied decision with 403 access_denied
+	if resp.StatusCode == http.StatusForbidden {
+		return fmt.Errorf("%w: %s", errNotAuthorized, string(resp.Body))
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("authorization check failed with status %d: %s", resp.StatusCode, string(resp.Body))
+	}
+
+	var decision struct {
+		Result bool `json:"result"`
+	}
+	if err := json.Unmarshal(resp.Body, &decision); err != nil {
+		return fmt.Errorf("parse authorization decision: %w", err)
+	}
+	if !decision.Result {
+		return errNotAuthorized
+	}
+	return nil
+}
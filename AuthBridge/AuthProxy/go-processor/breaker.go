@@ -0,0 +1,57 @@
+package main
+
+import (
+	"errors"
+	"time"
+
+	"github.com/kagenti/kagenti-extensions/AuthBridge/AuthProxy/go-processor/internal/breaker"
+)
+
+// Policies for requests arriving while the token endpoint's breaker is open.
+const (
+	// breakerPassthrough forwards the original token, as for any failed exchange
+	breakerPassthrough = "passthrough"
+	// breakerDeny rejects the request with 503
+	breakerDeny = "deny"
+)
+
+var errCircuitOpen = errors.New("token endpoint circuit breaker is open")
+
+// exchangeBreakers holds one breaker per token endpoint URL, since routes may
+// exchange at different IdPs.
+var (
+	exchangeBreakers = breaker.NewSet(0, 0, nil)
+	breakerPolicy    = breakerPassthrough
+)
+
+// breakerEnv configures the token endpoint circuit breakers.
+type breakerEnv struct {
+	Threshold int           `env:"EXCHANGE_BREAKER_THRESHOLD" default:"5" doc:"Consecutive failed exchanges that open a token endpoint's circuit breaker; 0 disables the breakers"`
+	Cooldown  time.Duration `env:"EXCHANGE_BREAKER_COOLDOWN" default:"30s" doc:"Time before an open breaker lets a trial exchange through"`
+	Policy    string        `env:"EXCHANGE_BREAKER_POLICY" default:"passthrough" doc:"Requests while the breaker is open: passthrough (forward the original token) or deny (503)"`
+}
+
+func loadBreakerConfig(env breakerEnv) {
+	threshold, cooldown := env.Threshold, env.Cooldown
+	if threshold < 0 {
+		fatal("Invalid EXCHANGE_BREAKER_THRESHOLD", "value", threshold)
+	}
+	if cooldown < 0 {
+		fatal("Invalid EXCHANGE_BREAKER_COOLDOWN", "value", cooldown)
+	}
+	switch v := env.Policy; v {
+	case breakerPassthrough:
+		breakerPolicy = breakerPassthrough
+	case breakerDeny:
+		breakerPolicy = breakerDeny
+	default:
+		fatal("Invalid EXCHANGE_BREAKER_POLICY", "value", v)
+	}
+
+	exchangeBreakers = breaker.NewSet(threshold, cooldown, func(tokenURL string, from, to breaker.State) {
+		exchangeLog.Warn("Token endpoint circuit breaker changed state",
+			"token_url", tokenURL, "from", from.String(), "to", to.String())
+	})
+	exchangeLog.Info("Token endpoint circuit breaker",
+		"threshold", threshold, "cooldown", cooldown, "policy", breakerPolicy)
+}
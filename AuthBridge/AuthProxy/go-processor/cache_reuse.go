@@ -0,0 +1,123 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"sync"
+	"time"
+)
+
+const (
+	cacheReuseFixed    = "fixed"
+	cacheReuseAdaptive = "adaptive"
+
+	// cacheReuseStep is how much the adaptive fraction grows per stable period
+	cacheReuseStep = 0.05
+)
+
+// cacheReuse decides how much of a cached token's lifetime passes before a
+// new one is fetched, for workload tokens and the exchange cache.
+var cacheReuse = &reuseFraction{current: workloadTokenRefreshFraction}
+
+// reuseFraction is the fraction of their lifetime cached tokens are reused
+// for. It is fixed unless adaptive: then every upstream 401 on a cached token
+// halves it, down to min, since rejections hint at revoked tokens, and every
+// stable period without one raises it by cacheReuseStep, up to max, to spare
+// the IdP.
+type reuseFraction struct {
+	mu       sync.Mutex
+	adaptive bool
+	current  float64
+	min, max float64
+	stable   time.Duration
+	// since is when current last changed
+	since time.Time
+	now   func() time.Time
+}
+
+// cacheReuseEnv configures how long cached tokens are reused.
+type cacheReuseEnv struct {
+	Mode   string        `env:"CACHE_REUSE_MODE" default:"fixed" doc:"fixed (reuse cached tokens for 80% of their lifetime) or adaptive (shrink the fraction on upstream 401s, grow it back while none occur)"`
+	Min    float64       `env:"CACHE_REUSE_MIN" default:"0.2" doc:"Lower bound of the adaptive fraction, in (0, 1]"`
+	Max    float64       `env:"CACHE_REUSE_MAX" default:"0.9" doc:"Upper bound of the adaptive fraction, in (0, 1]"`
+	Stable time.Duration `env:"CACHE_REUSE_STABLE_PERIOD" default:"5m" doc:"Time without upstream 401s after which the adaptive fraction grows"`
+}
+
+func loadCacheReuseConfig(env cacheReuseEnv) {
+	switch env.Mode {
+	case cacheReuseFixed:
+		return
+	case cacheReuseAdaptive:
+	default:
+		fatal("Invalid CACHE_REUSE_MODE", "value", env.Mode)
+	}
+	minFraction, maxFraction := env.Min, env.Max
+	if minFraction <= 0 || minFraction > 1 {
+		fatal("Invalid CACHE_REUSE_MIN", "value", minFraction)
+	}
+	if maxFraction <= 0 || maxFraction > 1 {
+		fatal("Invalid CACHE_REUSE_MAX", "value", maxFraction)
+	}
+	if minFraction > maxFraction {
+		fatal("CACHE_REUSE_MIN exceeds CACHE_REUSE_MAX", "min", minFraction, "max", maxFraction)
+	}
+	stable := env.Stable
+	if stable <= 0 {
+		fatal("Invalid CACHE_REUSE_STABLE_PERIOD", "value", stable)
+	}
+	cacheReuse = &reuseFraction{
+		adaptive: true,
+		current:  min(max(workloadTokenRefreshFraction, minFraction), maxFraction),
+		min:      minFraction,
+		max:      maxFraction,
+		stable:   stable,
+		since:    time.Now(),
+		now:      time.Now,
+	}
+	exchangeLog.Info("Adaptive cache reuse", "min", minFraction, "max", maxFraction, "stable_period", stable)
+}
+
+// fraction returns the fraction of their lifetime cached tokens are reused
+// for now.
+func (r *reuseFraction) fraction() float64 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.growLocked()
+	return r.current
+}
+
+// rejected records an upstream 401 on a cached token.
+func (r *reuseFraction) rejected() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if !r.adaptive {
+		return
+	}
+	r.growLocked()
+	if shrunk := max(r.current/2, r.min); shrunk != r.current {
+		exchangeLog.Info("Upstream rejection, reusing cached tokens for less of their lifetime", "from", r.current, "to", shrunk)
+		r.current = shrunk
+	}
+	r.since = r.now()
+}
+
+// growLocked applies the stable periods passed since the last change.
+func (r *reuseFraction) growLocked() {
+	if !r.adaptive {
+		return
+	}
+	periods := r.now().Sub(r.since) / r.stable
+	if periods == 0 {
+		return
+	}
+	r.since = r.since.Add(periods * r.stable)
+	r.current = min(r.current+float64(periods)*cacheReuseStep, r.max)
+}
+
+// writeCacheReuseMetrics writes the current fraction in the Prometheus text
+// format.
+func writeCacheReuseMetrics(w io.Writer) {
+	fmt.Fprintf(w, "# HELP authbridge_token_cache_reuse_fraction Fraction of their lifetime cached tokens are reused for.\n")
+	fmt.Fprintf(w, "# TYPE authbridge_token_cache_reuse_fraction gauge\n")
+	fmt.Fprintf(w, "authbridge_token_cache_reuse_fraction %g\n", cacheReuse.fraction())
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	core "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
+	"github.com/lestrrat-go/jwx/v2/jwt"
+
+	"github.com/kagenti/kagenti-extensions/AuthBridge/AuthProxy/go-processor/internal/callchain"
+)
+
+// Agent-to-agent identity propagation. When CALL_CHAIN_KEY_FILE is set,
+// exchanged outbound calls carry a signed call chain naming the original
+// subject and every agent on the way, and inbound chains are verified
+// against the validated token. All workloads of a chain share the key.
+var (
+	callChainSigner *callchain.Signer
+	callChainHeader = "x-agent-call-chain"
+)
+
+// callChainEnv configures call chain propagation.
+type callChainEnv struct {
+	KeyFile  string        `env:"CALL_CHAIN_KEY_FILE" doc:"Key of at least 32 bytes shared by the workloads of a chain; enables call chain propagation"`
+	MaxDepth int           `env:"CALL_CHAIN_MAX_DEPTH" default:"8" doc:"Agents a call chain may name"`
+	Header   string        `env:"CALL_CHAIN_HEADER" default:"x-agent-call-chain" doc:"Header carrying the call chain"`
+	TTL      time.Duration `env:"CALL_CHAIN_TTL" default:"5m" doc:"Lifetime of signed call chains"`
+}
+
+func loadCallChainConfig(env callChainEnv) {
+	path := env.KeyFile
+	if path == "" {
+		return
+	}
+	key, err := os.ReadFile(path)
+	if err != nil {
+		fatal("Failed to read CALL_CHAIN_KEY_FILE", "path", path, "error", err)
+	}
+	key = []byte(strings.TrimSpace(string(key)))
+	if len(key) < 32 {
+		fatal("CALL_CHAIN_KEY_FILE must hold at least 32 bytes", "path", path)
+	}
+
+	maxDepth := env.MaxDepth
+	if maxDepth < 0 {
+		fatal("Invalid CALL_CHAIN_MAX_DEPTH", "value", maxDepth)
+	}
+	if env.TTL < 0 {
+		fatal("Invalid CALL_CHAIN_TTL", "value", env.TTL)
+	}
+	callChainHeader = strings.ToLower(env.Header)
+	callChainSigner = &callchain.Signer{
+		Key:      key,
+		TTL:      env.TTL,
+		MaxDepth: maxDepth,
+	}
+	rootLogger.Info("Call chain propagation enabled", "header", callChainHeader,
+		"ttl", callChainSigner.TTL, "max_depth", maxDepth)
+}
+
+// tokenSubject returns the sub claim of a token without verifying it. Only
+// use it on tokens that were verified elsewhere.
+func tokenSubject(token string) string {
+	parsed, err := jwt.ParseInsecure([]byte(token))
+	if err != nil {
+		return ""
+	}
+	return parsed.Subject()
+}
+
+// outboundCallChain builds the chain for an outbound call by actor: the chain
+// the app propagated from its own inbound request, or a new one for the
+// subject token's subject, extended with actor. A propagated chain that does
+// not verify or belongs to another subject is replaced. Subject tokens that
+// are not JWTs get no chain.
+func outboundCallChain(headers []*core.HeaderValue, subjectToken, actor string) (string, error) {
+	subject := tokenSubject(subjectToken)
+	if subject == "" {
+		exchangeLog.Debug("Subject token has no sub claim, not propagating a call chain")
+		return "", nil
+	}
+	chain := callchain.Chain{Subject: subject}
+	if propagated := getHeaderValue(headers, callChainHeader); propagated != "" {
+		verified, err := callChainSigner.Verify(propagated)
+		switch {
+		case err != nil:
+			exchangeLog.Warn("Ignoring propagated call chain", "error", err)
+		case verified.Subject != subject:
+			exchangeLog.Warn("Ignoring propagated call chain for another subject",
+				"chain_subject", verified.Subject, "token_subject", subject)
+		default:
+			chain = verified
+		}
+	}
+	return callChainSigner.Sign(chain.Append(actor))
+}
+
+// verifyInboundCallChain checks the chain of an inbound request, if any,
+// against the subject of its already validated token.
+func verifyInboundCallChain(headers []*core.HeaderValue, token string) error {
+	value := getHeaderValue(headers, callChainHeader)
+	if value == "" {
+		return nil
+	}
+	chain, err := callChainSigner.Verify(value)
+	if err != nil {
+		return err
+	}
+	if subject := tokenSubject(token); chain.Subject != subject {
+		return fmt.Errorf("call chain subject %q does not match token subject %q", chain.Subject, subject)
+	}
+	inboundLog.Debug("Call chain verified", "subject", chain.Subject, "actors", chain.Actors)
+	return nil
+}
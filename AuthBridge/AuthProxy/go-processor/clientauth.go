@@ -0,0 +1,192 @@
+package main
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/hex"
+	"fmt"
+	"net/url"
+	"os"
+	"time"
+
+	"github.com/lestrrat-go/jwx/v2/jwa"
+	"github.com/lestrrat-go/jwx/v2/jwk"
+	"github.com/lestrrat-go/jwx/v2/jwt"
+)
+
+// How the ext proc authenticates to the token endpoint (CLIENT_AUTH_METHOD).
+const (
+	// clientSecretPost sends client_id and client_secret in the form.
+	clientSecretPost = "client_secret_post"
+	// privateKeyJWT sends an RFC 7523 client assertion signed with a mounted
+	// private key.
+	privateKeyJWT = "private_key_jwt"
+	// jwtSVID sends the workload's SPIFFE JWT-SVID as the client assertion.
+	jwtSVID = "jwt_svid"
+)
+
+const (
+	clientAssertionType   = "urn:ietf:params:oauth:client-assertion-type:jwt-bearer"
+	clientAssertionTTL    = time.Minute
+	defaultSVIDPath       = "/opt/jwt_svid.token"
+	defaultClientAuthMode = clientSecretPost
+)
+
+var (
+	clientAuthMethod = defaultClientAuthMode
+	// clientAssertionKey and clientAssertionAlg sign private_key_jwt assertions
+	clientAssertionKey jwk.Key
+	clientAssertionAlg jwa.SignatureAlgorithm
+	// clientAssertionSVIDFile is re-read for every assertion, as spiffe-helper
+	// rotates the SVID in place; unused when the Workload API is configured
+	clientAssertionSVIDFile string
+)
+
+// clientAuthEnv configures how the ext proc authenticates to the token
+// endpoint.
+type clientAuthEnv struct {
+	Method   string `env:"CLIENT_AUTH_METHOD" default:"client_secret_post" doc:"Token endpoint client authentication: client_secret_post, private_key_jwt or jwt_svid"`
+	KeyFile  string `env:"CLIENT_ASSERTION_KEY_FILE" doc:"PEM private key (RSA, EC or Ed25519) signing private_key_jwt assertions"`
+	KeyID    string `env:"CLIENT_ASSERTION_KEY_ID" doc:"kid of private_key_jwt assertions"`
+	SVIDFile string `env:"CLIENT_ASSERTION_SVID_FILE" default:"/opt/jwt_svid.token" doc:"JWT-SVID sent with jwt_svid, unless SPIFFE_ENDPOINT_SOCKET is set"`
+}
+
+func loadClientAuthConfig(env clientAuthEnv) {
+	clientAuthMethod = env.Method
+	switch clientAuthMethod {
+	case clientSecretPost:
+	case privateKeyJWT:
+		path := env.KeyFile
+		if path == "" {
+			fatal("CLIENT_AUTH_METHOD=private_key_jwt needs CLIENT_ASSERTION_KEY_FILE")
+		}
+		key, alg, err := loadAssertionKey(path, env.KeyID)
+		if err != nil {
+			fatal("Invalid CLIENT_ASSERTION_KEY_FILE", "path", path, "error", err)
+		}
+		clientAssertionKey, clientAssertionAlg = key, alg
+	case jwtSVID:
+		clientAssertionSVIDFile = env.SVIDFile
+	default:
+		fatal("Invalid CLIENT_AUTH_METHOD", "value", clientAuthMethod)
+	}
+	exchangeLog.Info("Token endpoint client authentication", "method", clientAuthMethod, "algorithm", clientAssertionAlg)
+}
+
+// loadAssertionKey parses a PEM private key and picks its signing algorithm.
+func loadAssertionKey(path, keyID string) (jwk.Key, jwa.SignatureAlgorithm, error) {
+	pem, err := os.ReadFile(path)
+	if err != nil {
+		return nil, "", err
+	}
+	key, err := jwk.ParseKey(pem, jwk.WithPEM(true))
+	if err != nil {
+		return nil, "", err
+	}
+	var raw interface{}
+	if err := key.Raw(&raw); err != nil {
+		return nil, "", err
+	}
+
+	var alg jwa.SignatureAlgorithm
+	switch k := raw.(type) {
+	case *rsa.PrivateKey:
+		alg = jwa.RS256
+	case *ecdsa.PrivateKey:
+		switch k.Curve {
+		case elliptic.P256():
+			alg = jwa.ES256
+		case elliptic.P384():
+			alg = jwa.ES384
+		case elliptic.P521():
+			alg = jwa.ES512
+		default:
+			return nil, "", fmt.Errorf("unsupported EC curve %s", k.Curve.Params().Name)
+		}
+	case ed25519.PrivateKey:
+		alg = jwa.EdDSA
+	default:
+		return nil, "", fmt.Errorf("unsupported private key type %T", raw)
+	}
+	if keyID != "" {
+		if err := key.Set(jwk.KeyIDKey, keyID); err != nil {
+			return nil, "", err
+		}
+	}
+	return key, alg, nil
+}
+
+// hasClientCredentials reports whether the ext proc can authenticate to the
+// token endpoint; only client_secret_post needs the client secret.
+func hasClientCredentials(clientID, clientSecret string) bool {
+	return clientID != "" && (clientSecret != "" || clientAuthMethod != clientSecretPost)
+}
+
+// setClientAuth adds the client authentication for tokenURL to a token
+// endpoint request form.
+func setClientAuth(ctx context.Context, form url.Values, clientID, clientSecret, tokenURL string) error {
+	form.Set("client_id", clientID)
+	switch clientAuthMethod {
+	case privateKeyJWT:
+		assertion, err := signClientAssertion(clientID, tokenURL)
+		if err != nil {
+			return fmt.Errorf("sign client assertion: %w", err)
+		}
+		form.Set("client_assertion_type", clientAssertionType)
+		form.Set("client_assertion", assertion)
+	case jwtSVID:
+		svid, err := currentJWTSVID(ctx)
+		if err != nil {
+			return err
+		}
+		form.Set("client_assertion_type", clientAssertionType)
+		form.Set("client_assertion", svid)
+	default:
+		form.Set("client_secret", clientSecret)
+	}
+	return nil
+}
+
+// refreshClientAssertion replaces a private_key_jwt assertion in form with a
+// freshly signed one, for retries of the same request.
+func refreshClientAssertion(form url.Values, tokenURL string) error {
+	if clientAuthMethod != privateKeyJWT || form.Get("client_assertion") == "" {
+		return nil
+	}
+	assertion, err := signClientAssertion(form.Get("client_id"), tokenURL)
+	if err != nil {
+		return fmt.Errorf("sign client assertion: %w", err)
+	}
+	form.Set("client_assertion", assertion)
+	return nil
+}
+
+// signClientAssertion builds an RFC 7523 section 3 assertion: the client is
+// issuer and subject, and the token endpoint the audience.
+func signClientAssertion(clientID, tokenURL string) (string, error) {
+	jti := make([]byte, 16)
+	if _, err := rand.Read(jti); err != nil {
+		return "", err
+	}
+	now := time.Now()
+	token, err := jwt.NewBuilder().
+		Issuer(clientID).
+		Subject(clientID).
+		Audience([]string{tokenURL}).
+		JwtID(hex.EncodeToString(jti)).
+		IssuedAt(now).
+		Expiration(now.Add(clientAssertionTTL)).
+		Build()
+	if err != nil {
+		return "", err
+	}
+	signed, err := jwt.Sign(token, jwt.WithKey(clientAssertionAlg, clientAssertionKey))
+	if err != nil {
+		return "", err
+	}
+	return string(signed), nil
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/kagenti/kagenti-extensions/AuthBridge/AuthProxy/go-processor/internal/idp"
+	"github.com/kagenti/kagenti-extensions/AuthBridge/AuthProxy/go-processor/internal/mcppolicy"
+	"github.com/kagenti/kagenti-extensions/AuthBridge/AuthProxy/go-processor/internal/resolver"
+	"github.com/kagenti/kagenti-extensions/AuthBridge/AuthProxy/internal/mcpauth"
+	"github.com/kagenti/kagenti-extensions/configschema"
+)
+
+// processorEnv is the processor configuration, decoded from the environment
+// by configschema. Feature-specific settings are grouped in structs defined
+// next to the feature and passed to its loader.
+type processorEnv struct {
+	TokenURL       string `env:"TOKEN_URL" doc:"Token endpoint for exchanges; also locates the JWKS without OIDC discovery"`
+	TargetAudience string `env:"TARGET_AUDIENCE" doc:"Audience of exchanged tokens for hosts without a route"`
+	TargetScopes   string `env:"TARGET_SCOPES" doc:"Space-separated scopes requested for hosts without a route"`
+	// ClientID and ClientSecret are fallbacks for the credential files
+	ClientID     string `env:"CLIENT_ID" doc:"Client ID used when the credential file is absent"`
+	ClientSecret string `env:"CLIENT_SECRET" doc:"Client secret used when the credential file is absent"`
+
+	Issuer           string `env:"ISSUER" doc:"Expected issuer of inbound tokens; enables inbound validation"`
+	ExpectedAudience string `env:"EXPECTED_AUDIENCE" doc:"Required audience of inbound tokens"`
+	OIDCDiscovery    bool   `env:"OIDC_DISCOVERY" doc:"Discover the JWKS and endpoints from the issuer"`
+	DeadlineHeader   string `env:"DEADLINE_HEADER" default:"x-request-timeout-ms" doc:"Header carrying the remaining request budget in milliseconds"`
+
+	OIDCDiscoveryRefresh time.Duration `env:"OIDC_DISCOVERY_REFRESH" default:"1h" doc:"How often the issuer's metadata is discovered again"`
+	IntrospectionURL     string        `env:"INTROSPECTION_URL" doc:"RFC 7662 introspection endpoint of introspect routes; defaults to the discovered one, else TOKEN_URL + /introspect as in Keycloak"`
+	DPoPKeyFile          string        `env:"DPOP_KEY_FILE" doc:"PEM private key (RSA, EC or Ed25519) DPoP tokens are bound to; without it a key is generated at startup"`
+	InboundProbePaths    []string      `env:"INBOUND_PROBE_PATHS" doc:"port:path pairs of the app's kubelet probes that reach it without a token"`
+
+	RoutesConfigPath    string `env:"ROUTES_CONFIG_PATH" default:"/etc/authproxy/routes.yaml" doc:"Routes file; see -config-schema=routes"`
+	ClaimAssertionsPath string `env:"CLAIM_ASSERTIONS_PATH" default:"/etc/authproxy/claim-assertions.yaml" doc:"Claim assertions checked after inbound validation"`
+	IdPsConfigPath      string `env:"IDPS_CONFIG_PATH" default:"/etc/authproxy/idps.yaml" doc:"Identity providers keyed by token issuer; see -config-schema=idps"`
+	MCPCallPolicyPath   string `env:"MCP_CALL_POLICY_PATH" default:"/etc/authproxy/mcp-call-policy.yaml" doc:"Per-tool and per-resource requirements of inbound MCP calls; see -config-schema=mcp-call-policy"`
+	ControlHeadersPath  string `env:"CONTROL_HEADERS_PATH" default:"/etc/authproxy/control-headers.yaml" doc:"Names of the control headers and whether to strip them outbound; see -config-schema=control-headers"`
+	// ExpandConfigEnv turns on ${VAR} references in the files above
+	ExpandConfigEnv bool `env:"EXPAND_CONFIG_ENV" doc:"Expand ${NAME} and ${NAME:-fallback} in string values of the configuration files; $${ stands for a literal ${"`
+
+	PolicyHooks string `env:"POLICY_HOOKS" doc:"Comma-separated names of the policy hooks consulted before exchanges"`
+	// PolicyHooksFailOpen keeps exchanging when a policy hook errors
+	PolicyHooksFailOpen bool `env:"POLICY_HOOKS_FAIL_OPEN" doc:"Exchange anyway when a policy hook fails rather than denies; by default such requests are rejected with 403"`
+
+	// RouteMatching chooses among routes of the routes file matching a host
+	RouteMatching string `env:"ROUTE_MATCHING" default:"first" doc:"Route of the routes file applied when several match: first (in file order) or specific (most specific pattern)"`
+	// StrictRoutes turns skipped routes into startup and reload errors
+	StrictRoutes bool `env:"STRICT_ROUTES" doc:"Fail startup, and reject reloads, on invalid routes and duplicate hosts instead of skipping them; see -validate-routes"`
+
+	// UnmatchedHosts decides what happens to requests no route applies to
+	UnmatchedHosts string `env:"UNMATCHED_HOSTS" default:"global" doc:"Handling of hosts without a route: global (exchange with the global configuration if set, else forward), passthrough, exchange (reject requests that cannot be exchanged) or deny (403)"`
+
+	// RouteSources orders the routes file and the remote policy service
+	RouteSources             []string      `env:"ROUTE_SOURCES" doc:"Route sources consulted in order, first route found wins: file, service; defaults to service with ROUTES_SERVICE_URL, else file"`
+	RoutesServiceURL         string        `env:"ROUTES_SERVICE_URL" doc:"Policy service queried for the route of each host"`
+	RoutesServiceTTL         time.Duration `env:"ROUTES_SERVICE_TTL" default:"1m" doc:"How long routes of the policy service are reused"`
+	RoutesServiceNegativeTTL time.Duration `env:"ROUTES_SERVICE_NEGATIVE_TTL" default:"30s" doc:"How long hosts without a valid route at the policy service are remembered"`
+	RoutesServiceTimeout     time.Duration `env:"ROUTES_SERVICE_TIMEOUT" default:"5s" doc:"Timeout of policy service requests"`
+
+	// RouteCacheSize enables caching the route sources' configurations
+	RouteCacheSize int           `env:"ROUTE_CACHE_SIZE" doc:"Hosts whose configuration is cached in front of the route sources; 0 disables the cache"`
+	RouteCacheTTL  time.Duration `env:"ROUTE_CACHE_TTL" default:"30s" doc:"How long cached host configurations are reused"`
+
+	ExposeExchangeMetadata bool   `env:"EXPOSE_EXCHANGE_METADATA" doc:"Tell callers in response headers whether their request was exchanged and for how long the token is valid"`
+	DecisionTraceKey       string `env:"DECISION_TRACE_KEY" doc:"Value the x-authbridge-trace header must carry to trace a request's exchange decision"`
+	ConfigServiceEnabled   bool   `env:"CONFIG_SERVICE_ENABLED" doc:"Serve the gRPC config service pushing routes and claim assertions; requires TLS_CLIENT_CA_FILE"`
+	MetricsAddress         string `env:"METRICS_ADDRESS" doc:"Address Prometheus metrics are served on, e.g. :9091"`
+	AdminAddress           string `env:"ADMIN_ADDRESS" doc:"Loopback address of the admin server, e.g. 127.0.0.1:9092"`
+
+	Log             logEnv
+	Listener        listenerEnv
+	Credentials     credentialsEnv
+	Reload          reloadEnv
+	Shutdown        shutdownEnv
+	SPIFFE          spiffeEnv
+	ActorToken      actorTokenEnv
+	ClientAuth      clientAuthEnv
+	WorkloadToken   workloadTokenEnv
+	TokenClient     tokenClientEnv
+	SubjectToken    subjectTokenEnv
+	CSRF            csrfEnv
+	Challenge       challengeEnv
+	MCPAuth         mcpauth.Env
+	CallChain       callChainEnv
+	ResponsePolicy  responsePolicyEnv
+	ExchangeCache   exchangeCacheEnv
+	CacheReuse      cacheReuseEnv
+	ExchangeRetry   exchangeRetryEnv
+	Breaker         breakerEnv
+	ALS             alsEnv
+	StreamLimit     streamLimitEnv
+	Audit           auditEnv
+	RouteValidation routeValidationEnv
+}
+
+var configSchema = flag.String("config-schema", "",
+	`print the JSON Schema of "env" (the environment variables), "routes" (the routes file), "idps" (the identity providers file) or "mcp-call-policy" (the inbound MCP call policy) or "control-headers" (the control headers file) and exit`)
+
+// loadProcessorEnv decodes the environment variables and enables
+// ${VAR} expansion in configuration files if asked to; invalid values
+// are fatal.
+func loadProcessorEnv() processorEnv {
+	var env processorEnv
+	if err := configschema.DecodeEnv(os.LookupEnv, &env); err != nil {
+		fatal("Invalid configuration", "error", err)
+	}
+	configschema.SetExpandEnv(env.ExpandConfigEnv)
+	return env
+}
+
+// decodeStartupEnv decodes settings needed before main runs, such as flag
+// defaults. processorEnv embeds them too, so they are part of its schema.
+func decodeStartupEnv[T any]() T {
+	var env T
+	if err := configschema.DecodeEnv(os.LookupEnv, &env); err != nil {
+		fmt.Fprintln(os.Stderr, "Invalid configuration:", err)
+		os.Exit(1)
+	}
+	return env
+}
+
+// printConfigSchema handles -config-schema and reports whether it did.
+func printConfigSchema() bool {
+	var data []byte
+	var err error
+	switch *configSchema {
+	case "":
+		return false
+	case "env":
+		data, err = configschema.EnvSchema(processorEnv{}, "AuthBridge go-processor environment")
+	case "routes":
+		data, err = resolver.RoutesSchema()
+	case "idps":
+		data, err = idp.Schema()
+	case "mcp-call-policy":
+		data, err = mcppolicy.Schema()
+	case "control-headers":
+		data, err = controlHeadersSchema()
+	default:
+		err = fmt.Errorf("unknown schema %q, want env, routes, idps, mcp-call-policy or control-headers", *configSchema)
+	}
+	if err != nil {
+		fatal("Cannot print config schema", "error", err)
+	}
+	os.Stdout.Write(append(data, '\n'))
+	return true
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+
+	"google.golang.org/grpc"
+
+	"github.com/kagenti/kagenti-extensions/AuthBridge/AuthProxy/go-processor/internal/claims"
+	"github.com/kagenti/kagenti-extensions/AuthBridge/AuthProxy/go-processor/internal/configservice"
+)
+
+// registerConfigService adds the config service to the processor's gRPC
+// server when enabled (CONFIG_SERVICE_ENABLED). Pushed routes and claim
+// assertions replace those of the files, which are no longer reloaded for
+// that type; see reloader. Anyone who can call the service can change
+// routes, so it requires client certificates (TLS_CLIENT_CA_FILE).
+func registerConfigService(server *grpc.Server, r *reloader, enabled bool) error {
+	if !enabled {
+		return nil
+	}
+	if *tlsClientCAFile == "" {
+		return errors.New("CONFIG_SERVICE_ENABLED requires mTLS: set TLS_CLIENT_CA_FILE")
+	}
+	configservice.NewServer(map[string]configservice.ApplyFunc{
+		configservice.TypeRoutes:          r.pushRoutes,
+		configservice.TypeClaimAssertions: r.pushClaims,
+	}).Register(server)
+	reloadLog.Info("Config service enabled", "service", configservice.ServiceName)
+	return nil
+}
+
+// pushRoutes replaces the routes with pushed ones.
+func (r *reloader) pushRoutes(version string, docs [][]byte) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if err := r.routes.Update("routes version "+version, docs...); err != nil {
+		reloadLog.Error("Pushed routes rejected, keeping current routes", "version", version, "error", err)
+		return err
+	}
+	r.routesPushed = true
+	reloadLog.Info("Routes pushed", "version", version, "documents", len(docs))
+	return nil
+}
+
+// pushClaims replaces the claim assertions with pushed ones.
+func (r *reloader) pushClaims(version string, docs [][]byte) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	rules, err := claims.ParseRules(docs...)
+	if err != nil {
+		err = fmt.Errorf("claim assertions version %s: %w", version, err)
+		reloadLog.Error("Pushed claim assertions rejected, keeping current ones", "version", version, "error", err)
+		return err
+	}
+	setClaimRules(rules)
+	r.claimsPushed = true
+	reloadLog.Info("Claim assertions pushed", "version", version, "documents", len(docs))
+	return nil
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	core "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
+	v3 "github.com/envoyproxy/go-control-plane/envoy/service/ext_proc/v3"
+	"golang.org/x/net/http/httpguts"
+
+	"github.com/kagenti/kagenti-extensions/configschema"
+)
+
+// controlHeadersFile renames or disables the headers through which the app
+// steers the processor and the processor reports back to the app:
+//
+//	strip_outbound: true
+//	headers:
+//	  deadline: x-budget-ms
+//	  exchange_outcome: ""    # disabled
+//
+// Headers the file leaves out keep their names, including those set with
+// DEADLINE_HEADER and CALL_CHAIN_HEADER.
+type controlHeadersFile struct {
+	StripOutbound bool               `yaml:"strip_outbound,omitempty" doc:"Remove the deadline header from outbound requests once read, so it never reaches the target"`
+	Headers       controlHeaderNames `yaml:"headers,omitempty" doc:"Header names; an empty name disables the header"`
+}
+
+type controlHeaderNames struct {
+	Deadline        string `yaml:"deadline" doc:"Request: remaining request budget in milliseconds (default x-request-timeout-ms)"`
+	Trace           string `yaml:"trace" doc:"Request: decision trace key (default x-authbridge-trace)"`
+	CallChain       string `yaml:"call_chain" doc:"Request: signed agent call chain (default x-agent-call-chain)"`
+	TokenExchanged  string `yaml:"token_exchanged" doc:"Response: set when the request was exchanged (default x-authbridge-token-exchanged)"`
+	TokenExpiresIn  string `yaml:"token_expires_in" doc:"Response: exchanged token lifetime in seconds (default x-exchanged-token-expires-in)"`
+	ExchangeOutcome string `yaml:"exchange_outcome" doc:"Response: whether the exchange was performed or skipped (default x-authbridge-exchange)"`
+	Retry           string `yaml:"retry" doc:"Response: marks an upstream 401 a retry gets a fresh token for (default x-authbridge-retry)"`
+}
+
+// Validate checks that every enabled header has a valid, distinct name.
+func (f *controlHeadersFile) Validate() error {
+	n := f.Headers
+	seen := make(map[string]bool)
+	for _, name := range []string{n.Deadline, n.Trace, n.CallChain, n.TokenExchanged, n.TokenExpiresIn, n.ExchangeOutcome, n.Retry} {
+		if name == "" {
+			continue
+		}
+		if !httpguts.ValidHeaderFieldName(name) {
+			return fmt.Errorf("invalid header name %q", name)
+		}
+		if seen[strings.ToLower(name)] {
+			return fmt.Errorf("header %q used twice", name)
+		}
+		seen[strings.ToLower(name)] = true
+	}
+	return nil
+}
+
+// stripOutboundControlHeaders is set by strip_outbound.
+var stripOutboundControlHeaders bool
+
+// controlHeadersSchema returns the JSON Schema of the control headers file.
+func controlHeadersSchema() ([]byte, error) {
+	return configschema.Schema(controlHeadersFile{}, "AuthBridge control headers")
+}
+
+// loadControlHeaders applies the control headers file at path, if any.
+// Invalid files are fatal.
+func loadControlHeaders(path string) {
+	content, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return
+	}
+	if err != nil {
+		fatal("Cannot read control headers file", "path", path, "error", err)
+	}
+	f := controlHeadersFile{Headers: controlHeaderNames{
+		Deadline:        deadlineHeader,
+		Trace:           traceHeader,
+		CallChain:       callChainHeader,
+		TokenExchanged:  exchangedHeader,
+		TokenExpiresIn:  exchangedExpiresInHeader,
+		ExchangeOutcome: exchangeDiagnosticsHeader,
+		Retry:           retryHeader,
+	}}
+	if err := configschema.Decode(content, &f); err != nil {
+		fatal("Invalid control headers file", "path", path, "error", err)
+	}
+	n := f.Headers
+	deadlineHeader = strings.ToLower(n.Deadline)
+	traceHeader = strings.ToLower(n.Trace)
+	callChainHeader = strings.ToLower(n.CallChain)
+	exchangedHeader = strings.ToLower(n.TokenExchanged)
+	exchangedExpiresInHeader = strings.ToLower(n.TokenExpiresIn)
+	exchangeDiagnosticsHeader = strings.ToLower(n.ExchangeOutcome)
+	retryHeader = strings.ToLower(n.Retry)
+	stripOutboundControlHeaders = f.StripOutbound
+
+	if callChainHeader == "" && callChainSigner != nil {
+		callChainSigner = nil
+		rootLogger.Warn("Call chain header disabled, not propagating call chains")
+	}
+	configLog.Info("Control headers loaded", "path", path, "strip_outbound", stripOutboundControlHeaders,
+		"deadline", deadlineHeader, "trace", traceHeader, "call_chain", callChainHeader,
+		"token_exchanged", exchangedHeader, "token_expires_in", exchangedExpiresInHeader,
+		"exchange_outcome", exchangeDiagnosticsHeader, "retry", retryHeader)
+}
+
+// stripControlHeaders removes the deadline header from an outbound
+// request-headers response when strip_outbound is set, both the caller's and
+// the one applyUpstreamTimeout sets; the route timeout still bounds the
+// upstream request. The trace header is always removed, and the call chain
+// is meant for the target and is kept. Immediate responses are left
+// untouched.
+func stripControlHeaders(resp *v3.ProcessingResponse, headers []*core.HeaderValue) {
+	rh := resp.GetRequestHeaders()
+	if !stripOutboundControlHeaders || rh == nil || deadlineHeader == "" {
+		return
+	}
+	if rh.Response != nil && rh.Response.HeaderMutation != nil {
+		mutation := rh.Response.HeaderMutation
+		kept := mutation.SetHeaders[:0]
+		for _, h := range mutation.SetHeaders {
+			if !strings.EqualFold(h.GetHeader().GetKey(), deadlineHeader) {
+				kept = append(kept, h)
+			}
+		}
+		mutation.SetHeaders = kept
+	}
+	if !hasHeader(headers, deadlineHeader) {
+		return
+	}
+	if rh.Response == nil {
+		rh.Response = &v3.CommonResponse{}
+	}
+	if rh.Response.HeaderMutation == nil {
+		rh.Response.HeaderMutation = &v3.HeaderMutation{}
+	}
+	rh.Response.HeaderMutation.RemoveHeaders = append(rh.Response.HeaderMutation.RemoveHeaders, deadlineHeader)
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	core "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
+	v3 "github.com/envoyproxy/go-control-plane/envoy/service/ext_proc/v3"
+	"github.com/kagenti/kagenti-extensions/AuthBridge/AuthProxy/go-processor/internal/resolver"
+)
+
+// credentialHeaders must never be honoured from the wire: client credentials
+// come only from the processor's own configuration (files or environment).
+// They are stripped from every request so neither the application nor the
+// target ever receives caller-supplied credentials.
+var credentialHeaders = []string{"x-client-id", "x-client-secret"}
+
+// credentialsEnv locates the client credential files. They are usually
+// written by client-registration or mounted from a Kubernetes Secret.
+type credentialsEnv struct {
+	ClientIDFile     string        `env:"CLIENT_ID_FILE" default:"/shared/client-id.txt" doc:"Client ID file; preferred over CLIENT_ID"`
+	ClientSecretFile string        `env:"CLIENT_SECRET_FILE" default:"/shared/client-secret.txt" doc:"Client secret file; preferred over CLIENT_SECRET"`
+	ReloadInterval   time.Duration `env:"CREDENTIALS_RELOAD_INTERVAL" default:"30s" doc:"How often the credential files are re-read; 0 disables reloading"`
+}
+
+// resolveSecretRef reads a route's client secret. Files are read on every
+// call, so a rotated Secret applies to the next request.
+func resolveSecretRef(ref resolver.SecretRef) (string, error) {
+	switch {
+	case ref.File != "":
+		return readFileContent(ref.File)
+	case ref.Env != "":
+		if v := os.Getenv(ref.Env); v != "" {
+			return v, nil
+		}
+		return "", fmt.Errorf("environment variable %s is not set", ref.Env)
+	}
+	return "", nil
+}
+
+// watchCredentials re-reads the credential files every interval and swaps in
+// changed values, so rotated Secrets take effect without a restart.
+func watchCredentials(clientIDFile, clientSecretFile string, interval time.Duration) {
+	for range time.Tick(interval) {
+		reloadCredentials(clientIDFile, clientSecretFile)
+	}
+}
+
+// reloadCredentials swaps in the credentials of the files if they changed.
+// Missing or empty files keep the current values; the client secret file is
+// only needed with client_secret_post (see hasClientCredentials).
+func reloadCredentials(clientIDFile, clientSecretFile string) {
+	clientID, err := readFileContent(clientIDFile)
+	if err != nil {
+		return
+	}
+	clientSecret, err := readFileContent(clientSecretFile)
+	if err != nil {
+		clientSecret = ""
+	}
+	if !hasClientCredentials(clientID, clientSecret) {
+		return
+	}
+
+	globalConfig.mu.Lock()
+	changed := clientID != globalConfig.ClientID || clientSecret != globalConfig.ClientSecret
+	if changed {
+		globalConfig.ClientID = clientID
+		globalConfig.ClientSecret = clientSecret
+	}
+	globalConfig.mu.Unlock()
+
+	if changed {
+		configLog.Info("Reloaded client credentials", "client_id_file", clientIDFile, "client_secret_file", clientSecretFile)
+	}
+}
+
+// startCredentialsWatch starts watchCredentials unless disabled with
+// CREDENTIALS_RELOAD_INTERVAL=0.
+func startCredentialsWatch(env credentialsEnv) {
+	interval := env.ReloadInterval
+	if interval < 0 {
+		fatal("Invalid CREDENTIALS_RELOAD_INTERVAL", "value", interval)
+	}
+	if interval == 0 {
+		configLog.Info("Credential file reload disabled")
+		return
+	}
+	go watchCredentials(env.ClientIDFile, env.ClientSecretFile, interval)
+	configLog.Info("Reloading credential files", "interval", interval)
+}
+
+// stripCredentialHeaders removes credential headers supplied by the caller
+// from a request-headers response. Immediate responses are left untouched.
+func stripCredentialHeaders(resp *v3.ProcessingResponse, headers []*core.HeaderValue) {
+	rh := resp.GetRequestHeaders()
+	if rh == nil {
+		return
+	}
+	for _, name := range credentialHeaders {
+		if !hasHeader(headers, name) {
+			continue
+		}
+		configLog.Warn("Ignoring and removing caller-supplied credential header", "header", name)
+		if rh.Response == nil {
+			rh.Response = &v3.CommonResponse{}
+		}
+		if rh.Response.HeaderMutation == nil {
+			rh.Response.HeaderMutation = &v3.HeaderMutation{}
+		}
+		rh.Response.HeaderMutation.RemoveHeaders = append(rh.Response.HeaderMutation.RemoveHeaders, name)
+	}
+}
+
+func hasHeader(headers []*core.HeaderValue, name string) bool {
+	for _, h := range headers {
+		if strings.EqualFold(h.Key, name) {
+			return true
+		}
+	}
+	return false
+}
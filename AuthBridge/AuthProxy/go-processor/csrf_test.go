@@ -0,0 +1,85 @@
+package main
+
+import (
+	"testing"
+
+	core "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
+)
+
+// requestHeaders builds Envoy request headers from name/value pairs.
+func requestHeaders(pairs ...string) []*core.HeaderValue {
+	var headers []*core.HeaderValue
+	for i := 0; i+1 < len(pairs); i += 2 {
+		headers = append(headers, &core.HeaderValue{Key: pairs[i], RawValue: []byte(pairs[i+1])})
+	}
+	return headers
+}
+
+func TestCheckCSRF(t *testing.T) {
+	saved := csrf
+	t.Cleanup(func() { csrf = saved })
+	csrf = csrfConfig{Enabled: true, CookieName: "authbridge_csrf", HeaderName: "x-csrf-token", AllowedOrigins: map[string]bool{}}
+
+	tests := []struct {
+		name    string
+		headers []*core.HeaderValue
+		wantErr string
+	}{
+		{
+			name:    "tokens match",
+			headers: requestHeaders(":method", "POST", ":authority", "app.example.com", "cookie", "session=s1; authbridge_csrf=abc123", "x-csrf-token", "abc123"),
+		},
+		{
+			name:    "tokens differ",
+			headers: requestHeaders(":method", "POST", ":authority", "app.example.com", "cookie", "authbridge_csrf=abc123", "x-csrf-token", "xyz789"),
+			wantErr: "CSRF token mismatch",
+		},
+		{
+			name:    "header token missing",
+			headers: requestHeaders(":method", "DELETE", ":authority", "app.example.com", "cookie", "authbridge_csrf=abc123"),
+			wantErr: "missing CSRF token",
+		},
+		{
+			name:    "cookie token missing",
+			headers: requestHeaders(":method", "PUT", ":authority", "app.example.com", "cookie", "session=s1", "x-csrf-token", "abc123"),
+			wantErr: "missing CSRF token",
+		},
+		{
+			name:    "cross-site",
+			headers: requestHeaders(":method", "POST", ":authority", "app.example.com", "cookie", "authbridge_csrf=abc123", "x-csrf-token", "abc123", "sec-fetch-site", "cross-site"),
+			wantErr: "cross-site request rejected",
+		},
+		{
+			name:    "GET is safe",
+			headers: requestHeaders(":method", "GET", ":authority", "app.example.com", "cookie", "session=s1"),
+		},
+		{
+			name:    "HEAD is safe",
+			headers: requestHeaders(":method", "HEAD", ":authority", "app.example.com", "cookie", "session=s1"),
+		},
+		{
+			name:    "OPTIONS is safe",
+			headers: requestHeaders(":method", "OPTIONS", ":authority", "app.example.com", "cookie", "session=s1"),
+		},
+		{
+			name:    "TRACE is checked",
+			headers: requestHeaders(":method", "TRACE", ":authority", "app.example.com", "cookie", "session=s1"),
+			wantErr: "missing CSRF token",
+		},
+		{
+			name:    "no cookies",
+			headers: requestHeaders(":method", "POST", ":authority", "app.example.com", "authorization", "Bearer token"),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkCSRF(tt.headers)
+			switch {
+			case tt.wantErr == "" && err != nil:
+				t.Errorf("unexpected error: %v", err)
+			case tt.wantErr != "" && (err == nil || err.Error() != tt.wantErr):
+				t.Errorf("error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
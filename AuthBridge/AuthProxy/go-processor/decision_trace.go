@@ -0,0 +1,115 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"log/slog"
+	"os"
+
+	core "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
+	v3 "github.com/envoyproxy/go-control-plane/envoy/service/ext_proc/v3"
+
+	"github.com/kagenti/kagenti-extensions/AuthBridge/AuthProxy/go-processor/internal/resolver"
+)
+
+// A decision trace logs every step of one outbound request's exchange
+// decision (route, effective parameters, cache use, IdP result) at info,
+// whatever LOG_LEVEL is, so a single request can be debugged in production.
+// It is requested by:
+//   - the x-authbridge-trace header, whose value must equal DECISION_TRACE_KEY;
+//     without the key the header is ignored. The header is never forwarded.
+//   - Envoy dynamic metadata trace: true in the "authbridge" namespace, sent
+//     with metadata_options.forwarding_namespaces.untyped: [authbridge], e.g.
+//     set by a Lua or RBAC filter.
+//
+// Secrets are redacted as in every log line; tokens are never traced.
+const traceMetadataNamespace = "authbridge"
+
+var (
+	// traceHeader is renamed or disabled in the control headers file
+	traceHeader      = "x-authbridge-trace"
+	decisionTraceKey string
+	// traceLog ignores LOG_LEVEL unless it is off
+	traceLog = slog.New(newHandler(os.Stderr, traceLevel{}, startupLogEnv.Format)).With("component", "trace")
+)
+
+// traceLevel enables info while logging is not off.
+type traceLevel struct{}
+
+func (traceLevel) Level() slog.Level {
+	if logLevel.Level() >= levelOff {
+		return levelOff
+	}
+	return slog.LevelInfo
+}
+
+// loadDecisionTraceConfig sets key (DECISION_TRACE_KEY), the value the trace
+// header must carry.
+func loadDecisionTraceConfig(key string) {
+	decisionTraceKey = key
+	if decisionTraceKey != "" {
+		rootLogger.Info("Decision traces enabled", "header", traceHeader)
+	}
+}
+
+// startDecisionTrace enables tracing for the stream if its request asks for
+// it.
+func startDecisionTrace(req *v3.ProcessingRequest, headers []*core.HeaderValue, state *streamState) {
+	trigger := ""
+	if v := getHeaderValue(headers, traceHeader); v != "" && traceHeader != "" && decisionTraceKey != "" &&
+		subtle.ConstantTimeCompare([]byte(v), []byte(decisionTraceKey)) == 1 {
+		trigger = "header"
+	} else if md := req.GetMetadataContext().GetFilterMetadata()[traceMetadataNamespace]; md.GetFields()["trace"].GetBoolValue() {
+		trigger = "metadata"
+	}
+	if trigger == "" {
+		return
+	}
+	state.trace = traceLog.With("request_id", getHeaderValue(headers, "x-request-id"), "host", getHostFromHeaders(headers))
+	traceStep(state.withTrace(context.Background()), "Trace started", "trigger", trigger,
+		"method", getHeaderValue(headers, ":method"), "path", getHeaderValue(headers, ":path"))
+}
+
+type traceKey struct{}
+
+// withTrace returns ctx carrying the stream's trace, if any, for traceStep.
+func (s *streamState) withTrace(ctx context.Context) context.Context {
+	if s.trace == nil {
+		return ctx
+	}
+	return context.WithValue(ctx, traceKey{}, s)
+}
+
+// traceStep logs a step of the decision if ctx carries a trace.
+func traceStep(ctx context.Context, msg string, args ...any) {
+	s, _ := ctx.Value(traceKey{}).(*streamState)
+	if s == nil {
+		return
+	}
+	s.traceSteps++
+	s.trace.Info(msg, append([]any{"step", s.traceSteps}, args...)...)
+}
+
+// traceRoute logs the route a request resolved to.
+func traceRoute(ctx context.Context, cfg *resolver.TargetConfig, err error) {
+	switch {
+	case err != nil:
+		traceStep(ctx, "Route resolution failed", "error", err)
+	case cfg == nil:
+		traceStep(ctx, "No route matched, using global configuration")
+	default:
+		traceStep(ctx, "Route matched", "audience", cfg.Audience, "scopes", cfg.Scopes, "max_scopes", cfg.MaxScopes,
+			"token_url", cfg.TokenEndpoint, "client_id", cfg.ClientID, "passthrough", cfg.Passthrough,
+			"workload_identity", cfg.WorkloadIdentity, "introspect", cfg.Introspect, "require_exchange", cfg.RequireExchange,
+			"mcp_tools", len(cfg.MCPTools), "a2a", cfg.A2A != nil)
+	}
+}
+
+// traceTokenAttempt logs one call to a token endpoint.
+func traceTokenAttempt(ctx context.Context, tokenURL string, attempt int, resp *tokenResponse, err error) {
+	if err != nil {
+		traceStep(ctx, "Token endpoint call failed", "token_url", tokenURL, "attempt", attempt+1, "error", err)
+		return
+	}
+	traceStep(ctx, "Token endpoint responded", "token_url", tokenURL, "attempt", attempt+1, "status", resp.StatusCode)
+}
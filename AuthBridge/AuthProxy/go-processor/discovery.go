@@ -0,0 +1,81 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/lestrrat-go/jwx/v2/jwk"
+
+	"github.com/kagenti/kagenti-extensions/AuthBridge/AuthProxy/go-processor/internal/oidc"
+)
+
+const discoveryRetry = 15 * time.Second
+
+// oidcDiscovery is set when OIDC_DISCOVERY=true; endpoints are then taken from
+// ISSUER's discovery document instead of being derived from TOKEN_URL.
+var oidcDiscovery *oidc.Cache
+
+var inboundJWKSMu sync.RWMutex
+
+func setInboundJWKSURL(u string) {
+	inboundJWKSMu.Lock()
+	defer inboundJWKSMu.Unlock()
+	inboundJWKSURL = u
+}
+
+func getInboundJWKSURL() string {
+	inboundJWKSMu.RLock()
+	defer inboundJWKSMu.RUnlock()
+	return inboundJWKSURL
+}
+
+// startOIDCDiscovery creates the JWKS cache up front so inbound validation
+// fails closed until the first discovery succeeds, then keeps the JWKS URL
+// and (unless TOKEN_URL was set explicitly) the token endpoint current.
+func startOIDCDiscovery(issuer string, refresh time.Duration) {
+	if refresh <= 0 {
+		fatal("Invalid OIDC_DISCOVERY_REFRESH", "value", refresh)
+	}
+
+	ctx := context.Background()
+	jwksCache = jwk.NewCache(ctx)
+
+	_, _, tokenURL, _, _ := getConfig()
+	tokenURLFromDiscovery := tokenURL == ""
+
+	oidcDiscovery = &oidc.Cache{
+		Issuer: issuer,
+		Client: &http.Client{Timeout: 10 * time.Second},
+		OnChange: func(_, md *oidc.Metadata) {
+			if !jwksCache.IsRegistered(md.JWKSURI) {
+				if err := jwksCache.Register(md.JWKSURI); err != nil {
+					discoveryLog.Error("Failed to register JWKS URL", "jwks_uri", md.JWKSURI, "error", err)
+					return
+				}
+			}
+			setInboundJWKSURL(md.JWKSURI)
+			discoveryLog.Info("Discovered JWKS URL", "jwks_uri", md.JWKSURI)
+
+			if tokenURLFromDiscovery && md.TokenEndpoint != "" {
+				globalConfig.mu.Lock()
+				globalConfig.TokenURL = md.TokenEndpoint
+				globalConfig.mu.Unlock()
+				discoveryLog.Info("Discovered token endpoint", "token_endpoint", md.TokenEndpoint)
+			}
+			if md.IntrospectionEndpoint != "" {
+				discoveryLog.Info("Discovered introspection endpoint", "introspection_endpoint", md.IntrospectionEndpoint)
+			}
+		},
+	}
+
+	// Resolve once synchronously so the first requests already validate.
+	if err := oidcDiscovery.Refresh(ctx); err != nil {
+		discoveryLog.Warn("Initial discovery failed, retrying in background", "issuer", issuer, "error", err)
+	}
+	go oidcDiscovery.Run(ctx, refresh, discoveryRetry, func(err error) {
+		discoveryLog.Warn("Refresh failed, keeping last known endpoints", "error", err)
+	})
+	discoveryLog.Info("OIDC discovery enabled", "issuer", issuer, "refresh", refresh)
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"sync"
+
+	core "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
+
+	"github.com/kagenti/kagenti-extensions/AuthBridge/AuthProxy/go-processor/internal/dpop"
+)
+
+// dpopProofer signs the DPoP proofs of routes with dpop: true.
+var dpopProofer *dpop.Proofer
+
+// loadDPoPConfig loads the PEM private key (RSA, EC or Ed25519) at path
+// (DPOP_KEY_FILE) that tokens are bound to. Without it a P-256 key is
+// generated at startup, so bound tokens do not survive a restart.
+func loadDPoPConfig(path string) {
+	var err error
+	if path != "" {
+		key, alg, kerr := loadAssertionKey(path, "")
+		if kerr != nil {
+			fatal("Invalid DPOP_KEY_FILE", "path", path, "error", kerr)
+		}
+		dpopProofer, err = dpop.New(key, alg)
+	} else {
+		dpopProofer, err = dpop.Generate()
+	}
+	if err != nil {
+		fatal("Cannot create DPoP key", "error", err)
+	}
+	exchangeLog.Info("DPoP key", "key_file", path, "jkt", dpopProofer.Thumbprint())
+}
+
+type dpopKey struct{}
+
+// withDPoP makes token endpoint calls with ctx send DPoP proofs.
+func withDPoP(ctx context.Context, enabled bool) context.Context {
+	if !enabled {
+		return ctx
+	}
+	return context.WithValue(ctx, dpopKey{}, true)
+}
+
+func dpopRequested(ctx context.Context) bool {
+	enabled, _ := ctx.Value(dpopKey{}).(bool)
+	return enabled
+}
+
+// dpopNonces remembers the last DPoP-Nonce each token endpoint sent, to be
+// echoed in the next proof.
+var dpopNonces = &nonceCache{nonces: make(map[string]string)}
+
+type nonceCache struct {
+	mu     sync.Mutex
+	nonces map[string]string
+}
+
+func (c *nonceCache) get(tokenURL string) string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.nonces[tokenURL]
+}
+
+func (c *nonceCache) set(tokenURL, nonce string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.nonces[tokenURL] = nonce
+}
+
+// setDPoPProof adds a proof for the token endpoint call to req when ctx asks
+// for DPoP.
+func setDPoPProof(ctx context.Context, req *http.Request) error {
+	if !dpopRequested(ctx) {
+		return nil
+	}
+	tokenURL := req.URL.String()
+	proof, err := dpopProofer.Proof(req.Method, tokenURL, "", dpopNonces.get(tokenURL))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("DPoP", proof)
+	return nil
+}
+
+// useDPoPNonce reports whether the token endpoint rejected a DPoP request
+// only because the proof lacked the nonce it has just sent (RFC 9449 §8).
+func useDPoPNonce(ctx context.Context, resp *tokenResponse) bool {
+	if !dpopRequested(ctx) || resp.StatusCode != http.StatusBadRequest || resp.DPoPNonce == "" {
+		return false
+	}
+	var body struct {
+		Error string `json:"error"`
+	}
+	return json.Unmarshal(resp.Body, &body) == nil && body.Error == "use_dpop_nonce"
+}
+
+// dpopAuthorization returns the Authorization value, and the DPoP proof if
+// any, for sending an exchanged token on the request with headers. Tokens
+// the IdP issued as DPoP-bound are sent with a fresh proof for that request;
+// an IdP without DPoP support issues plain bearer tokens, sent as such.
+func dpopAuthorization(headers []*core.HeaderValue, tokenResp tokenExchangeResponse) (authorization, proof string, err error) {
+	if !strings.EqualFold(tokenResp.TokenType, "DPoP") {
+		return "Bearer " + tokenResp.AccessToken, "", nil
+	}
+	scheme := getHeaderValue(headers, ":scheme")
+	if scheme == "" {
+		scheme = "http"
+	}
+	uri := scheme + "://" + getHostFromHeaders(headers) + getHeaderValue(headers, ":path")
+	proof, err = dpopProofer.Proof(getHeaderValue(headers, ":method"), uri, tokenResp.AccessToken, "")
+	if err != nil {
+		return "", "", err
+	}
+	return "DPoP " + tokenResp.AccessToken, proof, nil
+}
@@ -0,0 +1,192 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/lestrrat-go/jwx/v2/jwt"
+)
+
+// exchangeCache is nil unless EXCHANGE_CACHE=true.
+var exchangeCache *exchangedTokenCache
+
+// exchangeCacheEnv configures the exchange cache.
+type exchangeCacheEnv struct {
+	Enabled bool `env:"EXCHANGE_CACHE" doc:"Reuse exchanged tokens for repeated requests with the same subject token and exchange parameters"`
+	Size    int  `env:"EXCHANGE_CACHE_SIZE" default:"10000" doc:"Exchanged tokens cached at once"`
+}
+
+func loadExchangeCacheConfig(env exchangeCacheEnv) {
+	if !env.Enabled {
+		return
+	}
+	size := env.Size
+	if size <= 0 {
+		fatal("Invalid EXCHANGE_CACHE_SIZE", "value", size)
+	}
+	exchangeCache = &exchangedTokenCache{max: size, entries: make(map[string]*exchangeCacheEntry)}
+	exchangeLog.Info("Exchange cache enabled", "size", size)
+}
+
+// exchangedTokenCache keeps exchanged tokens until most of their lifetime
+// has passed, keyed by a hash of the subject token and every exchange
+// parameter, so a token is only reused for the caller it was issued for.
+// Subject tokens are not kept.
+type exchangedTokenCache struct {
+	max     int
+	mu      sync.Mutex
+	entries map[string]*exchangeCacheEntry
+
+	hits, misses atomic.Uint64
+}
+
+type exchangeCacheEntry struct {
+	// mu serializes exchanges, so concurrent requests wait for one call
+	mu        sync.Mutex
+	resp      tokenExchangeResponse
+	expiresAt time.Time
+	refreshAt time.Time
+	// rejected is set when an upstream rejected the entry's token, until
+	// the next exchange; reexchanged marks a token exchanged after that.
+	rejected    bool
+	reexchanged bool
+}
+
+// entry returns the entry for the exchange parameters, or nil if the cache
+// is full of live tokens.
+func (c *exchangedTokenCache) entry(parts ...string) *exchangeCacheEntry {
+	key := exchangeKey(parts...)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if e := c.entries[key]; e != nil {
+		return e
+	}
+	if len(c.entries) >= c.max {
+		c.pruneLocked(time.Now())
+		if len(c.entries) >= c.max {
+			return nil
+		}
+	}
+	e := &exchangeCacheEntry{}
+	c.entries[key] = e
+	return e
+}
+
+// exchangeKey hashes the subject token and exchange parameters of an
+// exchange.
+func exchangeKey(parts ...string) string {
+	h := sha256.New()
+	for _, p := range parts {
+		h.Write([]byte(p))
+		h.Write([]byte{0})
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// pruneLocked drops entries whose token has expired. Entries being
+// exchanged are kept.
+func (c *exchangedTokenCache) pruneLocked(now time.Time) {
+	for k, e := range c.entries {
+		if !e.mu.TryLock() {
+			continue
+		}
+		if now.After(e.expiresAt) {
+			delete(c.entries, k)
+		}
+		e.mu.Unlock()
+	}
+}
+
+// stats reports the cache for the admin server; a nil cache is disabled.
+func (c *exchangedTokenCache) stats() cacheStats {
+	if c == nil {
+		return cacheStats{}
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return cacheStats{Enabled: true, Entries: len(c.entries), MaxEntries: c.max, Hits: c.hits.Load(), Misses: c.misses.Load()}
+}
+
+// flush drops every cached token and returns how many there were. Requests
+// holding an entry still finish with it.
+func (c *exchangedTokenCache) flush() int {
+	if c == nil {
+		return 0
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	n := len(c.entries)
+	c.entries = make(map[string]*exchangeCacheEntry)
+	return n
+}
+
+// reject drops token after an upstream answered it with 401 and reports
+// whether a retry may succeed: false when token was itself exchanged after
+// a rejection, so one refresh is tried per rejection rather than a loop.
+func (e *exchangeCacheEntry) reject(token string) bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.resp.AccessToken != token {
+		// Another request already replaced it
+		return true
+	}
+	if e.reexchanged {
+		return false
+	}
+	e.resp = tokenExchangeResponse{}
+	e.rejected = true
+	return true
+}
+
+// cachedExchangeToken returns an exchanged token from the cache or, on a
+// miss, from exchangeToken, and the cache entry holding it (nil without a
+// cache). The token is cached for most of its lifetime, but never beyond
+// the subject token's expiry; tokens without a reported lifetime are not
+// reused.
+func cachedExchangeToken(ctx context.Context, dpop bool, clientID, clientSecret, tokenURL, subjectToken, subjectTokenType, audience, scopes string) (tokenExchangeResponse, *exchangeCacheEntry, error) {
+	if exchangeCache == nil {
+		resp, err := exchangeToken(ctx, clientID, clientSecret, tokenURL, subjectToken, subjectTokenType, audience, scopes)
+		return resp, nil, err
+	}
+	e := exchangeCache.entry(subjectToken, subjectTokenType, clientID, tokenURL, audience, scopes, strconv.FormatBool(dpop))
+	if e == nil {
+		exchangeLog.Debug("Exchange cache full, not caching")
+		exchangeCache.misses.Add(1)
+		resp, err := exchangeToken(ctx, clientID, clientSecret, tokenURL, subjectToken, subjectTokenType, audience, scopes)
+		return resp, nil, err
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	now := time.Now()
+	if e.resp.AccessToken != "" && now.Before(e.refreshAt) {
+		exchangeCache.hits.Add(1)
+		traceStep(ctx, "Exchanged token from cache", "refresh_at", e.refreshAt)
+		resp := e.resp
+		resp.ExpiresIn = int(e.expiresAt.Sub(now).Seconds())
+		return resp, e, nil
+	}
+	exchangeCache.misses.Add(1)
+	resp, err := exchangeToken(ctx, clientID, clientSecret, tokenURL, subjectToken, subjectTokenType, audience, scopes)
+	if err != nil {
+		return resp, nil, err
+	}
+	e.reexchanged, e.rejected = e.rejected, false
+	if e.reexchanged {
+		traceStep(ctx, "Exchanged again after an upstream rejection")
+	}
+	expiresAt := now.Add(time.Duration(resp.ExpiresIn) * time.Second)
+	if t, err := jwt.ParseInsecure([]byte(subjectToken)); err == nil && !t.Expiration().IsZero() && t.Expiration().Before(expiresAt) {
+		expiresAt = t.Expiration()
+	}
+	e.resp = resp
+	e.expiresAt = expiresAt
+	e.refreshAt = now.Add(time.Duration(float64(expiresAt.Sub(now)) * cacheReuse.fraction()))
+	return resp, e, nil
+}
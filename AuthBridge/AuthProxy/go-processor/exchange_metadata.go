@@ -0,0 +1,122 @@
+package main
+
+import (
+	"log/slog"
+	"strconv"
+
+	core "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
+	extprocfilter "github.com/envoyproxy/go-control-plane/envoy/extensions/filters/http/ext_proc/v3"
+	v3 "github.com/envoyproxy/go-control-plane/envoy/service/ext_proc/v3"
+
+	"github.com/kagenti/kagenti-extensions/AuthBridge/AuthProxy/go-processor/internal/resolver"
+)
+
+// Response headers returned to the original caller after a token exchange,
+// so agent frameworks can cache per-target decisions client-side. Renamed or
+// disabled in the control headers file.
+var (
+	exchangedHeader          = "x-authbridge-token-exchanged"
+	exchangedExpiresInHeader = "x-exchanged-token-expires-in"
+)
+
+// exposeExchangeMetadata enables the response headers above. Configurable via
+// EXPOSE_EXCHANGE_METADATA=true.
+var exposeExchangeMetadata bool
+
+func loadExchangeMetadataConfig(expose bool) {
+	exposeExchangeMetadata = expose
+	if exposeExchangeMetadata {
+		exchangeLog.Info("Exchange metadata response headers enabled")
+	}
+}
+
+// streamState carries what the request phase learned to the response phase
+// of the same ext_proc stream (one stream per HTTP request).
+type streamState struct {
+	exchanged bool
+	// expiresIn is the exchanged token lifetime in seconds, 0 if unknown
+	expiresIn int
+
+	// bodyFollows is set when the request headers did not end the stream
+	bodyFollows bool
+	// pendingHeaders are the request headers of an exchange waiting for the
+	// body; see request_body.go
+	pendingHeaders *core.HeaderMap
+	bodyInspected  bool
+	// mcpTool and a2aMethod are what the request body calls, if anything
+	mcpTool   string
+	a2aMethod string
+
+	// workloadToken is the cache entry of the workload token the request
+	// was sent with, dropped on an upstream 401; see response_policy.go
+	workloadToken      *workloadTokenEntry
+	workloadTokenValue string
+	// exchangeEntry is the exchange cache entry of the exchanged token the
+	// request was sent with; see exchange_cache.go
+	exchangeEntry  *exchangeCacheEntry
+	exchangedToken string
+	// uncachedExchange is the exchangeKey of an exchange without a cache
+	// entry, set when an upstream 401 may be retried; see response_policy.go
+	uncachedExchange string
+
+	// inboundClaims are the validated token's claims of an inbound request
+	// waiting for its body; see mcp_call_policy.go
+	inboundClaims map[string]interface{}
+
+	// envoyRoute is the route Envoy sent with the request, nil when the
+	// routes file applies; see route_metadata.go
+	envoyRoute []byte
+
+	// responseHeaderRules are the route's response_headers, if any
+	responseHeaderRules *resolver.HeaderRules
+
+	// trace logs the request's decision steps, nil unless requested; see
+	// decision_trace.go
+	trace      *slog.Logger
+	traceSteps int
+}
+
+// exchangeMetadataModeOverride asks Envoy to send response headers for this
+// request only, so exchanged requests can be annotated, or the response
+// policy applied, while every other request keeps response_header_mode: SKIP.
+// Requires allow_mode_override.
+func exchangeMetadataModeOverride() *extprocfilter.ProcessingMode {
+	return &extprocfilter.ProcessingMode{
+		RequestHeaderMode:  extprocfilter.ProcessingMode_SEND,
+		ResponseHeaderMode: extprocfilter.ProcessingMode_SEND,
+		RequestBodyMode:    extprocfilter.ProcessingMode_NONE,
+		ResponseBodyMode:   extprocfilter.ProcessingMode_NONE,
+	}
+}
+
+// responseHeadersResponse returns the response-phase reply, adding exchange
+// metadata headers when an exchange happened on this stream and applying the
+// response policy.
+func responseHeadersResponse(headers []*core.HeaderValue, state *streamState) *v3.ProcessingResponse {
+	headersResponse := &v3.HeadersResponse{}
+	mutation := &v3.HeaderMutation{}
+	if exposeExchangeMetadata && state.exchanged {
+		if exchangedHeader != "" {
+			mutation.SetHeaders = append(mutation.SetHeaders, &core.HeaderValueOption{
+				Header: &core.HeaderValue{Key: exchangedHeader, RawValue: []byte("true")},
+			})
+		}
+		if state.expiresIn > 0 && exchangedExpiresInHeader != "" {
+			mutation.SetHeaders = append(mutation.SetHeaders, &core.HeaderValueOption{
+				Header: &core.HeaderValue{Key: exchangedExpiresInHeader, RawValue: []byte(strconv.Itoa(state.expiresIn))},
+			})
+		}
+	}
+	if state.responseHeaderRules != nil {
+		applyHeaderRules(headers, state.responseHeaderRules, mutation)
+	}
+	applyResponsePolicy(headers, state, mutation)
+	if len(mutation.SetHeaders) > 0 || len(mutation.RemoveHeaders) > 0 {
+		headersResponse.Response = &v3.CommonResponse{HeaderMutation: mutation}
+	}
+	return &v3.ProcessingResponse{
+		Response: &v3.ProcessingResponse_ResponseHeaders{
+			ResponseHeaders: headersResponse,
+		},
+	}
+}
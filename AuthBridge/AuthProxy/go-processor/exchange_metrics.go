@@ -0,0 +1,199 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	core "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
+)
+
+const (
+	exchangeOK       = "ok"
+	exchangeRejected = "rejected"
+	exchangeError    = "error"
+)
+
+// exchangeDurationBuckets are the upper bounds, in seconds, of the token
+// exchange latency histogram.
+var exchangeDurationBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// exchangeDurations is the latency of token exchange requests to the IdP, by
+// outcome.
+var exchangeDurations = &latencyHistogram{
+	bounds: exchangeDurationBuckets,
+	series: map[string]*latencySeries{},
+}
+
+// latencyHistogram is a histogram by outcome. Each bucket keeps the last
+// observation made while the request was traced as its exemplar, so a
+// latency spike links to a trace that shows it.
+type latencyHistogram struct {
+	mu     sync.Mutex
+	bounds []float64
+	series map[string]*latencySeries
+}
+
+type latencySeries struct {
+	// counts[i] are the observations in bucket i alone; the last bucket is +Inf
+	counts    []uint64
+	exemplars []*exemplar
+	sum       float64
+}
+
+type exemplar struct {
+	traceID string
+	value   float64
+	at      time.Time
+}
+
+func (h *latencyHistogram) observe(ctx context.Context, d time.Duration, outcome string) {
+	v := d.Seconds()
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	s := h.series[outcome]
+	if s == nil {
+		s = &latencySeries{
+			counts:    make([]uint64, len(h.bounds)+1),
+			exemplars: make([]*exemplar, len(h.bounds)+1),
+		}
+		h.series[outcome] = s
+	}
+	i := 0
+	for i < len(h.bounds) && v > h.bounds[i] {
+		i++
+	}
+	s.counts[i]++
+	s.sum += v
+	if traceID := requestTraceID(ctx); traceID != "" {
+		s.exemplars[i] = &exemplar{traceID: traceID, value: v, at: time.Now()}
+	}
+}
+
+// write writes the histogram in the Prometheus text format, with the
+// exemplars of the buckets if openMetrics.
+func (h *latencyHistogram) write(w io.Writer, name, help string, openMetrics bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	fmt.Fprintf(w, "# HELP %s %s\n", name, help)
+	fmt.Fprintf(w, "# TYPE %s histogram\n", name)
+	for _, outcome := range []string{exchangeOK, exchangeRejected, exchangeError} {
+		s := h.series[outcome]
+		if s == nil {
+			continue
+		}
+		var cumulative uint64
+		for i, count := range s.counts {
+			cumulative += count
+			le := "+Inf"
+			if i < len(h.bounds) {
+				le = strconv.FormatFloat(h.bounds[i], 'g', -1, 64)
+			}
+			fmt.Fprintf(w, "%s_bucket{outcome=%q,le=%q} %d", name, outcome, le, cumulative)
+			if e := s.exemplars[i]; openMetrics && e != nil {
+				fmt.Fprintf(w, " # {trace_id=%q} %g %.3f", e.traceID, e.value, float64(e.at.UnixMilli())/1000)
+			}
+			fmt.Fprintln(w)
+		}
+		fmt.Fprintf(w, "%s_sum{outcome=%q} %g\n", name, outcome, s.sum)
+		fmt.Fprintf(w, "%s_count{outcome=%q} %d\n", name, outcome, cumulative)
+	}
+}
+
+// writeExchangeMetrics writes the token exchange latency histogram.
+func writeExchangeMetrics(w io.Writer, openMetrics bool) {
+	exchangeDurations.write(w, "authbridge_token_exchange_duration_seconds",
+		"Latency of token exchange requests to the IdP, by outcome.", openMetrics)
+}
+
+// exchangeOutcome classifies an exchange request for the latency histogram.
+func exchangeOutcome(resp *tokenResponse, err error) string {
+	switch {
+	case err != nil || resp.StatusCode >= 500:
+		return exchangeError
+	case resp.StatusCode == 200:
+		return exchangeOK
+	}
+	return exchangeRejected
+}
+
+type traceIDKey struct{}
+
+// withTraceID records the ID of the trace the request belongs to, if Envoy
+// traces it: the trace-id of a sampled W3C traceparent header, or else a
+// sampled B3 x-b3-traceid. Unsampled requests have no trace to link to.
+func withTraceID(ctx context.Context, headers []*core.HeaderValue) context.Context {
+	if traceID := sampledTraceID(headers); traceID != "" {
+		return context.WithValue(ctx, traceIDKey{}, traceID)
+	}
+	return ctx
+}
+
+func requestTraceID(ctx context.Context) string {
+	traceID, _ := ctx.Value(traceIDKey{}).(string)
+	return traceID
+}
+
+func sampledTraceID(headers []*core.HeaderValue) string {
+	// version-traceid-parentid-flags, e.g.
+	// 00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01
+	if parts := strings.Split(getHeaderValue(headers, "traceparent"), "-"); len(parts) >= 4 && len(parts[3]) == 2 {
+		flags, err := strconv.ParseUint(parts[3], 16, 8)
+		if err == nil && flags&1 == 1 && validTraceID(parts[1], 32) {
+			return parts[1]
+		}
+		return ""
+	}
+	switch getHeaderValue(headers, "x-b3-sampled") {
+	case "1", "true":
+		if traceID := getHeaderValue(headers, "x-b3-traceid"); validTraceID(traceID, 16) || validTraceID(traceID, 32) {
+			return traceID
+		}
+	}
+	return ""
+}
+
+// validTraceID reports whether id is n lowercase hex digits, not all zero.
+func validTraceID(id string, n int) bool {
+	if len(id) != n || strings.Trim(id, "0") == "" {
+		return false
+	}
+	for _, c := range id {
+		if (c < '0' || c > '9') && (c < 'a' || c > 'f') {
+			return false
+		}
+	}
+	return true
+}
+
+// toOpenMetrics converts metrics in the Prometheus text format to the
+// OpenMetrics one, whose counter families are named without the _total
+// suffix of their samples, and terminates them.
+func toOpenMetrics(text []byte) []byte {
+	var out bytes.Buffer
+	scanner := bufio.NewScanner(bytes.NewReader(text))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if fields := strings.SplitN(line, " ", 4); len(fields) >= 3 && fields[0] == "#" && (fields[1] == "HELP" || fields[1] == "TYPE") {
+			if family, ok := strings.CutSuffix(fields[2], "_total"); ok && counterFamily(text, fields[2]) {
+				fields[2] = family
+				line = strings.Join(fields, " ")
+			}
+		}
+		out.WriteString(line)
+		out.WriteByte('\n')
+	}
+	out.WriteString("# EOF\n")
+	return out.Bytes()
+}
+
+// counterFamily reports whether text declares name a counter.
+func counterFamily(text []byte, name string) bool {
+	return bytes.Contains(text, []byte("# TYPE "+name+" counter\n"))
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/kagenti/kagenti-extensions/AuthBridge/AuthProxy/go-processor/internal/resolver"
+)
+
+// chainedExchangeToken exchanges subjectToken for audience like
+// cachedExchangeToken, after the route's intermediate exchanges
+// (exchange_via): each hop exchanges the token the previous one issued, and
+// the last hop's token is exchanged for audience. Hops use the exchange
+// client in effect and default to the route's token endpoint and scopes;
+// only the final token is DPoP-bound. Each hop is cached on its own, so with
+// EXCHANGE_CACHE a hop's token is reused as long as the token it was
+// exchanged from stays the same.
+func chainedExchangeToken(ctx context.Context, dpop bool, hops []resolver.ExchangeHop, clientID, clientSecret, tokenURL, subjectToken, subjectTokenType, audience, scopes string) (tokenExchangeResponse, *exchangeCacheEntry, error) {
+	for i, hop := range hops {
+		hopURL, hopScopes := hopParameters(hop, tokenURL, scopes)
+		traceStep(ctx, "Exchanging token for an intermediate audience", "hop", i+1, "audience", hop.Audience, "scopes", hopScopes)
+		resp, _, err := cachedExchangeToken(ctx, false, clientID, clientSecret, hopURL, subjectToken, subjectTokenType, hop.Audience, hopScopes)
+		if err != nil {
+			return tokenExchangeResponse{}, nil, fmt.Errorf("exchange for intermediate audience %q: %w", hop.Audience, err)
+		}
+		exchangeLog.Debug("Token exchanged for intermediate audience", "hop", i+1, "audience", hop.Audience)
+		subjectToken, subjectTokenType = resp.AccessToken, tokenTypeAccessToken
+	}
+	return cachedExchangeToken(withDPoP(ctx, dpop), dpop, clientID, clientSecret, tokenURL, subjectToken, subjectTokenType, audience, scopes)
+}
+
+// hopParameters returns the token endpoint and scopes of an intermediate
+// exchange, given the route's.
+func hopParameters(hop resolver.ExchangeHop, tokenURL, scopes string) (string, string) {
+	if hop.TokenEndpoint != "" {
+		tokenURL = hop.TokenEndpoint
+	}
+	if hop.Scopes != "" {
+		scopes = hop.Scopes
+	}
+	return tokenURL, scopes
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"strings"
+
+	core "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
+	v3 "github.com/envoyproxy/go-control-plane/envoy/service/ext_proc/v3"
+
+	"github.com/kagenti/kagenti-extensions/AuthBridge/AuthProxy/go-processor/internal/resolver"
+)
+
+// applyHeaderRules adds a route's request_headers or response_headers rules
+// for headers to mutation.
+func applyHeaderRules(headers []*core.HeaderValue, rules *resolver.HeaderRules, mutation *v3.HeaderMutation) {
+	for _, r := range rules.Rename {
+		action := core.HeaderValueOption_OVERWRITE_IF_EXISTS_OR_ADD
+		for _, h := range headers {
+			if !strings.EqualFold(h.Key, r.From) {
+				continue
+			}
+			mutation.SetHeaders = append(mutation.SetHeaders, &core.HeaderValueOption{
+				Header:       &core.HeaderValue{Key: r.To, RawValue: h.RawValue},
+				AppendAction: action,
+			})
+			// Further values of a repeated header are kept
+			action = core.HeaderValueOption_APPEND_IF_EXISTS_OR_ADD
+		}
+		if action == core.HeaderValueOption_APPEND_IF_EXISTS_OR_ADD {
+			mutation.RemoveHeaders = append(mutation.RemoveHeaders, r.From)
+		}
+	}
+	mutation.RemoveHeaders = append(mutation.RemoveHeaders, rules.Remove...)
+	for _, a := range rules.Add {
+		mutation.SetHeaders = append(mutation.SetHeaders, &core.HeaderValueOption{
+			Header:       &core.HeaderValue{Key: a.Name, RawValue: []byte(a.Value)},
+			AppendAction: core.HeaderValueOption_OVERWRITE_IF_EXISTS_OR_ADD,
+		})
+	}
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"context"
+
+	"github.com/lestrrat-go/jwx/v2/jwk"
+
+	"github.com/kagenti/kagenti-extensions/AuthBridge/AuthProxy/go-processor/internal/idp"
+)
+
+var (
+	// identityProviders are the IdPs besides the global one, keyed by the
+	// issuer of their tokens; nil when IDPS_CONFIG_PATH does not exist.
+	identityProviders *idp.Registry
+	// idpKeys holds the JWKS of every provider
+	idpKeys *jwk.Cache
+)
+
+// loadIdPConfig reads the identity providers file. Invalid providers are
+// fatal, since their tokens would otherwise be rejected or exchanged at the
+// wrong IdP.
+func loadIdPConfig(path string) {
+	r, err := idp.Load(path)
+	if err != nil {
+		fatal("Failed to load identity providers", "path", path, "error", err)
+	}
+	if r == nil {
+		return
+	}
+	idpKeys = jwk.NewCache(context.Background())
+	for _, p := range r.Providers() {
+		if p.JWKSURL == "" {
+			p.JWKSURL = deriveJWKSURL(p.TokenURL)
+		}
+		if err := idpKeys.Register(p.JWKSURL); err != nil {
+			fatal("Invalid identity provider JWKS URL", "issuer", p.Issuer, "jwks_url", p.JWKSURL, "error", err)
+		}
+		configLog.Info("Identity provider configured", "issuer", p.Issuer, "token_url", p.TokenURL,
+			"jwks_url", p.JWKSURL, "client_id", p.ClientID)
+	}
+	identityProviders = r
+}
+
+// inboundKeys returns the keys and issuer an inbound token is validated
+// against: those of the provider its iss names, else the global ones. The
+// cache is nil if neither applies.
+func inboundKeys(token string) (cache *jwk.Cache, jwksURL, issuer string) {
+	if p := identityProviders.ForToken(token); p != nil {
+		return idpKeys, p.JWKSURL, p.Issuer
+	}
+	if inboundIssuer == "" {
+		return nil, "", ""
+	}
+	return jwksCache, getInboundJWKSURL(), inboundIssuer
+}
+
+// exchangeClient returns the token endpoint and client to exchange token
+// with: those of the provider its iss names, else the ones given. A
+// provider without its own client keeps the given one.
+func exchangeClient(ctx context.Context, token, clientID, clientSecret, tokenURL, tokenCAFile string) (string, string, string, string) {
+	p := identityProviders.ForToken(token)
+	if p == nil {
+		return clientID, clientSecret, tokenURL, tokenCAFile
+	}
+	if p.ClientID != "" {
+		secret, err := resolveSecretRef(p.ClientSecretRef)
+		if err != nil {
+			exchangeLog.Error("Cannot read identity provider client secret", "issuer", p.Issuer, "client_id", p.ClientID, "error", err)
+		}
+		clientID, clientSecret = p.ClientID, secret
+	}
+	if p.TokenCAFile != "" {
+		tokenCAFile = p.TokenCAFile
+	}
+	exchangeLog.Debug("Using identity provider of the subject token", "issuer", p.Issuer, "token_url", p.TokenURL, "client_id", clientID)
+	traceStep(ctx, "Identity provider selected by issuer", "issuer", p.Issuer, "token_url", p.TokenURL, "client_id", clientID)
+	return clientID, clientSecret, p.TokenURL, tokenCAFile
+}
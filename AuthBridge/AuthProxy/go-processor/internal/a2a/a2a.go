@@ -0,0 +1,61 @@
+// Package a2a recognizes A2A (Agent2Agent) protocol requests: agent card
+// fetches and the JSON-RPC method of calls such as message/send or
+// tasks/cancel, so routes can treat them differently.
+package a2a
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"strings"
+)
+
+// AgentCardPaths are the well-known agent card locations: agent.json up to
+// A2A 0.2, agent-card.json from 0.3.
+var AgentCardPaths = []string{"/.well-known/agent.json", "/.well-known/agent-card.json"}
+
+// IsAgentCardRequest reports whether a request with the HTTP method and
+// :path (query included) fetches the agent card.
+func IsAgentCardRequest(method, path string) bool {
+	if method != http.MethodGet && method != http.MethodHead {
+		return false
+	}
+	path, _, _ = strings.Cut(path, "?")
+	for _, p := range AgentCardPaths {
+		if path == p {
+			return true
+		}
+	}
+	return false
+}
+
+type message struct {
+	Method string `json:"method"`
+}
+
+// Method returns the JSON-RPC method body calls, or "" if body is not a
+// JSON-RPC request. A batch names a method only if all its messages call it.
+func Method(body []byte) string {
+	body = bytes.TrimSpace(body)
+	if len(body) == 0 {
+		return ""
+	}
+	if body[0] != '[' {
+		var m message
+		if json.Unmarshal(body, &m) != nil {
+			return ""
+		}
+		return m.Method
+	}
+
+	var batch []message
+	if json.Unmarshal(body, &batch) != nil || len(batch) == 0 {
+		return ""
+	}
+	for _, m := range batch[1:] {
+		if m.Method != batch[0].Method {
+			return ""
+		}
+	}
+	return batch[0].Method
+}
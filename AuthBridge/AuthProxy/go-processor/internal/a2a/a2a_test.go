@@ -0,0 +1,47 @@
+package a2a
+
+import "testing"
+
+func TestIsAgentCardRequest(t *testing.T) {
+	tests := []struct {
+		method, path string
+		want         bool
+	}{
+		{"GET", "/.well-known/agent.json", true},
+		{"GET", "/.well-known/agent-card.json", true},
+		{"HEAD", "/.well-known/agent-card.json?v=1", true},
+		{"POST", "/.well-known/agent.json", false},
+		{"GET", "/.well-known/agent.json/../tasks", false},
+		{"GET", "/agents/.well-known/agent.json", false},
+		{"GET", "/", false},
+	}
+	for _, tc := range tests {
+		if got := IsAgentCardRequest(tc.method, tc.path); got != tc.want {
+			t.Errorf("IsAgentCardRequest(%q, %q) = %v, want %v", tc.method, tc.path, got, tc.want)
+		}
+	}
+}
+
+func TestMethod(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		want string
+	}{
+		{"message send", `{"jsonrpc":"2.0","id":1,"method":"message/send","params":{"message":{"role":"user"}}}`, "message/send"},
+		{"task cancel", `{"jsonrpc":"2.0","id":"a","method":"tasks/cancel","params":{"id":"t1"}}`, "tasks/cancel"},
+		{"no method", `{"jsonrpc":"2.0","id":1,"result":{}}`, ""},
+		{"not json", `method=message/send`, ""},
+		{"empty", ``, ""},
+		{"batch of one method", `[{"method":"tasks/get"},{"method":"tasks/get"}]`, "tasks/get"},
+		{"mixed batch", `[{"method":"tasks/get"},{"method":"tasks/cancel"}]`, ""},
+		{"empty batch", `[]`, ""},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := Method([]byte(tc.body)); got != tc.want {
+				t.Errorf("Method() = %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,155 @@
+// Package accesslog implements the Envoy access log service (ALS) so access
+// logs and token exchange decisions are collected in the processor and can be
+// joined by request ID.
+package accesslog
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	data "github.com/envoyproxy/go-control-plane/envoy/data/accesslog/v3"
+	als "github.com/envoyproxy/go-control-plane/envoy/service/accesslog/v3"
+)
+
+// Exchange outcomes recorded in the journal.
+const (
+	OutcomeExchanged = "exchanged"
+	OutcomeFailed    = "failed"
+	OutcomeDenied    = "denied"
+)
+
+// ExchangeEvent is the processor's view of one outbound request.
+type ExchangeEvent struct {
+	RequestID string
+	Host      string
+	Audience  string
+	Scopes    string
+	Outcome   string
+	Time      time.Time
+}
+
+// Journal holds exchange events until the matching access log entry arrives.
+// It is bounded: the oldest events are dropped when full or older than ttl,
+// which covers requests whose access log is never sent.
+type Journal struct {
+	mu      sync.Mutex
+	max     int
+	ttl     time.Duration
+	now     func() time.Time
+	entries map[string]ExchangeEvent
+	order   []string
+}
+
+// NewJournal returns a journal holding at most max events for up to ttl.
+func NewJournal(max int, ttl time.Duration) *Journal {
+	return &Journal{
+		max:     max,
+		ttl:     ttl,
+		now:     time.Now,
+		entries: make(map[string]ExchangeEvent),
+	}
+}
+
+// Record stores ev under its request ID. Events without one are ignored
+// since they can never be joined.
+func (j *Journal) Record(ev ExchangeEvent) {
+	if ev.RequestID == "" {
+		return
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	if ev.Time.IsZero() {
+		ev.Time = j.now()
+	}
+	if _, exists := j.entries[ev.RequestID]; !exists {
+		j.order = append(j.order, ev.RequestID)
+	}
+	j.entries[ev.RequestID] = ev
+	j.evictLocked()
+}
+
+// Take returns and removes the event for requestID.
+func (j *Journal) Take(requestID string) (ExchangeEvent, bool) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	j.evictLocked()
+	ev, ok := j.entries[requestID]
+	if ok {
+		delete(j.entries, requestID)
+	}
+	return ev, ok
+}
+
+// Len returns the number of pending events.
+func (j *Journal) Len() int {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return len(j.entries)
+}
+
+// evictLocked drops taken IDs, expired events and any overflow from the
+// front of the insertion order.
+func (j *Journal) evictLocked() {
+	cutoff := j.now().Add(-j.ttl)
+	drop := 0
+	for _, id := range j.order {
+		ev, ok := j.entries[id]
+		switch {
+		case !ok:
+		case len(j.entries) > j.max, ev.Time.Before(cutoff):
+			delete(j.entries, id)
+		default:
+			j.order = j.order[drop:]
+			return
+		}
+		drop++
+	}
+	j.order = j.order[:0]
+}
+
+// Server implements the ALS gRPC service. Each HTTP access log entry is
+// passed to Logf joined with the exchange event of the same request, if any.
+type Server struct {
+	als.UnimplementedAccessLogServiceServer
+
+	Journal *Journal
+	Logf    func(format string, args ...interface{})
+}
+
+// StreamAccessLogs consumes one Envoy access log stream.
+func (s *Server) StreamAccessLogs(stream als.AccessLogService_StreamAccessLogsServer) error {
+	for {
+		msg, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			return stream.SendAndClose(&als.StreamAccessLogsResponse{})
+		}
+		if err != nil {
+			return err
+		}
+		for _, entry := range msg.GetHttpLogs().GetLogEntry() {
+			s.Logf("%s", s.Join(entry))
+		}
+	}
+}
+
+// Join formats entry together with its exchange event.
+func (s *Server) Join(entry *data.HTTPAccessLogEntry) string {
+	req := entry.GetRequest()
+	line := fmt.Sprintf("request_id=%q authority=%q method=%s path=%q status=%d",
+		req.GetRequestId(), req.GetAuthority(), req.GetRequestMethod(), req.GetPath(),
+		entry.GetResponse().GetResponseCode().GetValue())
+	if d := entry.GetCommonProperties().GetTimeToLastDownstreamTxByte(); d != nil {
+		line += fmt.Sprintf(" duration=%s", d.AsDuration())
+	}
+
+	ev, ok := s.Journal.Take(req.GetRequestId())
+	if !ok {
+		return line + " exchange=none"
+	}
+	return line + fmt.Sprintf(" exchange=%s audience=%q scopes=%q", ev.Outcome, ev.Audience, ev.Scopes)
+}
@@ -0,0 +1,82 @@
+package accesslog
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	core "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
+	data "github.com/envoyproxy/go-control-plane/envoy/data/accesslog/v3"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+func TestJournalRecordTake(t *testing.T) {
+	j := NewJournal(10, time.Minute)
+	j.Record(ExchangeEvent{RequestID: "a", Outcome: OutcomeExchanged})
+	j.Record(ExchangeEvent{Outcome: OutcomeExchanged}) // no request ID, ignored
+
+	if j.Len() != 1 {
+		t.Fatalf("Len = %d, want 1", j.Len())
+	}
+	ev, ok := j.Take("a")
+	if !ok || ev.Outcome != OutcomeExchanged {
+		t.Fatalf("Take(a) = %+v, %v", ev, ok)
+	}
+	if _, ok := j.Take("a"); ok {
+		t.Fatal("event should be removed after Take")
+	}
+}
+
+func TestJournalEviction(t *testing.T) {
+	now := time.Unix(1000, 0)
+	j := NewJournal(2, time.Minute)
+	j.now = func() time.Time { return now }
+
+	j.Record(ExchangeEvent{RequestID: "a"})
+	j.Record(ExchangeEvent{RequestID: "b"})
+	j.Record(ExchangeEvent{RequestID: "c"})
+	if _, ok := j.Take("a"); ok {
+		t.Error("oldest event should be evicted when full")
+	}
+
+	now = now.Add(2 * time.Minute)
+	j.Record(ExchangeEvent{RequestID: "d"})
+	if _, ok := j.Take("b"); ok {
+		t.Error("expired event should be evicted")
+	}
+	if _, ok := j.Take("d"); !ok {
+		t.Error("fresh event should be kept")
+	}
+	if j.Len() != 0 {
+		t.Errorf("Len = %d, want 0", j.Len())
+	}
+}
+
+func TestServerJoin(t *testing.T) {
+	j := NewJournal(10, time.Minute)
+	j.Record(ExchangeEvent{RequestID: "req-1", Audience: "tool-a", Scopes: "openid", Outcome: OutcomeExchanged})
+	s := &Server{Journal: j}
+
+	entry := func(id string) *data.HTTPAccessLogEntry {
+		return &data.HTTPAccessLogEntry{
+			Request: &data.HTTPRequestProperties{
+				RequestId:     id,
+				Authority:     "tool-a.svc",
+				Path:          "/mcp",
+				RequestMethod: core.RequestMethod_POST,
+			},
+			Response: &data.HTTPResponseProperties{ResponseCode: wrapperspb.UInt32(200)},
+		}
+	}
+
+	line := s.Join(entry("req-1"))
+	for _, want := range []string{`request_id="req-1"`, "status=200", "exchange=exchanged", `audience="tool-a"`} {
+		if !strings.Contains(line, want) {
+			t.Errorf("joined line %q missing %q", line, want)
+		}
+	}
+
+	if line := s.Join(entry("req-2")); !strings.Contains(line, "exchange=none") {
+		t.Errorf("unmatched entry should report exchange=none, got %q", line)
+	}
+}
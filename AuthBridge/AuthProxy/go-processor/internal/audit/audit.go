@@ -0,0 +1,104 @@
+// Package audit records every token exchange decision for security review:
+// who asked (sub), for which audience and scopes, the decision and how long
+// it took. Token values are never recorded, only their SHA-256, so a
+// reviewer holding a token can find its exchanges without the log leaking
+// credentials.
+package audit
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"os"
+	"sync"
+	"time"
+)
+
+// Record is one exchange decision.
+type Record struct {
+	Time      time.Time `json:"time"`
+	RequestID string    `json:"request_id,omitempty"`
+	Host      string    `json:"host"`
+	// Subject and Issuer are the sub and iss claims of the subject token
+	Subject  string `json:"sub,omitempty"`
+	Issuer   string `json:"iss,omitempty"`
+	ClientID string `json:"client_id,omitempty"`
+	Audience string `json:"audience,omitempty"`
+	Scopes   string `json:"scopes,omitempty"`
+	// Decision is exchanged, failed or denied
+	Decision string        `json:"decision"`
+	Latency  time.Duration `json:"-"`
+	// SubjectTokenHash and IssuedTokenHash are HashToken of the tokens
+	SubjectTokenHash string `json:"subject_token_sha256,omitempty"`
+	IssuedTokenHash  string `json:"issued_token_sha256,omitempty"`
+}
+
+// LatencyMillis returns the latency in milliseconds.
+func (r Record) LatencyMillis() float64 {
+	return float64(r.Latency) / float64(time.Millisecond)
+}
+
+// MarshalJSON adds latency_ms to the record's fields.
+func (r Record) MarshalJSON() ([]byte, error) {
+	type plain Record
+	return json.Marshal(struct {
+		plain
+		LatencyMS float64 `json:"latency_ms"`
+	}{plain(r), r.LatencyMillis()})
+}
+
+// HashToken returns the hex SHA-256 of a token, or "" for no token.
+func HashToken(token string) string {
+	if token == "" {
+		return ""
+	}
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// Sink stores records. Write must not block for long: it runs on the
+// request path.
+type Sink interface {
+	Write(Record) error
+	Close() error
+}
+
+// FileSink appends records to a file as JSON lines. The file is opened for
+// appending only and never truncated or rewritten.
+type FileSink struct {
+	mu  sync.Mutex
+	f   *os.File
+	enc *json.Encoder
+}
+
+// OpenFile opens or creates path for appending, readable by its owner only.
+func OpenFile(path string) (*FileSink, error) {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o600)
+	if err != nil {
+		return nil, err
+	}
+	return &FileSink{f: f, enc: json.NewEncoder(f)}, nil
+}
+
+// Write appends r as one line.
+func (s *FileSink) Write(r Record) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.f == nil {
+		return errors.New("audit: file sink closed")
+	}
+	return s.enc.Encode(r)
+}
+
+// Close syncs and closes the file.
+func (s *FileSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.f == nil {
+		return nil
+	}
+	err := errors.Join(s.f.Sync(), s.f.Close())
+	s.f = nil
+	return err
+}
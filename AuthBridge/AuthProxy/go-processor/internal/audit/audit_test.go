@@ -0,0 +1,153 @@
+package audit
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func testRecord() Record {
+	return Record{
+		Time:             time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC),
+		RequestID:        "req-1",
+		Host:             "tool.example.com",
+		Subject:          "alice",
+		ClientID:         "agent",
+		Audience:         "tool",
+		Scopes:           "read",
+		Decision:         "exchanged",
+		Latency:          1500 * time.Microsecond,
+		SubjectTokenHash: HashToken("subject-token"),
+		IssuedTokenHash:  HashToken("issued-token"),
+	}
+}
+
+func TestHashToken(t *testing.T) {
+	// sha256("abc")
+	if got := HashToken("abc"); got != "ba7816bf8f01cfea414140de5dae2223b00361a396177a9cb410ff61f20015ad" {
+		t.Errorf("HashToken = %s", got)
+	}
+	if HashToken("") != "" {
+		t.Error("HashToken of no token is not empty")
+	}
+}
+
+func TestFileSink(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+	for i := 0; i < 2; i++ {
+		// Reopening appends rather than truncating
+		s, err := OpenFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := s.Write(testRecord()); err != nil {
+			t.Fatal(err)
+		}
+		if err := s.Close(); err != nil {
+			t.Fatal(err)
+		}
+		if err := s.Write(testRecord()); err == nil {
+			t.Error("Write after Close succeeded")
+		}
+	}
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(content)), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("got %d lines, want 2:\n%s", len(lines), content)
+	}
+	var got map[string]any
+	if err := json.Unmarshal([]byte(lines[0]), &got); err != nil {
+		t.Fatal(err)
+	}
+	if got["sub"] != "alice" || got["decision"] != "exchanged" || got["latency_ms"] != 1.5 ||
+		got["subject_token_sha256"] != HashToken("subject-token") {
+		t.Errorf("record = %v", got)
+	}
+	if strings.Contains(string(content), "subject-token") {
+		t.Error("token value written to the audit log")
+	}
+	if info, err := os.Stat(path); err == nil && info.Mode().Perm() != 0o600 {
+		t.Errorf("mode = %v, want 0600", info.Mode().Perm())
+	}
+}
+
+func TestOTLPSink(t *testing.T) {
+	bodies := make(chan []byte, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/logs" || r.Header.Get("Content-Type") != "application/json" || r.Header.Get("Authorization") != "Bearer k" {
+			t.Errorf("unexpected request %s %v", r.URL.Path, r.Header)
+		}
+		body, _ := io.ReadAll(r.Body)
+		bodies <- body
+	}))
+	defer srv.Close()
+
+	s := NewOTLPSink(OTLPConfig{
+		Endpoint:    srv.URL + "/",
+		ServiceName: "authbridge",
+		Headers:     map[string]string{"Authorization": "Bearer k"},
+		Interval:    time.Hour,
+		OnError:     func(err error) { t.Error(err) },
+	})
+	if err := s.Write(testRecord()); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	var req otlpLogs
+	if err := json.Unmarshal(<-bodies, &req); err != nil {
+		t.Fatal(err)
+	}
+	if *req.ResourceLogs[0].Resource.Attributes[0].Value.StringValue != "authbridge" {
+		t.Errorf("service.name = %+v", req.ResourceLogs[0].Resource)
+	}
+	records := req.ResourceLogs[0].ScopeLogs[0].LogRecords
+	if len(records) != 1 || records[0].TimeUnixNano != "1767323045000000000" {
+		t.Fatalf("records = %+v", records)
+	}
+	attrs := map[string]otlpValue{}
+	for _, kv := range records[0].Attributes {
+		attrs[kv.Key] = kv.Value
+	}
+	if v := attrs["authbridge.sub"].StringValue; v == nil || *v != "alice" {
+		t.Errorf("sub attribute = %v", v)
+	}
+	if v := attrs["authbridge.latency_ms"].DoubleValue; v == nil || *v != 1.5 {
+		t.Errorf("latency attribute = %v", v)
+	}
+	if _, ok := attrs["authbridge.iss"]; ok {
+		t.Error("empty iss exported")
+	}
+
+	if err := s.Write(testRecord()); err == nil {
+		t.Error("Write after Close succeeded")
+	}
+}
+
+func TestOTLPSink_QueueFull(t *testing.T) {
+	block := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { <-block }))
+	defer srv.Close()
+	defer close(block)
+
+	s := NewOTLPSink(OTLPConfig{Endpoint: srv.URL, QueueSize: 1, BatchSize: 1, Interval: time.Hour})
+	var full bool
+	for i := 0; i < 10 && !full; i++ {
+		full = s.Write(testRecord()) == ErrQueueFull
+	}
+	if !full || s.Dropped() == 0 {
+		t.Errorf("queue never reported full, dropped = %d", s.Dropped())
+	}
+}
@@ -0,0 +1,247 @@
+package audit
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ErrQueueFull is returned by OTLPSink.Write when records arrive faster
+// than they are exported; the record is dropped.
+var ErrQueueFull = errors.New("audit: export queue full, record dropped")
+
+// OTLPConfig configures an OTLPSink.
+type OTLPConfig struct {
+	// Endpoint is the OTLP/HTTP base URL, e.g. http://otel-collector:4318;
+	// records are posted to its /v1/logs path.
+	Endpoint string
+	// ServiceName is the service.name resource attribute
+	ServiceName string
+	Headers     map[string]string
+	// QueueSize bounds the records waiting for export (default 10000)
+	QueueSize int
+	// BatchSize and Interval bound the records per export and the time a
+	// record waits for one (defaults 512 and 5s)
+	BatchSize int
+	Interval  time.Duration
+	Client    *http.Client
+	// OnError is called with failed exports; may be nil
+	OnError func(error)
+}
+
+// OTLPSink exports records as OTLP log records over HTTP with JSON encoding,
+// in batches, from a background goroutine.
+type OTLPSink struct {
+	cfg     OTLPConfig
+	url     string
+	done    chan struct{}
+	dropped atomic.Uint64
+
+	// mu guards closing queue against concurrent writes
+	mu     sync.RWMutex
+	queue  chan Record
+	closed bool
+}
+
+// NewOTLPSink starts exporting to cfg.Endpoint.
+func NewOTLPSink(cfg OTLPConfig) *OTLPSink {
+	if cfg.QueueSize <= 0 {
+		cfg.QueueSize = 10000
+	}
+	if cfg.BatchSize <= 0 {
+		cfg.BatchSize = 512
+	}
+	if cfg.Interval <= 0 {
+		cfg.Interval = 5 * time.Second
+	}
+	if cfg.Client == nil {
+		cfg.Client = &http.Client{Timeout: 10 * time.Second}
+	}
+	s := &OTLPSink{
+		cfg:   cfg,
+		url:   strings.TrimSuffix(cfg.Endpoint, "/") + "/v1/logs",
+		queue: make(chan Record, cfg.QueueSize),
+		done:  make(chan struct{}),
+	}
+	go s.run()
+	return s
+}
+
+// Write queues r for export without blocking.
+func (s *OTLPSink) Write(r Record) error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.closed {
+		return errors.New("audit: OTLP sink closed")
+	}
+	select {
+	case s.queue <- r:
+		return nil
+	default:
+		s.dropped.Add(1)
+		return ErrQueueFull
+	}
+}
+
+// Dropped returns the number of records dropped because the queue was full.
+func (s *OTLPSink) Dropped() uint64 {
+	return s.dropped.Load()
+}
+
+// Close exports the queued records and stops the sink.
+func (s *OTLPSink) Close() error {
+	s.mu.Lock()
+	if !s.closed {
+		s.closed = true
+		close(s.queue)
+	}
+	s.mu.Unlock()
+	<-s.done
+	return nil
+}
+
+func (s *OTLPSink) run() {
+	defer close(s.done)
+	ticker := time.NewTicker(s.cfg.Interval)
+	defer ticker.Stop()
+	batch := make([]Record, 0, s.cfg.BatchSize)
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+		if err := s.export(batch); err != nil && s.cfg.OnError != nil {
+			s.cfg.OnError(fmt.Errorf("exporting %d audit records: %w", len(batch), err))
+		}
+		batch = batch[:0]
+	}
+	for {
+		select {
+		case r, ok := <-s.queue:
+			if !ok {
+				flush()
+				return
+			}
+			batch = append(batch, r)
+			if len(batch) >= s.cfg.BatchSize {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+		}
+	}
+}
+
+func (s *OTLPSink) export(batch []Record) error {
+	body, err := json.Marshal(logsRequest(s.cfg.ServiceName, batch))
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), s.cfg.Client.Timeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range s.cfg.Headers {
+		req.Header.Set(k, v)
+	}
+	resp, err := s.cfg.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 4096))
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("%s returned %s", s.url, resp.Status)
+	}
+	return nil
+}
+
+// The OTLP/HTTP JSON encoding of ExportLogsServiceRequest; 64-bit integers
+// are strings, as protobuf JSON requires.
+type (
+	otlpLogs struct {
+		ResourceLogs []otlpResourceLogs `json:"resourceLogs"`
+	}
+	otlpResourceLogs struct {
+		Resource  otlpResource    `json:"resource"`
+		ScopeLogs []otlpScopeLogs `json:"scopeLogs"`
+	}
+	otlpResource struct {
+		Attributes []otlpKeyValue `json:"attributes"`
+	}
+	otlpScopeLogs struct {
+		Scope      otlpScope       `json:"scope"`
+		LogRecords []otlpLogRecord `json:"logRecords"`
+	}
+	otlpScope struct {
+		Name string `json:"name"`
+	}
+	otlpLogRecord struct {
+		TimeUnixNano   string         `json:"timeUnixNano"`
+		SeverityNumber int            `json:"severityNumber"`
+		SeverityText   string         `json:"severityText"`
+		Body           otlpValue      `json:"body"`
+		Attributes     []otlpKeyValue `json:"attributes"`
+	}
+	otlpKeyValue struct {
+		Key   string    `json:"key"`
+		Value otlpValue `json:"value"`
+	}
+	otlpValue struct {
+		StringValue *string  `json:"stringValue,omitempty"`
+		DoubleValue *float64 `json:"doubleValue,omitempty"`
+	}
+)
+
+// severityInfo is the OTLP SeverityNumber of INFO.
+const severityInfo = 9
+
+func stringValue(s string) otlpValue { return otlpValue{StringValue: &s} }
+
+func logsRequest(service string, batch []Record) otlpLogs {
+	records := make([]otlpLogRecord, 0, len(batch))
+	for _, r := range batch {
+		latency := r.LatencyMillis()
+		attrs := []otlpKeyValue{
+			{"authbridge.decision", stringValue(r.Decision)},
+			{"authbridge.host", stringValue(r.Host)},
+			{"authbridge.latency_ms", otlpValue{DoubleValue: &latency}},
+		}
+		for _, kv := range []struct{ key, value string }{
+			{"authbridge.request_id", r.RequestID},
+			{"authbridge.sub", r.Subject},
+			{"authbridge.iss", r.Issuer},
+			{"authbridge.client_id", r.ClientID},
+			{"authbridge.audience", r.Audience},
+			{"authbridge.scopes", r.Scopes},
+			{"authbridge.subject_token_sha256", r.SubjectTokenHash},
+			{"authbridge.issued_token_sha256", r.IssuedTokenHash},
+		} {
+			if kv.value != "" {
+				attrs = append(attrs, otlpKeyValue{kv.key, stringValue(kv.value)})
+			}
+		}
+		records = append(records, otlpLogRecord{
+			TimeUnixNano:   strconv.FormatInt(r.Time.UnixNano(), 10),
+			SeverityNumber: severityInfo,
+			SeverityText:   "INFO",
+			Body:           stringValue("token exchange " + r.Decision),
+			Attributes:     attrs,
+		})
+	}
+	return otlpLogs{ResourceLogs: []otlpResourceLogs{{
+		Resource:  otlpResource{Attributes: []otlpKeyValue{{"service.name", stringValue(service)}}},
+		ScopeLogs: []otlpScopeLogs{{Scope: otlpScope{Name: "authbridge.audit"}, LogRecords: records}},
+	}}}
+}
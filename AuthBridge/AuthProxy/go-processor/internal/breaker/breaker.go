@@ -0,0 +1,227 @@
+// Package breaker implements a consecutive-failure circuit breaker so calls to
+// an unavailable dependency (the token endpoint) fail fast instead of waiting
+// for a doomed round trip.
+package breaker
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+	"time"
+)
+
+// State of a breaker.
+type State int
+
+const (
+	// Closed lets every call through.
+	Closed State = iota
+	// Open rejects calls until the cooldown has passed.
+	Open
+	// HalfOpen lets a single trial call through; its outcome closes or
+	// re-opens the breaker.
+	HalfOpen
+)
+
+func (s State) String() string {
+	switch s {
+	case Open:
+		return "open"
+	case HalfOpen:
+		return "half-open"
+	default:
+		return "closed"
+	}
+}
+
+// MarshalText encodes the state by its name, e.g. in JSON.
+func (s State) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+// Breaker opens after Threshold consecutive failures and half-opens after
+// Cooldown. A Threshold of zero disables it.
+type Breaker struct {
+	Threshold int
+	Cooldown  time.Duration
+	// OnStateChange, if set, is called with the new state (under the lock).
+	OnStateChange func(from, to State)
+
+	now func() time.Time
+
+	mu       sync.Mutex
+	state    State
+	failures int
+	openedAt time.Time
+	// trialAt is when the half-open trial call started; zero if none runs
+	trialAt  time.Time
+	opened   uint64
+	rejected uint64
+}
+
+// New returns a closed breaker.
+func New(threshold int, cooldown time.Duration) *Breaker {
+	return &Breaker{Threshold: threshold, Cooldown: cooldown, now: time.Now}
+}
+
+// Allow reports whether a call may proceed. Every allowed call must be
+// followed by Success or Failure.
+func (b *Breaker) Allow() bool {
+	if b.Threshold <= 0 {
+		return true
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case Open:
+		if b.now().Sub(b.openedAt) < b.Cooldown {
+			b.rejected++
+			return false
+		}
+		b.setState(HalfOpen)
+		b.trialAt = b.now()
+		return true
+	case HalfOpen:
+		// Only one trial call at a time. A trial whose outcome was never
+		// recorded (e.g. the caller went away) expires after the cooldown.
+		if !b.trialAt.IsZero() && b.now().Sub(b.trialAt) < b.Cooldown {
+			b.rejected++
+			return false
+		}
+		b.trialAt = b.now()
+		return true
+	default:
+		return true
+	}
+}
+
+// Success records a successful call and closes the breaker.
+func (b *Breaker) Success() {
+	if b.Threshold <= 0 {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.failures = 0
+	b.trialAt = time.Time{}
+	if b.state != Closed {
+		b.setState(Closed)
+	}
+}
+
+// Failure records a failed call. A failed trial re-opens the breaker.
+func (b *Breaker) Failure() {
+	if b.Threshold <= 0 {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.failures++
+	b.trialAt = time.Time{}
+	if b.state == HalfOpen || (b.state == Closed && b.failures >= b.Threshold) {
+		b.openedAt = b.now()
+		b.opened++
+		b.setState(Open)
+	}
+}
+
+// State returns the current state. An open breaker whose cooldown has passed
+// still reports Open until the next Allow.
+func (b *Breaker) State() State {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.state
+}
+
+func (b *Breaker) setState(to State) {
+	from := b.state
+	b.state = to
+	if b.OnStateChange != nil {
+		b.OnStateChange(from, to)
+	}
+}
+
+// Set holds one breaker per key, e.g. per token endpoint URL.
+type Set struct {
+	threshold int
+	cooldown  time.Duration
+	onChange  func(key string, from, to State)
+
+	mu       sync.Mutex
+	breakers map[string]*Breaker
+}
+
+// NewSet returns a set creating breakers with the given settings. onChange
+// may be nil.
+func NewSet(threshold int, cooldown time.Duration, onChange func(key string, from, to State)) *Set {
+	return &Set{threshold: threshold, cooldown: cooldown, onChange: onChange, breakers: make(map[string]*Breaker)}
+}
+
+// Get returns the breaker for key, creating it on first use.
+func (s *Set) Get(key string) *Breaker {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	b, ok := s.breakers[key]
+	if !ok {
+		b = New(s.threshold, s.cooldown)
+		if s.onChange != nil {
+			b.OnStateChange = func(from, to State) { s.onChange(key, from, to) }
+		}
+		s.breakers[key] = b
+	}
+	return b
+}
+
+// Status is a snapshot of one breaker of a Set.
+type Status struct {
+	Key   string `json:"key"`
+	State State  `json:"state"`
+	// Opened counts the times the breaker opened, Rejected the calls it
+	// rejected while open.
+	Opened   uint64 `json:"opened"`
+	Rejected uint64 `json:"rejected"`
+}
+
+// Snapshot returns the status of every breaker, sorted by key.
+func (s *Set) Snapshot() []Status {
+	s.mu.Lock()
+	snaps := make([]Status, 0, len(s.breakers))
+	for k, b := range s.breakers {
+		b.mu.Lock()
+		snaps = append(snaps, Status{k, b.state, b.opened, b.rejected})
+		b.mu.Unlock()
+	}
+	s.mu.Unlock()
+	sort.Slice(snaps, func(i, j int) bool { return snaps[i].Key < snaps[j].Key })
+	return snaps
+}
+
+// WriteMetrics writes the state and counters of every breaker in the
+// Prometheus text format, labelled by key. Metric names start with prefix.
+func (s *Set) WriteMetrics(w io.Writer, prefix string) {
+	snaps := s.Snapshot()
+
+	fmt.Fprintf(w, "# HELP %s_state Circuit breaker state (1 for the current state).\n", prefix)
+	fmt.Fprintf(w, "# TYPE %s_state gauge\n", prefix)
+	for _, sn := range snaps {
+		for _, st := range []State{Closed, Open, HalfOpen} {
+			v := 0
+			if st == sn.State {
+				v = 1
+			}
+			fmt.Fprintf(w, "%s_state{key=%q,state=%q} %d\n", prefix, sn.Key, st, v)
+		}
+	}
+	fmt.Fprintf(w, "# HELP %s_opened_total Times the breaker opened.\n", prefix)
+	fmt.Fprintf(w, "# TYPE %s_opened_total counter\n", prefix)
+	for _, sn := range snaps {
+		fmt.Fprintf(w, "%s_opened_total{key=%q} %d\n", prefix, sn.Key, sn.Opened)
+	}
+	fmt.Fprintf(w, "# HELP %s_rejected_total Calls rejected while open.\n", prefix)
+	fmt.Fprintf(w, "# TYPE %s_rejected_total counter\n", prefix)
+	for _, sn := range snaps {
+		fmt.Fprintf(w, "%s_rejected_total{key=%q} %d\n", prefix, sn.Key, sn.Rejected)
+	}
+}
@@ -0,0 +1,140 @@
+package breaker
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newTestBreaker(threshold int, cooldown time.Duration) (*Breaker, *time.Time) {
+	now := time.Unix(0, 0)
+	b := New(threshold, cooldown)
+	b.now = func() time.Time { return now }
+	return b, &now
+}
+
+func TestBreakerOpensAfterThreshold(t *testing.T) {
+	b, _ := newTestBreaker(3, time.Minute)
+	for i := 0; i < 2; i++ {
+		if !b.Allow() {
+			t.Fatalf("call %d rejected while closed", i)
+		}
+		b.Failure()
+	}
+	// A success resets the consecutive count
+	b.Allow()
+	b.Success()
+	for i := 0; i < 3; i++ {
+		b.Allow()
+		b.Failure()
+	}
+	if b.State() != Open {
+		t.Fatalf("state = %v, want open", b.State())
+	}
+	if b.Allow() {
+		t.Error("call allowed while open")
+	}
+}
+
+func TestBreakerHalfOpen(t *testing.T) {
+	b, now := newTestBreaker(1, time.Minute)
+	var transitions []string
+	b.OnStateChange = func(from, to State) { transitions = append(transitions, from.String()+">"+to.String()) }
+
+	b.Allow()
+	b.Failure()
+	*now = now.Add(time.Minute)
+
+	if !b.Allow() {
+		t.Fatal("trial call rejected after cooldown")
+	}
+	if b.Allow() {
+		t.Error("second call allowed while the trial runs")
+	}
+	b.Failure()
+	if b.State() != Open {
+		t.Fatalf("failed trial: state = %v, want open", b.State())
+	}
+
+	*now = now.Add(time.Minute)
+	b.Allow()
+	b.Success()
+	if b.State() != Closed {
+		t.Fatalf("successful trial: state = %v, want closed", b.State())
+	}
+
+	want := "closed>open open>half-open half-open>open open>half-open half-open>closed"
+	if got := strings.Join(transitions, " "); got != want {
+		t.Errorf("transitions = %q, want %q", got, want)
+	}
+}
+
+func TestBreakerAbandonedTrialExpires(t *testing.T) {
+	b, now := newTestBreaker(1, time.Minute)
+	b.Allow()
+	b.Failure()
+	*now = now.Add(time.Minute)
+	b.Allow() // trial never reports back
+
+	*now = now.Add(time.Minute)
+	if !b.Allow() {
+		t.Error("new trial rejected after the abandoned one expired")
+	}
+}
+
+func TestBreakerDisabled(t *testing.T) {
+	b, _ := newTestBreaker(0, time.Minute)
+	for i := 0; i < 10; i++ {
+		b.Failure()
+	}
+	if !b.Allow() || b.State() != Closed {
+		t.Error("disabled breaker must stay closed")
+	}
+}
+
+func TestSetWriteMetrics(t *testing.T) {
+	s := NewSet(1, time.Minute, nil)
+	b := s.Get("https://idp/token")
+	b.Allow()
+	b.Failure()
+	b.Allow()
+	if s.Get("https://idp/token") != b {
+		t.Fatal("Get returned a new breaker for the same key")
+	}
+
+	var out strings.Builder
+	s.WriteMetrics(&out, "authbridge_token_endpoint_breaker")
+	for _, line := range []string{
+		`authbridge_token_endpoint_breaker_state{key="https://idp/token",state="open"} 1`,
+		`authbridge_token_endpoint_breaker_state{key="https://idp/token",state="closed"} 0`,
+		`authbridge_token_endpoint_breaker_opened_total{key="https://idp/token"} 1`,
+		`authbridge_token_endpoint_breaker_rejected_total{key="https://idp/token"} 1`,
+	} {
+		if !strings.Contains(out.String(), line+"\n") {
+			t.Errorf("metrics missing %q:\n%s", line, out.String())
+		}
+	}
+}
+
+func TestSetSnapshot(t *testing.T) {
+	s := NewSet(1, time.Minute, nil)
+	s.Get("https://b/token")
+	a := s.Get("https://a/token")
+	a.Allow()
+	a.Failure()
+
+	got := s.Snapshot()
+	want := []Status{
+		{Key: "https://a/token", State: Open, Opened: 1},
+		{Key: "https://b/token", State: Closed},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Snapshot() = %+v, want %+v", got, want)
+	}
+	out, err := json.Marshal(got[0])
+	if err != nil || !strings.Contains(string(out), `"state":"open"`) {
+		t.Errorf("json.Marshal = %s, %v", out, err)
+	}
+}
@@ -0,0 +1,133 @@
+// Package callchain implements the agent-to-agent identity propagation
+// profile: a short-lived HS256 JWT, carried in a request header, that records
+// the original (human) subject of a call and every agent it passed through.
+//
+// The chain uses the RFC 8693 "act" claim: the outermost act is the most
+// recent actor and each nested act the one before it, e.g. for
+// user -> agent-a -> agent-b:
+//
+//	{"sub": "alice", "act": {"sub": "agent-b", "act": {"sub": "agent-a"}}}
+package callchain
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/lestrrat-go/jwx/v2/jwa"
+	"github.com/lestrrat-go/jwx/v2/jwt"
+)
+
+// Chain is a verified call chain.
+type Chain struct {
+	// Subject is the original subject of the call.
+	Subject string
+	// Actors are the agents the call passed through, oldest first.
+	Actors []string
+}
+
+// Append returns the chain extended with actor.
+func (c Chain) Append(actor string) Chain {
+	actors := make([]string, len(c.Actors), len(c.Actors)+1)
+	copy(actors, c.Actors)
+	return Chain{Subject: c.Subject, Actors: append(actors, actor)}
+}
+
+// Signer signs and verifies chains with a key shared by all participants.
+type Signer struct {
+	Key []byte
+	// TTL is the lifetime of a signed chain.
+	TTL time.Duration
+	// MaxDepth bounds the number of actors, as a guard against call loops.
+	// Zero means unlimited.
+	MaxDepth int
+	// Now returns the current time; time.Now when nil.
+	Now func() time.Time
+}
+
+func (s *Signer) now() time.Time {
+	if s.Now != nil {
+		return s.Now()
+	}
+	return time.Now()
+}
+
+// Sign encodes the chain as a signed JWT.
+func (s *Signer) Sign(c Chain) (string, error) {
+	if c.Subject == "" {
+		return "", errors.New("call chain has no subject")
+	}
+	if s.MaxDepth > 0 && len(c.Actors) > s.MaxDepth {
+		return "", fmt.Errorf("call chain exceeds %d actors", s.MaxDepth)
+	}
+	now := s.now()
+	token := jwt.New()
+	_ = token.Set(jwt.SubjectKey, c.Subject)
+	_ = token.Set(jwt.IssuedAtKey, now)
+	_ = token.Set(jwt.ExpirationKey, now.Add(s.TTL))
+	if act := nestActors(c.Actors); act != nil {
+		_ = token.Set("act", act)
+	}
+	signed, err := jwt.Sign(token, jwt.WithKey(jwa.HS256, s.Key))
+	if err != nil {
+		return "", err
+	}
+	return string(signed), nil
+}
+
+// Verify checks the signature and expiry of a signed chain and decodes it.
+func (s *Signer) Verify(value string) (Chain, error) {
+	token, err := jwt.Parse([]byte(value),
+		jwt.WithKey(jwa.HS256, s.Key),
+		jwt.WithValidate(true),
+		jwt.WithClock(jwt.ClockFunc(s.now)))
+	if err != nil {
+		return Chain{}, fmt.Errorf("invalid call chain: %w", err)
+	}
+	if token.Subject() == "" {
+		return Chain{}, errors.New("invalid call chain: no subject")
+	}
+	chain := Chain{Subject: token.Subject()}
+	if act, ok := token.Get("act"); ok {
+		actors, err := flattenActors(act)
+		if err != nil {
+			return Chain{}, err
+		}
+		chain.Actors = actors
+	}
+	if s.MaxDepth > 0 && len(chain.Actors) > s.MaxDepth {
+		return Chain{}, fmt.Errorf("invalid call chain: more than %d actors", s.MaxDepth)
+	}
+	return chain, nil
+}
+
+// nestActors builds the act claim, most recent actor outermost.
+func nestActors(actors []string) map[string]interface{} {
+	var act map[string]interface{}
+	for _, actor := range actors {
+		next := map[string]interface{}{"sub": actor}
+		if act != nil {
+			next["act"] = act
+		}
+		act = next
+	}
+	return act
+}
+
+// flattenActors reverses nestActors.
+func flattenActors(act interface{}) ([]string, error) {
+	var actors []string
+	for act != nil {
+		m, ok := act.(map[string]interface{})
+		if !ok {
+			return nil, errors.New("invalid call chain: act is not an object")
+		}
+		sub, _ := m["sub"].(string)
+		if sub == "" {
+			return nil, errors.New("invalid call chain: actor without sub")
+		}
+		actors = append([]string{sub}, actors...)
+		act = m["act"]
+	}
+	return actors, nil
+}
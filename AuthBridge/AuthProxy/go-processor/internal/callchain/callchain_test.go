@@ -0,0 +1,87 @@
+package callchain
+
+import (
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newSigner(now time.Time) *Signer {
+	return &Signer{
+		Key:      []byte("0123456789abcdef0123456789abcdef"),
+		TTL:      time.Minute,
+		MaxDepth: 3,
+		Now:      func() time.Time { return now },
+	}
+}
+
+func TestSignVerifyRoundTrip(t *testing.T) {
+	s := newSigner(time.Now())
+	chain := Chain{Subject: "alice"}.Append("spiffe://td/ns/a/sa/agent-a").Append("spiffe://td/ns/b/sa/agent-b")
+
+	signed, err := s.Sign(chain)
+	if err != nil {
+		t.Fatalf("Sign: %v", err)
+	}
+	got, err := s.Verify(signed)
+	if err != nil {
+		t.Fatalf("Verify: %v", err)
+	}
+	if got.Subject != "alice" || !slices.Equal(got.Actors, chain.Actors) {
+		t.Errorf("Verify() = %+v, want %+v", got, chain)
+	}
+}
+
+func TestVerifyRejects(t *testing.T) {
+	now := time.Now()
+	s := newSigner(now)
+	signed, err := s.Sign(Chain{Subject: "alice", Actors: []string{"agent-a"}})
+	if err != nil {
+		t.Fatalf("Sign: %v", err)
+	}
+
+	other := newSigner(now)
+	other.Key = []byte("another-key-another-key-another-k")
+	if _, err := other.Verify(signed); err == nil {
+		t.Error("expected a chain signed with another key to be rejected")
+	}
+
+	expired := newSigner(now.Add(2 * time.Minute))
+	if _, err := expired.Verify(signed); err == nil {
+		t.Error("expected an expired chain to be rejected")
+	}
+
+	parts := strings.Split(signed, ".")
+	if _, err := s.Verify(parts[0] + "." + parts[1] + ".AAAA"); err == nil {
+		t.Error("expected a tampered chain to be rejected")
+	}
+}
+
+func TestMaxDepth(t *testing.T) {
+	s := newSigner(time.Now())
+	chain := Chain{Subject: "alice", Actors: []string{"a", "b", "c", "d"}}
+	if _, err := s.Sign(chain); err == nil {
+		t.Error("expected Sign to reject a chain deeper than MaxDepth")
+	}
+
+	unbounded := newSigner(time.Now())
+	unbounded.MaxDepth = 0
+	signed, err := unbounded.Sign(chain)
+	if err != nil {
+		t.Fatalf("Sign: %v", err)
+	}
+	if _, err := s.Verify(signed); err == nil {
+		t.Error("expected Verify to reject a chain deeper than MaxDepth")
+	}
+}
+
+func TestAppendDoesNotAlias(t *testing.T) {
+	base := Chain{Subject: "alice", Actors: make([]string, 1, 4)}
+	base.Actors[0] = "a"
+	x := base.Append("x")
+	y := base.Append("y")
+	if x.Actors[1] != "x" || y.Actors[1] != "y" {
+		t.Errorf("Append aliased the actor slice: %v %v", x.Actors, y.Actors)
+	}
+}
@@ -0,0 +1,270 @@
+// Package claims evaluates configuration-driven assertions against the
+// claims of an already signature-verified JWT.
+//
+// Each assertion is a one-line expression of the form
+//
+//	<claim path> <operator> [value]
+//
+// for example:
+//
+//	azp == spiffe://cluster.local/ns/team1/sa/agent
+//	groups contains mcp-users
+//	realm_access.roles contains tool-caller
+//	scope contains "mcp:tools"
+//	email matches .*@example\.com
+//	act exists
+package claims
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Operator is a comparison applied to a claim value.
+type Operator string
+
+const (
+	OpEquals      Operator = "=="
+	OpNotEquals   Operator = "!="
+	OpContains    Operator = "contains"
+	OpNotContains Operator = "!contains"
+	OpIn          Operator = "in"
+	OpMatches     Operator = "matches"
+	OpExists      Operator = "exists"
+)
+
+// Rule is a single parsed claim assertion.
+type Rule struct {
+	// Expr is the original expression, used in error messages.
+	Expr string
+	// Path is the claim path split on '.', e.g. ["realm_access", "roles"].
+	Path []string
+	Op   Operator
+	// Value is the right-hand operand. For OpIn it is a comma-separated list.
+	Value string
+
+	re *regexp.Regexp
+}
+
+// AssertionError is returned when a verified token fails a claim assertion.
+// Callers use it to tell authorization failures (403) from authentication
+// failures (401).
+type AssertionError struct {
+	Rule   string
+	Reason string
+}
+
+func (e *AssertionError) Error() string {
+	return fmt.Sprintf("claim assertion %q failed: %s", e.Rule, e.Reason)
+}
+
+// Parse parses a single assertion expression.
+func Parse(expr string) (Rule, error) {
+	expr = strings.TrimSpace(expr)
+	path, rest, _ := strings.Cut(expr, " ")
+	if path == "" {
+		return Rule{}, fmt.Errorf("empty claim assertion")
+	}
+	rest = strings.TrimSpace(rest)
+	op, value, _ := strings.Cut(rest, " ")
+	value = strings.TrimSpace(value)
+
+	rule := Rule{
+		Expr: expr,
+		Path: strings.Split(path, "."),
+		Op:   Operator(op),
+	}
+
+	if unquoted, err := strconv.Unquote(value); err == nil {
+		value = unquoted
+	}
+	rule.Value = value
+
+	switch rule.Op {
+	case OpExists:
+		if value != "" {
+			return Rule{}, fmt.Errorf("claim assertion %q: %q takes no value", expr, op)
+		}
+	case OpEquals, OpNotEquals, OpContains, OpNotContains, OpIn:
+		if value == "" {
+			return Rule{}, fmt.Errorf("claim assertion %q: %q requires a value", expr, op)
+		}
+	case OpMatches:
+		re, err := regexp.Compile("^(?:" + value + ")$")
+		if err != nil {
+			return Rule{}, fmt.Errorf("claim assertion %q: invalid pattern: %w", expr, err)
+		}
+		rule.re = re
+	default:
+		return Rule{}, fmt.Errorf("claim assertion %q: unknown operator %q", expr, op)
+	}
+
+	return rule, nil
+}
+
+// LoadRules reads a YAML list of assertion expressions from path.
+// Returns no rules if the file doesn't exist.
+func LoadRules(path string) ([]Rule, error) {
+	content, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		slog.Info("No claim assertions", "component", "claims", "path", path)
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return ParseRules(content)
+}
+
+// ParseRules parses YAML lists of assertion expressions, as in an assertions
+// file, into one rule set.
+func ParseRules(docs ...[]byte) ([]Rule, error) {
+	var exprs []string
+	for _, content := range docs {
+		var doc []string
+		if err := yaml.Unmarshal(content, &doc); err != nil {
+			return nil, err
+		}
+		exprs = append(exprs, doc...)
+	}
+
+	rules := make([]Rule, 0, len(exprs))
+	for _, expr := range exprs {
+		rule, err := Parse(expr)
+		if err != nil {
+			return nil, err
+		}
+		rules = append(rules, rule)
+	}
+
+	slog.Info("Loaded claim assertions", "component", "claims", "count", len(rules))
+	return rules, nil
+}
+
+// Evaluate checks every rule against the token claims and returns an
+// *AssertionError for the first rule that does not hold.
+func Evaluate(rules []Rule, tokenClaims map[string]interface{}) error {
+	for _, rule := range rules {
+		if err := rule.evaluate(tokenClaims); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r Rule) evaluate(tokenClaims map[string]interface{}) error {
+	value, found := lookup(tokenClaims, r.Path)
+
+	if r.Op == OpExists {
+		if !found {
+			return r.fail("claim not present")
+		}
+		return nil
+	}
+	if !found {
+		// A missing claim satisfies only the negative operators
+		if r.Op == OpNotEquals || r.Op == OpNotContains {
+			return nil
+		}
+		return r.fail("claim not present")
+	}
+
+	switch r.Op {
+	case OpEquals:
+		if !equals(value, r.Value) {
+			return r.fail(fmt.Sprintf("got %v", value))
+		}
+	case OpNotEquals:
+		if equals(value, r.Value) {
+			return r.fail(fmt.Sprintf("got %v", value))
+		}
+	case OpContains:
+		if !contains(value, r.Value) {
+			return r.fail(fmt.Sprintf("%v does not contain %q", value, r.Value))
+		}
+	case OpNotContains:
+		if contains(value, r.Value) {
+			return r.fail(fmt.Sprintf("%v contains %q", value, r.Value))
+		}
+	case OpIn:
+		for _, candidate := range strings.Split(r.Value, ",") {
+			if equals(value, strings.TrimSpace(candidate)) {
+				return nil
+			}
+		}
+		return r.fail(fmt.Sprintf("got %v", value))
+	case OpMatches:
+		if !r.re.MatchString(stringify(value)) {
+			return r.fail(fmt.Sprintf("got %v", value))
+		}
+	}
+	return nil
+}
+
+func (r Rule) fail(reason string) error {
+	return &AssertionError{Rule: r.Expr, Reason: reason}
+}
+
+// lookup walks a dotted claim path through nested JSON objects.
+func lookup(tokenClaims map[string]interface{}, path []string) (interface{}, bool) {
+	var current interface{} = tokenClaims
+	for _, key := range path {
+		obj, ok := current.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		current, ok = obj[key]
+		if !ok {
+			return nil, false
+		}
+	}
+	return current, true
+}
+
+// contains reports whether an array claim has an element equal to want, or
+// whether a string claim has want as one of its space-separated tokens
+// (the encoding used by the OAuth "scope" claim).
+func contains(value interface{}, want string) bool {
+	switch v := value.(type) {
+	case []interface{}:
+		for _, elem := range v {
+			if equals(elem, want) {
+				return true
+			}
+		}
+	case []string:
+		for _, elem := range v {
+			if elem == want {
+				return true
+			}
+		}
+	case string:
+		for _, token := range strings.Fields(v) {
+			if token == want {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func equals(value interface{}, want string) bool {
+	return stringify(value) == want
+}
+
+func stringify(value interface{}) string {
+	switch v := value.(type) {
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	default:
+		return fmt.Sprint(v)
+	}
+}
@@ -0,0 +1,110 @@
+package claims
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func testClaims() map[string]interface{} {
+	return map[string]interface{}{
+		"azp":    "spiffe://cluster.local/ns/team1/sa/agent",
+		"groups": []interface{}{"mcp-users", "developers"},
+		"aud":    []string{"tool-a", "tool-b"},
+		"scope":  "openid profile mcp:tools",
+		"email":  "alice@example.com",
+		"age":    float64(42),
+		"realm_access": map[string]interface{}{
+			"roles": []interface{}{"tool-caller"},
+		},
+	}
+}
+
+func TestEvaluate(t *testing.T) {
+	tests := []struct {
+		expr string
+		pass bool
+	}{
+		{"azp == spiffe://cluster.local/ns/team1/sa/agent", true},
+		{"azp == spiffe://cluster.local/ns/team2/sa/agent", false},
+		{"azp != spiffe://cluster.local/ns/team2/sa/agent", true},
+		{"groups contains mcp-users", true},
+		{"groups contains admins", false},
+		{"groups !contains admins", true},
+		{"aud contains tool-b", true},
+		{`scope contains "mcp:tools"`, true},
+		{"scope contains mcp", false},
+		{"realm_access.roles contains tool-caller", true},
+		{"realm_access.missing contains tool-caller", false},
+		{"email matches .*@example\\.com", true},
+		{"email matches example", false},
+		{"age == 42", true},
+		{"azp in spiffe://a, spiffe://cluster.local/ns/team1/sa/agent", true},
+		{"azp in spiffe://a, spiffe://b", false},
+		{"act exists", false},
+		{"email exists", true},
+		{"act != anything", true},
+	}
+
+	for _, tc := range tests {
+		rule, err := Parse(tc.expr)
+		if err != nil {
+			t.Fatalf("Parse(%q): unexpected error: %v", tc.expr, err)
+		}
+		err = Evaluate([]Rule{rule}, testClaims())
+		if tc.pass && err != nil {
+			t.Errorf("%q: expected pass, got %v", tc.expr, err)
+		}
+		if !tc.pass {
+			var assertionErr *AssertionError
+			if !errors.As(err, &assertionErr) {
+				t.Errorf("%q: expected *AssertionError, got %v", tc.expr, err)
+			}
+		}
+	}
+}
+
+func TestParse_Invalid(t *testing.T) {
+	for _, expr := range []string{
+		"",
+		"azp",
+		"azp ~= foo",
+		"azp ==",
+		"azp exists foo",
+		"email matches (",
+	} {
+		if _, err := Parse(expr); err == nil {
+			t.Errorf("Parse(%q): expected error, got nil", expr)
+		}
+	}
+}
+
+func TestLoadRules(t *testing.T) {
+	rules, err := LoadRules("/nonexistent/claim-assertions.yaml")
+	if err != nil {
+		t.Fatalf("unexpected error for missing file: %v", err)
+	}
+	if len(rules) != 0 {
+		t.Errorf("expected no rules for missing file, got %d", len(rules))
+	}
+
+	path := filepath.Join(t.TempDir(), "claim-assertions.yaml")
+	content := `
+- "groups contains mcp-users"
+- "azp exists"
+`
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatalf("failed to write test yaml: %v", err)
+	}
+	rules, err = LoadRules(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(rules) != 2 {
+		t.Fatalf("expected 2 rules, got %d", len(rules))
+	}
+	if err := Evaluate(rules, testClaims()); err != nil {
+		t.Errorf("expected rules to pass, got %v", err)
+	}
+}
@@ -0,0 +1,168 @@
+// Package configservice implements a gRPC service through which a controller,
+// such as the kagenti-webhook's TokenExchange controller, pushes routes and
+// claim assertions to a running processor instead of mounting files.
+//
+// The protocol borrows xDS's state-of-the-world messages (see config.proto):
+// the controller opens StreamConfig and sends a DiscoveryResponse holding
+// every resource of one type under a version; the processor applies them
+// atomically and answers with a DiscoveryRequest that ACKs the version, or
+// NACKs it with error_detail while naming the version still in effect. When a
+// stream opens, the processor first sends one DiscoveryRequest per type with
+// its current version, so a controller can skip pushes that are already
+// applied.
+package configservice
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+
+	discovery "github.com/envoyproxy/go-control-plane/envoy/service/discovery/v3"
+	rpcstatus "google.golang.org/genproto/googleapis/rpc/status"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+)
+
+// ServiceName is the full name of the gRPC service.
+const ServiceName = "authbridge.config.v1.ConfigService"
+
+// Resource types. Each resource is an Any of the push's type whose value is a
+// YAML document in the format of the corresponding file.
+const (
+	// TypeRoutes resources are YAML lists of routes, as in routes.yaml.
+	TypeRoutes = "type.kagenti.io/authbridge.config.v1.Routes"
+	// TypeClaimAssertions resources are YAML lists of claim assertions.
+	TypeClaimAssertions = "type.kagenti.io/authbridge.config.v1.ClaimAssertions"
+)
+
+// ApplyFunc replaces the configuration of one type with the given resources.
+// It must leave the current configuration in place when it returns an error.
+type ApplyFunc func(version string, resources [][]byte) error
+
+// Server applies pushed configuration. Pushes are serialized across streams.
+type Server struct {
+	mu       sync.Mutex
+	appliers map[string]ApplyFunc
+	versions map[string]string
+}
+
+// NewServer returns a server accepting the types of appliers.
+func NewServer(appliers map[string]ApplyFunc) *Server {
+	return &Server{appliers: appliers, versions: make(map[string]string)}
+}
+
+// Register adds the service to a gRPC server.
+func (s *Server) Register(server *grpc.Server) {
+	server.RegisterService(&serviceDesc, s)
+}
+
+// Version returns the version of typeURL in effect, "" if none was pushed.
+func (s *Server) Version(typeURL string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.versions[typeURL]
+}
+
+// Push applies one push and returns its ACK or NACK. A version equal to the
+// one in effect is acknowledged without applying it again.
+func (s *Server) Push(resp *discovery.DiscoveryResponse) *discovery.DiscoveryRequest {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	typeURL, version := resp.GetTypeUrl(), resp.GetVersionInfo()
+	err := func() error {
+		apply, ok := s.appliers[typeURL]
+		switch {
+		case !ok:
+			return fmt.Errorf("unknown type %q", typeURL)
+		case version == "":
+			return errors.New("version_info is required")
+		case version == s.versions[typeURL]:
+			return nil
+		}
+		docs := make([][]byte, 0, len(resp.GetResources()))
+		for i, res := range resp.GetResources() {
+			if res.GetTypeUrl() != typeURL {
+				return fmt.Errorf("resource %d has type %q, want %q", i, res.GetTypeUrl(), typeURL)
+			}
+			docs = append(docs, res.GetValue())
+		}
+		if err := apply(version, docs); err != nil {
+			return err
+		}
+		s.versions[typeURL] = version
+		return nil
+	}()
+
+	reply := &discovery.DiscoveryRequest{
+		TypeUrl:       typeURL,
+		VersionInfo:   s.versions[typeURL],
+		ResponseNonce: resp.GetNonce(),
+	}
+	if err != nil {
+		reply.ErrorDetail = &rpcstatus.Status{Code: int32(codes.InvalidArgument), Message: err.Error()}
+	}
+	return reply
+}
+
+// StreamConfig serves one controller stream until it is closed.
+func (s *Server) StreamConfig(stream grpc.ServerStream) error {
+	s.mu.Lock()
+	types := make([]string, 0, len(s.appliers))
+	for typeURL := range s.appliers {
+		types = append(types, typeURL)
+	}
+	sort.Strings(types)
+	current := make([]*discovery.DiscoveryRequest, 0, len(types))
+	for _, typeURL := range types {
+		current = append(current, &discovery.DiscoveryRequest{TypeUrl: typeURL, VersionInfo: s.versions[typeURL]})
+	}
+	s.mu.Unlock()
+	for _, req := range current {
+		if err := stream.SendMsg(req); err != nil {
+			return err
+		}
+	}
+
+	for {
+		resp := &discovery.DiscoveryResponse{}
+		if err := stream.RecvMsg(resp); errors.Is(err, io.EOF) {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		if err := stream.SendMsg(s.Push(resp)); err != nil {
+			return err
+		}
+	}
+}
+
+// configServiceServer is the handler type of serviceDesc.
+type configServiceServer interface {
+	StreamConfig(grpc.ServerStream) error
+}
+
+// serviceDesc is written by hand, as the service only uses xDS messages; see
+// config.proto for its definition.
+var serviceDesc = grpc.ServiceDesc{
+	ServiceName: ServiceName,
+	HandlerType: (*configServiceServer)(nil),
+	Streams: []grpc.StreamDesc{{
+		StreamName: "StreamConfig",
+		Handler: func(srv any, stream grpc.ServerStream) error {
+			return srv.(configServiceServer).StreamConfig(stream)
+		},
+		ServerStreams: true,
+		ClientStreams: true,
+	}},
+	Metadata: "config.proto",
+}
+
+// StreamDesc describes StreamConfig for clients, e.g. with
+// grpc.ClientConn.NewStream(ctx, &StreamDesc, StreamMethod).
+var StreamDesc = serviceDesc.Streams[0]
+
+// StreamMethod is the full method name of StreamConfig.
+const StreamMethod = "/" + ServiceName + "/StreamConfig"
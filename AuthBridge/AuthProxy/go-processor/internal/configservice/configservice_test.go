@@ -0,0 +1,134 @@
+package configservice
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strings"
+	"testing"
+
+	discovery "github.com/envoyproxy/go-control-plane/envoy/service/discovery/v3"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/test/bufconn"
+	"google.golang.org/protobuf/types/known/anypb"
+)
+
+func push(typeURL, version, nonce string, docs ...string) *discovery.DiscoveryResponse {
+	resp := &discovery.DiscoveryResponse{TypeUrl: typeURL, VersionInfo: version, Nonce: nonce}
+	for _, doc := range docs {
+		resp.Resources = append(resp.Resources, &anypb.Any{TypeUrl: typeURL, Value: []byte(doc)})
+	}
+	return resp
+}
+
+// recorder is an ApplyFunc that rejects documents containing "invalid".
+type recorder struct {
+	applied [][]byte
+	calls   int
+}
+
+func (r *recorder) apply(_ string, docs [][]byte) error {
+	r.calls++
+	for _, doc := range docs {
+		if strings.Contains(string(doc), "invalid") {
+			return errors.New("invalid document")
+		}
+	}
+	r.applied = docs
+	return nil
+}
+
+func TestPush_AckNack(t *testing.T) {
+	routes := &recorder{}
+	s := NewServer(map[string]ApplyFunc{TypeRoutes: routes.apply})
+
+	ack := s.Push(push(TypeRoutes, "v1", "n1", "- host: a", "- host: b"))
+	if ack.GetErrorDetail() != nil || ack.GetVersionInfo() != "v1" || ack.GetResponseNonce() != "n1" {
+		t.Fatalf("ack = %v", ack)
+	}
+	if len(routes.applied) != 2 || s.Version(TypeRoutes) != "v1" {
+		t.Fatalf("applied %q, version %q", routes.applied, s.Version(TypeRoutes))
+	}
+
+	nack := s.Push(push(TypeRoutes, "v2", "n2", "- host: c", "invalid"))
+	if nack.GetErrorDetail() == nil || nack.GetVersionInfo() != "v1" || nack.GetResponseNonce() != "n2" {
+		t.Fatalf("nack = %v", nack)
+	}
+	if string(routes.applied[0]) != "- host: a" || s.Version(TypeRoutes) != "v1" {
+		t.Errorf("rejected push changed the configuration: %q", routes.applied)
+	}
+
+	// The version in effect is not applied again
+	calls := routes.calls
+	if ack := s.Push(push(TypeRoutes, "v1", "n3", "- host: a")); ack.GetErrorDetail() != nil || routes.calls != calls {
+		t.Errorf("repeated version: ack = %v, calls %d -> %d", ack, calls, routes.calls)
+	}
+}
+
+func TestPush_Rejected(t *testing.T) {
+	s := NewServer(map[string]ApplyFunc{TypeRoutes: (&recorder{}).apply})
+	tests := map[string]*discovery.DiscoveryResponse{
+		"unknown type":   push("type.kagenti.io/other", "v1", "n"),
+		"no version":     push(TypeRoutes, "", "n", "- host: a"),
+		"mixed resource": {TypeUrl: TypeRoutes, VersionInfo: "v1", Resources: []*anypb.Any{{TypeUrl: TypeClaimAssertions}}},
+	}
+	for name, resp := range tests {
+		if reply := s.Push(resp); reply.GetErrorDetail() == nil {
+			t.Errorf("%s: expected a NACK, got %v", name, reply)
+		}
+	}
+	if s.Version(TypeRoutes) != "" {
+		t.Errorf("version = %q after rejected pushes", s.Version(TypeRoutes))
+	}
+}
+
+func TestStreamConfig(t *testing.T) {
+	routes, claims := &recorder{}, &recorder{}
+	s := NewServer(map[string]ApplyFunc{TypeRoutes: routes.apply, TypeClaimAssertions: claims.apply})
+	s.Push(push(TypeClaimAssertions, "c1", "", "- act exists"))
+
+	lis := bufconn.Listen(1 << 20)
+	server := grpc.NewServer()
+	s.Register(server)
+	go server.Serve(lis)
+	defer server.Stop()
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return lis.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	stream, err := conn.NewStream(context.Background(), &StreamDesc, StreamMethod)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The current versions are announced first, in type order
+	want := map[string]string{TypeClaimAssertions: "c1", TypeRoutes: ""}
+	for range want {
+		req := &discovery.DiscoveryRequest{}
+		if err := stream.RecvMsg(req); err != nil {
+			t.Fatal(err)
+		}
+		if v, ok := want[req.GetTypeUrl()]; !ok || v != req.GetVersionInfo() {
+			t.Errorf("announced %s version %q", req.GetTypeUrl(), req.GetVersionInfo())
+		}
+	}
+
+	if err := stream.SendMsg(push(TypeRoutes, "r1", "n1", "- host: a")); err != nil {
+		t.Fatal(err)
+	}
+	ack := &discovery.DiscoveryRequest{}
+	if err := stream.RecvMsg(ack); err != nil {
+		t.Fatal(err)
+	}
+	if ack.GetErrorDetail() != nil || ack.GetVersionInfo() != "r1" || ack.GetResponseNonce() != "n1" {
+		t.Errorf("ack = %v", ack)
+	}
+	if err := stream.CloseSend(); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,145 @@
+// Package dpop creates RFC 9449 DPoP proofs: short-lived JWTs, signed with a
+// key only the client holds, that tie a request to that key. A token issued
+// for a DPoP proof is bound to the key, so it is useless to whoever steals it
+// without the key.
+//
+// A proof names the request it is made for (htm, htu) and, when presenting a
+// token to a resource server, the token's hash (ath):
+//
+//	header: {"typ": "dpop+jwt", "alg": "ES256", "jwk": {...public key...}}
+//	claims: {"jti": "...", "htm": "GET", "htu": "https://tools/mcp", "iat": 1700000000, "ath": "..."}
+package dpop
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"net/url"
+	"time"
+
+	"github.com/lestrrat-go/jwx/v2/jwa"
+	"github.com/lestrrat-go/jwx/v2/jwk"
+	"github.com/lestrrat-go/jwx/v2/jws"
+	"github.com/lestrrat-go/jwx/v2/jwt"
+)
+
+// ProofType is the typ header of a DPoP proof.
+const ProofType = "dpop+jwt"
+
+// Proofer signs DPoP proofs with one key.
+type Proofer struct {
+	key        jwk.Key
+	public     jwk.Key
+	alg        jwa.SignatureAlgorithm
+	thumbprint string
+
+	// Now is the clock; tests override it.
+	Now func() time.Time
+}
+
+// New returns a Proofer signing with the private key and alg.
+func New(key jwk.Key, alg jwa.SignatureAlgorithm) (*Proofer, error) {
+	public, err := key.PublicKey()
+	if err != nil {
+		return nil, fmt.Errorf("public key: %w", err)
+	}
+	tp, err := public.Thumbprint(crypto.SHA256)
+	if err != nil {
+		return nil, fmt.Errorf("key thumbprint: %w", err)
+	}
+	return &Proofer{
+		key:        key,
+		public:     public,
+		alg:        alg,
+		thumbprint: base64.RawURLEncoding.EncodeToString(tp),
+		Now:        time.Now,
+	}, nil
+}
+
+// Generate returns a Proofer with a fresh P-256 key. Tokens bound to it
+// cannot be used once the process exits.
+func Generate() (*Proofer, error) {
+	priv, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	key, err := jwk.FromRaw(priv)
+	if err != nil {
+		return nil, err
+	}
+	return New(key, jwa.ES256)
+}
+
+// Thumbprint is the RFC 7638 SHA-256 thumbprint of the public key, the jkt
+// an IdP records in the tokens bound to it.
+func (p *Proofer) Thumbprint() string {
+	return p.thumbprint
+}
+
+// Proof returns a proof for a request with the given method and URI. A
+// non-empty accessToken is bound through ath, as resource servers require;
+// token endpoint proofs have none. nonce is the last DPoP-Nonce the server
+// sent, if any.
+func (p *Proofer) Proof(method, uri, accessToken, nonce string) (string, error) {
+	htu, err := TargetURI(uri)
+	if err != nil {
+		return "", err
+	}
+	jti := make([]byte, 16)
+	if _, err := rand.Read(jti); err != nil {
+		return "", err
+	}
+
+	builder := jwt.NewBuilder().
+		JwtID(hex.EncodeToString(jti)).
+		IssuedAt(p.Now()).
+		Claim("htm", method).
+		Claim("htu", htu)
+	if accessToken != "" {
+		builder = builder.Claim("ath", TokenHash(accessToken))
+	}
+	if nonce != "" {
+		builder = builder.Claim("nonce", nonce)
+	}
+	token, err := builder.Build()
+	if err != nil {
+		return "", err
+	}
+
+	headers := jws.NewHeaders()
+	if err := headers.Set(jws.TypeKey, ProofType); err != nil {
+		return "", err
+	}
+	if err := headers.Set(jws.JWKKey, p.public); err != nil {
+		return "", err
+	}
+	signed, err := jwt.Sign(token, jwt.WithKey(p.alg, p.key, jws.WithProtectedHeaders(headers)))
+	if err != nil {
+		return "", fmt.Errorf("sign DPoP proof: %w", err)
+	}
+	return string(signed), nil
+}
+
+// TargetURI returns uri as it appears in htu: without query and fragment.
+func TargetURI(uri string) (string, error) {
+	u, err := url.Parse(uri)
+	if err != nil {
+		return "", fmt.Errorf("DPoP target URI: %w", err)
+	}
+	if u.Scheme == "" || u.Host == "" {
+		return "", fmt.Errorf("DPoP target URI %q is not absolute", uri)
+	}
+	u.RawQuery, u.ForceQuery, u.Fragment, u.RawFragment = "", false, "", ""
+	return u.String(), nil
+}
+
+// TokenHash is the ath of an access token: base64url(SHA-256(token)).
+func TokenHash(accessToken string) string {
+	sum := sha256.Sum256([]byte(accessToken))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
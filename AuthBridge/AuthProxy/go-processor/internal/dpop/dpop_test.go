@@ -0,0 +1,116 @@
+package dpop
+
+import (
+	"crypto"
+	"encoding/base64"
+	"testing"
+	"time"
+
+	"github.com/lestrrat-go/jwx/v2/jws"
+	"github.com/lestrrat-go/jwx/v2/jwt"
+)
+
+// verify checks a proof the way a server does: with the key in its own header.
+func verify(t *testing.T, proof string) (jws.Headers, jwt.Token) {
+	t.Helper()
+	msg, err := jws.Parse([]byte(proof))
+	if err != nil {
+		t.Fatal(err)
+	}
+	headers := msg.Signatures()[0].ProtectedHeaders()
+	if headers.Type() != ProofType {
+		t.Errorf("typ = %q, want %q", headers.Type(), ProofType)
+	}
+	key := headers.JWK()
+	if key == nil {
+		t.Fatal("proof has no jwk header")
+	}
+	token, err := jwt.Parse([]byte(proof), jwt.WithKey(headers.Algorithm(), key), jwt.WithValidate(false))
+	if err != nil {
+		t.Fatalf("proof does not verify with its own key: %v", err)
+	}
+	return headers, token
+}
+
+func claim(token jwt.Token, name string) string {
+	v, _ := token.Get(name)
+	s, _ := v.(string)
+	return s
+}
+
+func TestProof(t *testing.T) {
+	p, err := Generate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Unix(1700000000, 0)
+	p.Now = func() time.Time { return now }
+
+	proof, err := p.Proof("GET", "https://tools.example.com/mcp?session=1#frag", "access-token", "server-nonce")
+	if err != nil {
+		t.Fatal(err)
+	}
+	headers, token := verify(t, proof)
+
+	if got := claim(token, "htm"); got != "GET" {
+		t.Errorf("htm = %q", got)
+	}
+	if got := claim(token, "htu"); got != "https://tools.example.com/mcp" {
+		t.Errorf("htu = %q, want query and fragment stripped", got)
+	}
+	if got := claim(token, "ath"); got != TokenHash("access-token") {
+		t.Errorf("ath = %q", got)
+	}
+	if got := claim(token, "nonce"); got != "server-nonce" {
+		t.Errorf("nonce = %q", got)
+	}
+	if !token.IssuedAt().Equal(now) {
+		t.Errorf("iat = %v, want %v", token.IssuedAt(), now)
+	}
+
+	// The jwk header must be public and match the advertised thumbprint
+	if _, ok := headers.JWK().Get("d"); ok {
+		t.Error("proof leaks the private key")
+	}
+	tp, err := headers.JWK().Thumbprint(crypto.SHA256)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := base64.RawURLEncoding.EncodeToString(tp); got != p.Thumbprint() {
+		t.Errorf("thumbprint = %q, want %q", got, p.Thumbprint())
+	}
+}
+
+func TestProofWithoutToken(t *testing.T) {
+	p, err := Generate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	first, err := p.Proof("POST", "https://idp.example.com/token", "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, _ := p.Proof("POST", "https://idp.example.com/token", "", "")
+
+	_, a := verify(t, first)
+	_, b := verify(t, second)
+	if _, ok := a.Get("ath"); ok {
+		t.Error("token endpoint proof has ath")
+	}
+	if _, ok := a.Get("nonce"); ok {
+		t.Error("proof has a nonce nobody asked for")
+	}
+	if a.JwtID() == "" || a.JwtID() == b.JwtID() {
+		t.Errorf("jti must be unique per proof: %q, %q", a.JwtID(), b.JwtID())
+	}
+}
+
+func TestTargetURI(t *testing.T) {
+	if _, err := TargetURI("/mcp"); err == nil {
+		t.Error("expected an error for a relative URI")
+	}
+	got, err := TargetURI("http://tools:8080/a/b?x=1")
+	if err != nil || got != "http://tools:8080/a/b" {
+		t.Errorf("TargetURI() = %q, %v", got, err)
+	}
+}
@@ -0,0 +1,118 @@
+// Package idp holds the identity providers an agent accepts tokens from when
+// there is more than one. Each is keyed by the issuer (iss) of its tokens and
+// names the token endpoint, client and keys to use for them, so one
+// AuthBridge can exchange and validate tokens of several IdPs.
+package idp
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+
+	"github.com/lestrrat-go/jwx/v2/jwt"
+
+	"github.com/kagenti/kagenti-extensions/AuthBridge/AuthProxy/go-processor/internal/resolver"
+	"github.com/kagenti/kagenti-extensions/configschema"
+)
+
+// Provider is one identity provider.
+type Provider struct {
+	Issuer   string `yaml:"issuer" doc:"iss claim of the IdP's tokens"`
+	TokenURL string `yaml:"token_url" doc:"Token endpoint exchanging the IdP's tokens"`
+	// JWKSURL is empty to derive it from TokenURL, as for TOKEN_URL
+	JWKSURL string `yaml:"jwks_url,omitempty" doc:"Keys of the IdP's tokens; default derived from token_url"`
+	// ClientID is empty to use the global client at this IdP too
+	ClientID        string             `yaml:"client_id,omitempty" doc:"Client ID registered at this IdP"`
+	ClientSecretRef resolver.SecretRef `yaml:"client_secret_ref,omitempty" doc:"Secret of client_id: a file or an environment variable"`
+	TokenCAFile     string             `yaml:"token_ca_file,omitempty" doc:"PEM bundle trusted for token_url"`
+}
+
+// Registry is the set of configured providers.
+type Registry struct {
+	providers []*Provider
+	byIssuer  map[string]*Provider
+}
+
+// Schema returns the JSON Schema of the providers file.
+func Schema() ([]byte, error) {
+	return configschema.Schema([]Provider{}, "AuthBridge identity providers")
+}
+
+// Load reads the providers file at path. A missing file is not an error and
+// returns a nil registry.
+func Load(path string) (*Registry, error) {
+	content, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		slog.Info("No identity providers config, using the global IdP", "component", "idp", "path", path)
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return Parse(path, content)
+}
+
+// Parse decodes a YAML list of providers. Unlike routes, an invalid provider
+// is an error rather than skipped: a missing IdP would reject its tokens.
+func Parse(source string, content []byte) (*Registry, error) {
+	var providers []Provider
+	if err := configschema.Decode(content, &providers); err != nil {
+		return nil, fmt.Errorf("%s: %w", source, err)
+	}
+	r := &Registry{byIssuer: make(map[string]*Provider, len(providers))}
+	for i := range providers {
+		p := &providers[i]
+		switch {
+		case p.Issuer == "":
+			return nil, fmt.Errorf("%s[%d]: issuer is required", source, i)
+		case r.byIssuer[p.Issuer] != nil:
+			return nil, fmt.Errorf("%s[%d]: duplicate issuer %s", source, i, p.Issuer)
+		case p.TokenURL == "":
+			return nil, fmt.Errorf("%s[%d]: token_url is required", source, i)
+		case p.ClientSecretRef.File != "" && p.ClientSecretRef.Env != "":
+			return nil, fmt.Errorf("%s[%d]: client_secret_ref needs exactly one of file and env", source, i)
+		case p.ClientID == "" && !p.ClientSecretRef.IsZero():
+			return nil, fmt.Errorf("%s[%d]: client_secret_ref without client_id", source, i)
+		}
+		r.providers = append(r.providers, p)
+		r.byIssuer[p.Issuer] = p
+	}
+	return r, nil
+}
+
+// Providers returns the providers in file order.
+func (r *Registry) Providers() []*Provider {
+	if r == nil {
+		return nil
+	}
+	return r.providers
+}
+
+// Lookup returns the provider of issuer, or nil.
+func (r *Registry) Lookup(issuer string) *Provider {
+	if r == nil {
+		return nil
+	}
+	return r.byIssuer[issuer]
+}
+
+// ForToken returns the provider named by the iss claim of a JWT, or nil.
+// The token is not verified: the result only selects the keys and endpoint
+// to use, which then verify or reject the token.
+func (r *Registry) ForToken(token string) *Provider {
+	if r == nil || token == "" {
+		return nil
+	}
+	return r.Lookup(Issuer(token))
+}
+
+// Issuer returns the unverified iss claim of a JWT, or "" if it has none or
+// is not a JWT.
+func Issuer(token string) string {
+	t, err := jwt.ParseInsecure([]byte(token))
+	if err != nil {
+		return ""
+	}
+	return t.Issuer()
+}
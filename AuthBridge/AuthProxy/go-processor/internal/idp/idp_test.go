@@ -0,0 +1,99 @@
+package idp
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/lestrrat-go/jwx/v2/jwa"
+	"github.com/lestrrat-go/jwx/v2/jwt"
+)
+
+const providersYAML = `
+- issuer: https://keycloak.example.com/realms/agents
+  token_url: https://keycloak.example.com/realms/agents/protocol/openid-connect/token
+- issuer: https://login.partner.example
+  token_url: https://login.partner.example/oauth2/token
+  jwks_url: https://login.partner.example/oauth2/keys
+  client_id: agent
+  client_secret_ref:
+    env: PARTNER_CLIENT_SECRET
+`
+
+func signedToken(t *testing.T, issuer string) string {
+	t.Helper()
+	token, err := jwt.NewBuilder().Issuer(issuer).Subject("alice").Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	signed, err := jwt.Sign(token, jwt.WithKey(jwa.HS256, []byte("test-key")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(signed)
+}
+
+func TestParse(t *testing.T) {
+	r, err := Parse("idps.yaml", []byte(providersYAML))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := len(r.Providers()); n != 2 {
+		t.Fatalf("got %d providers, want 2", n)
+	}
+	p := r.Lookup("https://login.partner.example")
+	if p == nil || p.ClientID != "agent" || p.ClientSecretRef.Env != "PARTNER_CLIENT_SECRET" || p.JWKSURL != "https://login.partner.example/oauth2/keys" {
+		t.Errorf("partner provider = %+v", p)
+	}
+	if r.Lookup("https://unknown.example") != nil {
+		t.Error("Lookup of an unknown issuer returned a provider")
+	}
+}
+
+func TestParse_Invalid(t *testing.T) {
+	tests := []struct {
+		name, yaml, want string
+	}{
+		{"missing issuer", "- token_url: https://idp/token", "[0]: issuer is required"},
+		{"missing token_url", "- issuer: https://idp", "[0]: token_url is required"},
+		{"duplicate issuer", "- {issuer: https://idp, token_url: https://idp/token}\n- {issuer: https://idp, token_url: https://idp/token2}", "[1]: duplicate issuer"},
+		{"secret without client", "- {issuer: https://idp, token_url: https://idp/token, client_secret_ref: {env: S}}", "client_secret_ref without client_id"},
+		{"both secret sources", "- {issuer: https://idp, token_url: https://idp/token, client_id: a, client_secret_ref: {env: S, file: /s}}", "exactly one of file and env"},
+		{"unknown field", "- {issuer: https://idp, token_url: https://idp/token, audience: x}", "audience"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Parse("idps.yaml", []byte(tt.yaml))
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("got %v, want error containing %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestRegistry_ForToken(t *testing.T) {
+	r, err := Parse("idps.yaml", []byte(providersYAML))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p := r.ForToken(signedToken(t, "https://login.partner.example")); p == nil || p.Issuer != "https://login.partner.example" {
+		t.Errorf("ForToken(partner token) = %+v", p)
+	}
+	if p := r.ForToken(signedToken(t, "https://other.example")); p != nil {
+		t.Errorf("ForToken(foreign token) = %+v, want nil", p)
+	}
+	if p := r.ForToken("not-a-jwt"); p != nil {
+		t.Errorf("ForToken(opaque token) = %+v, want nil", p)
+	}
+	var none *Registry
+	if p := none.ForToken(signedToken(t, "https://login.partner.example")); p != nil {
+		t.Errorf("nil registry returned %+v", p)
+	}
+}
+
+func TestLoad_Missing(t *testing.T) {
+	r, err := Load(filepath.Join(t.TempDir(), "idps.yaml"))
+	if err != nil || r != nil {
+		t.Errorf("Load(missing) = %v, %v; want nil, nil", r, err)
+	}
+}
@@ -0,0 +1,110 @@
+// Package introspection reads RFC 7662 token introspection responses and maps
+// the claims they return to request headers, for routes whose callers hold
+// opaque tokens that cannot be validated locally.
+package introspection
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// DefaultHeaders is the claim-to-header mapping used when a route sets none.
+var DefaultHeaders = map[string]string{
+	"sub":   "x-sub",
+	"scope": "x-scopes",
+}
+
+// Result is an introspection response.
+type Result struct {
+	// Active is false for expired, revoked or unknown tokens; no other claims
+	// are returned for them.
+	Active bool
+	// Claims holds every member of the response, including active.
+	Claims map[string]any
+}
+
+// Parse decodes an introspection response body. Numbers are kept as
+// json.Number so exp and iat keep their exact value in headers.
+func Parse(body []byte) (*Result, error) {
+	dec := json.NewDecoder(bytes.NewReader(body))
+	dec.UseNumber()
+	var claims map[string]any
+	if err := dec.Decode(&claims); err != nil {
+		return nil, fmt.Errorf("parse introspection response: %w", err)
+	}
+	active, ok := claims["active"].(bool)
+	if !ok {
+		return nil, fmt.Errorf("introspection response has no boolean active member")
+	}
+	return &Result{Active: active, Claims: claims}, nil
+}
+
+// Header is a request header set from a claim.
+type Header struct {
+	Name  string
+	Value string
+}
+
+// Headers maps claims to headers, sorted by name. Headers whose claim is
+// missing, or whose value cannot be sent in a header, are returned in remove
+// so a caller cannot supply them itself.
+//
+// Strings are sent as they are, arrays (e.g. aud) space-separated like scope,
+// and objects as JSON.
+func Headers(claims map[string]any, mapping map[string]string) (set []Header, remove []string) {
+	for claim, header := range mapping {
+		value, ok := stringify(claims[claim])
+		if !ok {
+			remove = append(remove, header)
+			continue
+		}
+		set = append(set, Header{Name: header, Value: value})
+	}
+	sort.Slice(set, func(i, j int) bool { return set[i].Name < set[j].Name })
+	sort.Strings(remove)
+	return set, remove
+}
+
+func stringify(value any) (string, bool) {
+	var s string
+	switch v := value.(type) {
+	case nil:
+		return "", false
+	case string:
+		s = v
+	case json.Number:
+		s = v.String()
+	case bool:
+		s = fmt.Sprint(v)
+	case []any:
+		parts := make([]string, 0, len(v))
+		for _, item := range v {
+			part, ok := stringify(item)
+			if !ok {
+				return "", false
+			}
+			parts = append(parts, part)
+		}
+		s = strings.Join(parts, " ")
+	default:
+		data, err := json.Marshal(v)
+		if err != nil {
+			return "", false
+		}
+		s = string(data)
+	}
+	// A header value cannot span lines
+	if strings.ContainsAny(s, "\r\n\x00") {
+		return "", false
+	}
+	return s, true
+}
+
+// Endpoint derives the introspection endpoint from a Keycloak token endpoint.
+// e.g. ".../protocol/openid-connect/token" -> ".../protocol/openid-connect/token/introspect"
+func Endpoint(tokenURL string) string {
+	return strings.TrimSuffix(tokenURL, "/") + "/introspect"
+}
@@ -0,0 +1,58 @@
+package introspection
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	r, err := Parse([]byte(`{"active": true, "sub": "alice", "scope": "openid tools", "exp": 1700000000, "aud": ["a", "b"]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !r.Active {
+		t.Error("active = false")
+	}
+
+	set, remove := Headers(r.Claims, map[string]string{
+		"sub": "x-sub", "scope": "x-scopes", "exp": "x-exp", "aud": "x-aud", "username": "x-user",
+	})
+	want := []Header{
+		{Name: "x-aud", Value: "a b"},
+		{Name: "x-exp", Value: "1700000000"},
+		{Name: "x-scopes", Value: "openid tools"},
+		{Name: "x-sub", Value: "alice"},
+	}
+	if !reflect.DeepEqual(set, want) {
+		t.Errorf("set = %v, want %v", set, want)
+	}
+	if !reflect.DeepEqual(remove, []string{"x-user"}) {
+		t.Errorf("remove = %v, want [x-user]", remove)
+	}
+}
+
+func TestParse_Inactive(t *testing.T) {
+	r, err := Parse([]byte(`{"active": false}`))
+	if err != nil || r.Active {
+		t.Errorf("Parse() = %+v, %v", r, err)
+	}
+	for _, body := range []string{`{}`, `{"active": "true"}`, `not json`} {
+		if _, err := Parse([]byte(body)); err == nil {
+			t.Errorf("Parse(%s): expected an error", body)
+		}
+	}
+}
+
+func TestHeaders_Unsafe(t *testing.T) {
+	_, remove := Headers(map[string]any{"sub": "alice\r\nx-admin: true"}, DefaultHeaders)
+	if !reflect.DeepEqual(remove, []string{"x-scopes", "x-sub"}) {
+		t.Errorf("remove = %v", remove)
+	}
+}
+
+func TestEndpoint(t *testing.T) {
+	got := Endpoint("http://keycloak:8080/realms/demo/protocol/openid-connect/token")
+	if got != "http://keycloak:8080/realms/demo/protocol/openid-connect/token/introspect" {
+		t.Errorf("Endpoint() = %q", got)
+	}
+}
@@ -0,0 +1,119 @@
+// Package listener opens the ext proc's gRPC listeners from a
+// comma-separated address list, e.g. "0.0.0.0:9090,[::]:9090" or
+// "unix:///run/authbridge/ext-proc.sock".
+//
+// The network follows the host: an IPv4 literal listens on tcp4 and an IPv6
+// literal on tcp6 (IPv6 only), so explicit IPv4 and IPv6 listeners on the same
+// port don't collide. A hostname or empty host (":9090") uses tcp, which is
+// dual-stack where the kernel allows it.
+package listener
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+)
+
+// Address is one parsed listen address.
+type Address struct {
+	// Network is "tcp", "tcp4", "tcp6" or "unix".
+	Network string
+	// Address is host:port, or the socket path for unix.
+	Address string
+}
+
+func (a Address) String() string {
+	if a.Network == "unix" {
+		return "unix://" + a.Address
+	}
+	return a.Address
+}
+
+// Parse splits and validates a comma-separated address list.
+func Parse(spec string) ([]Address, error) {
+	var addrs []Address
+	seen := make(map[Address]bool)
+	for _, raw := range strings.Split(spec, ",") {
+		raw = strings.TrimSpace(raw)
+		if raw == "" {
+			continue
+		}
+		addr, err := parseOne(raw)
+		if err != nil {
+			return nil, err
+		}
+		if seen[addr] {
+			return nil, fmt.Errorf("duplicate listen address %q", raw)
+		}
+		seen[addr] = true
+		addrs = append(addrs, addr)
+	}
+	if len(addrs) == 0 {
+		return nil, errors.New("no listen address")
+	}
+	return addrs, nil
+}
+
+func parseOne(raw string) (Address, error) {
+	path, isUnix := strings.CutPrefix(raw, "unix://")
+	if !isUnix {
+		path, isUnix = strings.CutPrefix(raw, "unix:")
+	}
+	if isUnix {
+		if path == "" {
+			return Address{}, fmt.Errorf("empty unix socket path in %q", raw)
+		}
+		return Address{Network: "unix", Address: path}, nil
+	}
+
+	host, port, err := net.SplitHostPort(raw)
+	if err != nil {
+		return Address{}, fmt.Errorf("invalid listen address %q (IPv6 hosts need brackets, e.g. [::1]:9090): %w", raw, err)
+	}
+	if port == "" {
+		return Address{}, fmt.Errorf("missing port in listen address %q", raw)
+	}
+	network := "tcp"
+	ipHost, _, _ := strings.Cut(host, "%") // link-local zone, e.g. fe80::1%eth0
+	if ip := net.ParseIP(ipHost); ip != nil {
+		if ip.To4() != nil {
+			network = "tcp4"
+		} else {
+			network = "tcp6"
+		}
+	}
+	return Address{Network: network, Address: raw}, nil
+}
+
+// Listen opens a listener for every address in spec. A stale unix socket
+// file left by a previous run is removed first. If any listener fails, the
+// ones already opened are closed.
+func Listen(spec string) ([]net.Listener, error) {
+	addrs, err := Parse(spec)
+	if err != nil {
+		return nil, err
+	}
+	listeners := make([]net.Listener, 0, len(addrs))
+	for _, addr := range addrs {
+		lis, err := listenOne(addr)
+		if err != nil {
+			for _, l := range listeners {
+				l.Close()
+			}
+			return nil, fmt.Errorf("listen on %s: %w", addr, err)
+		}
+		listeners = append(listeners, lis)
+	}
+	return listeners, nil
+}
+
+func listenOne(addr Address) (net.Listener, error) {
+	if addr.Network == "unix" {
+		if err := os.Remove(addr.Address); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return nil, fmt.Errorf("remove stale socket: %w", err)
+		}
+	}
+	return net.Listen(addr.Network, addr.Address)
+}
@@ -0,0 +1,137 @@
+package listener
+
+import (
+	"net"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		spec string
+		want []Address
+	}{
+		{":9090", []Address{{"tcp", ":9090"}}},
+		{"0.0.0.0:9090", []Address{{"tcp4", "0.0.0.0:9090"}}},
+		{"[::]:9090", []Address{{"tcp6", "[::]:9090"}}},
+		{"[fe80::1%eth0]:9090", []Address{{"tcp6", "[fe80::1%eth0]:9090"}}},
+		{"localhost:9090", []Address{{"tcp", "localhost:9090"}}},
+		{"0.0.0.0:9090, [::]:9090", []Address{{"tcp4", "0.0.0.0:9090"}, {"tcp6", "[::]:9090"}}},
+		{"unix:///run/ext-proc.sock,127.0.0.1:9090", []Address{{"unix", "/run/ext-proc.sock"}, {"tcp4", "127.0.0.1:9090"}}},
+		{"unix:ext-proc.sock", []Address{{"unix", "ext-proc.sock"}}},
+	}
+	for _, tt := range tests {
+		got, err := Parse(tt.spec)
+		if err != nil {
+			t.Errorf("Parse(%q): %v", tt.spec, err)
+			continue
+		}
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("Parse(%q) = %v, want %v", tt.spec, got, tt.want)
+		}
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	for _, spec := range []string{
+		"",
+		" , ",
+		"::1:9090",
+		"127.0.0.1",
+		"127.0.0.1:",
+		"unix://",
+		":9090,:9090",
+	} {
+		if _, err := Parse(spec); err == nil {
+			t.Errorf("Parse(%q): expected error", spec)
+		}
+	}
+}
+
+func ipv6Available(t *testing.T) {
+	t.Helper()
+	l, err := net.Listen("tcp6", "[::1]:0")
+	if err != nil {
+		t.Skipf("IPv6 loopback not available: %v", err)
+	}
+	l.Close()
+}
+
+// Explicit IPv4 and IPv6 listeners share a port without colliding, as in a
+// dual-stack pod listening on both families.
+func TestListenDualStackSamePort(t *testing.T) {
+	ipv6Available(t)
+
+	v4, err := net.Listen("tcp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	port := strconv.Itoa(v4.Addr().(*net.TCPAddr).Port)
+	v4.Close()
+
+	listeners, err := Listen("127.0.0.1:" + port + ",[::1]:" + port)
+	if err != nil {
+		t.Fatalf("Listen: %v", err)
+	}
+	defer func() {
+		for _, l := range listeners {
+			l.Close()
+		}
+	}()
+	if len(listeners) != 2 {
+		t.Fatalf("got %d listeners, want 2", len(listeners))
+	}
+
+	for _, addr := range []string{"127.0.0.1:" + port, "[::1]:" + port} {
+		conn, err := net.Dial("tcp", addr)
+		if err != nil {
+			t.Errorf("dial %s: %v", addr, err)
+			continue
+		}
+		conn.Close()
+	}
+}
+
+func TestListenUnixReplacesStaleSocket(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "ext-proc.sock")
+	first, err := Listen("unix://" + path)
+	if err != nil {
+		t.Fatalf("Listen: %v", err)
+	}
+	// Simulate a crash: the socket file stays behind
+	first[0].(*net.UnixListener).SetUnlinkOnClose(false)
+	first[0].Close()
+
+	second, err := Listen("unix://" + path)
+	if err != nil {
+		t.Fatalf("Listen over stale socket: %v", err)
+	}
+	second[0].Close()
+}
+
+func TestListenClosesOnFailure(t *testing.T) {
+	busy, err := net.Listen("tcp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	defer busy.Close()
+
+	free, err := net.Listen("tcp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	freeAddr := free.Addr().String()
+	free.Close()
+
+	if _, err := Listen(freeAddr + "," + busy.Addr().String()); err == nil {
+		t.Fatal("expected an error for a port in use")
+	}
+	// The first listener must have been closed again
+	l, err := net.Listen("tcp4", freeAddr)
+	if err != nil {
+		t.Fatalf("%s still in use after failed Listen: %v", freeAddr, err)
+	}
+	l.Close()
+}
@@ -0,0 +1,101 @@
+// Package mcpcall reads the tool an MCP request calls from its JSON-RPC body,
+// so tokens can be exchanged for that tool rather than for the server as a
+// whole, and inbound calls authorized per tool or resource:
+//
+//	{"jsonrpc": "2.0", "id": 1, "method": "tools/call", "params": {"name": "search", "arguments": {...}}}
+//	{"jsonrpc": "2.0", "id": 2, "method": "resources/read", "params": {"uri": "file:///notes.txt"}}
+package mcpcall
+
+import (
+	"bytes"
+	"encoding/json"
+)
+
+// JSON-RPC methods of MCP calls that name what they act on.
+const (
+	MethodToolsCall          = "tools/call"
+	MethodResourcesRead      = "resources/read"
+	MethodResourcesSubscribe = "resources/subscribe"
+)
+
+type message struct {
+	Method string `json:"method"`
+	Params struct {
+		Name string `json:"name"`
+		URI  string `json:"uri"`
+	} `json:"params"`
+}
+
+// Call is a tool call or resource access in a request body.
+type Call struct {
+	Method string
+	// Target is the tool name or the resource URI
+	Target string
+}
+
+// IsTool reports whether c calls a tool rather than accessing a resource.
+func (c Call) IsTool() bool {
+	return c.Method == MethodToolsCall
+}
+
+// Calls returns every tool call and resource access in body, a single
+// JSON-RPC message or a batch. Other methods are not returned; a body that
+// is not JSON returns none.
+func Calls(body []byte) []Call {
+	body = bytes.TrimSpace(body)
+	if len(body) == 0 {
+		return nil
+	}
+	var batch []message
+	if body[0] == '[' {
+		if json.Unmarshal(body, &batch) != nil {
+			return nil
+		}
+	} else {
+		var m message
+		if json.Unmarshal(body, &m) != nil {
+			return nil
+		}
+		batch = []message{m}
+	}
+	var calls []Call
+	for _, m := range batch {
+		switch m.Method {
+		case MethodToolsCall:
+			calls = append(calls, Call{Method: m.Method, Target: m.Params.Name})
+		case MethodResourcesRead, MethodResourcesSubscribe:
+			calls = append(calls, Call{Method: m.Method, Target: m.Params.URI})
+		}
+	}
+	return calls
+}
+
+// ToolName returns the name of the tool body calls, or "" if body is not a
+// tools/call request. A batch names a tool only if every message in it is a
+// call of the same tool; mixed batches return "", so no single tool's
+// audience or scopes cover calls of another.
+func ToolName(body []byte) string {
+	body = bytes.TrimSpace(body)
+	if len(body) == 0 {
+		return ""
+	}
+	if body[0] != '[' {
+		var m message
+		if json.Unmarshal(body, &m) != nil || m.Method != MethodToolsCall {
+			return ""
+		}
+		return m.Params.Name
+	}
+
+	var batch []message
+	if json.Unmarshal(body, &batch) != nil || len(batch) == 0 {
+		return ""
+	}
+	name := batch[0].Params.Name
+	for _, m := range batch {
+		if m.Method != MethodToolsCall || m.Params.Name != name {
+			return ""
+		}
+	}
+	return name
+}
@@ -0,0 +1,58 @@
+package mcpcall
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestToolName(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		want string
+	}{
+		{"tool call", `{"jsonrpc":"2.0","id":1,"method":"tools/call","params":{"name":"search","arguments":{"q":"x"}}}`, "search"},
+		{"surrounding whitespace", "\n  {\"method\":\"tools/call\",\"params\":{\"name\":\"search\"}}\n", "search"},
+		{"other method", `{"jsonrpc":"2.0","id":1,"method":"tools/list"}`, ""},
+		{"notification", `{"jsonrpc":"2.0","method":"notifications/initialized"}`, ""},
+		{"not json", `name=search`, ""},
+		{"empty", ``, ""},
+		{"batch of one tool", `[{"method":"tools/call","params":{"name":"search"}},{"method":"tools/call","params":{"name":"search"}}]`, "search"},
+		{"batch of two tools", `[{"method":"tools/call","params":{"name":"search"}},{"method":"tools/call","params":{"name":"delete"}}]`, ""},
+		{"batch with other method", `[{"method":"tools/call","params":{"name":"search"}},{"method":"tools/list"}]`, ""},
+		{"empty batch", `[]`, ""},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := ToolName([]byte(tc.body)); got != tc.want {
+				t.Errorf("ToolName() = %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestCalls(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		want []Call
+	}{
+		{"tool call", `{"jsonrpc":"2.0","id":1,"method":"tools/call","params":{"name":"search"}}`,
+			[]Call{{MethodToolsCall, "search"}}},
+		{"resource read", `{"jsonrpc":"2.0","id":1,"method":"resources/read","params":{"uri":"file:///a.txt"}}`,
+			[]Call{{MethodResourcesRead, "file:///a.txt"}}},
+		{"batch", `[{"method":"tools/call","params":{"name":"search"}},{"method":"tools/list"},{"method":"resources/subscribe","params":{"uri":"db://t"}}]`,
+			[]Call{{MethodToolsCall, "search"}, {MethodResourcesSubscribe, "db://t"}}},
+		{"tool call without name", `{"method":"tools/call","params":{}}`, []Call{{MethodToolsCall, ""}}},
+		{"other method", `{"method":"initialize"}`, nil},
+		{"not json", `name=search`, nil},
+		{"empty", ``, nil},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := Calls([]byte(tc.body)); !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("Calls() = %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,235 @@
+// Package mcppolicy authorizes the MCP calls of inbound requests per tool
+// and resource. After the caller's token is validated, each tools/call and
+// resources/read or resources/subscribe in the JSON-RPC body is matched
+// against the policy's rules; the first matching rule states the scopes,
+// roles and claim assertions the token needs for it:
+//
+//	default: deny
+//	roles_claim: realm_access.roles
+//	tools:
+//	  - name: "delete_*"
+//	    scopes: mcp:admin
+//	    roles: [admin]
+//	  - name: "*"
+//	    scopes: mcp:tools
+//	resources:
+//	  - uri: "file:///public/**"
+package mcppolicy
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+
+	"github.com/gobwas/glob"
+
+	"github.com/kagenti/kagenti-extensions/AuthBridge/AuthProxy/go-processor/internal/claims"
+	"github.com/kagenti/kagenti-extensions/AuthBridge/AuthProxy/go-processor/internal/mcpcall"
+	"github.com/kagenti/kagenti-extensions/configschema"
+)
+
+type yamlPolicy struct {
+	Default    string     `yaml:"default,omitempty" default:"allow" doc:"allow or deny calls no rule matches"`
+	RolesClaim string     `yaml:"roles_claim,omitempty" default:"realm_access.roles" doc:"Dotted path of the claim listing the caller's roles (default: Keycloak realm roles)"`
+	Tools      []yamlRule `yaml:"tools,omitempty" doc:"Rules over tool names, first match wins"`
+	Resources  []yamlRule `yaml:"resources,omitempty" doc:"Rules over resource URIs, first match wins"`
+}
+
+type yamlRule struct {
+	Name string `yaml:"name,omitempty" doc:"Glob over tool names, e.g. delete_* (tools only)"`
+	URI  string `yaml:"uri,omitempty" doc:"Glob over resource URIs; * stays within a path segment, ** does not (resources only)"`
+	// Scopes are all required; Roles need any one
+	Scopes  string   `yaml:"scopes,omitempty" doc:"Space-separated scopes the token must all have"`
+	Roles   []string `yaml:"roles,omitempty" doc:"Roles of which the token must have at least one"`
+	Require []string `yaml:"require,omitempty" doc:"Claim assertions the token must meet, as in the claim assertions file"`
+}
+
+// Policy is a compiled policy.
+type Policy struct {
+	deny      bool
+	tools     []rule
+	resources []rule
+}
+
+type rule struct {
+	pattern string
+	glob    glob.Glob
+	scopes  []string
+	// roles are "<roles_claim> contains <role>" assertions, any of which
+	// grants the call
+	roles   []claims.Rule
+	require []claims.Rule
+}
+
+// containsRule asserts that the claim at the dotted path contains value.
+func containsRule(path, value string) claims.Rule {
+	return claims.Rule{Expr: path + " contains " + value, Path: strings.Split(path, "."), Op: claims.OpContains, Value: value}
+}
+
+// Denied is returned for a call the token is not authorized for.
+type Denied struct {
+	Call   mcpcall.Call
+	Reason string
+	// Scopes are the scopes the matching rule requires, for the challenge
+	Scopes []string
+}
+
+func (e *Denied) Error() string {
+	return fmt.Sprintf("%s %q not allowed: %s", e.Call.Method, e.Call.Target, e.Reason)
+}
+
+// Schema returns the JSON Schema of the policy file.
+func Schema() ([]byte, error) {
+	return configschema.Schema(yamlPolicy{}, "AuthBridge MCP call policy")
+}
+
+// Load reads the policy file at path. A missing file is not an error and
+// returns a nil policy.
+func Load(path string) (*Policy, error) {
+	content, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		slog.Info("No MCP call policy, not inspecting inbound bodies", "component", "mcppolicy", "path", path)
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	p, err := Parse(content)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return p, nil
+}
+
+// Parse compiles a policy document.
+func Parse(content []byte) (*Policy, error) {
+	var y yamlPolicy
+	if err := configschema.Decode(content, &y); err != nil {
+		return nil, err
+	}
+	p := &Policy{}
+	switch y.Default {
+	case "allow":
+	case "deny":
+		p.deny = true
+	default:
+		return nil, fmt.Errorf("default must be allow or deny, got %q", y.Default)
+	}
+	for i, yr := range y.Tools {
+		if yr.Name == "" || yr.URI != "" {
+			return nil, fmt.Errorf("tools[%d]: needs name and no uri", i)
+		}
+		r, err := compileRule(yr, yr.Name, y.RolesClaim, glob.Compile)
+		if err != nil {
+			return nil, fmt.Errorf("tools[%d]: %w", i, err)
+		}
+		p.tools = append(p.tools, r)
+	}
+	for i, yr := range y.Resources {
+		if yr.URI == "" || yr.Name != "" {
+			return nil, fmt.Errorf("resources[%d]: needs uri and no name", i)
+		}
+		r, err := compileRule(yr, yr.URI, y.RolesClaim, func(pattern string, _ ...rune) (glob.Glob, error) {
+			return glob.Compile(pattern, '/')
+		})
+		if err != nil {
+			return nil, fmt.Errorf("resources[%d]: %w", i, err)
+		}
+		p.resources = append(p.resources, r)
+	}
+	return p, nil
+}
+
+func compileRule(yr yamlRule, pattern, rolesClaim string, compile func(string, ...rune) (glob.Glob, error)) (rule, error) {
+	g, err := compile(pattern)
+	if err != nil {
+		return rule{}, fmt.Errorf("%q: %w", pattern, err)
+	}
+	r := rule{pattern: pattern, glob: g, scopes: strings.Fields(yr.Scopes)}
+	for _, role := range yr.Roles {
+		if role == "" {
+			return rule{}, errors.New("empty role")
+		}
+		r.roles = append(r.roles, containsRule(rolesClaim, role))
+	}
+	for _, expr := range yr.Require {
+		assertion, err := claims.Parse(expr)
+		if err != nil {
+			return rule{}, err
+		}
+		r.require = append(r.require, assertion)
+	}
+	return r, nil
+}
+
+// DefaultDeny reports whether calls no rule matches are denied.
+func (p *Policy) DefaultDeny() bool {
+	return p.deny
+}
+
+// Authorize checks every call against the claims of the caller's verified
+// token and returns a *Denied error for the first one not allowed.
+func (p *Policy) Authorize(calls []mcpcall.Call, tokenClaims map[string]interface{}) error {
+	for _, call := range calls {
+		rules := p.resources
+		if call.IsTool() {
+			rules = p.tools
+		}
+		r := match(rules, call.Target)
+		if r == nil {
+			if p.deny {
+				return &Denied{Call: call, Reason: "no rule matches"}
+			}
+			continue
+		}
+		if err := r.authorize(call, tokenClaims); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func match(rules []rule, target string) *rule {
+	for i := range rules {
+		if rules[i].glob.Match(target) {
+			return &rules[i]
+		}
+	}
+	return nil
+}
+
+func (r *rule) authorize(call mcpcall.Call, tokenClaims map[string]interface{}) error {
+	deny := func(reason string) error {
+		return &Denied{Call: call, Reason: fmt.Sprintf("%s (rule %q)", reason, r.pattern), Scopes: r.scopes}
+	}
+	for _, scope := range r.scopes {
+		if !hasScope(tokenClaims, scope) {
+			return deny("missing scope " + scope)
+		}
+	}
+	if len(r.roles) > 0 {
+		granted := false
+		for _, role := range r.roles {
+			if claims.Evaluate([]claims.Rule{role}, tokenClaims) == nil {
+				granted = true
+				break
+			}
+		}
+		if !granted {
+			return deny("missing role")
+		}
+	}
+	if err := claims.Evaluate(r.require, tokenClaims); err != nil {
+		return deny(err.Error())
+	}
+	return nil
+}
+
+// hasScope checks the space-separated scope claim, or the scp array some
+// IdPs issue instead.
+func hasScope(tokenClaims map[string]interface{}, scope string) bool {
+	return claims.Evaluate([]claims.Rule{containsRule("scope", scope)}, tokenClaims) == nil ||
+		claims.Evaluate([]claims.Rule{containsRule("scp", scope)}, tokenClaims) == nil
+}
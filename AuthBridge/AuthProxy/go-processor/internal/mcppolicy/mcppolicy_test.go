@@ -0,0 +1,119 @@
+package mcppolicy
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/kagenti/kagenti-extensions/AuthBridge/AuthProxy/go-processor/internal/mcpcall"
+)
+
+const policyYAML = `
+default: deny
+tools:
+  - name: "delete_*"
+    scopes: mcp:tools mcp:admin
+    roles: [admin, ops]
+  - name: "report"
+    require: ["email matches .*@example\\.com"]
+  - name: "*"
+    scopes: mcp:tools
+resources:
+  - uri: "file:///public/**"
+  - uri: "file:///team/*"
+    roles: [team]
+`
+
+func tool(name string) mcpcall.Call {
+	return mcpcall.Call{Method: mcpcall.MethodToolsCall, Target: name}
+}
+
+func resource(uri string) mcpcall.Call {
+	return mcpcall.Call{Method: mcpcall.MethodResourcesRead, Target: uri}
+}
+
+func TestPolicy_Authorize(t *testing.T) {
+	p, err := Parse([]byte(policyYAML))
+	if err != nil {
+		t.Fatal(err)
+	}
+	user := map[string]interface{}{
+		"scope":        "openid mcp:tools",
+		"email":        "alice@example.com",
+		"realm_access": map[string]interface{}{"roles": []interface{}{"team"}},
+	}
+	admin := map[string]interface{}{
+		"scp":          []interface{}{"mcp:tools", "mcp:admin"},
+		"realm_access": map[string]interface{}{"roles": []interface{}{"ops"}},
+	}
+
+	tests := []struct {
+		name   string
+		calls  []mcpcall.Call
+		claims map[string]interface{}
+		denied string
+	}{
+		{"tool with scope", []mcpcall.Call{tool("search")}, user, ""},
+		{"tool without scope", []mcpcall.Call{tool("search")}, map[string]interface{}{"scope": "openid"}, "missing scope mcp:tools"},
+		{"admin tool without admin scope", []mcpcall.Call{tool("delete_repo")}, user, "missing scope mcp:admin"},
+		{"admin tool with scp and role", []mcpcall.Call{tool("delete_repo")}, admin, ""},
+		{"admin tool without role", []mcpcall.Call{tool("delete_repo")}, map[string]interface{}{"scope": "mcp:tools mcp:admin"}, "missing role"},
+		{"claim assertion", []mcpcall.Call{tool("report")}, user, ""},
+		{"failed claim assertion", []mcpcall.Call{tool("report")}, admin, "claim assertion"},
+		{"public resource", []mcpcall.Call{resource("file:///public/docs/a.md")}, admin, ""},
+		{"team resource with role", []mcpcall.Call{resource("file:///team/plan.md")}, user, ""},
+		{"team resource without role", []mcpcall.Call{resource("file:///team/plan.md")}, admin, "missing role"},
+		{"single star stays in segment", []mcpcall.Call{resource("file:///team/x/plan.md")}, user, "no rule matches"},
+		{"unmatched resource denied by default", []mcpcall.Call{resource("db://orders")}, admin, "no rule matches"},
+		{"batch denied by one call", []mcpcall.Call{tool("search"), tool("delete_repo")}, user, "delete_repo"},
+		{"no calls", nil, nil, ""},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			err := p.Authorize(tc.calls, tc.claims)
+			if tc.denied == "" {
+				if err != nil {
+					t.Errorf("denied: %v", err)
+				}
+				return
+			}
+			var denied *Denied
+			if !errors.As(err, &denied) || !strings.Contains(err.Error(), tc.denied) {
+				t.Errorf("got %v, want denial containing %q", err, tc.denied)
+			}
+		})
+	}
+}
+
+func TestPolicy_DefaultAllow(t *testing.T) {
+	p, err := Parse([]byte(`tools: [{name: "delete_*", roles: [admin]}]`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Authorize([]mcpcall.Call{tool("search"), resource("file:///a")}, nil); err != nil {
+		t.Errorf("unmatched calls denied: %v", err)
+	}
+	// roles_claim defaults to Keycloak realm roles
+	keycloakAdmin := map[string]interface{}{"realm_access": map[string]interface{}{"roles": []interface{}{"admin"}}}
+	if err := p.Authorize([]mcpcall.Call{tool("delete_x")}, keycloakAdmin); err != nil {
+		t.Errorf("admin denied: %v", err)
+	}
+}
+
+func TestParse_Invalid(t *testing.T) {
+	tests := []struct{ name, yaml, want string }{
+		{"bad default", `default: maybe`, "default must be allow or deny"},
+		{"tool without name", `tools: [{scopes: a}]`, "tools[0]"},
+		{"tool with uri", `tools: [{name: a, uri: b}]`, "tools[0]"},
+		{"resource without uri", `resources: [{name: a}]`, "resources[0]"},
+		{"bad assertion", `tools: [{name: a, require: ["email ~ x"]}]`, "unknown operator"},
+		{"unknown field", `tools: [{name: a, role: x}]`, "role"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if _, err := Parse([]byte(tc.yaml)); err == nil || !strings.Contains(err.Error(), tc.want) {
+				t.Errorf("got %v, want error containing %q", err, tc.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,125 @@
+// Package oidc discovers identity provider endpoints from an issuer URL and
+// keeps them fresh, so the processor only needs to be configured with ISSUER.
+package oidc
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Metadata is the subset of the OpenID provider metadata the processor uses.
+type Metadata struct {
+	Issuer                string `json:"issuer"`
+	JWKSURI               string `json:"jwks_uri"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	IntrospectionEndpoint string `json:"introspection_endpoint"`
+}
+
+// DiscoveryURL returns the well-known configuration URL for issuer.
+func DiscoveryURL(issuer string) string {
+	return strings.TrimSuffix(issuer, "/") + "/.well-known/openid-configuration"
+}
+
+// Discover fetches and validates the provider metadata for issuer.
+func Discover(ctx context.Context, client *http.Client, issuer string) (*Metadata, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, DiscoveryURL(issuer), nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("fetching discovery document: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return nil, fmt.Errorf("discovery document returned status %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+
+	var md Metadata
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&md); err != nil {
+		return nil, fmt.Errorf("decoding discovery document: %w", err)
+	}
+	// OpenID Connect Discovery 1.0 section 4.3: the issuer must match exactly.
+	if md.Issuer != issuer {
+		return nil, fmt.Errorf("discovery document issuer %q does not match %q", md.Issuer, issuer)
+	}
+	if md.JWKSURI == "" {
+		return nil, fmt.Errorf("discovery document for %q has no jwks_uri", issuer)
+	}
+	return &md, nil
+}
+
+// Cache holds the latest metadata for one issuer. A failed refresh keeps the
+// last good metadata.
+type Cache struct {
+	Issuer string
+	Client *http.Client
+	// OnChange is called after a refresh that changed the metadata, including
+	// the first successful one (old is nil then).
+	OnChange func(old, current *Metadata)
+
+	mu      sync.RWMutex
+	current *Metadata
+}
+
+// Current returns the latest metadata, or nil before the first successful
+// refresh.
+func (c *Cache) Current() *Metadata {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.current
+}
+
+// Refresh fetches the metadata once.
+func (c *Cache) Refresh(ctx context.Context) error {
+	client := c.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	md, err := Discover(ctx, client, c.Issuer)
+	if err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	old := c.current
+	c.current = md
+	c.mu.Unlock()
+
+	if c.OnChange != nil && (old == nil || *old != *md) {
+		c.OnChange(old, md)
+	}
+	return nil
+}
+
+// Run refreshes every interval until ctx is done, starting after the first
+// wait. Failures are passed to onError and retried after retry, which should
+// be shorter than interval; so is the first refresh if none succeeded yet.
+func (c *Cache) Run(ctx context.Context, interval, retry time.Duration, onError func(error)) {
+	wait := interval
+	if c.Current() == nil {
+		wait = retry
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(wait):
+		}
+		wait = interval
+		if err := c.Refresh(ctx); err != nil {
+			if onError != nil {
+				onError(err)
+			}
+			wait = retry
+		}
+	}
+}
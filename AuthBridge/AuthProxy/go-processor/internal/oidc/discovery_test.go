@@ -0,0 +1,104 @@
+package oidc
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+func discoveryServer(t *testing.T, jwksPath *atomic.Value, issuerOverride string) *httptest.Server {
+	t.Helper()
+	var srv *httptest.Server
+	srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/realms/demo/.well-known/openid-configuration" {
+			http.NotFound(w, r)
+			return
+		}
+		issuer := srv.URL + "/realms/demo"
+		if issuerOverride != "" {
+			issuer = issuerOverride
+		}
+		_ = json.NewEncoder(w).Encode(map[string]string{
+			"issuer":                 issuer,
+			"jwks_uri":               srv.URL + jwksPath.Load().(string),
+			"token_endpoint":         srv.URL + "/realms/demo/token",
+			"introspection_endpoint": srv.URL + "/realms/demo/token/introspect",
+		})
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestDiscover(t *testing.T) {
+	var jwks atomic.Value
+	jwks.Store("/realms/demo/certs")
+	srv := discoveryServer(t, &jwks, "")
+
+	md, err := Discover(context.Background(), srv.Client(), srv.URL+"/realms/demo")
+	if err != nil {
+		t.Fatalf("Discover: %v", err)
+	}
+	if md.JWKSURI != srv.URL+"/realms/demo/certs" || md.TokenEndpoint != srv.URL+"/realms/demo/token" {
+		t.Errorf("unexpected metadata %+v", md)
+	}
+
+	if _, err := Discover(context.Background(), srv.Client(), srv.URL+"/realms/other"); err == nil {
+		t.Error("expected error for unknown issuer")
+	}
+}
+
+func TestDiscoverIssuerMismatch(t *testing.T) {
+	var jwks atomic.Value
+	jwks.Store("/realms/demo/certs")
+	srv := discoveryServer(t, &jwks, "https://evil.example.com/realms/demo")
+
+	_, err := Discover(context.Background(), srv.Client(), srv.URL+"/realms/demo")
+	if err == nil || !strings.Contains(err.Error(), "does not match") {
+		t.Fatalf("expected issuer mismatch error, got %v", err)
+	}
+}
+
+func TestCacheRefresh(t *testing.T) {
+	var jwks atomic.Value
+	jwks.Store("/realms/demo/certs")
+	srv := discoveryServer(t, &jwks, "")
+
+	changes := 0
+	c := &Cache{
+		Issuer:   srv.URL + "/realms/demo",
+		Client:   srv.Client(),
+		OnChange: func(old, current *Metadata) { changes++ },
+	}
+	if c.Current() != nil {
+		t.Fatal("Current should be nil before the first refresh")
+	}
+
+	for i := 0; i < 2; i++ {
+		if err := c.Refresh(context.Background()); err != nil {
+			t.Fatalf("Refresh: %v", err)
+		}
+	}
+	if changes != 1 {
+		t.Errorf("OnChange called %d times for unchanged metadata, want 1", changes)
+	}
+
+	jwks.Store("/realms/demo/certs-v2")
+	if err := c.Refresh(context.Background()); err != nil {
+		t.Fatalf("Refresh: %v", err)
+	}
+	if changes != 2 || !strings.HasSuffix(c.Current().JWKSURI, "/certs-v2") {
+		t.Errorf("moved jwks_uri not picked up: changes=%d current=%+v", changes, c.Current())
+	}
+
+	srv.Close()
+	if err := c.Refresh(context.Background()); err == nil {
+		t.Fatal("expected refresh error once the provider is down")
+	}
+	if !strings.HasSuffix(c.Current().JWKSURI, "/certs-v2") {
+		t.Error("failed refresh should keep the last good metadata")
+	}
+}
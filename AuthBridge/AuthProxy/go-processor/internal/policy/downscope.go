@@ -0,0 +1,70 @@
+package policy
+
+import (
+	"context"
+	"os"
+	"strings"
+)
+
+func init() {
+	Register("downscope", func() (Hook, error) {
+		return NewDownscopeHook(os.Getenv("DOWNSCOPE_MAX_SCOPES")), nil
+	})
+}
+
+// DownscopeHook never requests broader scopes than the caller consented to.
+// The requested scopes are narrowed to those the subject token carries and,
+// if set, to a maximum scope set that applies to every route, on top of the
+// routes' max_scopes. A request left without scopes is denied.
+//
+// Exchanges of the processor's own identity have no caller consent, and
+// opaque subject tokens or those without a scope claim do not say what was
+// consented to; only the maximum scope set applies to them.
+type DownscopeHook struct {
+	// max is nil when no maximum scope set is configured
+	max map[string]bool
+}
+
+// NewDownscopeHook returns a hook with the space-separated maximum scope
+// set maxScopes; empty sets no maximum.
+func NewDownscopeHook(maxScopes string) *DownscopeHook {
+	h := &DownscopeHook{}
+	if fields := strings.Fields(maxScopes); len(fields) > 0 {
+		h.max = make(map[string]bool, len(fields))
+		for _, s := range fields {
+			h.max[s] = true
+		}
+	}
+	return h
+}
+
+func (*DownscopeHook) Name() string { return "downscope" }
+
+func (h *DownscopeHook) BeforeExchange(_ context.Context, req *ExchangeRequest) error {
+	var consented map[string]bool
+	if req.SubjectScopes != nil {
+		consented = make(map[string]bool, len(req.SubjectScopes))
+		for _, s := range req.SubjectScopes {
+			consented[s] = true
+		}
+	}
+	var kept, dropped []string
+	for _, s := range strings.Fields(req.Scopes) {
+		if (consented == nil || consented[s]) && (h.max == nil || h.max[s]) {
+			kept = append(kept, s)
+		} else {
+			dropped = append(dropped, s)
+		}
+	}
+	if len(dropped) == 0 {
+		return nil
+	}
+	req.Annotate("downscope_dropped", strings.Join(dropped, " "))
+	if len(kept) == 0 {
+		return &DenyError{Reason: "none of the requested scopes " + strings.Join(dropped, " ") + " are consented to or allowed"}
+	}
+	req.Scopes = strings.Join(kept, " ")
+	return nil
+}
+
+func (*DownscopeHook) AfterExchange(context.Context, *ExchangeRequest, *ExchangeResult) {}
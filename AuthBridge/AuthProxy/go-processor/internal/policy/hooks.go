@@ -0,0 +1,64 @@
+package policy
+
+import (
+	"context"
+	"strings"
+)
+
+func init() {
+	Register("noop", func() (Hook, error) { return NoopHook{}, nil })
+	Register("header", func() (Hook, error) { return HeaderHook{}, nil })
+}
+
+// NoopHook does nothing; it is the reference implementation for forks.
+type NoopHook struct{}
+
+func (NoopHook) Name() string { return "noop" }
+
+func (NoopHook) BeforeExchange(context.Context, *ExchangeRequest) error { return nil }
+
+func (NoopHook) AfterExchange(context.Context, *ExchangeRequest, *ExchangeResult) {}
+
+// Headers read by HeaderHook.
+const (
+	PolicyHeader = "x-authbridge-policy"
+	ScopesHeader = "x-authbridge-scopes"
+)
+
+// HeaderHook is an example hook driven by request headers set by the agent:
+//   - "x-authbridge-policy: deny" rejects the exchange
+//   - "x-authbridge-scopes: a b" narrows the requested scopes to that subset;
+//     it can never add scopes the route would not request, and an empty
+//     intersection is denied
+type HeaderHook struct{}
+
+func (HeaderHook) Name() string { return "header" }
+
+func (HeaderHook) BeforeExchange(_ context.Context, req *ExchangeRequest) error {
+	if strings.EqualFold(req.Headers[PolicyHeader], "deny") {
+		return &DenyError{Reason: PolicyHeader + " requested deny"}
+	}
+
+	requested := req.Headers[ScopesHeader]
+	if requested == "" {
+		return nil
+	}
+	wanted := make(map[string]bool)
+	for _, s := range strings.Fields(requested) {
+		wanted[s] = true
+	}
+	var kept []string
+	for _, s := range strings.Fields(req.Scopes) {
+		if wanted[s] {
+			kept = append(kept, s)
+		}
+	}
+	if len(kept) == 0 {
+		return &DenyError{Reason: "none of the scopes in " + ScopesHeader + " are allowed for this route"}
+	}
+	req.Scopes = strings.Join(kept, " ")
+	req.Annotate("header_hook_scopes", req.Scopes)
+	return nil
+}
+
+func (HeaderHook) AfterExchange(context.Context, *ExchangeRequest, *ExchangeResult) {}
@@ -0,0 +1,158 @@
+// Package policy defines in-process hooks invoked around token exchange, so
+// downstream forks can add custom logic without patching the processor.
+//
+// A hook is registered under a name (typically from an init function) and
+// enabled at runtime by listing it in POLICY_HOOKS:
+//
+//	func init() {
+//		policy.Register("my-hook", func() (policy.Hook, error) { return &myHook{}, nil })
+//	}
+package policy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// ExchangeRequest describes an outbound exchange about to happen. Hooks may
+// modify Audience and Scopes in BeforeExchange and add Annotations, which
+// the processor logs with the request's audit line.
+type ExchangeRequest struct {
+	Host        string
+	Headers     map[string]string // lower-cased names
+	Audience    string
+	Scopes      string
+	Annotations map[string]string
+	// SubjectScopes are the scopes the subject token was issued with, from
+	// its scope or scp claim; empty if the claim lists none. Nil when they
+	// are unknown: the token has neither claim or is not a JWT (e.g. opaque),
+	// or the processor exchanges its own identity rather than a caller's token.
+	SubjectScopes []string
+}
+
+// Annotate records a key/value pair on the request's audit line.
+func (r *ExchangeRequest) Annotate(key, value string) {
+	if r.Annotations == nil {
+		r.Annotations = make(map[string]string)
+	}
+	r.Annotations[key] = value
+}
+
+// ExchangeResult describes the outcome of an exchange.
+type ExchangeResult struct {
+	// Err is nil when the exchange succeeded
+	Err error
+	// ExpiresIn is the exchanged token lifetime in seconds, 0 if unknown
+	ExpiresIn int
+}
+
+// Hook is invoked before and after every outbound token exchange.
+// Returning a *DenyError from BeforeExchange rejects the request with 403.
+// The processor rejects the request on any other error too, unless it is
+// configured to fail open. Scopes a hook adds beyond the route's max_scopes
+// are dropped.
+type Hook interface {
+	Name() string
+	BeforeExchange(ctx context.Context, req *ExchangeRequest) error
+	AfterExchange(ctx context.Context, req *ExchangeRequest, result *ExchangeResult)
+}
+
+// DenyError rejects a request from BeforeExchange.
+type DenyError struct {
+	Hook   string
+	Reason string
+}
+
+func (e *DenyError) Error() string {
+	return fmt.Sprintf("denied by policy hook %q: %s", e.Hook, e.Reason)
+}
+
+// Factory creates a hook instance; it may read its own configuration.
+type Factory func() (Hook, error)
+
+var (
+	registryMu sync.RWMutex
+	registry   = map[string]Factory{}
+)
+
+// Register makes a hook available under name. It panics on duplicates, like
+// other init-time registries.
+func Register(name string, factory Factory) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	if _, exists := registry[name]; exists {
+		panic(fmt.Sprintf("policy: hook %q registered twice", name))
+	}
+	registry[name] = factory
+}
+
+// Registered returns the names of all registered hooks, sorted.
+func Registered() []string {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	names := make([]string, 0, len(registry))
+	for name := range registry {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Chain runs hooks in order.
+type Chain []Hook
+
+// Load builds a chain from a comma-separated list of hook names. An empty
+// list yields the no-op chain.
+func Load(names string) (Chain, error) {
+	var chain Chain
+	for _, name := range strings.Split(names, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		registryMu.RLock()
+		factory, ok := registry[name]
+		registryMu.RUnlock()
+		if !ok {
+			return nil, fmt.Errorf("unknown policy hook %q (registered: %s)", name, strings.Join(Registered(), ", "))
+		}
+		hook, err := factory()
+		if err != nil {
+			return nil, fmt.Errorf("policy hook %q: %w", name, err)
+		}
+		chain = append(chain, hook)
+	}
+	return chain, nil
+}
+
+// BeforeExchange runs every hook until one denies. Non-deny errors are
+// returned joined after all hooks ran so the caller can log them.
+func (c Chain) BeforeExchange(ctx context.Context, req *ExchangeRequest) (*DenyError, error) {
+	var errs []error
+	for _, hook := range c {
+		err := hook.BeforeExchange(ctx, req)
+		if err == nil {
+			continue
+		}
+		var deny *DenyError
+		if errors.As(err, &deny) {
+			if deny.Hook == "" {
+				deny.Hook = hook.Name()
+			}
+			return deny, errors.Join(errs...)
+		}
+		errs = append(errs, fmt.Errorf("%s: %w", hook.Name(), err))
+	}
+	return nil, errors.Join(errs...)
+}
+
+// AfterExchange runs every hook.
+func (c Chain) AfterExchange(ctx context.Context, req *ExchangeRequest, result *ExchangeResult) {
+	for _, hook := range c {
+		hook.AfterExchange(ctx, req, result)
+	}
+}
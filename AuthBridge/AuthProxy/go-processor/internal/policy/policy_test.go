@@ -0,0 +1,150 @@
+package policy
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+)
+
+type recordingHook struct {
+	name   string
+	err    error
+	after  int
+	result *ExchangeResult
+}
+
+func (h *recordingHook) Name() string { return h.name }
+
+func (h *recordingHook) BeforeExchange(context.Context, *ExchangeRequest) error { return h.err }
+
+func (h *recordingHook) AfterExchange(_ context.Context, _ *ExchangeRequest, result *ExchangeResult) {
+	h.after++
+	h.result = result
+}
+
+func TestLoad(t *testing.T) {
+	chain, err := Load("")
+	if err != nil || len(chain) != 0 {
+		t.Fatalf("Load(\"\") = %v, %v; want empty chain", chain, err)
+	}
+
+	chain, err = Load(" noop , header ")
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if len(chain) != 2 || chain[0].Name() != "noop" || chain[1].Name() != "header" {
+		t.Fatalf("unexpected chain %v", chain)
+	}
+
+	_, err = Load("noop,missing")
+	if err == nil || !strings.Contains(err.Error(), `"missing"`) {
+		t.Fatalf("expected unknown hook error, got %v", err)
+	}
+}
+
+func TestLoadFactoryError(t *testing.T) {
+	Register("test-broken", func() (Hook, error) { return nil, errors.New("bad config") })
+	_, err := Load("test-broken")
+	if err == nil || !strings.Contains(err.Error(), "bad config") {
+		t.Fatalf("expected factory error, got %v", err)
+	}
+}
+
+func TestRegisterDuplicatePanics(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Fatal("expected panic on duplicate registration")
+		}
+	}()
+	Register("noop", func() (Hook, error) { return NoopHook{}, nil })
+}
+
+func TestChainBeforeExchange(t *testing.T) {
+	soft := &recordingHook{name: "soft", err: errors.New("backend unavailable")}
+	denier := &recordingHook{name: "denier", err: &DenyError{Reason: "not today"}}
+	never := &recordingHook{name: "never", err: &DenyError{Reason: "unreachable"}}
+
+	deny, err := Chain{soft, denier, never}.BeforeExchange(context.Background(), &ExchangeRequest{})
+	if deny == nil || deny.Hook != "denier" || deny.Reason != "not today" {
+		t.Fatalf("unexpected deny %+v", deny)
+	}
+	if err == nil || !strings.Contains(err.Error(), "soft: backend unavailable") {
+		t.Fatalf("expected soft error to be reported, got %v", err)
+	}
+
+	deny, err = Chain{soft}.BeforeExchange(context.Background(), &ExchangeRequest{})
+	if deny != nil || err == nil {
+		t.Fatalf("non-deny errors must not deny: %v, %v", deny, err)
+	}
+}
+
+func TestChainAfterExchange(t *testing.T) {
+	a, b := &recordingHook{name: "a"}, &recordingHook{name: "b"}
+	result := &ExchangeResult{ExpiresIn: 300}
+	Chain{a, b}.AfterExchange(context.Background(), &ExchangeRequest{}, result)
+	if a.after != 1 || b.after != 1 || b.result != result {
+		t.Fatalf("AfterExchange not run on every hook: a=%d b=%d", a.after, b.after)
+	}
+}
+
+func TestHeaderHook(t *testing.T) {
+	tests := []struct {
+		name       string
+		headers    map[string]string
+		wantDeny   bool
+		wantScopes string
+	}{
+		{name: "no headers", headers: nil, wantScopes: "openid mcp:read mcp:write"},
+		{name: "deny", headers: map[string]string{PolicyHeader: "Deny"}, wantDeny: true},
+		{name: "narrow", headers: map[string]string{ScopesHeader: "mcp:read admin"}, wantScopes: "mcp:read"},
+		{name: "no overlap", headers: map[string]string{ScopesHeader: "admin"}, wantDeny: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := &ExchangeRequest{Headers: tt.headers, Scopes: "openid mcp:read mcp:write"}
+			deny, err := Chain{HeaderHook{}}.BeforeExchange(context.Background(), req)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if (deny != nil) != tt.wantDeny {
+				t.Fatalf("deny = %v, want deny %v", deny, tt.wantDeny)
+			}
+			if !tt.wantDeny && req.Scopes != tt.wantScopes {
+				t.Errorf("scopes = %q, want %q", req.Scopes, tt.wantScopes)
+			}
+		})
+	}
+}
+
+func TestDownscopeHook(t *testing.T) {
+	tests := []struct {
+		name       string
+		max        string
+		subject    []string
+		wantDeny   bool
+		wantScopes string
+	}{
+		{name: "consented", subject: []string{"openid", "mcp:read", "mcp:write"}, wantScopes: "openid mcp:read mcp:write"},
+		{name: "narrowed to consent", subject: []string{"openid", "mcp:read"}, wantScopes: "openid mcp:read"},
+		{name: "narrowed to max", max: "openid mcp:write", subject: []string{"openid", "mcp:read", "mcp:write"}, wantScopes: "openid mcp:write"},
+		{name: "own identity", max: "mcp:read", wantScopes: "mcp:read"},
+		{name: "no scopes consented", subject: []string{}, wantDeny: true},
+		{name: "no overlap", subject: []string{"profile"}, wantDeny: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := &ExchangeRequest{Scopes: "openid mcp:read mcp:write", SubjectScopes: tt.subject}
+			deny, err := Chain{NewDownscopeHook(tt.max)}.BeforeExchange(context.Background(), req)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if (deny != nil) != tt.wantDeny {
+				t.Fatalf("deny = %v, want deny %v", deny, tt.wantDeny)
+			}
+			if !tt.wantDeny && req.Scopes != tt.wantScopes {
+				t.Errorf("scopes = %q, want %q", req.Scopes, tt.wantScopes)
+			}
+		})
+	}
+}
@@ -0,0 +1,176 @@
+package resolver
+
+import (
+	"container/list"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// CachingResolver caches the configurations of another resolver by host,
+// for a bounded number of hosts (least recently used first out) and a TTL each, so
+// expensive resolvers are not consulted on every request. Hosts without a
+// route are cached too; errors are not. Configurations that depend on more
+// than the host, e.g. templates with header or subject placeholders, are
+// never cached, nor are fallbacks a CompositeResolver returned because a
+// source before it failed. Invalidate and Purge drop entries when the underlying routes
+// change.
+type CachingResolver struct {
+	next TargetResolver
+	size int
+	ttl  time.Duration
+	now  func() time.Time
+
+	mu sync.Mutex
+	// lru holds *cacheEntry, most recently used first
+	lru   *list.List
+	hosts map[string]*list.Element
+
+	hits, misses atomic.Uint64
+}
+
+type cacheEntry struct {
+	host    string
+	config  *TargetConfig
+	expires time.Time
+}
+
+// NewCachingResolver returns next with a cache of size hosts and ttl.
+func NewCachingResolver(next TargetResolver, size int, ttl time.Duration) *CachingResolver {
+	return &CachingResolver{next: next, size: size, ttl: ttl, now: time.Now, lru: list.New(), hosts: make(map[string]*list.Element)}
+}
+
+// Resolve returns the cached configuration of host, or resolves and caches
+// it.
+func (c *CachingResolver) Resolve(ctx context.Context, host string) (*TargetConfig, error) {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	now := c.now()
+	c.mu.Lock()
+	if el, ok := c.hosts[host]; ok {
+		e := el.Value.(*cacheEntry)
+		if now.Before(e.expires) {
+			c.lru.MoveToFront(el)
+			c.mu.Unlock()
+			c.hits.Add(1)
+			return e.config.clone(), nil
+		}
+		c.removeLocked(el)
+	}
+	c.mu.Unlock()
+	c.misses.Add(1)
+
+	ctx, dependent := trackRequestDependence(ctx)
+	ctx, partial := trackPartialFailure(ctx)
+	config, err := c.next.Resolve(ctx, host)
+	if err != nil || *dependent || *partial {
+		return config, err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if el, ok := c.hosts[host]; ok {
+		// Resolved concurrently
+		c.removeLocked(el)
+	}
+	c.hosts[host] = c.lru.PushFront(&cacheEntry{host: host, config: config, expires: now.Add(c.ttl)})
+	for c.lru.Len() > c.size {
+		c.removeLocked(c.lru.Back())
+	}
+	return config.clone(), nil
+}
+
+func (c *CachingResolver) removeLocked(el *list.Element) {
+	delete(c.hosts, el.Value.(*cacheEntry).host)
+	c.lru.Remove(el)
+}
+
+// Invalidate drops the cached configuration of host.
+func (c *CachingResolver) Invalidate(host string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if el, ok := c.hosts[host]; ok {
+		c.removeLocked(el)
+	}
+}
+
+// Purge drops every cached configuration and returns how many there were.
+func (c *CachingResolver) Purge() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	n := c.lru.Len()
+	c.lru.Init()
+	c.hosts = make(map[string]*list.Element)
+	return n
+}
+
+// Routes returns the routes of the cached resolver, if it lists them.
+func (c *CachingResolver) Routes() []Route {
+	if r, ok := c.next.(interface{ Routes() []Route }); ok {
+		return r.Routes()
+	}
+	return nil
+}
+
+// WriteMetrics writes the cache's size and counters in the Prometheus text
+// format, with metric names starting with prefix.
+func (c *CachingResolver) WriteMetrics(w io.Writer, prefix string) {
+	c.mu.Lock()
+	entries := c.lru.Len()
+	c.mu.Unlock()
+	fmt.Fprintf(w, "# HELP %s_entries Hosts cached.\n", prefix)
+	fmt.Fprintf(w, "# TYPE %s_entries gauge\n", prefix)
+	fmt.Fprintf(w, "%s_entries %d\n", prefix, entries)
+	fmt.Fprintf(w, "# HELP %s_lookups_total Lookups, by whether the cache had the host.\n", prefix)
+	fmt.Fprintf(w, "# TYPE %s_lookups_total counter\n", prefix)
+	fmt.Fprintf(w, "%s_lookups_total{result=\"hit\"} %d\n", prefix, c.hits.Load())
+	fmt.Fprintf(w, "%s_lookups_total{result=\"miss\"} %d\n", prefix, c.misses.Load())
+}
+
+// clone returns a copy of c, so callers cannot change cached
+// configurations. Slices and maps are shared; they are never modified.
+func (c *TargetConfig) clone() *TargetConfig {
+	if c == nil {
+		return nil
+	}
+	clone := *c
+	return &clone
+}
+
+type requestDependenceKey struct{}
+
+// trackRequestDependence returns a context in which resolvers record that
+// the configuration they return depends on more than the host.
+func trackRequestDependence(ctx context.Context) (context.Context, *bool) {
+	dependent := new(bool)
+	return context.WithValue(ctx, requestDependenceKey{}, dependent), dependent
+}
+
+// markRequestDependent records in ctx that the configuration being resolved
+// depends on request attributes other than the host.
+func markRequestDependent(ctx context.Context) {
+	if dependent, ok := ctx.Value(requestDependenceKey{}).(*bool); ok {
+		*dependent = true
+	}
+}
+
+type partialFailureKey struct{}
+
+// trackPartialFailure returns a context in which resolvers record that the
+// configuration they return stands in for one a failed source may have had.
+func trackPartialFailure(ctx context.Context) (context.Context, *bool) {
+	partial := new(bool)
+	return context.WithValue(ctx, partialFailureKey{}, partial), partial
+}
+
+// markPartialFailure records in ctx that the configuration being resolved
+// was found after a source failed.
+func markPartialFailure(ctx context.Context) {
+	if partial, ok := ctx.Value(partialFailureKey{}).(*bool); ok {
+		*partial = true
+	}
+}
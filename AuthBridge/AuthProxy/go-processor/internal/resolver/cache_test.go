@@ -0,0 +1,169 @@
+package resolver
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCachingResolver(t *testing.T) {
+	lookups := map[string]int{}
+	next := resolverFunc(func(host string) (*TargetConfig, error) {
+		lookups[host]++
+		switch host {
+		case "flaky.tools.svc":
+			return nil, errors.New("policy service unavailable")
+		case "unknown.example.com":
+			return nil, nil
+		}
+		return &TargetConfig{Audience: host}, nil
+	})
+	now := time.Unix(0, 0)
+	c := NewCachingResolver(next, 2, time.Minute)
+	c.now = func() time.Time { return now }
+	ctx := context.Background()
+
+	for range 2 {
+		config, err := c.Resolve(ctx, "weather.tools.svc:8080")
+		if err != nil || config == nil || config.Audience != "weather.tools.svc" {
+			t.Fatalf("unexpected result %+v, %v", config, err)
+		}
+		// Callers cannot change the cached configuration
+		config.Audience = "changed"
+		c.Resolve(ctx, "unknown.example.com")
+		c.Resolve(ctx, "flaky.tools.svc")
+	}
+	if lookups["weather.tools.svc"] != 1 || lookups["unknown.example.com"] != 1 {
+		t.Errorf("expected routes and missing routes to be cached, got lookups %v", lookups)
+	}
+	if lookups["flaky.tools.svc"] != 2 {
+		t.Errorf("expected errors not to be cached, got lookups %v", lookups)
+	}
+	if config, _ := c.Resolve(ctx, "weather.tools.svc"); config.Audience != "weather.tools.svc" {
+		t.Errorf("expected cached configuration to be unchanged, got %q", config.Audience)
+	}
+
+	// The least recently used host is evicted beyond the cache's size
+	c.Resolve(ctx, "maps.tools.svc")
+	c.Resolve(ctx, "unknown.example.com")
+	if lookups["unknown.example.com"] != 2 {
+		t.Errorf("expected unknown.example.com to be evicted, got lookups %v", lookups)
+	}
+
+	now = now.Add(time.Minute)
+	c.Resolve(ctx, "maps.tools.svc")
+	if lookups["maps.tools.svc"] != 2 {
+		t.Errorf("expected expired entry to be resolved again, got lookups %v", lookups)
+	}
+
+	c.Invalidate("maps.tools.svc")
+	c.Resolve(ctx, "maps.tools.svc")
+	if lookups["maps.tools.svc"] != 3 {
+		t.Errorf("expected invalidated entry to be resolved again, got lookups %v", lookups)
+	}
+	if n := c.Purge(); n != 2 {
+		t.Errorf("Purge() = %d, want 2", n)
+	}
+
+	var metrics strings.Builder
+	c.WriteMetrics(&metrics, "test_route_cache")
+	for _, want := range []string{
+		"test_route_cache_entries 0",
+		`test_route_cache_lookups_total{result="hit"} 3`,
+		`test_route_cache_lookups_total{result="miss"} 8`,
+	} {
+		if !strings.Contains(metrics.String(), want) {
+			t.Errorf("metrics missing %q:\n%s", want, metrics.String())
+		}
+	}
+}
+
+func TestCachingResolver_StaticRoutes(t *testing.T) {
+	r := resolverFromYAML(t, `
+- host: "tenant.example.com"
+  target_audience: "{{ header.X-Tenant }}-api"
+- host: "fixed.example.com"
+  target_audience: "fixed-api"
+- host: "user.example.com"
+  token_scopes: "user:{{ sub }}"
+- host: "paths.example.com"
+  path_prefix: "/mcp"
+  target_audience: "paths-mcp"
+`)
+	c := NewCachingResolver(r, 10, time.Minute)
+	r.OnChange(func() { c.Purge() })
+
+	// Audiences rendered from request headers are not cached
+	for _, tenant := range []string{"acme", "globex"} {
+		ctx := WithRequestHeaders(context.Background(), map[string]string{"x-tenant": tenant})
+		config, err := c.Resolve(ctx, "tenant.example.com")
+		if err != nil || config == nil || config.Audience != tenant+"-api" {
+			t.Errorf("%s: unexpected result %+v, %v", tenant, config, err)
+		}
+	}
+
+	// Nor scopes rendered from the caller's subject
+	for _, sub := range []string{"alice", "bob"} {
+		config, err := c.Resolve(WithSubject(context.Background(), sub), "user.example.com")
+		if err != nil || config == nil || config.Scopes != "user:"+sub {
+			t.Errorf("%s: unexpected result %+v, %v", sub, config, err)
+		}
+	}
+
+	// Neither are routes depending on the path, matching or not
+	for _, p := range []string{"/mcp", "/healthz", "/mcp"} {
+		ctx := WithRequestHeaders(context.Background(), map[string]string{":path": p})
+		config, _ := c.Resolve(ctx, "paths.example.com")
+		if matched := config != nil; matched != (p == "/mcp") {
+			t.Errorf("%s: unexpected configuration %+v", p, config)
+		}
+	}
+
+	// Updates of the routes purge the cache
+	if config, _ := c.Resolve(context.Background(), "fixed.example.com"); config == nil || config.Audience != "fixed-api" {
+		t.Fatalf("unexpected configuration %+v", config)
+	}
+	if err := r.Update("push", []byte(`- host: "fixed.example.com"`+"\n  target_audience: \"updated-api\"")); err != nil {
+		t.Fatalf("unexpected update error: %v", err)
+	}
+	if config, _ := c.Resolve(context.Background(), "fixed.example.com"); config == nil || config.Audience != "updated-api" {
+		t.Errorf("expected updated route after purge, got %+v", config)
+	}
+}
+
+func TestCachingResolver_CompositeFallbackAfterFailure(t *testing.T) {
+	serviceDown, lookups := true, 0
+	service := resolverFunc(func(host string) (*TargetConfig, error) {
+		lookups++
+		if serviceDown {
+			return nil, errors.New("policy service unavailable")
+		}
+		return &TargetConfig{Audience: "weather-override"}, nil
+	})
+	file := resolverFromYAML(t, `
+- host: "*.tools.svc"
+  target_audience: "tools-default"
+`)
+	c := NewCachingResolver(NewCompositeResolver(
+		Source{Name: "policy-service", Resolver: service},
+		Source{Name: "routes-file", Resolver: file},
+	), 10, time.Minute)
+	ctx := context.Background()
+
+	config, err := c.Resolve(ctx, "weather.tools.svc")
+	if err != nil || config == nil || config.Audience != "tools-default" {
+		t.Fatalf("with the service down: %+v, %v, want the routes file's route", config, err)
+	}
+
+	serviceDown = false
+	config, err = c.Resolve(ctx, "weather.tools.svc")
+	if err != nil || config == nil || config.Audience != "weather-override" {
+		t.Errorf("after the service recovered: %+v, %v, want its route, not the cached fallback", config, err)
+	}
+	c.Resolve(ctx, "weather.tools.svc")
+	if lookups != 2 {
+		t.Errorf("service consulted %d times, want 2: routes found without a failure are cached", lookups)
+	}
+}
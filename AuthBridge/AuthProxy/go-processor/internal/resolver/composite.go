@@ -0,0 +1,105 @@
+package resolver
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"sync/atomic"
+)
+
+// Source is a named resolver consulted by a CompositeResolver.
+type Source struct {
+	Name     string
+	Resolver TargetResolver
+}
+
+// CompositeResolver consults its sources in order and returns the first
+// configuration found, so e.g. workload-specific routes of a policy service
+// override platform defaults of the routes file. A source that fails is
+// skipped; its error is returned only if no later source has a route, and a
+// later source's route is not cached by a CachingResolver. A
+// *TemplateError ends the lookup, as its source has the route. When no source
+// has one, the caller's global configuration applies.
+type CompositeResolver struct {
+	sources []compositeSource
+	// unresolved counts hosts no source had a route for
+	unresolved atomic.Uint64
+}
+
+type compositeSource struct {
+	Source
+	resolved atomic.Uint64
+	errors   atomic.Uint64
+}
+
+// NewCompositeResolver returns a resolver consulting sources in order.
+func NewCompositeResolver(sources ...Source) *CompositeResolver {
+	c := &CompositeResolver{sources: make([]compositeSource, len(sources))}
+	for i, s := range sources {
+		c.sources[i].Source = s
+	}
+	return c
+}
+
+// Resolve returns the configuration of the first source with a route for
+// host.
+func (c *CompositeResolver) Resolve(ctx context.Context, host string) (*TargetConfig, error) {
+	var firstErr error
+	for i := range c.sources {
+		s := &c.sources[i]
+		config, err := s.Resolver.Resolve(ctx, host)
+		var templateErr *TemplateError
+		if errors.As(err, &templateErr) {
+			return nil, fmt.Errorf("%s: %w", s.Name, err)
+		}
+		if err != nil {
+			s.errors.Add(1)
+			slog.Warn("Route source failed, trying the next one", "component", "resolver", "source", s.Name, "host", host, "error", err)
+			if firstErr == nil {
+				firstErr = fmt.Errorf("%s: %w", s.Name, err)
+			}
+			continue
+		}
+		if config != nil {
+			s.resolved.Add(1)
+			slog.Debug("Route found", "component", "resolver", "source", s.Name, "host", host)
+			if firstErr != nil {
+				// A failed source may have a route that takes precedence
+				markPartialFailure(ctx)
+			}
+			return config, nil
+		}
+	}
+	c.unresolved.Add(1)
+	return nil, firstErr
+}
+
+// Routes returns the routes of the sources that list them, in source and
+// match order.
+func (c *CompositeResolver) Routes() []Route {
+	var routes []Route
+	for i := range c.sources {
+		if r, ok := c.sources[i].Resolver.(interface{ Routes() []Route }); ok {
+			routes = append(routes, r.Routes()...)
+		}
+	}
+	return routes
+}
+
+// WriteMetrics writes per-source counters in the Prometheus text format,
+// with metric names starting with prefix.
+func (c *CompositeResolver) WriteMetrics(w io.Writer, prefix string) {
+	fmt.Fprintf(w, "# HELP %s_total Hosts resolved, by the source that had their route (none for the global configuration).\n", prefix)
+	fmt.Fprintf(w, "# TYPE %s_total counter\n", prefix)
+	for i := range c.sources {
+		fmt.Fprintf(w, "%s_total{source=%q} %d\n", prefix, c.sources[i].Name, c.sources[i].resolved.Load())
+	}
+	fmt.Fprintf(w, "%s_total{source=\"none\"} %d\n", prefix, c.unresolved.Load())
+	fmt.Fprintf(w, "# HELP %s_errors_total Failed lookups, by source.\n", prefix)
+	fmt.Fprintf(w, "# TYPE %s_errors_total counter\n", prefix)
+	for i := range c.sources {
+		fmt.Fprintf(w, "%s_errors_total{source=%q} %d\n", prefix, c.sources[i].Name, c.sources[i].errors.Load())
+	}
+}
@@ -0,0 +1,102 @@
+package resolver
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+)
+
+// resolverFunc adapts a function to TargetResolver.
+type resolverFunc func(host string) (*TargetConfig, error)
+
+func (f resolverFunc) Resolve(_ context.Context, host string) (*TargetConfig, error) {
+	return f(host)
+}
+
+func TestCompositeResolver(t *testing.T) {
+	service := resolverFunc(func(host string) (*TargetConfig, error) {
+		switch host {
+		case "weather.tools.svc":
+			return &TargetConfig{Audience: "weather-override"}, nil
+		case "flaky.tools.svc":
+			return nil, errors.New("policy service unavailable")
+		}
+		return nil, nil
+	})
+	file := resolverFromYAML(t, `
+- host: "*.tools.svc"
+  target_audience: "tools-default"
+`)
+	c := NewCompositeResolver(Source{Name: "service", Resolver: service}, Source{Name: "file", Resolver: file})
+	ctx := context.Background()
+
+	tests := []struct {
+		host         string
+		wantAudience string
+		wantErr      bool
+	}{
+		{host: "weather.tools.svc", wantAudience: "weather-override"},
+		{host: "maps.tools.svc", wantAudience: "tools-default"},
+		// The file's route is used when the service fails
+		{host: "flaky.tools.svc", wantAudience: "tools-default"},
+		{host: "unknown.example.com"},
+	}
+	for _, tc := range tests {
+		config, err := c.Resolve(ctx, tc.host)
+		if err != nil {
+			t.Errorf("%s: unexpected error %v", tc.host, err)
+			continue
+		}
+		got := ""
+		if config != nil {
+			got = config.Audience
+		}
+		if got != tc.wantAudience {
+			t.Errorf("%s: audience = %q, want %q", tc.host, got, tc.wantAudience)
+		}
+	}
+
+	// Failures are reported when no later source has a route
+	failing := NewCompositeResolver(Source{Name: "service", Resolver: service})
+	if _, err := failing.Resolve(ctx, "flaky.tools.svc"); err == nil || !strings.Contains(err.Error(), "service:") {
+		t.Errorf("expected error naming the source, got %v", err)
+	}
+
+	if routes := c.Routes(); len(routes) != 1 || routes[0].Host != "*.tools.svc" {
+		t.Errorf("unexpected routes %+v", routes)
+	}
+
+	var metrics strings.Builder
+	c.WriteMetrics(&metrics, "test_resolutions")
+	for _, want := range []string{
+		`test_resolutions_total{source="service"} 1`,
+		`test_resolutions_total{source="file"} 2`,
+		`test_resolutions_total{source="none"} 1`,
+		`test_resolutions_errors_total{source="service"} 1`,
+	} {
+		if !strings.Contains(metrics.String(), want) {
+			t.Errorf("metrics missing %q:\n%s", want, metrics.String())
+		}
+	}
+}
+
+func TestCompositeResolver_TemplateErrorEndsLookup(t *testing.T) {
+	file := resolverFromYAML(t, `
+- host: "tools.example.com"
+  target_audience: "{{ header.x-tenant }}-tools"
+`)
+	fallback := resolverFunc(func(string) (*TargetConfig, error) {
+		return &TargetConfig{Audience: "fallback"}, nil
+	})
+	c := NewCompositeResolver(Source{Name: "file", Resolver: file}, Source{Name: "service", Resolver: fallback})
+
+	config, err := c.Resolve(context.Background(), "tools.example.com")
+	var templateErr *TemplateError
+	if !errors.As(err, &templateErr) || config != nil {
+		t.Fatalf("Resolve() = %+v, %v; want a *TemplateError and no fallback", config, err)
+	}
+	if templateErr.Route != "tools.example.com" || !strings.Contains(err.Error(), `header "x-tenant"`) {
+		t.Errorf("error = %v", err)
+	}
+}
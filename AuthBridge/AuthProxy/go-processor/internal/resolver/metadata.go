@@ -0,0 +1,76 @@
+package resolver
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync"
+
+	"github.com/kagenti/kagenti-extensions/configschema"
+)
+
+// maxMetadataRoutes bounds the compiled routes MetadataRoutes keeps. Envoy
+// sends one document per configured route, so the cache is only ever full
+// when documents vary per request; it is then emptied and refilled.
+const maxMetadataRoutes = 256
+
+// MetadataRoutes resolves routes configured in Envoy rather than the routes
+// file: the route of a request comes with the request, as one route in the
+// routes file format (JSON or YAML) without host. Documents are compiled
+// once and cached, invalid ones included.
+type MetadataRoutes struct {
+	mu     sync.Mutex
+	routes map[string]metadataRoute
+}
+
+type metadataRoute struct {
+	entry *routeEntry
+	err   error
+}
+
+// Resolve returns the configuration of the route doc for a request to host.
+func (m *MetadataRoutes) Resolve(ctx context.Context, host string, doc []byte) (*TargetConfig, error) {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	route := m.compile(doc)
+	if route.err != nil {
+		return nil, route.err
+	}
+	return route.entry.targetConfig(ctx, host)
+}
+
+func (m *MetadataRoutes) compile(doc []byte) metadataRoute {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if route, ok := m.routes[string(doc)]; ok {
+		return route
+	}
+	if m.routes == nil || len(m.routes) >= maxMetadataRoutes {
+		m.routes = make(map[string]metadataRoute)
+	}
+	entry, err := compileHostlessRoute(doc)
+	if err == nil && !entry.matchesAll() {
+		entry, err = nil, errors.New("path_prefix, path and methods are matched by the Envoy route")
+	}
+	route := metadataRoute{entry: entry, err: err}
+	m.routes[string(doc)] = route
+	return route
+}
+
+// compileHostlessRoute compiles one route in the routes file format whose
+// host comes from the request, as sent by Envoy or a remote resolver.
+func compileHostlessRoute(doc []byte) (*routeEntry, error) {
+	var yr yamlRoute
+	if err := configschema.Decode(doc, &yr); err != nil {
+		return nil, err
+	}
+	if yr.Host != "" {
+		return nil, errors.New("host is taken from the request and cannot be set")
+	}
+	entry, err := compileRoute(yr)
+	if err != nil {
+		return nil, err
+	}
+	return &entry, nil
+}
@@ -0,0 +1,59 @@
+package resolver
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestMetadataRoutes_Resolve(t *testing.T) {
+	var m MetadataRoutes
+
+	tests := []struct {
+		name    string
+		doc     string
+		check   func(*TargetConfig) bool
+		wantErr bool
+	}{
+		{
+			name: "JSON from Envoy metadata",
+			doc:  `{"target_audience":"mcp-{{ host_label_1 }}","token_scopes":"openid tools","upstream_timeout":"5s"}`,
+			check: func(c *TargetConfig) bool {
+				return c.Audience == "mcp-weather" && c.Scopes == "openid tools" && c.UpstreamTimeout == 5*time.Second
+			},
+		},
+		{
+			name: "passthrough",
+			doc:  `{"passthrough":true,"strip_headers":["X-Internal"]}`,
+			check: func(c *TargetConfig) bool {
+				return c.Passthrough && len(c.StripHeaders) == 1 && c.StripHeaders[0] == "x-internal"
+			},
+		},
+		{name: "unknown key", doc: `{"target_audiance":"a"}`, wantErr: true},
+		{name: "host set", doc: `{"host":"*.example.com"}`, wantErr: true},
+		{name: "path matcher", doc: `{"path_prefix":"/mcp","target_audience":"a"}`, wantErr: true},
+		{name: "invalid route", doc: `{"passthrough":true,"workload_identity":true}`, wantErr: true},
+		{name: "malformed", doc: `{"target_audience":`, wantErr: true},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			// The second call is served from the cache
+			for range 2 {
+				config, err := m.Resolve(context.Background(), "weather.tools.svc:8080", []byte(tc.doc))
+				if tc.wantErr {
+					if err == nil {
+						t.Fatalf("expected error, got config %+v", config)
+					}
+					continue
+				}
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				if !tc.check(config) {
+					t.Errorf("unexpected config %+v", config)
+				}
+			}
+		})
+	}
+}
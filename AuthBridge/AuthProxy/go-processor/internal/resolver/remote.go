@@ -0,0 +1,282 @@
+package resolver
+
+import (
+	"container/list"
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultRemoteTTL is how long an HTTPResolver reuses a route.
+	DefaultRemoteTTL = time.Minute
+	// DefaultRemoteNegativeTTL is how long an HTTPResolver remembers that a
+	// host has no route, or an invalid one.
+	DefaultRemoteNegativeTTL = 30 * time.Second
+
+	// maxRemoteRoutes bounds the hosts with a route an HTTPResolver caches,
+	// and maxRemoteNegativeRoutes those without a valid one; the least
+	// recently used go first. The separate bound keeps requests for many
+	// unknown hosts from evicting routes.
+	maxRemoteRoutes         = 1024
+	maxRemoteNegativeRoutes = 1024
+	// maxRemoteRouteSize bounds a route document of the policy service.
+	maxRemoteRouteSize = 64 << 10
+)
+
+// HTTPResolver resolves targets with an external policy service, so
+// audiences and scopes can be managed centrally. For each host it sends
+//
+//	GET <URL>?host=<host>
+//
+// and the service answers 200 with one route in the routes file format
+// (JSON or YAML) without host, or 404 (or 204) when the host has no route.
+// Answers are cached per host for TTL, missing and invalid routes for
+// NegativeTTL. When the service fails, an expired route of the host is
+// reused until it answers again. Concurrent requests for a host share one
+// query.
+type HTTPResolver struct {
+	URL    string
+	Client *http.Client
+	// TTL and NegativeTTL default to DefaultRemoteTTL and
+	// DefaultRemoteNegativeTTL.
+	TTL         time.Duration
+	NegativeTTL time.Duration
+
+	now func() time.Time
+
+	mu sync.Mutex
+	// routes holds hosts with a route, negative the others
+	routes, negative remoteCache
+	// calls are the queries in flight, by host
+	calls map[string]*remoteCall
+}
+
+type remoteRoute struct {
+	// entry is nil for hosts without a route
+	entry   *routeEntry
+	err     error
+	expires time.Time
+}
+
+// remoteCall is a query of the policy service that concurrent requests for
+// the same host wait for.
+type remoteCall struct {
+	done  chan struct{}
+	route remoteRoute
+	err   error
+}
+
+// Resolve returns the configuration the policy service has for host.
+func (r *HTTPResolver) Resolve(ctx context.Context, host string) (*TargetConfig, error) {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	now := r.clock()
+	r.mu.Lock()
+	cached, ok := r.cachedLocked(host)
+	r.mu.Unlock()
+
+	if !ok || !now.Before(cached.expires) {
+		route, err := r.fetchShared(ctx, host, now)
+		if err != nil {
+			if !ok || cached.entry == nil {
+				return nil, err
+			}
+			slog.Warn("Policy service failed, reusing expired route", "component", "resolver", "host", host, "error", err)
+			return cached.entry.resolve(ctx, host)
+		}
+		cached = route
+	}
+	if cached.err != nil {
+		return nil, cached.err
+	}
+	if cached.entry == nil {
+		return nil, nil
+	}
+	return cached.entry.resolve(ctx, host)
+}
+
+// fetchShared fetches and caches the route of host, or waits for the fetch
+// another request started. A route another request just stored is returned
+// as is.
+func (r *HTTPResolver) fetchShared(ctx context.Context, host string, now time.Time) (remoteRoute, error) {
+	r.mu.Lock()
+	if call, ok := r.calls[host]; ok {
+		r.mu.Unlock()
+		select {
+		case <-call.done:
+			return call.route, call.err
+		case <-ctx.Done():
+			return remoteRoute{}, ctx.Err()
+		}
+	}
+	if cached, ok := r.cachedLocked(host); ok && now.Before(cached.expires) {
+		r.mu.Unlock()
+		return cached, nil
+	}
+	call := &remoteCall{done: make(chan struct{})}
+	if r.calls == nil {
+		r.calls = make(map[string]*remoteCall)
+	}
+	r.calls[host] = call
+	r.mu.Unlock()
+
+	call.route, call.err = r.fetch(ctx, host)
+	r.mu.Lock()
+	if call.err == nil {
+		call.route = r.storeLocked(host, call.route, now)
+	}
+	delete(r.calls, host)
+	r.mu.Unlock()
+	close(call.done)
+	return call.route, call.err
+}
+
+// fetch asks the policy service for the route of host. Invalid routes are
+// returned in the route, as they are cached; only failures of the service
+// itself are errors.
+func (r *HTTPResolver) fetch(ctx context.Context, host string) (remoteRoute, error) {
+	u, err := url.Parse(r.URL)
+	if err != nil {
+		return remoteRoute{}, fmt.Errorf("invalid policy service URL: %w", err)
+	}
+	q := u.Query()
+	q.Set("host", host)
+	u.RawQuery = q.Encode()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return remoteRoute{}, err
+	}
+	req.Header.Set("Accept", "application/json")
+	client := r.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return remoteRoute{}, fmt.Errorf("querying policy service: %w", err)
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound, http.StatusNoContent:
+		slog.Debug("No remote route", "component", "resolver", "host", host)
+		return remoteRoute{}, nil
+	default:
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return remoteRoute{}, fmt.Errorf("policy service returned status %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+	doc, err := io.ReadAll(io.LimitReader(resp.Body, maxRemoteRouteSize+1))
+	if err != nil {
+		return remoteRoute{}, fmt.Errorf("reading policy service response: %w", err)
+	}
+	if len(doc) > maxRemoteRouteSize {
+		return remoteRoute{err: fmt.Errorf("remote route for %q exceeds %d bytes", host, maxRemoteRouteSize)}, nil
+	}
+	entry, err := compileHostlessRoute(doc)
+	if err != nil {
+		slog.Warn("Invalid remote route", "component", "resolver", "host", host, "error", err)
+		return remoteRoute{err: fmt.Errorf("remote route for %q: %w", host, err)}, nil
+	}
+	entry.pattern = host
+	slog.Debug("Fetched remote route", "component", "resolver", "host", host)
+	return remoteRoute{entry: entry}, nil
+}
+
+func (r *HTTPResolver) cachedLocked(host string) (remoteRoute, bool) {
+	if route, ok := r.routes.get(host); ok {
+		return route, true
+	}
+	return r.negative.get(host)
+}
+
+// storeLocked caches route until its TTL passes and returns it.
+func (r *HTTPResolver) storeLocked(host string, route remoteRoute, now time.Time) remoteRoute {
+	ttl := r.TTL
+	if ttl <= 0 {
+		ttl = DefaultRemoteTTL
+	}
+	if route.entry == nil {
+		ttl = r.NegativeTTL
+		if ttl <= 0 {
+			ttl = DefaultRemoteNegativeTTL
+		}
+	}
+	route.expires = now.Add(ttl)
+
+	if route.entry != nil {
+		r.negative.remove(host)
+		r.routes.put(host, route, maxRemoteRoutes)
+	} else {
+		r.routes.remove(host)
+		r.negative.put(host, route, maxRemoteNegativeRoutes)
+	}
+	return route
+}
+
+func (r *HTTPResolver) clock() time.Time {
+	if r.now != nil {
+		return r.now()
+	}
+	return time.Now()
+}
+
+// remoteCache holds routes by host, evicting the least recently used. The
+// zero value is empty.
+type remoteCache struct {
+	// lru holds *remoteCacheEntry, most recently used first
+	lru   *list.List
+	hosts map[string]*list.Element
+}
+
+type remoteCacheEntry struct {
+	host  string
+	route remoteRoute
+}
+
+func (c *remoteCache) get(host string) (remoteRoute, bool) {
+	el, ok := c.hosts[host]
+	if !ok {
+		return remoteRoute{}, false
+	}
+	c.lru.MoveToFront(el)
+	return el.Value.(*remoteCacheEntry).route, true
+}
+
+// put caches route for host, evicting the least recently used hosts beyond
+// size.
+func (c *remoteCache) put(host string, route remoteRoute, size int) {
+	if c.hosts == nil {
+		c.lru = list.New()
+		c.hosts = make(map[string]*list.Element)
+	}
+	if el, ok := c.hosts[host]; ok {
+		el.Value.(*remoteCacheEntry).route = route
+		c.lru.MoveToFront(el)
+		return
+	}
+	c.hosts[host] = c.lru.PushFront(&remoteCacheEntry{host: host, route: route})
+	for c.lru.Len() > size {
+		c.remove(c.lru.Back().Value.(*remoteCacheEntry).host)
+	}
+}
+
+func (c *remoteCache) remove(host string) {
+	if el, ok := c.hosts[host]; ok {
+		delete(c.hosts, host)
+		c.lru.Remove(el)
+	}
+}
+
+func (c *remoteCache) len() int {
+	return len(c.hosts)
+}
@@ -0,0 +1,197 @@
+package resolver
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// policyService answers route documents by host; unknown hosts get 404 and
+// failing hosts 500.
+func policyService(t *testing.T, routes map[string]string, failing *atomic.Bool, requests *atomic.Int32) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		if failing.Load() {
+			http.Error(w, "unavailable", http.StatusInternalServerError)
+			return
+		}
+		doc, ok := routes[r.URL.Query().Get("host")]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(doc))
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestHTTPResolver_Resolve(t *testing.T) {
+	var failing atomic.Bool
+	var requests atomic.Int32
+	srv := policyService(t, map[string]string{
+		"weather.tools.svc": `{"target_audience":"mcp-{{ host_label_1 }}","token_scopes":"openid tools"}`,
+		"broken.tools.svc":  `{"passthrough":true,"workload_identity":true}`,
+	}, &failing, &requests)
+
+	now := time.Unix(1700000000, 0)
+	r := &HTTPResolver{URL: srv.URL + "/routes", Client: srv.Client(), TTL: time.Minute, NegativeTTL: 10 * time.Second}
+	r.now = func() time.Time { return now }
+	ctx := context.Background()
+
+	config, err := r.Resolve(ctx, "weather.tools.svc:8080")
+	if err != nil {
+		t.Fatalf("Resolve: %v", err)
+	}
+	if config == nil || config.Audience != "mcp-weather" || config.Scopes != "openid tools" {
+		t.Fatalf("unexpected config %+v", config)
+	}
+	if _, err := r.Resolve(ctx, "weather.tools.svc"); err != nil || requests.Load() != 1 {
+		t.Errorf("expected cached route, got error %v after %d requests", err, requests.Load())
+	}
+
+	// Missing and invalid routes are cached for the negative TTL
+	for range 2 {
+		if config, err := r.Resolve(ctx, "unknown.svc"); err != nil || config != nil {
+			t.Errorf("expected no route, got %+v, %v", config, err)
+		}
+		if _, err := r.Resolve(ctx, "broken.tools.svc"); err == nil {
+			t.Error("expected error for invalid route")
+		}
+	}
+	if requests.Load() != 3 {
+		t.Errorf("expected 3 requests, got %d", requests.Load())
+	}
+	now = now.Add(11 * time.Second)
+	if _, err := r.Resolve(ctx, "unknown.svc"); err != nil || requests.Load() != 4 {
+		t.Errorf("expected negative entry to expire, got error %v after %d requests", err, requests.Load())
+	}
+
+	// An expired route is reused while the service fails
+	now = now.Add(time.Minute)
+	failing.Store(true)
+	config, err = r.Resolve(ctx, "weather.tools.svc")
+	if err != nil || config == nil || config.Audience != "mcp-weather" {
+		t.Errorf("expected stale route, got %+v, %v", config, err)
+	}
+	if _, err := r.Resolve(ctx, "other.svc"); err == nil {
+		t.Error("expected error without a cached route")
+	}
+
+	failing.Store(false)
+	before := requests.Load()
+	if _, err := r.Resolve(ctx, "weather.tools.svc"); err != nil || requests.Load() != before+1 {
+		t.Errorf("expected refetch once the service recovers, got error %v", err)
+	}
+}
+
+func TestHTTPResolver_EvictsLeastRecentlyUsed(t *testing.T) {
+	var failing atomic.Bool
+	var requests atomic.Int32
+	routes := make(map[string]string)
+	for i := range maxRemoteRoutes + 1 {
+		routes[fmt.Sprintf("svc-%d", i)] = `{"target_audience":"a"}`
+	}
+	srv := policyService(t, routes, &failing, &requests)
+	r := &HTTPResolver{URL: srv.URL, Client: srv.Client()}
+	ctx := context.Background()
+
+	for i := range maxRemoteRoutes {
+		if _, err := r.Resolve(ctx, fmt.Sprintf("svc-%d", i)); err != nil {
+			t.Fatalf("Resolve: %v", err)
+		}
+		// svc-0 stays the most recently used
+		if _, err := r.Resolve(ctx, "svc-0"); err != nil {
+			t.Fatalf("Resolve: %v", err)
+		}
+	}
+	if _, err := r.Resolve(ctx, fmt.Sprintf("svc-%d", maxRemoteRoutes)); err != nil {
+		t.Fatalf("Resolve: %v", err)
+	}
+	if got := r.routes.len(); got != maxRemoteRoutes {
+		t.Errorf("cached %d routes, want %d", got, maxRemoteRoutes)
+	}
+
+	before := requests.Load()
+	if _, err := r.Resolve(ctx, "svc-0"); err != nil || requests.Load() != before {
+		t.Errorf("expected svc-0 to stay cached, got error %v after %d requests", err, requests.Load()-before)
+	}
+	if _, err := r.Resolve(ctx, "svc-1"); err != nil || requests.Load() != before+1 {
+		t.Errorf("expected svc-1 to be evicted, got error %v after %d requests", err, requests.Load()-before)
+	}
+}
+
+func TestHTTPResolver_UnknownHostsKeepRoutes(t *testing.T) {
+	var failing atomic.Bool
+	var requests atomic.Int32
+	srv := policyService(t, map[string]string{"weather.tools.svc": `{"target_audience":"weather"}`}, &failing, &requests)
+	r := &HTTPResolver{URL: srv.URL, Client: srv.Client()}
+	ctx := context.Background()
+
+	if _, err := r.Resolve(ctx, "weather.tools.svc"); err != nil {
+		t.Fatalf("Resolve: %v", err)
+	}
+	for i := range 2 * maxRemoteNegativeRoutes {
+		if config, err := r.Resolve(ctx, fmt.Sprintf("unknown-%d", i)); err != nil || config != nil {
+			t.Fatalf("expected no route, got %+v, %v", config, err)
+		}
+	}
+	if got := r.negative.len(); got != maxRemoteNegativeRoutes {
+		t.Errorf("cached %d hosts without a route, want %d", got, maxRemoteNegativeRoutes)
+	}
+
+	before := requests.Load()
+	if config, err := r.Resolve(ctx, "weather.tools.svc"); err != nil || config == nil || requests.Load() != before {
+		t.Errorf("expected the route to stay cached, got %+v, %v after %d requests", config, err, requests.Load()-before)
+	}
+}
+
+func TestHTTPResolver_SharesConcurrentFetches(t *testing.T) {
+	var requests atomic.Int32
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		requests.Add(1)
+		<-release
+		_, _ = w.Write([]byte(`{"target_audience":"weather"}`))
+	}))
+	t.Cleanup(srv.Close)
+	r := &HTTPResolver{URL: srv.URL, Client: srv.Client()}
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 10)
+	for range 10 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			config, err := r.Resolve(context.Background(), "weather.tools.svc")
+			if err == nil && (config == nil || config.Audience != "weather") {
+				err = fmt.Errorf("unexpected config %+v", config)
+			}
+			errs <- err
+		}()
+	}
+	// Let the goroutines join the first fetch before it completes
+	for requests.Load() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	time.Sleep(20 * time.Millisecond)
+	close(release)
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		if err != nil {
+			t.Error(err)
+		}
+	}
+	if n := requests.Load(); n != 1 {
+		t.Errorf("expected one request to the policy service, got %d", n)
+	}
+}
@@ -2,7 +2,12 @@
 // to token exchange configuration.
 package resolver
 
-import "context"
+import (
+	"context"
+	"time"
+
+	"github.com/gobwas/glob"
+)
 
 // TargetConfig describes the token exchange parameters for a target service.
 // We use "target" terminology deliberately - these are resource servers that
@@ -15,13 +20,219 @@ type TargetConfig struct {
 	// Scopes are the permissions to request in the exchanged token.
 	Scopes string
 
+	// MaxScopes is the space-separated set of scopes this route may ever
+	// request. When set, the requested scopes are intersected with it before
+	// exchange, so callers cannot widen the exchanged token beyond route policy.
+	// Requests none of whose scopes it allows are denied.
+	MaxScopes string
+
 	// TokenEndpoint overrides the default token endpoint for this target.
 	// If empty, the global token endpoint is used.
 	TokenEndpoint string
 
+	// ClientID overrides the global client for this target, e.g. when its
+	// audience lives in another IdP realm. Empty uses the global client.
+	ClientID string
+
+	// ClientSecretRef locates the secret of ClientID. It is resolved per
+	// request, so rotated secret files apply without a reload.
+	ClientSecretRef SecretRef
+
+	// TokenCAFile is a PEM bundle of extra CAs trusted when calling the token
+	// endpoint for this target. If empty, the global bundle (if any) is used.
+	TokenCAFile string
+
+	// UpstreamTimeout bounds how long the target may take to respond.
+	// Zero means no route-specific timeout (Envoy's route timeout applies).
+	UpstreamTimeout time.Duration
+
+	// PathPrefix, Path and Methods restrict the route to some requests to
+	// the host: paths starting with the segments of PathPrefix (e.g. /mcp
+	// matches /mcp and /mcp/sse but not /mcpx), paths matching the glob Path
+	// (* within a segment, ** across segments) and the HTTP methods listed.
+	// Paths are cleaned and stripped of the query first. Empty matches every
+	// request.
+	PathPrefix string
+	Path       string
+	Methods    []string
+
 	// Passthrough skips token exchange entirely.
 	// Use for trusted internal services that don't need exchange.
 	Passthrough bool
+
+	// StripHeaders are removed from passthrough requests (including A2A
+	// passthrough methods) before forwarding, e.g. internal headers the
+	// target must not see. Lower-case; never includes authorization.
+	StripHeaders []string
+
+	// RequireExchange rejects the request when the token cannot be exchanged
+	// (no or malformed subject token, IdP error) instead of forwarding the
+	// original token.
+	RequireExchange bool
+
+	// RequireAuthorization asks the IdP whether the subject may access the
+	// target before exchanging, and denies the request if not.
+	RequireAuthorization bool
+
+	// Permissions are the space-separated "resource#scope" permissions the
+	// authorization check asks for. Empty checks access to the audience as a
+	// whole.
+	Permissions string
+
+	// WorkloadIdentity sends a token representing the workload itself instead
+	// of exchanging the caller's token, for calls without user context such as
+	// background agent tasks.
+	WorkloadIdentity bool
+
+	// DPoP requests sender-constrained (RFC 9449) tokens for this target and
+	// sends them with a DPoP proof of the ext proc's key.
+	DPoP bool
+
+	// ExchangeVia are intermediate exchanges made in order before the one
+	// for Audience, each on the token the previous one issued, for targets
+	// that only accept tokens obtained through e.g. a gateway's audience.
+	ExchangeVia []ExchangeHop
+
+	// Introspect checks the caller's token at the IdP's RFC 7662
+	// introspection endpoint instead of exchanging it, for opaque tokens, and
+	// rejects inactive ones. Claims of the response are forwarded as headers.
+	Introspect bool
+
+	// IntrospectionEndpoint overrides the introspection endpoint. If empty,
+	// the global or discovered one is used, else one derived from the token
+	// endpoint.
+	IntrospectionEndpoint string
+
+	// IntrospectionHeaders maps introspection response claims to the headers
+	// they are forwarded in, e.g. sub: x-sub. Lower-case header names.
+	IntrospectionHeaders map[string]string
+
+	// ExchangeAfterIntrospection still exchanges the token once introspection
+	// found it active, instead of forwarding it unchanged.
+	ExchangeAfterIntrospection bool
+
+	// MCPTools select the audience and scopes of MCP tools/call requests by
+	// tool name. When set, the request body of JSON POSTs is inspected before
+	// the exchange (see InspectsBody); other requests and unmatched tools use
+	// the route's own audience and scopes.
+	MCPTools []MCPTool
+
+	// A2A applies per-method policies to A2A (Agent2Agent) traffic. Nil
+	// treats the target like any other.
+	A2A *A2APolicy
+
+	// RequestHeaders and ResponseHeaders rewrite the headers of the target's
+	// requests and responses, whether or not the token is exchanged.
+	RequestHeaders  HeaderRules
+	ResponseHeaders HeaderRules
+}
+
+// ExchangeHop is an intermediate exchange of a route.
+type ExchangeHop struct {
+	Audience string
+	// Scopes and TokenEndpoint default to the route's when empty
+	Scopes        string
+	TokenEndpoint string
+}
+
+// InspectsBody reports whether exchanges for the target depend on the
+// request body: the MCP tool or A2A method it calls.
+func (c *TargetConfig) InspectsBody() bool {
+	return len(c.MCPTools) > 0 || (c.A2A != nil && len(c.A2A.Methods) > 0)
+}
+
+// A2APolicy tells how the requests of an A2A agent are handled. Agent card
+// fetches are forwarded unchanged unless ExchangeAgentCard is set; JSON-RPC
+// calls follow the first of Methods matching their method, else the route.
+type A2APolicy struct {
+	ExchangeAgentCard bool
+	Methods           []A2AMethod
+}
+
+// A2AMethod is the policy of the A2A methods matching Method.
+type A2AMethod struct {
+	// Method is a glob over JSON-RPC methods, e.g. "tasks/*".
+	Method string
+	// Passthrough forwards the caller's token unchanged.
+	Passthrough bool
+	Audience    string
+	Scopes      string
+
+	glob glob.Glob
+}
+
+// A2AMethod returns the first A2A method policy matching method, or nil.
+func (c *TargetConfig) A2AMethod(method string) *A2AMethod {
+	if c.A2A == nil || method == "" {
+		return nil
+	}
+	for i := range c.A2A.Methods {
+		if c.A2A.Methods[i].glob.Match(method) {
+			return &c.A2A.Methods[i]
+		}
+	}
+	return nil
+}
+
+// MCPTool overrides the audience and scopes of exchanges for the MCP tools
+// matching Name.
+type MCPTool struct {
+	// Name is a glob over tool names, e.g. "delete_*".
+	Name     string
+	Audience string
+	Scopes   string
+
+	glob glob.Glob
+}
+
+// MCPTool returns the first of c's MCPTools matching the tool name, or nil.
+func (c *TargetConfig) MCPTool(name string) *MCPTool {
+	if name == "" {
+		return nil
+	}
+	for i := range c.MCPTools {
+		if c.MCPTools[i].glob.Match(name) {
+			return &c.MCPTools[i]
+		}
+	}
+	return nil
+}
+
+// HeaderRules rewrite headers, in order: Rename, Remove, then Add. Header
+// names are lower-case and never pseudo-headers; request rules never touch
+// authorization, which the exchange owns. No header is both removed and set.
+type HeaderRules struct {
+	Rename []HeaderRename
+	Remove []string
+	// Add sets headers, replacing any existing value.
+	Add []HeaderValue
+}
+
+// HeaderRename moves the values of header From to header To.
+type HeaderRename struct {
+	From, To string
+}
+
+// HeaderValue is a header set by HeaderRules.
+type HeaderValue struct {
+	Name, Value string
+}
+
+// IsZero reports whether the rules change nothing.
+func (r *HeaderRules) IsZero() bool {
+	return len(r.Rename) == 0 && len(r.Remove) == 0 && len(r.Add) == 0
+}
+
+// SecretRef points at a secret without embedding it in the routes file:
+// either a file (e.g. a mounted Secret key) or an environment variable.
+type SecretRef struct {
+	File string `yaml:"file,omitempty" doc:"File holding the secret"`
+	Env  string `yaml:"env,omitempty" doc:"Environment variable holding the secret"`
+}
+
+// IsZero reports whether no secret is referenced.
+func (r SecretRef) IsZero() bool {
+	return r.File == "" && r.Env == ""
 }
 
 // TargetResolver maps a destination host to its token exchange configuration.
@@ -2,84 +2,714 @@ package resolver
 
 import (
 	"context"
-	"log"
+	"errors"
+	"fmt"
+	"log/slog"
 	"net"
 	"os"
+	"path"
+	"slices"
+	"sort"
+	"strings"
 	"sync"
+	"time"
 
 	"github.com/gobwas/glob"
-	"gopkg.in/yaml.v3"
+	"golang.org/x/net/http/httpguts"
+
+	"github.com/kagenti/kagenti-extensions/configschema"
 )
 
-// yamlRoute is the configuration file format for route entries.
+// yamlRoute is the configuration file format for route entries. It is
+// decoded strictly by configschema, so misspelled keys are errors.
 type yamlRoute struct {
-	Host           string `yaml:"host"`
-	TargetAudience string `yaml:"target_audience,omitempty"`
-	TokenScopes    string `yaml:"token_scopes,omitempty"`
-	TokenURL       string `yaml:"token_url,omitempty"`
-	Passthrough    bool   `yaml:"passthrough,omitempty"`
+	Host string `yaml:"host" doc:"Destination host glob, e.g. *.example.com"`
+	// PathPrefix, Path and Methods restrict the route to some requests
+	PathPrefix     string   `yaml:"path_prefix,omitempty" doc:"Only requests whose path starts with these segments, e.g. /mcp"`
+	Path           string   `yaml:"path,omitempty" doc:"Only requests whose path matches this glob, e.g. /api/*/admin"`
+	Methods        []string `yaml:"methods,omitempty" doc:"Only requests with one of these HTTP methods"`
+	TargetAudience string   `yaml:"target_audience,omitempty" doc:"Audience of exchanged tokens; may use {{ }} placeholders"`
+	TokenScopes    string   `yaml:"token_scopes,omitempty" doc:"Space-separated scopes requested in the exchange"`
+	MaxScopes      string   `yaml:"max_scopes,omitempty" doc:"Space-separated upper bound on the scopes of exchanged tokens"`
+	TokenURL       string   `yaml:"token_url,omitempty" doc:"Token endpoint for this route"`
+	// ClientID and ClientSecretRef override the global client credentials
+	ClientID        string    `yaml:"client_id,omitempty" doc:"Client ID used for this route's exchanges"`
+	ClientSecretRef SecretRef `yaml:"client_secret_ref,omitempty" doc:"Secret of client_id: a file or an environment variable"`
+	// TokenCAFile is a PEM bundle trusted for token_url, re-read on change
+	TokenCAFile string `yaml:"token_ca_file,omitempty" doc:"PEM bundle trusted for token_url"`
+	Passthrough bool   `yaml:"passthrough,omitempty" doc:"Forward the caller's token unchanged"`
+	// StripHeaders are removed from passthrough requests
+	StripHeaders []string `yaml:"strip_headers,omitempty" doc:"Headers removed from passthrough requests"`
+	// RequireExchange rejects requests whose token cannot be exchanged
+	RequireExchange bool `yaml:"require_exchange,omitempty" doc:"Reject requests whose token cannot be exchanged"`
+	// RequireAuthorization checks Permissions with the IdP before exchange
+	RequireAuthorization bool   `yaml:"require_authorization,omitempty" doc:"Check permissions with the IdP before exchange"`
+	Permissions          string `yaml:"permissions,omitempty" doc:"Permissions checked by require_authorization"`
+	// WorkloadIdentity replaces the caller's token with the workload's own
+	WorkloadIdentity bool `yaml:"workload_identity,omitempty" doc:"Send the workload's own token instead of the caller's"`
+	// DPoP requests DPoP-bound tokens for exchanges
+	DPoP bool `yaml:"dpop,omitempty" doc:"Request DPoP-bound tokens and send DPoP proofs"`
+	// ExchangeVia are exchanges made before the route's own, in order
+	ExchangeVia []yamlExchangeHop `yaml:"exchange_via,omitempty" doc:"Intermediate exchanges made in order before the route's own, e.g. to a gateway audience"`
+	// Introspect checks opaque tokens with the IdP instead of exchanging them
+	Introspect                 bool              `yaml:"introspect,omitempty" doc:"Check opaque caller tokens with the IdP's introspection endpoint"`
+	IntrospectionURL           string            `yaml:"introspection_url,omitempty" doc:"Introspection endpoint for this route"`
+	IntrospectionHeaders       map[string]string `yaml:"introspection_headers,omitempty" doc:"Introspection claims to forward, by header name"`
+	ExchangeAfterIntrospection bool              `yaml:"exchange_after_introspection,omitempty" doc:"Exchange the token after a successful introspection"`
+	// UpstreamTimeout is a Go duration string, e.g. "5s" or "750ms"
+	UpstreamTimeout string `yaml:"upstream_timeout,omitempty" doc:"Go duration the target may take to respond, e.g. 5s"`
+	// MCPTools select audience and scopes by the MCP tool called
+	MCPTools []yamlMCPTool `yaml:"mcp_tools,omitempty" doc:"Audience and scopes per MCP tool, first match wins"`
+	// A2A applies per-method policies to an A2A agent
+	A2A *yamlA2A `yaml:"a2a,omitempty" doc:"Per-method policies for an A2A agent"`
+	// RequestHeaders and ResponseHeaders rewrite headers beyond the token
+	RequestHeaders  yamlHeaderRules `yaml:"request_headers,omitempty" doc:"Header rules applied to requests to the target"`
+	ResponseHeaders yamlHeaderRules `yaml:"response_headers,omitempty" doc:"Header rules applied to the target's responses"`
+}
+
+type yamlHeaderRules struct {
+	Rename map[string]string `yaml:"rename,omitempty" doc:"Headers renamed, as from: to; applied first"`
+	Remove []string          `yaml:"remove,omitempty" doc:"Headers removed"`
+	Add    map[string]string `yaml:"add,omitempty" doc:"Headers set, replacing any existing value; applied last"`
+}
+
+type yamlExchangeHop struct {
+	TargetAudience string `yaml:"target_audience" doc:"Audience of the intermediate token"`
+	TokenScopes    string `yaml:"token_scopes,omitempty" doc:"Scopes of the intermediate token; defaults to the route's"`
+	TokenURL       string `yaml:"token_url,omitempty" doc:"Token endpoint of this exchange; defaults to the route's"`
+}
+
+type yamlA2A struct {
+	ExchangeAgentCard bool            `yaml:"exchange_agent_card,omitempty" doc:"Exchange agent card fetches instead of forwarding them unchanged"`
+	Methods           []yamlA2AMethod `yaml:"methods,omitempty" doc:"Policies per JSON-RPC method, first match wins"`
+}
+
+type yamlA2AMethod struct {
+	Method         string `yaml:"method" doc:"Glob over JSON-RPC methods, e.g. tasks/*"`
+	Passthrough    bool   `yaml:"passthrough,omitempty" doc:"Forward the caller's token unchanged"`
+	TargetAudience string `yaml:"target_audience,omitempty" doc:"Audience for these methods; defaults to the route's"`
+	TokenScopes    string `yaml:"token_scopes,omitempty" doc:"Scopes for these methods; defaults to the route's"`
+}
+
+type yamlMCPTool struct {
+	Name           string `yaml:"name" doc:"Glob over tool names, e.g. delete_*"`
+	TargetAudience string `yaml:"target_audience,omitempty" doc:"Audience for calls of these tools; defaults to the route's"`
+	TokenScopes    string `yaml:"token_scopes,omitempty" doc:"Scopes for calls of these tools; defaults to the route's"`
+}
+
+// RoutesSchema returns the JSON Schema of the routes file.
+func RoutesSchema() ([]byte, error) {
+	return configschema.Schema([]yamlRoute{}, "AuthBridge routes")
 }
 
 type routeEntry struct {
 	pattern string
 	glob    glob.Glob
-	config  TargetConfig
+	// index is the route's position in file order
+	index  int
+	config TargetConfig
+	// audience and scopes are set when target_audience and token_scopes
+	// contain placeholders
+	audience *valueTemplate
+	scopes   *valueTemplate
+	// pathGlob is set when path is
+	pathGlob glob.Glob
 }
 
+// MatchMode selects which of several routes matching a host applies.
+type MatchMode string
+
+const (
+	// MatchFirst applies the first matching route in file order.
+	MatchFirst MatchMode = "first"
+	// MatchSpecific applies the most specific matching route regardless of
+	// file order: exact hosts before globs within one label (*.example.com)
+	// before globs across labels (**.example.com). Within each class, longer
+	// literal parts win, then file order.
+	MatchSpecific MatchMode = "specific"
+)
+
 // StaticResolver resolves targets from a YAML configuration file.
 type StaticResolver struct {
+	// routes are kept in match order
 	routes []routeEntry
+	mode   MatchMode
+	// strict rejects reloads and updates with invalid or duplicate routes
+	strict bool
 	mu     sync.RWMutex
+	// onChange is called after the routes were replaced
+	onChange []func()
 }
 
 // NewStaticResolver loads routes from a YAML file.
 // Returns a resolver with no routes if the file doesn't exist.
 func NewStaticResolver(configPath string) (*StaticResolver, error) {
-	r := &StaticResolver{}
+	routes, err := loadRoutes(configPath, false)
+	if err != nil {
+		return nil, err
+	}
+	return &StaticResolver{routes: routes}, nil
+}
+
+// CheckRoutes loads the routes file at configPath strictly: unlike
+// NewStaticResolver, which skips invalid routes with a warning, it returns
+// every invalid route and every duplicate host, i.e. route the routes before
+// it always shadow, as errors.
+func CheckRoutes(configPath string) error {
+	_, err := loadRoutes(configPath, true)
+	return err
+}
+
+// SetStrict makes later reloads and updates fail, keeping the current routes,
+// if any route is invalid or duplicate, as with CheckRoutes.
+func (r *StaticResolver) SetStrict(strict bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.strict = strict
+}
+
+func (r *StaticResolver) isStrict() bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.strict
+}
+
+// Reload re-reads configPath and swaps in the new routes atomically. On error
+// the current routes are kept.
+func (r *StaticResolver) Reload(configPath string) error {
+	routes, err := loadRoutes(configPath, r.isStrict())
+	if err != nil {
+		return err
+	}
+	r.swap(routes)
+	return nil
+}
+
+// Update replaces the routes with those of docs, each a YAML list of routes
+// as in a routes file, e.g. pushed through the config service. source names
+// the update in errors. All documents are decoded before any route changes.
+func (r *StaticResolver) Update(source string, docs ...[]byte) error {
+	routes, err := parseRoutes(source, r.isStrict(), docs...)
+	if err != nil {
+		return err
+	}
+	r.swap(routes)
+	return nil
+}
+
+func (r *StaticResolver) swap(routes []routeEntry) {
+	r.mu.Lock()
+	r.routes = orderRoutes(routes, r.mode)
+	onChange := r.onChange
+	r.mu.Unlock()
+	for _, fn := range onChange {
+		fn()
+	}
+}
+
+// OnChange registers fn to be called whenever Reload or Update replaced the
+// routes, e.g. to invalidate a CachingResolver.
+func (r *StaticResolver) OnChange(fn func()) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.onChange = append(r.onChange, fn)
+}
+
+// SetMatchMode selects how routes matching the same host are chosen. The
+// default is MatchFirst.
+func (r *StaticResolver) SetMatchMode(mode MatchMode) error {
+	switch mode {
+	case MatchFirst, MatchSpecific:
+	default:
+		return fmt.Errorf("unknown match mode %q", mode)
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.mode = mode
+	r.routes = orderRoutes(r.routes, mode)
+	return nil
+}
+
+// orderRoutes returns routes sorted into match order for mode.
+func orderRoutes(routes []routeEntry, mode MatchMode) []routeEntry {
+	ordered := slices.Clone(routes)
+	if mode != MatchSpecific {
+		slices.SortFunc(ordered, func(a, b routeEntry) int { return a.index - b.index })
+		return ordered
+	}
+	slices.SortFunc(ordered, func(a, b routeEntry) int {
+		ac, al := patternSpecificity(a.pattern)
+		bc, bl := patternSpecificity(b.pattern)
+		if ac != bc {
+			return bc - ac
+		}
+		if al != bl {
+			return bl - al
+		}
+		if ar, br := a.requestSpecificity(), b.requestSpecificity(); ar != br {
+			return br - ar
+		}
+		return a.index - b.index
+	})
+	return ordered
+}
 
+// requestSpecificity ranks routes of the same host pattern: longer path
+// matchers first, then routes restricted to some methods.
+func (e *routeEntry) requestSpecificity() int {
+	_, literal := patternSpecificity(e.config.PathPrefix + e.config.Path)
+	if e.config.PathPrefix != "" || e.config.Path != "" {
+		literal++
+	}
+	literal *= 2
+	if len(e.config.Methods) > 0 {
+		literal++
+	}
+	return literal
+}
+
+// Specificity classes of host patterns, most specific last.
+const (
+	multiLabelGlob = iota
+	singleLabelGlob
+	exactHost
+)
+
+// patternSpecificity returns the specificity class of a host pattern and the
+// length of its literal parts.
+func patternSpecificity(pattern string) (class, literal int) {
+	class = exactHost
+	depth := 0
+	for i := 0; i < len(pattern); i++ {
+		switch c := pattern[i]; {
+		case c == '\\' && i+1 < len(pattern):
+			i++
+			if depth == 0 {
+				literal++
+			}
+		case c == '[' || c == '{':
+			depth++
+			class = min(class, singleLabelGlob)
+		case (c == ']' || c == '}') && depth > 0:
+			depth--
+		case c == '*' && i+1 < len(pattern) && pattern[i+1] == '*':
+			i++
+			class = multiLabelGlob
+		case c == '*' || c == '?':
+			class = min(class, singleLabelGlob)
+		case depth == 0:
+			literal++
+		}
+	}
+	return class, literal
+}
+
+func loadRoutes(configPath string, strict bool) ([]routeEntry, error) {
 	if _, err := os.Stat(configPath); os.IsNotExist(err) {
-		log.Printf("[Resolver] No routes config at %s, using defaults", configPath)
-		return r, nil
+		slog.Info("No routes config, using defaults", "component", "resolver", "path", configPath)
+		return nil, nil
 	}
 
 	content, err := os.ReadFile(configPath)
 	if err != nil {
 		return nil, err
 	}
+	return parseRoutes(configPath, strict, content)
+}
 
+// parseRoutes decodes and compiles the routes of docs. Invalid routes are
+// skipped with a warning, and duplicates only warned about, unless strict;
+// an invalid upstream_timeout alone is ignored with a warning.
+func parseRoutes(source string, strict bool, docs ...[]byte) ([]routeEntry, error) {
 	var routes []yamlRoute
-	if err := yaml.Unmarshal(content, &routes); err != nil {
-		return nil, err
+	for i, content := range docs {
+		var doc []yamlRoute
+		if err := configschema.Decode(content, &doc); err != nil {
+			if len(docs) > 1 {
+				return nil, fmt.Errorf("%s[%d]: %w", source, i, err)
+			}
+			return nil, fmt.Errorf("%s: %w", source, err)
+		}
+		routes = append(routes, doc...)
 	}
 
-	r.routes = make([]routeEntry, 0, len(routes))
-	for _, yr := range routes {
-		// Use '.' as separator so *.example.com doesn't match foo.bar.example.com
-		g, err := glob.Compile(yr.Host, '.')
+	entries := make([]routeEntry, 0, len(routes))
+	var errs []error
+	seen := make(map[string]int)
+	for i, yr := range routes {
+		if _, err := parseUpstreamTimeout(yr.UpstreamTimeout); err != nil && !strict {
+			// Dropping the route would also drop its exchange settings
+			slog.Warn("Invalid upstream_timeout, ignoring it", "component", "resolver", "host", yr.Host, "error", err)
+			yr.UpstreamTimeout = ""
+		}
+		entry, err := compileRoute(yr)
 		if err != nil {
-			log.Printf("[Resolver] Invalid pattern %q: %v, skipping", yr.Host, err)
+			if strict {
+				errs = append(errs, fmt.Errorf("%s: [%d] %s: %w", source, i, yr.Host, err))
+				continue
+			}
+			slog.Warn("Invalid route, skipping", "component", "resolver", "host", yr.Host, "error", err)
 			continue
 		}
+		if first, ok := seen[entry.matchKey()]; ok {
+			if strict {
+				errs = append(errs, fmt.Errorf("%s: [%d] %s: duplicates [%d], which matches the same requests first", source, i, yr.Host, first))
+			} else {
+				slog.Warn("Duplicate route", "component", "resolver", "host", yr.Host, "route", i, "duplicates", first)
+			}
+		} else {
+			seen[entry.matchKey()] = i
+		}
+		entry.index = len(entries)
+		entries = append(entries, entry)
+	}
+	if len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+
+	slog.Info("Loaded routes", "component", "resolver", "count", len(entries))
+	return entries, nil
+}
+
+// parseUpstreamTimeout parses a route's upstream_timeout; empty is none.
+func parseUpstreamTimeout(s string) (time.Duration, error) {
+	if s == "" {
+		return 0, nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil || d <= 0 {
+		return 0, fmt.Errorf("invalid upstream_timeout %q", s)
+	}
+	return d, nil
+}
+
+// compileRoute validates a route and compiles its globs and templates.
+func compileRoute(yr yamlRoute) (routeEntry, error) {
+	// Use '.' as separator so *.example.com doesn't match foo.bar.example.com
+	g, err := glob.Compile(yr.Host, '.')
+	if err != nil {
+		return routeEntry{}, fmt.Errorf("invalid pattern: %w", err)
+	}
+
+	if yr.ClientSecretRef.File != "" && yr.ClientSecretRef.Env != "" {
+		return routeEntry{}, errors.New("client_secret_ref needs exactly one of file and env")
+	}
+	if yr.ClientID == "" && !yr.ClientSecretRef.IsZero() {
+		return routeEntry{}, errors.New("client_secret_ref without client_id")
+	}
 
-		r.routes = append(r.routes, routeEntry{
-			pattern: yr.Host,
-			glob:    g,
-			config: TargetConfig{
-				Audience:      yr.TargetAudience,
-				Scopes:        yr.TokenScopes,
-				TokenEndpoint: yr.TokenURL,
-				Passthrough:   yr.Passthrough,
-			},
+	if yr.WorkloadIdentity && yr.Passthrough {
+		return routeEntry{}, errors.New("passthrough and workload_identity are exclusive")
+	}
+	if yr.DPoP && (yr.Passthrough || yr.WorkloadIdentity) {
+		return routeEntry{}, errors.New("dpop only applies to exchanged tokens")
+	}
+	if yr.Introspect && (yr.Passthrough || yr.WorkloadIdentity) {
+		return routeEntry{}, errors.New("introspect applies to the caller's token")
+	}
+	if !yr.Introspect && (yr.IntrospectionURL != "" || len(yr.IntrospectionHeaders) > 0 || yr.ExchangeAfterIntrospection) {
+		return routeEntry{}, errors.New("introspection settings without introspect")
+	}
+	if yr.Introspect && yr.DPoP && !yr.ExchangeAfterIntrospection {
+		return routeEntry{}, errors.New("dpop on an introspect route needs exchange_after_introspection")
+	}
+	if len(yr.MCPTools) > 0 && (yr.Passthrough || (yr.Introspect && !yr.ExchangeAfterIntrospection)) {
+		return routeEntry{}, errors.New("mcp_tools only applies to exchanged tokens")
+	}
+	if len(yr.ExchangeVia) > 0 && (yr.Passthrough || yr.WorkloadIdentity || (yr.Introspect && !yr.ExchangeAfterIntrospection)) {
+		return routeEntry{}, errors.New("exchange_via only applies to exchanged tokens")
+	}
+	exchangeVia, err := compileExchangeHops(yr.ExchangeVia)
+	if err != nil {
+		return routeEntry{}, fmt.Errorf("invalid exchange_via: %w", err)
+	}
+	mcpTools, err := compileMCPTools(yr.MCPTools)
+	if err != nil {
+		return routeEntry{}, fmt.Errorf("invalid mcp_tools: %w", err)
+	}
+	if yr.A2A != nil && (yr.Passthrough || (yr.Introspect && !yr.ExchangeAfterIntrospection)) {
+		return routeEntry{}, errors.New("a2a only applies to exchanged tokens")
+	}
+	a2aPolicy, err := compileA2A(yr.A2A)
+	if err != nil {
+		return routeEntry{}, fmt.Errorf("invalid a2a: %w", err)
+	}
+	requestHeaders, err := compileHeaderRules(yr.RequestHeaders, true)
+	if err != nil {
+		return routeEntry{}, fmt.Errorf("invalid request_headers: %w", err)
+	}
+	responseHeaders, err := compileHeaderRules(yr.ResponseHeaders, false)
+	if err != nil {
+		return routeEntry{}, fmt.Errorf("invalid response_headers: %w", err)
+	}
+
+	upstreamTimeout, err := parseUpstreamTimeout(yr.UpstreamTimeout)
+	if err != nil {
+		return routeEntry{}, err
+	}
+
+	var stripHeaders []string
+	for _, h := range yr.StripHeaders {
+		h = strings.ToLower(strings.TrimSpace(h))
+		if h == "" || h == "authorization" || strings.HasPrefix(h, ":") {
+			slog.Warn("Ignoring strip_headers entry", "component", "resolver", "host", yr.Host, "header", h)
+			continue
+		}
+		stripHeaders = append(stripHeaders, h)
+	}
+
+	var introspectionHeaders map[string]string
+	for claim, h := range yr.IntrospectionHeaders {
+		h = strings.ToLower(strings.TrimSpace(h))
+		if claim == "" || h == "" || h == "authorization" || strings.HasPrefix(h, ":") {
+			slog.Warn("Ignoring introspection_headers entry", "component", "resolver", "host", yr.Host, "claim", claim, "header", h)
+			continue
+		}
+		if introspectionHeaders == nil {
+			introspectionHeaders = make(map[string]string)
+		}
+		introspectionHeaders[claim] = h
+	}
+
+	audience, err := parseTemplate(yr.TargetAudience)
+	if err != nil {
+		return routeEntry{}, fmt.Errorf("invalid target_audience template: %w", err)
+	}
+	scopes, err := parseTemplate(yr.TokenScopes)
+	if err != nil {
+		return routeEntry{}, fmt.Errorf("invalid token_scopes template: %w", err)
+	}
+
+	pathPrefix, pathGlob, methods, err := compileRequestMatchers(yr)
+	if err != nil {
+		return routeEntry{}, err
+	}
+
+	return routeEntry{
+		pattern:  yr.Host,
+		glob:     g,
+		audience: audience,
+		scopes:   scopes,
+		pathGlob: pathGlob,
+		config: TargetConfig{
+			PathPrefix:                 pathPrefix,
+			Path:                       yr.Path,
+			Methods:                    methods,
+			Audience:                   yr.TargetAudience,
+			Scopes:                     yr.TokenScopes,
+			MaxScopes:                  yr.MaxScopes,
+			TokenEndpoint:              yr.TokenURL,
+			ClientID:                   yr.ClientID,
+			ClientSecretRef:            yr.ClientSecretRef,
+			TokenCAFile:                yr.TokenCAFile,
+			Passthrough:                yr.Passthrough,
+			StripHeaders:               stripHeaders,
+			RequireExchange:            yr.RequireExchange,
+			RequireAuthorization:       yr.RequireAuthorization,
+			Permissions:                yr.Permissions,
+			WorkloadIdentity:           yr.WorkloadIdentity,
+			DPoP:                       yr.DPoP,
+			ExchangeVia:                exchangeVia,
+			Introspect:                 yr.Introspect,
+			IntrospectionEndpoint:      yr.IntrospectionURL,
+			IntrospectionHeaders:       introspectionHeaders,
+			ExchangeAfterIntrospection: yr.ExchangeAfterIntrospection,
+			UpstreamTimeout:            upstreamTimeout,
+			MCPTools:                   mcpTools,
+			A2A:                        a2aPolicy,
+			RequestHeaders:             requestHeaders,
+			ResponseHeaders:            responseHeaders,
+		},
+	}, nil
+}
+
+func compileExchangeHops(hops []yamlExchangeHop) ([]ExchangeHop, error) {
+	var compiled []ExchangeHop
+	for i, h := range hops {
+		switch {
+		case h.TargetAudience == "":
+			return nil, fmt.Errorf("exchange %d has no target_audience", i+1)
+		case strings.Contains(h.TargetAudience, "{{"):
+			return nil, fmt.Errorf("exchange %d: target_audience cannot be a template", i+1)
+		}
+		compiled = append(compiled, ExchangeHop{Audience: h.TargetAudience, Scopes: h.TokenScopes, TokenEndpoint: h.TokenURL})
+	}
+	return compiled, nil
+}
+
+func compileHeaderRules(y yamlHeaderRules, request bool) (HeaderRules, error) {
+	var rules HeaderRules
+	name := func(h string) (string, error) {
+		n := strings.ToLower(strings.TrimSpace(h))
+		switch {
+		case !httpguts.ValidHeaderFieldName(n):
+			return "", fmt.Errorf("invalid header name %q", h)
+		case request && n == "authorization":
+			return "", errors.New("authorization is set by the exchange")
+		}
+		return n, nil
+	}
+	set := make(map[string]bool)
+	for _, from := range sortedKeys(y.Rename) {
+		f, err := name(from)
+		if err != nil {
+			return HeaderRules{}, err
+		}
+		t, err := name(y.Rename[from])
+		if err != nil {
+			return HeaderRules{}, err
+		}
+		rules.Rename = append(rules.Rename, HeaderRename{From: f, To: t})
+		set[t] = true
+	}
+	for _, h := range y.Add {
+		if !httpguts.ValidHeaderFieldValue(h) {
+			return HeaderRules{}, fmt.Errorf("invalid header value %q", h)
+		}
+	}
+	for _, h := range sortedKeys(y.Add) {
+		n, err := name(h)
+		if err != nil {
+			return HeaderRules{}, err
+		}
+		rules.Add = append(rules.Add, HeaderValue{Name: n, Value: y.Add[h]})
+		set[n] = true
+	}
+	for _, h := range y.Remove {
+		n, err := name(h)
+		if err != nil {
+			return HeaderRules{}, err
+		}
+		if set[n] {
+			return HeaderRules{}, fmt.Errorf("header %q is both removed and set", n)
+		}
+		rules.Remove = append(rules.Remove, n)
+	}
+	return rules, nil
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// compileRequestMatchers validates the path and method matchers of a route
+// and returns the normalized path prefix, the compiled path glob and the
+// upper-cased methods.
+func compileRequestMatchers(yr yamlRoute) (string, glob.Glob, []string, error) {
+	if yr.PathPrefix != "" && yr.Path != "" {
+		return "", nil, nil, errors.New("path_prefix and path are exclusive")
+	}
+	prefix := yr.PathPrefix
+	if prefix != "" {
+		if !strings.HasPrefix(prefix, "/") {
+			return "", nil, nil, fmt.Errorf("invalid path_prefix %q: must start with /", prefix)
+		}
+		prefix = path.Clean(prefix)
+	}
+	var g glob.Glob
+	if yr.Path != "" {
+		if !strings.HasPrefix(yr.Path, "/") {
+			return "", nil, nil, fmt.Errorf("invalid path %q: must start with /", yr.Path)
+		}
+		var err error
+		if g, err = glob.Compile(yr.Path, '/'); err != nil {
+			return "", nil, nil, fmt.Errorf("invalid path: %w", err)
+		}
+	}
+	var methods []string
+	for _, m := range yr.Methods {
+		if !httpguts.ValidHeaderFieldName(m) {
+			return "", nil, nil, fmt.Errorf("invalid method %q", m)
+		}
+		methods = append(methods, strings.ToUpper(m))
+	}
+	return prefix, g, methods, nil
+}
+
+func compileMCPTools(tools []yamlMCPTool) ([]MCPTool, error) {
+	var compiled []MCPTool
+	for _, t := range tools {
+		if t.Name == "" {
+			return nil, errors.New("tool without name")
+		}
+		if t.TargetAudience == "" && t.TokenScopes == "" {
+			return nil, fmt.Errorf("tool %q sets neither target_audience nor token_scopes", t.Name)
+		}
+		g, err := glob.Compile(t.Name)
+		if err != nil {
+			return nil, fmt.Errorf("tool %q: %w", t.Name, err)
+		}
+		compiled = append(compiled, MCPTool{Name: t.Name, Audience: t.TargetAudience, Scopes: t.TokenScopes, glob: g})
+	}
+	return compiled, nil
+}
+
+func compileA2A(a *yamlA2A) (*A2APolicy, error) {
+	if a == nil {
+		return nil, nil
+	}
+	policy := &A2APolicy{ExchangeAgentCard: a.ExchangeAgentCard}
+	for _, m := range a.Methods {
+		if m.Method == "" {
+			return nil, errors.New("method policy without method")
+		}
+		overrides := m.TargetAudience != "" || m.TokenScopes != ""
+		if m.Passthrough == overrides {
+			return nil, fmt.Errorf("method %q needs either passthrough or target_audience/token_scopes", m.Method)
+		}
+		g, err := glob.Compile(m.Method)
+		if err != nil {
+			return nil, fmt.Errorf("method %q: %w", m.Method, err)
+		}
+		policy.Methods = append(policy.Methods, A2AMethod{
+			Method:      m.Method,
+			Passthrough: m.Passthrough,
+			Audience:    m.TargetAudience,
+			Scopes:      m.TokenScopes,
+			glob:        g,
 		})
 	}
+	return policy, nil
+}
+
+// Route is a configured route, as listed by Routes.
+type Route struct {
+	Host string
+	// Index is the route's position in file order
+	Index  int
+	Config TargetConfig
+}
 
-	log.Printf("[Resolver] Loaded %d routes", len(r.routes))
-	return r, nil
+// Routes returns the routes in effect, in match order. Audience and scope
+// templates are returned unrendered.
+func (r *StaticResolver) Routes() []Route {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	routes := make([]Route, len(r.routes))
+	for i, entry := range r.routes {
+		routes[i] = Route{Host: entry.pattern, Index: entry.index, Config: entry.config}
+	}
+	return routes
 }
 
 // Resolve returns the configuration for the given host.
 // Returns nil if no route matches.
 func (r *StaticResolver) Resolve(ctx context.Context, host string) (*TargetConfig, error) {
+	route, err := r.Match(ctx, host)
+	if route == nil || err != nil {
+		return nil, err
+	}
+	return &route.Config, nil
+}
+
+// Match returns the route applying to a request to host, with its audience
+// and scope templates rendered, or nil if none does.
+func (r *StaticResolver) Match(ctx context.Context, host string) (*Route, error) {
 	r.mu.RLock()
 	defer r.mu.RUnlock()
 
@@ -88,12 +718,93 @@ func (r *StaticResolver) Resolve(ctx context.Context, host string) (*TargetConfi
 	}
 
 	for _, entry := range r.routes {
-		if entry.glob.Match(host) {
-			log.Printf("[Resolver] Host %q matched %q", host, entry.pattern)
-			config := entry.config
-			return &config, nil
+		if entry.glob.Match(host) && entry.matchesRequest(ctx) {
+			slog.Debug("Host matched", "component", "resolver", "host", host, "pattern", entry.pattern)
+			config, err := entry.targetConfig(ctx, host)
+			if err != nil {
+				return nil, err
+			}
+			return &Route{Host: entry.pattern, Index: entry.index, Config: *config}, nil
 		}
 	}
 
 	return nil, nil
 }
+
+// matchKey identifies the requests an entry applies to: entries with equal
+// keys match the same requests, so only the first of them is ever used.
+func (e *routeEntry) matchKey() string {
+	methods := slices.Clone(e.config.Methods)
+	sort.Strings(methods)
+	return strings.Join([]string{e.pattern, e.config.PathPrefix, e.config.Path, strings.Join(methods, ",")}, "\x00")
+}
+
+// matchesAll reports whether the entry has no path or method matchers.
+func (e *routeEntry) matchesAll() bool {
+	return e.config.PathPrefix == "" && e.pathGlob == nil && len(e.config.Methods) == 0
+}
+
+// matchesRequest reports whether the request of ctx matches the entry's
+// path and method matchers. Entries with matchers mark ctx as request
+// dependent, whether they match or not.
+func (e *routeEntry) matchesRequest(ctx context.Context) bool {
+	if e.matchesAll() {
+		return true
+	}
+	markRequestDependent(ctx)
+	headers := requestHeaders(ctx)
+	if len(e.config.Methods) > 0 && !slices.Contains(e.config.Methods, strings.ToUpper(headers[":method"])) {
+		return false
+	}
+	p := headers[":path"]
+	if i := strings.IndexAny(p, "?#"); i >= 0 {
+		p = p[:i]
+	}
+	if p == "" {
+		p = "/"
+	}
+	// Cleaned so e.g. /healthz/../mcp cannot pose as a /healthz request
+	p = path.Clean(p)
+	switch prefix := e.config.PathPrefix; {
+	case prefix != "":
+		return prefix == "/" || p == prefix || strings.HasPrefix(p, prefix+"/")
+	case e.pathGlob != nil:
+		return e.pathGlob.Match(p)
+	}
+	return true
+}
+
+// resolve returns the entry's configuration for a request to host, or nil if
+// the request does not match its path and method matchers.
+func (e *routeEntry) resolve(ctx context.Context, host string) (*TargetConfig, error) {
+	if !e.matchesRequest(ctx) {
+		return nil, nil
+	}
+	return e.targetConfig(ctx, host)
+}
+
+// targetConfig returns the entry's configuration for a request to host,
+// with its audience and scope templates rendered, or a *TemplateError.
+func (e *routeEntry) targetConfig(ctx context.Context, host string) (*TargetConfig, error) {
+	config := e.config
+	for _, t := range []struct {
+		template *valueTemplate
+		value    *string
+	}{
+		{e.audience, &config.Audience},
+		{e.scopes, &config.Scopes},
+	} {
+		if t.template == nil {
+			continue
+		}
+		if t.template.dependsOnRequest() {
+			markRequestDependent(ctx)
+		}
+		value, err := t.template.render(ctx, host)
+		if err != nil {
+			return nil, &TemplateError{Route: e.pattern, Err: err}
+		}
+		*t.value = value
+	}
+	return &config, nil
+}
@@ -4,7 +4,13 @@ import (
 	"context"
 	"os"
 	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
 	"testing"
+	"time"
+
+	"github.com/kagenti/kagenti-extensions/configschema"
 )
 
 func TestStaticResolver_NoConfigFile(t *testing.T) {
@@ -180,6 +186,172 @@ func TestStaticResolver_OrderMatters(t *testing.T) {
 	}
 }
 
+func TestStaticResolver_SpecificMatch(t *testing.T) {
+	// Least specific first, so first-match order would always pick **
+	r := resolverFromYAML(t, `
+- host: "**.example.com"
+  target_audience: "any-depth"
+- host: "*.example.com"
+  target_audience: "one-label"
+- host: "api-*.example.com"
+  target_audience: "api-prefix"
+- host: "*.eu.example.com"
+  target_audience: "eu"
+- host: "api.example.com"
+  target_audience: "exact"
+`)
+	if err := r.SetMatchMode(MatchSpecific); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	tests := []struct {
+		host string
+		want string
+	}{
+		// Exact hosts win over every glob
+		{"api.example.com", "exact"},
+		// Globs within one label win over globs across labels, and longer
+		// literal parts win within a class
+		{"api-v2.example.com", "api-prefix"},
+		{"web.example.com", "one-label"},
+		{"web.eu.example.com", "eu"},
+		{"web.us.example.com", "any-depth"},
+	}
+	for _, tc := range tests {
+		config, err := r.Resolve(context.Background(), tc.host)
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", tc.host, err)
+		}
+		if config == nil || config.Audience != tc.want {
+			t.Errorf("%s: expected %q, got %+v", tc.host, tc.want, config)
+		}
+	}
+
+	var patterns []string
+	for _, route := range r.Routes() {
+		patterns = append(patterns, route.Host)
+	}
+	want := []string{"api.example.com", "api-*.example.com", "*.eu.example.com", "*.example.com", "**.example.com"}
+	if !slices.Equal(patterns, want) {
+		t.Errorf("expected routes in match order %v, got %v", want, patterns)
+	}
+
+	// The mode applies to updated routes, and file order breaks ties
+	if err := r.Update("push", []byte(`
+- host: "*.example.com"
+  target_audience: "wildcard-1"
+- host: "*.example.com"
+  target_audience: "wildcard-2"
+- host: "specific.example.com"
+  target_audience: "specific"
+`)); err != nil {
+		t.Fatalf("unexpected update error: %v", err)
+	}
+	for host, want := range map[string]string{"specific.example.com": "specific", "other.example.com": "wildcard-1"} {
+		if config, _ := r.Resolve(context.Background(), host); config == nil || config.Audience != want {
+			t.Errorf("%s: expected %q, got %+v", host, want, config)
+		}
+	}
+
+	// Switching back restores file order
+	if err := r.SetMatchMode(MatchFirst); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if config, _ := r.Resolve(context.Background(), "specific.example.com"); config == nil || config.Audience != "wildcard-1" {
+		t.Errorf("expected first match after switching back, got %+v", config)
+	}
+
+	if err := r.SetMatchMode("longest"); err == nil {
+		t.Error("expected error for unknown match mode")
+	}
+}
+
+func TestStaticResolver_PathAndMethod(t *testing.T) {
+	r := resolverFromYAML(t, `
+- host: "tools.example.com"
+  path_prefix: "/healthz"
+  passthrough: true
+- host: "tools.example.com"
+  path: "/api/*/admin"
+  methods: [delete, PUT]
+  target_audience: "tools-admin"
+  require_authorization: true
+- host: "tools.example.com"
+  path_prefix: "/mcp/"
+  target_audience: "tools-mcp"
+- host: "tools.example.com"
+  target_audience: "tools"
+- host: "bad.example.com"
+  path_prefix: "mcp"
+- host: "bad.example.com"
+  path_prefix: "/mcp"
+  path: "/mcp/*"
+`)
+
+	tests := []struct {
+		method, path string
+		want         string
+	}{
+		{"GET", "/healthz", "passthrough"},
+		{"GET", "/healthz?verbose=1", "passthrough"},
+		{"GET", "/healthzz", "tools"},
+		// Paths are cleaned before matching
+		{"POST", "/healthz/../mcp", "tools-mcp"},
+		{"POST", "/mcp", "tools-mcp"},
+		{"GET", "/mcp/sse", "tools-mcp"},
+		{"DELETE", "/api/users/admin", "tools-admin"},
+		{"GET", "/api/users/admin", "tools"},
+		// * does not cross path segments
+		{"DELETE", "/api/a/b/admin", "tools"},
+		{"GET", "/", "tools"},
+	}
+	for _, tc := range tests {
+		ctx := WithRequestHeaders(context.Background(), map[string]string{":method": tc.method, ":path": tc.path})
+		config, err := r.Resolve(ctx, "tools.example.com")
+		if err != nil {
+			t.Fatalf("%s %s: unexpected error: %v", tc.method, tc.path, err)
+		}
+		got := "none"
+		switch {
+		case config == nil:
+		case config.Passthrough:
+			got = "passthrough"
+		default:
+			got = config.Audience
+		}
+		if got != tc.want {
+			t.Errorf("%s %s: expected %q, got %q", tc.method, tc.path, tc.want, got)
+		}
+	}
+
+	routes := r.Routes()
+	if len(routes) != 4 {
+		t.Fatalf("expected invalid matchers to be skipped, got %d routes", len(routes))
+	}
+	if admin := routes[1].Config; admin.Path != "/api/*/admin" || !slices.Equal(admin.Methods, []string{"DELETE", "PUT"}) {
+		t.Errorf("unexpected matchers %q %v", admin.Path, admin.Methods)
+	}
+	if routes[2].Config.PathPrefix != "/mcp" {
+		t.Errorf("expected path_prefix to be normalized, got %q", routes[2].Config.PathPrefix)
+	}
+
+	// In specific mode routes with matchers win regardless of order
+	r = resolverFromYAML(t, `
+- host: "tools.example.com"
+  target_audience: "tools"
+- host: "tools.example.com"
+  path_prefix: "/mcp"
+  target_audience: "tools-mcp"
+`)
+	if err := r.SetMatchMode(MatchSpecific); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	ctx := WithRequestHeaders(context.Background(), map[string]string{":method": "POST", ":path": "/mcp"})
+	if config, _ := r.Resolve(ctx, "tools.example.com"); config == nil || config.Audience != "tools-mcp" {
+		t.Errorf("expected path route to win in specific mode, got %+v", config)
+	}
+}
+
 func TestStaticResolver_PortStripping(t *testing.T) {
 	yaml := `
 - host: "service.example.com"
@@ -243,12 +415,374 @@ func TestStaticResolver_Passthrough(t *testing.T) {
 	}
 }
 
+func TestStaticResolver_RequireExchange(t *testing.T) {
+	yaml := `
+- host: "strict.example.com"
+  target_audience: "strict"
+  require_exchange: true
+- host: "lenient.example.com"
+  target_audience: "lenient"
+`
+	r := resolverFromYAML(t, yaml)
+
+	config, err := r.Resolve(context.Background(), "strict.example.com")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if config == nil || !config.RequireExchange {
+		t.Errorf("expected RequireExchange for strict.example.com, got %+v", config)
+	}
+
+	config, err = r.Resolve(context.Background(), "lenient.example.com")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if config == nil || config.RequireExchange {
+		t.Errorf("expected RequireExchange to default to false, got %+v", config)
+	}
+}
+
+func TestStaticResolver_RequireAuthorization(t *testing.T) {
+	yaml := `
+- host: "billing.example.com"
+  target_audience: "billing"
+  require_authorization: true
+  permissions: "invoices#read invoices#write"
+`
+	r := resolverFromYAML(t, yaml)
+
+	config, err := r.Resolve(context.Background(), "billing.example.com")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if config == nil || !config.RequireAuthorization {
+		t.Fatalf("expected RequireAuthorization, got %+v", config)
+	}
+	if config.Permissions != "invoices#read invoices#write" {
+		t.Errorf("Permissions = %q", config.Permissions)
+	}
+}
+
+func TestStaticResolver_ClientCredentials(t *testing.T) {
+	yaml := `
+- host: "billing.example.com"
+  target_audience: "billing"
+  client_id: "agent-billing-realm"
+  client_secret_ref:
+    file: "/etc/authproxy/clients/billing/client-secret"
+- host: "crm.example.com"
+  target_audience: "crm"
+  client_id: "agent-crm-realm"
+  client_secret_ref:
+    env: "CRM_CLIENT_SECRET"
+- host: "both.example.com"
+  client_id: "agent"
+  client_secret_ref:
+    file: "/secret"
+    env: "SECRET"
+- host: "orphan.example.com"
+  client_secret_ref:
+    env: "SECRET"
+`
+	r := resolverFromYAML(t, yaml)
+
+	config, err := r.Resolve(context.Background(), "billing.example.com")
+	if err != nil || config == nil {
+		t.Fatalf("Resolve: %+v, %v", config, err)
+	}
+	if config.ClientID != "agent-billing-realm" || config.ClientSecretRef != (SecretRef{File: "/etc/authproxy/clients/billing/client-secret"}) {
+		t.Errorf("got client %q, secret ref %+v", config.ClientID, config.ClientSecretRef)
+	}
+
+	config, err = r.Resolve(context.Background(), "crm.example.com")
+	if err != nil || config == nil {
+		t.Fatalf("Resolve: %+v, %v", config, err)
+	}
+	if config.ClientSecretRef != (SecretRef{Env: "CRM_CLIENT_SECRET"}) {
+		t.Errorf("secret ref = %+v", config.ClientSecretRef)
+	}
+
+	// Ambiguous refs and refs without a client are dropped
+	for _, host := range []string{"both.example.com", "orphan.example.com"} {
+		if config, _ := r.Resolve(context.Background(), host); config != nil {
+			t.Errorf("%s: expected route to be skipped, got %+v", host, config)
+		}
+	}
+}
+
+func TestStaticResolver_WorkloadIdentity(t *testing.T) {
+	yaml := `
+- host: "indexer.example.com"
+  target_audience: "indexer"
+  workload_identity: true
+- host: "conflicting.example.com"
+  passthrough: true
+  workload_identity: true
+`
+	r := resolverFromYAML(t, yaml)
+
+	config, err := r.Resolve(context.Background(), "indexer.example.com")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if config == nil || !config.WorkloadIdentity {
+		t.Fatalf("expected WorkloadIdentity, got %+v", config)
+	}
+
+	// A route cannot both skip and replace the token; it is dropped
+	config, err = r.Resolve(context.Background(), "conflicting.example.com")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if config != nil {
+		t.Errorf("expected conflicting route to be skipped, got %+v", config)
+	}
+}
+
+func TestStaticResolver_ExchangeVia(t *testing.T) {
+	yaml := `
+- host: "weather.tools.example.com"
+  target_audience: "weather-tool"
+  token_scopes: "openid weather"
+  exchange_via:
+  - target_audience: "mcp-gateway"
+    token_scopes: "openid gateway"
+  - target_audience: "tools-realm"
+    token_url: "https://idp.example.com/realms/tools/protocol/openid-connect/token"
+- host: "internal.example.com"
+  passthrough: true
+  exchange_via:
+  - target_audience: "mcp-gateway"
+- host: "unnamed.example.com"
+  target_audience: "tool"
+  exchange_via:
+  - token_scopes: "openid"
+`
+	r := resolverFromYAML(t, yaml)
+
+	config, err := r.Resolve(context.Background(), "weather.tools.example.com")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := []ExchangeHop{
+		{Audience: "mcp-gateway", Scopes: "openid gateway"},
+		{Audience: "tools-realm", TokenEndpoint: "https://idp.example.com/realms/tools/protocol/openid-connect/token"},
+	}
+	if config == nil || !reflect.DeepEqual(config.ExchangeVia, want) {
+		t.Fatalf("expected ExchangeVia %+v, got %+v", want, config)
+	}
+
+	// Routes that exchange nothing, and hops without an audience, are dropped
+	for _, host := range []string{"internal.example.com", "unnamed.example.com"} {
+		config, err := r.Resolve(context.Background(), host)
+		if err != nil || config != nil {
+			t.Errorf("%s: expected route to be skipped, got %+v, %v", host, config, err)
+		}
+	}
+}
+
+func TestStaticResolver_DPoP(t *testing.T) {
+	yaml := `
+- host: "tools.example.com"
+  target_audience: "tools"
+  dpop: true
+- host: "internal.example.com"
+  passthrough: true
+  dpop: true
+`
+	r := resolverFromYAML(t, yaml)
+
+	config, err := r.Resolve(context.Background(), "tools.example.com")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if config == nil || !config.DPoP {
+		t.Fatalf("expected DPoP, got %+v", config)
+	}
+
+	// Nothing is exchanged on a passthrough route, so there is no token to bind
+	config, err = r.Resolve(context.Background(), "internal.example.com")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if config != nil {
+		t.Errorf("expected passthrough route with dpop to be skipped, got %+v", config)
+	}
+}
+
+func TestStaticResolver_Introspect(t *testing.T) {
+	yaml := `
+- host: "legacy.example.com"
+  introspect: true
+  introspection_url: "https://idp.example.com/introspect"
+  introspection_headers:
+    sub: X-Sub
+    username: authorization
+  exchange_after_introspection: true
+- host: "opaque.example.com"
+  introspection_headers:
+    sub: x-sub
+`
+	r := resolverFromYAML(t, yaml)
+
+	config, err := r.Resolve(context.Background(), "legacy.example.com")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if config == nil || !config.Introspect || !config.ExchangeAfterIntrospection {
+		t.Fatalf("expected introspection with exchange, got %+v", config)
+	}
+	if config.IntrospectionEndpoint != "https://idp.example.com/introspect" {
+		t.Errorf("IntrospectionEndpoint = %q", config.IntrospectionEndpoint)
+	}
+	// Header names are lower-cased and authorization cannot be overwritten
+	if len(config.IntrospectionHeaders) != 1 || config.IntrospectionHeaders["sub"] != "x-sub" {
+		t.Errorf("IntrospectionHeaders = %v, want map[sub:x-sub]", config.IntrospectionHeaders)
+	}
+
+	config, err = r.Resolve(context.Background(), "opaque.example.com")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if config != nil {
+		t.Errorf("expected introspection_headers without introspect to be skipped, got %+v", config)
+	}
+}
+
+func TestStaticResolver_MCPTools(t *testing.T) {
+	yaml := `
+- host: "tools.example.com"
+  target_audience: "mcp-tools"
+  token_scopes: "openid"
+  mcp_tools:
+    - name: "delete_*"
+      token_scopes: "openid tools:write"
+    - name: "search"
+      target_audience: "mcp-search"
+- host: "internal.example.com"
+  passthrough: true
+  mcp_tools:
+    - name: "*"
+      token_scopes: "openid"
+- host: "empty.example.com"
+  mcp_tools:
+    - name: "search"
+`
+	r := resolverFromYAML(t, yaml)
+
+	config, err := r.Resolve(context.Background(), "tools.example.com")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if config == nil || len(config.MCPTools) != 2 {
+		t.Fatalf("expected two MCP tools, got %+v", config)
+	}
+	if tool := config.MCPTool("delete_issue"); tool == nil || tool.Scopes != "openid tools:write" || tool.Audience != "" {
+		t.Errorf("MCPTool(delete_issue) = %+v", tool)
+	}
+	if tool := config.MCPTool("search"); tool == nil || tool.Audience != "mcp-search" {
+		t.Errorf("MCPTool(search) = %+v", tool)
+	}
+	if tool := config.MCPTool("list_issues"); tool != nil {
+		t.Errorf("MCPTool(list_issues) = %+v, want nil", tool)
+	}
+	if tool := config.MCPTool(""); tool != nil {
+		t.Errorf("MCPTool(\"\") = %+v, want nil", tool)
+	}
+
+	for _, host := range []string{"internal.example.com", "empty.example.com"} {
+		config, err = r.Resolve(context.Background(), host)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if config != nil {
+			t.Errorf("expected %s to be skipped, got %+v", host, config)
+		}
+	}
+}
+
+func TestStaticResolver_A2A(t *testing.T) {
+	yaml := `
+- host: "planner.agents.example.com"
+  target_audience: "planner"
+  token_scopes: "openid"
+  a2a:
+    methods:
+      - method: "tasks/get"
+        passthrough: true
+      - method: "tasks/*"
+        token_scopes: "openid agent:manage"
+- host: "both.agents.example.com"
+  target_audience: "both"
+  a2a:
+    methods:
+      - method: "message/send"
+        passthrough: true
+        token_scopes: "openid"
+- host: "card.agents.example.com"
+  target_audience: "card"
+  a2a:
+    exchange_agent_card: true
+`
+	r := resolverFromYAML(t, yaml)
+
+	config, err := r.Resolve(context.Background(), "planner.agents.example.com")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if config == nil || config.A2A == nil || config.A2A.ExchangeAgentCard || !config.InspectsBody() {
+		t.Fatalf("expected A2A policy inspecting bodies, got %+v", config)
+	}
+	if m := config.A2AMethod("tasks/get"); m == nil || !m.Passthrough {
+		t.Errorf("A2AMethod(tasks/get) = %+v, want passthrough", m)
+	}
+	if m := config.A2AMethod("tasks/cancel"); m == nil || m.Passthrough || m.Scopes != "openid agent:manage" {
+		t.Errorf("A2AMethod(tasks/cancel) = %+v", m)
+	}
+	if m := config.A2AMethod("message/send"); m != nil {
+		t.Errorf("A2AMethod(message/send) = %+v, want nil", m)
+	}
+
+	config, _ = r.Resolve(context.Background(), "both.agents.example.com")
+	if config != nil {
+		t.Errorf("expected a method with passthrough and scopes to be skipped, got %+v", config)
+	}
+
+	// Agent card policy only: nothing to read from the body
+	config, _ = r.Resolve(context.Background(), "card.agents.example.com")
+	if config == nil || config.A2A == nil || !config.A2A.ExchangeAgentCard || config.InspectsBody() {
+		t.Errorf("expected agent card exchange without body inspection, got %+v", config)
+	}
+}
+
+func TestStaticResolver_StripHeaders(t *testing.T) {
+	yaml := `
+- host: "internal.service.local"
+  passthrough: true
+  strip_headers: ["X-Internal-Tenant", "authorization", ":authority", "x-debug"]
+`
+	r := resolverFromYAML(t, yaml)
+
+	config, err := r.Resolve(context.Background(), "internal.service.local")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if config == nil {
+		t.Fatal("expected config, got nil")
+	}
+	want := []string{"x-internal-tenant", "x-debug"}
+	if !slices.Equal(config.StripHeaders, want) {
+		t.Errorf("StripHeaders = %v, want %v", config.StripHeaders, want)
+	}
+}
+
 func TestStaticResolver_AllFields(t *testing.T) {
 	yaml := `
 - host: "full.example.com"
   target_audience: "aud"
   token_scopes: "openid profile"
   token_url: "https://custom.idp/token"
+  token_ca_file: "/etc/authproxy/ca/custom-idp.pem"
   passthrough: false
 `
 	r := resolverFromYAML(t, yaml)
@@ -269,11 +803,401 @@ func TestStaticResolver_AllFields(t *testing.T) {
 	if config.TokenEndpoint != "https://custom.idp/token" {
 		t.Errorf("TokenEndpoint: expected 'https://custom.idp/token', got %q", config.TokenEndpoint)
 	}
+	if config.TokenCAFile != "/etc/authproxy/ca/custom-idp.pem" {
+		t.Errorf("TokenCAFile: expected '/etc/authproxy/ca/custom-idp.pem', got %q", config.TokenCAFile)
+	}
 	if config.Passthrough != false {
 		t.Errorf("Passthrough: expected false, got true")
 	}
 }
 
+func TestStaticResolver_MaxScopes(t *testing.T) {
+	yaml := `
+- host: "tool.example.com"
+  target_audience: "tool"
+  token_scopes: "openid tool-read tool-write"
+  max_scopes: "openid tool-read"
+`
+	r := resolverFromYAML(t, yaml)
+
+	config, err := r.Resolve(context.Background(), "tool.example.com")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if config == nil {
+		t.Fatal("expected config, got nil")
+	}
+	if config.MaxScopes != "openid tool-read" {
+		t.Errorf("MaxScopes: expected 'openid tool-read', got %q", config.MaxScopes)
+	}
+}
+
+func TestStaticResolver_UpstreamTimeout(t *testing.T) {
+	yaml := `
+- host: "slow-tool.example.com"
+  target_audience: "slow-tool"
+  upstream_timeout: "2500ms"
+- host: "bad-timeout.example.com"
+  upstream_timeout: "soon"
+`
+	r := resolverFromYAML(t, yaml)
+
+	config, err := r.Resolve(context.Background(), "slow-tool.example.com")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if config == nil {
+		t.Fatal("expected config, got nil")
+	}
+	if config.UpstreamTimeout != 2500*time.Millisecond {
+		t.Errorf("UpstreamTimeout: expected 2.5s, got %v", config.UpstreamTimeout)
+	}
+
+	// An unparseable timeout is ignored; the route still applies
+	config, err = r.Resolve(context.Background(), "bad-timeout.example.com")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if config == nil || config.UpstreamTimeout != 0 {
+		t.Errorf("expected route with invalid timeout to be kept without a timeout, got %+v", config)
+	}
+
+	// Strict loading rejects it
+	if _, err := parseRoutes("routes.yaml", true, []byte(yaml)); err == nil || !strings.Contains(err.Error(), `invalid upstream_timeout "soon"`) {
+		t.Errorf("strict parse error = %v, want the invalid upstream_timeout", err)
+	}
+}
+
+func TestStaticResolver_ScopeTemplate(t *testing.T) {
+	r := resolverFromYAML(t, `
+- host: "**.svc.cluster.local"
+  target_audience: "{{ namespace }}-{{ host_label_1 }}"
+  token_scopes: "openid {{ namespace }}:read user:{{ sub }}"
+- host: "*.*"
+  target_audience: "{{ namespace }}"
+- host: "*.example.com"
+  target_audience: "{{ namespace }}"
+- host: "bad-scopes.example.com"
+  token_scopes: "openid {{ sub"
+`)
+
+	tests := []struct {
+		name     string
+		host     string
+		subject  string
+		audience string
+		scopes   string
+		wantErr  bool
+	}{
+		{"service host", "weather.tools.svc.cluster.local", "alice", "tools-weather", "openid tools:read user:alice", false},
+		{"short service host", "notes.team1", "", "team1", "", false},
+		{"missing subject", "weather.tools.svc.cluster.local", "", "", "", true},
+		{"not a service", "api.example.com", "alice", "", "", true},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			config, err := r.Resolve(WithSubject(context.Background(), tc.subject), tc.host)
+			if tc.wantErr {
+				if err == nil {
+					t.Errorf("expected error, got config %+v", config)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if config == nil || config.Audience != tc.audience || config.Scopes != tc.scopes {
+				t.Errorf("expected audience %q and scopes %q, got %+v", tc.audience, tc.scopes, config)
+			}
+		})
+	}
+
+	// Routes are listed with their templates unrendered
+	if routes := r.Routes(); len(routes) != 3 || routes[0].Config.Scopes != "openid {{ namespace }}:read user:{{ sub }}" {
+		t.Errorf("unexpected routes %+v", routes)
+	}
+}
+
+func TestStaticResolver_AudienceTemplate(t *testing.T) {
+	yaml := `
+- host: "*.tools.svc.cluster.local"
+  target_audience: "mcp-{{ host_label_1 }}"
+- host: "tenant-api.example.com"
+  target_audience: "{{ header.X-Tenant }}-api"
+- host: "bad-template.example.com"
+  target_audience: "{{ cookie.session }}"
+`
+	r := resolverFromYAML(t, yaml)
+
+	tests := []struct {
+		name     string
+		host     string
+		headers  map[string]string
+		audience string
+		wantErr  bool
+	}{
+		{"host label", "weather.tools.svc.cluster.local:8080", nil, "mcp-weather", false},
+		{"header", "tenant-api.example.com", map[string]string{"x-tenant": "acme"}, "acme-api", false},
+		{"missing header", "tenant-api.example.com", nil, "", true},
+		{"unsafe header value", "tenant-api.example.com", map[string]string{"x-tenant": "acme other"}, "", true},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			ctx := WithRequestHeaders(context.Background(), tc.headers)
+			config, err := r.Resolve(ctx, tc.host)
+			if tc.wantErr {
+				if err == nil {
+					t.Errorf("expected error, got config %+v", config)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if config == nil || config.Audience != tc.audience {
+				t.Errorf("expected audience %q, got %+v", tc.audience, config)
+			}
+		})
+	}
+
+	// Routes with an invalid template are skipped like invalid patterns
+	config, err := r.Resolve(context.Background(), "bad-template.example.com")
+	if err != nil || config != nil {
+		t.Errorf("expected route with invalid template to be skipped, got %+v, %v", config, err)
+	}
+}
+
+func TestStaticResolver_Reload(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "routes.yaml")
+	write := func(content string) {
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("failed to write test yaml: %v", err)
+		}
+	}
+
+	write(`
+- host: "service-a.example.com"
+  target_audience: "audience-a"
+`)
+	r, err := NewStaticResolver(path)
+	if err != nil {
+		t.Fatalf("failed to create resolver: %v", err)
+	}
+
+	write(`
+- host: "service-a.example.com"
+  target_audience: "audience-a2"
+  upstream_timeout: "2s"
+`)
+	if err := r.Reload(path); err != nil {
+		t.Fatalf("unexpected reload error: %v", err)
+	}
+	config, _ := r.Resolve(context.Background(), "service-a.example.com")
+	if config == nil || config.Audience != "audience-a2" || config.UpstreamTimeout != 2*time.Second {
+		t.Fatalf("expected reloaded route, got %+v", config)
+	}
+
+	write("- host: [unterminated")
+	if err := r.Reload(path); err == nil {
+		t.Fatal("expected error for invalid YAML")
+	}
+	config, _ = r.Resolve(context.Background(), "service-a.example.com")
+	if config == nil || config.Audience != "audience-a2" {
+		t.Errorf("expected previous routes to be kept after failed reload, got %+v", config)
+	}
+}
+
+func TestStaticResolver_Update(t *testing.T) {
+	r := resolverFromYAML(t, `
+- host: "service-a.example.com"
+  target_audience: "audience-a"
+`)
+	err := r.Update("push",
+		[]byte(`- host: "service-b.example.com"`+"\n  target_audience: \"audience-b\""),
+		[]byte(`- host: "service-c.example.com"`+"\n  target_audience: \"audience-c\""))
+	if err != nil {
+		t.Fatalf("unexpected update error: %v", err)
+	}
+	if config, _ := r.Resolve(context.Background(), "service-a.example.com"); config != nil {
+		t.Errorf("expected service-a to be replaced, got %+v", config)
+	}
+	config, _ := r.Resolve(context.Background(), "service-c.example.com")
+	if config == nil || config.Audience != "audience-c" {
+		t.Fatalf("expected pushed route, got %+v", config)
+	}
+	var hosts []string
+	for _, route := range r.Routes() {
+		hosts = append(hosts, route.Host)
+	}
+	if !slices.Equal(hosts, []string{"service-b.example.com", "service-c.example.com"}) {
+		t.Errorf("expected pushed routes to be listed in order, got %v", hosts)
+	}
+
+	// One invalid document rejects the whole update
+	err = r.Update("push", []byte(`- host: "service-d.example.com"`), []byte(`- hots: "x"`))
+	if err == nil || !strings.Contains(err.Error(), "push[1]") {
+		t.Fatalf("expected error naming the document, got %v", err)
+	}
+	if config, _ := r.Resolve(context.Background(), "service-b.example.com"); config == nil {
+		t.Error("expected previous routes to be kept after failed update")
+	}
+}
+
+func TestStaticResolver_StrictDecoding(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "routes.yaml")
+	if err := os.WriteFile(path, []byte(`
+- host: "service-a.example.com"
+  target_audiance: "audience-a"
+`), 0644); err != nil {
+		t.Fatalf("failed to write test yaml: %v", err)
+	}
+	_, err := NewStaticResolver(path)
+	if err == nil || !strings.Contains(err.Error(), "[0].target_audiance: unknown field") {
+		t.Fatalf("expected unknown field error, got %v", err)
+	}
+}
+
+func TestCheckRoutes(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "routes.yaml")
+	write := func(content string) {
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("failed to write test yaml: %v", err)
+		}
+	}
+
+	write(`
+- host: "tools.example.com"
+  path_prefix: "/mcp"
+  target_audience: "tools-mcp"
+- host: "tools.example.com"
+  target_audience: "tools"
+- host: "tools.example.com"
+  methods: [get]
+  target_audience: "tools-read"
+`)
+	if err := CheckRoutes(path); err != nil {
+		t.Fatalf("unexpected error for routes with distinct matchers: %v", err)
+	}
+	r, err := NewStaticResolver(path)
+	if err != nil {
+		t.Fatalf("failed to create resolver: %v", err)
+	}
+	r.SetStrict(true)
+
+	write(`
+- host: "tools.example.com"
+  target_audience: "tools"
+- host: "*.[bad"
+  target_audience: "bad"
+- host: "tools.example.com"
+  target_audience: "tools-again"
+`)
+	// Not strict, the invalid route is skipped and the duplicate kept
+	if _, err := NewStaticResolver(path); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	err = CheckRoutes(path)
+	for _, want := range []string{"[1] *.[bad: invalid pattern", "[2] tools.example.com: duplicates [0]"} {
+		if err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("expected error containing %q, got %v", want, err)
+		}
+	}
+	if err := r.Reload(path); err == nil {
+		t.Error("expected strict reload to fail")
+	}
+	if routes := r.Routes(); len(routes) != 3 {
+		t.Errorf("expected previous routes to be kept after failed reload, got %+v", routes)
+	}
+}
+
+func TestStaticResolver_Match(t *testing.T) {
+	r := resolverFromYAML(t, `
+- host: "tools.example.com"
+  path_prefix: "/mcp"
+  target_audience: "tools-mcp"
+- host: "*.example.com"
+  target_audience: "{{ host }}"
+`)
+	ctx := WithRequestHeaders(context.Background(), map[string]string{":method": "GET", ":path": "/"})
+	route, err := r.Match(ctx, "tools.example.com:8080")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if route == nil || route.Index != 1 || route.Host != "*.example.com" || route.Config.Audience != "tools.example.com" {
+		t.Errorf("expected the rendered glob route, got %+v", route)
+	}
+	if route, _ := r.Match(ctx, "other.org"); route != nil {
+		t.Errorf("expected no route, got %+v", route)
+	}
+}
+
+func TestStaticResolver_EnvExpansion(t *testing.T) {
+	configschema.SetExpandEnv(true)
+	t.Cleanup(func() { configschema.SetExpandEnv(false) })
+	t.Setenv("TEST_TENANT", "acme")
+	r := resolverFromYAML(t, `
+- host: "service-a.example.com"
+  target_audience: "${TEST_TENANT}-api"
+  token_url: "${TEST_TOKEN_URL:-http://keycloak:8080/token}"
+`)
+	config, _ := r.Resolve(context.Background(), "service-a.example.com")
+	if config == nil || config.Audience != "acme-api" || config.TokenEndpoint != "http://keycloak:8080/token" {
+		t.Fatalf("expected expanded route, got %+v", config)
+	}
+}
+
+func TestStaticResolver_HeaderRules(t *testing.T) {
+	r := resolverFromYAML(t, `
+- host: "tenant.example.com"
+  target_audience: "tenant"
+  request_headers:
+    add:
+      X-Tenant: "acme"
+    remove: ["x-internal-debug"]
+    rename:
+      x-user: x-forwarded-user
+  response_headers:
+    remove: ["x-internal-trace"]
+- host: "authz.example.com"
+  request_headers:
+    remove: ["Authorization"]
+- host: "pseudo.example.com"
+  response_headers:
+    add:
+      ":status": "200"
+- host: "conflict.example.com"
+  request_headers:
+    add:
+      x-tenant: "acme"
+    remove: ["x-tenant"]
+`)
+
+	config, _ := r.Resolve(context.Background(), "tenant.example.com")
+	if config == nil {
+		t.Fatal("expected tenant route")
+	}
+	want := HeaderRules{
+		Rename: []HeaderRename{{From: "x-user", To: "x-forwarded-user"}},
+		Remove: []string{"x-internal-debug"},
+		Add:    []HeaderValue{{Name: "x-tenant", Value: "acme"}},
+	}
+	if !reflect.DeepEqual(config.RequestHeaders, want) {
+		t.Errorf("RequestHeaders = %+v, want %+v", config.RequestHeaders, want)
+	}
+	if !reflect.DeepEqual(config.ResponseHeaders.Remove, []string{"x-internal-trace"}) {
+		t.Errorf("ResponseHeaders = %+v", config.ResponseHeaders)
+	}
+
+	for _, host := range []string{"authz.example.com", "pseudo.example.com", "conflict.example.com"} {
+		if config, _ := r.Resolve(context.Background(), host); config != nil {
+			t.Errorf("%s: expected route to be skipped, got %+v", host, config)
+		}
+	}
+}
+
 // resolverFromYAML creates a StaticResolver from inline YAML for testing
 func resolverFromYAML(t *testing.T, yaml string) *StaticResolver {
 	t.Helper()
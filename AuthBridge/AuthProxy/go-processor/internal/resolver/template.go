@@ -0,0 +1,208 @@
+package resolver
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Audience and scope templates let one route cover many near-identical
+// targets, e.g.
+//
+//	target_audience: "mcp-{{ host_label_1 }}"
+//	target_audience: "{{ header.x-tenant }}-api"
+//	token_scopes: "openid {{ namespace }}:read"
+//
+// Supported placeholders:
+//   - host: the request host without port
+//   - host_label_N: the Nth dot-separated label of the host, counting from 1
+//   - namespace: the namespace of a Kubernetes service host (svc.ns,
+//     svc.ns.svc or svc.ns.svc.<cluster domain>)
+//   - header.<name>: the value of a request header (case-insensitive)
+//   - sub: the sub claim of the caller's token
+//
+// Rendered values may only contain letters, digits and '.', '_', ':', '-',
+// so request attributes cannot inject arbitrary text into the audience.
+
+// TemplateError is returned by Resolve when a route applies to a request
+// but its audience or scope template cannot be rendered for it, e.g. because
+// a header it names is missing. The request must be rejected rather than
+// handled as if no route applied, or callers could skip the route's policy
+// by leaving out a header.
+type TemplateError struct {
+	// Route is the host pattern of the route
+	Route string
+	Err   error
+}
+
+func (e *TemplateError) Error() string {
+	return fmt.Sprintf("route %q: %v", e.Route, e.Err)
+}
+
+func (e *TemplateError) Unwrap() error {
+	return e.Err
+}
+
+type requestHeadersKey struct{}
+
+// WithRequestHeaders attaches request headers (lower-cased names) to ctx so
+// Resolve can render header-based templates.
+func WithRequestHeaders(ctx context.Context, headers map[string]string) context.Context {
+	return context.WithValue(ctx, requestHeadersKey{}, headers)
+}
+
+func requestHeaders(ctx context.Context) map[string]string {
+	headers, _ := ctx.Value(requestHeadersKey{}).(map[string]string)
+	return headers
+}
+
+type subjectKey struct{}
+
+// WithSubject attaches the subject of the caller's token to ctx so Resolve
+// can render {{ sub }} templates. The token need not be verified yet: the
+// rendered values only parameterize its exchange, which verifies it.
+func WithSubject(ctx context.Context, subject string) context.Context {
+	return context.WithValue(ctx, subjectKey{}, subject)
+}
+
+func requestSubject(ctx context.Context) string {
+	subject, _ := ctx.Value(subjectKey{}).(string)
+	return subject
+}
+
+type templateSegment struct {
+	literal string
+	// Placeholder kinds; at most one is set
+	host       bool
+	hostLabel  int
+	namespace  bool
+	headerName string
+	subject    bool
+}
+
+type valueTemplate struct {
+	source   string
+	segments []templateSegment
+}
+
+// parseTemplate returns nil when s contains no placeholders.
+func parseTemplate(s string) (*valueTemplate, error) {
+	if !strings.Contains(s, "{{") {
+		return nil, nil
+	}
+
+	t := &valueTemplate{source: s}
+	rest := s
+	for rest != "" {
+		start := strings.Index(rest, "{{")
+		if start < 0 {
+			t.segments = append(t.segments, templateSegment{literal: rest})
+			break
+		}
+		if start > 0 {
+			t.segments = append(t.segments, templateSegment{literal: rest[:start]})
+		}
+		end := strings.Index(rest[start:], "}}")
+		if end < 0 {
+			return nil, fmt.Errorf("unterminated placeholder in %q", s)
+		}
+		name := strings.TrimSpace(rest[start+2 : start+end])
+		seg, err := parsePlaceholder(name)
+		if err != nil {
+			return nil, fmt.Errorf("%w in %q", err, s)
+		}
+		t.segments = append(t.segments, seg)
+		rest = rest[start+end+2:]
+	}
+	return t, nil
+}
+
+func parsePlaceholder(name string) (templateSegment, error) {
+	switch {
+	case name == "host":
+		return templateSegment{host: true}, nil
+	case strings.HasPrefix(name, "host_label_"):
+		n, err := strconv.Atoi(strings.TrimPrefix(name, "host_label_"))
+		if err != nil || n < 1 {
+			return templateSegment{}, fmt.Errorf("invalid placeholder %q", name)
+		}
+		return templateSegment{hostLabel: n}, nil
+	case name == "namespace":
+		return templateSegment{namespace: true}, nil
+	case name == "sub":
+		return templateSegment{subject: true}, nil
+	case strings.HasPrefix(name, "header.") && len(name) > len("header."):
+		return templateSegment{headerName: strings.ToLower(strings.TrimPrefix(name, "header."))}, nil
+	default:
+		return templateSegment{}, fmt.Errorf("unknown placeholder %q", name)
+	}
+}
+
+// dependsOnRequest reports whether t renders more than the host, i.e.
+// request headers or the caller's subject.
+func (t *valueTemplate) dependsOnRequest() bool {
+	for _, seg := range t.segments {
+		if seg.headerName != "" || seg.subject {
+			return true
+		}
+	}
+	return false
+}
+
+// render substitutes the attributes of the request of ctx. host must not
+// include a port.
+func (t *valueTemplate) render(ctx context.Context, host string) (string, error) {
+	var b strings.Builder
+	labels := strings.Split(host, ".")
+	for _, seg := range t.segments {
+		var value string
+		switch {
+		case seg.host:
+			value = host
+		case seg.hostLabel > 0:
+			if seg.hostLabel > len(labels) {
+				return "", fmt.Errorf("host %q has no label %d", host, seg.hostLabel)
+			}
+			value = labels[seg.hostLabel-1]
+		case seg.namespace:
+			if len(labels) < 2 || (len(labels) > 2 && labels[2] != "svc") {
+				return "", fmt.Errorf("host %q is not a Kubernetes service", host)
+			}
+			value = labels[1]
+		case seg.headerName != "":
+			value = requestHeaders(ctx)[seg.headerName]
+			if value == "" {
+				return "", fmt.Errorf("header %q required by template %q is missing", seg.headerName, t.source)
+			}
+		case seg.subject:
+			value = requestSubject(ctx)
+			if value == "" {
+				return "", fmt.Errorf("caller subject required by template %q is missing", t.source)
+			}
+		default:
+			b.WriteString(seg.literal)
+			continue
+		}
+		if !isSafeTemplateValue(value) {
+			return "", fmt.Errorf("value %q for template %q contains disallowed characters", value, t.source)
+		}
+		b.WriteString(value)
+	}
+	return b.String(), nil
+}
+
+func isSafeTemplateValue(v string) bool {
+	if v == "" {
+		return false
+	}
+	for _, r := range v {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+		case r == '.', r == '_', r == ':', r == '-':
+		default:
+			return false
+		}
+	}
+	return true
+}
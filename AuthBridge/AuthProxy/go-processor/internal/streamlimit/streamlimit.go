@@ -0,0 +1,175 @@
+// Package streamlimit bounds the gRPC streams the processor serves, so a
+// misbehaving Envoy or a burst of traffic cannot start an unbounded number of
+// token exchanges. Envoy opens one ext_proc stream per HTTP request, so
+// limiting streams limits the goroutines doing exchanges. Streams beyond the
+// limits are rejected with RESOURCE_EXHAUSTED before their handler runs.
+package streamlimit
+
+import (
+	"context"
+	"crypto/x509"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+
+	"github.com/kagenti/kagenti-extensions/AuthBridge/AuthProxy/internal/middleware"
+)
+
+// maxIdleClients is the number of per-client buckets kept before full ones,
+// i.e. of clients idle long enough to have regained their burst, are dropped.
+const maxIdleClients = 1024
+
+// Config sets the limits; a zero value disables a limit.
+type Config struct {
+	// MaxStreams caps the streams served at once across all clients.
+	MaxStreams int
+	// ClientRate is the number of new streams per second allowed per client,
+	// with bursts up to ClientBurst.
+	ClientRate  float64
+	ClientBurst int
+}
+
+// Limiter enforces a Config on the methods it is given.
+type Limiter struct {
+	cfg     Config
+	methods map[string]bool
+	slots   chan struct{}
+	now     func() time.Time
+
+	mu      sync.Mutex
+	clients map[string]*middleware.TokenBucket
+
+	rejectedConcurrency atomic.Uint64
+	rejectedRate        atomic.Uint64
+}
+
+// New returns a limiter applying cfg to streams of the given full method
+// names, e.g. "/envoy.service.ext_proc.v3.ExternalProcessor/Process". Other
+// methods, such as health checks, are not limited.
+func New(cfg Config, methods ...string) *Limiter {
+	l := &Limiter{cfg: cfg, methods: make(map[string]bool), now: time.Now, clients: make(map[string]*middleware.TokenBucket)}
+	for _, m := range methods {
+		l.methods[m] = true
+	}
+	if cfg.MaxStreams > 0 {
+		l.slots = make(chan struct{}, cfg.MaxStreams)
+	}
+	return l
+}
+
+// StreamInterceptor returns the interceptor to install with
+// grpc.StreamInterceptor.
+func (l *Limiter) StreamInterceptor() grpc.StreamServerInterceptor {
+	return func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		if !l.methods[info.FullMethod] {
+			return handler(srv, ss)
+		}
+		release, err := l.acquire(ss.Context())
+		if err != nil {
+			return err
+		}
+		defer release()
+		return handler(srv, ss)
+	}
+}
+
+// acquire admits a stream of the client of ctx, or returns a
+// RESOURCE_EXHAUSTED error.
+func (l *Limiter) acquire(ctx context.Context) (func(), error) {
+	if l.cfg.ClientRate > 0 {
+		client := ClientID(ctx)
+		if ok, wait := l.bucket(client).Take(l.now()); !ok {
+			l.rejectedRate.Add(1)
+			return nil, status.Errorf(codes.ResourceExhausted, "stream rate limit exceeded for %s, retry in %s", client, wait.Round(time.Millisecond))
+		}
+	}
+	if l.slots == nil {
+		return func() {}, nil
+	}
+	select {
+	case l.slots <- struct{}{}:
+		return func() { <-l.slots }, nil
+	default:
+		l.rejectedConcurrency.Add(1)
+		return nil, status.Errorf(codes.ResourceExhausted, "too many concurrent streams (limit %d)", l.cfg.MaxStreams)
+	}
+}
+
+func (l *Limiter) bucket(client string) *middleware.TokenBucket {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	b := l.clients[client]
+	if b != nil {
+		return b
+	}
+	if len(l.clients) >= maxIdleClients {
+		now := l.now()
+		for k, other := range l.clients {
+			if other.Full(now) {
+				delete(l.clients, k)
+			}
+		}
+	}
+	burst := l.cfg.ClientBurst
+	if burst < 1 {
+		burst = int(math.Max(1, math.Ceil(l.cfg.ClientRate)))
+	}
+	b = middleware.NewTokenBucket(l.cfg.ClientRate, burst)
+	l.clients[client] = b
+	return b
+}
+
+// Active returns the number of limited streams being served.
+func (l *Limiter) Active() int {
+	return len(l.slots)
+}
+
+// WriteMetrics writes the limiter's counters in Prometheus text format.
+func (l *Limiter) WriteMetrics(w io.Writer, prefix string) {
+	fmt.Fprintf(w, "# HELP %s_active Streams being served.\n", prefix)
+	fmt.Fprintf(w, "# TYPE %s_active gauge\n", prefix)
+	fmt.Fprintf(w, "%s_active %d\n", prefix, l.Active())
+	fmt.Fprintf(w, "# HELP %s_rejected_total Streams rejected with RESOURCE_EXHAUSTED.\n", prefix)
+	fmt.Fprintf(w, "# TYPE %s_rejected_total counter\n", prefix)
+	fmt.Fprintf(w, "%s_rejected_total{reason=\"concurrency\"} %d\n", prefix, l.rejectedConcurrency.Load())
+	fmt.Fprintf(w, "%s_rejected_total{reason=\"rate\"} %d\n", prefix, l.rejectedRate.Load())
+}
+
+// ClientID identifies the peer of a stream: the URI SAN (e.g. a SPIFFE ID)
+// or subject of its verified client certificate, else its IP address. Each
+// Envoy is one client, whatever the number of its connections.
+func ClientID(ctx context.Context) string {
+	p, ok := peer.FromContext(ctx)
+	if !ok {
+		return "unknown"
+	}
+	if tlsInfo, ok := p.AuthInfo.(credentials.TLSInfo); ok && len(tlsInfo.State.VerifiedChains) > 0 {
+		if id := certID(tlsInfo.State.VerifiedChains[0][0]); id != "" {
+			return id
+		}
+	}
+	if p.Addr == nil {
+		return "unknown"
+	}
+	if host, _, err := net.SplitHostPort(p.Addr.String()); err == nil {
+		return host
+	}
+	return p.Addr.String()
+}
+
+func certID(cert *x509.Certificate) string {
+	if len(cert.URIs) > 0 {
+		return cert.URIs[0].String()
+	}
+	return cert.Subject.String()
+}
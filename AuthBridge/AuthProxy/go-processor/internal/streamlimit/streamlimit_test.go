@@ -0,0 +1,114 @@
+package streamlimit
+
+import (
+	"context"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+const method = "/envoy.service.ext_proc.v3.ExternalProcessor/Process"
+
+type fakeStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *fakeStream) Context() context.Context { return s.ctx }
+
+func streamFrom(ip string) *fakeStream {
+	addr := &net.TCPAddr{IP: net.ParseIP(ip), Port: 40000}
+	return &fakeStream{ctx: peer.NewContext(context.Background(), &peer.Peer{Addr: addr})}
+}
+
+func call(l *Limiter, s grpc.ServerStream, fullMethod string, handler grpc.StreamHandler) error {
+	return l.StreamInterceptor()(nil, s, &grpc.StreamServerInfo{FullMethod: fullMethod}, handler)
+}
+
+func noop(any, grpc.ServerStream) error { return nil }
+
+func TestLimiter_MaxStreams(t *testing.T) {
+	l := New(Config{MaxStreams: 2}, method)
+	block, started := make(chan struct{}), make(chan struct{})
+	done := make(chan error, 2)
+	for i := 0; i < 2; i++ {
+		go func() {
+			done <- call(l, streamFrom("10.0.0.1"), method, func(any, grpc.ServerStream) error {
+				started <- struct{}{}
+				<-block
+				return nil
+			})
+		}()
+		<-started
+	}
+
+	err := call(l, streamFrom("10.0.0.2"), method, noop)
+	if status.Code(err) != codes.ResourceExhausted {
+		t.Fatalf("third stream: got %v, want RESOURCE_EXHAUSTED", err)
+	}
+	if err := call(l, streamFrom("10.0.0.2"), "/grpc.health.v1.Health/Watch", noop); err != nil {
+		t.Errorf("unlimited method rejected: %v", err)
+	}
+
+	close(block)
+	for i := 0; i < 2; i++ {
+		if err := <-done; err != nil {
+			t.Errorf("admitted stream: %v", err)
+		}
+	}
+	if err := call(l, streamFrom("10.0.0.2"), method, noop); err != nil {
+		t.Errorf("slot not released: %v", err)
+	}
+	if l.Active() != 0 {
+		t.Errorf("Active() = %d after all streams ended", l.Active())
+	}
+}
+
+func TestLimiter_ClientRate(t *testing.T) {
+	now := time.Unix(1000, 0)
+	l := New(Config{ClientRate: 1, ClientBurst: 2}, method)
+	l.now = func() time.Time { return now }
+
+	for i := 0; i < 2; i++ {
+		if err := call(l, streamFrom("10.0.0.1"), method, noop); err != nil {
+			t.Fatalf("stream %d within burst: %v", i, err)
+		}
+	}
+	err := call(l, streamFrom("10.0.0.1"), method, noop)
+	if status.Code(err) != codes.ResourceExhausted || !strings.Contains(err.Error(), "10.0.0.1") {
+		t.Fatalf("over the rate: got %v", err)
+	}
+	// Other clients have their own bucket
+	if err := call(l, streamFrom("10.0.0.2"), method, noop); err != nil {
+		t.Errorf("other client rejected: %v", err)
+	}
+
+	now = now.Add(time.Second)
+	if err := call(l, streamFrom("10.0.0.1"), method, noop); err != nil {
+		t.Errorf("after refill: %v", err)
+	}
+}
+
+func TestLimiter_Disabled(t *testing.T) {
+	l := New(Config{}, method)
+	for i := 0; i < 100; i++ {
+		if err := call(l, streamFrom("10.0.0.1"), method, noop); err != nil {
+			t.Fatalf("disabled limiter rejected stream %d: %v", i, err)
+		}
+	}
+}
+
+func TestClientID(t *testing.T) {
+	if got := ClientID(streamFrom("10.0.0.7").ctx); got != "10.0.0.7" {
+		t.Errorf("ClientID = %q", got)
+	}
+	if got := ClientID(context.Background()); got != "unknown" {
+		t.Errorf("ClientID without peer = %q", got)
+	}
+}
@@ -0,0 +1,361 @@
+// Package workloadapi fetches the workload's own SVIDs from the SPIFFE
+// Workload API exposed by the SPIRE agent socket, so the ext proc does not
+// depend on spiffe-helper writing them to files.
+//
+// Only the two calls the ext proc needs are implemented, FetchJWTSVID and
+// FetchX509SVID. Their messages are small, so they are encoded by hand with
+// protowire instead of pulling in generated stubs.
+package workloadapi
+
+import (
+	"context"
+	"crypto"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/lestrrat-go/jwx/v2/jwt"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+const (
+	fetchJWTSVIDMethod  = "/SpiffeWorkloadAPI/FetchJWTSVID"
+	fetchX509SVIDMethod = "/SpiffeWorkloadAPI/FetchX509SVID"
+	// securityHeader must be sent on every call; the agent rejects requests
+	// without it (SPIFFE Workload Endpoint spec, section 6.2).
+	securityHeader = "workload.spiffe.io"
+)
+
+// JWTSVID is a JWT-SVID and the expiry read from its exp claim.
+type JWTSVID struct {
+	SPIFFEID string
+	Token    string
+	Expiry   time.Time
+}
+
+// X509SVID is an X.509-SVID with its private key and trust bundle.
+type X509SVID struct {
+	SPIFFEID     string
+	Certificates []*x509.Certificate
+	PrivateKey   crypto.Signer
+	Bundle       []*x509.Certificate
+}
+
+// TLSCertificate returns the SVID as a TLS client or server certificate.
+func (s *X509SVID) TLSCertificate() *tls.Certificate {
+	cert := &tls.Certificate{PrivateKey: s.PrivateKey, Leaf: s.Certificates[0]}
+	for _, c := range s.Certificates {
+		cert.Certificate = append(cert.Certificate, c.Raw)
+	}
+	return cert
+}
+
+// Client calls the Workload API over a Unix domain socket.
+type Client struct {
+	conn *grpc.ClientConn
+}
+
+// New connects lazily to the agent socket, given as "unix:///path" or a plain
+// path (the SPIFFE_ENDPOINT_SOCKET convention).
+func New(socket string) (*Client, error) {
+	target := socket
+	if !strings.HasPrefix(target, "unix:") {
+		target = "unix://" + target
+	}
+	conn, err := grpc.NewClient(target,
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithDefaultCallOptions(grpc.ForceCodec(rawCodec{})))
+	if err != nil {
+		return nil, err
+	}
+	return &Client{conn: conn}, nil
+}
+
+// Close closes the connection to the agent.
+func (c *Client) Close() error {
+	return c.conn.Close()
+}
+
+func withSecurityHeader(ctx context.Context) context.Context {
+	return metadata.AppendToOutgoingContext(ctx, securityHeader, "true")
+}
+
+// FetchJWTSVID returns the workload's default JWT-SVID for audience.
+func (c *Client) FetchJWTSVID(ctx context.Context, audience string) (*JWTSVID, error) {
+	var req []byte
+	req = protowire.AppendTag(req, 1, protowire.BytesType)
+	req = protowire.AppendString(req, audience)
+
+	var resp []byte
+	if err := c.conn.Invoke(withSecurityHeader(ctx), fetchJWTSVIDMethod, &req, &resp); err != nil {
+		return nil, fmt.Errorf("fetch JWT-SVID: %w", err)
+	}
+	svid, err := parseJWTSVIDResponse(resp)
+	if err != nil {
+		return nil, fmt.Errorf("fetch JWT-SVID: %w", err)
+	}
+	return svid, nil
+}
+
+// FetchX509SVID returns the workload's default X.509-SVID: the first one in
+// the first message of the FetchX509SVID stream.
+func (c *Client) FetchX509SVID(ctx context.Context) (*X509SVID, error) {
+	ctx, cancel := context.WithCancel(withSecurityHeader(ctx))
+	defer cancel() // ends the stream; later updates are fetched on demand
+
+	stream, err := c.conn.NewStream(ctx, &grpc.StreamDesc{ServerStreams: true}, fetchX509SVIDMethod)
+	if err != nil {
+		return nil, fmt.Errorf("fetch X.509-SVID: %w", err)
+	}
+	req := []byte{}
+	if err := stream.SendMsg(&req); err != nil {
+		return nil, fmt.Errorf("fetch X.509-SVID: %w", err)
+	}
+	if err := stream.CloseSend(); err != nil {
+		return nil, fmt.Errorf("fetch X.509-SVID: %w", err)
+	}
+	var resp []byte
+	if err := stream.RecvMsg(&resp); err != nil {
+		return nil, fmt.Errorf("fetch X.509-SVID: %w", err)
+	}
+	svid, err := parseX509SVIDResponse(resp)
+	if err != nil {
+		return nil, fmt.Errorf("fetch X.509-SVID: %w", err)
+	}
+	return svid, nil
+}
+
+// parseJWTSVIDResponse decodes JWTSVIDResponse{repeated JWTSVID svids = 1}
+// and returns the first SVID; JWTSVID is {spiffe_id = 1, svid = 2}.
+func parseJWTSVIDResponse(b []byte) (*JWTSVID, error) {
+	msg, err := firstSubmessage(b, 1)
+	if err != nil {
+		return nil, err
+	}
+	svid := &JWTSVID{}
+	err = forEachField(msg, func(num protowire.Number, v []byte) {
+		switch num {
+		case 1:
+			svid.SPIFFEID = string(v)
+		case 2:
+			svid.Token = string(v)
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	if svid.Token == "" {
+		return nil, errors.New("response has an empty JWT-SVID")
+	}
+	token, err := jwt.ParseString(svid.Token, jwt.WithVerify(false), jwt.WithValidate(false))
+	if err != nil {
+		return nil, fmt.Errorf("parse JWT-SVID: %w", err)
+	}
+	svid.Expiry = token.Expiration()
+	return svid, nil
+}
+
+// parseX509SVIDResponse decodes X509SVIDResponse{repeated X509SVID svids = 1}
+// and returns the first SVID; X509SVID is {spiffe_id = 1, x509_svid = 2
+// (DER certificate chain), x509_svid_key = 3 (PKCS#8 DER), bundle = 4}.
+func parseX509SVIDResponse(b []byte) (*X509SVID, error) {
+	msg, err := firstSubmessage(b, 1)
+	if err != nil {
+		return nil, err
+	}
+	var spiffeID string
+	var chain, key, bundle []byte
+	err = forEachField(msg, func(num protowire.Number, v []byte) {
+		switch num {
+		case 1:
+			spiffeID = string(v)
+		case 2:
+			chain = v
+		case 3:
+			key = v
+		case 4:
+			bundle = v
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	svid := &X509SVID{SPIFFEID: spiffeID}
+	if svid.Certificates, err = x509.ParseCertificates(chain); err != nil {
+		return nil, fmt.Errorf("parse X.509-SVID: %w", err)
+	}
+	if len(svid.Certificates) == 0 {
+		return nil, errors.New("response has an empty X.509-SVID")
+	}
+	parsedKey, err := x509.ParsePKCS8PrivateKey(key)
+	if err != nil {
+		return nil, fmt.Errorf("parse X.509-SVID key: %w", err)
+	}
+	signer, ok := parsedKey.(crypto.Signer)
+	if !ok {
+		return nil, fmt.Errorf("unsupported X.509-SVID key type %T", parsedKey)
+	}
+	svid.PrivateKey = signer
+	if svid.Bundle, err = x509.ParseCertificates(bundle); err != nil {
+		return nil, fmt.Errorf("parse X.509 bundle: %w", err)
+	}
+	return svid, nil
+}
+
+// firstSubmessage returns the first length-delimited field num of b.
+func firstSubmessage(b []byte, num protowire.Number) ([]byte, error) {
+	var found []byte
+	err := forEachField(b, func(n protowire.Number, v []byte) {
+		if n == num && found == nil {
+			found = v
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	if found == nil {
+		return nil, errors.New("response has no SVIDs")
+	}
+	return found, nil
+}
+
+// forEachField calls fn for every length-delimited field of b and skips the
+// others.
+func forEachField(b []byte, fn func(protowire.Number, []byte)) error {
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			return fmt.Errorf("malformed response: %w", protowire.ParseError(n))
+		}
+		b = b[n:]
+		if typ == protowire.BytesType {
+			v, n := protowire.ConsumeBytes(b)
+			if n < 0 {
+				return fmt.Errorf("malformed response: %w", protowire.ParseError(n))
+			}
+			fn(num, v)
+			b = b[n:]
+			continue
+		}
+		n = protowire.ConsumeFieldValue(num, typ, b)
+		if n < 0 {
+			return fmt.Errorf("malformed response: %w", protowire.ParseError(n))
+		}
+		b = b[n:]
+	}
+	return nil
+}
+
+// rawCodec passes pre-encoded protobuf messages through as *[]byte.
+type rawCodec struct{}
+
+func (rawCodec) Marshal(v any) ([]byte, error) {
+	b, ok := v.(*[]byte)
+	if !ok {
+		return nil, fmt.Errorf("rawCodec: unexpected message type %T", v)
+	}
+	return *b, nil
+}
+
+func (rawCodec) Unmarshal(data []byte, v any) error {
+	b, ok := v.(*[]byte)
+	if !ok {
+		return fmt.Errorf("rawCodec: unexpected message type %T", v)
+	}
+	*b = append((*b)[:0], data...)
+	return nil
+}
+
+// Name keeps the standard content-type, application/grpc+proto.
+func (rawCodec) Name() string { return "proto" }
+
+// fetcher is the part of Client that Source uses.
+type fetcher interface {
+	FetchJWTSVID(ctx context.Context, audience string) (*JWTSVID, error)
+	FetchX509SVID(ctx context.Context) (*X509SVID, error)
+}
+
+// Source caches SVIDs and fetches new ones once half of their lifetime has
+// passed, as the agent rotates them well before they expire. When a refresh
+// fails, the cached SVID is served until it expires.
+type Source struct {
+	client fetcher
+	// Now is the clock; tests override it.
+	Now func() time.Time
+
+	mu   sync.Mutex
+	jwts map[string]*cachedJWT
+	x509 *X509SVID
+}
+
+type cachedJWT struct {
+	svid      *JWTSVID
+	fetchedAt time.Time
+}
+
+// NewSource returns a caching source backed by client.
+func NewSource(client *Client) *Source {
+	return newSource(client)
+}
+
+func newSource(client fetcher) *Source {
+	return &Source{client: client, Now: time.Now, jwts: make(map[string]*cachedJWT)}
+}
+
+// refreshDue reports whether more than half of the lifetime between issued
+// and expiry has passed.
+func refreshDue(now, issued, expiry time.Time) bool {
+	return !now.Before(issued.Add(expiry.Sub(issued) / 2))
+}
+
+// JWTSVID returns a JWT-SVID for audience.
+func (s *Source) JWTSVID(ctx context.Context, audience string) (*JWTSVID, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.Now()
+	cached := s.jwts[audience]
+	if cached != nil && !refreshDue(now, cached.fetchedAt, cached.svid.Expiry) {
+		return cached.svid, nil
+	}
+	svid, err := s.client.FetchJWTSVID(ctx, audience)
+	if err != nil {
+		if cached != nil && now.Before(cached.svid.Expiry) {
+			return cached.svid, nil
+		}
+		return nil, err
+	}
+	s.jwts[audience] = &cachedJWT{svid: svid, fetchedAt: now}
+	return svid, nil
+}
+
+// X509SVID returns the workload's X.509-SVID.
+func (s *Source) X509SVID(ctx context.Context) (*X509SVID, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.Now()
+	if s.x509 != nil {
+		leaf := s.x509.Certificates[0]
+		if !refreshDue(now, leaf.NotBefore, leaf.NotAfter) {
+			return s.x509, nil
+		}
+	}
+	svid, err := s.client.FetchX509SVID(ctx)
+	if err != nil {
+		if s.x509 != nil && now.Before(s.x509.Certificates[0].NotAfter) {
+			return s.x509, nil
+		}
+		return nil, err
+	}
+	s.x509 = svid
+	return svid, nil
+}
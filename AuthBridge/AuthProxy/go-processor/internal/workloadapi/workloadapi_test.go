@@ -0,0 +1,302 @@
+package workloadapi
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"math/big"
+	"net"
+	"net/url"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/lestrrat-go/jwx/v2/jwa"
+	"github.com/lestrrat-go/jwx/v2/jwt"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+const testSPIFFEID = "spiffe://example.org/ns/team1/sa/agent"
+
+func appendBytesField(b []byte, num protowire.Number, v []byte) []byte {
+	b = protowire.AppendTag(b, num, protowire.BytesType)
+	return protowire.AppendBytes(b, v)
+}
+
+func testJWT(t *testing.T, exp time.Time) string {
+	t.Helper()
+	token, err := jwt.NewBuilder().Subject(testSPIFFEID).Audience([]string{"kagenti"}).Expiration(exp).Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	signed, err := jwt.Sign(token, jwt.WithKey(jwa.HS256, []byte("test-key")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(signed)
+}
+
+func testCert(t *testing.T) (der, keyDER []byte) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	id, _ := url.Parse(testSPIFFEID)
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{Organization: []string{"SPIRE"}},
+		URIs:         []*url.URL{id},
+		NotBefore:    time.Now().Add(-time.Minute),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err = x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err = x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return der, keyDER
+}
+
+// fakeAgent serves the Workload API on a Unix socket. handle gets the method
+// and the raw request and returns the raw response.
+func fakeAgent(t *testing.T, handle func(method string, req []byte) ([]byte, error)) string {
+	t.Helper()
+	socket := filepath.Join(t.TempDir(), "agent.sock")
+	lis, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := grpc.NewServer(grpc.ForceServerCodec(rawCodec{}),
+		grpc.UnknownServiceHandler(func(_ any, stream grpc.ServerStream) error {
+			md, _ := metadata.FromIncomingContext(stream.Context())
+			if v := md.Get(securityHeader); len(v) != 1 || v[0] != "true" {
+				return status.Error(codes.InvalidArgument, "security header missing")
+			}
+			method, _ := grpc.MethodFromServerStream(stream)
+			var req []byte
+			if err := stream.RecvMsg(&req); err != nil {
+				return err
+			}
+			resp, err := handle(method, req)
+			if err != nil {
+				return err
+			}
+			return stream.SendMsg(&resp)
+		}))
+	go server.Serve(lis)
+	t.Cleanup(server.Stop)
+	return "unix://" + socket
+}
+
+func newTestClient(t *testing.T, socket string) *Client {
+	t.Helper()
+	c, err := New(socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { c.Close() })
+	return c
+}
+
+func TestFetchJWTSVID(t *testing.T) {
+	exp := time.Now().Add(5 * time.Minute).Truncate(time.Second)
+	token := testJWT(t, exp)
+	var gotAudience string
+	socket := fakeAgent(t, func(method string, req []byte) ([]byte, error) {
+		if method != fetchJWTSVIDMethod {
+			return nil, status.Error(codes.Unimplemented, method)
+		}
+		forEachField(req, func(num protowire.Number, v []byte) {
+			if num == 1 {
+				gotAudience = string(v)
+			}
+		})
+		var svid []byte
+		svid = appendBytesField(svid, 1, []byte(testSPIFFEID))
+		svid = appendBytesField(svid, 2, []byte(token))
+		return appendBytesField(nil, 1, svid), nil
+	})
+
+	got, err := newTestClient(t, socket).FetchJWTSVID(context.Background(), "kagenti")
+	if err != nil {
+		t.Fatalf("FetchJWTSVID: %v", err)
+	}
+	if gotAudience != "kagenti" {
+		t.Errorf("audience = %q, want kagenti", gotAudience)
+	}
+	if got.SPIFFEID != testSPIFFEID || got.Token != token {
+		t.Errorf("got %+v", got)
+	}
+	if !got.Expiry.Equal(exp) {
+		t.Errorf("expiry = %v, want %v", got.Expiry, exp)
+	}
+}
+
+func TestFetchX509SVID(t *testing.T) {
+	der, keyDER := testCert(t)
+	socket := fakeAgent(t, func(method string, req []byte) ([]byte, error) {
+		if method != fetchX509SVIDMethod {
+			return nil, status.Error(codes.Unimplemented, method)
+		}
+		var svid []byte
+		svid = appendBytesField(svid, 1, []byte(testSPIFFEID))
+		svid = appendBytesField(svid, 2, der)
+		svid = appendBytesField(svid, 3, keyDER)
+		svid = appendBytesField(svid, 4, der)
+		return appendBytesField(nil, 1, svid), nil
+	})
+
+	got, err := newTestClient(t, socket).FetchX509SVID(context.Background())
+	if err != nil {
+		t.Fatalf("FetchX509SVID: %v", err)
+	}
+	if got.SPIFFEID != testSPIFFEID || len(got.Certificates) != 1 || len(got.Bundle) != 1 {
+		t.Fatalf("got %+v", got)
+	}
+	if got.Certificates[0].URIs[0].String() != testSPIFFEID {
+		t.Errorf("certificate URI SAN = %v", got.Certificates[0].URIs)
+	}
+	cert := got.TLSCertificate()
+	if len(cert.Certificate) != 1 || cert.PrivateKey == nil || cert.Leaf == nil {
+		t.Errorf("TLSCertificate = %+v", cert)
+	}
+}
+
+func TestFetchErrors(t *testing.T) {
+	socket := fakeAgent(t, func(method string, req []byte) ([]byte, error) {
+		if method == fetchJWTSVIDMethod {
+			return nil, status.Error(codes.PermissionDenied, "no identity issued")
+		}
+		return []byte{}, nil // no SVIDs
+	})
+	c := newTestClient(t, socket)
+
+	_, err := c.FetchJWTSVID(context.Background(), "kagenti")
+	if status.Code(errors.Unwrap(err)) != codes.PermissionDenied {
+		t.Errorf("FetchJWTSVID error = %v, want PermissionDenied", err)
+	}
+	if _, err := c.FetchX509SVID(context.Background()); err == nil {
+		t.Error("FetchX509SVID: expected error for an empty response")
+	}
+}
+
+func TestFetchUnreachableSocket(t *testing.T) {
+	c := newTestClient(t, filepath.Join(t.TempDir(), "missing.sock"))
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if _, err := c.FetchJWTSVID(ctx, "kagenti"); err == nil {
+		t.Error("expected error for a missing socket")
+	}
+}
+
+type fakeFetcher struct {
+	jwtCalls, x509Calls int
+	jwt                 *JWTSVID
+	x509                *X509SVID
+	err                 error
+}
+
+func (f *fakeFetcher) FetchJWTSVID(context.Context, string) (*JWTSVID, error) {
+	f.jwtCalls++
+	if f.err != nil {
+		return nil, f.err
+	}
+	return f.jwt, nil
+}
+
+func (f *fakeFetcher) FetchX509SVID(context.Context) (*X509SVID, error) {
+	f.x509Calls++
+	if f.err != nil {
+		return nil, f.err
+	}
+	return f.x509, nil
+}
+
+func TestSourceJWTSVIDRefresh(t *testing.T) {
+	start := time.Unix(1_700_000_000, 0)
+	now := start
+	f := &fakeFetcher{}
+	s := newSource(f)
+	s.Now = func() time.Time { return now }
+	ctx := context.Background()
+
+	for _, step := range []struct {
+		at        time.Duration
+		wantCalls int
+	}{
+		{0, 1},
+		{4 * time.Minute, 1},                // cached
+		{5 * time.Minute, 2},                // half of the 10m lifetime has passed
+		{9*time.Minute + 59*time.Second, 2}, // within half of the new lifetime
+		{10 * time.Minute, 3},               // due again
+	} {
+		now = start.Add(step.at)
+		// The agent issues SVIDs valid for 10 minutes from now
+		f.jwt = &JWTSVID{Token: "t", Expiry: now.Add(10 * time.Minute)}
+		if _, err := s.JWTSVID(ctx, "kagenti"); err != nil {
+			t.Fatalf("at %v: %v", step.at, err)
+		}
+		if f.jwtCalls != step.wantCalls {
+			t.Fatalf("at %v: %d fetches, want %d", step.at, f.jwtCalls, step.wantCalls)
+		}
+	}
+}
+
+func TestSourceServesCachedSVIDWhenAgentFails(t *testing.T) {
+	start := time.Unix(1_700_000_000, 0)
+	now := start
+	f := &fakeFetcher{jwt: &JWTSVID{Token: "a", Expiry: start.Add(10 * time.Minute)}}
+	s := newSource(f)
+	s.Now = func() time.Time { return now }
+	ctx := context.Background()
+
+	if _, err := s.JWTSVID(ctx, "kagenti"); err != nil {
+		t.Fatal(err)
+	}
+	f.err = errors.New("agent restarting")
+	now = start.Add(8 * time.Minute)
+	got, err := s.JWTSVID(ctx, "kagenti")
+	if err != nil || got.Token != "a" {
+		t.Fatalf("got %v, %v; want the cached SVID", got, err)
+	}
+	now = start.Add(10 * time.Minute)
+	if _, err := s.JWTSVID(ctx, "kagenti"); err == nil {
+		t.Fatal("expected an error once the cached SVID expired")
+	}
+}
+
+func TestSourceX509SVIDRefresh(t *testing.T) {
+	start := time.Unix(1_700_000_000, 0)
+	now := start
+	leaf := &x509.Certificate{NotBefore: start, NotAfter: start.Add(time.Hour)}
+	f := &fakeFetcher{x509: &X509SVID{Certificates: []*x509.Certificate{leaf}}}
+	s := newSource(f)
+	s.Now = func() time.Time { return now }
+	ctx := context.Background()
+
+	if _, err := s.X509SVID(ctx); err != nil {
+		t.Fatal(err)
+	}
+	now = start.Add(20 * time.Minute)
+	s.X509SVID(ctx)
+	if f.x509Calls != 1 {
+		t.Fatalf("%d fetches before half of the lifetime, want 1", f.x509Calls)
+	}
+	now = start.Add(31 * time.Minute)
+	s.X509SVID(ctx)
+	if f.x509Calls != 2 {
+		t.Fatalf("%d fetches after half of the lifetime, want 2", f.x509Calls)
+	}
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	core "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
+	v3 "github.com/envoyproxy/go-control-plane/envoy/service/ext_proc/v3"
+	typev3 "github.com/envoyproxy/go-control-plane/envoy/type/v3"
+
+	"github.com/kagenti/kagenti-extensions/AuthBridge/AuthProxy/go-processor/internal/accesslog"
+	"github.com/kagenti/kagenti-extensions/AuthBridge/AuthProxy/go-processor/internal/introspection"
+	"github.com/kagenti/kagenti-extensions/AuthBridge/AuthProxy/go-processor/internal/resolver"
+)
+
+// globalIntrospectionURL is the introspection endpoint of introspect routes
+// without introspection_url (INTROSPECTION_URL).
+var globalIntrospectionURL string
+
+// loadIntrospectionConfig sets the RFC 7662 introspection endpoint
+// (INTROSPECTION_URL). Without it the endpoint is discovered with
+// OIDC_DISCOVERY, else TOKEN_URL + "/introspect" as in Keycloak.
+func loadIntrospectionConfig(endpoint string) {
+	globalIntrospectionURL = endpoint
+	if globalIntrospectionURL != "" {
+		exchangeLog.Info("Introspection endpoint", "introspection_url", globalIntrospectionURL)
+	}
+}
+
+// introspectionEndpoint returns the endpoint introspecting tokens of route,
+// whose token endpoint is tokenURL.
+func introspectionEndpoint(route *resolver.TargetConfig, tokenURL string) string {
+	if route.IntrospectionEndpoint != "" {
+		return route.IntrospectionEndpoint
+	}
+	if globalIntrospectionURL != "" {
+		return globalIntrospectionURL
+	}
+	// A route's own token endpoint may belong to another IdP than the issuer
+	if oidcDiscovery != nil && route.TokenEndpoint == "" {
+		if md := oidcDiscovery.Current(); md != nil && md.IntrospectionEndpoint != "" {
+			return md.IntrospectionEndpoint
+		}
+	}
+	if tokenURL == "" {
+		return ""
+	}
+	return introspection.Endpoint(tokenURL)
+}
+
+// introspectToken asks endpoint whether token is active, authenticating as
+// the ext proc's client.
+func introspectToken(ctx context.Context, clientID, clientSecret, endpoint, token string) (*introspection.Result, error) {
+	data := url.Values{}
+	if err := setClientAuth(ctx, data, clientID, clientSecret, endpoint); err != nil {
+		return nil, err
+	}
+	data.Set("token", token)
+	data.Set("token_type_hint", "access_token")
+
+	cb := exchangeBreakers.Get(endpoint)
+	if !cb.Allow() {
+		return nil, errCircuitOpen
+	}
+	resp, err := postTokenRequest(ctx, endpoint, data)
+	switch {
+	case ctx.Err() != nil:
+	case err != nil || resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500:
+		cb.Failure()
+	default:
+		cb.Success()
+	}
+	if err != nil {
+		return nil, fmt.Errorf("introspection request failed: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("introspection failed with status %d: %s", resp.StatusCode, string(resp.Body))
+	}
+	return introspection.Parse(resp.Body)
+}
+
+// introspectResponse introspects the caller's token on an introspect route
+// and adds the mapped claims of an active token to mutation. It returns nil
+// when the request may go on, to exchange or to be forwarded, and otherwise
+// the response rejecting it. Introspection is a check, so a token that is
+// missing, inactive or cannot be introspected is always rejected.
+func introspectResponse(ctx context.Context, headers []*core.HeaderValue, mutation *v3.HeaderMutation, route *resolver.TargetConfig,
+	requestHost, clientID, clientSecret, tokenURL, audience, scopes string) *v3.ProcessingResponse {
+	authHeader := getHeaderValue(headers, "authorization")
+	if authHeader == "" {
+		exchangeLog.Debug("No Authorization header to introspect", "host", requestHost)
+		return problemResponse(typev3.StatusCode_Unauthorized, "", "missing token", "subject_token_missing")
+	}
+	token := strings.TrimPrefix(authHeader, "Bearer ")
+	token = strings.TrimPrefix(token, "bearer ")
+	if token == authHeader {
+		return problemResponse(typev3.StatusCode_Unauthorized, errInvalidToken, "authorization header is not a bearer token", "subject_token_invalid")
+	}
+
+	auditFrom(ctx).subjectToken(token, clientID)
+
+	endpoint := introspectionEndpoint(route, tokenURL)
+	if endpoint == "" || !hasClientCredentials(clientID, clientSecret) {
+		exchangeLog.Warn("Introspection not configured", "host", requestHost, "introspection_url_set", endpoint != "", "client_id_set", clientID != "")
+		return problemResponse(typev3.StatusCode_ServiceUnavailable, "", "token introspection not configured", "introspection_not_configured")
+	}
+
+	result, err := introspectToken(ctx, clientID, clientSecret, endpoint, token)
+	if err != nil {
+		recordExchange(ctx, headers, requestHost, audience, scopes, accesslog.OutcomeFailed)
+		if errors.Is(err, errCircuitOpen) {
+			return problemResponse(typev3.StatusCode_ServiceUnavailable, "", "token endpoint unavailable", "token_endpoint_circuit_open")
+		}
+		exchangeLog.Error("Token introspection failed", "host", requestHost, "introspection_url", endpoint, "error", err)
+		return problemResponse(typev3.StatusCode_BadGateway, "", "token introspection failed", "introspection_failed")
+	}
+	if !result.Active {
+		exchangeLog.Info("Introspected token is not active", "host", requestHost)
+		recordExchange(ctx, headers, requestHost, audience, scopes, accesslog.OutcomeDenied)
+		return problemResponse(typev3.StatusCode_Unauthorized, errInvalidToken, "token is not active", "token_inactive")
+	}
+
+	mapping := route.IntrospectionHeaders
+	if len(mapping) == 0 {
+		mapping = introspection.DefaultHeaders
+	}
+	set, remove := introspection.Headers(result.Claims, mapping)
+	for _, h := range set {
+		mutation.SetHeaders = append(mutation.SetHeaders, &core.HeaderValueOption{
+			Header: &core.HeaderValue{Key: h.Name, RawValue: []byte(h.Value)},
+		})
+	}
+	mutation.RemoveHeaders = append(mutation.RemoveHeaders, remove...)
+	exchangeLog.Debug("Token introspected", "host", requestHost, "sub", result.Claims["sub"], "headers", len(set))
+	return nil
+}
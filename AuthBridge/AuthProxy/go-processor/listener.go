@@ -0,0 +1,131 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+)
+
+// listenerEnv holds the defaults of the listener flags.
+type listenerEnv struct {
+	Address      string `env:"LISTEN_ADDRESS" default:":9090" doc:"gRPC listen addresses, comma-separated: host:port, [ipv6]:port or unix:///path/to/socket; overridden by -listen"`
+	CertFile     string `env:"TLS_CERT_FILE" doc:"Server certificate; enables TLS together with TLS_KEY_FILE; overridden by -tls-cert"`
+	KeyFile      string `env:"TLS_KEY_FILE" doc:"Server private key; overridden by -tls-key"`
+	ClientCAFile string `env:"TLS_CLIENT_CA_FILE" doc:"CA bundle for verifying client certificates; enables mTLS; overridden by -tls-client-ca"`
+}
+
+// Listener settings. Each flag defaults to its environment variable, so the
+// sidecar can be configured either way.
+var (
+	startupListenerEnv = decodeStartupEnv[listenerEnv]()
+
+	listenAddress = flag.String("listen", startupListenerEnv.Address,
+		`gRPC listen addresses, comma-separated: "host:port", "[ipv6]:port" or "unix:///path/to/socket" (env LISTEN_ADDRESS)`)
+	tlsCertFile = flag.String("tls-cert", startupListenerEnv.CertFile,
+		"server certificate; enables TLS together with -tls-key (env TLS_CERT_FILE)")
+	tlsKeyFile = flag.String("tls-key", startupListenerEnv.KeyFile,
+		"server private key (env TLS_KEY_FILE)")
+	tlsClientCAFile = flag.String("tls-client-ca", startupListenerEnv.ClientCAFile,
+		"CA bundle for verifying client certificates; enables mTLS (env TLS_CLIENT_CA_FILE)")
+)
+
+// serverOptions returns the gRPC server options for the configured TLS mode:
+// plaintext, TLS, or mTLS when a client CA is set.
+func serverOptions() ([]grpc.ServerOption, error) {
+	if *tlsCertFile == "" && *tlsKeyFile == "" {
+		if *tlsClientCAFile != "" {
+			return nil, errors.New("TLS_CLIENT_CA_FILE requires TLS_CERT_FILE and TLS_KEY_FILE")
+		}
+		return nil, nil
+	}
+	if *tlsCertFile == "" || *tlsKeyFile == "" {
+		return nil, errors.New("TLS_CERT_FILE and TLS_KEY_FILE must be set together")
+	}
+
+	cert := &reloadingCert{certFile: *tlsCertFile, keyFile: *tlsKeyFile}
+	if _, err := cert.get(nil); err != nil {
+		return nil, err
+	}
+	cfg := &tls.Config{
+		MinVersion:     tls.VersionTLS12,
+		GetCertificate: cert.get,
+	}
+	if *tlsClientCAFile != "" {
+		pem, err := os.ReadFile(*tlsClientCAFile)
+		if err != nil {
+			return nil, fmt.Errorf("read client CA: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in %s", *tlsClientCAFile)
+		}
+		cfg.ClientCAs = pool
+		cfg.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	return []grpc.ServerOption{grpc.Creds(credentials.NewTLS(cfg))}, nil
+}
+
+// reloadingCert re-reads the key pair when the certificate file changes, so
+// rotated certificates (e.g. from cert-manager) are used without a restart.
+type reloadingCert struct {
+	certFile, keyFile string
+
+	mu      sync.Mutex
+	modTime time.Time
+	cert    *tls.Certificate
+}
+
+func (c *reloadingCert) get(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	return c.load()
+}
+
+// getClient is get for tls.Config.GetClientCertificate.
+func (c *reloadingCert) getClient(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+	return c.load()
+}
+
+func (c *reloadingCert) load() (*tls.Certificate, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	info, err := os.Stat(c.certFile)
+	if err != nil {
+		if c.cert != nil {
+			return c.cert, nil
+		}
+		return nil, fmt.Errorf("stat certificate: %w", err)
+	}
+	if c.cert != nil && info.ModTime().Equal(c.modTime) {
+		return c.cert, nil
+	}
+	cert, err := tls.LoadX509KeyPair(c.certFile, c.keyFile)
+	if err != nil {
+		if c.cert != nil {
+			// Mid-rotation; keep serving the previous pair
+			return c.cert, nil
+		}
+		return nil, fmt.Errorf("load key pair: %w", err)
+	}
+	c.cert, c.modTime = &cert, info.ModTime()
+	return c.cert, nil
+}
+
+// tlsMode describes the server's transport security for logging.
+func tlsMode() string {
+	switch {
+	case *tlsClientCAFile != "":
+		return "mtls"
+	case *tlsCertFile != "":
+		return "tls"
+	default:
+		return "plaintext"
+	}
+}
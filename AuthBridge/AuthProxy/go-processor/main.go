@@ -3,18 +3,19 @@ package main
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
-	"io"
-	"log"
-	"net"
 	"net/http"
 	"net/url"
 	"os"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
 
 	core "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
+	extprocfilter "github.com/envoyproxy/go-control-plane/envoy/extensions/filters/http/ext_proc/v3"
 	v3 "github.com/envoyproxy/go-control-plane/envoy/service/ext_proc/v3"
 	typev3 "github.com/envoyproxy/go-control-plane/envoy/type/v3"
 	"github.com/lestrrat-go/jwx/v2/jwk"
@@ -23,6 +24,11 @@ import (
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
 
+	"github.com/kagenti/kagenti-extensions/AuthBridge/AuthProxy/go-processor/internal/accesslog"
+	"github.com/kagenti/kagenti-extensions/AuthBridge/AuthProxy/go-processor/internal/claims"
+	"github.com/kagenti/kagenti-extensions/AuthBridge/AuthProxy/go-processor/internal/idp"
+	"github.com/kagenti/kagenti-extensions/AuthBridge/AuthProxy/go-processor/internal/listener"
+	"github.com/kagenti/kagenti-extensions/AuthBridge/AuthProxy/go-processor/internal/policy"
 	"github.com/kagenti/kagenti-extensions/AuthBridge/AuthProxy/go-processor/internal/resolver"
 )
 
@@ -48,10 +54,20 @@ type tokenExchangeResponse struct {
 	ExpiresIn   int    `json:"expires_in"`
 }
 
-const defaultRoutesConfigPath = "/etc/authproxy/routes.yaml"
-
 var globalResolver resolver.TargetResolver
 
+// policyHooks run around every outbound exchange; see internal/policy.
+var policyHooks policy.Chain
+
+// policyHooksFailOpen lets exchanges proceed when a policy hook fails rather
+// than denies; by default the request is denied.
+var policyHooksFailOpen bool
+
+// deadlineHeader carries the remaining request budget in milliseconds to the
+// target service. Configurable via DEADLINE_HEADER or the control headers
+// file, where it can also be disabled.
+var deadlineHeader = "x-request-timeout-ms"
+
 // readFileContent reads the content of a file, trimming whitespace
 func readFileContent(path string) (string, error) {
 	content, err := os.ReadFile(path)
@@ -64,66 +80,52 @@ func readFileContent(path string) (string, error) {
 // loadConfig loads configuration from environment variables or files.
 // For dynamic credentials from client-registration, it reads from /shared/ files.
 // Retries loading credentials from files if they're not immediately available.
-func loadConfig() {
+func loadConfig(env processorEnv) {
 	globalConfig.mu.Lock()
 	defer globalConfig.mu.Unlock()
 
 	// Static configuration from environment variables
-	globalConfig.TokenURL = os.Getenv("TOKEN_URL")
-	globalConfig.TargetAudience = os.Getenv("TARGET_AUDIENCE")
-	globalConfig.TargetScopes = os.Getenv("TARGET_SCOPES")
+	globalConfig.TokenURL = env.TokenURL
+	globalConfig.TargetAudience = env.TargetAudience
+	globalConfig.TargetScopes = env.TargetScopes
 
 	// For CLIENT_ID and CLIENT_SECRET, prefer files from /shared/ (dynamic credentials)
 	// This allows AuthProxy to use the same credentials as the auto-registered client
-	clientIDFile := os.Getenv("CLIENT_ID_FILE")
-	if clientIDFile == "" {
-		clientIDFile = "/shared/client-id.txt"
-	}
-	clientSecretFile := os.Getenv("CLIENT_SECRET_FILE")
-	if clientSecretFile == "" {
-		clientSecretFile = "/shared/client-secret.txt"
-	}
+	clientIDFile, clientSecretFile := env.Credentials.ClientIDFile, env.Credentials.ClientSecretFile
 
 	// Try to load from files first (preferred for SPIFFE-based dynamic credentials)
 	if clientID, err := readFileContent(clientIDFile); err == nil && clientID != "" {
 		globalConfig.ClientID = clientID
-		log.Printf("[Config] Loaded CLIENT_ID from file: %s", clientIDFile)
-	} else if envClientID := os.Getenv("CLIENT_ID"); envClientID != "" {
+		configLog.Info("Loaded CLIENT_ID from file", "file", clientIDFile)
+	} else if envClientID := env.ClientID; envClientID != "" {
 		// Fall back to environment variable
 		globalConfig.ClientID = envClientID
-		log.Printf("[Config] Using CLIENT_ID from environment variable")
+		configLog.Info("Using CLIENT_ID from environment variable")
 	}
 
 	if clientSecret, err := readFileContent(clientSecretFile); err == nil && clientSecret != "" {
 		globalConfig.ClientSecret = clientSecret
-		log.Printf("[Config] Loaded CLIENT_SECRET from file: %s", clientSecretFile)
-	} else if envClientSecret := os.Getenv("CLIENT_SECRET"); envClientSecret != "" {
+		configLog.Info("Loaded CLIENT_SECRET from file", "file", clientSecretFile)
+	} else if envClientSecret := env.ClientSecret; envClientSecret != "" {
 		// Fall back to environment variable
 		globalConfig.ClientSecret = envClientSecret
-		log.Printf("[Config] Using CLIENT_SECRET from environment variable")
+		configLog.Info("Using CLIENT_SECRET from environment variable")
 	}
 
-	log.Printf("[Config] Configuration loaded:")
-	log.Printf("[Config]   CLIENT_ID: %s", globalConfig.ClientID)
-	log.Printf("[Config]   CLIENT_SECRET: [REDACTED, length=%d]", len(globalConfig.ClientSecret))
-	log.Printf("[Config]   TOKEN_URL: %s", globalConfig.TokenURL)
-	log.Printf("[Config]   TARGET_AUDIENCE: %s", globalConfig.TargetAudience)
-	log.Printf("[Config]   TARGET_SCOPES: %s", globalConfig.TargetScopes)
+	configLog.Info("Configuration loaded",
+		"client_id", globalConfig.ClientID,
+		"client_secret_set", globalConfig.ClientSecret != "",
+		"token_url", globalConfig.TokenURL,
+		"target_audience", globalConfig.TargetAudience,
+		"target_scopes", globalConfig.TargetScopes)
 }
 
 // waitForCredentials waits for credential files to be available
 // This handles the case where client-registration hasn't finished yet
-func waitForCredentials(maxWait time.Duration) bool {
-	clientIDFile := os.Getenv("CLIENT_ID_FILE")
-	if clientIDFile == "" {
-		clientIDFile = "/shared/client-id.txt"
-	}
-	clientSecretFile := os.Getenv("CLIENT_SECRET_FILE")
-	if clientSecretFile == "" {
-		clientSecretFile = "/shared/client-secret.txt"
-	}
+func waitForCredentials(env credentialsEnv, maxWait time.Duration) bool {
+	clientIDFile, clientSecretFile := env.ClientIDFile, env.ClientSecretFile
 
-	log.Printf("[Config] Waiting for credential files (max %v)...", maxWait)
+	configLog.Info("Waiting for credential files", "max_wait", maxWait)
 	deadline := time.Now().Add(maxWait)
 
 	for time.Now().Before(deadline) {
@@ -131,16 +133,16 @@ func waitForCredentials(maxWait time.Duration) bool {
 		clientID, err1 := readFileContent(clientIDFile)
 		clientSecret, err2 := readFileContent(clientSecretFile)
 
-		if err1 == nil && err2 == nil && clientID != "" && clientSecret != "" {
-			log.Printf("[Config] Credential files are ready")
+		if err1 == nil && (err2 == nil || clientAuthMethod != clientSecretPost) && hasClientCredentials(clientID, clientSecret) {
+			configLog.Info("Credential files are ready")
 			return true
 		}
 
-		log.Printf("[Config] Credentials not ready yet, waiting...")
+		configLog.Debug("Credentials not ready yet, waiting")
 		time.Sleep(2 * time.Second)
 	}
 
-	log.Printf("[Config] Timeout waiting for credentials, will use environment variables if available")
+	configLog.Warn("Timeout waiting for credentials, will use environment variables if available")
 	return false
 }
 
@@ -156,6 +158,7 @@ var (
 	inboundJWKSURL   string
 	inboundIssuer    string
 	expectedAudience string
+	claimRules       []claims.Rule
 )
 
 // deriveJWKSURL derives the JWKS URL from the token endpoint URL.
@@ -172,31 +175,35 @@ func initJWKSCache(jwksURL string) {
 	ctx := context.Background()
 	jwksCache = jwk.NewCache(ctx)
 	if err := jwksCache.Register(jwksURL); err != nil {
-		log.Printf("[Inbound] Failed to register JWKS URL %s: %v", jwksURL, err)
+		inboundLog.Error("Failed to register JWKS URL", "jwks_url", jwksURL, "error", err)
 		return
 	}
-	log.Printf("[Inbound] JWKS cache initialized with URL: %s", jwksURL)
+	inboundLog.Info("JWKS cache initialized", "jwks_url", jwksURL)
 }
 
-// validateInboundJWT validates a JWT token for inbound requests.
-func validateInboundJWT(tokenString, jwksURL, expectedIssuer string) error {
-	if jwksCache == nil {
-		return fmt.Errorf("JWKS cache not initialized")
+// validateInboundJWT validates a JWT token for inbound requests and returns
+// it.
+func validateInboundJWT(cache *jwk.Cache, tokenString, jwksURL, expectedIssuer string) (jwt.Token, error) {
+	if cache == nil {
+		return nil, fmt.Errorf("JWKS cache not initialized")
+	}
+	if jwksURL == "" {
+		return nil, fmt.Errorf("JWKS URL not discovered yet")
 	}
 
 	ctx := context.Background()
-	keySet, err := jwksCache.Get(ctx, jwksURL)
+	keySet, err := cache.Get(ctx, jwksURL)
 	if err != nil {
-		return fmt.Errorf("failed to fetch JWKS: %w", err)
+		return nil, fmt.Errorf("failed to fetch JWKS: %w", err)
 	}
 
 	token, err := jwt.Parse([]byte(tokenString), jwt.WithKeySet(keySet), jwt.WithValidate(true))
 	if err != nil {
-		return fmt.Errorf("failed to parse/validate token: %w", err)
+		return nil, fmt.Errorf("failed to parse/validate token: %w", err)
 	}
 
 	if token.Issuer() != expectedIssuer {
-		return fmt.Errorf("invalid issuer: expected %s, got %s", expectedIssuer, token.Issuer())
+		return nil, fmt.Errorf("invalid issuer: expected %s, got %s", expectedIssuer, token.Issuer())
 	}
 
 	// Validate audience if EXPECTED_AUDIENCE is configured.
@@ -204,37 +211,54 @@ func validateInboundJWT(tokenString, jwksURL, expectedIssuer string) error {
 	// - Set EXPECTED_AUDIENCE for strict zero-trust validation
 	// - Leave unset if audience validation is handled elsewhere (e.g., downstream service)
 	// - In service mesh scenarios, the audience might vary based on routing
-	if expectedAudience != "" {
+	// In MCP authorization mode tokens bound to MCP_RESOURCE (RFC 8707
+	// resource indicator) are accepted too, and some audience is required.
+	if expectedAudience != "" || mcpAuth != nil {
 		audiences := token.Audience()
-		audienceValid := false
+		audienceValid := mcpAuth != nil && mcpAuth.AudienceMatches(audiences)
 		for _, aud := range audiences {
-			if aud == expectedAudience {
+			if expectedAudience != "" && aud == expectedAudience {
 				audienceValid = true
 				break
 			}
 		}
 		if !audienceValid {
-			return fmt.Errorf("invalid audience: expected %s, got %v", expectedAudience, audiences)
+			expected := expectedAudience
+			switch {
+			case mcpAuth != nil && expected != "":
+				expected += " or " + mcpAuth.Resource
+			case mcpAuth != nil:
+				expected = mcpAuth.Resource
+			}
+			return nil, fmt.Errorf("invalid audience: expected %s, got %v", expected, audiences)
 		}
 	}
 
-	log.Printf("[Inbound] Token validated - issuer: %s, audience: %v", token.Issuer(), token.Audience())
-	return nil
+	// Claim assertions run only after signature, issuer, and audience checks
+	if rules := getClaimRules(); len(rules) > 0 {
+		tokenClaims, err := token.AsMap(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read token claims: %w", err)
+		}
+		if err := claims.Evaluate(rules, tokenClaims); err != nil {
+			return nil, err
+		}
+	}
+
+	inboundLog.Debug("Token validated", "issuer", token.Issuer(), "audience", token.Audience())
+	return token, nil
 }
 
-// denyRequest returns a ProcessingResponse that sends a 401 Unauthorized to the client.
-func denyRequest(message string) *v3.ProcessingResponse {
-	return &v3.ProcessingResponse{
-		Response: &v3.ProcessingResponse_ImmediateResponse{
-			ImmediateResponse: &v3.ImmediateResponse{
-				Status: &typev3.HttpStatus{
-					Code: typev3.StatusCode_Unauthorized,
-				},
-				Body:    []byte(fmt.Sprintf(`{"error":"unauthorized","message":"%s"}`, message)),
-				Details: "jwt_validation_failed",
-			},
-		},
-	}
+// denyRequest returns a ProcessingResponse that sends a 401 Unauthorized to
+// the client. errorCode is an RFC 6750 code, empty when no token was sent.
+func denyRequest(errorCode, message string) *v3.ProcessingResponse {
+	return problemResponse(typev3.StatusCode_Unauthorized, errorCode, message, "jwt_validation_failed")
+}
+
+// forbidRequest returns a ProcessingResponse that sends a 403 Forbidden to the client.
+// Used when the token is valid but its claims are not allowed through.
+func forbidRequest(errorCode, message, details string) *v3.ProcessingResponse {
+	return problemResponse(typev3.StatusCode_Forbidden, errorCode, message, details)
 }
 
 // getHostFromHeaders extracts host from :authority (HTTP/2) or Host header
@@ -245,54 +269,200 @@ func getHostFromHeaders(headers []*core.HeaderValue) string {
 	return getHeaderValue(headers, "host")
 }
 
+// headerMap flattens request headers into a lower-cased name -> value map,
+// keeping the first value like getHeaderValue.
+func headerMap(headers []*core.HeaderValue) map[string]string {
+	m := make(map[string]string, len(headers))
+	for _, h := range headers {
+		key := strings.ToLower(h.Key)
+		if _, ok := m[key]; !ok {
+			m[key] = string(h.RawValue)
+		}
+	}
+	return m
+}
+
+// isUpgradeRequest reports whether the request opens a long-lived tunnel:
+// an HTTP/1.1 Upgrade (e.g. WebSocket) or a CONNECT request, including
+// extended CONNECT (RFC 8441) used for WebSocket over HTTP/2.
+func isUpgradeRequest(headers []*core.HeaderValue) bool {
+	if strings.EqualFold(getHeaderValue(headers, ":method"), http.MethodConnect) {
+		return true
+	}
+	if getHeaderValue(headers, "upgrade") == "" {
+		return false
+	}
+	for _, token := range strings.Split(getHeaderValue(headers, "connection"), ",") {
+		if strings.EqualFold(strings.TrimSpace(token), "upgrade") {
+			return true
+		}
+	}
+	return false
+}
+
+// upgradeModeOverride tells Envoy not to send body or trailer phases for the
+// rest of the stream. Once the handshake is forwarded the stream carries
+// opaque frames, so the token exchanged for the handshake covers the whole
+// connection. Envoy only honors the override when the ext_proc filter is
+// configured with allow_mode_override: true.
+func upgradeModeOverride() *extprocfilter.ProcessingMode {
+	return &extprocfilter.ProcessingMode{
+		RequestHeaderMode:   extprocfilter.ProcessingMode_SEND,
+		ResponseHeaderMode:  extprocfilter.ProcessingMode_SKIP,
+		RequestBodyMode:     extprocfilter.ProcessingMode_NONE,
+		ResponseBodyMode:    extprocfilter.ProcessingMode_NONE,
+		RequestTrailerMode:  extprocfilter.ProcessingMode_SKIP,
+		ResponseTrailerMode: extprocfilter.ProcessingMode_SKIP,
+	}
+}
+
 // exchangeToken performs OAuth 2.0 Token Exchange (RFC 8693).
 // Exchanges the subject token for a new token with the specified audience.
 // Requires the exchanging client to be in the subject token's audience.
 // When using dynamic credentials from /shared/, this works because the token's
 // audience matches the auto-registered client's SPIFFE ID.
-func exchangeToken(clientID, clientSecret, tokenURL, subjectToken, audience, scopes string) (string, error) {
-	log.Printf("[Token Exchange] Starting token exchange")
-	log.Printf("[Token Exchange] Token URL: %s", tokenURL)
-	log.Printf("[Token Exchange] Client ID: %s", clientID)
-	log.Printf("[Token Exchange] Audience: %s", audience)
-	log.Printf("[Token Exchange] Scopes: %s", scopes)
+//
+// Returns the IdP's response: the new access token, its type (DPoP when
+// bound to dpopProofer's key) and its lifetime in seconds (0 if not
+// reported).
+func exchangeToken(ctx context.Context, clientID, clientSecret, tokenURL, subjectToken, subjectTokenType, audience, scopes string) (tokenExchangeResponse, error) {
+	exchangeLog.Debug("Starting token exchange",
+		"token_url", tokenURL, "client_id", clientID, "audience", audience, "scopes", scopes)
 
 	data := url.Values{}
-	data.Set("client_id", clientID)
-	data.Set("client_secret", clientSecret)
+	if err := setClientAuth(ctx, data, clientID, clientSecret, tokenURL); err != nil {
+		return tokenExchangeResponse{}, err
+	}
 	data.Set("grant_type", "urn:ietf:params:oauth:grant-type:token-exchange")
-	data.Set("requested_token_type", "urn:ietf:params:oauth:token-type:access_token")
+	data.Set("requested_token_type", tokenTypeAccessToken)
 	data.Set("subject_token", subjectToken)
-	data.Set("subject_token_type", "urn:ietf:params:oauth:token-type:access_token")
+	data.Set("subject_token_type", subjectTokenType)
+	if err := setActorToken(ctx, data); err != nil {
+		return tokenExchangeResponse{}, err
+	}
 	data.Set("audience", audience)
 	data.Set("scope", scopes)
 
-	resp, err := http.PostForm(tokenURL, data)
-	if err != nil {
-		log.Printf("[Token Exchange] Failed to make request: %v", err)
-		return "", err
+	cb := exchangeBreakers.Get(tokenURL)
+	if !cb.Allow() {
+		return tokenExchangeResponse{}, errCircuitOpen
+	}
+	start := time.Now()
+	resp, err := postTokenRequest(ctx, tokenURL, data)
+	exchangeDurations.observe(ctx, time.Since(start), exchangeOutcome(resp, err))
+	switch {
+	case ctx.Err() != nil:
+		// The caller went away; this says nothing about the token endpoint
+	case err != nil || resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500:
+		cb.Failure()
+	default:
+		cb.Success()
 	}
-	defer resp.Body.Close()
-
-	body, err := io.ReadAll(resp.Body)
 	if err != nil {
-		log.Printf("[Token Exchange] Failed to read response: %v", err)
-		return "", err
+		exchangeLog.Error("Token exchange request failed", "error", err)
+		return tokenExchangeResponse{}, err
 	}
 
 	if resp.StatusCode != http.StatusOK {
-		log.Printf("[Token Exchange] Failed with status %d: %s", resp.StatusCode, string(body))
-		return "", status.Errorf(codes.Internal, "token exchange failed: %s", string(body))
+		exchangeLog.Error("Token exchange rejected", "status", resp.StatusCode, "response", string(resp.Body))
+		return tokenExchangeResponse{}, status.Errorf(codes.Internal, "token exchange failed: %s", string(resp.Body))
 	}
 
 	var tokenResp tokenExchangeResponse
-	if err := json.Unmarshal(body, &tokenResp); err != nil {
-		log.Printf("[Token Exchange] Failed to parse response: %v", err)
-		return "", err
+	if err := json.Unmarshal(resp.Body, &tokenResp); err != nil {
+		exchangeLog.Error("Failed to parse token exchange response", "error", err)
+		return tokenExchangeResponse{}, err
+	}
+
+	exchangeLog.Debug("Token exchange response received", "token_type", tokenResp.TokenType)
+	return tokenResp, nil
+}
+
+// applyUpstreamTimeout bounds the upstream request by the route timeout and
+// tells the target how much time it has left. If the caller already sent a
+// shorter deadline (e.g. from an earlier hop), that deadline wins.
+func applyUpstreamTimeout(mutation *v3.HeaderMutation, headers []*core.HeaderValue, routeTimeout time.Duration) {
+	timeoutMs := routeTimeout.Milliseconds()
+	if deadlineHeader == "" {
+		mutation.SetHeaders = append(mutation.SetHeaders, &core.HeaderValueOption{
+			Header: &core.HeaderValue{Key: "x-envoy-upstream-rq-timeout-ms", RawValue: []byte(strconv.FormatInt(timeoutMs, 10))},
+		})
+		return
 	}
+	if incoming, err := strconv.ParseInt(getHeaderValue(headers, deadlineHeader), 10, 64); err == nil && incoming > 0 && incoming < timeoutMs {
+		timeoutMs = incoming
+	}
+	value := []byte(strconv.FormatInt(timeoutMs, 10))
+	streamLog.Debug("Upstream timeout", "timeout_ms", timeoutMs, "route", routeTimeout)
+
+	mutation.SetHeaders = append(mutation.SetHeaders,
+		// Envoy's router enforces this as the upstream request timeout
+		&core.HeaderValueOption{
+			Header: &core.HeaderValue{Key: "x-envoy-upstream-rq-timeout-ms", RawValue: value},
+		},
+		&core.HeaderValueOption{
+			Header: &core.HeaderValue{Key: deadlineHeader, RawValue: value},
+		},
+	)
+}
+
+// restrictScopes returns the scopes from requested that also appear in allowed,
+// preserving the requested order and dropping duplicates.
+func restrictScopes(requested, allowed string) string {
+	allowedSet := make(map[string]bool)
+	for _, scope := range strings.Fields(allowed) {
+		allowedSet[scope] = true
+	}
+
+	var kept []string
+	for _, scope := range strings.Fields(requested) {
+		if allowedSet[scope] {
+			kept = append(kept, scope)
+			delete(allowedSet, scope)
+		}
+	}
+	return strings.Join(kept, " ")
+}
+
+// scopesExceededResponse rejects a request none of whose scopes the route's
+// max_scopes allows.
+func scopesExceededResponse(ctx context.Context, headers []*core.HeaderValue, host, audience, maxScopes string) *v3.ProcessingResponse {
+	resolverLog.Info("No requested scope is allowed by max_scopes, denying", "host", host, "max_scopes", maxScopes)
+	traceStep(ctx, "No requested scope allowed by max_scopes", "max_scopes", maxScopes)
+	recordExchange(ctx, headers, host, audience, "", accesslog.OutcomeDenied)
+	return forbidRequest(errInsufficientScope, "requested scopes exceed max_scopes", "scopes_not_allowed")
+}
 
-	log.Printf("[Token Exchange] Successfully exchanged token")
-	return tokenResp.AccessToken, nil
+// tokenScopes returns the scopes of a token from its space-separated scope
+// claim, or the scp claim some IdPs issue instead, without verifying it.
+// It returns nil for non-JWTs, such as opaque or introspected tokens, and
+// tokens without either claim, whose scopes are unknown, and an empty slice
+// for a claim without scopes.
+func tokenScopes(token string) []string {
+	parsed, err := jwt.ParseInsecure([]byte(token))
+	if err != nil {
+		return nil
+	}
+	scopes := []string{}
+	if v, ok := parsed.Get("scope"); ok {
+		if s, ok := v.(string); ok {
+			return append(scopes, strings.Fields(s)...)
+		}
+	}
+	if v, ok := parsed.Get("scp"); ok {
+		switch scp := v.(type) {
+		case string:
+			scopes = append(scopes, strings.Fields(scp)...)
+		case []interface{}:
+			for _, s := range scp {
+				if s, ok := s.(string); ok {
+					scopes = append(scopes, s)
+				}
+			}
+		}
+		return scopes
+	}
+	return nil
 }
 
 func getHeaderValue(headers []*core.HeaderValue, key string) string {
@@ -305,19 +475,25 @@ func getHeaderValue(headers []*core.HeaderValue, key string) string {
 }
 
 // handleInbound processes inbound traffic by validating the JWT token.
-func (p *processor) handleInbound(headers *core.HeaderMap) *v3.ProcessingResponse {
-	log.Println("=== Inbound Request Headers ===")
-	if headers != nil {
-		for _, header := range headers.Headers {
-			if !strings.EqualFold(header.Key, "authorization") &&
-				!strings.EqualFold(header.Key, "x-client-secret") {
-				log.Printf("%s: %s", header.Key, string(header.RawValue))
-			}
-		}
+func (p *processor) handleInbound(headers *core.HeaderMap, state *streamState) *v3.ProcessingResponse {
+	inboundLog.Debug("Request headers", headersAttr(headers))
+
+	if err := checkCSRF(headers.Headers); err != nil {
+		inboundLog.Warn("CSRF check failed, rejecting request", "error", err)
+		return forbidRequest("", err.Error(), "csrf_check_failed")
 	}
 
-	if jwksCache == nil || inboundIssuer == "" {
-		log.Println("[Inbound] Inbound validation not configured (ISSUER or TOKEN_URL missing), skipping")
+	if isProbeRequest(headers.Headers) {
+		inboundLog.Debug("Kubelet probe, skipping token validation", "path", getHeaderValue(headers.Headers, ":path"))
+		return requestHeadersResponse(&v3.HeaderMutation{RemoveHeaders: []string{"x-authbridge-direction"}})
+	}
+
+	if resp := mcpMetadataResponse(headers.Headers); resp != nil {
+		return resp
+	}
+
+	if (jwksCache == nil || inboundIssuer == "") && identityProviders == nil {
+		inboundLog.Debug("Inbound validation not configured (ISSUER or TOKEN_URL missing), skipping")
 		return &v3.ProcessingResponse{
 			Response: &v3.ProcessingResponse_RequestHeaders{
 				RequestHeaders: &v3.HeadersResponse{},
@@ -327,25 +503,45 @@ func (p *processor) handleInbound(headers *core.HeaderMap) *v3.ProcessingRespons
 
 	authHeader := getHeaderValue(headers.Headers, "authorization")
 	if authHeader == "" {
-		log.Println("[Inbound] Missing Authorization header")
-		return denyRequest("missing Authorization header")
+		inboundLog.Info("Missing Authorization header")
+		return denyRequest("", "missing Authorization header")
 	}
 
 	tokenString := strings.TrimPrefix(authHeader, "Bearer ")
 	tokenString = strings.TrimPrefix(tokenString, "bearer ")
 	if tokenString == authHeader {
-		log.Println("[Inbound] Invalid Authorization header format")
-		return denyRequest("invalid Authorization header format")
+		inboundLog.Info("Invalid Authorization header format")
+		return denyRequest(errInvalidToken, "invalid Authorization header format")
 	}
 
-	if err := validateInboundJWT(tokenString, inboundJWKSURL, inboundIssuer); err != nil {
-		log.Printf("[Inbound] JWT validation failed: %v", err)
-		return denyRequest(fmt.Sprintf("token validation failed: %v", err))
+	cache, jwksURL, issuer := inboundKeys(tokenString)
+	if cache == nil {
+		inboundLog.Info("Token issuer not trusted", "issuer", idp.Issuer(tokenString))
+		return denyRequest(errInvalidToken, "token issuer not trusted")
+	}
+	token, err := validateInboundJWT(cache, tokenString, jwksURL, issuer)
+	if err != nil {
+		var assertionErr *claims.AssertionError
+		if errors.As(err, &assertionErr) {
+			inboundLog.Info("Claim assertion failed", "error", err)
+			// The rule and claim values stay in the log; callers learn only
+			// that they are not allowed
+			return forbidRequest(errInsufficientScope, "forbidden", "claim_assertion_failed")
+		}
+		inboundLog.Info("JWT validation failed", "error", err)
+		return denyRequest(errInvalidToken, fmt.Sprintf("token validation failed: %v", err))
 	}
 
-	log.Println("[Inbound] JWT validation succeeded, forwarding request")
+	if callChainSigner != nil {
+		if err := verifyInboundCallChain(headers.Headers, tokenString); err != nil {
+			inboundLog.Info("Call chain rejected", "error", err)
+			return problemResponse(typev3.StatusCode_Unauthorized, errInvalidToken, err.Error(), "call_chain_invalid")
+		}
+	}
+
+	inboundLog.Debug("JWT validation succeeded, forwarding request")
 	// Remove the x-authbridge-direction header so the app never sees it
-	return &v3.ProcessingResponse{
+	resp := &v3.ProcessingResponse{
 		Response: &v3.ProcessingResponse_RequestHeaders{
 			RequestHeaders: &v3.HeadersResponse{
 				Response: &v3.CommonResponse{
@@ -356,116 +552,410 @@ func (p *processor) handleInbound(headers *core.HeaderMap) *v3.ProcessingRespons
 			},
 		},
 	}
+	if inspectsInboundBody(headers.Headers, state) {
+		return waitForInboundBody(resp, token, state)
+	}
+	if reject := unsupportedMCPBody(headers.Headers, state); reject != nil {
+		return reject
+	}
+	return resp
 }
 
 // handleOutbound processes outbound traffic by performing token exchange.
 // It uses the resolver to get per-host configuration for audience/scopes/tokenURL.
-func (p *processor) handleOutbound(ctx context.Context, headers *core.HeaderMap) *v3.ProcessingResponse {
-	log.Println("=== Outbound Request Headers ===")
-	if headers != nil {
-		for _, header := range headers.Headers {
-			if !strings.EqualFold(header.Key, "authorization") &&
-				!strings.EqualFold(header.Key, "x-client-secret") {
-				log.Printf("%s: %s", header.Key, string(header.RawValue))
-			}
-		}
-	}
+func (p *processor) handleOutbound(ctx context.Context, headers *core.HeaderMap, state *streamState) *v3.ProcessingResponse {
+	exchangeLog.Debug("Request headers", headersAttr(headers))
+	ctx = startAudit(ctx)
+	ctx = withTraceID(ctx, headers.Headers)
 
 	// Extract host and resolve target configuration
 	requestHost := getHostFromHeaders(headers.Headers)
-	targetConfig, err := globalResolver.Resolve(ctx, requestHost)
+	resolveCtx := resolver.WithRequestHeaders(ctx, headerMap(headers.Headers))
+	// For {{ sub }} templates; the exchange verifies the token
+	if authHeader := getHeaderValue(headers.Headers, "authorization"); authHeader != "" {
+		callerToken := strings.TrimPrefix(strings.TrimPrefix(authHeader, "Bearer "), "bearer ")
+		resolveCtx = resolver.WithSubject(resolveCtx, tokenSubject(callerToken))
+	}
+	var targetConfig *resolver.TargetConfig
+	var err error
+	if state.envoyRoute != nil {
+		traceStep(ctx, "Using route configured in Envoy")
+		targetConfig, err = metadataRoutes.Resolve(resolveCtx, requestHost, state.envoyRoute)
+	} else {
+		targetConfig, err = globalResolver.Resolve(resolveCtx, requestHost)
+	}
 	if err != nil {
-		log.Printf("[Resolver] Error resolving host %q: %v", requestHost, err)
+		resolverLog.Error("Error resolving host", "host", requestHost, "error", err)
+	}
+	traceRoute(ctx, targetConfig, err)
+
+	// A host whose route could not be resolved is rejected: handling it as
+	// unmatched would skip the route's policy (require_exchange, max_scopes,
+	// deny) whenever a caller leaves out a header or a route source fails.
+	// A route that applies but cannot be rendered for the request, e.g. as a
+	// header its audience names is missing, is the caller's fault.
+	var templateErr *resolver.TemplateError
+	if errors.As(err, &templateErr) {
+		recordExchange(ctx, headers.Headers, requestHost, "", "", accesslog.OutcomeDenied)
+		return forbidRequest("", "the route for "+requestHost+" cannot be applied to this request", "route_template_unresolved")
+	}
+	if err != nil {
+		recordExchange(ctx, headers.Headers, requestHost, "", "", accesslog.OutcomeFailed)
+		return problemResponse(typev3.StatusCode_ServiceUnavailable, "", "the route for "+requestHost+" is unavailable", "route_unavailable")
 	}
 
-	// Handle passthrough routes - skip token exchange
-	if targetConfig != nil && targetConfig.Passthrough {
-		log.Printf("[Resolver] Passthrough enabled for host %q, skipping token exchange", requestHost)
-		return &v3.ProcessingResponse{
-			Response: &v3.ProcessingResponse_RequestHeaders{
-				RequestHeaders: &v3.HeadersResponse{},
-			},
+	// Header mutations accumulated for this request; applied whether or not
+	// the exchange itself happens
+	mutation := &v3.HeaderMutation{}
+	if traceHeader != "" && hasHeader(headers.Headers, traceHeader) {
+		mutation.RemoveHeaders = append(mutation.RemoveHeaders, traceHeader)
+	}
+	if targetConfig != nil {
+		applyHeaderRules(headers.Headers, &targetConfig.RequestHeaders, mutation)
+		if !targetConfig.ResponseHeaders.IsZero() {
+			state.responseHeaderRules = &targetConfig.ResponseHeaders
 		}
 	}
 
+	if targetConfig != nil && targetConfig.UpstreamTimeout > 0 {
+		applyUpstreamTimeout(mutation, headers.Headers, targetConfig.UpstreamTimeout)
+	}
+
+	// Hosts without a route follow UNMATCHED_HOSTS
+	if targetConfig == nil {
+		switch unmatchedHosts {
+		case unmatchedDeny:
+			resolverLog.Info("No route for host, denying request", "host", requestHost)
+			traceStep(ctx, "No route, denying", "unmatched_hosts", unmatchedHosts)
+			recordExchange(ctx, headers.Headers, requestHost, "", "", accesslog.OutcomeDenied)
+			return forbidRequest("", "no route for "+requestHost, "no_route")
+		case unmatchedPassthrough:
+			resolverLog.Debug("No route for host, forwarding unchanged", "host", requestHost)
+			traceStep(ctx, "No route, not exchanging", "unmatched_hosts", unmatchedHosts)
+			return requestHeadersResponse(mutation)
+		}
+	}
+
+	// Handle passthrough routes - skip token exchange and leave Authorization
+	// as it is; only the route's internal headers are removed
+	if targetConfig != nil && targetConfig.Passthrough {
+		resolverLog.Debug("Passthrough enabled, skipping token exchange", "host", requestHost, "strip_headers", targetConfig.StripHeaders)
+		traceStep(ctx, "Passthrough route, not exchanging", "strip_headers", targetConfig.StripHeaders)
+		mutation.RemoveHeaders = append(mutation.RemoveHeaders, targetConfig.StripHeaders...)
+		return requestHeadersResponse(mutation)
+	}
+
 	// Get global configuration (from files or env vars)
 	clientID, clientSecret, tokenURL, targetAudience, targetScopes := getConfig()
+	tokenCAFile := globalTokenCAFile
+	scopesExceeded := false
+
+	// The IdP that issued the caller's token replaces the global token
+	// endpoint and client; the route's own still win. Workload identity
+	// routes don't exchange the caller's token.
+	if targetConfig == nil || !targetConfig.WorkloadIdentity {
+		callerToken := strings.TrimPrefix(getHeaderValue(headers.Headers, "authorization"), "Bearer ")
+		clientID, clientSecret, tokenURL, tokenCAFile = exchangeClient(ctx, strings.TrimPrefix(callerToken, "bearer "),
+			clientID, clientSecret, tokenURL, tokenCAFile)
+	}
 
 	// Apply target-specific overrides if available
 	if targetConfig != nil {
-		log.Printf("[Resolver] Applying target config for host %q", requestHost)
+		resolverLog.Debug("Applying target config", "host", requestHost)
 		if targetConfig.Audience != "" {
 			targetAudience = targetConfig.Audience
-			log.Printf("[Resolver] Using target audience: %s", targetAudience)
+			resolverLog.Debug("Using target audience", "audience", targetAudience)
 		}
 		if targetConfig.Scopes != "" {
 			targetScopes = targetConfig.Scopes
-			log.Printf("[Resolver] Using target scopes: %s", targetScopes)
+			resolverLog.Debug("Using target scopes", "scopes", targetScopes)
 		}
 		if targetConfig.TokenEndpoint != "" {
 			tokenURL = targetConfig.TokenEndpoint
-			log.Printf("[Resolver] Using target token_url: %s", tokenURL)
+			resolverLog.Debug("Using target token_url", "token_url", tokenURL)
+		}
+		if targetConfig.ClientID != "" {
+			secret, err := resolveSecretRef(targetConfig.ClientSecretRef)
+			if err != nil {
+				resolverLog.Error("Cannot read target client secret", "host", requestHost, "client_id", targetConfig.ClientID, "error", err)
+			}
+			// Never pair the route's client with the global secret
+			clientID, clientSecret = targetConfig.ClientID, secret
+			resolverLog.Debug("Using target client", "client_id", clientID)
+		}
+		if targetConfig.TokenCAFile != "" {
+			tokenCAFile = targetConfig.TokenCAFile
+		}
+		if tool := targetConfig.MCPTool(state.mcpTool); tool != nil {
+			if tool.Audience != "" {
+				targetAudience = tool.Audience
+			}
+			if tool.Scopes != "" {
+				targetScopes = tool.Scopes
+			}
+			resolverLog.Debug("Using MCP tool config", "tool", state.mcpTool, "pattern", tool.Name, "audience", targetAudience, "scopes", targetScopes)
+		}
+		if method := targetConfig.A2AMethod(state.a2aMethod); method != nil && !method.Passthrough {
+			if method.Audience != "" {
+				targetAudience = method.Audience
+			}
+			if method.Scopes != "" {
+				targetScopes = method.Scopes
+			}
+			resolverLog.Debug("Using A2A method config", "method", state.a2aMethod, "pattern", method.Method, "audience", targetAudience, "scopes", targetScopes)
+		}
+		// Apply the scope ceiling after the route, tool and method scopes;
+		// it is applied again after the policy hooks
+		if targetConfig.MaxScopes != "" {
+			reduced := restrictScopes(targetScopes, targetConfig.MaxScopes)
+			if reduced != targetScopes {
+				resolverLog.Debug("Reduced scopes", "from", targetScopes, "to", reduced, "max_scopes", targetConfig.MaxScopes)
+			}
+			// Exchanging without scopes would not be the requested access
+			scopesExceeded = targetScopes != "" && reduced == ""
+			targetScopes = reduced
 		}
 	}
 
-	if clientID != "" && clientSecret != "" && tokenURL != "" && targetAudience != "" && targetScopes != "" {
-		log.Println("[Token Exchange] Configuration loaded, attempting token exchange")
-		log.Printf("[Token Exchange] Client ID: %s", clientID)
-		log.Printf("[Token Exchange] Target Audience: %s", targetAudience)
-		log.Printf("[Token Exchange] Target Scopes: %s", targetScopes)
+	traceStep(ctx, "Exchange parameters", "client_id", clientID, "token_url", tokenURL, "audience", targetAudience,
+		"scopes", targetScopes, "mcp_tool", state.mcpTool, "a2a_method", state.a2aMethod)
+	if waitsForBody(headers.Headers, targetConfig, state) {
+		exchangeLog.Debug("Waiting for the request body to select audience and scopes", "host", requestHost)
+		traceStep(ctx, "Waiting for the request body")
+		return waitForBody(headers, mutation, state)
+	}
+	if reason := a2aPassthrough(headers.Headers, targetConfig, state); reason != "" {
+		resolverLog.Debug("A2A passthrough, skipping token exchange", "host", requestHost, "reason", reason)
+		traceStep(ctx, "A2A passthrough, not exchanging", "reason", reason)
+		mutation.RemoveHeaders = append(mutation.RemoveHeaders, targetConfig.StripHeaders...)
+		return requestHeadersResponse(mutation)
+	}
+	if scopesExceeded {
+		return scopesExceededResponse(ctx, headers.Headers, requestHost, targetAudience, targetConfig.MaxScopes)
+	}
+
+	required := (targetConfig != nil && targetConfig.RequireExchange) || (targetConfig == nil && unmatchedHosts == unmatchedExchange)
+	ctx = withTokenCA(ctx, tokenCAFile)
+
+	if targetConfig != nil && targetConfig.WorkloadIdentity {
+		return workloadIdentityResponse(ctx, headers, state, mutation, requestHost, clientID, clientSecret, tokenURL, targetAudience, targetScopes)
+	}
+
+	introspected := false
+	if targetConfig != nil && targetConfig.Introspect {
+		if resp := introspectResponse(ctx, headers.Headers, mutation, targetConfig, requestHost, clientID, clientSecret, tokenURL, targetAudience, targetScopes); resp != nil {
+			return resp
+		}
+		if !targetConfig.ExchangeAfterIntrospection {
+			exchangeLog.Debug("Token active, forwarding it with introspected claims", "host", requestHost)
+			traceStep(ctx, "Token active, forwarding it without exchange")
+			return requestHeadersResponse(mutation)
+		}
+		introspected = true
+	}
+
+	if hasClientCredentials(clientID, clientSecret) && tokenURL != "" && targetAudience != "" && targetScopes != "" {
+		exchangeLog.Debug("Attempting token exchange",
+			"client_id", clientID, "audience", targetAudience, "scopes", targetScopes)
 
 		authHeader := getHeaderValue(headers.Headers, "authorization")
+		subjectTokenType := tokenTypeAccessToken
+		ownIdentity := false
+		if authHeader == "" {
+			svid, err := svidSubjectToken(ctx)
+			if err != nil {
+				exchangeLog.Error("Cannot fetch JWT-SVID as subject token", "host", requestHost, "error", err)
+				return exchangeFailedResponse(required, mutation, typev3.StatusCode_ServiceUnavailable, "", "workload identity unavailable", "svid_unavailable")
+			}
+			if svid != "" {
+				exchangeLog.Debug("No Authorization header, exchanging own JWT-SVID", "host", requestHost)
+				traceStep(ctx, "No Authorization header, using own JWT-SVID as subject token")
+				authHeader, subjectTokenType, ownIdentity = "Bearer "+svid, tokenTypeJWT, true
+			}
+		}
 		if authHeader != "" {
 			subjectToken := strings.TrimPrefix(authHeader, "Bearer ")
 			subjectToken = strings.TrimPrefix(subjectToken, "bearer ")
 
 			if subjectToken != authHeader {
-				newToken, err := exchangeToken(clientID, clientSecret, tokenURL, subjectToken, targetAudience, targetScopes)
+				auditFrom(ctx).subjectToken(subjectToken, clientID)
+				// The ext proc's own SVID is not issued by the IdP, and an
+				// introspected token may be opaque
+				if subjectTokenCheck != nil && !ownIdentity && !introspected {
+					if err := subjectTokenCheck.validate(ctx, subjectToken, clientID); err != nil {
+						exchangeLog.Info("Subject token failed local validation, not exchanging", "host", requestHost, "error", err)
+						traceStep(ctx, "Subject token failed local validation", "error", err)
+						recordExchange(ctx, headers.Headers, requestHost, targetAudience, targetScopes, accesslog.OutcomeFailed)
+						return exchangeFailedResponse(required, mutation, typev3.StatusCode_Unauthorized, errInvalidToken, err.Error(), "subject_token_invalid")
+					}
+				}
+
+				exchangeReq := &policy.ExchangeRequest{
+					Host:     requestHost,
+					Headers:  headerMap(headers.Headers),
+					Audience: targetAudience,
+					Scopes:   targetScopes,
+				}
+				if !ownIdentity {
+					exchangeReq.SubjectScopes = tokenScopes(subjectToken)
+				}
+				deny, hookErr := policyHooks.BeforeExchange(ctx, exchangeReq)
+				if hookErr != nil && deny == nil && !policyHooksFailOpen {
+					policyLog.Error("Hook error, denying", "host", requestHost, "error", hookErr)
+					traceStep(ctx, "Policy hook failed, denying", "error", hookErr)
+					recordExchange(ctx, headers.Headers, requestHost, targetAudience, targetScopes, accesslog.OutcomeDenied)
+					return forbidRequest("", "policy hook failed", "policy_hook_failed")
+				}
+				if hookErr != nil {
+					policyLog.Warn("Hook error, continuing", "error", hookErr)
+				}
+				if deny != nil {
+					policyLog.Info("Exchange denied", "reason", deny, "host", requestHost, "annotations", exchangeReq.Annotations)
+					traceStep(ctx, "Policy hook denied the exchange", "reason", deny)
+					recordExchange(ctx, headers.Headers, requestHost, targetAudience, targetScopes, accesslog.OutcomeDenied)
+					return forbidRequest(errInsufficientScope, deny.Error(), "policy_denied")
+				}
+				// Hooks may narrow the scopes, never widen them past the ceiling
+				if targetConfig != nil && targetConfig.MaxScopes != "" {
+					reduced := restrictScopes(exchangeReq.Scopes, targetConfig.MaxScopes)
+					if exchangeReq.Scopes != "" && reduced == "" {
+						return scopesExceededResponse(ctx, headers.Headers, requestHost, exchangeReq.Audience, targetConfig.MaxScopes)
+					}
+					exchangeReq.Scopes = reduced
+				}
+				if exchangeReq.Audience != targetAudience || exchangeReq.Scopes != targetScopes {
+					traceStep(ctx, "Policy hooks changed the exchange", "audience", exchangeReq.Audience, "scopes", exchangeReq.Scopes)
+				}
+				targetAudience, targetScopes = exchangeReq.Audience, exchangeReq.Scopes
+
+				if targetConfig != nil && targetConfig.RequireAuthorization {
+					err := checkAuthorization(ctx, clientID, clientSecret, tokenURL, subjectToken, targetAudience, targetConfig.Permissions)
+					switch {
+					case errors.Is(err, errNotAuthorized):
+						exchangeLog.Info("Authorization denied by IdP", "host", requestHost, "audience", targetAudience, "error", err)
+						recordExchange(ctx, headers.Headers, requestHost, targetAudience, targetScopes, accesslog.OutcomeDenied)
+						return forbidRequest(errInsufficientScope, "not authorized for "+targetAudience, "authorization_denied")
+					case errors.Is(err, errCircuitOpen):
+						recordExchange(ctx, headers.Headers, requestHost, targetAudience, targetScopes, accesslog.OutcomeFailed)
+						return problemResponse(typev3.StatusCode_ServiceUnavailable, "", "token endpoint unavailable", "token_endpoint_circuit_open")
+					case err != nil:
+						exchangeLog.Error("Authorization check failed", "host", requestHost, "error", err)
+						recordExchange(ctx, headers.Headers, requestHost, targetAudience, targetScopes, accesslog.OutcomeFailed)
+						return problemResponse(typev3.StatusCode_BadGateway, "", "authorization check failed", "authorization_check_failed")
+					}
+				}
+
+				var callChain string
+				if callChainSigner != nil {
+					if callChain, err = outboundCallChain(headers.Headers, subjectToken, clientID); err != nil {
+						exchangeLog.Warn("Cannot extend call chain", "host", requestHost, "error", err)
+						recordExchange(ctx, headers.Headers, requestHost, targetAudience, targetScopes, accesslog.OutcomeDenied)
+						return problemResponse(typev3.StatusCode_LoopDetected, "", err.Error(), "call_chain_rejected")
+					}
+				}
+
+				dpopRoute := targetConfig != nil && targetConfig.DPoP
+				traceStep(ctx, "Exchanging token", "subject_token_type", subjectTokenType, "own_identity", ownIdentity,
+					"actor_token_source", actorTokenSource, "dpop", dpopRoute, "call_chain", callChain != "")
+				var hops []resolver.ExchangeHop
+				if targetConfig != nil {
+					hops = targetConfig.ExchangeVia
+				}
+				tokenResp, cacheEntry, err := chainedExchangeToken(ctx, dpopRoute, hops, clientID, clientSecret, tokenURL, subjectToken, subjectTokenType, targetAudience, targetScopes)
+				policyHooks.AfterExchange(ctx, exchangeReq, &policy.ExchangeResult{Err: err, ExpiresIn: tokenResp.ExpiresIn})
+				if len(exchangeReq.Annotations) > 0 {
+					policyLog.Debug("Annotations", "host", requestHost, "annotations", exchangeReq.Annotations)
+				}
 				if err == nil {
-					log.Printf("[Token Exchange] Successfully exchanged token, replacing Authorization header")
-					return &v3.ProcessingResponse{
-						Response: &v3.ProcessingResponse_RequestHeaders{
-							RequestHeaders: &v3.HeadersResponse{
-								Response: &v3.CommonResponse{
-									HeaderMutation: &v3.HeaderMutation{
-										SetHeaders: []*core.HeaderValueOption{
-											{
-												Header: &core.HeaderValue{
-													Key:      "authorization",
-													RawValue: []byte("Bearer " + newToken),
-												},
-											},
-										},
-									},
-								},
-							},
+					authorization, proof, err := dpopAuthorization(headers.Headers, tokenResp)
+					if err != nil {
+						exchangeLog.Error("Cannot create DPoP proof", "host", requestHost, "error", err)
+						recordExchange(ctx, headers.Headers, requestHost, targetAudience, targetScopes, accesslog.OutcomeFailed)
+						return exchangeFailedResponse(required, mutation, typev3.StatusCode_BadGateway, "", "DPoP proof failed", "dpop_proof_failed")
+					}
+					if dpopRoute && proof == "" {
+						exchangeLog.Warn("IdP issued a bearer token for a DPoP route", "host", requestHost, "token_type", tokenResp.TokenType)
+					}
+					auditFrom(ctx).issuedToken(tokenResp.AccessToken)
+					recordExchange(ctx, headers.Headers, requestHost, targetAudience, targetScopes, accesslog.OutcomeExchanged)
+					state.exchanged = true
+					state.expiresIn = tokenResp.ExpiresIn
+					state.exchangeEntry, state.exchangedToken = cacheEntry, tokenResp.AccessToken
+					if cacheEntry == nil && respPolicy.upstream401 != upstream401Pass {
+						state.uncachedExchange = exchangeKey(subjectToken, subjectTokenType, clientID, tokenURL, targetAudience, targetScopes)
+					}
+					traceStep(ctx, "Token exchanged", "token_type", tokenResp.TokenType, "expires_in", tokenResp.ExpiresIn)
+					exchangeLog.Info("Token exchanged, replacing Authorization header", "host", requestHost, "audience", targetAudience)
+					mutation.SetHeaders = append(mutation.SetHeaders, &core.HeaderValueOption{
+						Header: &core.HeaderValue{
+							Key:      "authorization",
+							RawValue: []byte(authorization),
 						},
+					})
+					if proof != "" {
+						mutation.SetHeaders = append(mutation.SetHeaders, &core.HeaderValueOption{
+							Header: &core.HeaderValue{Key: "dpop", RawValue: []byte(proof)},
+						})
+					}
+					if callChain != "" {
+						mutation.SetHeaders = append(mutation.SetHeaders, &core.HeaderValueOption{
+							Header: &core.HeaderValue{Key: callChainHeader, RawValue: []byte(callChain)},
+						})
 					}
+					return requestHeadersResponse(mutation)
 				}
-				log.Printf("[Token Exchange] Failed to exchange token: %v", err)
-			} else {
-				log.Printf("[Token Exchange] Invalid Authorization header format")
+				exchangeLog.Error("Failed to exchange token", "host", requestHost, "error", err)
+				traceStep(ctx, "Token exchange failed", "error", err, "required", required)
+				recordExchange(ctx, headers.Headers, requestHost, targetAudience, targetScopes, accesslog.OutcomeFailed)
+				if errors.Is(err, errCircuitOpen) && (breakerPolicy == breakerDeny || required) {
+					return problemResponse(typev3.StatusCode_ServiceUnavailable, "", "token endpoint unavailable", "token_endpoint_circuit_open")
+				}
+				return exchangeFailedResponse(required, mutation, typev3.StatusCode_BadGateway, "", "token exchange failed", "token_exchange_failed")
 			}
-		} else {
-			log.Printf("[Token Exchange] No Authorization header found")
+			exchangeLog.Info("Invalid Authorization header format")
+			traceStep(ctx, "Authorization header is not a bearer token", "required", required)
+			return exchangeFailedResponse(required, mutation, typev3.StatusCode_Unauthorized, errInvalidToken, "authorization header is not a bearer token", "subject_token_invalid")
 		}
-	} else {
-		log.Println("[Token Exchange] Missing configuration, skipping token exchange")
-		log.Printf("[Token Exchange] CLIENT_ID present: %v, CLIENT_SECRET present: %v, TOKEN_URL present: %v",
-			clientID != "", clientSecret != "", tokenURL != "")
-		log.Printf("[Token Exchange] TARGET_AUDIENCE present: %v, TARGET_SCOPES present: %v",
-			targetAudience != "", targetScopes != "")
+		exchangeLog.Debug("No Authorization header found")
+		traceStep(ctx, "No subject token", "required", required)
+		return exchangeFailedResponse(required, mutation, typev3.StatusCode_Unauthorized, "", "missing subject token", "subject_token_missing")
 	}
 
+	exchangeLog.Debug("Missing configuration, skipping token exchange",
+		"client_id_set", clientID != "", "client_secret_set", clientSecret != "", "token_url_set", tokenURL != "",
+		"target_audience_set", targetAudience != "", "target_scopes_set", targetScopes != "")
+	traceStep(ctx, "Exchange not configured", "client_secret_set", clientSecret != "", "required", required)
+	return exchangeFailedResponse(required, mutation, typev3.StatusCode_ServiceUnavailable, "", "token exchange not configured", "token_exchange_not_configured")
+}
+
+// exchangeFailedResponse handles an outbound request whose token could not be
+// exchanged. Routes with require_exchange are rejected with a problem+json
+// response; others are forwarded with the original token.
+func exchangeFailedResponse(required bool, mutation *v3.HeaderMutation, code typev3.StatusCode, errorCode, description, details string) *v3.ProcessingResponse {
+	if required {
+		exchangeLog.Info("Exchange required, rejecting request", "status", int(code), "reason", details)
+		return problemResponse(code, errorCode, description, details)
+	}
+	return requestHeadersResponse(mutation)
+}
+
+// requestHeadersResponse wraps a header mutation in a request-headers
+// ProcessingResponse. An empty mutation forwards the request unchanged.
+func requestHeadersResponse(mutation *v3.HeaderMutation) *v3.ProcessingResponse {
+	headersResponse := &v3.HeadersResponse{}
+	if mutation != nil && (len(mutation.SetHeaders) > 0 || len(mutation.RemoveHeaders) > 0) {
+		headersResponse.Response = &v3.CommonResponse{HeaderMutation: mutation}
+	}
 	return &v3.ProcessingResponse{
 		Response: &v3.ProcessingResponse_RequestHeaders{
-			RequestHeaders: &v3.HeadersResponse{},
+			RequestHeaders: headersResponse,
 		},
 	}
 }
 
 func (p *processor) Process(stream v3.ExternalProcessor_ProcessServer) error {
 	ctx := stream.Context()
+	state := &streamState{}
 	for {
 		select {
 		case <-ctx.Done():
@@ -486,27 +976,42 @@ func (p *processor) Process(stream v3.ExternalProcessor_ProcessServer) error {
 			direction := getHeaderValue(headers.Headers, "x-authbridge-direction")
 
 			if direction == "inbound" {
-				resp = p.handleInbound(headers)
+				state.bodyFollows = !r.RequestHeaders.EndOfStream
+				resp = p.handleInbound(headers, state)
 			} else {
-				resp = p.handleOutbound(ctx, headers)
-			}
-
-		case *v3.ProcessingRequest_ResponseHeaders:
-			log.Println("=== Response Headers ===")
-			headers := r.ResponseHeaders.Headers
-			if headers != nil {
-				for _, header := range headers.Headers {
-					log.Printf("%s: %s", header.Key, string(header.RawValue))
+				state.bodyFollows = !r.RequestHeaders.EndOfStream
+				startDecisionTrace(req, headers.Headers, state)
+				state.envoyRoute = routeFromEnvoy(ctx, req)
+				resp = p.handleOutbound(state.withTrace(ctx), headers, state)
+				// Upgrade/CONNECT handshakes get the same per-connection exchange
+				// as plain requests; only the follow-up body phases are skipped.
+				if isUpgradeRequest(headers.Headers) {
+					streamLog.Debug("Upgrade/CONNECT request, skipping body phases", "host", getHostFromHeaders(headers.Headers))
+					resp.ModeOverride = upgradeModeOverride()
+				} else if wantsResponseHeaders(state) {
+					resp.ModeOverride = exchangeMetadataModeOverride()
 				}
 			}
-			resp = &v3.ProcessingResponse{
-				Response: &v3.ProcessingResponse_ResponseHeaders{
-					ResponseHeaders: &v3.HeadersResponse{},
-				},
+			stripCredentialHeaders(resp, headers.Headers)
+			if direction != "inbound" {
+				stripControlHeaders(resp, headers.Headers)
 			}
 
+		case *v3.ProcessingRequest_RequestBody:
+			// Only requested by waitForBody and waitForInboundBody
+			if state.inboundClaims != nil {
+				resp = handleInboundBody(r.RequestBody, state)
+			} else {
+				resp = p.handleOutboundBody(state.withTrace(ctx), r.RequestBody, state)
+			}
+
+		case *v3.ProcessingRequest_ResponseHeaders:
+			streamLog.Debug("Response headers", headersAttr(r.ResponseHeaders.Headers))
+			traceStep(state.withTrace(ctx), "Upstream responded", "status", getHeaderValue(r.ResponseHeaders.Headers.GetHeaders(), ":status"))
+			resp = responseHeadersResponse(r.ResponseHeaders.Headers.GetHeaders(), state)
+
 		default:
-			log.Printf("Unknown request type: %T\n", r)
+			streamLog.Warn("Unknown request type", "type", fmt.Sprintf("%T", r))
 		}
 
 		if err := stream.Send(resp); err != nil {
@@ -516,60 +1021,145 @@ func (p *processor) Process(stream v3.ExternalProcessor_ProcessServer) error {
 }
 
 func main() {
-	log.Println("=== Go External Processor Starting ===")
+	flag.Parse()
+	if printConfigSchema() || runValidateRoutes() {
+		return
+	}
+	rootLogger.Info("Go external processor starting")
+	env := loadProcessorEnv()
+
+	// Needed to know which credentials to wait for
+	loadSPIFFEConfig(env.SPIFFE)
+	loadActorTokenConfig(env.ActorToken)
+	loadClientAuthConfig(env.ClientAuth)
+	loadDPoPConfig(env.DPoPKeyFile)
 
 	// Wait for credential files from client-registration (up to 60 seconds)
 	// This handles the startup race condition with client-registration container
-	waitForCredentials(60 * time.Second)
+	waitForCredentials(env.Credentials, 60*time.Second)
 
 	// Load configuration from files (or environment variables as fallback)
-	loadConfig()
+	loadConfig(env)
+	startCredentialsWatch(env.Credentials)
 
 	// Initialize inbound JWT validation
 	_, _, tokenURL, _, _ := getConfig()
-	inboundIssuer = os.Getenv("ISSUER")
-	expectedAudience = os.Getenv("EXPECTED_AUDIENCE")
-	if tokenURL != "" && inboundIssuer != "" {
-		inboundJWKSURL = deriveJWKSURL(tokenURL)
-		initJWKSCache(inboundJWKSURL)
-		log.Printf("[Inbound] Issuer: %s", inboundIssuer)
+	inboundIssuer = env.Issuer
+	expectedAudience = env.ExpectedAudience
+	if inboundIssuer != "" && env.OIDCDiscovery {
+		startOIDCDiscovery(inboundIssuer, env.OIDCDiscoveryRefresh)
+	} else if tokenURL != "" && inboundIssuer != "" {
+		setInboundJWKSURL(deriveJWKSURL(tokenURL))
+		initJWKSCache(getInboundJWKSURL())
+	}
+	loadIdPConfig(env.IdPsConfigPath)
+	if jwksCache != nil || identityProviders != nil {
+		inboundLog.Info("Inbound validation enabled", "issuer", inboundIssuer, "identity_providers", len(identityProviders.Providers()))
 		if expectedAudience != "" {
-			log.Printf("[Inbound] Expected audience: %s", expectedAudience)
+			inboundLog.Info("Audience validation enabled", "audience", expectedAudience)
 		} else {
-			log.Printf("[Inbound] Audience validation disabled (EXPECTED_AUDIENCE not set)")
+			inboundLog.Info("Audience validation disabled (EXPECTED_AUDIENCE not set)")
 		}
 	} else {
 		if tokenURL == "" {
-			log.Println("[Inbound] TOKEN_URL not configured, inbound JWT validation disabled")
+			inboundLog.Warn("TOKEN_URL not configured and OIDC_DISCOVERY off, inbound JWT validation disabled")
 		}
 		if inboundIssuer == "" {
-			log.Println("[Inbound] ISSUER not configured, inbound JWT validation disabled")
+			inboundLog.Warn("ISSUER not configured, inbound JWT validation disabled")
 		}
 	}
 
+	loadCSRFConfig(env.CSRF)
+	loadChallengeConfig(env.Challenge)
+	loadMCPAuthConfig(env.MCPAuth)
+	loadMCPCallPolicy(env.MCPCallPolicyPath)
+	loadCallChainConfig(env.CallChain)
+	loadSubjectTokenConfig(env.SubjectToken)
+	loadIntrospectionConfig(env.IntrospectionURL)
+	loadWorkloadTokenConfig(env.WorkloadToken)
+	loadTokenClientConfig(env.TokenClient)
+	loadProbeConfig(env.InboundProbePaths)
+	loadExchangeMetadataConfig(env.ExposeExchangeMetadata)
+	loadDecisionTraceConfig(env.DecisionTraceKey)
+	loadResponsePolicyConfig(env.ResponsePolicy)
+	loadExchangeCacheConfig(env.ExchangeCache)
+	loadCacheReuseConfig(env.CacheReuse)
+	loadExchangeRetryConfig(env.ExchangeRetry)
+	loadBreakerConfig(env.Breaker)
+	loadALSConfig(env.ALS)
+	loadStreamLimitConfig(env.StreamLimit)
+	loadAuditConfig(env.Audit)
+	loadRouteValidationConfig(env.RouteValidation)
+
+	deadlineHeader = strings.ToLower(env.DeadlineHeader)
+	loadControlHeaders(env.ControlHeadersPath)
+
+	// Load claim assertions evaluated after inbound signature checks
+	claimAssertionsPath := env.ClaimAssertionsPath
+	rules, err := claims.LoadRules(claimAssertionsPath)
+	if err != nil {
+		fatal("Failed to load claim assertions", "error", err)
+	}
+	setClaimRules(rules)
+
+	policyHooksFailOpen = env.PolicyHooksFailOpen
+	policyHooks, err = policy.Load(env.PolicyHooks)
+	if err != nil {
+		fatal("Failed to load policy hooks", "error", err)
+	}
+	if len(policyHooks) > 0 {
+		policyLog.Info("Policy hooks enabled", "hooks", env.PolicyHooks)
+	}
+
 	// Initialize the target resolver
-	configPath := os.Getenv("ROUTES_CONFIG_PATH")
-	if configPath == "" {
-		configPath = defaultRoutesConfigPath
+	configPath := env.RoutesConfigPath
+	if env.StrictRoutes {
+		if err := resolver.CheckRoutes(configPath); err != nil {
+			fatal("Invalid routes config", "error", err)
+		}
 	}
-	var err error
-	globalResolver, err = resolver.NewStaticResolver(configPath)
+	routes, err := resolver.NewStaticResolver(configPath)
 	if err != nil {
-		log.Fatalf("failed to load routes config: %v", err)
+		fatal("Failed to load routes config", "error", err)
 	}
+	routes.SetStrict(env.StrictRoutes)
+	if err := routes.SetMatchMode(resolver.MatchMode(env.RouteMatching)); err != nil {
+		fatal("Invalid ROUTE_MATCHING", "error", err)
+	}
+	if err := setUnmatchedHosts(env.UnmatchedHosts); err != nil {
+		fatal("Invalid UNMATCHED_HOSTS", "error", err)
+	}
+	globalResolver = routeSources(env, routes)
+
+	// Pick up routes and claim assertion changes without a restart
+	configReloader := newReloader(routes, configPath, claimAssertionsPath)
+	configReloader.start(env.Reload)
+
+	// Surface misconfigured routes before requests hit them
+	startRouteValidation()
+
+	startMetricsServer(env.MetricsAddress)
+	startAdminServer(env.AdminAddress)
 
 	// Start gRPC server
-	port := ":9090"
-	lis, err := net.Listen("tcp", port)
+	listeners, err := listener.Listen(*listenAddress)
+	if err != nil {
+		fatal("Failed to listen", "error", err)
+	}
+	opts, err := serverOptions()
 	if err != nil {
-		log.Fatalf("failed to listen: %v", err)
+		fatal("Invalid TLS configuration", "error", err)
 	}
 
-	grpcServer := grpc.NewServer()
+	grpcServer := grpc.NewServer(append(opts, streamLimitOptions()...)...)
 	v3.RegisterExternalProcessorServer(grpcServer, &processor{})
-
-	log.Printf("Starting Go external processor on %s", port)
-	if err := grpcServer.Serve(lis); err != nil {
-		log.Fatalf("failed to serve: %v", err)
+	registerALS(grpcServer)
+	if err := registerConfigService(grpcServer, configReloader, env.ConfigServiceEnabled); err != nil {
+		fatal("Invalid config service configuration", "error", err)
 	}
+	healthServer := registerHealth(grpcServer)
+
+	rootLogger.Info("Starting Go external processor", "address", *listenAddress, "tls", tlsMode())
+	serve(grpcServer, healthServer, listeners, env.Shutdown)
+	closeAudit()
 }
@@ -0,0 +1,216 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	core "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
+	extprocfilter "github.com/envoyproxy/go-control-plane/envoy/extensions/filters/http/ext_proc/v3"
+	v3 "github.com/envoyproxy/go-control-plane/envoy/service/ext_proc/v3"
+	typev3 "github.com/envoyproxy/go-control-plane/envoy/type/v3"
+
+	"github.com/kagenti/kagenti-extensions/AuthBridge/AuthProxy/go-processor/internal/policy"
+	"github.com/kagenti/kagenti-extensions/AuthBridge/AuthProxy/go-processor/internal/resolver"
+)
+
+func TestRestrictScopes(t *testing.T) {
+	tests := []struct {
+		name      string
+		requested string
+		allowed   string
+		want      string
+	}{
+		{"all allowed", "read write", "read write admin", "read write"},
+		{"some allowed", "read write admin", "read", "read"},
+		{"requested order kept", "write read", "read write", "write read"},
+		{"duplicates dropped", "read read write", "read write", "read write"},
+		{"extra whitespace", "  read\twrite ", "write  read", "read write"},
+		{"none allowed", "admin", "read write", ""},
+		{"nothing requested", "", "read", ""},
+		{"nothing allowed", "read", "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := restrictScopes(tt.requested, tt.allowed); got != tt.want {
+				t.Errorf("restrictScopes(%q, %q) = %q, want %q", tt.requested, tt.allowed, got, tt.want)
+			}
+		})
+	}
+}
+
+// unsignedJWT returns a JWT with the given JSON payload and no valid
+// signature, enough for functions that read claims without verifying them.
+func unsignedJWT(payload string) string {
+	enc := base64.RawURLEncoding
+	return enc.EncodeToString([]byte(`{"alg":"RS256","typ":"JWT"}`)) + "." + enc.EncodeToString([]byte(payload)) + ".c2ln"
+}
+
+func TestTokenScopes(t *testing.T) {
+	tests := []struct {
+		name  string
+		token string
+		want  []string
+	}{
+		{"scope claim", unsignedJWT(`{"sub":"alice","scope":"openid mcp:read"}`), []string{"openid", "mcp:read"}},
+		{"scp string", unsignedJWT(`{"sub":"alice","scp":"openid mcp:read"}`), []string{"openid", "mcp:read"}},
+		{"scp array", unsignedJWT(`{"sub":"alice","scp":["openid","mcp:read"]}`), []string{"openid", "mcp:read"}},
+		{"empty scope claim", unsignedJWT(`{"sub":"alice","scope":""}`), []string{}},
+		{"no scope claim", unsignedJWT(`{"sub":"alice"}`), nil},
+		{"opaque token", "2YotnFZFEjr1zCsicMWpAA", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tokenScopes(tt.token); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("tokenScopes() = %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDownscope_OpaqueSubjectToken(t *testing.T) {
+	req := &policy.ExchangeRequest{Scopes: "openid mcp:read", SubjectScopes: tokenScopes("2YotnFZFEjr1zCsicMWpAA")}
+	deny, err := policy.Chain{policy.NewDownscopeHook("")}.BeforeExchange(context.Background(), req)
+	if deny != nil || err != nil {
+		t.Fatalf("opaque subject token: deny = %v, err = %v", deny, err)
+	}
+	if req.Scopes != "openid mcp:read" {
+		t.Errorf("scopes = %q, want them unchanged", req.Scopes)
+	}
+}
+
+func TestIsUpgradeRequest(t *testing.T) {
+	tests := []struct {
+		name    string
+		headers []string
+		want    bool
+	}{
+		{"websocket", []string{":method", "GET", "connection", "Upgrade", "upgrade", "websocket"}, true},
+		{"upgrade among connection tokens", []string{":method", "GET", "connection", "keep-alive, upgrade", "upgrade", "websocket"}, true},
+		{"CONNECT", []string{":method", "CONNECT", ":authority", "db.example.com:5432"}, true},
+		{"lowercase connect", []string{":method", "connect"}, true},
+		{"upgrade header only", []string{":method", "GET", "upgrade", "websocket"}, false},
+		{"connection upgrade only", []string{":method", "GET", "connection", "upgrade"}, false},
+		{"connection token containing upgrade", []string{":method", "GET", "connection", "no-upgrade", "upgrade", "websocket"}, false},
+		{"plain request", []string{":method", "POST", "connection", "keep-alive"}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isUpgradeRequest(requestHeaders(tt.headers...)); got != tt.want {
+				t.Errorf("isUpgradeRequest() = %t, want %t", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestUpgradeModeOverride(t *testing.T) {
+	mode := upgradeModeOverride()
+	if mode.RequestBodyMode != extprocfilter.ProcessingMode_NONE || mode.ResponseBodyMode != extprocfilter.ProcessingMode_NONE {
+		t.Errorf("body modes = %s, %s; want NONE so frames are not buffered", mode.RequestBodyMode, mode.ResponseBodyMode)
+	}
+	if mode.RequestTrailerMode != extprocfilter.ProcessingMode_SKIP || mode.ResponseTrailerMode != extprocfilter.ProcessingMode_SKIP {
+		t.Errorf("trailer modes = %s, %s; want SKIP", mode.RequestTrailerMode, mode.ResponseTrailerMode)
+	}
+	if mode.ResponseHeaderMode != extprocfilter.ProcessingMode_SKIP {
+		t.Errorf("response header mode = %s, want SKIP", mode.ResponseHeaderMode)
+	}
+}
+
+// withRoutes makes routesYAML the routes of handleOutbound for the test.
+func withRoutes(t *testing.T, routesYAML string) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "routes.yaml")
+	writeFile(t, path, routesYAML)
+	routes, err := resolver.NewStaticResolver(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	saved := globalResolver
+	t.Cleanup(func() { globalResolver = saved })
+	globalResolver = routes
+}
+
+// failingResolver fails every lookup, like an unreachable route source.
+type failingResolver struct{}
+
+func (failingResolver) Resolve(context.Context, string) (*resolver.TargetConfig, error) {
+	return nil, errors.New("policy service unavailable")
+}
+
+func TestHandleOutbound_RouteResolutionFails(t *testing.T) {
+	withRoutes(t, `
+- host: "tools.example.com"
+  target_audience: "{{ header.x-tenant }}-tools"
+  max_scopes: "tools:read"
+`)
+	outbound := func(host string) typev3.StatusCode {
+		headers := &core.HeaderMap{Headers: requestHeaders(":method", "GET", ":path", "/", ":authority", host,
+			"authorization", "Bearer "+unsignedJWT(`{"sub":"alice"}`))}
+		resp := (&processor{}).handleOutbound(context.Background(), headers, &streamState{})
+		return resp.GetImmediateResponse().GetStatus().GetCode()
+	}
+
+	// Without x-tenant the route cannot be rendered; the request must not
+	// fall back to UNMATCHED_HOSTS (global: forwarded or exchanged globally)
+	if got := outbound("tools.example.com"); got != typev3.StatusCode_Forbidden {
+		t.Errorf("missing header: status = %v, want 403", got)
+	}
+
+	globalResolver = failingResolver{}
+	if got := outbound("tools.example.com"); got != typev3.StatusCode_ServiceUnavailable {
+		t.Errorf("failing route source: status = %v, want 503", got)
+	}
+}
+
+func TestHandleOutbound_UnrenderableRequiredRoute(t *testing.T) {
+	withRoutes(t, `
+- host: "tools.example.com"
+  target_audience: "{{ header.x-tenant }}-tools"
+  require_exchange: true
+`)
+	headers := &core.HeaderMap{Headers: requestHeaders(":method", "GET", ":path", "/", ":authority", "tools.example.com",
+		"authorization", "Bearer "+unsignedJWT(`{"sub":"alice"}`))}
+	resp := (&processor{}).handleOutbound(context.Background(), headers, &streamState{})
+	if got := resp.GetImmediateResponse().GetStatus().GetCode(); got != typev3.StatusCode_Forbidden {
+		t.Errorf("status = %v, want the request rejected with 403 rather than forwarded", got)
+	}
+}
+
+func TestUpstreamUnauthorized_UncachedExchangeRetriedOnce(t *testing.T) {
+	prev := respPolicy
+	respPolicy.upstream401 = upstream401Retry
+	t.Cleanup(func() { respPolicy = prev })
+
+	retried := func(key string) bool {
+		mutation := &v3.HeaderMutation{}
+		upstreamUnauthorized(&streamState{exchanged: true, uncachedExchange: key}, mutation)
+		for _, h := range mutation.SetHeaders {
+			if h.Header.Key == ":status" {
+				return string(h.Header.RawValue) == "503"
+			}
+		}
+		return false
+	}
+
+	key := exchangeKey("subject-token", "audience-a")
+	if !retried(key) {
+		t.Error("first 401 of an uncached exchange was not turned into a retry")
+	}
+	if retried(key) {
+		t.Error("401 after the retry was retried again, want it passed on")
+	}
+	if !retried(exchangeKey("subject-token", "audience-b")) {
+		t.Error("401 of another exchange was not retried")
+	}
+
+	m := &rejectionMemory{entries: make(map[string]time.Time)}
+	now := time.Now()
+	m.reject(key, now)
+	if !m.reject(key, now.Add(uncachedRejectionWindow)) {
+		t.Error("401 after the rejection window was not retried")
+	}
+}
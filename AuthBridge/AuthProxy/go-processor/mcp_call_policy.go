@@ -0,0 +1,98 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+
+	core "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
+	extprocfilter "github.com/envoyproxy/go-control-plane/envoy/extensions/filters/http/ext_proc/v3"
+	v3 "github.com/envoyproxy/go-control-plane/envoy/service/ext_proc/v3"
+	typev3 "github.com/envoyproxy/go-control-plane/envoy/type/v3"
+	"github.com/lestrrat-go/jwx/v2/jwt"
+
+	"github.com/kagenti/kagenti-extensions/AuthBridge/AuthProxy/go-processor/internal/mcpcall"
+	"github.com/kagenti/kagenti-extensions/AuthBridge/AuthProxy/go-processor/internal/mcppolicy"
+)
+
+// With an MCP call policy, inbound JSON POSTs whose token is valid are held
+// until Envoy has sent the body, like outbound requests of body-aware routes
+// (see request_body.go), and every tool call and resource access in it is
+// checked against the policy before the request reaches the MCP server.
+
+// mcpCallPolicy is nil unless MCP_CALL_POLICY_PATH exists.
+var mcpCallPolicy *mcppolicy.Policy
+
+func loadMCPCallPolicy(path string) {
+	policy, err := mcppolicy.Load(path)
+	if err != nil {
+		fatal("Failed to load MCP call policy", "error", err)
+	}
+	if policy == nil {
+		return
+	}
+	mcpCallPolicy = policy
+	inboundLog.Info("MCP call policy enabled", "path", path, "default_deny", policy.DefaultDeny())
+}
+
+// inspectsInboundBody reports whether the body of a validated inbound
+// request must be checked against the MCP call policy.
+func inspectsInboundBody(headers []*core.HeaderValue, state *streamState) bool {
+	return mcpCallPolicy != nil && state.bodyFollows && isJSONPost(headers)
+}
+
+// waitForInboundBody keeps the claims of the validated token and turns resp,
+// the headers response forwarding the request, into one asking Envoy to
+// buffer the body and send it. Requires allow_mode_override on the inbound
+// ext_proc filter.
+func waitForInboundBody(resp *v3.ProcessingResponse, token jwt.Token, state *streamState) *v3.ProcessingResponse {
+	tokenClaims, err := token.AsMap(context.Background())
+	if err != nil {
+		inboundLog.Info("Cannot read token claims", "error", err)
+		return denyRequest(errInvalidToken, "failed to read token claims")
+	}
+	state.inboundClaims = tokenClaims
+	resp.ModeOverride = &extprocfilter.ProcessingMode{
+		RequestHeaderMode:  extprocfilter.ProcessingMode_SEND,
+		ResponseHeaderMode: extprocfilter.ProcessingMode_SKIP,
+		RequestBodyMode:    extprocfilter.ProcessingMode_BUFFERED,
+		ResponseBodyMode:   extprocfilter.ProcessingMode_NONE,
+	}
+	return resp
+}
+
+// handleInboundBody authorizes the MCP calls of a held inbound request.
+func handleInboundBody(body *v3.HttpBody, state *streamState) *v3.ProcessingResponse {
+	tokenClaims := state.inboundClaims
+	state.inboundClaims = nil
+
+	calls := mcpcall.Calls(body.GetBody())
+	err := mcpCallPolicy.Authorize(calls, tokenClaims)
+	var denied *mcppolicy.Denied
+	switch {
+	case errors.As(err, &denied):
+		inboundLog.Info("MCP call denied", "method", denied.Call.Method, "target", denied.Call.Target,
+			"reason", denied.Reason, "sub", tokenClaims["sub"])
+		return forbidRequest(errInsufficientScope, err.Error(), "mcp_call_forbidden")
+	case err != nil:
+		inboundLog.Error("MCP call policy failed", "error", err)
+		return problemResponse(typev3.StatusCode_InternalServerError, "", "MCP call policy failed", "mcp_call_policy_failed")
+	}
+	if len(calls) > 0 {
+		inboundLog.Debug("MCP calls allowed", "calls", len(calls), "first", calls[0].Method+" "+calls[0].Target)
+	}
+	return &v3.ProcessingResponse{Response: &v3.ProcessingResponse_RequestBody{RequestBody: &v3.BodyResponse{}}}
+}
+
+// unsupportedMCPBody rejects inbound POSTs with a non-JSON body when the
+// policy denies by default, since the MCP server might still read calls
+// from them that the policy never saw. It returns nil for other requests.
+func unsupportedMCPBody(headers []*core.HeaderValue, state *streamState) *v3.ProcessingResponse {
+	if mcpCallPolicy == nil || !mcpCallPolicy.DefaultDeny() || !state.bodyFollows ||
+		!strings.EqualFold(getHeaderValue(headers, ":method"), http.MethodPost) || isJSONPost(headers) || isUpgradeRequest(headers) {
+		return nil
+	}
+	inboundLog.Info("Non-JSON POST rejected by the MCP call policy", "content_type", getHeaderValue(headers, "content-type"))
+	return problemResponse(typev3.StatusCode_UnsupportedMediaType, "", "MCP requests must be application/json", "mcp_body_unsupported")
+}
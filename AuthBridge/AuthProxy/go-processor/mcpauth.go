@@ -0,0 +1,58 @@
+package main
+
+import (
+	"encoding/json"
+
+	core "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
+	v3 "github.com/envoyproxy/go-control-plane/envoy/service/ext_proc/v3"
+	typev3 "github.com/envoyproxy/go-control-plane/envoy/type/v3"
+
+	"github.com/kagenti/kagenti-extensions/AuthBridge/AuthProxy/internal/mcpauth"
+)
+
+// mcpAuth is the MCP authorization spec mode (MCP_AUTH=true), nil when off.
+// In this mode inbound 401s point clients at the protected resource metadata,
+// the metadata endpoint needs no token, and tokens must be bound to
+// MCP_RESOURCE by audience.
+var mcpAuth *mcpauth.Config
+
+func loadMCPAuthConfig(env mcpauth.Env) {
+	cfg, err := env.Config(inboundIssuer)
+	if err != nil {
+		fatal("Invalid MCP authorization config", "error", err)
+	}
+	if cfg == nil {
+		return
+	}
+	mcpAuth = cfg
+	inboundLog.Info("MCP authorization mode enabled", "resource", cfg.Resource,
+		"authorization_servers", cfg.AuthorizationServers, "metadata_url", cfg.MetadataURL(), "forward_metadata", cfg.Forward)
+}
+
+// mcpMetadataResponse answers a request for the protected resource metadata,
+// or returns nil for any other request. Forwarded metadata requests reach the
+// MCP server without a token.
+func mcpMetadataResponse(headers []*core.HeaderValue) *v3.ProcessingResponse {
+	if mcpAuth == nil || !mcpAuth.IsMetadataPath(getHeaderValue(headers, ":path")) {
+		return nil
+	}
+	if mcpAuth.Forward {
+		inboundLog.Debug("Forwarding protected resource metadata request")
+		return requestHeadersResponse(&v3.HeaderMutation{RemoveHeaders: []string{"x-authbridge-direction"}})
+	}
+
+	body, _ := json.Marshal(mcpAuth.Metadata())
+	return &v3.ProcessingResponse{
+		Response: &v3.ProcessingResponse_ImmediateResponse{
+			ImmediateResponse: &v3.ImmediateResponse{
+				Status: &typev3.HttpStatus{Code: typev3.StatusCode_OK},
+				Headers: &v3.HeaderMutation{SetHeaders: []*core.HeaderValueOption{
+					{Header: &core.HeaderValue{Key: "content-type", RawValue: []byte("application/json")}},
+					{Header: &core.HeaderValue{Key: "cache-control", RawValue: []byte("max-age=3600")}},
+				}},
+				Body:    body,
+				Details: "mcp_resource_metadata",
+			},
+		},
+	}
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"strings"
+)
+
+// startMetricsServer serves Prometheus metrics on addr (METRICS_ADDRESS,
+// e.g. ":9091"). It is off when addr is empty. Scrapers that accept
+// OpenMetrics get it, with trace exemplars on the exchange latency.
+func startMetricsServer(addr string) {
+	if addr == "" {
+		return
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/metrics", func(w http.ResponseWriter, r *http.Request) {
+		openMetrics := strings.Contains(r.Header.Get("Accept"), "application/openmetrics-text")
+		var buf bytes.Buffer
+		exchangeBreakers.WriteMetrics(&buf, "authbridge_token_endpoint_breaker")
+		streamLimiter.WriteMetrics(&buf, "authbridge_ext_proc_streams")
+		writeAuditMetrics(&buf)
+		writeReloadMetrics(&buf)
+		writeCacheReuseMetrics(&buf)
+		writeRouteValidationMetrics(&buf)
+		writeRouteSourceMetrics(&buf)
+		writeExchangeMetrics(&buf, openMetrics)
+		if openMetrics {
+			w.Header().Set("Content-Type", "application/openmetrics-text; version=1.0.0; charset=utf-8")
+			w.Write(toOpenMetrics(buf.Bytes()))
+			return
+		}
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		w.Write(buf.Bytes())
+	})
+	go func() {
+		rootLogger.Info("Serving metrics", "address", addr)
+		if err := http.ListenAndServe(addr, mux); err != nil {
+			fatal("Metrics server failed", "error", err)
+		}
+	}()
+}
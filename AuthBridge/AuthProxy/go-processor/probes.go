@@ -0,0 +1,43 @@
+package main
+
+import (
+	"net"
+	"strings"
+
+	core "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
+)
+
+// inboundProbePaths holds "port:path" pairs of the app's kubelet probes that
+// may reach the app without a token. Set by the webhook via
+// INBOUND_PROBE_PATHS when the platform's proxy.probeMode is allow-paths.
+var inboundProbePaths map[string]bool
+
+func loadProbeConfig(paths []string) {
+	if len(paths) == 0 {
+		return
+	}
+	inboundProbePaths = make(map[string]bool)
+	for _, entry := range paths {
+		inboundProbePaths[entry] = true
+	}
+	inboundLog.Info("Probe paths allowed without a token", "paths", paths)
+}
+
+// isProbeRequest reports whether an inbound request is a GET/HEAD on an
+// exact probe port and path. Query strings are ignored, like kubelet does
+// when matching the configured path.
+func isProbeRequest(headers []*core.HeaderValue) bool {
+	if len(inboundProbePaths) == 0 {
+		return false
+	}
+	method := getHeaderValue(headers, ":method")
+	if method != "GET" && method != "HEAD" {
+		return false
+	}
+	_, port, err := net.SplitHostPort(getHostFromHeaders(headers))
+	if err != nil {
+		return false
+	}
+	path, _, _ := strings.Cut(getHeaderValue(headers, ":path"), "?")
+	return inboundProbePaths[port+":"+path]
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	core "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
+	v3 "github.com/envoyproxy/go-control-plane/envoy/service/ext_proc/v3"
+	typev3 "github.com/envoyproxy/go-control-plane/envoy/type/v3"
+)
+
+// RFC 6750 section 3.1 error codes used in deny responses.
+const (
+	errInvalidToken      = "invalid_token"
+	errInsufficientScope = "insufficient_scope"
+)
+
+// Bearer challenge parameters. Configurable via WWW_AUTHENTICATE_REALM and
+// WWW_AUTHENTICATE_SCOPE (the scope clients should request, if any).
+var (
+	challengeRealm = "authbridge"
+	challengeScope string
+)
+
+// challengeEnv configures the Bearer challenge of inbound 401s.
+type challengeEnv struct {
+	Realm string `env:"WWW_AUTHENTICATE_REALM" default:"authbridge" doc:"realm of WWW-Authenticate challenges"`
+	Scope string `env:"WWW_AUTHENTICATE_SCOPE" doc:"scope clients should request, sent in WWW-Authenticate challenges"`
+}
+
+func loadChallengeConfig(env challengeEnv) {
+	challengeRealm = env.Realm
+	challengeScope = env.Scope
+	inboundLog.Info("WWW-Authenticate challenge configured", "realm", challengeRealm, "scope", challengeScope)
+}
+
+// problem is an RFC 9457 problem details body extended with the RFC 6750
+// error fields, so MCP clients can branch on error without parsing text.
+type problem struct {
+	Type             string `json:"type"`
+	Title            string `json:"title"`
+	Status           int    `json:"status"`
+	Detail           string `json:"detail,omitempty"`
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description,omitempty"`
+}
+
+// bearerChallenge builds a WWW-Authenticate value. errorCode is empty when
+// the request carried no credentials (RFC 6750 section 3.1).
+func bearerChallenge(errorCode, description string) string {
+	params := []string{fmt.Sprintf("realm=%q", challengeRealm)}
+	if challengeScope != "" {
+		params = append(params, fmt.Sprintf("scope=%q", challengeScope))
+	}
+	// MCP clients discover the authorization server from here
+	if mcpAuth != nil {
+		params = append(params, mcpAuth.Challenge())
+	}
+	// Requests without credentials get no error information (section 3.1)
+	if errorCode == "" {
+		return "Bearer " + strings.Join(params, ", ")
+	}
+	params = append(params, fmt.Sprintf("error=%q", errorCode))
+	if description != "" {
+		// Quoted-string may not contain '"' or '\'; RFC 6750 restricts
+		// error_description to printable ASCII without those.
+		clean := strings.Map(func(r rune) rune {
+			if r == '"' || r == '\\' || r < 0x20 || r > 0x7e {
+				return '\''
+			}
+			return r
+		}, description)
+		params = append(params, fmt.Sprintf("error_description=%q", clean))
+	}
+	return "Bearer " + strings.Join(params, ", ")
+}
+
+// problemResponse returns an immediate problem+json response. 401s always
+// carry a Bearer challenge; 403s only when errorCode is set, since not every
+// 403 (e.g. CSRF) is about the token.
+func problemResponse(code typev3.StatusCode, errorCode, description, details string) *v3.ProcessingResponse {
+	status := int(code)
+	title := http.StatusText(status)
+	bodyError := errorCode
+	if bodyError == "" {
+		bodyError = strings.ToLower(strings.ReplaceAll(title, " ", "_"))
+	}
+	body, _ := json.Marshal(problem{
+		Type:             "about:blank",
+		Title:            title,
+		Status:           status,
+		Detail:           description,
+		Error:            bodyError,
+		ErrorDescription: description,
+	})
+
+	headers := []*core.HeaderValueOption{{
+		Header: &core.HeaderValue{Key: "content-type", RawValue: []byte("application/problem+json")},
+	}}
+	if code == typev3.StatusCode_Unauthorized || errorCode != "" {
+		headers = append(headers, &core.HeaderValueOption{
+			Header: &core.HeaderValue{Key: "www-authenticate", RawValue: []byte(bearerChallenge(errorCode, description))},
+		})
+	}
+
+	return &v3.ProcessingResponse{
+		Response: &v3.ProcessingResponse_ImmediateResponse{
+			ImmediateResponse: &v3.ImmediateResponse{
+				Status:  &typev3.HttpStatus{Code: code},
+				Headers: &v3.HeaderMutation{SetHeaders: headers},
+				Body:    body,
+				Details: details,
+			},
+		},
+	}
+}
@@ -0,0 +1,248 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+
+	"github.com/kagenti/kagenti-extensions/AuthBridge/AuthProxy/go-processor/internal/claims"
+	"github.com/kagenti/kagenti-extensions/AuthBridge/AuthProxy/go-processor/internal/resolver"
+)
+
+// reloadEnv configures file reloads.
+type reloadEnv struct {
+	WatchInterval time.Duration `env:"RELOAD_WATCH_INTERVAL" default:"10s" doc:"How often the configuration files are polled for changes; 0 reloads on SIGHUP only"`
+	Debounce      time.Duration `env:"RELOAD_DEBOUNCE" default:"1s" doc:"Quiet time after a file event before reloading"`
+}
+
+var (
+	claimRulesMu sync.RWMutex
+	// reloadsSucceeded and reloadsFailed count file reloads for /metrics
+	reloadsSucceeded, reloadsFailed atomic.Uint64
+)
+
+func getClaimRules() []claims.Rule {
+	claimRulesMu.RLock()
+	defer claimRulesMu.RUnlock()
+	return claimRules
+}
+
+func setClaimRules(rules []claims.Rule) {
+	claimRulesMu.Lock()
+	defer claimRulesMu.Unlock()
+	claimRules = rules
+}
+
+// reloader re-reads the routes and claim assertion files without a restart,
+// so long-lived SSE and WebSocket sessions survive configuration changes.
+type reloader struct {
+	routes     *resolver.StaticResolver
+	routesPath string
+	claimsPath string
+
+	mu   sync.Mutex
+	seen map[string][]byte
+	// absent are the files missing since startup, which mean no routes or no
+	// claim assertions. Any other file missing on reload is an error, e.g. a
+	// volume being remounted, rather than a reason to drop every rule.
+	absent map[string]bool
+	// routesPushed and claimsPushed are set once the config service applied
+	// that type; its file is no longer reloaded
+	routesPushed bool
+	claimsPushed bool
+}
+
+func newReloader(routes *resolver.StaticResolver, routesPath, claimsPath string) *reloader {
+	r := &reloader{routes: routes, routesPath: routesPath, claimsPath: claimsPath, absent: map[string]bool{}}
+	for _, path := range []string{routesPath, claimsPath} {
+		if _, err := os.Stat(path); os.IsNotExist(err) {
+			r.absent[path] = true
+		}
+	}
+	return r
+}
+
+// reload validates both files before swapping either; on error the running
+// configuration is kept.
+func (r *reloader) reload() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if !r.claimsPushed {
+		if err := r.checkPresent(r.claimsPath); err != nil {
+			return fmt.Errorf("claim assertions %s: %w", r.claimsPath, err)
+		}
+	}
+	if !r.routesPushed {
+		if err := r.checkPresent(r.routesPath); err != nil {
+			return fmt.Errorf("routes %s: %w", r.routesPath, err)
+		}
+	}
+
+	var rules []claims.Rule
+	if !r.claimsPushed {
+		var err error
+		if rules, err = claims.LoadRules(r.claimsPath); err != nil {
+			return fmt.Errorf("claim assertions %s: %w", r.claimsPath, err)
+		}
+	}
+	if !r.routesPushed {
+		if err := r.routes.Reload(r.routesPath); err != nil {
+			return fmt.Errorf("routes %s: %w", r.routesPath, err)
+		}
+	}
+	if !r.claimsPushed {
+		setClaimRules(rules)
+	}
+	// Files loaded once stay required
+	for path := range r.absent {
+		if _, err := os.Stat(path); err == nil {
+			delete(r.absent, path)
+		}
+	}
+	return nil
+}
+
+// checkPresent fails if path is missing and was not missing since startup.
+func (r *reloader) checkPresent(path string) error {
+	if _, err := os.Stat(path); err != nil && !(os.IsNotExist(err) && r.absent[path]) {
+		return err
+	}
+	return nil
+}
+
+// changed reports whether any watched file's content differs from the last
+// call. Content is compared rather than mtimes because Kubernetes updates
+// mounted ConfigMaps by swapping symlinks.
+func (r *reloader) changed() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.seen == nil {
+		r.seen = make(map[string][]byte)
+	}
+	changed := false
+	for _, path := range []string{r.routesPath, r.claimsPath} {
+		content, _ := os.ReadFile(path)
+		if prev, ok := r.seen[path]; ok && !bytes.Equal(prev, content) {
+			changed = true
+		}
+		r.seen[path] = content
+	}
+	return changed
+}
+
+func (r *reloader) reloadAndLog(trigger string) {
+	if err := r.reload(); err != nil {
+		reloadsFailed.Add(1)
+		reloadLog.Error("Reload failed, keeping current configuration", "trigger", trigger, "error", err)
+		return
+	}
+	reloadsSucceeded.Add(1)
+	reloadLog.Info("Routes and claim assertions reloaded", "trigger", trigger)
+}
+
+// reloadIfChanged reloads if a watched file's content changed.
+func (r *reloader) reloadIfChanged(trigger string) {
+	if r.changed() {
+		r.reloadAndLog(trigger)
+	}
+}
+
+// writeReloadMetrics writes the reload counters in the Prometheus text
+// format.
+func writeReloadMetrics(w io.Writer) {
+	fmt.Fprintf(w, "# HELP authbridge_config_reloads_total Reloads of the routes and claim assertion files, by result.\n")
+	fmt.Fprintf(w, "# TYPE authbridge_config_reloads_total counter\n")
+	fmt.Fprintf(w, "authbridge_config_reloads_total{result=\"success\"} %d\n", reloadsSucceeded.Load())
+	fmt.Fprintf(w, "authbridge_config_reloads_total{result=\"failure\"} %d\n", reloadsFailed.Load())
+}
+
+// watch reloads once the directories of the watched files have been quiet
+// for debounce after a change. Kubernetes updates mounted ConfigMaps by
+// swapping the ..data symlink, which only shows as events on the directory,
+// so directories are watched and contents compared as when polling. It
+// reports whether any directory is watched.
+func (r *reloader) watch(debounce time.Duration) bool {
+	w, err := fsnotify.NewWatcher()
+	if err != nil {
+		reloadLog.Warn("Cannot watch files, polling only", "error", err)
+		return false
+	}
+	watched := 0
+	for _, dir := range []string{filepath.Dir(r.routesPath), filepath.Dir(r.claimsPath)} {
+		if err := w.Add(dir); err != nil {
+			reloadLog.Warn("Cannot watch directory, polling only", "dir", dir, "error", err)
+			continue
+		}
+		watched++
+	}
+	if watched == 0 {
+		w.Close()
+		return false
+	}
+
+	go func() {
+		var settled *time.Timer
+		for {
+			select {
+			case _, ok := <-w.Events:
+				if !ok {
+					return
+				}
+				if settled == nil {
+					settled = time.AfterFunc(debounce, func() { r.reloadIfChanged("file event") })
+				} else {
+					settled.Reset(debounce)
+				}
+			case err, ok := <-w.Errors:
+				if !ok {
+					return
+				}
+				reloadLog.Warn("File watch error", "error", err)
+			}
+		}
+	}()
+	return true
+}
+
+// start reloads on SIGHUP and, unless RELOAD_WATCH_INTERVAL=0, whenever a
+// watched file changes: on file events, debounced by RELOAD_DEBOUNCE, and by
+// polling every RELOAD_WATCH_INTERVAL in case events are missed.
+func (r *reloader) start(env reloadEnv) {
+	interval, debounce := env.WatchInterval, env.Debounce
+	if interval < 0 || debounce < 0 {
+		fatal("Invalid RELOAD_WATCH_INTERVAL or RELOAD_DEBOUNCE", "interval", interval, "debounce", debounce)
+	}
+
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	go func() {
+		for range hup {
+			r.reloadAndLog("SIGHUP")
+		}
+	}()
+
+	if interval == 0 {
+		reloadLog.Info("Reloading on SIGHUP only")
+		return
+	}
+	r.changed() // record the initial contents
+	watching := r.watch(debounce)
+	go func() {
+		for range time.Tick(interval) {
+			r.reloadIfChanged("file change")
+		}
+	}()
+	reloadLog.Info("Reloading on SIGHUP and on file changes", "routes", r.routesPath, "claims", r.claimsPath,
+		"interval", interval, "file_events", watching, "debounce", debounce)
+}
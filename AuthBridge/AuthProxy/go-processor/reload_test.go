@@ -0,0 +1,115 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/kagenti/kagenti-extensions/AuthBridge/AuthProxy/go-processor/internal/resolver"
+)
+
+func writeFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatalf("failed to write %s: %v", path, err)
+	}
+}
+
+func TestReload_MissingFileKeepsConfiguration(t *testing.T) {
+	dir := t.TempDir()
+	routesPath := filepath.Join(dir, "routes.yaml")
+	claimsPath := filepath.Join(dir, "claim-assertions.yaml")
+	writeFile(t, routesPath, `
+- host: "service-a.example.com"
+  target_audience: "audience-a"
+`)
+	writeFile(t, claimsPath, `
+- "azp exists"
+`)
+	routes, err := resolver.NewStaticResolver(routesPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { setClaimRules(nil) })
+	r := newReloader(routes, routesPath, claimsPath)
+	if err := r.reload(); err != nil {
+		t.Fatalf("reload: %v", err)
+	}
+
+	for _, path := range []string{routesPath, claimsPath} {
+		content, _ := os.ReadFile(path)
+		if err := os.Remove(path); err != nil {
+			t.Fatal(err)
+		}
+		if err := r.reload(); err == nil {
+			t.Errorf("reload without %s succeeded", filepath.Base(path))
+		}
+		if len(routes.Routes()) != 1 || len(getClaimRules()) != 1 {
+			t.Errorf("without %s: %d routes and %d claim rules, want the current 1 and 1",
+				filepath.Base(path), len(routes.Routes()), len(getClaimRules()))
+		}
+		writeFile(t, path, string(content))
+	}
+}
+
+func TestReload_FileMissingSinceStartup(t *testing.T) {
+	dir := t.TempDir()
+	routesPath := filepath.Join(dir, "routes.yaml")
+	claimsPath := filepath.Join(dir, "claim-assertions.yaml")
+	routes, err := resolver.NewStaticResolver(routesPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { setClaimRules(nil) })
+	r := newReloader(routes, routesPath, claimsPath)
+	if err := r.reload(); err != nil {
+		t.Fatalf("files absent since startup mean no routes and no claim rules, got %v", err)
+	}
+
+	writeFile(t, claimsPath, `
+- "azp exists"
+`)
+	if err := r.reload(); err != nil {
+		t.Fatalf("reload: %v", err)
+	}
+	if err := os.Remove(claimsPath); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.reload(); err == nil {
+		t.Error("reload succeeded after a loaded claim assertions file was removed")
+	}
+	if len(getClaimRules()) != 1 {
+		t.Errorf("claim rules = %d, want the current 1", len(getClaimRules()))
+	}
+}
+
+func TestReloadCredentials_PrivateKeyJWTWithoutSecret(t *testing.T) {
+	dir := t.TempDir()
+	clientIDFile := filepath.Join(dir, "client-id.txt")
+	clientSecretFile := filepath.Join(dir, "client-secret.txt")
+	writeFile(t, clientIDFile, "agent-v2\n")
+
+	globalConfig.mu.Lock()
+	prevID, prevSecret := globalConfig.ClientID, globalConfig.ClientSecret
+	globalConfig.ClientID, globalConfig.ClientSecret = "agent-v1", ""
+	globalConfig.mu.Unlock()
+	prevMethod := clientAuthMethod
+	t.Cleanup(func() {
+		clientAuthMethod = prevMethod
+		globalConfig.mu.Lock()
+		globalConfig.ClientID, globalConfig.ClientSecret = prevID, prevSecret
+		globalConfig.mu.Unlock()
+	})
+
+	clientAuthMethod = clientSecretPost
+	reloadCredentials(clientIDFile, clientSecretFile)
+	if globalConfig.ClientID != "agent-v1" {
+		t.Errorf("client_secret_post without a secret file: client ID = %q, want the current agent-v1", globalConfig.ClientID)
+	}
+
+	clientAuthMethod = privateKeyJWT
+	reloadCredentials(clientIDFile, clientSecretFile)
+	if globalConfig.ClientID != "agent-v2" {
+		t.Errorf("private_key_jwt without a secret file: client ID = %q, want agent-v2", globalConfig.ClientID)
+	}
+}
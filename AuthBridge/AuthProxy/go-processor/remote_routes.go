@@ -0,0 +1,28 @@
+package main
+
+import (
+	"net/http"
+	"net/url"
+
+	"github.com/kagenti/kagenti-extensions/AuthBridge/AuthProxy/go-processor/internal/resolver"
+)
+
+// remoteResolver returns the resolver for ROUTES_SERVICE_URL: routes are
+// fetched from the policy service per host and cached.
+func remoteResolver(env processorEnv) *resolver.HTTPResolver {
+	u, err := url.Parse(env.RoutesServiceURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		fatal("Invalid ROUTES_SERVICE_URL", "value", env.RoutesServiceURL)
+	}
+	if env.RoutesServiceTTL <= 0 || env.RoutesServiceNegativeTTL <= 0 || env.RoutesServiceTimeout <= 0 {
+		fatal("ROUTES_SERVICE_TTL, ROUTES_SERVICE_NEGATIVE_TTL and ROUTES_SERVICE_TIMEOUT must be positive")
+	}
+	resolverLog.Info("Resolving routes with a policy service",
+		"url", u.Redacted(), "ttl", env.RoutesServiceTTL, "negative_ttl", env.RoutesServiceNegativeTTL)
+	return &resolver.HTTPResolver{
+		URL:         env.RoutesServiceURL,
+		Client:      &http.Client{Timeout: env.RoutesServiceTimeout},
+		TTL:         env.RoutesServiceTTL,
+		NegativeTTL: env.RoutesServiceNegativeTTL,
+	}
+}
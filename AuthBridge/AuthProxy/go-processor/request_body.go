@@ -0,0 +1,100 @@
+package main
+
+import (
+	"context"
+	"mime"
+	"net/http"
+	"strings"
+
+	core "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
+	extprocfilter "github.com/envoyproxy/go-control-plane/envoy/extensions/filters/http/ext_proc/v3"
+	v3 "github.com/envoyproxy/go-control-plane/envoy/service/ext_proc/v3"
+
+	"github.com/kagenti/kagenti-extensions/AuthBridge/AuthProxy/go-processor/internal/a2a"
+	"github.com/kagenti/kagenti-extensions/AuthBridge/AuthProxy/go-processor/internal/mcpcall"
+	"github.com/kagenti/kagenti-extensions/AuthBridge/AuthProxy/go-processor/internal/resolver"
+)
+
+// Routes whose exchange depends on the request body (mcp_tools, a2a methods)
+// hold back the exchange of JSON POSTs until Envoy has sent the body, then
+// exchange for the MCP tool or A2A method it calls. Envoy keeps the request
+// headers until the body phase is answered, so the exchanged Authorization
+// header is set from the body response.
+
+// waitsForBody reports whether the exchange of a request must wait for its
+// body.
+func waitsForBody(headers []*core.HeaderValue, targetConfig *resolver.TargetConfig, state *streamState) bool {
+	if targetConfig == nil || !targetConfig.InspectsBody() || !state.bodyFollows || state.bodyInspected {
+		return false
+	}
+	return isJSONPost(headers)
+}
+
+// isJSONPost reports whether a request POSTs a JSON body, as JSON-RPC
+// requests of MCP and A2A do.
+func isJSONPost(headers []*core.HeaderValue) bool {
+	if !strings.EqualFold(getHeaderValue(headers, ":method"), http.MethodPost) || isUpgradeRequest(headers) {
+		return false
+	}
+	mediaType, _, err := mime.ParseMediaType(getHeaderValue(headers, "content-type"))
+	return err == nil && mediaType == "application/json"
+}
+
+// waitForBody answers the request headers without exchanging and asks Envoy
+// to buffer the body and send it. Requires allow_mode_override; the body must
+// fit Envoy's buffer limit or Envoy rejects the request with 413.
+func waitForBody(headers *core.HeaderMap, mutation *v3.HeaderMutation, state *streamState) *v3.ProcessingResponse {
+	state.pendingHeaders = headers
+	resp := requestHeadersResponse(mutation)
+	resp.ModeOverride = &extprocfilter.ProcessingMode{
+		RequestHeaderMode:  extprocfilter.ProcessingMode_SEND,
+		ResponseHeaderMode: extprocfilter.ProcessingMode_SKIP,
+		RequestBodyMode:    extprocfilter.ProcessingMode_BUFFERED,
+		ResponseBodyMode:   extprocfilter.ProcessingMode_NONE,
+	}
+	// The override cannot be changed once the exchange happens, so ask for
+	// the response headers now; they are only annotated if it does
+	if exposeExchangeMetadata || respPolicy.active() || state.responseHeaderRules != nil {
+		resp.ModeOverride.ResponseHeaderMode = extprocfilter.ProcessingMode_SEND
+	}
+	return resp
+}
+
+// handleOutboundBody runs the held-back exchange of a request with what its
+// body calls, and returns the result as the body response.
+func (p *processor) handleOutboundBody(ctx context.Context, body *v3.HttpBody, state *streamState) *v3.ProcessingResponse {
+	headers := state.pendingHeaders
+	if headers == nil {
+		return &v3.ProcessingResponse{Response: &v3.ProcessingResponse_RequestBody{RequestBody: &v3.BodyResponse{}}}
+	}
+	state.pendingHeaders = nil
+	state.bodyInspected = true
+	state.mcpTool = mcpcall.ToolName(body.GetBody())
+	state.a2aMethod = a2a.Method(body.GetBody())
+	exchangeLog.Debug("Request body inspected", "host", getHostFromHeaders(headers.Headers),
+		"mcp_tool", state.mcpTool, "a2a_method", state.a2aMethod)
+
+	resp := p.handleOutbound(ctx, headers, state)
+	if rh := resp.GetRequestHeaders(); rh != nil {
+		resp.Response = &v3.ProcessingResponse_RequestBody{
+			RequestBody: &v3.BodyResponse{Response: rh.Response},
+		}
+	}
+	return resp
+}
+
+// a2aPassthrough reports why a request to an A2A target is forwarded with the
+// caller's token unchanged, or "" if it is exchanged: agent card fetches,
+// unless the route exchanges them, and methods with passthrough.
+func a2aPassthrough(headers []*core.HeaderValue, targetConfig *resolver.TargetConfig, state *streamState) string {
+	if targetConfig == nil || targetConfig.A2A == nil {
+		return ""
+	}
+	if !targetConfig.A2A.ExchangeAgentCard && a2a.IsAgentCardRequest(getHeaderValue(headers, ":method"), getHeaderValue(headers, ":path")) {
+		return "agent card"
+	}
+	if m := targetConfig.A2AMethod(state.a2aMethod); m != nil && m.Passthrough {
+		return "method " + m.Method
+	}
+	return ""
+}
@@ -0,0 +1,261 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	core "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
+	v3 "github.com/envoyproxy/go-control-plane/envoy/service/ext_proc/v3"
+)
+
+// exchangeDiagnosticsHeader tells the caller whether its outbound request was
+// exchanged: performed or skipped. Renamed or disabled in the control
+// headers file.
+var exchangeDiagnosticsHeader = "x-authbridge-exchange"
+
+// retryHeader marks an upstream 401 after which a retry gets a fresh token.
+var retryHeader = "x-authbridge-retry"
+
+// What happens to an upstream 401 on an exchanged request
+// (UPSTREAM_401_POLICY).
+const (
+	// upstream401Pass forwards it unchanged.
+	upstream401Pass = "pass"
+	// upstream401Refresh drops the cached token, so the next request gets a
+	// new one, and marks the 401 with x-authbridge-retry: refresh.
+	upstream401Refresh = "refresh"
+	// upstream401Retry also answers 503 with Retry-After: 0, which clients
+	// and Envoy retry policies retry, instead of the 401.
+	upstream401Retry = "retry"
+)
+
+// responsePolicy holds the response header mutations of outbound requests.
+type responsePolicy struct {
+	// stripChallengeDetails reduces WWW-Authenticate to its auth schemes,
+	// dropping realm, error and error_description
+	stripChallengeDetails bool
+	diagnostics           bool
+	upstream401           string
+}
+
+var respPolicy = responsePolicy{upstream401: upstream401Pass}
+
+// responsePolicyEnv configures the response policy.
+type responsePolicyEnv struct {
+	StripChallengeDetails bool   `env:"STRIP_WWW_AUTHENTICATE_DETAILS" doc:"Reduce upstream WWW-Authenticate challenges to their auth schemes"`
+	Diagnostics           bool   `env:"EXCHANGE_DIAGNOSTICS_HEADER" doc:"Add x-authbridge-exchange, the exchange outcome, to every outbound response"`
+	Upstream401           string `env:"UPSTREAM_401_POLICY" default:"pass" doc:"Upstream 401s of exchanged requests: pass, refresh (drop the cached token) or retry (also answer 503 with Retry-After: 0)"`
+}
+
+func loadResponsePolicyConfig(env responsePolicyEnv) {
+	respPolicy.stripChallengeDetails = env.StripChallengeDetails
+	respPolicy.diagnostics = env.Diagnostics
+	respPolicy.upstream401 = env.Upstream401
+	switch respPolicy.upstream401 {
+	case upstream401Pass, upstream401Refresh, upstream401Retry:
+	default:
+		fatal("Invalid UPSTREAM_401_POLICY", "value", respPolicy.upstream401)
+	}
+	if respPolicy.active() {
+		exchangeLog.Info("Response policy enabled", "strip_www_authenticate_details", respPolicy.stripChallengeDetails,
+			"diagnostics_header", respPolicy.diagnostics, "upstream_401_policy", respPolicy.upstream401)
+	}
+}
+
+// active reports whether any response may be mutated, before the exchange
+// outcome is known.
+func (p *responsePolicy) active() bool {
+	return p.stripChallengeDetails || p.diagnostics || p.upstream401 != upstream401Pass
+}
+
+// wantsResponseHeaders reports whether the response headers of a request with
+// state must be sent to the ext proc.
+func wantsResponseHeaders(state *streamState) bool {
+	if respPolicy.stripChallengeDetails || respPolicy.diagnostics || state.responseHeaderRules != nil {
+		return true
+	}
+	return state.exchanged && (exposeExchangeMetadata || respPolicy.upstream401 != upstream401Pass)
+}
+
+// applyResponsePolicy adds the policy's mutations of an outbound response to
+// mutation.
+func applyResponsePolicy(headers []*core.HeaderValue, state *streamState, mutation *v3.HeaderMutation) {
+	if respPolicy.diagnostics && exchangeDiagnosticsHeader != "" {
+		outcome := "skipped"
+		if state.exchanged {
+			outcome = "performed"
+		}
+		mutation.SetHeaders = append(mutation.SetHeaders, &core.HeaderValueOption{
+			Header: &core.HeaderValue{Key: exchangeDiagnosticsHeader, RawValue: []byte(outcome)},
+		})
+	}
+	if respPolicy.stripChallengeDetails {
+		stripChallengeDetails(headers, mutation)
+	}
+	if state.exchanged && respPolicy.upstream401 != upstream401Pass &&
+		getHeaderValue(headers, ":status") == strconv.Itoa(http.StatusUnauthorized) {
+		upstreamUnauthorized(state, mutation)
+	}
+}
+
+// stripChallengeDetails replaces the WWW-Authenticate headers with their auth
+// schemes, so upstream error descriptions and realms do not reach the caller.
+func stripChallengeDetails(headers []*core.HeaderValue, mutation *v3.HeaderMutation) {
+	var schemes []string
+	found := false
+	for _, h := range headers {
+		if !strings.EqualFold(h.Key, "www-authenticate") {
+			continue
+		}
+		found = true
+		for _, scheme := range challengeSchemes(string(h.RawValue)) {
+			if !containsFold(schemes, scheme) {
+				schemes = append(schemes, scheme)
+			}
+		}
+	}
+	if !found {
+		return
+	}
+	if len(schemes) == 0 {
+		mutation.RemoveHeaders = append(mutation.RemoveHeaders, "www-authenticate")
+		return
+	}
+	// Overwriting replaces every value of the header
+	mutation.SetHeaders = append(mutation.SetHeaders, &core.HeaderValueOption{
+		Header:       &core.HeaderValue{Key: "www-authenticate", RawValue: []byte(strings.Join(schemes, ", "))},
+		AppendAction: core.HeaderValueOption_OVERWRITE_IF_EXISTS_OR_ADD,
+	})
+}
+
+// challengeSchemes returns the auth schemes of a WWW-Authenticate value
+// (RFC 9110 §11.6.1), e.g. [Bearer DPoP] for
+// `Bearer realm="x", error="invalid_token", DPoP algs="ES256"`. A scheme is a
+// comma-separated element without '='; quoted commas are skipped.
+func challengeSchemes(value string) []string {
+	var schemes []string
+	inQuotes, escaped := false, false
+	start := 0
+	element := func(end int) {
+		e := strings.TrimSpace(value[start:end])
+		if e == "" {
+			return
+		}
+		scheme, rest, _ := strings.Cut(e, " ")
+		if !strings.Contains(scheme, "=") && !strings.HasPrefix(strings.TrimSpace(rest), "=") {
+			schemes = append(schemes, scheme)
+		}
+	}
+	for i := 0; i < len(value); i++ {
+		switch c := value[i]; {
+		case escaped:
+			escaped = false
+		case c == '\\' && inQuotes:
+			escaped = true
+		case c == '"':
+			inQuotes = !inQuotes
+		case c == ',' && !inQuotes:
+			element(i)
+			start = i + 1
+		}
+	}
+	element(len(value))
+	return schemes
+}
+
+func containsFold(list []string, s string) bool {
+	for _, v := range list {
+		if strings.EqualFold(v, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// upstreamUnauthorized handles an upstream 401 on an exchanged request with
+// UPSTREAM_401_POLICY. The cached token the request was sent with, a
+// workload token or an exchanged token with EXCHANGE_CACHE, is dropped so a
+// retry gets a new one; uncached exchanges always exchange again. A token
+// that was itself obtained after a rejection is not retried again: the 401
+// is passed on, so clients and the processor don't loop.
+//
+// The ext proc cannot replay the request: the client or an Envoy retry
+// policy sends it again, so "re-exchange once" is approximated. For uncached
+// exchanges, rejectedExchanges remembers the subject token and exchange
+// parameters, and a second 401 for them within uncachedRejectionWindow is
+// passed on.
+func upstreamUnauthorized(state *streamState, mutation *v3.HeaderMutation) {
+	retry := true
+	switch {
+	case state.workloadToken != nil:
+		retry = state.workloadToken.reject(state.workloadTokenValue)
+		cacheReuse.rejected()
+	case state.exchangeEntry != nil:
+		retry = state.exchangeEntry.reject(state.exchangedToken)
+		cacheReuse.rejected()
+	case state.uncachedExchange != "":
+		retry = rejectedExchanges.reject(state.uncachedExchange, time.Now())
+	}
+	if !retry {
+		exchangeLog.Info("Upstream rejected a token obtained after a previous rejection, passing 401",
+			"workload_token", state.workloadToken != nil)
+		return
+	}
+	exchangeLog.Info("Upstream rejected exchanged token", "policy", respPolicy.upstream401,
+		"workload_token", state.workloadToken != nil, "cached", state.exchangeEntry != nil)
+	if retryHeader != "" {
+		mutation.SetHeaders = append(mutation.SetHeaders, &core.HeaderValueOption{
+			Header: &core.HeaderValue{Key: retryHeader, RawValue: []byte("refresh")},
+		})
+	}
+	if respPolicy.upstream401 == upstream401Retry {
+		mutation.SetHeaders = append(mutation.SetHeaders,
+			&core.HeaderValueOption{Header: &core.HeaderValue{Key: ":status", RawValue: []byte(strconv.Itoa(http.StatusServiceUnavailable))}},
+			&core.HeaderValueOption{Header: &core.HeaderValue{Key: "retry-after", RawValue: []byte("0")}},
+		)
+	}
+}
+
+const (
+	// uncachedRejectionWindow is how long rejectedExchanges remembers an
+	// exchange, enough for the client to retry it.
+	uncachedRejectionWindow = time.Minute
+	// maxUncachedRejections bounds rejectedExchanges; once full, further
+	// 401s are passed on.
+	maxUncachedRejections = 10000
+)
+
+// rejectedExchanges remembers uncached exchanges whose token an upstream
+// rejected, by exchangeKey, so their retry is not retried again.
+var rejectedExchanges = &rejectionMemory{entries: make(map[string]time.Time)}
+
+type rejectionMemory struct {
+	mu      sync.Mutex
+	entries map[string]time.Time
+}
+
+// reject records a 401 for key and reports whether a retry may succeed:
+// false when key was already rejected within uncachedRejectionWindow, or
+// when too many exchanges are remembered to add it.
+func (m *rejectionMemory) reject(key string, now time.Time) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if at, ok := m.entries[key]; ok && now.Sub(at) < uncachedRejectionWindow {
+		return false
+	}
+	if len(m.entries) >= maxUncachedRejections {
+		for k, at := range m.entries {
+			if now.Sub(at) >= uncachedRejectionWindow {
+				delete(m.entries, k)
+			}
+		}
+		if len(m.entries) >= maxUncachedRejections {
+			return false
+		}
+	}
+	m.entries[key] = now
+	return true
+}
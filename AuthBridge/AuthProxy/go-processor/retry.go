@@ -0,0 +1,163 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// exchangeRetryConfig bounds the retries of a token endpoint call. Only
+// transient failures are retried: network errors, per-attempt timeouts, 429
+// and 5xx responses. A 4xx from the IdP (e.g. invalid_grant) is final.
+type exchangeRetryConfig struct {
+	MaxRetries     int
+	BaseDelay      time.Duration
+	MaxDelay       time.Duration
+	AttemptTimeout time.Duration
+}
+
+var exchangeRetry = exchangeRetryConfig{
+	MaxRetries:     2,
+	BaseDelay:      100 * time.Millisecond,
+	MaxDelay:       2 * time.Second,
+	AttemptTimeout: 5 * time.Second,
+}
+
+// exchangeRetryEnv configures retries of token endpoint calls.
+type exchangeRetryEnv struct {
+	MaxRetries     int           `env:"EXCHANGE_MAX_RETRIES" default:"2" doc:"Retries of a failed token endpoint call after the first attempt; 0 disables retries"`
+	BaseDelay      time.Duration `env:"EXCHANGE_RETRY_BASE_DELAY" default:"100ms" doc:"Backoff before the first retry, doubled for each further one"`
+	MaxDelay       time.Duration `env:"EXCHANGE_RETRY_MAX_DELAY" default:"2s" doc:"Longest backoff between retries"`
+	AttemptTimeout time.Duration `env:"EXCHANGE_ATTEMPT_TIMEOUT" default:"5s" doc:"Timeout of a single token endpoint call"`
+}
+
+func loadExchangeRetryConfig(env exchangeRetryEnv) {
+	if env.MaxRetries < 0 {
+		fatal("Invalid EXCHANGE_MAX_RETRIES", "value", env.MaxRetries)
+	}
+	if env.BaseDelay < 0 || env.MaxDelay < 0 {
+		fatal("Invalid EXCHANGE_RETRY_BASE_DELAY or EXCHANGE_RETRY_MAX_DELAY", "base_delay", env.BaseDelay, "max_delay", env.MaxDelay)
+	}
+	if env.AttemptTimeout <= 0 {
+		fatal("EXCHANGE_ATTEMPT_TIMEOUT must be positive")
+	}
+	exchangeRetry = exchangeRetryConfig(env)
+
+	exchangeLog.Info("Token exchange retries",
+		"max_retries", exchangeRetry.MaxRetries, "base_delay", exchangeRetry.BaseDelay,
+		"max_delay", exchangeRetry.MaxDelay, "attempt_timeout", exchangeRetry.AttemptTimeout)
+}
+
+// tokenResponse is the raw outcome of a successful round trip to the token
+// endpoint; the status code may still be an error.
+type tokenResponse struct {
+	StatusCode int
+	RetryAfter string
+	DPoPNonce  string
+	Body       []byte
+}
+
+// postTokenRequest posts the form to the token endpoint, retrying transient
+// failures with jittered exponential backoff. It gives up early when ctx is
+// done, e.g. because the downstream request was cancelled.
+func postTokenRequest(ctx context.Context, tokenURL string, form url.Values) (*tokenResponse, error) {
+	nonceRetried := false
+	for attempt := 0; ; attempt++ {
+		if attempt > 0 {
+			// A client assertion's jti must not be replayed
+			if err := refreshClientAssertion(form, tokenURL); err != nil {
+				return nil, err
+			}
+		}
+		resp, err := postTokenAttempt(ctx, tokenURL, form.Encode())
+		traceTokenAttempt(ctx, tokenURL, attempt, resp, err)
+		if err == nil && !nonceRetried && useDPoPNonce(ctx, resp) {
+			// The IdP wants its nonce in the proof; the next one carries it
+			nonceRetried = true
+			if err := refreshClientAssertion(form, tokenURL); err != nil {
+				return nil, err
+			}
+			resp, err = postTokenAttempt(ctx, tokenURL, form.Encode())
+			traceTokenAttempt(ctx, tokenURL, attempt, resp, err)
+		}
+		retryable := err != nil || resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500
+		if !retryable || attempt >= exchangeRetry.MaxRetries || ctx.Err() != nil {
+			return resp, err
+		}
+
+		delay := backoff(attempt)
+		if resp != nil {
+			if after, perr := strconv.Atoi(resp.RetryAfter); perr == nil && after >= 0 {
+				delay = min(time.Duration(after)*time.Second, exchangeRetry.MaxDelay)
+			}
+			exchangeLog.Warn("Token endpoint returned transient error, retrying",
+				"status", resp.StatusCode, "attempt", attempt+1, "delay", delay)
+		} else {
+			exchangeLog.Warn("Token exchange request failed, retrying",
+				"error", err, "attempt", attempt+1, "delay", delay)
+		}
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return resp, errors.Join(err, ctx.Err())
+		case <-timer.C:
+		}
+	}
+}
+
+func postTokenAttempt(ctx context.Context, tokenURL, form string) (*tokenResponse, error) {
+	ctx, cancel := context.WithTimeout(ctx, exchangeRetry.AttemptTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, tokenURL, strings.NewReader(form))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if err := setDPoPProof(ctx, req); err != nil {
+		return nil, err
+	}
+
+	client, err := tokenHTTPClient(ctx)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("read token exchange response: %w", err)
+	}
+	nonce := resp.Header.Get("DPoP-Nonce")
+	if nonce != "" {
+		dpopNonces.set(tokenURL, nonce)
+	}
+	return &tokenResponse{StatusCode: resp.StatusCode, RetryAfter: resp.Header.Get("Retry-After"), DPoPNonce: nonce, Body: body}, nil
+}
+
+// backoff returns a "full jitter" delay for the given retry: uniformly random
+// up to BaseDelay*2^attempt, capped at MaxDelay.
+func backoff(attempt int) time.Duration {
+	ceiling := exchangeRetry.BaseDelay
+	for i := 0; i < attempt && ceiling < exchangeRetry.MaxDelay; i++ {
+		ceiling *= 2
+	}
+	ceiling = min(ceiling, exchangeRetry.MaxDelay)
+	if ceiling <= 0 {
+		return 0
+	}
+	return rand.N(ceiling)
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"context"
+
+	v3 "github.com/envoyproxy/go-control-plane/envoy/service/ext_proc/v3"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/protobuf/encoding/protojson"
+
+	"github.com/kagenti/kagenti-extensions/AuthBridge/AuthProxy/go-processor/internal/resolver"
+)
+
+const (
+	// routeMetadataKey holds a route in the authbridge dynamic metadata
+	// namespace, as a struct with the keys of a routes file entry
+	routeMetadataKey = "route"
+	// routeGRPCMetadata is the ext_proc stream's gRPC metadata carrying a
+	// route as JSON, set per Envoy route with ExtProcPerRoute overrides
+	routeGRPCMetadata = "x-authbridge-route"
+)
+
+// metadataRoutes compiles the routes Envoy sends with requests.
+var metadataRoutes resolver.MetadataRoutes
+
+// routeFromEnvoy returns the route Envoy configured for the request, or nil
+// when the routes file applies. Dynamic metadata, set per request, wins over
+// the stream's gRPC metadata, set per Envoy route.
+func routeFromEnvoy(ctx context.Context, req *v3.ProcessingRequest) []byte {
+	if route := req.GetMetadataContext().GetFilterMetadata()[traceMetadataNamespace].GetFields()[routeMetadataKey].GetStructValue(); route != nil {
+		doc, err := protojson.Marshal(route)
+		if err != nil {
+			resolverLog.Error("Cannot encode route metadata", "error", err)
+			return nil
+		}
+		return doc
+	}
+	md, _ := metadata.FromIncomingContext(ctx)
+	if values := md.Get(routeGRPCMetadata); len(values) > 0 && values[0] != "" {
+		return []byte(values[0])
+	}
+	return nil
+}
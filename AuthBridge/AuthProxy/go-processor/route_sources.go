@@ -0,0 +1,89 @@
+package main
+
+import (
+	"io"
+	"slices"
+
+	"github.com/kagenti/kagenti-extensions/AuthBridge/AuthProxy/go-processor/internal/resolver"
+)
+
+// Route sources selectable with ROUTE_SOURCES.
+const (
+	// routeSourceFile is the routes file, also updated by reloads and the
+	// config service.
+	routeSourceFile = "file"
+	// routeSourceService is the policy service at ROUTES_SERVICE_URL.
+	routeSourceService = "service"
+)
+
+// routeResolver consults the route sources in ROUTE_SOURCES order.
+var routeResolver *resolver.CompositeResolver
+
+// routeCache caches routeResolver's configurations with ROUTE_CACHE_SIZE,
+// nil without.
+var routeCache *resolver.CachingResolver
+
+// routeSources returns the resolver consulting ROUTE_SOURCES in order, e.g.
+// "service,file" for workload routes of a policy service with the routes
+// file as fallback. Hosts no source has a route for use the global
+// configuration. routes is the routes file's resolver. With ROUTE_CACHE_SIZE
+// the configurations are cached per host, and purged whenever the routes file
+// is reloaded or updated by the config service.
+func routeSources(env processorEnv, routes *resolver.StaticResolver) resolver.TargetResolver {
+	names := env.RouteSources
+	if len(names) == 0 {
+		names = []string{routeSourceFile}
+		if env.RoutesServiceURL != "" {
+			names = []string{routeSourceService}
+		}
+	}
+	var sources []resolver.Source
+	for i, name := range names {
+		if slices.Contains(names[:i], name) {
+			fatal("Route source listed twice in ROUTE_SOURCES", "source", name)
+		}
+		switch name {
+		case routeSourceFile:
+			sources = append(sources, resolver.Source{Name: name, Resolver: routes})
+		case routeSourceService:
+			if env.RoutesServiceURL == "" {
+				fatal("ROUTE_SOURCES includes service without ROUTES_SERVICE_URL")
+			}
+			sources = append(sources, resolver.Source{Name: name, Resolver: remoteResolver(env)})
+		default:
+			fatal("Invalid ROUTE_SOURCES entry", "value", name)
+		}
+	}
+	if env.RoutesServiceURL != "" && !slices.Contains(names, routeSourceService) {
+		resolverLog.Warn("ROUTES_SERVICE_URL is set but not in ROUTE_SOURCES, ignoring it")
+	}
+	resolverLog.Info("Route sources", "order", names)
+	routeResolver = resolver.NewCompositeResolver(sources...)
+	switch {
+	case env.RouteCacheSize < 0:
+		fatal("Invalid ROUTE_CACHE_SIZE", "value", env.RouteCacheSize)
+	case env.RouteCacheSize == 0:
+		return routeResolver
+	case env.RouteCacheTTL <= 0:
+		fatal("Invalid ROUTE_CACHE_TTL", "value", env.RouteCacheTTL)
+	}
+	routeCache = resolver.NewCachingResolver(routeResolver, env.RouteCacheSize, env.RouteCacheTTL)
+	routes.OnChange(func() {
+		if n := routeCache.Purge(); n > 0 {
+			resolverLog.Info("Routes changed, purged route cache", "entries", n)
+		}
+	})
+	resolverLog.Info("Caching routes", "size", env.RouteCacheSize, "ttl", env.RouteCacheTTL)
+	return routeCache
+}
+
+// writeRouteSourceMetrics writes per-source resolution counters and the
+// route cache's in the Prometheus text format.
+func writeRouteSourceMetrics(w io.Writer) {
+	if routeResolver != nil {
+		routeResolver.WriteMetrics(w, "authbridge_route_resolutions")
+	}
+	if routeCache != nil {
+		routeCache.WriteMetrics(w, "authbridge_route_cache")
+	}
+}
@@ -0,0 +1,227 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/kagenti/kagenti-extensions/AuthBridge/AuthProxy/go-processor/internal/resolver"
+)
+
+// How routes are checked against the IdP (ROUTE_VALIDATION).
+const (
+	routeValidationOff = "off"
+	// routeValidationCredentials obtains a token with each route's client
+	// and token endpoint, which catches wrong clients, secrets and URLs.
+	routeValidationCredentials = "credentials"
+	// routeValidationExchange also exchanges that token for the route's
+	// audience and scopes, as a request to the route would.
+	routeValidationExchange = "exchange"
+
+	routeValidationTimeout = 10 * time.Second
+	// defaultRouteHost names the global configuration in check results.
+	defaultRouteHost = "*"
+)
+
+var routeValidation struct {
+	mode     string
+	interval time.Duration
+
+	mu      sync.Mutex
+	results []routeCheck
+}
+
+// routeCheck is the outcome of checking one route.
+type routeCheck struct {
+	host     string
+	audience string
+	// skipped is why the route was not checked, e.g. a passthrough route
+	skipped string
+	err     error
+}
+
+// routeValidationEnv configures route validation.
+type routeValidationEnv struct {
+	Mode     string        `env:"ROUTE_VALIDATION" default:"off" doc:"Check routes in the background: off, credentials (obtain a token with each route's client) or exchange (also exchange it for the route's audience and scopes)"`
+	Interval time.Duration `env:"ROUTE_VALIDATION_INTERVAL" doc:"How often routes are checked again after startup; 0 checks them at startup only"`
+}
+
+func loadRouteValidationConfig(env routeValidationEnv) {
+	routeValidation.mode = env.Mode
+	switch routeValidation.mode {
+	case routeValidationOff, routeValidationCredentials, routeValidationExchange:
+	default:
+		fatal("Invalid ROUTE_VALIDATION", "value", routeValidation.mode)
+	}
+	if env.Interval < 0 {
+		fatal("Invalid ROUTE_VALIDATION_INTERVAL", "value", env.Interval)
+	}
+	routeValidation.interval = env.Interval
+}
+
+// startRouteValidation checks the routes of globalResolver and the global
+// configuration in the background, once and then every
+// ROUTE_VALIDATION_INTERVAL. Failures are logged and exported as metrics;
+// they never stop the processor or change how requests are handled.
+func startRouteValidation() {
+	if routeValidation.mode == routeValidationOff {
+		return
+	}
+	resolverLog.Info("Route validation enabled", "mode", routeValidation.mode, "interval", routeValidation.interval)
+	go func() {
+		validateRoutes()
+		if routeValidation.interval == 0 {
+			return
+		}
+		for range time.Tick(routeValidation.interval) {
+			validateRoutes()
+		}
+	}()
+}
+
+// validateRoutes checks every route once and records the results.
+func validateRoutes() {
+	routes := []resolver.Route{{Host: defaultRouteHost}}
+	if r, ok := globalResolver.(interface{ Routes() []resolver.Route }); ok {
+		routes = append(routes, r.Routes()...)
+	}
+	results := make([]routeCheck, 0, len(routes))
+	failed := 0
+	for _, route := range routes {
+		check := validateRoute(route)
+		switch {
+		case check.skipped != "":
+			resolverLog.Debug("Route not validated", "host", check.host, "reason", check.skipped)
+		case check.err != nil:
+			failed++
+			resolverLog.Error("Route validation failed", "host", check.host, "audience", check.audience, "error", check.err)
+		default:
+			resolverLog.Debug("Route validated", "host", check.host, "audience", check.audience)
+		}
+		results = append(results, check)
+	}
+	resolverLog.Info("Routes validated against the IdP", "routes", len(results), "failed", failed)
+
+	routeValidation.mu.Lock()
+	routeValidation.results = results
+	routeValidation.mu.Unlock()
+}
+
+// validateRoute checks one route with the parameters a request to it would
+// use. The global token endpoint and client apply where the route sets none:
+// the IdP selected by a caller's issuer is not known ahead of requests.
+func validateRoute(route resolver.Route) routeCheck {
+	config := route.Config
+	check := routeCheck{host: route.Host}
+	switch {
+	case config.Passthrough:
+		check.skipped = "passthrough"
+		return check
+	case config.Introspect && !config.ExchangeAfterIntrospection:
+		check.skipped = "introspection only"
+		return check
+	case strings.Contains(config.Audience, "{{") || strings.Contains(config.Scopes, "{{"):
+		check.skipped = "audience or scopes depend on the request"
+		return check
+	}
+
+	clientID, clientSecret, tokenURL, audience, scopes := getConfig()
+	if config.Audience != "" {
+		audience = config.Audience
+	}
+	if config.Scopes != "" {
+		scopes = config.Scopes
+	}
+	if config.TokenEndpoint != "" {
+		tokenURL = config.TokenEndpoint
+	}
+	if config.ClientID != "" {
+		secret, err := resolveSecretRef(config.ClientSecretRef)
+		if err != nil {
+			check.err = fmt.Errorf("read client secret: %w", err)
+			return check
+		}
+		clientID, clientSecret = config.ClientID, secret
+	}
+	if config.MaxScopes != "" {
+		scopes = restrictScopes(scopes, config.MaxScopes)
+	}
+	check.audience = audience
+	if route.Host == defaultRouteHost && (unmatchedHosts == unmatchedPassthrough || unmatchedHosts == unmatchedDeny) {
+		check.skipped = "UNMATCHED_HOSTS=" + unmatchedHosts
+		return check
+	}
+	if route.Host == defaultRouteHost && audience == "" {
+		check.skipped = "no TARGET_AUDIENCE"
+		return check
+	}
+	if !hasClientCredentials(clientID, clientSecret) || tokenURL == "" || audience == "" || (scopes == "" && !config.WorkloadIdentity) {
+		check.err = errors.New("incomplete exchange configuration: needs client credentials, token URL, audience and scopes")
+		return check
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), routeValidationTimeout)
+	defer cancel()
+	tokenCAFile := globalTokenCAFile
+	if config.TokenCAFile != "" {
+		tokenCAFile = config.TokenCAFile
+	}
+	ctx = withTokenCA(ctx, tokenCAFile)
+
+	if config.WorkloadIdentity {
+		// The token the route sends is the check itself
+		_, _, check.err = fetchWorkloadToken(ctx, clientID, clientSecret, tokenURL, audience, scopes)
+		return check
+	}
+	// The client's own token, for the client as audience, stands in for a
+	// caller's token
+	subjectToken, _, err := fetchWorkloadToken(ctx, clientID, clientSecret, tokenURL, clientID, "")
+	if err != nil {
+		check.err = fmt.Errorf("obtain client token: %w", err)
+		return check
+	}
+	if routeValidation.mode == routeValidationExchange {
+		// Through the route's intermediate exchanges, as requests go
+		for _, hop := range config.ExchangeVia {
+			hopURL, hopScopes := hopParameters(hop, tokenURL, scopes)
+			resp, err := exchangeToken(ctx, clientID, clientSecret, hopURL, subjectToken, tokenTypeAccessToken, hop.Audience, hopScopes)
+			if err != nil {
+				check.err = fmt.Errorf("dry-run exchange for intermediate audience %q: %w", hop.Audience, err)
+				return check
+			}
+			subjectToken = resp.AccessToken
+		}
+		if _, err := exchangeToken(ctx, clientID, clientSecret, tokenURL, subjectToken, tokenTypeAccessToken, audience, scopes); err != nil {
+			check.err = fmt.Errorf("dry-run exchange: %w", err)
+		}
+	}
+	return check
+}
+
+// writeRouteValidationMetrics writes the latest route checks in the
+// Prometheus text format.
+func writeRouteValidationMetrics(w io.Writer) {
+	if routeValidation.mode == routeValidationOff {
+		return
+	}
+	routeValidation.mu.Lock()
+	results := routeValidation.results
+	routeValidation.mu.Unlock()
+
+	fmt.Fprintf(w, "# HELP authbridge_route_valid Whether the last check of a route against the IdP succeeded (1) or failed (0).\n")
+	fmt.Fprintf(w, "# TYPE authbridge_route_valid gauge\n")
+	for _, check := range results {
+		if check.skipped != "" {
+			continue
+		}
+		valid := 1
+		if check.err != nil {
+			valid = 0
+		}
+		fmt.Fprintf(w, "authbridge_route_valid{host=%q,audience=%q} %d\n", check.host, check.audience, valid)
+	}
+}
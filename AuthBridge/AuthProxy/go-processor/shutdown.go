@@ -0,0 +1,83 @@
+package main
+
+import (
+	"net"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	v3 "github.com/envoyproxy/go-control-plane/envoy/service/ext_proc/v3"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+// shutdownEnv configures draining. The drain delay keeps accepting new
+// streams while the pod is removed from endpoints; the default sum stays
+// below Kubernetes' default 30s termination grace period.
+type shutdownEnv struct {
+	DrainDelay time.Duration `env:"SHUTDOWN_DRAIN_DELAY" default:"5s" doc:"How long new ext_proc streams are still accepted after SIGTERM"`
+	Timeout    time.Duration `env:"SHUTDOWN_TIMEOUT" default:"20s" doc:"How long open ext_proc streams may take to finish after the drain delay"`
+}
+
+// registerHealth adds the standard grpc.health.v1 service, reporting SERVING
+// for the server as a whole and for the ext_proc service.
+func registerHealth(server *grpc.Server) *health.Server {
+	hs := health.NewServer()
+	hs.SetServingStatus("", healthpb.HealthCheckResponse_SERVING)
+	hs.SetServingStatus(v3.ExternalProcessor_ServiceDesc.ServiceName, healthpb.HealthCheckResponse_SERVING)
+	healthpb.RegisterHealthServer(server, hs)
+	return hs
+}
+
+// serve runs the gRPC server until SIGTERM or SIGINT, then drains: health
+// turns NOT_SERVING, new streams are still accepted for SHUTDOWN_DRAIN_DELAY,
+// and open ext_proc streams get up to SHUTDOWN_TIMEOUT to finish before the
+// remaining ones are closed. Every listener is served by the same server.
+func serve(server *grpc.Server, hs *health.Server, listeners []net.Listener, env shutdownEnv) {
+	drainDelay, timeout := env.DrainDelay, env.Timeout
+	if drainDelay < 0 || timeout < 0 {
+		fatal("Invalid SHUTDOWN_DRAIN_DELAY or SHUTDOWN_TIMEOUT", "drain_delay", drainDelay, "timeout", timeout)
+	}
+
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, syscall.SIGTERM, syscall.SIGINT)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		sig := <-stop
+		rootLogger.Info("Shutting down, draining ext_proc streams", "signal", sig.String(),
+			"drain_delay", drainDelay, "timeout", timeout)
+		hs.Shutdown()
+		time.Sleep(drainDelay)
+
+		stopped := make(chan struct{})
+		go func() {
+			server.GracefulStop()
+			close(stopped)
+		}()
+		select {
+		case <-stopped:
+			rootLogger.Info("All streams drained")
+		case <-time.After(timeout):
+			rootLogger.Warn("Shutdown timeout reached, closing remaining streams")
+			server.Stop()
+		}
+	}()
+
+	var wg sync.WaitGroup
+	for _, lis := range listeners {
+		wg.Add(1)
+		go func(lis net.Listener) {
+			defer wg.Done()
+			if err := server.Serve(lis); err != nil {
+				fatal("Failed to serve", "address", lis.Addr().String(), "error", err)
+			}
+		}(lis)
+	}
+	wg.Wait()
+	<-done
+}
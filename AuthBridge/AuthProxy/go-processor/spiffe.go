@@ -0,0 +1,114 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/kagenti/kagenti-extensions/AuthBridge/AuthProxy/go-processor/internal/workloadapi"
+)
+
+// RFC 8693 token type identifiers.
+const (
+	tokenTypeAccessToken = "urn:ietf:params:oauth:token-type:access_token"
+	tokenTypeJWT         = "urn:ietf:params:oauth:token-type:jwt"
+)
+
+// How the ext proc's own JWT-SVID is used in exchanges (SPIFFE_TOKEN_ROLE).
+const (
+	// svidRoleNone leaves exchanges alone; the SVID may still be used for
+	// client authentication.
+	svidRoleNone = "none"
+	// svidRoleActor is shorthand for ACTOR_TOKEN_SOURCE=svid.
+	svidRoleActor = "actor"
+	// svidRoleSubject exchanges the SVID itself when a request carries no
+	// Authorization header, for calls the workload makes on its own behalf.
+	svidRoleSubject = "subject"
+)
+
+const (
+	defaultSVIDAudience   = "kagenti"
+	svidStartupFetchLimit = 5 * time.Second
+)
+
+var (
+	// workloadSVIDs fetches the ext proc's own SVIDs from the SPIRE agent;
+	// nil unless SPIFFE_ENDPOINT_SOCKET is set
+	workloadSVIDs *workloadapi.Source
+	svidAudience  = defaultSVIDAudience
+	svidTokenRole = svidRoleNone
+	// svidTokenMTLS presents the X.509-SVID as the TLS client certificate on
+	// token endpoint calls
+	svidTokenMTLS bool
+)
+
+// spiffeEnv configures the use of the ext proc's own SVIDs.
+type spiffeEnv struct {
+	EndpointSocket string `env:"SPIFFE_ENDPOINT_SOCKET" doc:"Workload API socket, e.g. unix:///spiffe-workload-api/spire-agent.sock"`
+	JWTAudience    string `env:"SPIFFE_JWT_AUDIENCE" default:"kagenti" doc:"Audience of fetched JWT-SVIDs"`
+	TokenRole      string `env:"SPIFFE_TOKEN_ROLE" default:"none" doc:"Role of the JWT-SVID in exchanges: none, actor or subject"`
+	TokenMTLS      bool   `env:"SPIFFE_TOKEN_MTLS" doc:"Authenticate token endpoint TLS with the X.509-SVID"`
+}
+
+func loadSPIFFEConfig(env spiffeEnv) {
+	socket := env.EndpointSocket
+	svidAudience = env.JWTAudience
+	svidTokenRole = env.TokenRole
+	svidTokenMTLS = env.TokenMTLS
+
+	switch svidTokenRole {
+	case svidRoleNone, svidRoleActor, svidRoleSubject:
+	default:
+		fatal("Invalid SPIFFE_TOKEN_ROLE", "value", svidTokenRole)
+	}
+	if socket == "" {
+		if svidTokenRole != svidRoleNone || svidTokenMTLS {
+			fatal("SPIFFE_TOKEN_ROLE and SPIFFE_TOKEN_MTLS need SPIFFE_ENDPOINT_SOCKET")
+		}
+		return
+	}
+
+	client, err := workloadapi.New(socket)
+	if err != nil {
+		fatal("Invalid SPIFFE_ENDPOINT_SOCKET", "socket", socket, "error", err)
+	}
+	workloadSVIDs = workloadapi.NewSource(client)
+
+	// The agent may still be attesting the pod; requests fetch again later
+	ctx, cancel := context.WithTimeout(context.Background(), svidStartupFetchLimit)
+	defer cancel()
+	if svid, err := workloadSVIDs.JWTSVID(ctx, svidAudience); err != nil {
+		exchangeLog.Warn("Workload API not ready yet", "socket", socket, "error", err)
+	} else {
+		exchangeLog.Info("Using SPIFFE Workload API", "socket", socket, "spiffe_id", svid.SPIFFEID,
+			"audience", svidAudience, "token_role", svidTokenRole, "token_mtls", svidTokenMTLS)
+	}
+}
+
+// currentJWTSVID returns the ext proc's JWT-SVID: from the Workload API when
+// configured, otherwise from the file spiffe-helper writes.
+func currentJWTSVID(ctx context.Context) (string, error) {
+	if workloadSVIDs == nil {
+		svid, err := os.ReadFile(clientAssertionSVIDFile)
+		if err != nil {
+			return "", fmt.Errorf("read JWT-SVID: %w", err)
+		}
+		return strings.TrimSpace(string(svid)), nil
+	}
+	svid, err := workloadSVIDs.JWTSVID(ctx, svidAudience)
+	if err != nil {
+		return "", err
+	}
+	return svid.Token, nil
+}
+
+// svidSubjectToken returns the JWT-SVID to exchange for a request without an
+// Authorization header, or "" when SPIFFE_TOKEN_ROLE is not subject.
+func svidSubjectToken(ctx context.Context) (string, error) {
+	if svidTokenRole != svidRoleSubject {
+		return "", nil
+	}
+	return currentJWTSVID(ctx)
+}
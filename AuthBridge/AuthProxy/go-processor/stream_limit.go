@@ -0,0 +1,48 @@
+package main
+
+import (
+	v3 "github.com/envoyproxy/go-control-plane/envoy/service/ext_proc/v3"
+	"google.golang.org/grpc"
+
+	"github.com/kagenti/kagenti-extensions/AuthBridge/AuthProxy/go-processor/internal/streamlimit"
+)
+
+const defaultMaxStreams = 4096
+
+// processMethod is the full name of the ext_proc stream, one per HTTP request.
+var processMethod = "/" + v3.ExternalProcessor_ServiceDesc.ServiceName + "/Process"
+
+var (
+	streamLimits  = streamlimit.Config{MaxStreams: defaultMaxStreams}
+	streamLimiter = streamlimit.New(streamLimits, processMethod)
+)
+
+// streamLimitEnv configures the ext_proc stream limits.
+type streamLimitEnv struct {
+	MaxStreams  int     `env:"EXT_PROC_MAX_STREAMS" default:"4096" doc:"ext_proc streams served at once; 0 disables the limit"`
+	ClientRate  float64 `env:"EXT_PROC_CLIENT_RPS" doc:"New streams per second per client, i.e. per Envoy; 0 disables the limit"`
+	ClientBurst int     `env:"EXT_PROC_CLIENT_BURST" doc:"Burst of EXT_PROC_CLIENT_RPS; defaults to the rate, rounded up"`
+}
+
+func loadStreamLimitConfig(env streamLimitEnv) {
+	if env.MaxStreams < 0 || env.ClientRate < 0 || env.ClientBurst < 0 {
+		fatal("Invalid ext_proc stream limits", "max_streams", env.MaxStreams,
+			"client_rps", env.ClientRate, "client_burst", env.ClientBurst)
+	}
+	streamLimits = streamlimit.Config(env)
+	streamLimiter = streamlimit.New(streamLimits, processMethod)
+	streamLog.Info("Stream limits", "max_streams", streamLimits.MaxStreams,
+		"client_rps", streamLimits.ClientRate, "client_burst", streamLimits.ClientBurst)
+}
+
+// streamLimitOptions returns the gRPC server options enforcing the limits.
+// Envoy gets RESOURCE_EXHAUSTED for rejected streams and applies the filter's
+// failure_mode_allow.
+func streamLimitOptions() []grpc.ServerOption {
+	opts := []grpc.ServerOption{grpc.StreamInterceptor(streamLimiter.StreamInterceptor())}
+	if streamLimits.MaxStreams > 0 {
+		// No single HTTP/2 connection may open more than the global limit
+		opts = append(opts, grpc.MaxConcurrentStreams(uint32(streamLimits.MaxStreams)))
+	}
+	return opts
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/lestrrat-go/jwx/v2/jwk"
+	"github.com/lestrrat-go/jwx/v2/jwt"
+
+	"github.com/kagenti/kagenti-extensions/AuthBridge/AuthProxy/go-processor/internal/idp"
+)
+
+// subjectTokenValidator checks outbound subject tokens locally before they
+// are exchanged, so malformed, expired or foreign tokens don't cost an IdP
+// round trip. It is an optimization: when the keys cannot be fetched the
+// token is left for the IdP to judge.
+type subjectTokenValidator struct {
+	// cache and jwksURL are empty to share the inbound JWKS cache and URL
+	cache   *jwk.Cache
+	jwksURL string
+	issuer  string
+	// audience is required in the token; empty means the exchanging client
+	audience string
+}
+
+// subjectTokenCheck is set when SUBJECT_TOKEN_VALIDATION=true.
+var subjectTokenCheck *subjectTokenValidator
+
+// subjectTokenEnv configures subject token validation.
+type subjectTokenEnv struct {
+	Enabled     bool          `env:"SUBJECT_TOKEN_VALIDATION" doc:"Verify subject tokens before exchanging them"`
+	JWKSURL     string        `env:"SUBJECT_TOKEN_JWKS_URL" doc:"Keys subject tokens are verified against; defaults to the inbound JWKS"`
+	JWKSRefresh time.Duration `env:"SUBJECT_TOKEN_JWKS_REFRESH" default:"15m" doc:"Minimum refresh interval of SUBJECT_TOKEN_JWKS_URL"`
+	Issuer      string        `env:"SUBJECT_TOKEN_ISSUER" doc:"Expected iss of subject tokens; defaults to ISSUER"`
+	Audience    string        `env:"SUBJECT_TOKEN_AUDIENCE" doc:"Expected aud of subject tokens; defaults to the client ID"`
+}
+
+func loadSubjectTokenConfig(env subjectTokenEnv) {
+	if !env.Enabled {
+		return
+	}
+	v := &subjectTokenValidator{
+		jwksURL:  env.JWKSURL,
+		issuer:   env.Issuer,
+		audience: env.Audience,
+	}
+	if v.issuer == "" {
+		v.issuer = inboundIssuer
+	}
+	if v.issuer == "" && identityProviders == nil {
+		fatal("SUBJECT_TOKEN_VALIDATION needs SUBJECT_TOKEN_ISSUER, ISSUER or identity providers")
+	}
+
+	if v.jwksURL != "" {
+		v.cache = jwk.NewCache(context.Background())
+		if err := v.cache.Register(v.jwksURL, jwk.WithMinRefreshInterval(env.JWKSRefresh)); err != nil {
+			fatal("Invalid SUBJECT_TOKEN_JWKS_URL", "jwks_url", v.jwksURL, "error", err)
+		}
+	} else if jwksCache == nil && identityProviders == nil {
+		fatal("SUBJECT_TOKEN_VALIDATION needs SUBJECT_TOKEN_JWKS_URL, inbound validation or identity providers")
+	}
+
+	subjectTokenCheck = v
+	exchangeLog.Info("Subject token validation enabled", "issuer", v.issuer,
+		"jwks_url", v.jwksURL, "audience", v.audience)
+}
+
+// validate verifies the signature, expiry, issuer and audience of a subject
+// token. clientID is the expected audience unless one is configured. Tokens
+// of a configured identity provider are checked against its keys and issuer.
+func (v *subjectTokenValidator) validate(ctx context.Context, token, clientID string) error {
+	cache, jwksURL, issuer := v.cache, v.jwksURL, v.issuer
+	if p := identityProviders.ForToken(token); p != nil {
+		cache, jwksURL, issuer = idpKeys, p.JWKSURL, p.Issuer
+	} else if cache == nil {
+		cache, jwksURL = jwksCache, getInboundJWKSURL()
+	}
+	if cache == nil || issuer == "" {
+		return fmt.Errorf("subject token rejected: issuer %q not trusted", idp.Issuer(token))
+	}
+	if jwksURL == "" {
+		exchangeLog.Debug("JWKS URL not known yet, leaving subject token to the IdP")
+		return nil
+	}
+	keySet, err := cache.Get(ctx, jwksURL)
+	if err != nil {
+		exchangeLog.Warn("Failed to fetch JWKS, leaving subject token to the IdP", "jwks_url", jwksURL, "error", err)
+		return nil
+	}
+
+	audience := v.audience
+	if audience == "" {
+		audience = clientID
+	}
+	_, err = jwt.Parse([]byte(token),
+		jwt.WithKeySet(keySet),
+		jwt.WithValidate(true),
+		jwt.WithIssuer(issuer),
+		jwt.WithAudience(audience))
+	if err != nil {
+		return fmt.Errorf("subject token rejected: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,215 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"sync"
+	"time"
+)
+
+// globalTokenCAFile is a PEM bundle of extra CAs trusted for token endpoint
+// calls (TOKEN_CA_FILE). Routes may name their own with token_ca_file.
+var globalTokenCAFile string
+
+// tokenTransportConfig shapes the HTTP transport of every token endpoint call.
+type tokenTransportConfig struct {
+	// clientCert authenticates to the token endpoint with mTLS; nil for none
+	clientCert *reloadingCert
+	// proxy overrides HTTPS_PROXY/HTTP_PROXY/NO_PROXY when set
+	proxy func(*http.Request) (*url.URL, error)
+
+	maxIdleConnsPerHost int
+	maxConnsPerHost     int
+	idleConnTimeout     time.Duration
+}
+
+var tokenTransport = tokenTransportConfig{
+	proxy:               http.ProxyFromEnvironment,
+	maxIdleConnsPerHost: 16,
+	idleConnTimeout:     90 * time.Second,
+}
+
+// tokenClientEnv configures the HTTP client of token endpoint calls.
+type tokenClientEnv struct {
+	CAFile              string        `env:"TOKEN_CA_FILE" doc:"Extra CAs trusted for token endpoints"`
+	CertFile            string        `env:"TOKEN_CLIENT_CERT_FILE" doc:"Client certificate for token endpoint mTLS, re-read when it changes"`
+	KeyFile             string        `env:"TOKEN_CLIENT_KEY_FILE" doc:"Private key of TOKEN_CLIENT_CERT_FILE"`
+	ProxyURL            string        `env:"TOKEN_PROXY_URL" doc:"Proxy of token endpoint calls, or direct for none; defaults to HTTPS_PROXY, HTTP_PROXY and NO_PROXY"`
+	MaxIdleConnsPerHost int           `env:"TOKEN_MAX_IDLE_CONNS_PER_HOST" default:"16" doc:"Idle connections kept per token endpoint host"`
+	MaxConnsPerHost     int           `env:"TOKEN_MAX_CONNS_PER_HOST" doc:"Connections per token endpoint host; 0 is unlimited"`
+	IdleConnTimeout     time.Duration `env:"TOKEN_IDLE_CONN_TIMEOUT" default:"90s" doc:"How long idle token endpoint connections are kept"`
+}
+
+func loadTokenClientConfig(env tokenClientEnv) {
+	certFile, keyFile := env.CertFile, env.KeyFile
+	if (certFile == "") != (keyFile == "") {
+		fatal("TOKEN_CLIENT_CERT_FILE and TOKEN_CLIENT_KEY_FILE must be set together")
+	}
+	if certFile != "" {
+		if svidTokenMTLS {
+			fatal("TOKEN_CLIENT_CERT_FILE and SPIFFE_TOKEN_MTLS are exclusive")
+		}
+		tokenTransport.clientCert = &reloadingCert{certFile: certFile, keyFile: keyFile}
+		if _, err := tokenTransport.clientCert.load(); err != nil {
+			fatal("Invalid token endpoint client certificate", "cert_file", certFile, "error", err)
+		}
+	}
+
+	proxy := "environment"
+	switch v := env.ProxyURL; v {
+	case "":
+	case "direct":
+		tokenTransport.proxy = nil
+	default:
+		proxyURL, err := url.Parse(v)
+		if err != nil || proxyURL.Host == "" {
+			fatal("Invalid TOKEN_PROXY_URL", "value", v)
+		}
+		tokenTransport.proxy = http.ProxyURL(proxyURL)
+		proxy = v
+	}
+
+	if env.MaxIdleConnsPerHost < 0 || env.MaxConnsPerHost < 0 || env.IdleConnTimeout < 0 {
+		fatal("Invalid token endpoint connection limits", "max_idle_conns_per_host", env.MaxIdleConnsPerHost,
+			"max_conns_per_host", env.MaxConnsPerHost, "idle_conn_timeout", env.IdleConnTimeout)
+	}
+	tokenTransport.maxIdleConnsPerHost = env.MaxIdleConnsPerHost
+	tokenTransport.maxConnsPerHost = env.MaxConnsPerHost
+	tokenTransport.idleConnTimeout = env.IdleConnTimeout
+	defaultTokenClient = &http.Client{Transport: newTokenTransport(nil)}
+
+	exchangeLog.Info("Token endpoint client",
+		"client_cert", certFile, "svid_mtls", svidTokenMTLS, "proxy", proxy,
+		"max_idle_conns_per_host", tokenTransport.maxIdleConnsPerHost, "max_conns_per_host", tokenTransport.maxConnsPerHost,
+		"idle_conn_timeout", tokenTransport.idleConnTimeout)
+
+	globalTokenCAFile = env.CAFile
+	if globalTokenCAFile == "" {
+		return
+	}
+	if _, err := tokenClients.get(globalTokenCAFile); err != nil {
+		fatal("Invalid TOKEN_CA_FILE", "path", globalTokenCAFile, "error", err)
+	}
+	exchangeLog.Info("Trusting extra CAs for token endpoints", "ca_file", globalTokenCAFile)
+}
+
+// newTokenTransport returns a transport for token endpoint calls trusting
+// roots (nil for the system pool).
+func newTokenTransport(roots *x509.CertPool) *http.Transport {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = tokenTransport.proxy
+	transport.MaxIdleConnsPerHost = tokenTransport.maxIdleConnsPerHost
+	transport.MaxConnsPerHost = tokenTransport.maxConnsPerHost
+	transport.IdleConnTimeout = tokenTransport.idleConnTimeout
+	transport.TLSClientConfig = tokenTLSConfig(roots)
+	return transport
+}
+
+// tokenTLSConfig returns the TLS client config for token endpoint calls,
+// presenting the X.509-SVID (SPIFFE_TOKEN_MTLS) or TOKEN_CLIENT_CERT_FILE as
+// the client certificate when configured.
+func tokenTLSConfig(roots *x509.CertPool) *tls.Config {
+	cfg := &tls.Config{RootCAs: roots, MinVersion: tls.VersionTLS12}
+	switch {
+	case svidTokenMTLS:
+		cfg.GetClientCertificate = func(info *tls.CertificateRequestInfo) (*tls.Certificate, error) {
+			svid, err := workloadSVIDs.X509SVID(info.Context())
+			if err != nil {
+				return nil, fmt.Errorf("X.509-SVID for token endpoint: %w", err)
+			}
+			return svid.TLSCertificate(), nil
+		}
+	case tokenTransport.clientCert != nil:
+		cfg.GetClientCertificate = tokenTransport.clientCert.getClient
+	}
+	return cfg
+}
+
+type tokenCAKey struct{}
+
+// withTokenCA selects the CA bundle for token endpoint calls made with ctx.
+func withTokenCA(ctx context.Context, caFile string) context.Context {
+	return context.WithValue(ctx, tokenCAKey{}, caFile)
+}
+
+// defaultTokenClient makes token endpoint calls without a CA bundle.
+var defaultTokenClient = http.DefaultClient
+
+// tokenHTTPClient returns the client for token endpoint calls made with ctx:
+// defaultTokenClient unless a CA bundle was selected.
+func tokenHTTPClient(ctx context.Context) (*http.Client, error) {
+	caFile, _ := ctx.Value(tokenCAKey{}).(string)
+	if caFile == "" {
+		return defaultTokenClient, nil
+	}
+	return tokenClients.get(caFile)
+}
+
+var tokenClients = &caClientCache{clients: make(map[string]*caClient)}
+
+// caClientCache keeps one HTTP client per CA bundle and rebuilds it when the
+// bundle file changes, so rotated CAs are trusted without a restart.
+type caClientCache struct {
+	mu      sync.Mutex
+	clients map[string]*caClient
+}
+
+type caClient struct {
+	modTime time.Time
+	client  *http.Client
+}
+
+func (c *caClientCache) get(caFile string) (*http.Client, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	cached := c.clients[caFile]
+	info, err := os.Stat(caFile)
+	if err != nil {
+		if cached != nil {
+			return cached.client, nil
+		}
+		return nil, fmt.Errorf("stat CA bundle: %w", err)
+	}
+	if cached != nil && info.ModTime().Equal(cached.modTime) {
+		return cached.client, nil
+	}
+
+	pool, err := loadCABundle(caFile)
+	if err != nil {
+		if cached != nil {
+			// Mid-rotation; keep trusting the previous bundle
+			exchangeLog.Warn("Failed to reload CA bundle, keeping the previous one", "path", caFile, "error", err)
+			return cached.client, nil
+		}
+		return nil, err
+	}
+	c.clients[caFile] = &caClient{modTime: info.ModTime(), client: &http.Client{Transport: newTokenTransport(pool)}}
+	if cached != nil {
+		exchangeLog.Info("Reloaded CA bundle", "path", caFile)
+		// The old transport's idle connections would otherwise linger
+		cached.client.Transport.(*http.Transport).CloseIdleConnections()
+	}
+	return c.clients[caFile].client, nil
+}
+
+// loadCABundle returns the system roots plus the certificates in caFile.
+func loadCABundle(caFile string) (*x509.CertPool, error) {
+	pem, err := os.ReadFile(caFile)
+	if err != nil {
+		return nil, fmt.Errorf("read CA bundle: %w", err)
+	}
+	pool, err := x509.SystemCertPool()
+	if err != nil {
+		pool = x509.NewCertPool()
+	}
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("no certificates found in %s", caFile)
+	}
+	return pool, nil
+}
@@ -0,0 +1,29 @@
+package main
+
+import "fmt"
+
+// How requests to hosts without a route are handled (UNMATCHED_HOSTS).
+const (
+	// unmatchedGlobal exchanges with the global configuration when it is
+	// complete and forwards the request unchanged otherwise or on failure
+	unmatchedGlobal = "global"
+	// unmatchedPassthrough forwards the request unchanged
+	unmatchedPassthrough = "passthrough"
+	// unmatchedExchange exchanges with the global configuration and rejects
+	// requests it cannot exchange, like a route with require_exchange
+	unmatchedExchange = "exchange"
+	// unmatchedDeny rejects the request with 403
+	unmatchedDeny = "deny"
+)
+
+var unmatchedHosts = unmatchedGlobal
+
+// setUnmatchedHosts sets the handling of hosts without a route.
+func setUnmatchedHosts(mode string) error {
+	switch mode {
+	case unmatchedGlobal, unmatchedPassthrough, unmatchedExchange, unmatchedDeny:
+		unmatchedHosts = mode
+		return nil
+	}
+	return fmt.Errorf("unknown mode %q, want %s, %s, %s or %s", mode, unmatchedGlobal, unmatchedPassthrough, unmatchedExchange, unmatchedDeny)
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+
+	"github.com/kagenti/kagenti-extensions/AuthBridge/AuthProxy/go-processor/internal/resolver"
+)
+
+var validateRoutesPath = flag.String("validate-routes", "",
+	`check the routes file at this path as STRICT_ROUTES would, print the route each argument ("[METHOD ]host[/path]") matches and exit`)
+
+// runValidateRoutes handles -validate-routes and reports whether it did. It
+// exits with status 1 if the file is missing or has invalid or duplicate
+// routes, e.g.
+//
+//	go-processor -validate-routes routes.yaml api.example.com "POST tools.example.com/mcp"
+func runValidateRoutes() bool {
+	path := *validateRoutesPath
+	if path == "" {
+		return false
+	}
+	// Errors are printed below; the resolver's own logs would repeat them
+	logLevel.Set(max(logLevel.Level(), slog.LevelError))
+	// Reads EXPAND_CONFIG_ENV and ROUTE_MATCHING
+	env := loadProcessorEnv()
+
+	if _, err := os.Stat(path); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	if err := resolver.CheckRoutes(path); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	routes, err := resolver.NewStaticResolver(path)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	if err := routes.SetMatchMode(resolver.MatchMode(env.RouteMatching)); err != nil {
+		fmt.Fprintln(os.Stderr, "ROUTE_MATCHING:", err)
+		os.Exit(1)
+	}
+	fmt.Printf("%s: %d routes OK\n", path, len(routes.Routes()))
+
+	for _, sample := range flag.Args() {
+		method, target := "GET", sample
+		if m, rest, ok := strings.Cut(sample, " "); ok {
+			method, target = strings.ToUpper(m), rest
+		}
+		host, requestPath := target, "/"
+		if i := strings.Index(target, "/"); i >= 0 {
+			host, requestPath = target[:i], target[i:]
+		}
+		ctx := resolver.WithRequestHeaders(context.Background(), map[string]string{
+			":method": method, ":path": requestPath, ":authority": host,
+		})
+		route, err := routes.Match(ctx, host)
+		switch {
+		case err != nil:
+			fmt.Printf("%s %s%s: %v\n", method, host, requestPath, err)
+		case route == nil:
+			fmt.Printf("%s %s%s: no route (UNMATCHED_HOSTS decides)\n", method, host, requestPath)
+		default:
+			fmt.Printf("%s %s%s: [%d] %s: %s\n", method, host, requestPath, route.Index, describeMatchers(route), describeAction(&route.Config))
+		}
+	}
+	return true
+}
+
+// describeMatchers names a route by its host pattern and request matchers.
+func describeMatchers(route *resolver.Route) string {
+	s := route.Host
+	if route.Config.PathPrefix != "" {
+		s += " path_prefix " + route.Config.PathPrefix
+	}
+	if route.Config.Path != "" {
+		s += " path " + route.Config.Path
+	}
+	if len(route.Config.Methods) > 0 {
+		s += " methods " + strings.Join(route.Config.Methods, ",")
+	}
+	return s
+}
+
+// describeAction summarizes what the processor does with a request a route
+// applies to.
+func describeAction(config *resolver.TargetConfig) string {
+	switch {
+	case config.Passthrough:
+		return "passthrough"
+	case config.WorkloadIdentity:
+		return "workload identity"
+	case config.Introspect && !config.ExchangeAfterIntrospection:
+		return "introspection"
+	}
+	s := fmt.Sprintf("exchange for audience %q", config.Audience)
+	if config.Scopes != "" {
+		s += fmt.Sprintf(" scopes %q", config.Scopes)
+	}
+	for _, hop := range config.ExchangeVia {
+		s += fmt.Sprintf(" via %q", hop.Audience)
+	}
+	return s
+}
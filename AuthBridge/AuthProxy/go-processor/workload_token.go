@@ -0,0 +1,250 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	core "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
+	v3 "github.com/envoyproxy/go-control-plane/envoy/service/ext_proc/v3"
+	typev3 "github.com/envoyproxy/go-control-plane/envoy/type/v3"
+	"github.com/kagenti/kagenti-extensions/AuthBridge/AuthProxy/go-processor/internal/accesslog"
+)
+
+// How workload_identity routes obtain the workload's own token
+// (WORKLOAD_TOKEN_GRANT).
+const (
+	// workloadGrantClientCredentials authenticates as the ext proc's client
+	// with CLIENT_AUTH_METHOD, e.g. a JWT-SVID assertion.
+	workloadGrantClientCredentials = "client_credentials"
+	// workloadGrantTokenExchange exchanges a projected service account token.
+	workloadGrantTokenExchange = "token_exchange"
+)
+
+const (
+	defaultWorkloadSubjectTokenFile = "/var/run/secrets/kubernetes.io/serviceaccount/token"
+	// workloadTokenRefreshFraction of a token's lifetime passes before a new
+	// one is fetched, unless CACHE_REUSE_MODE is adaptive
+	workloadTokenRefreshFraction = 0.8
+)
+
+var (
+	workloadTokenGrant            = workloadGrantClientCredentials
+	workloadSubjectTokenFile      = defaultWorkloadSubjectTokenFile
+	workloadTokens                = &workloadTokenCache{entries: make(map[string]*workloadTokenEntry)}
+	errWorkloadTokenNotConfigured = errors.New("workload token not configured")
+)
+
+// workloadTokenEnv configures how workload_identity routes obtain the
+// workload's own token.
+type workloadTokenEnv struct {
+	Grant            string `env:"WORKLOAD_TOKEN_GRANT" default:"client_credentials" doc:"client_credentials or token_exchange"`
+	SubjectTokenFile string `env:"WORKLOAD_SUBJECT_TOKEN_FILE" default:"/var/run/secrets/kubernetes.io/serviceaccount/token" doc:"Service account token exchanged by token_exchange, re-read for every fetch as the kubelet rotates it in place"`
+}
+
+func loadWorkloadTokenConfig(env workloadTokenEnv) {
+	workloadTokenGrant = env.Grant
+	workloadSubjectTokenFile = env.SubjectTokenFile
+	switch workloadTokenGrant {
+	case workloadGrantClientCredentials, workloadGrantTokenExchange:
+	default:
+		fatal("Invalid WORKLOAD_TOKEN_GRANT", "value", workloadTokenGrant)
+	}
+	exchangeLog.Debug("Workload identity routes", "grant", workloadTokenGrant, "subject_token_file", workloadSubjectTokenFile)
+}
+
+// workloadTokenCache shares the workload's tokens across requests. They carry
+// no user context, so one token per client, token endpoint, audience and
+// scopes serves every request until most of its lifetime has passed.
+type workloadTokenCache struct {
+	mu      sync.Mutex
+	entries map[string]*workloadTokenEntry
+
+	hits, misses atomic.Uint64
+}
+
+type workloadTokenEntry struct {
+	// mu serializes fetches, so concurrent requests wait for one call
+	mu        sync.Mutex
+	token     string
+	expiresAt time.Time
+	refreshAt time.Time
+	// rejected is set when an upstream rejected the entry's token, until
+	// the next fetch; refetched marks a token fetched after that.
+	rejected  bool
+	refetched bool
+}
+
+// reject drops token after an upstream answered it with 401 and reports
+// whether a retry may succeed; see exchangeCacheEntry.reject.
+func (e *workloadTokenEntry) reject(token string) bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.token != token {
+		return true
+	}
+	if e.refetched {
+		return false
+	}
+	e.token = ""
+	e.rejected = true
+	return true
+}
+
+// stats reports the cache for the admin server.
+func (c *workloadTokenCache) stats() cacheStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return cacheStats{Enabled: true, Entries: len(c.entries), Hits: c.hits.Load(), Misses: c.misses.Load()}
+}
+
+// flush drops every cached token and returns how many there were.
+func (c *workloadTokenCache) flush() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	n := len(c.entries)
+	c.entries = make(map[string]*workloadTokenEntry)
+	return n
+}
+
+func (c *workloadTokenCache) entry(clientID, tokenURL, audience, scopes string) *workloadTokenEntry {
+	key := clientID + "\x00" + tokenURL + "\x00" + audience + "\x00" + scopes
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e := c.entries[key]
+	if e == nil {
+		e = &workloadTokenEntry{}
+		c.entries[key] = e
+	}
+	return e
+}
+
+// workloadToken returns a token representing the workload itself for
+// audience, from the cache or the token endpoint. The second result is its
+// remaining lifetime in seconds, 0 if unknown; the third its cache entry.
+func workloadToken(ctx context.Context, clientID, clientSecret, tokenURL, audience, scopes string) (string, int, *workloadTokenEntry, error) {
+	if !hasClientCredentials(clientID, clientSecret) || tokenURL == "" || audience == "" {
+		return "", 0, nil, errWorkloadTokenNotConfigured
+	}
+	e := workloadTokens.entry(clientID, tokenURL, audience, scopes)
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	now := time.Now()
+	if e.token != "" && now.Before(e.refreshAt) {
+		workloadTokens.hits.Add(1)
+		traceStep(ctx, "Workload token from cache", "refresh_at", e.refreshAt)
+		return e.token, int(e.expiresAt.Sub(now).Seconds()), e, nil
+	}
+	workloadTokens.misses.Add(1)
+	traceStep(ctx, "Fetching workload token", "grant", workloadTokenGrant, "cached", e.token != "")
+	token, expiresIn, err := fetchWorkloadToken(ctx, clientID, clientSecret, tokenURL, audience, scopes)
+	if err != nil {
+		return "", 0, nil, err
+	}
+	e.refetched, e.rejected = e.rejected, false
+	// A token without a reported lifetime is not reused
+	lifetime := time.Duration(expiresIn) * time.Second
+	e.token = token
+	e.expiresAt = now.Add(lifetime)
+	e.refreshAt = now.Add(time.Duration(float64(lifetime) * cacheReuse.fraction()))
+	return token, expiresIn, e, nil
+}
+
+// workloadIdentityResponse handles a workload_identity route: the caller's
+// Authorization header, if any, is replaced with the workload's own token.
+// There is no caller token to fall back to, so failures always deny.
+func workloadIdentityResponse(ctx context.Context, headers *core.HeaderMap, state *streamState, mutation *v3.HeaderMutation,
+	requestHost, clientID, clientSecret, tokenURL, audience, scopes string) *v3.ProcessingResponse {
+	// There is no subject token: the workload acts as itself
+	auditFrom(ctx).subjectToken("", clientID)
+	token, expiresIn, entry, err := workloadToken(ctx, clientID, clientSecret, tokenURL, audience, scopes)
+	switch {
+	case errors.Is(err, errWorkloadTokenNotConfigured):
+		exchangeLog.Error("Workload identity route without client credentials, token URL or audience", "host", requestHost)
+		recordExchange(ctx, headers.Headers, requestHost, audience, scopes, accesslog.OutcomeFailed)
+		return problemResponse(typev3.StatusCode_ServiceUnavailable, "", "workload token not configured", "workload_token_not_configured")
+	case errors.Is(err, errCircuitOpen):
+		recordExchange(ctx, headers.Headers, requestHost, audience, scopes, accesslog.OutcomeFailed)
+		return problemResponse(typev3.StatusCode_ServiceUnavailable, "", "token endpoint unavailable", "token_endpoint_circuit_open")
+	case err != nil:
+		exchangeLog.Error("Failed to get workload token", "host", requestHost, "error", err)
+		traceStep(ctx, "Workload token failed", "error", err)
+		recordExchange(ctx, headers.Headers, requestHost, audience, scopes, accesslog.OutcomeFailed)
+		return problemResponse(typev3.StatusCode_BadGateway, "", "workload token request failed", "workload_token_failed")
+	}
+
+	auditFrom(ctx).issuedToken(token)
+	recordExchange(ctx, headers.Headers, requestHost, audience, scopes, accesslog.OutcomeExchanged)
+	state.exchanged = true
+	state.expiresIn = expiresIn
+	state.workloadToken, state.workloadTokenValue = entry, token
+	exchangeLog.Info("Using workload token", "host", requestHost, "audience", audience)
+	traceStep(ctx, "Using workload token", "audience", audience, "scopes", scopes, "expires_in", expiresIn)
+	mutation.SetHeaders = append(mutation.SetHeaders, &core.HeaderValueOption{
+		Header: &core.HeaderValue{Key: "authorization", RawValue: []byte("Bearer " + token)},
+	})
+	return requestHeadersResponse(mutation)
+}
+
+// fetchWorkloadToken requests a workload token with WORKLOAD_TOKEN_GRANT.
+func fetchWorkloadToken(ctx context.Context, clientID, clientSecret, tokenURL, audience, scopes string) (string, int, error) {
+	exchangeLog.Debug("Fetching workload token", "token_url", tokenURL, "grant", workloadTokenGrant, "audience", audience, "scopes", scopes)
+
+	data := url.Values{}
+	if err := setClientAuth(ctx, data, clientID, clientSecret, tokenURL); err != nil {
+		return "", 0, err
+	}
+	if workloadTokenGrant == workloadGrantTokenExchange {
+		saToken, err := os.ReadFile(workloadSubjectTokenFile)
+		if err != nil {
+			return "", 0, fmt.Errorf("read service account token: %w", err)
+		}
+		data.Set("grant_type", "urn:ietf:params:oauth:grant-type:token-exchange")
+		data.Set("requested_token_type", tokenTypeAccessToken)
+		data.Set("subject_token", strings.TrimSpace(string(saToken)))
+		data.Set("subject_token_type", tokenTypeJWT)
+	} else {
+		data.Set("grant_type", "client_credentials")
+	}
+	data.Set("audience", audience)
+	if scopes != "" {
+		data.Set("scope", scopes)
+	}
+
+	cb := exchangeBreakers.Get(tokenURL)
+	if !cb.Allow() {
+		return "", 0, errCircuitOpen
+	}
+	resp, err := postTokenRequest(ctx, tokenURL, data)
+	switch {
+	case ctx.Err() != nil:
+	case err != nil || resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500:
+		cb.Failure()
+	default:
+		cb.Success()
+	}
+	if err != nil {
+		return "", 0, fmt.Errorf("workload token request failed: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", 0, fmt.Errorf("workload token request failed with status %d: %s", resp.StatusCode, string(resp.Body))
+	}
+
+	var tokenResp tokenExchangeResponse
+	if err := json.Unmarshal(resp.Body, &tokenResp); err != nil {
+		return "", 0, fmt.Errorf("parse workload token response: %w", err)
+	}
+	if tokenResp.AccessToken == "" {
+		return "", 0, fmt.Errorf("workload token response has no access_token")
+	}
+	return tokenResp.AccessToken, tokenResp.ExpiresIn, nil
+}
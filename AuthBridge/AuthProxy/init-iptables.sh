@@ -162,8 +162,16 @@ ISTIO_HEALTH_PROBE_SRC="${ISTIO_HEALTH_PROBE_SRC:-169.254.7.127}"
 # as the packet source. The kernel's ip_route_me_harder() re-routes the packet
 # after NAT, and with route_localnet=0 (default) it considers 127.0.0.1 a martian
 # address and drops the packet. Istio sidecar mode uses the same setting.
-# Requires privileged init container (/proc/sys is read-only otherwise).
-sysctl -w net.ipv4.conf.all.route_localnet=1
+# Requires privileged init container (/proc/sys is read-only otherwise). With
+# PROXY_INIT_MINIMAL=1, set by the webhook for proxy.initSecurity "minimal",
+# a failure only warns; otherwise it is fatal like every other step.
+if ! sysctl -w net.ipv4.conf.all.route_localnet=1; then
+  if [ "${PROXY_INIT_MINIMAL:-}" != "1" ]; then
+    echo "ERROR: could not set route_localnet; proxy-init must run privileged"
+    exit 1
+  fi
+  echo "WARNING: could not set route_localnet; inbound interception under Istio ambient mesh requires a privileged proxy-init"
+fi
 
 # =============================================================================
 # OUTBOUND traffic interception (nat OUTPUT)
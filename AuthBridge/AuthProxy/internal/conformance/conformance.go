@@ -0,0 +1,146 @@
+// Package conformance checks that an identity provider's token endpoint
+// handles OAuth 2.0 Token Exchange (RFC 8693) the way AuthBridge needs it.
+// It runs a matrix of exchanges (audience, scopes, down-scoping, actor tokens)
+// and error cases against a live endpoint and reports, per scenario, whether
+// the IdP behaves as expected, so a Keycloak realm or another IdP can be
+// verified before agents depend on it.
+//
+// The suite is read-only for the IdP: it only requests tokens.
+package conformance
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// Token types of RFC 8693 §3.
+const (
+	TokenTypeAccessToken = "urn:ietf:params:oauth:token-type:access_token"
+	TokenTypeJWT         = "urn:ietf:params:oauth:token-type:jwt"
+
+	grantTypeTokenExchange = "urn:ietf:params:oauth:grant-type:token-exchange"
+)
+
+// Config is the endpoint and clients under test. The names of the variables
+// shared with the ext proc are the same, so the suite can run with a
+// sidecar's environment.
+type Config struct {
+	TokenURL     string `env:"TOKEN_URL" doc:"Token endpoint under test"`
+	ClientID     string `env:"CLIENT_ID" doc:"Client that exchanges tokens, as the ext proc does"`
+	ClientSecret string `env:"CLIENT_SECRET" doc:"Secret of CLIENT_ID (client_secret_post)"`
+	Audience     string `env:"TARGET_AUDIENCE" doc:"Audience tokens are exchanged for"`
+	Scopes       string `env:"TARGET_SCOPES" doc:"Space-separated scopes requested in exchanges"`
+
+	// The subject token is given, or obtained with the subject client through
+	// the password or client credentials grant
+	SubjectToken        string `env:"CONFORMANCE_SUBJECT_TOKEN" doc:"Token to exchange, e.g. a user's access token"`
+	SubjectClientID     string `env:"CONFORMANCE_SUBJECT_CLIENT_ID" doc:"Client that obtains the subject token, when CONFORMANCE_SUBJECT_TOKEN is unset"`
+	SubjectClientSecret string `env:"CONFORMANCE_SUBJECT_CLIENT_SECRET" doc:"Secret of the subject client, if confidential"`
+	SubjectUsername     string `env:"CONFORMANCE_SUBJECT_USERNAME" doc:"User of the password grant; without it the client credentials grant is used"`
+	SubjectPassword     string `env:"CONFORMANCE_SUBJECT_PASSWORD" doc:"Password of CONFORMANCE_SUBJECT_USERNAME"`
+
+	ActorToken     string `env:"CONFORMANCE_ACTOR_TOKEN" doc:"Actor token, e.g. a JWT-SVID; the actor scenario is skipped without it"`
+	ActorTokenType string `env:"CONFORMANCE_ACTOR_TOKEN_TYPE" default:"urn:ietf:params:oauth:token-type:jwt" doc:"Token type of CONFORMANCE_ACTOR_TOKEN"`
+	ForbiddenScope string `env:"CONFORMANCE_FORBIDDEN_SCOPE" doc:"A scope CLIENT_ID may not obtain for the audience; the down-scoping scenario is skipped without it"`
+
+	Timeout time.Duration `env:"CONFORMANCE_TIMEOUT" default:"10s" doc:"Timeout of each token request"`
+}
+
+// Validate implements configschema.Validator.
+func (c *Config) Validate() error {
+	switch {
+	case c.TokenURL == "":
+		return errors.New("TOKEN_URL is required")
+	case c.ClientID == "" || c.ClientSecret == "":
+		return errors.New("CLIENT_ID and CLIENT_SECRET are required")
+	case c.Audience == "":
+		return errors.New("TARGET_AUDIENCE is required")
+	case c.SubjectToken == "" && c.SubjectClientID == "":
+		return errors.New("CONFORMANCE_SUBJECT_TOKEN or CONFORMANCE_SUBJECT_CLIENT_ID is required")
+	case c.SubjectUsername != "" && c.SubjectPassword == "":
+		return errors.New("CONFORMANCE_SUBJECT_PASSWORD is required with CONFORMANCE_SUBJECT_USERNAME")
+	}
+	return nil
+}
+
+// Status is the outcome of a scenario.
+type Status string
+
+const (
+	// Pass means the IdP behaved as AuthBridge expects.
+	Pass Status = "pass"
+	// Warn means AuthBridge works, but the IdP deviates from RFC 8693 or
+	// could not be fully checked (e.g. opaque tokens).
+	Warn Status = "warn"
+	// Fail means AuthBridge will not work as configured.
+	Fail Status = "fail"
+	// Skip means the scenario was not configured or could not run.
+	Skip Status = "skip"
+)
+
+// Result is the outcome of one scenario.
+type Result struct {
+	Scenario string `json:"scenario"`
+	Status   Status `json:"status"`
+	Detail   string `json:"detail,omitempty"`
+}
+
+// Report lists the results of a run in scenario order.
+type Report struct {
+	TokenURL string    `json:"tokenUrl"`
+	Audience string    `json:"audience"`
+	Results  []Result  `json:"results"`
+	Started  time.Time `json:"started"`
+}
+
+// Compliant reports whether no scenario failed.
+func (r *Report) Compliant() bool {
+	for _, res := range r.Results {
+		if res.Status == Fail {
+			return false
+		}
+	}
+	return true
+}
+
+// Count returns how many scenarios ended with status.
+func (r *Report) Count(status Status) int {
+	n := 0
+	for _, res := range r.Results {
+		if res.Status == status {
+			n++
+		}
+	}
+	return n
+}
+
+// Run obtains the subject token and runs every scenario against cfg's token
+// endpoint. Scenarios needing the subject token are skipped if it cannot be
+// obtained.
+func Run(ctx context.Context, cfg *Config, client *http.Client) *Report {
+	if client == nil {
+		client = &http.Client{}
+	}
+	r := &runner{cfg: cfg, client: client}
+	report := &Report{TokenURL: cfg.TokenURL, Audience: cfg.Audience, Started: time.Now()}
+
+	subject := r.subjectToken(ctx)
+	report.Results = append(report.Results, subject)
+	for _, s := range scenarios {
+		if s.needsSubject && r.subject == "" {
+			report.Results = append(report.Results, Result{s.name, Skip, "no subject token"})
+			continue
+		}
+		res := s.run(ctx, r)
+		res.Scenario = s.name
+		report.Results = append(report.Results, res)
+	}
+	return report
+}
+
+func result(status Status, format string, args ...any) Result {
+	return Result{Status: status, Detail: fmt.Sprintf(format, args...)}
+}
@@ -0,0 +1,170 @@
+package conformance
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func fakeJWT(claims map[string]any) string {
+	payload, _ := json.Marshal(claims)
+	return "e30." + base64.RawURLEncoding.EncodeToString(payload) + ".sig"
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+// fakeIdP is a token endpoint; lenient issues tokens for any exchange.
+func fakeIdP(t *testing.T, lenient bool) *httptest.Server {
+	subject := fakeJWT(map[string]any{"sub": "alice", "aud": []string{"agent"}})
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			t.Errorf("ParseForm: %v", err)
+		}
+		f := r.PostForm
+		switch f.Get("grant_type") {
+		case "password":
+			writeJSON(w, http.StatusOK, map[string]any{"access_token": subject, "token_type": "Bearer"})
+			return
+		case grantTypeTokenExchange:
+		default:
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "unsupported_grant_type"})
+			return
+		}
+		scopes := f.Get("scope")
+		if !lenient {
+			switch {
+			case f.Get("client_id") != "agent" || f.Get("client_secret") != "secret":
+				writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "invalid_client"})
+				return
+			case f.Get("subject_token_type") == "":
+				writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_request"})
+				return
+			case f.Get("subject_token") != subject:
+				writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_token"})
+				return
+			case f.Get("audience") != "weather-tool":
+				writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_client", "error_description": "Audience not found"})
+				return
+			case strings.Contains(scopes, "admin"):
+				writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_scope"})
+				return
+			}
+		}
+		claims := map[string]any{"sub": "alice", "aud": f.Get("audience"), "scope": scopes}
+		if f.Get("actor_token") != "" {
+			claims["act"] = map[string]string{"sub": "spiffe://example.org/agent"}
+		}
+		writeJSON(w, http.StatusOK, map[string]any{
+			"access_token":      fakeJWT(claims),
+			"token_type":        "Bearer",
+			"issued_token_type": TokenTypeAccessToken,
+		})
+	}))
+}
+
+func testConfig(tokenURL string) *Config {
+	return &Config{
+		TokenURL:        tokenURL,
+		ClientID:        "agent",
+		ClientSecret:    "secret",
+		Audience:        "weather-tool",
+		Scopes:          "openid weather:read",
+		SubjectClientID: "agent",
+		SubjectUsername: "alice",
+		SubjectPassword: "alice",
+		ActorToken:      "actor.jwt.svid",
+		ActorTokenType:  TokenTypeJWT,
+		ForbiddenScope:  "weather:admin",
+		Timeout:         5 * time.Second,
+	}
+}
+
+func statuses(report *Report) map[string]Status {
+	got := make(map[string]Status)
+	for _, res := range report.Results {
+		got[res.Scenario] = res.Status
+	}
+	return got
+}
+
+func TestRun_CompliantIdP(t *testing.T) {
+	idp := fakeIdP(t, false)
+	defer idp.Close()
+
+	report := Run(context.Background(), testConfig(idp.URL), idp.Client())
+	for _, res := range report.Results {
+		if res.Status != Pass {
+			t.Errorf("%s: %s (%s), want pass", res.Scenario, res.Status, res.Detail)
+		}
+	}
+	if len(report.Results) != len(scenarios)+1 || !report.Compliant() {
+		t.Errorf("report = %+v", report)
+	}
+}
+
+func TestRun_LenientIdP(t *testing.T) {
+	idp := fakeIdP(t, true)
+	defer idp.Close()
+
+	report := Run(context.Background(), testConfig(idp.URL), idp.Client())
+	want := map[string]Status{
+		"subject-token":              Pass,
+		"exchange-audience":          Pass,
+		"exchange-scopes":            Pass,
+		"scope-down-scoping":         Fail,
+		"actor-token":                Pass,
+		"invalid-subject-token":      Fail,
+		"unknown-audience":           Fail,
+		"invalid-client":             Fail,
+		"missing-subject-token-type": Warn,
+	}
+	got := statuses(report)
+	for name, status := range want {
+		if got[name] != status {
+			t.Errorf("%s = %s, want %s", name, got[name], status)
+		}
+	}
+	if report.Compliant() || report.Count(Fail) != 4 {
+		t.Errorf("expected 4 failures, got %+v", report.Results)
+	}
+}
+
+func TestRun_NoSubjectToken(t *testing.T) {
+	idp := fakeIdP(t, false)
+	defer idp.Close()
+
+	cfg := testConfig(idp.URL)
+	cfg.SubjectUsername, cfg.SubjectPassword = "", ""
+	cfg.ActorToken, cfg.ForbiddenScope = "", ""
+	report := Run(context.Background(), cfg, idp.Client())
+	got := statuses(report)
+	// The fake rejects the client credentials grant
+	if got["subject-token"] != Fail || got["exchange-audience"] != Skip || got["invalid-subject-token"] != Pass {
+		t.Errorf("unexpected results %+v", report.Results)
+	}
+}
+
+func TestConfig_Validate(t *testing.T) {
+	cfg := testConfig("http://idp/token")
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("Validate() = %v", err)
+	}
+	cfg.SubjectPassword = ""
+	if err := cfg.Validate(); err == nil {
+		t.Error("expected an error for a username without password")
+	}
+	cfg = testConfig("http://idp/token")
+	cfg.SubjectClientID = ""
+	if err := cfg.Validate(); err == nil {
+		t.Error("expected an error without a subject token source")
+	}
+}
@@ -0,0 +1,350 @@
+package conformance
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+)
+
+type scenario struct {
+	name         string
+	needsSubject bool
+	run          func(context.Context, *runner) Result
+}
+
+// scenarios run in this order after the subject token is obtained.
+var scenarios = []scenario{
+	{"exchange-audience", true, exchangeAudience},
+	{"exchange-scopes", true, exchangeScopes},
+	{"scope-down-scoping", true, scopeDownScoping},
+	{"actor-token", true, actorToken},
+	{"invalid-subject-token", false, invalidSubjectToken},
+	{"unknown-audience", true, unknownAudience},
+	{"invalid-client", true, invalidClient},
+	{"missing-subject-token-type", true, missingSubjectTokenType},
+}
+
+type runner struct {
+	cfg     *Config
+	client  *http.Client
+	subject string
+}
+
+// tokenResponse is a token endpoint reply, successful or not.
+type tokenResponse struct {
+	status int
+	body   []byte
+
+	AccessToken     string `json:"access_token"`
+	TokenType       string `json:"token_type"`
+	IssuedTokenType string `json:"issued_token_type"`
+	Scope           string `json:"scope"`
+	Error           string `json:"error"`
+	ErrorDesc       string `json:"error_description"`
+}
+
+func (t *tokenResponse) describe() string {
+	if t.Error != "" {
+		if t.ErrorDesc != "" {
+			return fmt.Sprintf("HTTP %d %s: %s", t.status, t.Error, t.ErrorDesc)
+		}
+		return fmt.Sprintf("HTTP %d %s", t.status, t.Error)
+	}
+	body := string(t.body)
+	if len(body) > 200 {
+		body = body[:200] + "..."
+	}
+	return fmt.Sprintf("HTTP %d %s", t.status, body)
+}
+
+func (r *runner) post(ctx context.Context, form url.Values) (*tokenResponse, error) {
+	ctx, cancel := context.WithTimeout(ctx, r.cfg.Timeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, r.cfg.TokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return nil, err
+	}
+	t := &tokenResponse{status: resp.StatusCode, body: body}
+	// Non-JSON bodies leave the fields empty; scenarios report them
+	_ = json.Unmarshal(body, t)
+	return t, nil
+}
+
+// exchangeForm is the exchange the ext proc sends, authenticated with
+// client_secret_post.
+func (r *runner) exchangeForm(subjectToken, audience, scopes string) url.Values {
+	form := url.Values{}
+	form.Set("client_id", r.cfg.ClientID)
+	form.Set("client_secret", r.cfg.ClientSecret)
+	form.Set("grant_type", grantTypeTokenExchange)
+	form.Set("requested_token_type", TokenTypeAccessToken)
+	form.Set("subject_token", subjectToken)
+	form.Set("subject_token_type", TokenTypeAccessToken)
+	form.Set("audience", audience)
+	if scopes != "" {
+		form.Set("scope", scopes)
+	}
+	return form
+}
+
+func (r *runner) subjectToken(ctx context.Context) Result {
+	const name = "subject-token"
+	if r.cfg.SubjectToken != "" {
+		r.subject = r.cfg.SubjectToken
+		return Result{name, Pass, "given"}
+	}
+	form := url.Values{}
+	form.Set("client_id", r.cfg.SubjectClientID)
+	if r.cfg.SubjectClientSecret != "" {
+		form.Set("client_secret", r.cfg.SubjectClientSecret)
+	}
+	grant := "client_credentials"
+	if r.cfg.SubjectUsername != "" {
+		grant = "password"
+		form.Set("username", r.cfg.SubjectUsername)
+		form.Set("password", r.cfg.SubjectPassword)
+	}
+	form.Set("grant_type", grant)
+	form.Set("scope", "openid")
+	resp, err := r.post(ctx, form)
+	if err != nil {
+		return Result{name, Fail, err.Error()}
+	}
+	if resp.status != http.StatusOK || resp.AccessToken == "" {
+		return Result{name, Fail, grant + " grant: " + resp.describe()}
+	}
+	r.subject = resp.AccessToken
+	if claims := jwtClaims(resp.AccessToken); claims != nil && !hasAudience(claims, r.cfg.ClientID) {
+		// Keycloak only exchanges tokens whose aud includes the requester
+		return Result{name, Warn, fmt.Sprintf("obtained with the %s grant, but its aud does not include %s, which Keycloak requires for exchange", grant, r.cfg.ClientID)}
+	}
+	return Result{name, Pass, "obtained with the " + grant + " grant"}
+}
+
+// checkIssued checks what every successful exchange must return.
+func checkIssued(resp *tokenResponse, audience string) (Result, map[string]any) {
+	if resp.status != http.StatusOK || resp.AccessToken == "" {
+		return result(Fail, "exchange rejected: %s", resp.describe()), nil
+	}
+	tokenType := strings.ToLower(resp.TokenType)
+	if tokenType != "bearer" && tokenType != "dpop" && tokenType != "n_a" {
+		return result(Fail, "token_type %q, want Bearer", resp.TokenType), nil
+	}
+	claims := jwtClaims(resp.AccessToken)
+	if claims != nil && !hasAudience(claims, audience) {
+		return result(Fail, "issued token's aud %v does not include %s", claims["aud"], audience), claims
+	}
+	if resp.IssuedTokenType == "" {
+		return result(Warn, "issued_token_type missing (RFC 8693 §2.2.1)"), claims
+	}
+	if claims == nil {
+		return result(Warn, "issued token is not a JWT, audience not checked"), nil
+	}
+	return result(Pass, "aud includes %s", audience), claims
+}
+
+func exchangeAudience(ctx context.Context, r *runner) Result {
+	resp, err := r.post(ctx, r.exchangeForm(r.subject, r.cfg.Audience, ""))
+	if err != nil {
+		return result(Fail, "%v", err)
+	}
+	res, _ := checkIssued(resp, r.cfg.Audience)
+	return res
+}
+
+func exchangeScopes(ctx context.Context, r *runner) Result {
+	if r.cfg.Scopes == "" {
+		return result(Skip, "TARGET_SCOPES not set")
+	}
+	resp, err := r.post(ctx, r.exchangeForm(r.subject, r.cfg.Audience, r.cfg.Scopes))
+	if err != nil {
+		return result(Fail, "%v", err)
+	}
+	res, claims := checkIssued(resp, r.cfg.Audience)
+	if res.Status == Fail {
+		return res
+	}
+	granted := grantedScopes(resp, claims)
+	if granted == nil {
+		return result(Warn, "neither the response nor the token lists scopes, not checked")
+	}
+	var missing []string
+	for _, s := range strings.Fields(r.cfg.Scopes) {
+		if !slices.Contains(granted, s) {
+			missing = append(missing, s)
+		}
+	}
+	if len(missing) > 0 {
+		return result(Fail, "requested scopes not granted: %s", strings.Join(missing, " "))
+	}
+	if res.Status == Warn {
+		return res
+	}
+	return result(Pass, "granted %s", r.cfg.Scopes)
+}
+
+func scopeDownScoping(ctx context.Context, r *runner) Result {
+	if r.cfg.ForbiddenScope == "" {
+		return result(Skip, "CONFORMANCE_FORBIDDEN_SCOPE not set")
+	}
+	scopes := strings.TrimSpace(r.cfg.Scopes + " " + r.cfg.ForbiddenScope)
+	resp, err := r.post(ctx, r.exchangeForm(r.subject, r.cfg.Audience, scopes))
+	if err != nil {
+		return result(Fail, "%v", err)
+	}
+	if resp.status != http.StatusOK {
+		if resp.status == http.StatusBadRequest && resp.Error == "invalid_scope" {
+			return result(Pass, "rejected with invalid_scope")
+		}
+		return result(Warn, "rejected, but not with 400 invalid_scope: %s", resp.describe())
+	}
+	granted := grantedScopes(resp, jwtClaims(resp.AccessToken))
+	if granted == nil {
+		return result(Warn, "token issued without a scope list, cannot tell whether %s was granted", r.cfg.ForbiddenScope)
+	}
+	if slices.Contains(granted, r.cfg.ForbiddenScope) {
+		return result(Fail, "forbidden scope %s was granted", r.cfg.ForbiddenScope)
+	}
+	return result(Pass, "forbidden scope left out of the issued token")
+}
+
+func actorToken(ctx context.Context, r *runner) Result {
+	if r.cfg.ActorToken == "" {
+		return result(Skip, "CONFORMANCE_ACTOR_TOKEN not set")
+	}
+	form := r.exchangeForm(r.subject, r.cfg.Audience, r.cfg.Scopes)
+	form.Set("actor_token", r.cfg.ActorToken)
+	form.Set("actor_token_type", r.cfg.ActorTokenType)
+	resp, err := r.post(ctx, form)
+	if err != nil {
+		return result(Fail, "%v", err)
+	}
+	res, claims := checkIssued(resp, r.cfg.Audience)
+	if res.Status == Fail || claims == nil {
+		return res
+	}
+	if _, ok := claims["act"]; !ok {
+		return result(Warn, "actor token accepted, but the issued token has no act claim (RFC 8693 §4.1)")
+	}
+	return result(Pass, "issued token carries act %v", claims["act"])
+}
+
+// expectError checks a request the IdP must reject with one of codes.
+func expectError(resp *tokenResponse, wantStatus int, codes ...string) Result {
+	switch {
+	case resp.status == http.StatusOK:
+		return result(Fail, "accepted, a token was issued")
+	case resp.status >= 500:
+		return result(Fail, "server error instead of a client error: %s", resp.describe())
+	case resp.Error == "":
+		return result(Warn, "rejected without an RFC 6749 §5.2 error body: %s", resp.describe())
+	case resp.status != wantStatus || !slices.Contains(codes, resp.Error):
+		return result(Warn, "rejected, want HTTP %d %s: %s", wantStatus, strings.Join(codes, " or "), resp.describe())
+	}
+	return result(Pass, "rejected: %s", resp.describe())
+}
+
+func invalidSubjectToken(ctx context.Context, r *runner) Result {
+	resp, err := r.post(ctx, r.exchangeForm("not-a-token", r.cfg.Audience, r.cfg.Scopes))
+	if err != nil {
+		return result(Fail, "%v", err)
+	}
+	return expectError(resp, http.StatusBadRequest, "invalid_request", "invalid_grant", "invalid_token")
+}
+
+func unknownAudience(ctx context.Context, r *runner) Result {
+	suffix := make([]byte, 4)
+	_, _ = rand.Read(suffix)
+	audience := "authbridge-conformance-" + hex.EncodeToString(suffix)
+	resp, err := r.post(ctx, r.exchangeForm(r.subject, audience, r.cfg.Scopes))
+	if err != nil {
+		return result(Fail, "%v", err)
+	}
+	// Keycloak answers invalid_client ("Audience not found")
+	return expectError(resp, http.StatusBadRequest, "invalid_target", "invalid_request", "invalid_client")
+}
+
+func invalidClient(ctx context.Context, r *runner) Result {
+	form := r.exchangeForm(r.subject, r.cfg.Audience, r.cfg.Scopes)
+	form.Set("client_secret", r.cfg.ClientSecret+"-wrong")
+	resp, err := r.post(ctx, form)
+	if err != nil {
+		return result(Fail, "%v", err)
+	}
+	return expectError(resp, http.StatusUnauthorized, "invalid_client")
+}
+
+func missingSubjectTokenType(ctx context.Context, r *runner) Result {
+	form := r.exchangeForm(r.subject, r.cfg.Audience, r.cfg.Scopes)
+	form.Del("subject_token_type")
+	resp, err := r.post(ctx, form)
+	if err != nil {
+		return result(Fail, "%v", err)
+	}
+	if resp.status == http.StatusOK {
+		return result(Warn, "accepted without subject_token_type, which RFC 8693 §2.1 requires")
+	}
+	return expectError(resp, http.StatusBadRequest, "invalid_request")
+}
+
+// jwtClaims returns the unverified claims of a JWT, or nil if token is not
+// one. The suite only inspects tokens the IdP just issued to it.
+func jwtClaims(token string) map[string]any {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil
+	}
+	var claims map[string]any
+	if json.Unmarshal(payload, &claims) != nil {
+		return nil
+	}
+	return claims
+}
+
+func hasAudience(claims map[string]any, audience string) bool {
+	switch aud := claims["aud"].(type) {
+	case string:
+		return aud == audience
+	case []any:
+		for _, a := range aud {
+			if a == audience {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// grantedScopes returns the scopes of an issued token from the response, else
+// its scope claim, or nil if neither lists any.
+func grantedScopes(resp *tokenResponse, claims map[string]any) []string {
+	if resp.Scope != "" {
+		return strings.Fields(resp.Scope)
+	}
+	if s, ok := claims["scope"].(string); ok {
+		return strings.Fields(s)
+	}
+	return nil
+}
@@ -0,0 +1,64 @@
+// Package connlimit caps the number of connections a net.Listener keeps open
+// at once, so misbehaving clients cannot exhaust the process's file
+// descriptors. Connections beyond the cap are closed as soon as they are
+// accepted rather than left queued in the kernel backlog.
+package connlimit
+
+import (
+	"net"
+	"sync"
+	"sync/atomic"
+)
+
+// Listener wraps a net.Listener with a connection cap.
+type Listener struct {
+	net.Listener
+	slots    chan struct{}
+	rejected atomic.Uint64
+}
+
+// NewListener returns l limited to max open connections.
+func NewListener(l net.Listener, max int) *Listener {
+	return &Listener{Listener: l, slots: make(chan struct{}, max)}
+}
+
+// Accept returns the next connection that fits under the cap, closing the
+// ones that don't.
+func (l *Listener) Accept() (net.Conn, error) {
+	for {
+		c, err := l.Listener.Accept()
+		if err != nil {
+			return nil, err
+		}
+		select {
+		case l.slots <- struct{}{}:
+			return &conn{Conn: c, release: func() { <-l.slots }}, nil
+		default:
+			l.rejected.Add(1)
+			c.Close()
+		}
+	}
+}
+
+// Active returns the number of open connections.
+func (l *Listener) Active() int {
+	return len(l.slots)
+}
+
+// Rejected returns how many connections were closed for exceeding the cap.
+func (l *Listener) Rejected() uint64 {
+	return l.rejected.Load()
+}
+
+// conn frees its slot on the first Close.
+type conn struct {
+	net.Conn
+	once    sync.Once
+	release func()
+}
+
+func (c *conn) Close() error {
+	err := c.Conn.Close()
+	c.once.Do(c.release)
+	return err
+}
@@ -0,0 +1,101 @@
+package connlimit
+
+import (
+	"io"
+	"net"
+	"testing"
+	"time"
+)
+
+func newTestListener(t *testing.T, max int) *Listener {
+	t.Helper()
+	inner, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	l := NewListener(inner, max)
+	t.Cleanup(func() { l.Close() })
+	return l
+}
+
+// acceptAll accepts connections in the background and hands them out.
+func acceptAll(l *Listener) <-chan net.Conn {
+	accepted := make(chan net.Conn, 16)
+	go func() {
+		for {
+			c, err := l.Accept()
+			if err != nil {
+				close(accepted)
+				return
+			}
+			accepted <- c
+		}
+	}()
+	return accepted
+}
+
+func dial(t *testing.T, l net.Listener) net.Conn {
+	t.Helper()
+	c, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { c.Close() })
+	return c
+}
+
+// closedByPeer reports whether the server closed c.
+func closedByPeer(c net.Conn) bool {
+	c.SetReadDeadline(time.Now().Add(2 * time.Second))
+	_, err := c.Read(make([]byte, 1))
+	return err == io.EOF
+}
+
+func receive(t *testing.T, accepted <-chan net.Conn) net.Conn {
+	t.Helper()
+	select {
+	case c := <-accepted:
+		return c
+	case <-time.After(2 * time.Second):
+		t.Fatal("connection was not accepted")
+		return nil
+	}
+}
+
+func TestListenerRejectsBeyondCap(t *testing.T) {
+	l := newTestListener(t, 2)
+	accepted := acceptAll(l)
+
+	dial(t, l)
+	first := receive(t, accepted)
+	dial(t, l)
+	receive(t, accepted)
+
+	extra := dial(t, l)
+	if !closedByPeer(extra) {
+		t.Fatal("connection beyond the cap was not closed")
+	}
+	if l.Active() != 2 || l.Rejected() != 1 {
+		t.Errorf("Active() = %d, Rejected() = %d; want 2, 1", l.Active(), l.Rejected())
+	}
+
+	// Closing a connection frees its slot, twice closing frees only one
+	first.Close()
+	first.Close()
+	if l.Active() != 1 {
+		t.Fatalf("Active() = %d after close, want 1", l.Active())
+	}
+	dial(t, l)
+	receive(t, accepted)
+	if l.Active() != 2 {
+		t.Errorf("Active() = %d, want 2", l.Active())
+	}
+}
+
+func TestListenerAcceptError(t *testing.T) {
+	l := newTestListener(t, 1)
+	l.Close()
+	if _, err := l.Accept(); err == nil {
+		t.Fatal("expected error from a closed listener")
+	}
+}
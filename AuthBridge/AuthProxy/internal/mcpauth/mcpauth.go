@@ -0,0 +1,156 @@
+// Package mcpauth implements the resource server side of the MCP
+// authorization spec: OAuth 2.0 Protected Resource Metadata (RFC 9728), the
+// resource_metadata challenge parameter, and audience checks for tokens bound
+// to the server with a resource indicator (RFC 8707).
+package mcpauth
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// WellKnownPath is the RFC 9728 metadata path prefix.
+const WellKnownPath = "/.well-known/oauth-protected-resource"
+
+// Metadata is the protected resource metadata document.
+type Metadata struct {
+	Resource               string   `json:"resource"`
+	AuthorizationServers   []string `json:"authorization_servers"`
+	ScopesSupported        []string `json:"scopes_supported,omitempty"`
+	BearerMethodsSupported []string `json:"bearer_methods_supported"`
+}
+
+// Config describes the protected MCP server.
+type Config struct {
+	// Resource is the canonical URI of the MCP server, e.g.
+	// https://mcp.example.com/mcp. Clients request tokens for it as the
+	// RFC 8707 resource, so it is also the accepted token audience.
+	Resource string
+	// AuthorizationServers are the issuers clients may get tokens from.
+	AuthorizationServers []string
+	// ScopesSupported is advertised in the metadata, if set.
+	ScopesSupported []string
+	// Forward leaves the metadata endpoint to the MCP server instead of
+	// serving it from Resource and AuthorizationServers.
+	Forward bool
+}
+
+// Env holds the MCP authorization settings. Components embed it in the
+// configuration they decode with configschema.DecodeEnv, so the variables
+// appear in their -config-schema output.
+type Env struct {
+	Enabled              bool     `env:"MCP_AUTH" doc:"Enable MCP authorization mode: serve RFC 9728 protected resource metadata and point 401 challenges at it"`
+	Resource             string   `env:"MCP_RESOURCE" doc:"Canonical URI of the MCP server; required with MCP_AUTH"`
+	AuthorizationServers []string `env:"MCP_AUTHORIZATION_SERVERS" doc:"Issuers advertised to clients; defaults to the inbound issuer"`
+	ScopesSupported      string   `env:"MCP_SCOPES_SUPPORTED" doc:"Space-separated scopes advertised to clients"`
+	ResourceMetadata     string   `env:"MCP_RESOURCE_METADATA" default:"serve" doc:"serve the metadata document, or forward its requests to the MCP server"`
+}
+
+// Config returns the MCP authorization mode of e, or nil when it is off.
+// defaultIssuer is advertised when e names no authorization server.
+func (e Env) Config(defaultIssuer string) (*Config, error) {
+	if !e.Enabled {
+		return nil, nil
+	}
+	u, err := url.Parse(e.Resource)
+	if err != nil || u.Scheme == "" || u.Host == "" || u.Fragment != "" {
+		return nil, fmt.Errorf("MCP_RESOURCE must be an absolute URI without fragment, got %q", e.Resource)
+	}
+
+	cfg := &Config{Resource: e.Resource, ScopesSupported: strings.Fields(e.ScopesSupported), AuthorizationServers: e.AuthorizationServers}
+	if len(cfg.AuthorizationServers) == 0 && defaultIssuer != "" {
+		cfg.AuthorizationServers = []string{defaultIssuer}
+	}
+	if len(cfg.AuthorizationServers) == 0 {
+		return nil, fmt.Errorf("MCP_AUTHORIZATION_SERVERS or ISSUER must be set")
+	}
+
+	switch e.ResourceMetadata {
+	case "", "serve":
+	case "forward":
+		cfg.Forward = true
+	default:
+		return nil, fmt.Errorf("MCP_RESOURCE_METADATA must be serve or forward, got %q", e.ResourceMetadata)
+	}
+	return cfg, nil
+}
+
+// Metadata returns the metadata document for the configured resource.
+func (c *Config) Metadata() Metadata {
+	return Metadata{
+		Resource:               c.Resource,
+		AuthorizationServers:   c.AuthorizationServers,
+		ScopesSupported:        c.ScopesSupported,
+		BearerMethodsSupported: []string{"header"},
+	}
+}
+
+// MetadataURL is where clients find the metadata: the well-known path is
+// inserted between the host and the resource path (RFC 9728 section 3.1).
+func (c *Config) MetadataURL() string {
+	u, err := url.Parse(c.Resource)
+	if err != nil {
+		return ""
+	}
+	u.Path = c.MetadataPath()
+	u.RawPath, u.RawQuery = "", ""
+	return u.String()
+}
+
+// MetadataPath is the path of MetadataURL.
+func (c *Config) MetadataPath() string {
+	u, err := url.Parse(c.Resource)
+	if err != nil {
+		return WellKnownPath
+	}
+	return WellKnownPath + strings.TrimSuffix(u.Path, "/")
+}
+
+// IsMetadataPath reports whether a request path (query ignored) is the
+// metadata endpoint, either the bare well-known path or MetadataPath.
+func (c *Config) IsMetadataPath(path string) bool {
+	path, _, _ = strings.Cut(path, "?")
+	return path == WellKnownPath || path == c.MetadataPath()
+}
+
+// AudienceMatches reports whether one of the token audiences is the
+// resource. Scheme and host compare case-insensitively and a trailing slash
+// is ignored, as both forms name the same resource.
+func (c *Config) AudienceMatches(audiences []string) bool {
+	want := canonical(c.Resource)
+	for _, aud := range audiences {
+		if canonical(aud) == want {
+			return true
+		}
+	}
+	return false
+}
+
+func canonical(resource string) string {
+	u, err := url.Parse(resource)
+	if err != nil {
+		return resource
+	}
+	u.Scheme = strings.ToLower(u.Scheme)
+	u.Host = strings.ToLower(u.Host)
+	u.Path = strings.TrimSuffix(u.Path, "/")
+	u.RawPath = ""
+	return u.String()
+}
+
+// Challenge returns the resource_metadata parameter for a Bearer
+// WWW-Authenticate header.
+func (c *Config) Challenge() string {
+	return fmt.Sprintf("resource_metadata=%q", c.MetadataURL())
+}
+
+// ServeHTTP serves the metadata document.
+func (c *Config) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := json.Marshal(c.Metadata())
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "max-age=3600")
+	_, _ = w.Write(body)
+}
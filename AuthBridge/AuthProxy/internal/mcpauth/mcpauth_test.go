@@ -0,0 +1,117 @@
+package mcpauth
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+)
+
+func TestEnvConfig(t *testing.T) {
+	cfg, err := Env{}.Config("https://idp/realms/kagenti")
+	if err != nil || cfg != nil {
+		t.Fatalf("disabled mode = %+v, %v; want nil, nil", cfg, err)
+	}
+
+	cfg, err = Env{
+		Enabled:         true,
+		Resource:        "https://mcp.example.com/mcp",
+		ScopesSupported: "mcp:tools mcp:read",
+	}.Config("https://idp/realms/kagenti")
+	if err != nil {
+		t.Fatalf("Config: %v", err)
+	}
+	if !slices.Equal(cfg.AuthorizationServers, []string{"https://idp/realms/kagenti"}) {
+		t.Errorf("AuthorizationServers = %v, want the issuer", cfg.AuthorizationServers)
+	}
+	if !slices.Equal(cfg.ScopesSupported, []string{"mcp:tools", "mcp:read"}) {
+		t.Errorf("ScopesSupported = %v", cfg.ScopesSupported)
+	}
+	if cfg.Forward {
+		t.Error("Forward should default to false")
+	}
+
+	for name, env := range map[string]Env{
+		"missing resource":  {Enabled: true},
+		"relative resource": {Enabled: true, Resource: "/mcp"},
+		"bad metadata mode": {Enabled: true, Resource: "https://mcp", ResourceMetadata: "proxy"},
+	} {
+		if _, err := env.Config("https://idp"); err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+	}
+	if _, err := (Env{Enabled: true, Resource: "https://mcp"}).Config(""); err == nil {
+		t.Error("expected error without any authorization server")
+	}
+}
+
+func TestMetadataURL(t *testing.T) {
+	tests := []struct {
+		resource, want string
+	}{
+		{"https://mcp.example.com", "https://mcp.example.com/.well-known/oauth-protected-resource"},
+		{"https://mcp.example.com/", "https://mcp.example.com/.well-known/oauth-protected-resource"},
+		{"https://mcp.example.com/mcp", "https://mcp.example.com/.well-known/oauth-protected-resource/mcp"},
+	}
+	for _, tt := range tests {
+		cfg := &Config{Resource: tt.resource}
+		if got := cfg.MetadataURL(); got != tt.want {
+			t.Errorf("MetadataURL(%q) = %q, want %q", tt.resource, got, tt.want)
+		}
+	}
+}
+
+func TestIsMetadataPath(t *testing.T) {
+	cfg := &Config{Resource: "https://mcp.example.com/mcp"}
+	for path, want := range map[string]bool{
+		"/.well-known/oauth-protected-resource":       true,
+		"/.well-known/oauth-protected-resource/mcp":   true,
+		"/.well-known/oauth-protected-resource?x=1":   true,
+		"/.well-known/oauth-protected-resource/other": false,
+		"/mcp": false,
+	} {
+		if got := cfg.IsMetadataPath(path); got != want {
+			t.Errorf("IsMetadataPath(%q) = %v, want %v", path, got, want)
+		}
+	}
+}
+
+func TestAudienceMatches(t *testing.T) {
+	cfg := &Config{Resource: "https://mcp.example.com/mcp"}
+	for _, tt := range []struct {
+		aud  []string
+		want bool
+	}{
+		{[]string{"https://mcp.example.com/mcp"}, true},
+		{[]string{"account", "HTTPS://MCP.example.com/mcp/"}, true},
+		{[]string{"https://mcp.example.com/other"}, false},
+		{[]string{"https://mcp.example.com/MCP"}, false},
+		{nil, false},
+	} {
+		if got := cfg.AudienceMatches(tt.aud); got != tt.want {
+			t.Errorf("AudienceMatches(%v) = %v, want %v", tt.aud, got, tt.want)
+		}
+	}
+}
+
+func TestServeHTTP(t *testing.T) {
+	cfg := &Config{Resource: "https://mcp.example.com/mcp", AuthorizationServers: []string{"https://idp"}}
+	rec := httptest.NewRecorder()
+	cfg.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, WellKnownPath, nil))
+
+	if ct := rec.Header().Get("Content-Type"); ct != "application/json" {
+		t.Errorf("Content-Type = %q", ct)
+	}
+	var got Metadata
+	if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if got.Resource != cfg.Resource || !slices.Equal(got.AuthorizationServers, cfg.AuthorizationServers) ||
+		!slices.Equal(got.BearerMethodsSupported, []string{"header"}) {
+		t.Errorf("metadata = %+v", got)
+	}
+	if want := `resource_metadata="https://mcp.example.com/.well-known/oauth-protected-resource/mcp"`; cfg.Challenge() != want {
+		t.Errorf("Challenge() = %s, want %s", cfg.Challenge(), want)
+	}
+}
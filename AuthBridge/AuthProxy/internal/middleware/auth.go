@@ -0,0 +1,101 @@
+package middleware
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/lestrrat-go/jwx/v2/jwk"
+	"github.com/lestrrat-go/jwx/v2/jwt"
+)
+
+// Claims are the validated token claims made available to later handlers.
+type Claims map[string]interface{}
+
+type claimsKey struct{}
+
+// ClaimsFromContext returns the claims stored by Authn or Authenticate, or
+// nil.
+func ClaimsFromContext(ctx context.Context) Claims {
+	claims, _ := ctx.Value(claimsKey{}).(Claims)
+	return claims
+}
+
+// TokenValidator validates a bearer token and returns its claims.
+type TokenValidator interface {
+	Validate(ctx context.Context, token string) (Claims, error)
+}
+
+// JWKSValidator checks signature, expiry, issuer and audience against keys
+// from a jwk.Cache on which JWKSURL is registered.
+type JWKSValidator struct {
+	Cache    *jwk.Cache
+	JWKSURL  string
+	Issuer   string
+	Audience string
+}
+
+// Validate implements TokenValidator.
+func (v *JWKSValidator) Validate(ctx context.Context, tokenString string) (Claims, error) {
+	keySet, err := v.Cache.Get(ctx, v.JWKSURL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch JWKS: %w", err)
+	}
+
+	token, err := jwt.Parse([]byte(tokenString), jwt.WithKeySet(keySet), jwt.WithValidate(true))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse/validate token: %w", err)
+	}
+	if token.Issuer() != v.Issuer {
+		return nil, fmt.Errorf("invalid issuer: expected %s, got %s", v.Issuer, token.Issuer())
+	}
+	if v.Audience != "" && !slices.Contains(token.Audience(), v.Audience) {
+		return nil, fmt.Errorf("invalid audience: expected %s, got %v", v.Audience, token.Audience())
+	}
+
+	claims, err := token.AsMap(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read token claims: %w", err)
+	}
+	return claims, nil
+}
+
+// Authn requires a valid bearer token and stores its claims in the request
+// context. Failures get 401 with a Bearer challenge.
+func Authn(validator TokenValidator) Middleware {
+	return Authenticate(&BearerAuthenticator{Validator: validator})
+}
+
+// Authorizer decides whether an authenticated request may proceed.
+type Authorizer func(r *http.Request, claims Claims) error
+
+// Authz rejects requests the authorizer refuses with 403. It must run after
+// Authn.
+func Authz(authorize Authorizer) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if err := authorize(r, ClaimsFromContext(r.Context())); err != nil {
+				w.Header().Set("WWW-Authenticate", `Bearer error="insufficient_scope"`)
+				http.Error(w, "forbidden", http.StatusForbidden)
+				log.Printf("[Authz] Forbidden request: %s %s - %v", r.Method, r.URL.Path, err)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// RequireScope is an Authorizer that requires scope in the space-separated
+// "scope" claim.
+func RequireScope(scope string) Authorizer {
+	return func(_ *http.Request, claims Claims) error {
+		granted, _ := claims["scope"].(string)
+		if !slices.Contains(strings.Fields(granted), scope) {
+			return fmt.Errorf("missing scope %q", scope)
+		}
+		return nil
+	}
+}
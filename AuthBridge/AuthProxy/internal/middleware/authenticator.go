@@ -0,0 +1,169 @@
+package middleware
+
+import (
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+)
+
+// ErrNoCredentials is returned by an Authenticator when the request carries
+// no credential of its kind, so the next one is tried.
+var ErrNoCredentials = errors.New("no credentials")
+
+// errMalformedAuthorization is a non-Bearer Authorization header.
+var errMalformedAuthorization = errors.New("invalid Authorization header format")
+
+// Authenticator checks one kind of credential, e.g. bearer tokens or client
+// certificates. New credential types only need a new implementation.
+type Authenticator interface {
+	// Authenticate returns the claims of the request's credential:
+	// ErrNoCredentials if it carries none of this kind, another error if
+	// its credential is invalid.
+	Authenticate(r *http.Request) (Claims, error)
+	// Challenge returns the WWW-Authenticate value for a failure with err
+	// (ErrNoCredentials when no authenticator found a credential), or ""
+	// when the credential type has no challenge.
+	Challenge(err error) string
+}
+
+// Authenticate requires a credential accepted by one of authenticators,
+// tried in order, and stores its claims in the request context. The first
+// authenticator that finds a credential decides: an invalid credential is
+// rejected without trying the others. Failures get 401 with the challenges
+// of the authenticators involved.
+func Authenticate(authenticators ...Authenticator) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			for _, a := range authenticators {
+				claims, err := a.Authenticate(r)
+				if errors.Is(err, ErrNoCredentials) {
+					continue
+				}
+				if err != nil {
+					if challenge := a.Challenge(err); challenge != "" {
+						w.Header().Set("WWW-Authenticate", challenge)
+					}
+					http.Error(w, "unauthorized", http.StatusUnauthorized)
+					log.Printf("[Authn] Unauthorized request (invalid credentials): %s %s - %v", r.Method, r.URL.Path, err)
+					return
+				}
+				next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), claimsKey{}, claims)))
+				return
+			}
+			for _, a := range authenticators {
+				if challenge := a.Challenge(ErrNoCredentials); challenge != "" {
+					w.Header().Add("WWW-Authenticate", challenge)
+				}
+			}
+			http.Error(w, "unauthorized: missing credentials", http.StatusUnauthorized)
+			log.Printf("[Authn] Unauthorized request (missing credentials): %s %s", r.Method, r.URL.Path)
+		})
+	}
+}
+
+// BearerAuthenticator accepts bearer tokens in the Authorization header,
+// checked by Validator: a JWKSValidator for JWTs or an
+// IntrospectionValidator for opaque tokens.
+type BearerAuthenticator struct {
+	Validator TokenValidator
+}
+
+// Authenticate implements Authenticator.
+func (a *BearerAuthenticator) Authenticate(r *http.Request) (Claims, error) {
+	authHeader := r.Header.Get("Authorization")
+	if authHeader == "" {
+		return nil, ErrNoCredentials
+	}
+	token, ok := strings.CutPrefix(authHeader, "Bearer ")
+	if !ok {
+		return nil, errMalformedAuthorization
+	}
+	return a.Validator.Validate(r.Context(), token)
+}
+
+// Challenge implements Authenticator.
+func (a *BearerAuthenticator) Challenge(err error) string {
+	switch {
+	case errors.Is(err, ErrNoCredentials):
+		return "Bearer"
+	case errors.Is(err, errMalformedAuthorization):
+		return `Bearer error="invalid_request"`
+	}
+	return `Bearer error="invalid_token"`
+}
+
+// APIKeyAuthenticator accepts static API keys in a request header. The
+// claims hold the key's client name as sub.
+type APIKeyAuthenticator struct {
+	header string
+	// clients maps key hashes to client names; lookups by hash don't leak
+	// how much of a key matched
+	clients map[[sha256.Size]byte]string
+}
+
+// NewAPIKeyAuthenticator accepts the keys of clients, by client name, in
+// header.
+func NewAPIKeyAuthenticator(header string, keys map[string]string) (*APIKeyAuthenticator, error) {
+	a := &APIKeyAuthenticator{header: header, clients: make(map[[sha256.Size]byte]string, len(keys))}
+	for name, key := range keys {
+		if key == "" {
+			return nil, fmt.Errorf("empty API key for %q", name)
+		}
+		sum := sha256.Sum256([]byte(key))
+		if other, ok := a.clients[sum]; ok {
+			return nil, fmt.Errorf("clients %q and %q share an API key", other, name)
+		}
+		a.clients[sum] = name
+	}
+	return a, nil
+}
+
+// Authenticate implements Authenticator.
+func (a *APIKeyAuthenticator) Authenticate(r *http.Request) (Claims, error) {
+	key := r.Header.Get(a.header)
+	if key == "" {
+		return nil, ErrNoCredentials
+	}
+	name, ok := a.clients[sha256.Sum256([]byte(key))]
+	if !ok {
+		return nil, errors.New("unknown API key")
+	}
+	return Claims{"sub": name}, nil
+}
+
+// Challenge implements Authenticator. API keys have no standard challenge.
+func (a *APIKeyAuthenticator) Challenge(error) string {
+	return ""
+}
+
+// MTLSAuthenticator accepts verified client certificates. The server must
+// request them (tls.VerifyClientCertIfGiven when stacked with other
+// authenticators). The claims hold the certificate's first URI SAN (e.g. a
+// SPIFFE ID), else its common name, as sub.
+type MTLSAuthenticator struct{}
+
+// Authenticate implements Authenticator.
+func (MTLSAuthenticator) Authenticate(r *http.Request) (Claims, error) {
+	if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 {
+		return nil, ErrNoCredentials
+	}
+	cert := r.TLS.VerifiedChains[0][0]
+	subject := cert.Subject.CommonName
+	if len(cert.URIs) > 0 {
+		subject = cert.URIs[0].String()
+	}
+	if subject == "" {
+		return nil, errors.New("client certificate has neither URI SAN nor common name")
+	}
+	return Claims{"sub": subject}, nil
+}
+
+// Challenge implements Authenticator. Client certificates are requested
+// during the TLS handshake, not with a challenge.
+func (MTLSAuthenticator) Challenge(error) string {
+	return ""
+}
@@ -0,0 +1,105 @@
+package middleware
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+func TestAuthenticateStack(t *testing.T) {
+	apiKeys, err := NewAPIKeyAuthenticator("X-API-Key", map[string]string{"batch-job": "s3cret"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	spiffeID, _ := url.Parse("spiffe://example.org/ns/team1/sa/agent")
+	var sub string
+	h := Chain(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		sub, _ = ClaimsFromContext(r.Context())["sub"].(string)
+	}), Authenticate(&BearerAuthenticator{Validator: fakeValidator{}}, apiKeys, MTLSAuthenticator{}))
+
+	tests := []struct {
+		name       string
+		header     http.Header
+		cert       bool
+		wantStatus int
+		wantSub    string
+		challenges int
+	}{
+		{name: "bearer", header: http.Header{"Authorization": {"Bearer good"}}, wantStatus: http.StatusOK, wantSub: "alice"},
+		{name: "api key", header: http.Header{"X-Api-Key": {"s3cret"}}, wantStatus: http.StatusOK, wantSub: "batch-job"},
+		{name: "client certificate", cert: true, wantStatus: http.StatusOK, wantSub: spiffeID.String()},
+		{name: "nothing", wantStatus: http.StatusUnauthorized, challenges: 1},
+		{name: "unknown api key", header: http.Header{"X-Api-Key": {"guess"}}, wantStatus: http.StatusUnauthorized},
+		// An invalid token is not saved by a valid certificate
+		{name: "invalid bearer with certificate", header: http.Header{"Authorization": {"Bearer bad"}}, cert: true,
+			wantStatus: http.StatusUnauthorized, challenges: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sub = ""
+			req := httptest.NewRequest(http.MethodGet, "/tools", nil)
+			for k, v := range tt.header {
+				req.Header[k] = v
+			}
+			if tt.cert {
+				cert := &x509.Certificate{Subject: pkix.Name{CommonName: "agent"}, URIs: []*url.URL{spiffeID}}
+				req.TLS = &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{cert}}}
+			}
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, req)
+			if rec.Code != tt.wantStatus || sub != tt.wantSub {
+				t.Errorf("status = %d, sub = %q; want %d, %q", rec.Code, sub, tt.wantStatus, tt.wantSub)
+			}
+			if got := len(rec.Header().Values("WWW-Authenticate")); got != tt.challenges {
+				t.Errorf("got %d challenges, want %d", got, tt.challenges)
+			}
+		})
+	}
+}
+
+func TestNewAPIKeyAuthenticator(t *testing.T) {
+	if _, err := NewAPIKeyAuthenticator("X-API-Key", map[string]string{"a": "same", "b": "same"}); err == nil {
+		t.Error("expected error for shared key")
+	}
+	if _, err := NewAPIKeyAuthenticator("X-API-Key", map[string]string{"a": ""}); err == nil {
+		t.Error("expected error for empty key")
+	}
+}
+
+func TestIntrospectionValidator(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if id, secret, _ := r.BasicAuth(); id != "proxy" || secret != "pw" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		resp := map[string]any{"active": false}
+		if r.PostFormValue("token") == "opaque-good" {
+			resp = map[string]any{"active": true, "sub": "alice", "aud": []string{"demo", "other"}}
+		}
+		_ = json.NewEncoder(w).Encode(resp)
+	}))
+	defer srv.Close()
+
+	v := &IntrospectionValidator{Endpoint: srv.URL, ClientID: "proxy", ClientSecret: "pw", Audience: "demo"}
+	claims, err := v.Validate(context.Background(), "opaque-good")
+	if err != nil || claims["sub"] != "alice" {
+		t.Fatalf("Validate = %v, %v", claims, err)
+	}
+	if _, err := v.Validate(context.Background(), "revoked"); err == nil {
+		t.Error("expected error for inactive token")
+	}
+	v.Audience = "missing"
+	if _, err := v.Validate(context.Background(), "opaque-good"); err == nil {
+		t.Error("expected error for wrong audience")
+	}
+	v.ClientSecret = "wrong"
+	if _, err := v.Validate(context.Background(), "opaque-good"); err == nil {
+		t.Error("expected error when the endpoint rejects the client")
+	}
+}
@@ -0,0 +1,61 @@
+package middleware
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Metrics counts requests by status code and accumulates their duration.
+// It serves the counters in the Prometheus text format.
+type Metrics struct {
+	// Name prefixes every metric, e.g. "demo_app"
+	Name string
+
+	mu       sync.Mutex
+	requests map[int]uint64
+	seconds  float64
+}
+
+// NewMetrics returns an empty metrics set.
+func NewMetrics(name string) *Metrics {
+	return &Metrics{Name: name, requests: make(map[int]uint64)}
+}
+
+// Middleware records every request passing through it.
+func (m *Metrics) Middleware() Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			start := time.Now()
+			rec := &statusRecorder{ResponseWriter: w}
+			next.ServeHTTP(rec, r)
+
+			m.mu.Lock()
+			m.requests[rec.statusCode()]++
+			m.seconds += time.Since(start).Seconds()
+			m.mu.Unlock()
+		})
+	}
+}
+
+// ServeHTTP writes the counters; mount it on a metrics path.
+func (m *Metrics) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	codes := make([]int, 0, len(m.requests))
+	for code := range m.requests {
+		codes = append(codes, code)
+	}
+	sort.Ints(codes)
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	fmt.Fprintf(w, "# TYPE %s_http_requests_total counter\n", m.Name)
+	for _, code := range codes {
+		fmt.Fprintf(w, "%s_http_requests_total{code=\"%d\"} %d\n", m.Name, code, m.requests[code])
+	}
+	fmt.Fprintf(w, "# TYPE %s_http_request_duration_seconds_sum counter\n", m.Name)
+	fmt.Fprintf(w, "%s_http_request_duration_seconds_sum %g\n", m.Name, m.seconds)
+}
@@ -0,0 +1,76 @@
+// Package middleware provides composable net/http middlewares (authn, authz,
+// logging, metrics, rate limiting) so binaries in this module assemble the
+// same request pipeline instead of re-implementing it.
+//
+//	metrics := middleware.NewMetrics("demo_app")
+//	handler := middleware.Chain(mux,
+//		middleware.Logging("demo-app"),
+//		metrics.Middleware(),
+//		middleware.RateLimit(50, 100),
+//		middleware.Authn(validator),
+//	)
+package middleware
+
+import (
+	"log"
+	"net/http"
+	"time"
+)
+
+// Middleware wraps an http.Handler.
+type Middleware func(http.Handler) http.Handler
+
+// Chain wraps h so that the first middleware sees the request first.
+func Chain(h http.Handler, middlewares ...Middleware) http.Handler {
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		h = middlewares[i](h)
+	}
+	return h
+}
+
+// statusRecorder captures the response status for logging and metrics.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(code int) {
+	if r.status == 0 {
+		r.status = code
+	}
+	r.ResponseWriter.WriteHeader(code)
+}
+
+func (r *statusRecorder) Write(b []byte) (int, error) {
+	if r.status == 0 {
+		r.status = http.StatusOK
+	}
+	return r.ResponseWriter.Write(b)
+}
+
+// Flush keeps streaming responses (SSE) working through the wrapper.
+func (r *statusRecorder) Flush() {
+	if f, ok := r.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (r *statusRecorder) statusCode() int {
+	if r.status == 0 {
+		return http.StatusOK
+	}
+	return r.status
+}
+
+// Logging logs one line per request with its status and duration, prefixed
+// with [name].
+func Logging(name string) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			start := time.Now()
+			rec := &statusRecorder{ResponseWriter: w}
+			next.ServeHTTP(rec, r)
+			log.Printf("[%s] %s %s - Status: %d (%v)", name, r.Method, r.URL.Path, rec.statusCode(), time.Since(start).Round(time.Millisecond))
+		})
+	}
+}
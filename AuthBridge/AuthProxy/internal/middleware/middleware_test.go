@@ -0,0 +1,150 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+type fakeValidator struct{}
+
+func (fakeValidator) Validate(_ context.Context, token string) (Claims, error) {
+	if token != "good" {
+		return nil, errors.New("bad token")
+	}
+	return Claims{"sub": "alice", "scope": "openid mcp:read"}, nil
+}
+
+func serve(h http.Handler, authHeader string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, "/tools", nil)
+	if authHeader != "" {
+		req.Header.Set("Authorization", authHeader)
+	}
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestChainOrder(t *testing.T) {
+	var order []string
+	mark := func(name string) Middleware {
+		return func(next http.Handler) http.Handler {
+			return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				order = append(order, name)
+				next.ServeHTTP(w, r)
+			})
+		}
+	}
+	h := Chain(http.HandlerFunc(func(http.ResponseWriter, *http.Request) { order = append(order, "handler") }),
+		mark("first"), mark("second"))
+	serve(h, "")
+	if strings.Join(order, ",") != "first,second,handler" {
+		t.Errorf("unexpected order %v", order)
+	}
+}
+
+func TestAuthnAuthz(t *testing.T) {
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if ClaimsFromContext(r.Context())["sub"] != "alice" {
+			t.Error("claims not propagated to handler")
+		}
+		w.WriteHeader(http.StatusOK)
+	})
+
+	tests := []struct {
+		name       string
+		scope      string
+		authHeader string
+		wantStatus int
+	}{
+		{"missing header", "mcp:read", "", http.StatusUnauthorized},
+		{"not bearer", "mcp:read", "Basic Zm9v", http.StatusUnauthorized},
+		{"invalid token", "mcp:read", "Bearer bad", http.StatusUnauthorized},
+		{"valid with scope", "mcp:read", "Bearer good", http.StatusOK},
+		{"valid without scope", "mcp:write", "Bearer good", http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := Chain(ok, Authn(fakeValidator{}), Authz(RequireScope(tt.scope)))
+			rec := serve(h, tt.authHeader)
+			if rec.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", rec.Code, tt.wantStatus)
+			}
+			if rec.Code != http.StatusOK && rec.Header().Get("WWW-Authenticate") == "" {
+				t.Error("expected WWW-Authenticate on auth failure")
+			}
+		})
+	}
+}
+
+func TestMetrics(t *testing.T) {
+	m := NewMetrics("test")
+	h := Chain(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") == "" {
+			w.WriteHeader(http.StatusUnauthorized)
+		}
+	}), m.Middleware())
+	serve(h, "")
+	serve(h, "Bearer x")
+	serve(h, "Bearer x")
+
+	rec := httptest.NewRecorder()
+	m.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	body := rec.Body.String()
+	for _, want := range []string{`test_http_requests_total{code="200"} 2`, `test_http_requests_total{code="401"} 1`} {
+		if !strings.Contains(body, want) {
+			t.Errorf("metrics output missing %q:\n%s", want, body)
+		}
+	}
+}
+
+func TestTokenBucket(t *testing.T) {
+	now := time.Unix(0, 0)
+	b := NewTokenBucket(1, 2)
+
+	for i := 0; i < 2; i++ {
+		if ok, _ := b.Take(now); !ok {
+			t.Fatalf("burst request %d rejected", i)
+		}
+	}
+	ok, wait := b.Take(now)
+	if ok || wait != time.Second {
+		t.Fatalf("Take() = %v, %v; want rejection with 1s wait", ok, wait)
+	}
+	if b.Full(now) {
+		t.Error("Full() after the burst")
+	}
+	now = now.Add(time.Second)
+	if ok, _ := b.Take(now); !ok {
+		t.Error("token should be refilled after 1s")
+	}
+}
+
+func TestRateLimit(t *testing.T) {
+	h := Chain(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}), RateLimit(0.001, 1))
+	if rec := serve(h, ""); rec.Code != http.StatusOK {
+		t.Fatalf("first request status = %d", rec.Code)
+	}
+	rec := serve(h, "")
+	if rec.Code != http.StatusTooManyRequests || rec.Header().Get("Retry-After") == "" {
+		t.Errorf("expected 429 with Retry-After, got %d", rec.Code)
+	}
+}
+
+func TestRateLimitBy(t *testing.T) {
+	h := Chain(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}),
+		RateLimitBy(NewLocalLimiter(0.001, 1), func(r *http.Request) string { return r.Header.Get("Authorization") }))
+	if rec := serve(h, "Bearer alice"); rec.Code != http.StatusOK {
+		t.Fatalf("first request of alice: status = %d", rec.Code)
+	}
+	if rec := serve(h, "Bearer bob"); rec.Code != http.StatusOK {
+		t.Errorf("bob is limited by alice's requests: status = %d", rec.Code)
+	}
+	if rec := serve(h, "Bearer alice"); rec.Code != http.StatusTooManyRequests {
+		t.Errorf("second request of alice: status = %d, want 429", rec.Code)
+	}
+}
@@ -0,0 +1,122 @@
+package middleware
+
+import (
+	"context"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// maxIdleBuckets is the number of per-key buckets kept before full ones, i.e.
+// of callers idle long enough to have regained their burst, are dropped.
+const maxIdleBuckets = 1024
+
+// TokenBucket allows rate events per second with bursts up to burst. The
+// caller passes the current time, so it controls the clock.
+type TokenBucket struct {
+	mu     sync.Mutex
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+// NewTokenBucket returns a full bucket.
+func NewTokenBucket(rate float64, burst int) *TokenBucket {
+	return &TokenBucket{rate: rate, burst: float64(burst), tokens: float64(burst)}
+}
+
+// Take consumes a token, or returns how long until one is available.
+func (b *TokenBucket) Take(now time.Time) (bool, time.Duration) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if !b.last.IsZero() {
+		b.tokens = math.Min(b.burst, b.tokens+now.Sub(b.last).Seconds()*b.rate)
+	}
+	b.last = now
+	if b.tokens >= 1 {
+		b.tokens--
+		return true, 0
+	}
+	return false, time.Duration((1 - b.tokens) / b.rate * float64(time.Second))
+}
+
+// Full reports whether the bucket has regained its burst.
+func (b *TokenBucket) Full(now time.Time) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.last.IsZero() || b.tokens+now.Sub(b.last).Seconds()*b.rate >= b.burst
+}
+
+// Limiter decides whether the caller named key may make another request, and
+// if not, how long until it may.
+type Limiter interface {
+	Take(ctx context.Context, key string) (bool, time.Duration, error)
+}
+
+// LocalLimiter is a Limiter keeping a token bucket per key in memory, so
+// each process enforces its own limits.
+type LocalLimiter struct {
+	rate  float64
+	burst int
+	now   func() time.Time
+
+	mu      sync.Mutex
+	buckets map[string]*TokenBucket
+}
+
+// NewLocalLimiter allows each key rate requests per second with bursts up to
+// burst.
+func NewLocalLimiter(rate float64, burst int) *LocalLimiter {
+	return &LocalLimiter{rate: rate, burst: burst, now: time.Now, buckets: make(map[string]*TokenBucket)}
+}
+
+// Take implements Limiter; it never fails.
+func (l *LocalLimiter) Take(_ context.Context, key string) (bool, time.Duration, error) {
+	now := l.now()
+	l.mu.Lock()
+	b, ok := l.buckets[key]
+	if !ok {
+		if len(l.buckets) >= maxIdleBuckets {
+			for k, idle := range l.buckets {
+				if idle.Full(now) {
+					delete(l.buckets, k)
+				}
+			}
+		}
+		b = NewTokenBucket(l.rate, l.burst)
+		l.buckets[key] = b
+	}
+	l.mu.Unlock()
+	allowed, wait := b.Take(now)
+	return allowed, wait, nil
+}
+
+// RateLimit rejects requests beyond rate per second (bursts up to burst)
+// with 429 and a Retry-After header. The limit is shared by all callers.
+func RateLimit(rate float64, burst int) Middleware {
+	return RateLimitBy(NewLocalLimiter(rate, burst), func(*http.Request) string { return "" })
+}
+
+// RateLimitBy rejects requests beyond the limit of their caller, as named by
+// key, with 429 and a Retry-After header. Requests are let through if the
+// limiter fails.
+func RateLimitBy(limiter Limiter, key func(*http.Request) string) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ok, wait, err := limiter.Take(r.Context(), key(r))
+			if err != nil {
+				log.Printf("[RateLimit] Limiter failed, allowing request: %v", err)
+			} else if !ok {
+				w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+				http.Error(w, "rate limit exceeded", http.StatusTooManyRequests)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
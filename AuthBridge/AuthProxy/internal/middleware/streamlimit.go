@@ -0,0 +1,106 @@
+package middleware
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// IsStream reports whether r opens a long-lived stream: a WebSocket (or
+// other protocol) upgrade, or a request accepting Server-Sent Events.
+func IsStream(r *http.Request) bool {
+	if strings.EqualFold(r.Header.Get("Upgrade"), "websocket") ||
+		strings.Contains(strings.ToLower(r.Header.Get("Connection")), "upgrade") {
+		return true
+	}
+	return strings.Contains(r.Header.Get("Accept"), "text/event-stream")
+}
+
+// StreamLimiter caps the streams (see IsStream) each identity holds open at
+// once, so one caller cannot tie up the server with long-lived connections.
+// Other requests are not limited.
+type StreamLimiter struct {
+	// Max is the streams allowed per identity; Overrides replaces it for
+	// single identities. A cap of 0 means unlimited.
+	Max       int
+	Overrides map[string]int
+	// Identity names the caller of a request, e.g. its token's sub.
+	Identity func(*http.Request) string
+
+	mu     sync.Mutex
+	active map[string]int
+
+	rejected atomic.Uint64
+}
+
+// Middleware rejects streams beyond the caller's cap with 429.
+func (l *StreamLimiter) Middleware() Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !IsStream(r) {
+				next.ServeHTTP(w, r)
+				return
+			}
+			identity := l.Identity(r)
+			if !l.acquire(identity) {
+				l.rejected.Add(1)
+				http.Error(w, "too many concurrent streams", http.StatusTooManyRequests)
+				log.Printf("[StreamLimit] Rejected stream of %s: %s %s", identity, r.Method, r.URL.Path)
+				return
+			}
+			defer l.release(identity)
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func (l *StreamLimiter) acquire(identity string) bool {
+	limit := l.Max
+	if n, ok := l.Overrides[identity]; ok {
+		limit = n
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if limit > 0 && l.active[identity] >= limit {
+		return false
+	}
+	if l.active == nil {
+		l.active = make(map[string]int)
+	}
+	l.active[identity]++
+	return true
+}
+
+func (l *StreamLimiter) release(identity string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.active[identity]--; l.active[identity] <= 0 {
+		delete(l.active, identity)
+	}
+}
+
+// WriteMetrics writes the limiter's gauges and counters in the Prometheus
+// text format, with metric names starting with prefix. Identities are not
+// used as labels, so the series stay bounded.
+func (l *StreamLimiter) WriteMetrics(w io.Writer, prefix string) {
+	l.mu.Lock()
+	streams, identities := 0, len(l.active)
+	for _, n := range l.active {
+		streams += n
+	}
+	l.mu.Unlock()
+
+	fmt.Fprintf(w, "# HELP %s_active Streams open.\n", prefix)
+	fmt.Fprintf(w, "# TYPE %s_active gauge\n", prefix)
+	fmt.Fprintf(w, "%s_active %d\n", prefix, streams)
+	fmt.Fprintf(w, "# HELP %s_identities Identities with open streams.\n", prefix)
+	fmt.Fprintf(w, "# TYPE %s_identities gauge\n", prefix)
+	fmt.Fprintf(w, "%s_identities %d\n", prefix, identities)
+	fmt.Fprintf(w, "# HELP %s_rejected_total Streams rejected for exceeding their identity's cap.\n", prefix)
+	fmt.Fprintf(w, "# TYPE %s_rejected_total counter\n", prefix)
+	fmt.Fprintf(w, "%s_rejected_total %d\n", prefix, l.rejected.Load())
+}
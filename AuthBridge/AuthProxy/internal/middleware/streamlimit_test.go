@@ -0,0 +1,91 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestStreamLimiter(t *testing.T) {
+	l := &StreamLimiter{
+		Max:       1,
+		Overrides: map[string]int{"batch": 2},
+		Identity:  func(r *http.Request) string { return r.Header.Get("X-Identity") },
+	}
+	release := make(chan struct{})
+	var started sync.WaitGroup
+	// Requests with X-Hold stay open until release is closed
+	h := l.Middleware()(http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Hold") != "" {
+			started.Done()
+			<-release
+		}
+	}))
+
+	request := func(identity string, stream bool) *http.Request {
+		req := httptest.NewRequest(http.MethodGet, "/events", nil)
+		req.Header.Set("X-Identity", identity)
+		if stream {
+			req.Header.Set("Accept", "text/event-stream")
+		}
+		return req
+	}
+	// Open streams up to each identity's cap
+	var done sync.WaitGroup
+	for _, identity := range []string{"alice", "batch", "batch"} {
+		started.Add(1)
+		done.Add(1)
+		go func() {
+			defer done.Done()
+			req := request(identity, true)
+			req.Header.Set("X-Hold", "1")
+			h.ServeHTTP(httptest.NewRecorder(), req)
+		}()
+	}
+	started.Wait()
+
+	for _, identity := range []string{"alice", "batch"} {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, request(identity, true))
+		if rec.Code != http.StatusTooManyRequests {
+			t.Errorf("%s: status = %d, want 429", identity, rec.Code)
+		}
+	}
+	// Other identities and plain requests are not affected
+	for _, req := range []*http.Request{request("bob", true), request("alice", false)} {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		if rec.Code != http.StatusOK {
+			t.Errorf("status = %d, want 200", rec.Code)
+		}
+	}
+	close(release)
+	done.Wait()
+
+	var metrics strings.Builder
+	l.WriteMetrics(&metrics, "test_streams")
+	for _, want := range []string{"test_streams_active 0", "test_streams_rejected_total 2"} {
+		if !strings.Contains(metrics.String(), want) {
+			t.Errorf("metrics missing %q:\n%s", want, metrics.String())
+		}
+	}
+}
+
+func TestIsStream(t *testing.T) {
+	for _, tc := range []struct {
+		header http.Header
+		want   bool
+	}{
+		{http.Header{"Upgrade": {"websocket"}, "Connection": {"Upgrade"}}, true},
+		{http.Header{"Accept": {"text/event-stream"}}, true},
+		{http.Header{"Accept": {"application/json"}}, false},
+	} {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header = tc.header
+		if got := IsStream(req); got != tc.want {
+			t.Errorf("IsStream(%v) = %v, want %v", tc.header, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,148 @@
+// Package sharedlimit keeps rate limits in Redis, so the replicas of a proxy
+// fronting one tool enforce a caller's limit together rather than each
+// allowing it in full. The limit is a GCRA (generic cell rate algorithm)
+// token bucket kept as one key per caller, updated atomically by a Lua
+// script on Redis' clock, so replica clock skew does not matter.
+//
+// While Redis cannot be reached, each replica falls back to limiting on its
+// own, and goes back to Redis as soon as it answers again.
+package sharedlimit
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/kagenti/kagenti-extensions/AuthBridge/AuthProxy/internal/middleware"
+)
+
+// gcraScript takes a request from the bucket KEYS[1], whose theoretical
+// arrival time (TAT) is stored in microseconds. ARGV[1] is the interval
+// between requests at the limit and ARGV[2] the burst. It returns 0 if the
+// request is allowed, else the microseconds until it would be.
+const gcraScript = `
+local interval = tonumber(ARGV[1])
+local burst = tonumber(ARGV[2])
+local time = redis.call('TIME')
+local now = tonumber(time[1]) * 1000000 + tonumber(time[2])
+local tat = tonumber(redis.call('GET', KEYS[1]) or now)
+if tat < now then
+  tat = now
+end
+local next_tat = tat + interval
+local wait = next_tat - now - burst * interval
+if wait > 0 then
+  return math.ceil(wait)
+end
+redis.call('SET', KEYS[1], string.format('%d', next_tat), 'PX', math.ceil((next_tat - now) / 1000))
+return 0
+`
+
+// retryInterval is how often an unavailable Redis is tried again, so
+// requests do not each wait for a connection to time out.
+const retryInterval = time.Second
+
+var gcraSHA = func() string {
+	sum := sha1.Sum([]byte(gcraScript))
+	return hex.EncodeToString(sum[:])
+}()
+
+// Config locates the Redis server.
+type Config struct {
+	// Address is the host:port of the server
+	Address  string
+	Password string
+	// Prefix namespaces the keys, e.g. per tool
+	Prefix string
+	// Timeout bounds each call; a slow Redis must not hold up requests
+	Timeout time.Duration
+}
+
+// Limiter is a middleware.Limiter whose buckets live in Redis.
+type Limiter struct {
+	pool     *pool
+	prefix   string
+	interval int64
+	burst    int
+	// local limits while Redis is unavailable
+	local *middleware.LocalLimiter
+	// degraded is set while the local limiter is in use; Redis is tried
+	// again once per retryInterval
+	degraded atomic.Bool
+	retryAt  atomic.Int64
+	failures atomic.Uint64
+}
+
+// New returns a Limiter allowing each key rate requests per second with
+// bursts up to burst.
+func New(cfg Config, rate float64, burst int) *Limiter {
+	return &Limiter{
+		pool:     newPool(cfg.Address, cfg.Password, cfg.Timeout),
+		prefix:   cfg.Prefix,
+		interval: max(1, int64(1e6/rate)),
+		burst:    burst,
+		local:    middleware.NewLocalLimiter(rate, burst),
+	}
+}
+
+// Take implements middleware.Limiter. It falls back to the local limiter
+// rather than failing when Redis cannot be reached.
+func (l *Limiter) Take(ctx context.Context, key string) (bool, time.Duration, error) {
+	if l.degraded.Load() && time.Now().UnixNano() < l.retryAt.Load() {
+		return l.local.Take(ctx, key)
+	}
+	wait, err := l.take(ctx, l.prefix+key)
+	if err != nil {
+		l.failures.Add(1)
+		l.retryAt.Store(time.Now().Add(retryInterval).UnixNano())
+		if !l.degraded.Swap(true) {
+			log.Printf("[RateLimit] Redis unavailable, limiting per replica: %v", err)
+		}
+		return l.local.Take(ctx, key)
+	}
+	if l.degraded.Swap(false) {
+		log.Printf("[RateLimit] Redis available again, limiting across replicas")
+	}
+	return wait == 0, wait, nil
+}
+
+func (l *Limiter) take(ctx context.Context, key string) (time.Duration, error) {
+	args := []string{key, strconv.FormatInt(l.interval, 10), strconv.Itoa(l.burst)}
+	reply, err := l.pool.do(ctx, append([]string{"EVALSHA", gcraSHA, "1"}, args...)...)
+	var redisErr Error
+	if errors.As(err, &redisErr) && strings.HasPrefix(string(redisErr), "NOSCRIPT") {
+		// First call on this server, or its script cache was flushed
+		reply, err = l.pool.do(ctx, append([]string{"EVAL", gcraScript, "1"}, args...)...)
+	}
+	if err != nil {
+		return 0, err
+	}
+	micros, ok := reply.(int64)
+	if !ok {
+		return 0, fmt.Errorf("unexpected reply %v", reply)
+	}
+	return time.Duration(micros) * time.Microsecond, nil
+}
+
+// WriteMetrics writes the limiter's Redis failures and whether it limits per
+// replica in the Prometheus text format, with names starting with prefix.
+func (l *Limiter) WriteMetrics(w io.Writer, prefix string) {
+	degraded := 0
+	if l.degraded.Load() {
+		degraded = 1
+	}
+	fmt.Fprintf(w, "# HELP %s_degraded Whether rate limits are enforced per replica because Redis is unavailable.\n", prefix)
+	fmt.Fprintf(w, "# TYPE %s_degraded gauge\n", prefix)
+	fmt.Fprintf(w, "%s_degraded %d\n", prefix, degraded)
+	fmt.Fprintf(w, "# HELP %s_failures_total Rate limit checks Redis failed to answer.\n", prefix)
+	fmt.Fprintf(w, "# TYPE %s_failures_total counter\n", prefix)
+	fmt.Fprintf(w, "%s_failures_total %d\n", prefix, l.failures.Load())
+}
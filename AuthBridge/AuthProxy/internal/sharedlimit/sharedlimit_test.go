@@ -0,0 +1,173 @@
+package sharedlimit
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeRedis answers the limiter's commands like Redis would, running the
+// script as a plain counter: requests beyond the burst get a fixed wait.
+type fakeRedis struct {
+	mu       sync.Mutex
+	password string
+	scripts  map[string]bool
+	counts   map[string]int
+	commands []string
+}
+
+func startFakeRedis(t *testing.T, password string) (*fakeRedis, string) {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+	f := &fakeRedis{password: password, scripts: map[string]bool{}, counts: map[string]int{}}
+	go func() {
+		for {
+			c, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go f.serve(c)
+		}
+	}()
+	return f, l.Addr().String()
+}
+
+func (f *fakeRedis) serve(c net.Conn) {
+	defer c.Close()
+	r := bufio.NewReader(c)
+	authed := f.password == ""
+	for {
+		args, err := readCommand(r)
+		if err != nil {
+			return
+		}
+		f.mu.Lock()
+		f.commands = append(f.commands, args[0])
+		var reply string
+		switch {
+		case args[0] == "AUTH":
+			authed = args[1] == f.password
+			reply = "+OK\r\n"
+			if !authed {
+				reply = "-WRONGPASS invalid password\r\n"
+			}
+		case !authed:
+			reply = "-NOAUTH Authentication required.\r\n"
+		case args[0] == "EVALSHA" && !f.scripts[args[1]]:
+			reply = "-NOSCRIPT No matching script. Please use EVAL.\r\n"
+		case args[0] == "EVAL" || args[0] == "EVALSHA":
+			if args[0] == "EVAL" {
+				f.scripts[gcraSHA] = args[1] == gcraScript
+			}
+			key := args[3]
+			burst, _ := strconv.Atoi(args[5])
+			wait := 0
+			if f.counts[key]++; f.counts[key] > burst {
+				wait = 250000
+			}
+			reply = fmt.Sprintf(":%d\r\n", wait)
+		default:
+			reply = "-ERR unknown command\r\n"
+		}
+		f.mu.Unlock()
+		io.WriteString(c, reply)
+	}
+}
+
+func readCommand(r *bufio.Reader) ([]string, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	n, _ := strconv.Atoi(strings.TrimSpace(line[1:]))
+	args := make([]string, n)
+	for i := range args {
+		if _, err := r.ReadString('\n'); err != nil {
+			return nil, err
+		}
+		arg, err := r.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		// Arguments (scripts) may span lines; read up to the length given
+		for !strings.HasSuffix(arg, "\r\n") {
+			more, err := r.ReadString('\n')
+			if err != nil {
+				return nil, err
+			}
+			arg += more
+		}
+		args[i] = strings.TrimSuffix(arg, "\r\n")
+	}
+	return args, nil
+}
+
+func TestLimiter_SharedAcrossReplicas(t *testing.T) {
+	f, addr := startFakeRedis(t, "secret")
+	cfg := Config{Address: addr, Password: "secret", Prefix: "tool:", Timeout: time.Second}
+	replicas := []*Limiter{New(cfg, 1, 2), New(cfg, 1, 2)}
+
+	for i, l := range append(replicas, replicas...) {
+		ok, wait, err := l.Take(context.Background(), "alice")
+		if err != nil {
+			t.Fatalf("request %d: %v", i, err)
+		}
+		if want := i < 2; ok != want {
+			t.Errorf("request %d allowed = %t, want %t", i, ok, want)
+		}
+		if !ok && wait != 250*time.Millisecond {
+			t.Errorf("request %d wait = %s", i, wait)
+		}
+	}
+	if ok, _, _ := replicas[0].Take(context.Background(), "bob"); !ok {
+		t.Error("bob is limited by alice's requests")
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.counts["tool:alice"] != 4 {
+		t.Errorf("counts = %v, want 4 under the prefixed key", f.counts)
+	}
+	if evals := strings.Count(strings.Join(f.commands, " "), "EVAL "); evals != 1 {
+		t.Errorf("commands = %v, want the script loaded once", f.commands)
+	}
+}
+
+func TestLimiter_FallsBackWhenRedisIsDown(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := l.Addr().String()
+	l.Close()
+
+	limiter := New(Config{Address: addr, Timeout: 100 * time.Millisecond}, 0.001, 1)
+	ok, _, err := limiter.Take(context.Background(), "alice")
+	if !ok || err != nil {
+		t.Fatalf("first request: allowed = %t, err = %v", ok, err)
+	}
+	if ok, _, _ := limiter.Take(context.Background(), "alice"); ok {
+		t.Error("the local limiter should reject requests beyond the burst")
+	}
+	if !limiter.degraded.Load() || limiter.failures.Load() != 1 {
+		t.Errorf("degraded = %t, failures = %d; want Redis retried only after %s",
+			limiter.degraded.Load(), limiter.failures.Load(), retryInterval)
+	}
+
+	var metrics strings.Builder
+	limiter.WriteMetrics(&metrics, "test")
+	if !strings.Contains(metrics.String(), "test_degraded 1\n") {
+		t.Errorf("metrics:\n%s", metrics.String())
+	}
+}
@@ -0,0 +1,230 @@
+// Package upstream balances requests across all addresses a target hostname
+// resolves to, e.g. the pods behind a headless Service, instead of pinning
+// them to whichever address the default client's connection pool happens to
+// use.
+//
+// The hostname is re-resolved periodically, so scaled or rescheduled pods
+// are picked up. Endpoints are health-checked passively: after MaxFailures
+// consecutive transport errors an endpoint is ejected for EjectFor. When
+// every endpoint is ejected, all of them are tried again rather than failing
+// outright.
+package upstream
+
+import (
+	"context"
+	"crypto/tls"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"slices"
+	"sync"
+	"time"
+)
+
+// Config tunes a Balancer. Zero values use the defaults.
+type Config struct {
+	// Refresh is how often the hostname is re-resolved (default 30s).
+	Refresh time.Duration
+	// MaxFailures is the number of consecutive transport errors that eject
+	// an endpoint (default 3).
+	MaxFailures int
+	// EjectFor is how long an ejected endpoint is skipped (default 30s).
+	EjectFor time.Duration
+
+	// Lookup resolves a hostname; net.DefaultResolver.LookupHost by default.
+	Lookup func(ctx context.Context, host string) ([]string, error)
+	// Now is the clock; tests override it.
+	Now func() time.Time
+}
+
+func (c *Config) setDefaults() {
+	if c.Refresh <= 0 {
+		c.Refresh = 30 * time.Second
+	}
+	if c.MaxFailures <= 0 {
+		c.MaxFailures = 3
+	}
+	if c.EjectFor <= 0 {
+		c.EjectFor = 30 * time.Second
+	}
+	if c.Lookup == nil {
+		c.Lookup = net.DefaultResolver.LookupHost
+	}
+	if c.Now == nil {
+		c.Now = time.Now
+	}
+}
+
+type endpoint struct {
+	addr         string // ip:port
+	failures     int
+	ejectedUntil time.Time
+}
+
+// Balancer is an http.RoundTripper that sends each request to the next
+// healthy endpoint of its target host, round-robin. Requests for other hosts
+// go to the base transport unchanged.
+type Balancer struct {
+	host string // hostname as in the target URL
+	port string
+	base http.RoundTripper
+	cfg  Config
+
+	mu        sync.Mutex
+	endpoints []*endpoint
+	next      int
+}
+
+// New returns a Balancer for target's host. If base is an *http.Transport it
+// is cloned with the TLS server name set to the hostname, so certificates are
+// still verified against the name rather than the endpoint IP.
+func New(target *url.URL, base http.RoundTripper, cfg Config) *Balancer {
+	cfg.setDefaults()
+	port := target.Port()
+	if port == "" {
+		port = "80"
+		if target.Scheme == "https" {
+			port = "443"
+		}
+	}
+	if t, ok := base.(*http.Transport); ok {
+		t = t.Clone()
+		if t.TLSClientConfig == nil {
+			t.TLSClientConfig = &tls.Config{}
+		}
+		if t.TLSClientConfig.ServerName == "" {
+			t.TLSClientConfig.ServerName = target.Hostname()
+		}
+		base = t
+	}
+	return &Balancer{host: target.Hostname(), port: port, base: base, cfg: cfg}
+}
+
+// Start resolves the hostname now and then every Refresh until ctx is done.
+func (b *Balancer) Start(ctx context.Context) {
+	if err := b.Refresh(ctx); err != nil {
+		log.Printf("upstream: resolving %s: %v", b.host, err)
+	}
+	go func() {
+		ticker := time.NewTicker(b.cfg.Refresh)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if err := b.Refresh(ctx); err != nil {
+					log.Printf("upstream: re-resolving %s, keeping %d endpoints: %v", b.host, len(b.Endpoints()), err)
+				}
+			}
+		}
+	}()
+}
+
+// Refresh re-resolves the hostname. Endpoints that are still listed keep
+// their health state. On error, or when nothing resolves, the current
+// endpoints are kept.
+func (b *Balancer) Refresh(ctx context.Context) error {
+	ips, err := b.cfg.Lookup(ctx, b.host)
+	if err != nil {
+		return err
+	}
+	if len(ips) == 0 {
+		return nil
+	}
+	slices.Sort(ips)
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	current := make(map[string]*endpoint, len(b.endpoints))
+	for _, e := range b.endpoints {
+		current[e.addr] = e
+	}
+	endpoints := make([]*endpoint, 0, len(ips))
+	for _, ip := range slices.Compact(ips) {
+		addr := net.JoinHostPort(ip, b.port)
+		if e, ok := current[addr]; ok {
+			endpoints = append(endpoints, e)
+		} else {
+			endpoints = append(endpoints, &endpoint{addr: addr})
+		}
+	}
+	if !slices.EqualFunc(endpoints, b.endpoints, func(a, c *endpoint) bool { return a.addr == c.addr }) {
+		log.Printf("upstream: %s resolves to %d endpoints", b.host, len(endpoints))
+	}
+	b.endpoints = endpoints
+	return nil
+}
+
+// Endpoints returns the current endpoint addresses.
+func (b *Balancer) Endpoints() []string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	addrs := make([]string, len(b.endpoints))
+	for i, e := range b.endpoints {
+		addrs[i] = e.addr
+	}
+	return addrs
+}
+
+// pick returns the next healthy endpoint, or nil before the first successful
+// resolution.
+func (b *Balancer) pick() *endpoint {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	n := len(b.endpoints)
+	if n == 0 {
+		return nil
+	}
+	now := b.cfg.Now()
+	for i := 0; i < n; i++ {
+		e := b.endpoints[(b.next+i)%n]
+		if !now.Before(e.ejectedUntil) {
+			b.next = (b.next + i + 1) % n
+			return e
+		}
+	}
+	// All ejected: better to try one than to fail every request
+	e := b.endpoints[b.next%n]
+	b.next = (b.next + 1) % n
+	return e
+}
+
+func (b *Balancer) report(e *endpoint, err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if err == nil {
+		e.failures = 0
+		return
+	}
+	e.failures++
+	if e.failures >= b.cfg.MaxFailures {
+		e.ejectedUntil = b.cfg.Now().Add(b.cfg.EjectFor)
+		e.failures = 0
+		log.Printf("upstream: ejecting %s (%s) for %s: %v", e.addr, b.host, b.cfg.EjectFor, err)
+	}
+}
+
+// RoundTrip sends req to the next healthy endpoint, keeping the original
+// Host header.
+func (b *Balancer) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.URL.Hostname() != b.host {
+		return b.base.RoundTrip(req)
+	}
+	e := b.pick()
+	if e == nil {
+		return b.base.RoundTrip(req)
+	}
+	out := req.Clone(req.Context())
+	out.URL.Host = e.addr
+	if out.Host == "" {
+		out.Host = req.URL.Host
+	}
+	resp, err := b.base.RoundTrip(out)
+	if req.Context().Err() == nil {
+		// A cancelled caller says nothing about the endpoint
+		b.report(e, err)
+	}
+	return resp, err
+}
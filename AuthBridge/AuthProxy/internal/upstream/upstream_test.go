@@ -0,0 +1,193 @@
+package upstream
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+// recordingTransport answers every request itself and records the endpoint
+// it was sent to. Endpoints in down fail with a transport error.
+type recordingTransport struct {
+	hits []string
+	down map[string]bool
+}
+
+func (t *recordingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	t.hits = append(t.hits, req.URL.Host)
+	if t.down[req.URL.Host] {
+		return nil, errors.New("connection refused")
+	}
+	return &http.Response{StatusCode: http.StatusOK, Body: io.NopCloser(strings.NewReader("")), Request: req}, nil
+}
+
+type fakeDNS struct {
+	ips []string
+	err error
+}
+
+func (d *fakeDNS) lookup(context.Context, string) ([]string, error) {
+	return d.ips, d.err
+}
+
+func newTestBalancer(t *testing.T, dns *fakeDNS, rt http.RoundTripper, now *time.Time) *Balancer {
+	t.Helper()
+	target, _ := url.Parse("http://tools.team1.svc.cluster.local:8081")
+	b := New(target, rt, Config{MaxFailures: 2, EjectFor: time.Minute, Lookup: dns.lookup, Now: func() time.Time { return *now }})
+	if err := b.Refresh(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func get(t *testing.T, rt http.RoundTripper) error {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodGet, "http://tools.team1.svc.cluster.local:8081/mcp", nil)
+	req.RequestURI = ""
+	resp, err := rt.RoundTrip(req)
+	if err == nil {
+		resp.Body.Close()
+	}
+	return err
+}
+
+func TestRoundRobin(t *testing.T) {
+	now := time.Now()
+	rt := &recordingTransport{}
+	b := newTestBalancer(t, &fakeDNS{ips: []string{"10.0.0.2", "10.0.0.1", "10.0.0.3"}}, rt, &now)
+
+	for i := 0; i < 6; i++ {
+		if err := get(t, b); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want := []string{"10.0.0.1:8081", "10.0.0.2:8081", "10.0.0.3:8081", "10.0.0.1:8081", "10.0.0.2:8081", "10.0.0.3:8081"}
+	if !slices.Equal(rt.hits, want) {
+		t.Errorf("hits = %v, want %v", rt.hits, want)
+	}
+}
+
+func TestEjectsFailingEndpoint(t *testing.T) {
+	now := time.Now()
+	rt := &recordingTransport{down: map[string]bool{"10.0.0.1:8081": true}}
+	b := newTestBalancer(t, &fakeDNS{ips: []string{"10.0.0.1", "10.0.0.2"}}, rt, &now)
+
+	// Two failures eject 10.0.0.1
+	for i := 0; i < 4; i++ {
+		get(t, b)
+	}
+	rt.hits = nil
+	for i := 0; i < 3; i++ {
+		if err := get(t, b); err != nil {
+			t.Fatalf("request sent to an ejected endpoint: %v", err)
+		}
+	}
+	if slices.Contains(rt.hits, "10.0.0.1:8081") {
+		t.Errorf("ejected endpoint still used: %v", rt.hits)
+	}
+
+	// After EjectFor it is tried again
+	now = now.Add(time.Minute)
+	rt.hits = nil
+	get(t, b)
+	get(t, b)
+	if !slices.Contains(rt.hits, "10.0.0.1:8081") {
+		t.Errorf("endpoint not retried after ejection: %v", rt.hits)
+	}
+}
+
+func TestAllEjectedStillTries(t *testing.T) {
+	now := time.Now()
+	rt := &recordingTransport{down: map[string]bool{"10.0.0.1:8081": true}}
+	b := newTestBalancer(t, &fakeDNS{ips: []string{"10.0.0.1"}}, rt, &now)
+
+	get(t, b)
+	get(t, b)
+	rt.hits = nil
+	get(t, b)
+	if len(rt.hits) != 1 {
+		t.Errorf("expected the only endpoint to be tried, got %v", rt.hits)
+	}
+}
+
+func TestRefreshKeepsHealthAndSurvivesErrors(t *testing.T) {
+	now := time.Now()
+	dns := &fakeDNS{ips: []string{"10.0.0.1", "10.0.0.2"}}
+	rt := &recordingTransport{down: map[string]bool{"10.0.0.1:8081": true}}
+	b := newTestBalancer(t, dns, rt, &now)
+	for i := 0; i < 4; i++ {
+		get(t, b)
+	}
+
+	// Scale out: the ejected endpoint stays ejected
+	dns.ips = []string{"10.0.0.3", "10.0.0.2", "10.0.0.1"}
+	if err := b.Refresh(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if got := b.Endpoints(); !slices.Equal(got, []string{"10.0.0.1:8081", "10.0.0.2:8081", "10.0.0.3:8081"}) {
+		t.Fatalf("Endpoints() = %v", got)
+	}
+	rt.hits = nil
+	for i := 0; i < 4; i++ {
+		get(t, b)
+	}
+	if slices.Contains(rt.hits, "10.0.0.1:8081") {
+		t.Errorf("refresh reset the ejection: %v", rt.hits)
+	}
+
+	// DNS failures and empty answers keep the current endpoints
+	dns.err = errors.New("SERVFAIL")
+	if err := b.Refresh(context.Background()); err == nil {
+		t.Error("expected the lookup error")
+	}
+	dns.ips, dns.err = nil, nil
+	b.Refresh(context.Background())
+	if len(b.Endpoints()) != 3 {
+		t.Errorf("endpoints dropped: %v", b.Endpoints())
+	}
+}
+
+func TestPreservesHostHeader(t *testing.T) {
+	var gotHost string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotHost = r.Host
+	}))
+	defer srv.Close()
+	srvURL, _ := url.Parse(srv.URL)
+
+	target, _ := url.Parse("http://tools.example.com:" + srvURL.Port())
+	b := New(target, http.DefaultTransport, Config{Lookup: (&fakeDNS{ips: []string{"127.0.0.1"}}).lookup})
+	b.Refresh(context.Background())
+
+	resp, err := (&http.Client{Transport: b}).Get(target.String() + "/mcp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if gotHost != target.Host {
+		t.Errorf("Host = %q, want %q", gotHost, target.Host)
+	}
+}
+
+func TestOtherHostsAndUnresolvedPassThrough(t *testing.T) {
+	now := time.Now()
+	rt := &recordingTransport{}
+	target, _ := url.Parse("http://tools.example.com")
+	b := New(target, rt, Config{Lookup: (&fakeDNS{}).lookup, Now: func() time.Time { return now }})
+
+	// Nothing resolved yet: the hostname is used as is
+	req := httptest.NewRequest(http.MethodGet, "http://tools.example.com/", nil)
+	b.RoundTrip(req)
+	req = httptest.NewRequest(http.MethodGet, "http://other.example.com/", nil)
+	b.RoundTrip(req)
+	if !slices.Equal(rt.hits, []string{"tools.example.com", "other.example.com"}) {
+		t.Errorf("hits = %v", rt.hits)
+	}
+}
@@ -2,41 +2,66 @@ package main
 
 import (
 	"bytes"
+	"context"
 	"crypto/tls"
+	"flag"
 	"io"
 	"log"
+	"net"
 	"net/http"
 	"net/url"
 	"os"
 	"strings"
+
+	"github.com/kagenti/kagenti-extensions/AuthBridge/AuthProxy/internal/connlimit"
+	"github.com/kagenti/kagenti-extensions/AuthBridge/AuthProxy/internal/mcpauth"
+	"github.com/kagenti/kagenti-extensions/AuthBridge/AuthProxy/internal/middleware"
+	"github.com/kagenti/kagenti-extensions/AuthBridge/AuthProxy/internal/upstream"
+	"github.com/kagenti/kagenti-extensions/configschema"
 )
 
 const (
-	defaultTargetServiceURL      = "http://demo-app-service:8081"
-	defaultTargetServiceHTTPSURL = "https://demo-app-service:8443"
-	proxyPort                    = "0.0.0.0:8080"
-	tlsTestPrefix                = "/tls-test"
+	proxyPort     = "0.0.0.0:8080"
+	tlsTestPrefix = "/tls-test"
 )
 
 func main() {
-	targetServiceURL := os.Getenv("TARGET_SERVICE_URL")
-	if targetServiceURL == "" {
-		targetServiceURL = defaultTargetServiceURL
+	printSchema := flag.Bool("config-schema", false, "Print the JSON Schema of the environment variables and exit")
+	flag.Parse()
+	if *printSchema {
+		data, err := configschema.EnvSchema(proxyConfig{}, "AuthProxy environment")
+		if err != nil {
+			log.Fatal(err)
+		}
+		os.Stdout.Write(append(data, '\n'))
+		return
 	}
 
-	targetServiceHTTPSURL := os.Getenv("TARGET_SERVICE_HTTPS_URL")
-	if targetServiceHTTPSURL == "" {
-		targetServiceHTTPSURL = defaultTargetServiceHTTPSURL
+	var cfg proxyConfig
+	if err := configschema.DecodeEnv(os.LookupEnv, &cfg); err != nil {
+		log.Fatalf("Invalid configuration: %v", err)
 	}
+	targetServiceURL := cfg.TargetServiceURL
+	targetServiceHTTPSURL := cfg.TargetServiceHTTPSURL
 
+	defaultClient = upstreamClient(targetServiceURL, http.DefaultTransport.(*http.Transport).Clone(), &cfg)
 	// Client for HTTPS target (self-signed cert)
-	httpsClient := &http.Client{
-		Transport: &http.Transport{
-			TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
-		},
+	httpsClient := upstreamClient(targetServiceHTTPSURL, &http.Transport{
+		TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+	}, &cfg)
+
+	auth, err := authenticators(&cfg)
+	if err != nil {
+		log.Fatalf("Invalid authenticator config: %v", err)
+	}
+	tlsCfg, err := proxyTLSConfig(&cfg)
+	if err != nil {
+		log.Fatalf("Invalid TLS config: %v", err)
 	}
 
-	http.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+	limit := rateLimit(&cfg)
+	mux := http.NewServeMux()
+	mux.Handle("/", authenticated(limitIdentityRate(limitStreams(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		if rest, ok := strings.CutPrefix(r.URL.Path, tlsTestPrefix); ok {
 			// Forward to the HTTPS target with the prefix stripped
 			r.URL.Path = rest
@@ -47,16 +72,98 @@ func main() {
 		} else {
 			proxyHandler(w, r, targetServiceURL)
 		}
-	})
+	}), &cfg), limit, &cfg), auth, &cfg))
+
+	// MCP authorization mode: serve the protected resource metadata unless
+	// the target publishes its own
+	mcpAuth, err := cfg.MCPAuth.Config(cfg.Issuer)
+	if err != nil {
+		log.Fatalf("Invalid MCP authorization config: %v", err)
+	}
+	if mcpAuth != nil && !mcpAuth.Forward {
+		mux.Handle(mcpauth.WellKnownPath, mcpAuth)
+		if path := mcpAuth.MetadataPath(); path != mcpauth.WellKnownPath {
+			mux.Handle(path, mcpAuth)
+		}
+		log.Printf("Serving MCP protected resource metadata for %s", mcpAuth.Resource)
+	}
+
 	log.Printf("Auth proxy starting on port %s", proxyPort)
 	log.Printf("Forwarding HTTP  requests to %s", targetServiceURL)
 	log.Printf("Forwarding HTTPS requests (/tls-test) to %s", targetServiceHTTPSURL)
-	log.Printf("JWT validation is handled by the inbound ext proc")
-	log.Fatal(http.ListenAndServe(proxyPort, nil))
+	if len(auth) == 0 {
+		log.Printf("JWT validation is handled by the inbound ext proc")
+	}
+
+	// A global rate limit applies to every request, authenticated or not
+	var middlewares []middleware.Middleware
+	if limit != nil && cfg.RateLimitKey == rateLimitGlobal {
+		middlewares = append(middlewares, limit)
+	}
+
+	startMetricsServer(&cfg)
+
+	server := newServer(middleware.Chain(mux, middlewares...), &cfg)
+	lis, err := net.Listen("tcp", proxyPort)
+	if err != nil {
+		log.Fatalf("Failed to listen on %s: %v", proxyPort, err)
+	}
+	if n := cfg.MaxConnections; n > 0 {
+		lis = connlimit.NewListener(lis, n)
+		log.Printf("Connection limit: %d", n)
+	}
+	if tlsCfg != nil {
+		server.TLSConfig = tlsCfg
+		log.Printf("Serving TLS (client certificates: %s)", tlsCfg.ClientAuth)
+		// TLSConfig already has the cert; pass empty strings to use it
+		log.Fatal(server.ServeTLS(lis, "", ""))
+	}
+	log.Fatal(server.Serve(lis))
+}
+
+// newServer returns the proxy server with deadlines that stop slow clients
+// from holding connections open: a client must send its headers within
+// PROXY_READ_HEADER_TIMEOUT and idle keep-alive connections are closed after
+// PROXY_IDLE_TIMEOUT. PROXY_READ_TIMEOUT and PROXY_WRITE_TIMEOUT bound the
+// whole request and response; they are off by default so large uploads and
+// streamed (SSE) responses keep working.
+func newServer(handler http.Handler, cfg *proxyConfig) *http.Server {
+	server := &http.Server{
+		Handler:           handler,
+		ReadHeaderTimeout: cfg.ReadHeaderTimeout,
+		ReadTimeout:       cfg.ReadTimeout,
+		WriteTimeout:      cfg.WriteTimeout,
+		IdleTimeout:       cfg.IdleTimeout,
+		MaxHeaderBytes:    cfg.MaxHeaderBytes,
+	}
+	log.Printf("Server timeouts: read_header=%s read=%s write=%s idle=%s max_header_bytes=%d",
+		server.ReadHeaderTimeout, server.ReadTimeout, server.WriteTimeout, server.IdleTimeout, server.MaxHeaderBytes)
+	return server
 }
 
 var defaultClient = &http.Client{}
 
+// upstreamClient returns a client for targetURL that balances requests across
+// every address its hostname resolves to (e.g. a headless Service), unless
+// UPSTREAM_LOAD_BALANCING is "false".
+func upstreamClient(targetURL string, base *http.Transport, cfg *proxyConfig) *http.Client {
+	target, err := url.Parse(targetURL)
+	if err != nil {
+		log.Fatalf("Invalid target URL %q: %v", targetURL, err)
+	}
+	if !cfg.LoadBalancing || net.ParseIP(target.Hostname()) != nil {
+		return &http.Client{Transport: base}
+	}
+	balancer := upstream.New(target, base, upstream.Config{
+		Refresh:     cfg.DNSRefresh,
+		MaxFailures: cfg.MaxFailures,
+		EjectFor:    cfg.EjectTime,
+	})
+	balancer.Start(context.Background())
+	log.Printf("Balancing %s across %v", target.Host, balancer.Endpoints())
+	return &http.Client{Transport: balancer}
+}
+
 func proxyHandler(w http.ResponseWriter, r *http.Request, targetServiceURL string) {
 	proxyHandlerWithClient(w, r, targetServiceURL, defaultClient)
 }
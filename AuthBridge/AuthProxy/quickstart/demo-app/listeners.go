@@ -0,0 +1,245 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"gopkg.in/yaml.v3"
+
+	"github.com/kagenti/kagenti-extensions/AuthBridge/AuthProxy/internal/middleware"
+)
+
+// Listener protocols supported by the demo-app.
+const (
+	protocolHTTP  = "http"
+	protocolHTTPS = "https"
+	protocolMTLS  = "mtls"
+	protocolGRPC  = "grpc"
+)
+
+// listenerConfig describes one port exposed by the demo-app.
+type listenerConfig struct {
+	Name     string `yaml:"name"`
+	Address  string `yaml:"address"`
+	Protocol string `yaml:"protocol"`
+	// JWT enables bearer token validation against JWKS_URL/ISSUER/AUDIENCE.
+	JWT bool `yaml:"jwt"`
+	// TLS serves a grpc listener over TLS (https and mtls always use TLS).
+	TLS bool `yaml:"tls"`
+	// CertFile/KeyFile override the in-memory self-signed certificate.
+	CertFile string `yaml:"cert_file"`
+	KeyFile  string `yaml:"key_file"`
+	// ClientCAFile is the CA bundle used to verify client certificates (mtls only).
+	ClientCAFile string `yaml:"client_ca_file"`
+}
+
+type listenersFile struct {
+	Listeners []listenerConfig `yaml:"listeners"`
+}
+
+// defaultListeners reproduces the original fixed layout: JWT-validated HTTP
+// on 8081 and a TLS echo on 8443 for passthrough tests.
+func defaultListeners() []listenerConfig {
+	return []listenerConfig{
+		{Name: "http", Address: httpPort, Protocol: protocolHTTP, JWT: true},
+		{Name: "https", Address: httpsPort, Protocol: protocolHTTPS},
+	}
+}
+
+// loadListeners reads the listener matrix from path, falling back to the
+// default layout when path is empty.
+func loadListeners(path string) ([]listenerConfig, error) {
+	if path == "" {
+		return defaultListeners(), nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read listeners config: %w", err)
+	}
+	var file listenersFile
+	if err := yaml.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("parse listeners config: %w", err)
+	}
+	if len(file.Listeners) == 0 {
+		return nil, fmt.Errorf("listeners config %s defines no listeners", path)
+	}
+
+	seen := make(map[string]bool)
+	for i := range file.Listeners {
+		l := &file.Listeners[i]
+		l.Protocol = strings.ToLower(l.Protocol)
+		if l.Protocol == "" {
+			l.Protocol = protocolHTTP
+		}
+		if l.Name == "" {
+			l.Name = fmt.Sprintf("%s-%d", l.Protocol, i)
+		}
+		if seen[l.Name] {
+			return nil, fmt.Errorf("duplicate listener name %q", l.Name)
+		}
+		seen[l.Name] = true
+		if l.Address == "" {
+			return nil, fmt.Errorf("listener %q: address is required", l.Name)
+		}
+		switch l.Protocol {
+		case protocolHTTP, protocolHTTPS, protocolGRPC:
+		case protocolMTLS:
+			if l.ClientCAFile == "" {
+				return nil, fmt.Errorf("listener %q: client_ca_file is required for mtls", l.Name)
+			}
+		default:
+			return nil, fmt.Errorf("listener %q: unknown protocol %q", l.Name, l.Protocol)
+		}
+		if (l.CertFile == "") != (l.KeyFile == "") {
+			return nil, fmt.Errorf("listener %q: cert_file and key_file must be set together", l.Name)
+		}
+	}
+	return file.Listeners, nil
+}
+
+// usesTLS reports whether the listener terminates TLS.
+func (l listenerConfig) usesTLS() bool {
+	return l.Protocol == protocolHTTPS || l.Protocol == protocolMTLS || (l.Protocol == protocolGRPC && l.TLS)
+}
+
+// tlsConfig builds the server TLS settings for the listener. selfSigned is
+// used when no cert_file/key_file is configured.
+func (l listenerConfig) tlsConfig(selfSigned func() (tls.Certificate, error)) (*tls.Config, error) {
+	var cert tls.Certificate
+	var err error
+	if l.CertFile != "" {
+		cert, err = tls.LoadX509KeyPair(l.CertFile, l.KeyFile)
+	} else {
+		cert, err = selfSigned()
+	}
+	if err != nil {
+		return nil, fmt.Errorf("listener %q: load certificate: %w", l.Name, err)
+	}
+
+	cfg := &tls.Config{Certificates: []tls.Certificate{cert}}
+	if l.Protocol == protocolMTLS {
+		caPEM, err := os.ReadFile(l.ClientCAFile)
+		if err != nil {
+			return nil, fmt.Errorf("listener %q: read client CA: %w", l.Name, err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(caPEM) {
+			return nil, fmt.Errorf("listener %q: no certificates found in %s", l.Name, l.ClientCAFile)
+		}
+		cfg.ClientCAs = pool
+		cfg.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	return cfg, nil
+}
+
+// httpHandler builds the handler for an HTTP-family listener. auth is the
+// validator shared by all JWT-enabled listeners.
+func (l listenerConfig) httpHandler(auth middleware.TokenValidator, metrics *middleware.Metrics, recorder *requestRecorder, tokens *tokenHelper) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/agent.json", agentCardHandler)
+	mux.Handle("/metrics", metrics)
+	if tokens != nil {
+		mux.Handle(tokenHelperPath, tokens)
+	}
+	if l.JWT {
+		mux.Handle("/", middleware.Authn(auth)(http.HandlerFunc(authorizedHandler)))
+	} else {
+		body := []byte("ok")
+		if l.usesTLS() {
+			body = []byte("tls-ok")
+		}
+		mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusOK)
+			w.Write(body)
+		})
+	}
+
+	var handler http.Handler = mux
+	if recorder != nil {
+		mux.Handle(testRequestsPath, recorder)
+		handler = recorder.wrap(l.Name, mux)
+	}
+	return middleware.Chain(handler, middleware.Logging(l.Name), metrics.Middleware())
+}
+
+// serveHTTP runs an http, https or mtls listener until it fails.
+func (l listenerConfig) serveHTTP(handler http.Handler, tlsCfg *tls.Config) error {
+	server := &http.Server{
+		Addr:      l.Address,
+		Handler:   handler,
+		TLSConfig: tlsCfg,
+	}
+	if tlsCfg != nil {
+		// TLSConfig already has the cert; pass empty strings to use it
+		return server.ListenAndServeTLS("", "")
+	}
+	return server.ListenAndServe()
+}
+
+// serveGRPC runs a grpc listener exposing the standard health service.
+// With jwt enabled every call must carry a valid bearer token in the
+// authorization metadata.
+func (l listenerConfig) serveGRPC(auth middleware.TokenValidator, tlsCfg *tls.Config) error {
+	lis, err := net.Listen("tcp", l.Address)
+	if err != nil {
+		return err
+	}
+
+	var opts []grpc.ServerOption
+	if tlsCfg != nil {
+		opts = append(opts, grpc.Creds(credentials.NewTLS(tlsCfg)))
+	}
+	if l.JWT {
+		opts = append(opts,
+			grpc.UnaryInterceptor(func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+				if err := l.authorizeGRPC(ctx, auth); err != nil {
+					return nil, err
+				}
+				return handler(ctx, req)
+			}),
+			grpc.StreamInterceptor(func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+				if err := l.authorizeGRPC(ss.Context(), auth); err != nil {
+					return err
+				}
+				return handler(srv, ss)
+			}),
+		)
+	}
+
+	server := grpc.NewServer(opts...)
+	healthpb.RegisterHealthServer(server, health.NewServer())
+	return server.Serve(lis)
+}
+
+func (l listenerConfig) authorizeGRPC(ctx context.Context, auth middleware.TokenValidator) error {
+	md, _ := metadata.FromIncomingContext(ctx)
+	values := md.Get("authorization")
+	if len(values) == 0 {
+		log.Printf("[%s] Unauthorized gRPC call (missing authorization metadata)", l.Name)
+		return status.Error(codes.Unauthenticated, "missing authorization metadata")
+	}
+	tokenString, ok := strings.CutPrefix(values[0], "Bearer ")
+	if !ok {
+		log.Printf("[%s] Unauthorized gRPC call (invalid authorization format)", l.Name)
+		return status.Error(codes.Unauthenticated, "invalid authorization format")
+	}
+	if _, err := auth.Validate(ctx, tokenString); err != nil {
+		log.Printf("[%s] Unauthorized gRPC call (invalid token): %v", l.Name, err)
+		return status.Error(codes.Unauthenticated, "unauthorized")
+	}
+	return nil
+}
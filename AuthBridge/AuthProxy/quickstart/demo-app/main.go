@@ -14,11 +14,13 @@ import (
 	"math/big"
 	"net/http"
 	"os"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/lestrrat-go/jwx/v2/jwk"
-	"github.com/lestrrat-go/jwx/v2/jwt"
+
+	"github.com/kagenti/kagenti-extensions/AuthBridge/AuthProxy/internal/middleware"
 )
 
 const (
@@ -26,75 +28,102 @@ const (
 	httpsPort = "0.0.0.0:8443"
 )
 
-var jwksCache *jwk.Cache
-
 func main() {
-	jwksURL := os.Getenv("JWKS_URL")
-	if jwksURL == "" {
-		log.Fatal("JWKS_URL environment variable is required")
+	listeners, err := loadListeners(os.Getenv("LISTENERS_CONFIG"))
+	if err != nil {
+		log.Fatalf("Failed to load listeners: %v", err)
 	}
 
-	issuer := os.Getenv("ISSUER")
-	if issuer == "" {
-		log.Fatal("ISSUER environment variable is required")
+	jwtRequired := false
+	for _, l := range listeners {
+		jwtRequired = jwtRequired || l.JWT
 	}
 
-	audience := os.Getenv("AUDIENCE")
-	if audience == "" {
-		log.Fatal("AUDIENCE environment variable is required")
+	auth := &middleware.JWKSValidator{
+		JWKSURL:  os.Getenv("JWKS_URL"),
+		Issuer:   os.Getenv("ISSUER"),
+		Audience: os.Getenv("AUDIENCE"),
 	}
+	if jwtRequired {
+		if auth.JWKSURL == "" {
+			log.Fatal("JWKS_URL environment variable is required")
+		}
+		if auth.Issuer == "" {
+			log.Fatal("ISSUER environment variable is required")
+		}
+		if auth.Audience == "" {
+			log.Fatal("AUDIENCE environment variable is required")
+		}
 
-	// Initialize JWKS cache
-	ctx := context.Background()
-	jwksCache = jwk.NewCache(ctx)
-	if err := jwksCache.Register(jwksURL); err != nil {
-		log.Fatalf("Failed to register JWKS URL: %v", err)
+		// Initialize JWKS cache
+		auth.Cache = jwk.NewCache(context.Background())
+		if err := auth.Cache.Register(auth.JWKSURL); err != nil {
+			log.Fatalf("Failed to register JWKS URL: %v", err)
+		}
+		log.Printf("JWKS URL: %s", auth.JWKSURL)
+		log.Printf("Expected issuer: %s", auth.Issuer)
+		log.Printf("Expected audience: %s", auth.Audience)
 	}
 
-	// HTTP server on port 8081 with JWT validation
-	httpMux := http.NewServeMux()
-	httpMux.HandleFunc("/.well-known/agent.json", agentCardHandler)
-	httpMux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
-		authHandler(w, r, jwksURL, issuer, audience)
-	})
+	// Request counters shared by all HTTP listeners, served at /metrics
+	metrics := middleware.NewMetrics("demo_app")
 
-	// HTTPS server on port 8443 — simple echo, no JWT validation.
-	// This port is used to verify TLS passthrough through Envoy works.
-	httpsMux := http.NewServeMux()
-	httpsMux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
-		w.WriteHeader(http.StatusOK)
-		w.Write([]byte("tls-ok"))
-		log.Printf("HTTPS request served: %s %s", r.Method, r.URL.Path)
-	})
+	// Optional request recorder for e2e assertions (never enable in production:
+	// it exposes forwarded headers, including Authorization)
+	var recorder *requestRecorder
+	if os.Getenv("ENABLE_TEST_RECORDER") == "true" {
+		capacity, _ := strconv.Atoi(os.Getenv("TEST_RECORDER_SIZE"))
+		recorder = newRequestRecorder(capacity)
+		log.Printf("Test request recorder enabled at %s", testRequestsPath)
+	}
 
-	tlsCert, err := generateSelfSignedCert()
+	// Optional test token helper for quickstarts (never enable in production:
+	// it hands out tokens of its client to anyone reaching the listener)
+	tokens, err := loadTokenHelper()
 	if err != nil {
-		log.Fatalf("Failed to generate self-signed TLS certificate: %v", err)
+		log.Fatalf("Failed to configure token helper: %v", err)
 	}
-
-	httpsServer := &http.Server{
-		Addr:    httpsPort,
-		Handler: httpsMux,
-		TLSConfig: &tls.Config{
-			Certificates: []tls.Certificate{tlsCert},
-		},
+	if tokens != nil {
+		log.Printf("Token helper enabled at %s (token URL %s)", tokenHelperPath, tokens.tokenURL)
 	}
 
-	log.Printf("Demo app HTTP  starting on %s (JWT validation enabled)", httpPort)
-	log.Printf("Demo app HTTPS starting on %s (echo only, no JWT validation)", httpsPort)
-	log.Printf("JWKS URL: %s", jwksURL)
-	log.Printf("Expected issuer: %s", issuer)
-	log.Printf("Expected audience: %s", audience)
+	// All listeners without an explicit certificate share one self-signed cert
+	var selfSigned *tls.Certificate
+	selfSignedCert := func() (tls.Certificate, error) {
+		if selfSigned == nil {
+			cert, err := generateSelfSignedCert()
+			if err != nil {
+				return tls.Certificate{}, err
+			}
+			selfSigned = &cert
+		}
+		return *selfSigned, nil
+	}
 
-	// Start HTTPS listener in a goroutine
-	go func() {
-		// TLSConfig already has the cert; pass empty strings to use it
-		if err := httpsServer.ListenAndServeTLS("", ""); err != nil {
-			log.Fatalf("HTTPS server failed: %v", err)
+	errCh := make(chan error, len(listeners))
+	for _, l := range listeners {
+		var tlsCfg *tls.Config
+		if l.usesTLS() {
+			if tlsCfg, err = l.tlsConfig(selfSignedCert); err != nil {
+				log.Fatalf("Failed to configure TLS: %v", err)
+			}
 		}
-	}()
 
-	log.Fatal(http.ListenAndServe(httpPort, httpMux))
+		log.Printf("Demo app %s listener %q starting on %s (JWT validation: %t)",
+			strings.ToUpper(l.Protocol), l.Name, l.Address, l.JWT)
+
+		go func(l listenerConfig, tlsCfg *tls.Config) {
+			var err error
+			if l.Protocol == protocolGRPC {
+				err = l.serveGRPC(auth, tlsCfg)
+			} else {
+				err = l.serveHTTP(l.httpHandler(auth, metrics, recorder, tokens), tlsCfg)
+			}
+			errCh <- fmt.Errorf("listener %q failed: %w", l.Name, err)
+		}(l, tlsCfg)
+	}
+
+	log.Fatal(<-errCh)
 }
 
 // generateSelfSignedCert creates an in-memory self-signed TLS certificate.
@@ -160,92 +189,28 @@ func agentCardHandler(w http.ResponseWriter, r *http.Request) {
 	log.Printf("AgentCard served: %s %s", r.Method, r.URL.Path)
 }
 
-func validateJWT(tokenString, jwksURL, expectedIssuer, expectedAudience string) error {
-	ctx := context.Background()
-
-	// Fetch JWKS from cache
-	keySet, err := jwksCache.Get(ctx, jwksURL)
-	if err != nil {
-		return fmt.Errorf("failed to fetch JWKS: %w", err)
-	}
-
-	// Parse and validate the token
-	token, err := jwt.Parse([]byte(tokenString), jwt.WithKeySet(keySet), jwt.WithValidate(true))
-	if err != nil {
-		return fmt.Errorf("failed to parse/validate token: %w", err)
-	}
-
-	// Validate issuer claim
-	if token.Issuer() != expectedIssuer {
-		return fmt.Errorf("invalid issuer: expected %s, got %s", expectedIssuer, token.Issuer())
-	}
-
-	// Validate audience claim
-	audiences := token.Audience()
-	validAudience := false
-	for _, aud := range audiences {
-		if aud == expectedAudience {
-			validAudience = true
-			break
-		}
-	}
-	if !validAudience {
-		return fmt.Errorf("invalid audience: expected %s, got %v", expectedAudience, audiences)
-	}
-
-	// Log JWT claims for debugging
+// authorizedHandler answers requests that passed middleware.Authn and logs
+// the validated claims for debugging.
+func authorizedHandler(w http.ResponseWriter, r *http.Request) {
+	claims := middleware.ClaimsFromContext(r.Context())
 	log.Printf("[JWT Debug] Successfully validated token")
-	log.Printf("[JWT Debug] Issuer: %s", token.Issuer())
-	log.Printf("[JWT Debug] Subject: %s", token.Subject())
-	log.Printf("[JWT Debug] Audience: %v", audiences)
+	log.Printf("[JWT Debug] Issuer: %v", claims["iss"])
+	log.Printf("[JWT Debug] Subject: %v", claims["sub"])
+	log.Printf("[JWT Debug] Audience: %v", claims["aud"])
 
-	// Extract and log preferred_username if present (shows the actual username)
-	if preferredUsername, ok := token.Get("preferred_username"); ok {
+	// preferred_username shows the actual username
+	if preferredUsername, ok := claims["preferred_username"]; ok {
 		log.Printf("[JWT Debug] Preferred Username: %v", preferredUsername)
 	}
-
-	// Extract and log azp (authorized party) if present
-	if azp, ok := token.Get("azp"); ok {
+	if azp, ok := claims["azp"]; ok {
 		log.Printf("[JWT Debug] Authorized Party (azp): %v", azp)
 	}
-
-	// Extract and log scope claim if present
-	if scopeClaim, ok := token.Get("scope"); ok {
+	if scopeClaim, ok := claims["scope"]; ok {
 		log.Printf("[JWT Debug] Scope: %v", scopeClaim)
 	} else {
 		log.Printf("[JWT Debug] Scope: <not present>")
 	}
 
-	return nil
-}
-
-func authHandler(w http.ResponseWriter, r *http.Request, jwksURL, issuer, audience string) {
-	authHeader := r.Header.Get("Authorization")
-
-	if authHeader == "" {
-		w.WriteHeader(http.StatusUnauthorized)
-		w.Write([]byte("unauthorized: missing Authorization header"))
-		log.Printf("Unauthorized request (missing auth header): %s %s", r.Method, r.URL.Path)
-		return
-	}
-
-	// Extract token from "Bearer <token>" format
-	tokenString := strings.TrimPrefix(authHeader, "Bearer ")
-	if tokenString == authHeader {
-		w.WriteHeader(http.StatusUnauthorized)
-		w.Write([]byte("unauthorized: invalid Authorization header format"))
-		log.Printf("Unauthorized request (invalid auth format): %s %s", r.Method, r.URL.Path)
-		return
-	}
-
-	// Validate JWT
-	if err := validateJWT(tokenString, jwksURL, issuer, audience); err != nil {
-		w.WriteHeader(http.StatusUnauthorized)
-		w.Write([]byte("unauthorized"))
-		log.Printf("Unauthorized request (invalid token): %s %s - %v", r.Method, r.URL.Path, err)
-		return
-	}
-
 	w.WriteHeader(http.StatusOK)
 	w.Write([]byte("authorized"))
 	log.Printf("Authorized request: %s %s", r.Method, r.URL.Path)
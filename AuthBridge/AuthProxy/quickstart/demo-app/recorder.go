@@ -0,0 +1,140 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/lestrrat-go/jwx/v2/jwt"
+)
+
+const testRequestsPath = "/__test/requests"
+
+// recordedRequest is what the demo-app saw for one request, as returned by
+// the /__test/requests endpoint.
+type recordedRequest struct {
+	Time     time.Time              `json:"time"`
+	Listener string                 `json:"listener"`
+	Method   string                 `json:"method"`
+	Host     string                 `json:"host"`
+	Path     string                 `json:"path"`
+	Headers  map[string][]string    `json:"headers"`
+	Claims   map[string]interface{} `json:"claims,omitempty"`
+	Status   int                    `json:"status"`
+}
+
+// requestRecorder keeps the most recent requests in a fixed-size ring so e2e
+// suites can assert exactly what AuthBridge forwarded.
+type requestRecorder struct {
+	mu       sync.Mutex
+	entries  []recordedRequest
+	capacity int
+}
+
+func newRequestRecorder(capacity int) *requestRecorder {
+	if capacity <= 0 {
+		capacity = 100
+	}
+	return &requestRecorder{capacity: capacity}
+}
+
+func (rr *requestRecorder) add(entry recordedRequest) {
+	rr.mu.Lock()
+	defer rr.mu.Unlock()
+	rr.entries = append(rr.entries, entry)
+	if len(rr.entries) > rr.capacity {
+		rr.entries = rr.entries[len(rr.entries)-rr.capacity:]
+	}
+}
+
+// snapshot returns up to limit of the most recent entries, oldest first.
+func (rr *requestRecorder) snapshot(limit int) []recordedRequest {
+	rr.mu.Lock()
+	defer rr.mu.Unlock()
+	entries := rr.entries
+	if limit > 0 && len(entries) > limit {
+		entries = entries[len(entries)-limit:]
+	}
+	out := make([]recordedRequest, len(entries))
+	copy(out, entries)
+	return out
+}
+
+func (rr *requestRecorder) reset() {
+	rr.mu.Lock()
+	defer rr.mu.Unlock()
+	rr.entries = nil
+}
+
+// wrap records every request served by next on the named listener,
+// except calls to the recorder API itself.
+func (rr *requestRecorder) wrap(listener string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == testRequestsPath {
+			next.ServeHTTP(w, r)
+			return
+		}
+		sw := &statusWriter{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(sw, r)
+
+		rr.add(recordedRequest{
+			Time:     time.Now().UTC(),
+			Listener: listener,
+			Method:   r.Method,
+			Host:     r.Host,
+			Path:     r.URL.Path,
+			Headers:  r.Header.Clone(),
+			Claims:   unverifiedClaims(r.Header.Get("Authorization")),
+			Status:   sw.status,
+		})
+	})
+}
+
+// ServeHTTP implements the /__test/requests API:
+//   - GET returns recorded requests as JSON (optional ?limit=N)
+//   - DELETE clears the recording
+func (rr *requestRecorder) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(rr.snapshot(limit))
+	case http.MethodDelete:
+		rr.reset()
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// unverifiedClaims decodes the bearer token payload without verifying it.
+// Recording is for test assertions only; authHandler does the real validation.
+func unverifiedClaims(authHeader string) map[string]interface{} {
+	tokenString, ok := strings.CutPrefix(authHeader, "Bearer ")
+	if !ok || tokenString == "" {
+		return nil
+	}
+	token, err := jwt.ParseInsecure([]byte(tokenString))
+	if err != nil {
+		return nil
+	}
+	claims, err := token.AsMap(context.Background())
+	if err != nil {
+		return nil
+	}
+	return claims
+}
+
+type statusWriter struct {
+	http.ResponseWriter
+	status int
+}
+
+func (w *statusWriter) WriteHeader(status int) {
+	w.status = status
+	w.ResponseWriter.WriteHeader(status)
+}
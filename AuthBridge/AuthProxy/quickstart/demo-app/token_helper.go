@@ -0,0 +1,86 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+)
+
+const tokenHelperPath = "/token"
+
+// tokenHelper gets test tokens from the IdP on behalf of quickstart users,
+// so they need neither the client secret nor extra tooling: a POST with
+// username and password (and optionally scope) performs a password grant,
+// one without a client_credentials grant. The IdP's response is returned
+// unchanged.
+type tokenHelper struct {
+	tokenURL     string
+	clientID     string
+	clientSecret string
+	client       *http.Client
+}
+
+// loadTokenHelper reads the token helper settings; it is nil unless
+// ENABLE_TOKEN_HELPER=true.
+func loadTokenHelper() (*tokenHelper, error) {
+	if os.Getenv("ENABLE_TOKEN_HELPER") != "true" {
+		return nil, nil
+	}
+	h := &tokenHelper{
+		tokenURL:     os.Getenv("TOKEN_HELPER_TOKEN_URL"),
+		clientID:     os.Getenv("TOKEN_HELPER_CLIENT_ID"),
+		clientSecret: os.Getenv("TOKEN_HELPER_CLIENT_SECRET"),
+		client:       &http.Client{Timeout: 10 * time.Second},
+	}
+	if h.tokenURL == "" || h.clientID == "" {
+		return nil, fmt.Errorf("TOKEN_HELPER_TOKEN_URL and TOKEN_HELPER_CLIENT_ID are required with ENABLE_TOKEN_HELPER=true")
+	}
+	return h, nil
+}
+
+func (h *tokenHelper) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "invalid form", http.StatusBadRequest)
+		return
+	}
+	form := url.Values{"client_id": {h.clientID}}
+	if h.clientSecret != "" {
+		form.Set("client_secret", h.clientSecret)
+	}
+	username, password := r.PostForm.Get("username"), r.PostForm.Get("password")
+	switch {
+	case username != "" && password != "":
+		form.Set("grant_type", "password")
+		form.Set("username", username)
+		form.Set("password", password)
+	case username == "" && password == "":
+		form.Set("grant_type", "client_credentials")
+	default:
+		http.Error(w, "username and password must be given together", http.StatusBadRequest)
+		return
+	}
+	if scope := r.PostForm.Get("scope"); scope != "" {
+		form.Set("scope", scope)
+	}
+
+	resp, err := h.client.PostForm(h.tokenURL, form)
+	if err != nil {
+		log.Printf("Token helper: token request failed: %v", err)
+		http.Error(w, "token request failed", http.StatusBadGateway)
+		return
+	}
+	defer resp.Body.Close()
+	log.Printf("Token helper: %s grant returned %d", form.Get("grant_type"), resp.StatusCode)
+	w.Header().Set("Content-Type", resp.Header.Get("Content-Type"))
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(resp.StatusCode)
+	io.Copy(w, resp.Body)
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"log"
+	"math"
+	"net/http"
+
+	"github.com/kagenti/kagenti-extensions/AuthBridge/AuthProxy/internal/middleware"
+	"github.com/kagenti/kagenti-extensions/AuthBridge/AuthProxy/internal/sharedlimit"
+)
+
+// RATE_LIMIT_KEY values
+const (
+	rateLimitGlobal   = "global"
+	rateLimitIdentity = "identity"
+)
+
+// sharedLimiter keeps the rate limits in Redis; nil unless
+// RATE_LIMIT_REDIS_ADDRESS is set.
+var sharedLimiter *sharedlimit.Limiter
+
+// rateLimit returns the middleware enforcing RATE_LIMIT_RPS, e.g.
+// RATE_LIMIT_RPS=20 RATE_LIMIT_BURST=40, or nil when it is unset. The limit
+// applies to all callers together, or with RATE_LIMIT_KEY=identity to each
+// caller. It is kept in Redis with RATE_LIMIT_REDIS_ADDRESS, so replicas of
+// the proxy enforce it together, else in memory per replica.
+func rateLimit(cfg *proxyConfig) middleware.Middleware {
+	rps := cfg.RateLimitRPS
+	if rps <= 0 {
+		return nil
+	}
+	burst := cfg.RateLimitBurst
+	if burst < 1 {
+		burst = int(math.Ceil(rps))
+	}
+	key := func(*http.Request) string { return rateLimitGlobal }
+	if cfg.RateLimitKey == rateLimitIdentity {
+		key = func(r *http.Request) string { return rateLimitIdentity + ":" + callerIdentity(r) }
+	}
+	var limiter middleware.Limiter = middleware.NewLocalLimiter(rps, burst)
+	if cfg.RateLimitRedisAddress != "" {
+		sharedLimiter = sharedlimit.New(sharedlimit.Config{
+			Address:  cfg.RateLimitRedisAddress,
+			Password: cfg.RateLimitRedisPassword,
+			Prefix:   cfg.RateLimitRedisPrefix,
+			Timeout:  cfg.RateLimitRedisTimeout,
+		}, rps, burst)
+		limiter = sharedLimiter
+		log.Printf("Rate limits kept in Redis at %s", cfg.RateLimitRedisAddress)
+	}
+	log.Printf("Rate limit: %g requests/s (burst %d) per %s", rps, burst, cfg.RateLimitKey)
+	return middleware.RateLimitBy(limiter, key)
+}
+
+// limitIdentityRate applies a RATE_LIMIT_KEY=identity limit to h, which runs
+// after the authenticators so the limit is keyed by the identity they
+// accepted.
+func limitIdentityRate(h http.Handler, limit middleware.Middleware, cfg *proxyConfig) http.Handler {
+	if limit == nil || cfg.RateLimitKey != rateLimitIdentity {
+		return h
+	}
+	return limit(h)
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/kagenti/kagenti-extensions/AuthBridge/AuthProxy/internal/middleware"
+)
+
+// streamLimiter caps the SSE and WebSocket streams per identity; nil when
+// PROXY_STREAMS_PER_IDENTITY and the overrides are unset.
+var streamLimiter *middleware.StreamLimiter
+
+// parseStreamOverrides parses PROXY_STREAM_LIMIT_OVERRIDES entries of the
+// form identity=count.
+func parseStreamOverrides(entries []string) (map[string]int, error) {
+	overrides := make(map[string]int, len(entries))
+	for _, e := range entries {
+		// Identities such as SPIFFE IDs contain no "=", counts never do
+		i := strings.LastIndex(e, "=")
+		if i <= 0 {
+			return nil, fmt.Errorf("stream limit override %q is not identity=count", e)
+		}
+		n, err := strconv.Atoi(e[i+1:])
+		if err != nil || n < 0 {
+			return nil, fmt.Errorf("invalid count in stream limit override %q", e)
+		}
+		overrides[e[:i]] = n
+	}
+	return overrides, nil
+}
+
+// limitStreams applies the per-identity stream caps to h.
+func limitStreams(h http.Handler, cfg *proxyConfig) http.Handler {
+	overrides, _ := parseStreamOverrides(cfg.StreamLimitOverrides) // checked by Validate
+	if cfg.StreamsPerIdentity == 0 && len(overrides) == 0 {
+		return h
+	}
+	streamLimiter = &middleware.StreamLimiter{Max: cfg.StreamsPerIdentity, Overrides: overrides, Identity: callerIdentity}
+	log.Printf("Stream limit: %d per identity (%d overrides)", cfg.StreamsPerIdentity, len(overrides))
+	return streamLimiter.Middleware()(h)
+}
+
+// callerIdentity names the caller of r for the stream and rate limits by
+// verified credentials only, so callers cannot pick the bucket they count
+// against: the sub of the credential accepted by PROXY_AUTHENTICATORS, else
+// the SPIFFE ID (or common name) of a verified client certificate, else its
+// IP address.
+func callerIdentity(r *http.Request) string {
+	if sub, _ := middleware.ClaimsFromContext(r.Context())["sub"].(string); sub != "" {
+		return sub
+	}
+	if claims, err := (middleware.MTLSAuthenticator{}).Authenticate(r); err == nil {
+		return claims["sub"].(string)
+	}
+	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		return host
+	}
+	return r.RemoteAddr
+}
+
+// startMetricsServer serves the proxy's metrics on PROXY_METRICS_ADDRESS. It
+// is off when the variable is unset.
+func startMetricsServer(cfg *proxyConfig) {
+	if cfg.MetricsAddress == "" {
+		return
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/metrics", func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		if streamLimiter != nil {
+			streamLimiter.WriteMetrics(w, "authproxy_streams")
+		}
+		if sharedLimiter != nil {
+			sharedLimiter.WriteMetrics(w, "authproxy_rate_limit_redis")
+		}
+	})
+	go func() {
+		log.Printf("Serving metrics on %s", cfg.MetricsAddress)
+		log.Fatal(http.ListenAndServe(cfg.MetricsAddress, mux))
+	}()
+}
@@ -6,11 +6,16 @@ Idempotent:
 - Creates the client if it does not exist.
 - If the client already exists, reuses it.
 - Always retrieves and stores the client secret.
+- With CREDENTIALS_SECRET_NAME set, also stores the client ID and secret in
+  that Kubernetes Secret, owned by the CREDENTIALS_OWNER_* resource.
 """
 
 import os
+import tempfile
 from typing import Any
+import certifi
 import jwt
+import requests
 from keycloak import KeycloakAdmin, KeycloakPostError
 
 
@@ -32,9 +37,10 @@ def write_client_secret(
     internal_client_id: str,
     client_name: str,
     secret_file_path: str = "secret.txt",
-) -> None:
+) -> str | None:
     """
     Retrieve the secret for a Keycloak client and write it to a file.
+    Returns the secret, or None if it could not be retrieved.
     """
     try:
         # There will be a value field if client authentication is enabled
@@ -43,7 +49,7 @@ def write_client_secret(
         print(f'Successfully retrieved secret for client "{client_name}".')
     except KeycloakPostError as e:
         print(f"Could not retrieve secret for client '{client_name}': {e}")
-        return
+        return None
 
     try:
         with open(secret_file_path, "w") as f:
@@ -51,6 +57,75 @@ def write_client_secret(
         print(f'Secret written to file: "{secret_file_path}"')
     except OSError as ose:
         print(f"Error writing secret to file: {ose}")
+    return secret
+
+
+def keycloak_ca_bundle() -> str | bool:
+    """
+    Return the CA bundle used to verify Keycloak: the default roots plus the
+    PEM bundle in TRUST_BUNDLE_FILE when set, or True for the defaults alone.
+    """
+    trust_bundle_file = os.environ.get("TRUST_BUNDLE_FILE")
+    if not trust_bundle_file:
+        return True
+    with open(certifi.where(), "r") as f:
+        default_roots = f.read()
+    with open(trust_bundle_file, "r") as f:
+        extra = f.read()
+    with tempfile.NamedTemporaryFile("w", suffix=".pem", delete=False) as f:
+        f.write(default_roots + "\n" + extra)
+    print(f'Trusting extra CAs from "{trust_bundle_file}"')
+    return f.name
+
+
+SERVICE_ACCOUNT_DIR = "/var/run/secrets/kubernetes.io/serviceaccount"
+
+
+def write_credentials_secret(client_id: str, secret: str, secret_name: str, namespace: str) -> None:
+    """
+    Create or replace a Secret holding the client credentials, owned by the
+    resource named in the CREDENTIALS_OWNER_* variables so it is deleted with it.
+    Uses the pod's service account, which needs get on the owner resource and
+    create/update on secrets in the namespace.
+    """
+    api = f"https://{get_env_var('KUBERNETES_SERVICE_HOST')}:{get_env_var('KUBERNETES_SERVICE_PORT')}"
+    with open(f"{SERVICE_ACCOUNT_DIR}/token", "r") as f:
+        token = f.read().strip()
+    session = requests.Session()
+    session.headers["Authorization"] = f"Bearer {token}"
+    session.verify = f"{SERVICE_ACCOUNT_DIR}/ca.crt"
+
+    owner_api_version = get_env_var("CREDENTIALS_OWNER_API_VERSION")
+    owner_kind = get_env_var("CREDENTIALS_OWNER_KIND")
+    owner_name = get_env_var("CREDENTIALS_OWNER_NAME")
+    owner_url = (
+        f"{api}/apis/{owner_api_version}/namespaces/{namespace}/"
+        f"{get_env_var('CREDENTIALS_OWNER_RESOURCE')}/{owner_name}"
+    )
+    resp = session.get(owner_url, timeout=10)
+    resp.raise_for_status()
+    owner_uid = resp.json()["metadata"]["uid"]
+
+    body = {
+        "apiVersion": "v1",
+        "kind": "Secret",
+        "metadata": {
+            "name": secret_name,
+            "namespace": namespace,
+            "labels": {"app.kubernetes.io/managed-by": "kagenti-client-registration"},
+            "ownerReferences": [
+                {"apiVersion": owner_api_version, "kind": owner_kind, "name": owner_name, "uid": owner_uid}
+            ],
+        },
+        "type": "Opaque",
+        "stringData": {"client-id.txt": client_id, "client-secret.txt": secret},
+    }
+    secrets_url = f"{api}/api/v1/namespaces/{namespace}/secrets"
+    resp = session.put(f"{secrets_url}/{secret_name}", json=body, timeout=10)
+    if resp.status_code == 404:
+        resp = session.post(secrets_url, json=body, timeout=10)
+    resp.raise_for_status()
+    print(f'Credentials written to Secret "{namespace}/{secret_name}"')
 
 
 # TODO: refactor this function so kagenti-client-registration image can use it
@@ -136,6 +211,7 @@ keycloak_admin = KeycloakAdmin(
     password=get_env_var("KEYCLOAK_ADMIN_PASSWORD"),
     realm_name=get_env_var("KEYCLOAK_REALM"),
     user_realm_name="master",
+    verify=keycloak_ca_bundle(),
 )
 
 internal_client_id = register_client(
@@ -169,11 +245,24 @@ except ValueError:
 print(
     f'Writing secret for client ID: "{client_id}" (internal client ID: "{internal_client_id}") to file: "{secret_file_path}"'
 )
-write_client_secret(
+client_secret = write_client_secret(
     keycloak_admin,
     internal_client_id,
     client_name,
     secret_file_path=secret_file_path,
 )
 
+credentials_secret_name = os.environ.get("CREDENTIALS_SECRET_NAME")
+if credentials_secret_name and client_secret is not None:
+    try:
+        write_credentials_secret(
+            client_id,
+            client_secret,
+            credentials_secret_name,
+            get_env_var("CREDENTIALS_SECRET_NAMESPACE"),
+        )
+    except (OSError, ValueError, requests.RequestException) as e:
+        print(f'Could not write credentials to Secret "{credentials_secret_name}": {e}')
+        exit(1)
+
 print("Client registration complete.")
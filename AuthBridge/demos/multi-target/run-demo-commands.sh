@@ -67,5 +67,5 @@ echo ""
 echo ""
 echo "=== AuthBridge Token Exchange Logs ==="
 kubectl logs deployment/agent -n authbridge -c envoy-proxy --tail=500 2>&1 | \
-  grep -E "Host.*matched|Using route target_audience|Successfully exchanged token," | \
-  tail -12
+  grep "Token exchanged" | \
+  tail -3
@@ -9,6 +9,7 @@ Keycloak remains the source of truth - this script only proposes changes.
 """
 
 import argparse
+import re
 import sys
 import yaml
 from dataclasses import dataclass
@@ -387,8 +388,19 @@ def load_routes(path: str) -> list[RouteTarget]:
     for route in routes:
         if not route.get("target_audience"):
             continue  # Skip routes without audience (e.g., passthrough-only)
-
-        scopes = route.get("token_scopes", "").split()
+        if "{{" in route["target_audience"]:
+            # Templated audiences are rendered per request; their concrete
+            # target clients must be provisioned separately
+            print(f"Skipping templated audience {route['target_audience']!r} for host {route.get('host', '')!r}")
+            continue
+
+        scopes = []
+        # Placeholders may contain spaces: {{ namespace }}:read is one scope
+        for scope in re.findall(r"(?:\{\{.*?\}\}|\S)+", route.get("token_scopes", "")):
+            if "{{" in scope:
+                print(f"Skipping templated scope {scope!r} for host {route.get('host', '')!r}")
+                continue
+            scopes.append(scope)
         targets.append(RouteTarget(
             host=route.get("host", ""),
             audience=route["target_audience"],
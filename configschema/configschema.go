@@ -0,0 +1,551 @@
+// Package configschema decodes configuration files and environment variables
+// into typed structs the same way in every component: unknown fields are
+// errors, ${VAR} references are expanded if enabled, defaults come from
+// struct tags and the result is validated. Schema and EnvSchema export the same structs as
+// JSON Schema, so each format is documented by the code that reads it.
+//
+// In files, a field's name is its json tag, else its yaml tag; fields with
+// neither are not configurable. Embedded structs and ",inline" fields are
+// flattened. DecodeEnv reads fields with an env tag instead. Further tags:
+//
+//	default:"5s"   value of a field that is zero before decoding, so an
+//	               explicit zero in the input is kept
+//	doc:"..."      description in the schema
+//
+// After SetExpandEnv(true), string values in files may reference the
+// environment as ${NAME} or ${NAME:-fallback}; an unset NAME without
+// fallback is an error, and $${ stands for a literal ${. Expansion is off by
+// default, so values containing ${ keep their meaning unless a deployment
+// opts in.
+//
+// Types implementing json.Unmarshaler (e.g. Kubernetes quantities and times)
+// decode their value through it; time.Duration is a Go duration string.
+//
+// It is a module of its own, shared by AuthBridge/AuthProxy and
+// kagenti-webhook through replace directives.
+package configschema
+
+import (
+	"encoding"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Validator is implemented by configs that check themselves after decoding.
+type Validator interface {
+	Validate() error
+}
+
+// expandEnv enables ${VAR} references in files; see SetExpandEnv.
+var expandEnv atomic.Bool
+
+// SetExpandEnv turns expanding ${VAR} references in decoded files on or off.
+// Components set it once at startup from their configuration.
+func SetExpandEnv(on bool) {
+	expandEnv.Store(on)
+}
+
+var (
+	durationType        = reflect.TypeOf(time.Duration(0))
+	jsonUnmarshalerType = reflect.TypeOf((*json.Unmarshaler)(nil)).Elem()
+	textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+)
+
+// Decode strictly decodes a YAML or JSON document into v, a non-nil pointer.
+// Defaults from tags are applied first, to v and to every struct the
+// document adds. Fields absent from data keep their current value, so v may
+// also be prepared with defaults in code; maps are merged and slices
+// replaced. v is then validated if it implements Validator.
+func Decode(data []byte, v any) error {
+	_, err := DecodeExpanded(data, v)
+	return err
+}
+
+// DecodeExpanded is Decode that also returns the string values ${VAR}
+// expansion produced, so that callers showing the configuration can redact
+// them. It returns none unless SetExpandEnv enabled expansion.
+func DecodeExpanded(data []byte, v any) ([]string, error) {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Pointer || rv.IsNil() {
+		return nil, errors.New("configschema: Decode needs a non-nil pointer")
+	}
+	var root yaml.Node
+	if err := yaml.Unmarshal(data, &root); err != nil {
+		return nil, err
+	}
+	if err := applyDefaults(rv.Elem(), ""); err != nil {
+		return nil, err
+	}
+	var d decoder
+	if root.Kind == yaml.DocumentNode && len(root.Content) > 0 {
+		if err := d.decodeNode(root.Content[0], rv.Elem(), ""); err != nil {
+			return nil, err
+		}
+	}
+	return d.expanded, validate(v)
+}
+
+// DecodeEnv sets the fields of v, a pointer to a struct, that have an env
+// tag from the variables lookup returns (e.g. os.LookupEnv); empty values
+// count as unset. Slices are comma-separated. Nested structs without an env
+// tag are searched too. Defaults and validation apply as in Decode.
+func DecodeEnv(lookup func(string) (string, bool), v any) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Pointer || rv.IsNil() || rv.Elem().Kind() != reflect.Struct {
+		return errors.New("configschema: DecodeEnv needs a pointer to a struct")
+	}
+	if err := applyDefaults(rv.Elem(), ""); err != nil {
+		return err
+	}
+	if err := decodeEnv(lookup, rv.Elem()); err != nil {
+		return err
+	}
+	return validate(v)
+}
+
+func validate(v any) error {
+	if validator, ok := v.(Validator); ok {
+		return validator.Validate()
+	}
+	return nil
+}
+
+// field is a configurable struct field.
+type field struct {
+	name  string
+	index []int
+	doc   string
+	def   string
+	typ   reflect.Type
+}
+
+// fields lists the configurable fields of struct type t, keyed by the json
+// or yaml name, or by the env tag when env is set.
+func fields(t reflect.Type, env bool) []field {
+	var out []field
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		name, inline := fieldName(sf, env)
+		if name == "-" || (!sf.IsExported() && !sf.Anonymous) {
+			continue
+		}
+		ft := sf.Type
+		if ft.Kind() == reflect.Pointer {
+			ft = ft.Elem()
+		}
+		if (inline || (sf.Anonymous && name == "")) && ft.Kind() == reflect.Struct {
+			for _, f := range fields(ft, env) {
+				f.index = append([]int{i}, f.index...)
+				out = append(out, f)
+			}
+			continue
+		}
+		if name == "" || !sf.IsExported() {
+			continue
+		}
+		out = append(out, field{name: name, index: []int{i}, doc: sf.Tag.Get("doc"), def: sf.Tag.Get("default"), typ: sf.Type})
+	}
+	return out
+}
+
+func fieldName(sf reflect.StructField, env bool) (name string, inline bool) {
+	if env {
+		return sf.Tag.Get("env"), false
+	}
+	for _, key := range []string{"json", "yaml"} {
+		tag, ok := sf.Tag.Lookup(key)
+		if !ok {
+			continue
+		}
+		name, opts, _ := strings.Cut(tag, ",")
+		return name, strings.Contains(","+opts+",", ",inline,")
+	}
+	return "", false
+}
+
+// fieldValue returns the field at index, allocating nil embedded pointers.
+func fieldValue(v reflect.Value, index []int) reflect.Value {
+	for i, x := range index {
+		if i > 0 && v.Kind() == reflect.Pointer {
+			if v.IsNil() {
+				v.Set(reflect.New(v.Type().Elem()))
+			}
+			v = v.Elem()
+		}
+		v = v.Field(x)
+	}
+	return v
+}
+
+func join(path, name string) string {
+	if path == "" {
+		return name
+	}
+	return path + "." + name
+}
+
+func at(path string) string {
+	if path == "" {
+		return "config"
+	}
+	return path
+}
+
+// decoder records the values expansion produced while decoding a document.
+type decoder struct {
+	expanded []string
+}
+
+func (d *decoder) decodeNode(n *yaml.Node, v reflect.Value, path string) error {
+	if n.Kind == yaml.AliasNode {
+		n = n.Alias
+	}
+	if n.Kind == yaml.ScalarNode && n.Tag == "!!null" {
+		v.Set(reflect.Zero(v.Type()))
+		return nil
+	}
+	if v.Kind() == reflect.Pointer {
+		if v.IsNil() {
+			v.Set(reflect.New(v.Type().Elem()))
+			if err := applyDefaults(v.Elem(), path); err != nil {
+				return err
+			}
+		}
+		return d.decodeNode(n, v.Elem(), path)
+	}
+	if v.Type() != durationType && reflect.PointerTo(v.Type()).Implements(jsonUnmarshalerType) {
+		value, err := d.nodeValue(n, path)
+		if err != nil {
+			return err
+		}
+		data, err := json.Marshal(value)
+		if err != nil {
+			return fmt.Errorf("%s: %w", at(path), err)
+		}
+		if err := v.Addr().Interface().(json.Unmarshaler).UnmarshalJSON(data); err != nil {
+			return fmt.Errorf("%s: %w", at(path), err)
+		}
+		return nil
+	}
+
+	switch v.Kind() {
+	case reflect.Struct:
+		if n.Kind != yaml.MappingNode {
+			return fmt.Errorf("%s: expected a mapping", at(path))
+		}
+		byName := make(map[string]field)
+		for _, f := range fields(v.Type(), false) {
+			byName[f.name] = f
+		}
+		for i := 0; i+1 < len(n.Content); i += 2 {
+			key := n.Content[i].Value
+			f, ok := byName[key]
+			if !ok {
+				return fmt.Errorf("%s: unknown field", join(path, key))
+			}
+			if err := d.decodeNode(n.Content[i+1], fieldValue(v, f.index), join(path, key)); err != nil {
+				return err
+			}
+		}
+		return nil
+	case reflect.Map:
+		if n.Kind != yaml.MappingNode {
+			return fmt.Errorf("%s: expected a mapping", at(path))
+		}
+		if v.IsNil() {
+			v.Set(reflect.MakeMap(v.Type()))
+		}
+		for i := 0; i+1 < len(n.Content); i += 2 {
+			key := reflect.New(v.Type().Key()).Elem()
+			if err := setScalar(key, n.Content[i].Value); err != nil {
+				return fmt.Errorf("%s: key %q: %w", at(path), n.Content[i].Value, err)
+			}
+			elem := reflect.New(v.Type().Elem()).Elem()
+			if err := applyDefaults(elem, join(path, n.Content[i].Value)); err != nil {
+				return err
+			}
+			if err := d.decodeNode(n.Content[i+1], elem, join(path, n.Content[i].Value)); err != nil {
+				return err
+			}
+			v.SetMapIndex(key, elem)
+		}
+		return nil
+	case reflect.Slice:
+		if n.Kind != yaml.SequenceNode {
+			return fmt.Errorf("%s: expected a list", at(path))
+		}
+		s := reflect.MakeSlice(v.Type(), len(n.Content), len(n.Content))
+		for i, item := range n.Content {
+			elemPath := fmt.Sprintf("%s[%d]", path, i)
+			if err := applyDefaults(s.Index(i), elemPath); err != nil {
+				return err
+			}
+			if err := d.decodeNode(item, s.Index(i), elemPath); err != nil {
+				return err
+			}
+		}
+		v.Set(s)
+		return nil
+	case reflect.Interface:
+		value, err := d.nodeValue(n, path)
+		if err != nil {
+			return err
+		}
+		if value != nil {
+			v.Set(reflect.ValueOf(value))
+		}
+		return nil
+	}
+
+	if n.Kind != yaml.ScalarNode {
+		return fmt.Errorf("%s: expected a single value", at(path))
+	}
+	s, err := d.expandValue(n.Value)
+	if err != nil {
+		return fmt.Errorf("%s: %w", at(path), err)
+	}
+	if err := setScalar(v, s); err != nil {
+		return fmt.Errorf("%s: %w", at(path), err)
+	}
+	return nil
+}
+
+// nodeValue converts n to plain values (maps, slices, scalars), expanding
+// environment references in strings.
+func (d *decoder) nodeValue(n *yaml.Node, path string) (any, error) {
+	if n.Kind == yaml.AliasNode {
+		n = n.Alias
+	}
+	switch n.Kind {
+	case yaml.MappingNode:
+		m := make(map[string]any, len(n.Content)/2)
+		for i := 0; i+1 < len(n.Content); i += 2 {
+			key := n.Content[i].Value
+			value, err := d.nodeValue(n.Content[i+1], join(path, key))
+			if err != nil {
+				return nil, err
+			}
+			m[key] = value
+		}
+		return m, nil
+	case yaml.SequenceNode:
+		s := make([]any, len(n.Content))
+		for i, item := range n.Content {
+			value, err := d.nodeValue(item, fmt.Sprintf("%s[%d]", path, i))
+			if err != nil {
+				return nil, err
+			}
+			s[i] = value
+		}
+		return s, nil
+	}
+	expanded, err := d.expandValue(n.Value)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", at(path), err)
+	}
+	scalar := *n
+	if expanded != n.Value {
+		// Let plain scalars re-resolve, e.g. port: ${PORT} to a number
+		scalar.Value, scalar.Tag = expanded, ""
+		if scalar.Style != 0 {
+			scalar.Tag = "!!str"
+		}
+	}
+	var value any
+	if err := scalar.Decode(&value); err != nil {
+		return nil, fmt.Errorf("%s: %w", at(path), err)
+	}
+	return value, nil
+}
+
+// setScalar parses s into v.
+func setScalar(v reflect.Value, s string) error {
+	if v.Kind() == reflect.Pointer {
+		if v.IsNil() {
+			v.Set(reflect.New(v.Type().Elem()))
+		}
+		v = v.Elem()
+	}
+	if v.Type() == durationType {
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return err
+		}
+		v.SetInt(int64(d))
+		return nil
+	}
+	if u, ok := v.Addr().Interface().(encoding.TextUnmarshaler); ok {
+		return u.UnmarshalText([]byte(s))
+	}
+	if u, ok := v.Addr().Interface().(json.Unmarshaler); ok {
+		data, _ := json.Marshal(s)
+		return u.UnmarshalJSON(data)
+	}
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(s)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return fmt.Errorf("invalid boolean %q", s)
+		}
+		v.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		i, err := strconv.ParseInt(s, 0, v.Type().Bits())
+		if err != nil {
+			return fmt.Errorf("invalid integer %q", s)
+		}
+		v.SetInt(i)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		u, err := strconv.ParseUint(s, 0, v.Type().Bits())
+		if err != nil {
+			return fmt.Errorf("invalid unsigned integer %q", s)
+		}
+		v.SetUint(u)
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(s, v.Type().Bits())
+		if err != nil {
+			return fmt.Errorf("invalid number %q", s)
+		}
+		v.SetFloat(f)
+	case reflect.Slice:
+		parts := strings.Split(s, ",")
+		out := reflect.MakeSlice(v.Type(), 0, len(parts))
+		for _, part := range parts {
+			if part = strings.TrimSpace(part); part == "" {
+				continue
+			}
+			elem := reflect.New(v.Type().Elem()).Elem()
+			if err := setScalar(elem, part); err != nil {
+				return err
+			}
+			out = reflect.Append(out, elem)
+		}
+		v.Set(out)
+	default:
+		return fmt.Errorf("cannot set a %s from %q", v.Type(), s)
+	}
+	return nil
+}
+
+func decodeEnv(lookup func(string) (string, bool), v reflect.Value) error {
+	for i := 0; i < v.NumField(); i++ {
+		sf := v.Type().Field(i)
+		if !sf.IsExported() {
+			continue
+		}
+		name := sf.Tag.Get("env")
+		if name == "" {
+			if sf.Type.Kind() == reflect.Struct && sf.Type != durationType {
+				if err := decodeEnv(lookup, v.Field(i)); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+		if s, ok := lookup(name); ok && s != "" {
+			if err := setScalar(v.Field(i), s); err != nil {
+				return fmt.Errorf("%s: %w", name, err)
+			}
+		}
+	}
+	return nil
+}
+
+// applyDefaults sets zero fields with a default tag, in v and the structs it
+// already contains.
+func applyDefaults(v reflect.Value, path string) error {
+	switch v.Kind() {
+	case reflect.Pointer:
+		if !v.IsNil() {
+			return applyDefaults(v.Elem(), path)
+		}
+	case reflect.Slice:
+		for i := 0; i < v.Len(); i++ {
+			if err := applyDefaults(v.Index(i), fmt.Sprintf("%s[%d]", path, i)); err != nil {
+				return err
+			}
+		}
+	case reflect.Struct:
+		for i := 0; i < v.NumField(); i++ {
+			sf := v.Type().Field(i)
+			if !sf.IsExported() {
+				continue
+			}
+			fv := v.Field(i)
+			name := sf.Name
+			if n, _ := fieldName(sf, false); n != "" && n != "-" {
+				name = n
+			}
+			if def, ok := sf.Tag.Lookup("default"); ok && fv.IsZero() {
+				if err := setScalar(fv, def); err != nil {
+					return fmt.Errorf("%s: default: %w", join(path, name), err)
+				}
+				continue
+			}
+			if err := applyDefaults(fv, join(path, name)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// expandValue expands s if SetExpandEnv enabled it.
+func (d *decoder) expandValue(s string) (string, error) {
+	if !expandEnv.Load() {
+		return s, nil
+	}
+	expanded, err := Expand(s)
+	if err == nil && expanded != s {
+		d.expanded = append(d.expanded, expanded)
+	}
+	return expanded, err
+}
+
+// Expand replaces ${NAME} and ${NAME:-fallback} in s with environment
+// variables. $${ is a literal ${.
+func Expand(s string) (string, error) {
+	if !strings.Contains(s, "${") {
+		return s, nil
+	}
+	var b strings.Builder
+	for {
+		i := strings.Index(s, "${")
+		if i < 0 {
+			b.WriteString(s)
+			return b.String(), nil
+		}
+		if i > 0 && s[i-1] == '$' {
+			b.WriteString(s[:i])
+			b.WriteString("{")
+			s = s[i+2:]
+			continue
+		}
+		end := strings.IndexByte(s[i:], '}')
+		if end < 0 {
+			return "", fmt.Errorf("unterminated ${ in %q", s)
+		}
+		b.WriteString(s[:i])
+		name, fallback, hasFallback := strings.Cut(s[i+2:i+end], ":-")
+		value, ok := os.LookupEnv(name)
+		switch {
+		case value != "":
+		case hasFallback:
+			value = fallback
+		case !ok:
+			return "", fmt.Errorf("environment variable %s is not set", name)
+		}
+		b.WriteString(value)
+		s = s[i+end+1:]
+	}
+}
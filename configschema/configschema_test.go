@@ -0,0 +1,242 @@
+package configschema
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+type upstream struct {
+	URL     string        `yaml:"url" doc:"Target URL"`
+	Timeout time.Duration `yaml:"timeout,omitempty" default:"5s"`
+	Retries int           `yaml:"retries,omitempty" default:"2"`
+}
+
+type testConfig struct {
+	Name      string              `json:"name"`
+	Enabled   bool                `json:"enabled"`
+	Port      int32               `json:"port"`
+	Tags      []string            `json:"tags,omitempty"`
+	Labels    map[string]string   `json:"labels,omitempty"`
+	Upstreams []upstream          `json:"upstreams,omitempty"`
+	Expires   *jsonTime           `json:"expires,omitempty"`
+	Extra     map[string]upstream `json:"extra,omitempty"`
+	Inline    `json:",inline"`
+	internal  string
+}
+
+type Inline struct {
+	Region string `json:"region" default:"eu"`
+}
+
+// jsonTime stands in for types with their own JSON format, e.g. metav1.Time.
+type jsonTime struct{ time.Time }
+
+func (t *jsonTime) UnmarshalJSON(data []byte) error {
+	return json.Unmarshal(data, &t.Time)
+}
+
+func (c *testConfig) Validate() error {
+	if c.Port == 0 {
+		return errors.New("port is required")
+	}
+	return nil
+}
+
+// withExpandEnv enables ${VAR} expansion for the rest of the test.
+func withExpandEnv(t *testing.T) {
+	t.Helper()
+	SetExpandEnv(true)
+	t.Cleanup(func() { SetExpandEnv(false) })
+}
+
+func TestDecode(t *testing.T) {
+	withExpandEnv(t)
+	t.Setenv("UPSTREAM_HOST", "tools")
+	t.Setenv("PORT", "8080")
+
+	c := &testConfig{Name: "default", Labels: map[string]string{"team": "a"}}
+	err := Decode([]byte(`
+enabled: true
+port: ${PORT}
+labels: {env: prod}
+upstreams:
+- url: http://${UPSTREAM_HOST}:${UPSTREAM_PORT:-9000}/$${literal}
+- url: http://b
+  timeout: 1m
+  retries: 0
+expires: "2026-01-02T03:04:05Z"
+`), c)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if c.Name != "default" || !c.Enabled || c.Port != 8080 {
+		t.Errorf("c = %+v", c)
+	}
+	if !reflect.DeepEqual(c.Labels, map[string]string{"team": "a", "env": "prod"}) {
+		t.Errorf("labels = %v, want merged", c.Labels)
+	}
+	want := []upstream{
+		{URL: "http://tools:9000/${literal}", Timeout: 5 * time.Second, Retries: 2},
+		// An explicit zero is kept
+		{URL: "http://b", Timeout: time.Minute, Retries: 0},
+	}
+	if !reflect.DeepEqual(c.Upstreams, want) {
+		t.Errorf("upstreams = %+v, want %+v", c.Upstreams, want)
+	}
+	if c.Expires == nil || c.Expires.Year() != 2026 {
+		t.Errorf("expires = %v", c.Expires)
+	}
+	if c.Region != "eu" {
+		t.Errorf("region = %q, want the default", c.Region)
+	}
+}
+
+func TestDecode_Errors(t *testing.T) {
+	withExpandEnv(t)
+	tests := []struct {
+		name, doc, want string
+	}{
+		{"unknown field", "port: 1\nupstreams:\n- url: a\n  retry: 3", "upstreams[0].retry: unknown field"},
+		{"unexported field", "port: 1\ninternal: x", "internal: unknown field"},
+		{"wrong type", "port: many", `port: invalid integer "many"`},
+		{"scalar for list", "port: 1\ntags: a", "tags: expected a list"},
+		{"bad duration", "port: 1\nupstreams: [{timeout: soon}]", "upstreams[0].timeout"},
+		{"unset variable", "port: 1\nname: ${CONFIGSCHEMA_UNSET}", "name: environment variable CONFIGSCHEMA_UNSET is not set"},
+		{"validation", "name: x", "port is required"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := Decode([]byte(tt.doc), &testConfig{})
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("Decode() error = %v, want %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestDecode_ExpansionOptIn(t *testing.T) {
+	t.Setenv("CONFIGSCHEMA_HOST", "tools")
+	doc := []byte("port: 1\nname: pa$${ss}${CONFIGSCHEMA_HOST}$x\ntags: ['${CONFIGSCHEMA_UNSET}']")
+
+	var c testConfig
+	if err := Decode(doc, &c); err != nil {
+		t.Fatalf("without expansion: %v", err)
+	}
+	if c.Name != "pa$${ss}${CONFIGSCHEMA_HOST}$x" || c.Tags[0] != "${CONFIGSCHEMA_UNSET}" {
+		t.Errorf("without expansion: name = %q, tags = %q, want them literal", c.Name, c.Tags)
+	}
+
+	withExpandEnv(t)
+	if err := Decode(doc, &testConfig{}); err == nil || !strings.Contains(err.Error(), "CONFIGSCHEMA_UNSET is not set") {
+		t.Errorf("with expansion: error = %v, want the unset variable", err)
+	}
+	c = testConfig{}
+	if err := Decode([]byte("port: 1\nname: pa$${ss}${CONFIGSCHEMA_HOST}$x"), &c); err != nil {
+		t.Fatal(err)
+	}
+	// $${ escapes ${; a $ not followed by { is kept
+	if c.Name != "pa${ss}tools$x" {
+		t.Errorf("with expansion: name = %q, want %q", c.Name, "pa${ss}tools$x")
+	}
+}
+
+func TestDecodeExpanded(t *testing.T) {
+	t.Setenv("CONFIGSCHEMA_TOKEN", "s3cret")
+	doc := []byte("port: 1\nname: plain\nlabels: {auth: 'Bearer ${CONFIGSCHEMA_TOKEN}'}\nregion: ${CONFIGSCHEMA_REGION:-us}")
+
+	expanded, err := DecodeExpanded(doc, &testConfig{})
+	if err != nil || len(expanded) != 0 {
+		t.Errorf("without expansion: expanded = %q, %v, want none", expanded, err)
+	}
+
+	withExpandEnv(t)
+	expanded, err = DecodeExpanded(doc, &testConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"Bearer s3cret", "us"}
+	if !reflect.DeepEqual(expanded, want) {
+		t.Errorf("expanded = %q, want %q", expanded, want)
+	}
+}
+
+type envConfig struct {
+	URL     string        `env:"TEST_URL" doc:"Where to send requests"`
+	Timeout time.Duration `env:"TEST_TIMEOUT" default:"10s"`
+	Burst   int           `env:"TEST_BURST"`
+	Scopes  []string      `env:"TEST_SCOPES"`
+	Limits  struct {
+		RPS float64 `env:"TEST_RPS"`
+	}
+}
+
+func TestDecodeEnv(t *testing.T) {
+	env := map[string]string{"TEST_URL": "http://a", "TEST_BURST": "4", "TEST_SCOPES": "openid, tools", "TEST_RPS": "2.5", "TEST_TIMEOUT": ""}
+	lookup := func(name string) (string, bool) {
+		v, ok := env[name]
+		return v, ok
+	}
+	var c envConfig
+	if err := DecodeEnv(lookup, &c); err != nil {
+		t.Fatal(err)
+	}
+	if c.URL != "http://a" || c.Timeout != 10*time.Second || c.Burst != 4 || c.Limits.RPS != 2.5 ||
+		!reflect.DeepEqual(c.Scopes, []string{"openid", "tools"}) {
+		t.Errorf("c = %+v", c)
+	}
+
+	env["TEST_BURST"] = "lots"
+	if err := DecodeEnv(lookup, &c); err == nil || !strings.HasPrefix(err.Error(), "TEST_BURST:") {
+		t.Errorf("DecodeEnv() error = %v, want one naming TEST_BURST", err)
+	}
+}
+
+func TestSchema(t *testing.T) {
+	data, err := Schema(testConfig{}, "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var s struct {
+		Properties map[string]struct {
+			Type  string `json:"type"`
+			Items struct {
+				Properties map[string]map[string]any `json:"properties"`
+			} `json:"items"`
+		} `json:"properties"`
+		AdditionalProperties bool `json:"additionalProperties"`
+	}
+	if err := json.Unmarshal(data, &s); err != nil {
+		t.Fatal(err)
+	}
+	if s.AdditionalProperties {
+		t.Error("unknown fields must be rejected")
+	}
+	if s.Properties["port"].Type != "integer" || s.Properties["region"].Type != "string" {
+		t.Errorf("properties = %+v", s.Properties)
+	}
+	if _, ok := s.Properties["internal"]; ok {
+		t.Error("unexported field in schema")
+	}
+	url := s.Properties["upstreams"].Items.Properties["url"]
+	if url["description"] != "Target URL" {
+		t.Errorf("url = %v", url)
+	}
+	if got := s.Properties["upstreams"].Items.Properties["retries"]["default"]; got != 2.0 {
+		t.Errorf("retries default = %v", got)
+	}
+
+	data, err = EnvSchema(envConfig{}, "env")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{`"TEST_URL"`, `"TEST_RPS"`, `"format": "duration"`, `"default": "10s"`} {
+		if !strings.Contains(string(data), want) {
+			t.Errorf("env schema lacks %s:\n%s", want, data)
+		}
+	}
+}
@@ -0,0 +1,138 @@
+package configschema
+
+import (
+	"encoding/json"
+	"reflect"
+	"strconv"
+)
+
+const schemaDialect = "https://json-schema.org/draft/2020-12/schema"
+
+// Schema returns the JSON Schema of the files Decode accepts for v's type.
+func Schema(v any, title string) ([]byte, error) {
+	s := typeSchema(reflect.TypeOf(v), false, map[reflect.Type]bool{})
+	s["$schema"] = schemaDialect
+	s["title"] = title
+	return json.MarshalIndent(s, "", "  ")
+}
+
+// EnvSchema returns a JSON Schema describing the environment variables
+// DecodeEnv reads into v's type, as the properties of one object.
+func EnvSchema(v any, title string) ([]byte, error) {
+	s := typeSchema(reflect.TypeOf(v), true, map[reflect.Type]bool{})
+	s["$schema"] = schemaDialect
+	s["title"] = title
+	return json.MarshalIndent(s, "", "  ")
+}
+
+func typeSchema(t reflect.Type, env bool, visiting map[reflect.Type]bool) map[string]any {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	switch {
+	case t == durationType:
+		return map[string]any{"type": "string", "pattern": `^(\d+(\.\d+)?(ns|us|µs|ms|s|m|h))+$`}
+	case reflect.PointerTo(t).Implements(jsonUnmarshalerType), reflect.PointerTo(t).Implements(textUnmarshalerType):
+		// Formats of custom types, e.g. quantities, are not described
+		return map[string]any{}
+	}
+
+	switch t.Kind() {
+	case reflect.String:
+		return map[string]any{"type": "string"}
+	case reflect.Bool:
+		return map[string]any{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]any{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]any{"type": "number"}
+	case reflect.Slice, reflect.Array:
+		if env {
+			return map[string]any{"type": "string", "format": "comma-separated"}
+		}
+		return map[string]any{"type": "array", "items": typeSchema(t.Elem(), env, visiting)}
+	case reflect.Map:
+		return map[string]any{"type": "object", "additionalProperties": typeSchema(t.Elem(), env, visiting)}
+	case reflect.Struct:
+		if visiting[t] {
+			return map[string]any{"type": "object"}
+		}
+		visiting[t] = true
+		defer delete(visiting, t)
+
+		properties := map[string]any{}
+		var collect func(t reflect.Type)
+		collect = func(t reflect.Type) {
+			for _, f := range fields(t, env) {
+				p := typeSchema(f.typ, env, visiting)
+				if env {
+					// Every variable is a string; name the value it holds
+					format := schemaType(p)
+					p = map[string]any{"type": "string"}
+					if format != "string" {
+						p["format"] = format
+					}
+				}
+				if f.doc != "" {
+					p["description"] = f.doc
+				}
+				if f.def != "" {
+					p["default"] = defaultValue(f.typ, f.def, env)
+				}
+				properties[f.name] = p
+			}
+			if !env {
+				return
+			}
+			// DecodeEnv also searches nested structs without an env tag
+			for i := 0; i < t.NumField(); i++ {
+				sf := t.Field(i)
+				if sf.IsExported() && sf.Tag.Get("env") == "" && sf.Type.Kind() == reflect.Struct && sf.Type != durationType {
+					collect(sf.Type)
+				}
+			}
+		}
+		collect(t)
+		return map[string]any{"type": "object", "properties": properties, "additionalProperties": false}
+	}
+	return map[string]any{}
+}
+
+// schemaType names the value an environment variable holds.
+func schemaType(s map[string]any) string {
+	if _, ok := s["pattern"]; ok {
+		return "duration"
+	}
+	if f, ok := s["format"].(string); ok {
+		return f
+	}
+	if t, ok := s["type"].(string); ok {
+		return t
+	}
+	return "string"
+}
+
+func defaultValue(t reflect.Type, def string, env bool) any {
+	if env {
+		return def
+	}
+	switch t.Kind() {
+	case reflect.Bool:
+		if b, err := strconv.ParseBool(def); err == nil {
+			return b
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if t == durationType {
+			return def
+		}
+		if i, err := strconv.ParseInt(def, 0, 64); err == nil {
+			return i
+		}
+	case reflect.Float32, reflect.Float64:
+		if f, err := strconv.ParseFloat(def, 64); err == nil {
+			return f
+		}
+	}
+	return def
+}
@@ -21,13 +21,17 @@ import (
 	"flag"
 	"os"
 	"path/filepath"
+	"time"
 
 	// Import all Kubernetes client auth plugins (e.g. Azure, GCP, OIDC, etc.)
 	// to ensure that exec-entrypoint and run can make use of them.
 	_ "k8s.io/client-go/plugin/pkg/client/auth"
 
+	"github.com/kagenti/kagenti-extensions/configschema"
+	"github.com/kagenti/kagenti-extensions/kagenti-webhook/internal/webhook/audit"
 	"github.com/kagenti/kagenti-extensions/kagenti-webhook/internal/webhook/config"
 	"github.com/kagenti/kagenti-extensions/kagenti-webhook/internal/webhook/injector"
+	"github.com/kagenti/kagenti-extensions/kagenti-webhook/internal/webhook/status"
 	webhooktoolhivestacklokdevv1alpha1 "github.com/kagenti/kagenti-extensions/kagenti-webhook/internal/webhook/v1alpha1"
 	agentsv1alpha1 "github.com/kagenti/operator/api/v1alpha1"
 	toolhivestacklokdevv1alpha1 "github.com/stacklok/toolhive/cmd/thv-operator/api/v1alpha1"
@@ -71,6 +75,14 @@ func main() {
 	var enableClientRegistration bool
 	var configPath string
 	var featureGatesPath string
+	var expandConfigEnv bool
+	var publishEffectiveConfig bool
+	var adoptionReportInterval time.Duration
+	var adoptionReportNamespace string
+	var sidecarCostReportInterval time.Duration
+	var migrationScanInterval time.Duration
+	var migrateDeprecatedAnnotations bool
+	var printConfigSchema bool
 
 	flag.StringVar(&metricsAddr, "metrics-bind-address", "0", "The address the metrics endpoint binds to. "+
 		"Use :8443 for HTTPS or :8080 for HTTP, or leave as 0 to disable the metrics service.")
@@ -93,12 +105,39 @@ func main() {
 		"If set, Kagenti webhook will register tool clients in Keycloak")
 	flag.StringVar(&configPath, "config-path", "/etc/kagenti/config.yaml", "Path to platform config file")
 	flag.StringVar(&featureGatesPath, "feature-gates-path", "/etc/kagenti/feature-gates/feature-gates.yaml", "Path to feature gates config file")
+	flag.BoolVar(&expandConfigEnv, "expand-config-env", false,
+		"If set, expand ${NAME} and ${NAME:-fallback} in string values of the platform config file; $${ stands for a literal ${")
+	flag.BoolVar(&publishEffectiveConfig, "publish-effective-config", false,
+		"If set, publish the effective platform config and feature gates as a read-only ConfigMap in every opted-in namespace")
+	flag.DurationVar(&adoptionReportInterval, "adoption-report-interval", 5*time.Minute,
+		"How often to classify namespaces by AuthBridge adoption state for the adoption metrics. Set to 0 to disable.")
+	flag.StringVar(&adoptionReportNamespace, "adoption-report-namespace", "",
+		"If set, also write the adoption report as the kagenti-adoption-report ConfigMap in this namespace")
+	flag.DurationVar(&sidecarCostReportInterval, "sidecar-cost-report-interval", 15*time.Minute,
+		"How often to export the CPU/memory AuthBridge sidecars add per namespace, today and projected. Set to 0 to disable.")
+	flag.DurationVar(&migrationScanInterval, "migration-scan-interval", 10*time.Minute,
+		"How often to report objects still using the deprecated kagenti.dev/inject annotation. Set to 0 to disable.")
+	flag.BoolVar(&migrateDeprecatedAnnotations, "migrate-deprecated-annotations", false,
+		"If set, write the labels equivalent to deprecated kagenti.dev/inject annotations onto Namespaces, Agents and MCPServers")
+	flag.BoolVar(&printConfigSchema, "config-schema", false,
+		"Print the JSON Schema of the platform config file and exit")
 
 	opts := zap.Options{
 		Development: true,
 	}
 	opts.BindFlags(flag.CommandLine)
 	flag.Parse()
+	configschema.SetExpandEnv(expandConfigEnv)
+
+	if printConfigSchema {
+		schema, err := configschema.Schema(config.PlatformConfig{}, "Kagenti platform config")
+		if err != nil {
+			setupLog.Error(err, "Failed to build platform config schema")
+			os.Exit(1)
+		}
+		os.Stdout.Write(append(schema, '\n'))
+		return
+	}
 
 	ctrl.SetLogger(zap.New(zap.UseFlagOptions(&opts)))
 
@@ -282,6 +321,18 @@ func main() {
 		featureGateLoader.Get,
 	)
 
+	// Publish injection decisions to the configured audit sinks
+	injector.ExportImagePins(configLoader.Get().Images.Pins)
+	configLoader.OnChange(func(cfg *config.PlatformConfig) { injector.ExportImagePins(cfg.Images.Pins) })
+
+	auditDispatcher := audit.NewDispatcher(configLoader.Get().Audit)
+	configLoader.OnChange(func(cfg *config.PlatformConfig) { auditDispatcher.Reconfigure(cfg.Audit) })
+	if err := mgr.Add(auditDispatcher); err != nil {
+		setupLog.Error(err, "unable to add audit dispatcher to manager")
+		os.Exit(1)
+	}
+	podMutator.DecisionPublisher = auditDispatcher
+
 	// nolint:goconst
 	if os.Getenv("ENABLE_WEBHOOKS") != "false" {
 		// Setup MCPServer webhook
@@ -302,6 +353,61 @@ func main() {
 			os.Exit(1)
 		}
 	}
+
+	if publishEffectiveConfig {
+		effectiveConfig := &status.EffectiveConfigReconciler{
+			Client:            k8sClient,
+			GetPlatformConfig: configLoader.Get,
+			GetFeatureGates:   featureGateLoader.Get,
+			GetExpandedValues: configLoader.ExpandedValues,
+		}
+		if err := effectiveConfig.SetupWithManager(mgr); err != nil {
+			setupLog.Error(err, "unable to create controller", "controller", "effective-config")
+			os.Exit(1)
+		}
+		configLoader.OnChange(func(*config.PlatformConfig) { go effectiveConfig.Resync(ctx) })
+		featureGateLoader.OnChange(func(*config.FeatureGates) { go effectiveConfig.Resync(ctx) })
+	}
+
+	if adoptionReportInterval > 0 {
+		adoptionReporter := &status.AdoptionReporter{
+			Client:            k8sClient,
+			GetPlatformConfig: configLoader.Get,
+			GetFeatureGates:   featureGateLoader.Get,
+			Namespace:         adoptionReportNamespace,
+			Interval:          adoptionReportInterval,
+		}
+		if err := mgr.Add(adoptionReporter); err != nil {
+			setupLog.Error(err, "unable to add adoption reporter to manager")
+			os.Exit(1)
+		}
+	}
+
+	if sidecarCostReportInterval > 0 {
+		sidecarCostReporter := &status.SidecarCostReporter{
+			Client:            k8sClient,
+			GetPlatformConfig: configLoader.Get,
+			GetFeatureGates:   featureGateLoader.Get,
+			Interval:          sidecarCostReportInterval,
+		}
+		if err := mgr.Add(sidecarCostReporter); err != nil {
+			setupLog.Error(err, "unable to add sidecar cost reporter to manager")
+			os.Exit(1)
+		}
+	}
+
+	if migrationScanInterval > 0 {
+		migrationReporter := &status.MigrationReporter{
+			Client:   k8sClient,
+			Recorder: mgr.GetEventRecorderFor("kagenti-webhook"),
+			Apply:    migrateDeprecatedAnnotations,
+			Interval: migrationScanInterval,
+		}
+		if err := mgr.Add(migrationReporter); err != nil {
+			setupLog.Error(err, "unable to add migration reporter to manager")
+			os.Exit(1)
+		}
+	}
 	// +kubebuilder:scaffold:builder
 
 	if metricsCertWatcher != nil {
@@ -0,0 +1,126 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// sidecar-cost prints the CPU and memory AuthBridge sidecars add per
+// namespace, today and if every agent and tool pod were injected, using the
+// current kubeconfig context.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"text/tabwriter"
+
+	// Import all Kubernetes client auth plugins (e.g. Azure, GCP, OIDC, etc.)
+	_ "k8s.io/client-go/plugin/pkg/client/auth"
+
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/yaml"
+
+	"github.com/kagenti/kagenti-extensions/kagenti-webhook/internal/webhook/config"
+	"github.com/kagenti/kagenti-extensions/kagenti-webhook/internal/webhook/status"
+)
+
+func main() {
+	var configPath, featureGatesPath, output string
+	flag.StringVar(&configPath, "config-path", "", "Platform config file to project with (default: compiled defaults)")
+	flag.StringVar(&featureGatesPath, "feature-gates-path", "", "Feature gates file to project with (default: all enabled)")
+	flag.StringVar(&output, "o", "table", "Output format: table or yaml")
+	flag.Parse()
+
+	// The config loaders log through controller-runtime; keep stdout clean
+	log.SetLogger(logr.Discard())
+
+	pc := config.CompiledDefaults()
+	if configPath != "" {
+		loader := config.NewConfigLoader(configPath)
+		if err := loader.Load(); err != nil {
+			fail("load platform config: %v", err)
+		}
+		pc = loader.Get()
+	}
+	fg := config.DefaultFeatureGates()
+	if featureGatesPath != "" {
+		loader := config.NewFeatureGateLoader(featureGatesPath)
+		if err := loader.Load(); err != nil {
+			fail("load feature gates: %v", err)
+		}
+		fg = loader.Get()
+	}
+
+	c, err := client.New(ctrl.GetConfigOrDie(), client.Options{Scheme: clientgoscheme.Scheme})
+	if err != nil {
+		fail("create client: %v", err)
+	}
+	report, err := status.BuildSidecarCostReport(context.Background(), c, fg, pc)
+	if err != nil {
+		fail("%v", err)
+	}
+
+	switch output {
+	case "yaml":
+		data, err := yaml.Marshal(report)
+		if err != nil {
+			fail("%v", err)
+		}
+		os.Stdout.Write(data)
+	case "table":
+		printTable(os.Stdout, report)
+	default:
+		fail("unknown output format %q", output)
+	}
+}
+
+func printTable(out io.Writer, report *status.SidecarCostReport) {
+	w := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "NAMESPACE\tSCOPE\tPODS\tCPU REQUESTS\tMEMORY REQUESTS\tCPU LIMITS\tMEMORY LIMITS")
+	for _, ns := range report.Namespaces {
+		for _, row := range []struct {
+			scope string
+			res   status.SidecarResources
+		}{
+			{status.CostInjected, ns.Injected},
+			{status.CostProjected, ns.Projected},
+			{status.CostProjectedMaxScale, ns.ProjectedMaxScale},
+		} {
+			fmt.Fprintf(w, "%s\t%s\t%d\t%s\t%s\t%s\t%s\n", ns.Namespace, row.scope, row.res.Pods,
+				quantity(row.res.Requests, corev1.ResourceCPU), quantity(row.res.Requests, corev1.ResourceMemory),
+				quantity(row.res.Limits, corev1.ResourceCPU), quantity(row.res.Limits, corev1.ResourceMemory))
+		}
+	}
+	w.Flush()
+}
+
+func quantity(list corev1.ResourceList, name corev1.ResourceName) string {
+	q, ok := list[name]
+	if !ok {
+		return "-"
+	}
+	return q.String()
+}
+
+func fail(format string, args ...any) {
+	fmt.Fprintf(os.Stderr, "sidecar-cost: "+format+"\n", args...)
+	os.Exit(1)
+}
@@ -0,0 +1,169 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package audit
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/kagenti/kagenti-extensions/kagenti-webhook/internal/webhook/config"
+	"github.com/kagenti/kagenti-extensions/kagenti-webhook/internal/webhook/injector"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+var auditLog = logf.Log.WithName("audit")
+
+const defaultQueueSize = 1024
+
+// Dispatcher fans injection decisions out to the configured sinks. Publish
+// never blocks admission: records are queued and dropped (with a log line)
+// when the queue is full. It implements manager.Runnable.
+type Dispatcher struct {
+	queue chan DecisionRecord
+	// retire wakes Start to close replaced sinks
+	retire chan struct{}
+
+	mu    sync.RWMutex
+	sinks []Sink
+	// retired are replaced sinks a delivery may still be using; Start
+	// closes them between deliveries
+	retired []Sink
+}
+
+// NewDispatcher creates a dispatcher with sinks built from cfg.
+func NewDispatcher(cfg config.AuditConfig) *Dispatcher {
+	d := &Dispatcher{queue: make(chan DecisionRecord, defaultQueueSize), retire: make(chan struct{}, 1)}
+	d.Reconfigure(cfg)
+	return d
+}
+
+// Reconfigure replaces the active sinks. Sinks that fail to build are
+// logged and skipped so one bad entry does not disable auditing entirely.
+// The replaced sinks are closed by Start once no delivery uses them.
+func (d *Dispatcher) Reconfigure(cfg config.AuditConfig) {
+	var sinks []Sink
+	for _, sinkCfg := range cfg.Sinks {
+		sink, err := NewSink(sinkCfg)
+		if err != nil {
+			auditLog.Error(err, "Skipping audit sink")
+			continue
+		}
+		sinks = append(sinks, sink)
+	}
+
+	d.mu.Lock()
+	d.retired = append(d.retired, d.sinks...)
+	d.sinks = sinks
+	d.mu.Unlock()
+
+	select {
+	case d.retire <- struct{}{}:
+	default:
+	}
+	auditLog.Info("Audit sinks configured", "count", len(sinks))
+}
+
+// PublishDecision implements injector.DecisionPublisher.
+func (d *Dispatcher) PublishDecision(namespace, workload string, labels map[string]string, decision injector.InjectionDecision) {
+	d.mu.RLock()
+	enabled := len(d.sinks) > 0
+	d.mu.RUnlock()
+	if !enabled {
+		return
+	}
+
+	record := DecisionRecord{
+		Time:      time.Now().UTC(),
+		Namespace: namespace,
+		Workload:  workload,
+		Labels:    labels,
+		Injected:  decision.AnyInjected(),
+		Sidecars: map[string]SidecarRecord{
+			"envoy-proxy":         sidecarRecord(decision.EnvoyProxy),
+			"proxy-init":          sidecarRecord(decision.ProxyInit),
+			"spiffe-helper":       sidecarRecord(decision.SpiffeHelper),
+			"client-registration": sidecarRecord(decision.ClientRegistration),
+		},
+	}
+
+	select {
+	case d.queue <- record:
+	default:
+		auditLog.Info("Audit queue full, dropping decision", "namespace", namespace, "workload", workload)
+	}
+}
+
+// Start delivers queued records until ctx is cancelled, then closes the sinks.
+// Deliveries and closing sinks both happen here, so a sink is never closed
+// while a record is being sent to it.
+func (d *Dispatcher) Start(ctx context.Context) error {
+	for {
+		select {
+		case <-ctx.Done():
+			d.mu.Lock()
+			d.retired = append(d.retired, d.sinks...)
+			d.sinks = nil
+			d.mu.Unlock()
+			d.closeRetired()
+			return nil
+		case <-d.retire:
+			d.closeRetired()
+		case record := <-d.queue:
+			d.deliver(ctx, record)
+		}
+	}
+}
+
+// closeRetired closes the sinks replaced by Reconfigure.
+func (d *Dispatcher) closeRetired() {
+	d.mu.Lock()
+	retired := d.retired
+	d.retired = nil
+	d.mu.Unlock()
+
+	for _, sink := range retired {
+		if err := sink.Close(); err != nil {
+			auditLog.Error(err, "Failed to close audit sink", "sink", sink.Name())
+		}
+	}
+}
+
+// NeedLeaderElection implements manager.LeaderElectionRunnable: every
+// replica serves admission requests, so every replica must deliver.
+func (d *Dispatcher) NeedLeaderElection() bool {
+	return false
+}
+
+func (d *Dispatcher) deliver(ctx context.Context, record DecisionRecord) {
+	d.mu.RLock()
+	sinks := d.sinks
+	d.mu.RUnlock()
+
+	for _, sink := range sinks {
+		if err := sink.Send(ctx, record); err != nil {
+			auditLog.Error(err, "Failed to publish injection decision",
+				"sink", sink.Name(),
+				"namespace", record.Namespace,
+				"workload", record.Workload)
+		}
+	}
+}
+
+func sidecarRecord(d injector.SidecarDecision) SidecarRecord {
+	return SidecarRecord{Inject: d.Inject, Reason: d.Reason, Layer: d.Layer}
+}
@@ -0,0 +1,152 @@
+package audit
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/kagenti/kagenti-extensions/kagenti-webhook/internal/webhook/config"
+	"github.com/kagenti/kagenti-extensions/kagenti-webhook/internal/webhook/injector"
+)
+
+func testDecision() injector.InjectionDecision {
+	return injector.InjectionDecision{
+		EnvoyProxy:         injector.SidecarDecision{Inject: true, Reason: "platform default enabled envoy-proxy", Layer: "platform-default"},
+		ProxyInit:          injector.SidecarDecision{Inject: true, Reason: "follows envoy-proxy", Layer: "platform-default"},
+		SpiffeHelper:       injector.SidecarDecision{Inject: false, Reason: "feature gate disabled spiffe-helper", Layer: "feature-gate"},
+		ClientRegistration: injector.SidecarDecision{Inject: true, Reason: "platform default enabled client-registration", Layer: "platform-default"},
+	}
+}
+
+func TestDispatcher_DeliversToHTTPSink(t *testing.T) {
+	t.Setenv("AUDIT_TOKEN", "s3cret")
+
+	received := make(chan DecisionRecord, 1)
+	var authHeader string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		authHeader = r.Header.Get("Authorization")
+		var record DecisionRecord
+		if err := json.NewDecoder(r.Body).Decode(&record); err != nil {
+			t.Errorf("decode: %v", err)
+		}
+		received <- record
+	}))
+	defer server.Close()
+
+	d := NewDispatcher(config.AuditConfig{Sinks: []config.AuditSinkConfig{
+		{Name: "siem", Type: "http", URL: server.URL, TokenEnv: "AUDIT_TOKEN"},
+	}})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() { _ = d.Start(ctx) }()
+
+	d.PublishDecision("team1", "weather-agent", map[string]string{"kagenti.io/type": "agent"}, testDecision())
+
+	select {
+	case record := <-received:
+		if record.Namespace != "team1" || record.Workload != "weather-agent" {
+			t.Errorf("unexpected workload %s/%s", record.Namespace, record.Workload)
+		}
+		if !record.Injected {
+			t.Error("expected injected=true")
+		}
+		if got := record.Sidecars["spiffe-helper"]; got.Inject || got.Layer != "feature-gate" {
+			t.Errorf("unexpected spiffe-helper record: %+v", got)
+		}
+		if authHeader != "Bearer s3cret" {
+			t.Errorf("Authorization = %q, want bearer token from TokenEnv", authHeader)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for decision")
+	}
+}
+
+// blockingSink holds each Send until release is closed.
+type blockingSink struct {
+	sending chan struct{}
+	release chan struct{}
+	closed  chan struct{}
+}
+
+func (s *blockingSink) Name() string { return "blocking" }
+
+func (s *blockingSink) Send(context.Context, DecisionRecord) error {
+	s.sending <- struct{}{}
+	<-s.release
+	select {
+	case <-s.closed:
+		return errors.New("send on a closed sink")
+	default:
+		return nil
+	}
+}
+
+func (s *blockingSink) Close() error {
+	close(s.closed)
+	return nil
+}
+
+func TestDispatcher_ReconfigureWaitsForDelivery(t *testing.T) {
+	sink := &blockingSink{sending: make(chan struct{}), release: make(chan struct{}), closed: make(chan struct{})}
+	d := NewDispatcher(config.AuditConfig{})
+	d.sinks = []Sink{sink}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() { _ = d.Start(ctx) }()
+
+	d.PublishDecision("team1", "weather-agent", nil, testDecision())
+	<-sink.sending
+	d.Reconfigure(config.AuditConfig{})
+	select {
+	case <-sink.closed:
+		t.Fatal("sink closed while a record was being sent")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	close(sink.release)
+	select {
+	case <-sink.closed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("replaced sink was not closed after the delivery")
+	}
+}
+
+func TestDispatcher_NoSinksDropsSilently(t *testing.T) {
+	d := NewDispatcher(config.AuditConfig{})
+	d.PublishDecision("team1", "weather-agent", nil, testDecision())
+	if len(d.queue) != 0 {
+		t.Errorf("expected nothing queued without sinks, got %d", len(d.queue))
+	}
+}
+
+func TestNewSink_Invalid(t *testing.T) {
+	for _, cfg := range []config.AuditSinkConfig{
+		{Type: "http"},
+		{Type: "http", URL: "http://audit", TokenEnv: "AUDIT_TOKEN_UNSET"},
+		{Type: "kafka", Topic: "decisions"},
+		{Type: "syslog"},
+	} {
+		if _, err := NewSink(cfg); err == nil {
+			t.Errorf("NewSink(%+v): expected error", cfg)
+		}
+	}
+}
+
+func TestHTTPSink_ErrorStatus(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	sink, err := NewSink(config.AuditSinkConfig{Type: "http", URL: server.URL})
+	if err != nil {
+		t.Fatalf("NewSink: %v", err)
+	}
+	if err := sink.Send(context.Background(), DecisionRecord{}); err == nil {
+		t.Error("expected error for 503 response")
+	}
+}
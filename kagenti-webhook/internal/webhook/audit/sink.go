@@ -0,0 +1,172 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package audit publishes sidecar injection decisions to external sinks
+// (HTTP endpoints, Kafka topics) for enterprise audit pipelines.
+package audit
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/kagenti/kagenti-extensions/kagenti-webhook/internal/webhook/config"
+	"github.com/segmentio/kafka-go"
+)
+
+const defaultSinkTimeout = 5 * time.Second
+
+// SidecarRecord is the decision for a single sidecar.
+type SidecarRecord struct {
+	Inject bool   `json:"inject"`
+	Reason string `json:"reason"`
+	Layer  string `json:"layer"`
+}
+
+// DecisionRecord is the payload delivered to every sink.
+type DecisionRecord struct {
+	Time      time.Time                `json:"time"`
+	Namespace string                   `json:"namespace"`
+	Workload  string                   `json:"workload"`
+	Labels    map[string]string        `json:"labels,omitempty"`
+	Injected  bool                     `json:"injected"`
+	Sidecars  map[string]SidecarRecord `json:"sidecars"`
+}
+
+// Sink delivers decision records to one external system.
+type Sink interface {
+	Name() string
+	Send(ctx context.Context, record DecisionRecord) error
+	Close() error
+}
+
+// NewSink builds a sink from its config.
+func NewSink(cfg config.AuditSinkConfig) (Sink, error) {
+	timeout := cfg.Timeout.Duration
+	if timeout <= 0 {
+		timeout = defaultSinkTimeout
+	}
+	name := cfg.Name
+	if name == "" {
+		name = cfg.Type
+	}
+
+	switch cfg.Type {
+	case "http":
+		if cfg.URL == "" {
+			return nil, fmt.Errorf("audit sink %q: url is required", name)
+		}
+		sink := &HTTPSink{
+			name:   name,
+			url:    cfg.URL,
+			client: &http.Client{Timeout: timeout},
+		}
+		if cfg.TokenEnv != "" {
+			sink.token = os.Getenv(cfg.TokenEnv)
+			if sink.token == "" {
+				return nil, fmt.Errorf("audit sink %q: environment variable %s is empty", name, cfg.TokenEnv)
+			}
+		}
+		return sink, nil
+	case "kafka":
+		if len(cfg.Brokers) == 0 || cfg.Topic == "" {
+			return nil, fmt.Errorf("audit sink %q: brokers and topic are required", name)
+		}
+		return &KafkaSink{
+			name: name,
+			writer: &kafka.Writer{
+				Addr:         kafka.TCP(cfg.Brokers...),
+				Topic:        cfg.Topic,
+				Balancer:     &kafka.Hash{},
+				WriteTimeout: timeout,
+				RequiredAcks: kafka.RequireOne,
+			},
+		}, nil
+	default:
+		return nil, fmt.Errorf("audit sink %q: unknown type %q", name, cfg.Type)
+	}
+}
+
+// HTTPSink POSTs each record as JSON.
+type HTTPSink struct {
+	name   string
+	url    string
+	token  string
+	client *http.Client
+}
+
+func (s *HTTPSink) Name() string { return s.name }
+
+func (s *HTTPSink) Send(ctx context.Context, record DecisionRecord) error {
+	body, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("marshal decision: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if s.token != "" {
+		req.Header.Set("Authorization", "Bearer "+s.token)
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, resp.Body)
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("sink returned status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+func (s *HTTPSink) Close() error {
+	s.client.CloseIdleConnections()
+	return nil
+}
+
+// KafkaSink writes each record to a topic, keyed by namespace/workload so
+// decisions for one workload stay ordered within a partition.
+type KafkaSink struct {
+	name   string
+	writer *kafka.Writer
+}
+
+func (s *KafkaSink) Name() string { return s.name }
+
+func (s *KafkaSink) Send(ctx context.Context, record DecisionRecord) error {
+	value, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("marshal decision: %w", err)
+	}
+	return s.writer.WriteMessages(ctx, kafka.Message{
+		Key:   []byte(record.Namespace + "/" + record.Workload),
+		Value: value,
+		Time:  record.Time,
+	})
+}
+
+func (s *KafkaSink) Close() error {
+	return s.writer.Close()
+}
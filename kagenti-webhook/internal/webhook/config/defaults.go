@@ -20,6 +20,7 @@ func CompiledDefaults() *PlatformConfig {
 			UID:              1337,
 			InboundProxyPort: 15124,
 			AdminPort:        9901,
+			InitUID:          1338,
 		},
 		Resources: ResourcesConfig{
 			EnvoyProxy: corev1.ResourceRequirements{
@@ -75,10 +76,19 @@ func CompiledDefaults() *PlatformConfig {
 			EnableMetrics: true,
 			EnableTracing: false,
 		},
+		Logging: LoggingConfig{
+			EnvoyProxy:         SidecarLogging{TerminationMessagePolicy: corev1.TerminationMessageFallbackToLogsOnError},
+			ProxyInit:          SidecarLogging{TerminationMessagePolicy: corev1.TerminationMessageFallbackToLogsOnError},
+			SpiffeHelper:       SidecarLogging{TerminationMessagePolicy: corev1.TerminationMessageFallbackToLogsOnError},
+			ClientRegistration: SidecarLogging{TerminationMessagePolicy: corev1.TerminationMessageFallbackToLogsOnError},
+		},
 		Sidecars: SidecarDefaults{
 			EnvoyProxy:         SidecarDefault{Enabled: true},
 			SpiffeHelper:       SidecarDefault{Enabled: true},
 			ClientRegistration: SidecarDefault{Enabled: true},
 		},
+		TrustBundle: TrustBundleConfig{
+			Key: "ca.crt",
+		},
 	}
 }
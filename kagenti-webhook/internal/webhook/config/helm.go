@@ -0,0 +1,157 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// HelmValuesKey is the key holding the platform config in a Helm values
+// file, so the values file operators already maintain can be mounted as the
+// webhook's config.yaml unchanged:
+//
+//	replicaCount: 1          # other chart values are ignored
+//	platformConfig:
+//	  images:
+//	    envoyProxy:
+//	      repository: ghcr.io/kagenti/kagenti-extensions/envoy-with-processor
+//	      tag: v0.4.2
+//	  tokenExchange:
+//	    tokenUrl: http://keycloak.keycloak:8080/realms/kagenti/protocol/openid-connect/token
+//
+// Umbrella charts nest it under the subchart's name (kagenti-webhook). Below
+// the key the layout is the PlatformConfig one, except that images may also
+// be given the Helm way, as registry, repository, tag and digest.
+const HelmValuesKey = "platformConfig"
+
+// helmSubcharts are the keys umbrella charts nest this chart's values under.
+var helmSubcharts = []string{"kagenti-webhook", "kagentiWebhook"}
+
+// imageKeys are the image fields of ImageConfig and ImagePin.
+var imageKeys = []string{"envoyProxy", "proxyInit", "spiffeHelper", "clientRegistration"}
+
+// FromHelmValues converts the platform config of a Helm values file to a
+// PlatformConfig document. It reports false if data is not a values file,
+// i.e. has no HelmValuesKey at the top level or under a subchart key.
+func FromHelmValues(data []byte) ([]byte, bool, error) {
+	var root yaml.Node
+	if err := yaml.Unmarshal(data, &root); err != nil {
+		return nil, false, err
+	}
+	if root.Kind != yaml.DocumentNode || len(root.Content) == 0 {
+		return nil, false, nil
+	}
+	values := root.Content[0]
+	platform, path := mappingValue(values, HelmValuesKey), HelmValuesKey
+	for _, subchart := range helmSubcharts {
+		if platform != nil {
+			break
+		}
+		if chart := mappingValue(values, subchart); chart != nil {
+			platform, path = mappingValue(chart, HelmValuesKey), subchart+"."+HelmValuesKey
+		}
+	}
+	if platform == nil {
+		return nil, false, nil
+	}
+
+	switch platform.Kind {
+	case yaml.MappingNode:
+	case yaml.ScalarNode:
+		if platform.Tag != "!!null" {
+			return nil, true, fmt.Errorf("%s: expected a mapping", path)
+		}
+		return []byte("{}\n"), true, nil
+	default:
+		return nil, true, fmt.Errorf("%s: expected a mapping", path)
+	}
+	if images := mappingValue(platform, "images"); images != nil {
+		if err := convertImages(images, path+".images"); err != nil {
+			return nil, true, err
+		}
+		if pins := mappingValue(images, "pins"); pins != nil && pins.Kind == yaml.SequenceNode {
+			for i, pin := range pins.Content {
+				if err := convertImages(pin, fmt.Sprintf("%s.images.pins[%d]", path, i)); err != nil {
+					return nil, true, err
+				}
+			}
+		}
+	}
+	out, err := yaml.Marshal(platform)
+	if err != nil {
+		return nil, true, err
+	}
+	return out, true, nil
+}
+
+// convertImages replaces the Helm-style images of a mapping with image
+// references.
+func convertImages(m *yaml.Node, path string) error {
+	for _, key := range imageKeys {
+		image := mappingValue(m, key)
+		if image == nil || image.Kind != yaml.MappingNode {
+			continue
+		}
+		ref, err := helmImage(image)
+		if err != nil {
+			return fmt.Errorf("%s.%s: %w", path, key, err)
+		}
+		*image = yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: ref}
+	}
+	return nil
+}
+
+// helmImage returns the reference of an image given as registry, repository,
+// tag and digest, e.g. ghcr.io/kagenti/proxy-init:v0.4.2.
+func helmImage(m *yaml.Node) (string, error) {
+	var registry, repository, tag, digest string
+	for i := 0; i+1 < len(m.Content); i += 2 {
+		key, value := m.Content[i].Value, m.Content[i+1]
+		if value.Kind != yaml.ScalarNode {
+			return "", fmt.Errorf("%s: expected a string", key)
+		}
+		switch key {
+		case "registry":
+			registry = value.Value
+		case "repository":
+			repository = value.Value
+		case "tag":
+			tag = value.Value
+		case "digest":
+			digest = value.Value
+		case "pullPolicy":
+			return "", errors.New("pullPolicy applies to all images, set images.pullPolicy")
+		default:
+			return "", fmt.Errorf("%s: unknown field", key)
+		}
+	}
+	if repository == "" {
+		return "", errors.New("repository is required")
+	}
+	ref := repository
+	if registry != "" {
+		ref = strings.TrimSuffix(registry, "/") + "/" + ref
+	}
+	if tag != "" {
+		ref += ":" + tag
+	}
+	if digest != "" {
+		ref += "@" + digest
+	}
+	return ref, nil
+}
+
+// mappingValue returns the value of key in the mapping m, or nil.
+func mappingValue(m *yaml.Node, key string) *yaml.Node {
+	if m.Kind != yaml.MappingNode {
+		return nil
+	}
+	for i := 0; i+1 < len(m.Content); i += 2 {
+		if m.Content[i].Value == key {
+			return m.Content[i+1]
+		}
+	}
+	return nil
+}
@@ -0,0 +1,136 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func loadConfig(t *testing.T, data string) (*PlatformConfig, error) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+		t.Fatalf("failed to write config: %v", err)
+	}
+	l := NewConfigLoader(path)
+	if err := l.Load(); err != nil {
+		return nil, err
+	}
+	return l.Get(), nil
+}
+
+func TestLoad_HelmValues(t *testing.T) {
+	cfg, err := loadConfig(t, `
+replicaCount: 1
+image:
+  repository: ghcr.io/kagenti/kagenti-extensions/kagenti-webhook
+  tag: "__PLACEHOLDER__"
+webhook:
+  enabled: true
+platformConfig:
+  images:
+    envoyProxy:
+      repository: ghcr.io/kagenti/kagenti-extensions/envoy-with-processor
+      tag: v0.4.2
+    proxyInit:
+      registry: registry.internal:5000/
+      repository: kagenti/proxy-init
+      digest: sha256:0123abcd
+    spiffeHelper: ghcr.io/spiffe/spiffe-helper:0.10.0
+    pullPolicy: Always
+    pins:
+    - name: prod
+      namespaceSelector: env=prod
+      clientRegistration:
+        repository: ghcr.io/kagenti/kagenti-extensions/client-registration
+        tag: v0.4.1
+  proxy:
+    port: 15124
+  tokenExchange:
+    defaultScopes: [openid, agent]
+`)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defaults := CompiledDefaults()
+	for _, tc := range []struct{ name, got, want string }{
+		{"envoyProxy", cfg.Images.EnvoyProxy, "ghcr.io/kagenti/kagenti-extensions/envoy-with-processor:v0.4.2"},
+		{"proxyInit", cfg.Images.ProxyInit, "registry.internal:5000/kagenti/proxy-init@sha256:0123abcd"},
+		{"spiffeHelper", cfg.Images.SpiffeHelper, "ghcr.io/spiffe/spiffe-helper:0.10.0"},
+		{"clientRegistration", cfg.Images.ClientRegistration, defaults.Images.ClientRegistration},
+		{"pullPolicy", string(cfg.Images.PullPolicy), "Always"},
+	} {
+		if tc.got != tc.want {
+			t.Errorf("images.%s = %q, want %q", tc.name, tc.got, tc.want)
+		}
+	}
+	if len(cfg.Images.Pins) != 1 || cfg.Images.Pins[0].ClientRegistration != "ghcr.io/kagenti/kagenti-extensions/client-registration:v0.4.1" {
+		t.Errorf("unexpected pins %+v", cfg.Images.Pins)
+	}
+	if cfg.Proxy.Port != 15124 || cfg.Proxy.UID != defaults.Proxy.UID {
+		t.Errorf("expected port override on default proxy config, got %+v", cfg.Proxy)
+	}
+	if strings.Join(cfg.TokenExchange.DefaultScopes, " ") != "openid agent" {
+		t.Errorf("unexpected default scopes %v", cfg.TokenExchange.DefaultScopes)
+	}
+}
+
+func TestLoad_HelmValuesOfUmbrellaChart(t *testing.T) {
+	cfg, err := loadConfig(t, `
+kagenti-webhook:
+  platformConfig:
+    proxy:
+      port: 15200
+keycloak:
+  enabled: true
+`)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.Proxy.Port != 15200 {
+		t.Errorf("proxy.port = %d, want 15200", cfg.Proxy.Port)
+	}
+}
+
+func TestLoad_HelmValuesErrors(t *testing.T) {
+	for name, tc := range map[string]struct{ data, want string }{
+		"image without repository": {`
+platformConfig:
+  images:
+    envoyProxy:
+      tag: v1
+`, "platformConfig.images.envoyProxy: repository is required"},
+		"per-image pull policy": {`
+platformConfig:
+  images:
+    proxyInit:
+      repository: ghcr.io/kagenti/proxy-init
+      pullPolicy: Always
+`, "images.pullPolicy"},
+		"unknown platform field": {`
+platformConfig:
+  proxi:
+    port: 15124
+`, "proxi"},
+		"not a mapping": {`
+platformConfig: enabled
+`, "platformConfig: expected a mapping"},
+	} {
+		if _, err := loadConfig(t, tc.data); err == nil || !strings.Contains(err.Error(), tc.want) {
+			t.Errorf("%s: expected error containing %q, got %v", name, tc.want, err)
+		}
+	}
+}
+
+func TestFromHelmValues_PlatformConfig(t *testing.T) {
+	// Plain platform configs are not Helm values and load as before
+	data := []byte("proxy:\n  port: 15124\n")
+	if _, ok, err := FromHelmValues(data); ok || err != nil {
+		t.Errorf("FromHelmValues = %v, %v; want not a values file", ok, err)
+	}
+	cfg, err := loadConfig(t, string(data))
+	if err != nil || cfg.Proxy.Port != 15124 {
+		t.Errorf("unexpected result %+v, %v", cfg, err)
+	}
+}
@@ -2,6 +2,7 @@ package config
 
 import (
 	"context"
+	"fmt"
 	"os"
 	"path/filepath"
 	"sync"
@@ -9,7 +10,8 @@ import (
 
 	"github.com/fsnotify/fsnotify"
 	logf "sigs.k8s.io/controller-runtime/pkg/log"
-	"sigs.k8s.io/yaml"
+
+	"github.com/kagenti/kagenti-extensions/configschema"
 )
 
 var log = logf.Log.WithName("config")
@@ -20,6 +22,7 @@ type ConfigLoader struct {
 
 	mu            sync.RWMutex
 	currentConfig *PlatformConfig
+	expanded      []string
 
 	onChange []func(*PlatformConfig)
 }
@@ -45,6 +48,7 @@ func (l *ConfigLoader) Load() error {
 			log.Info("Config file not found, using compiled defaults only")
 			l.mu.Lock()
 			l.currentConfig = config
+			l.expanded = nil
 			callbacks := make([]func(*PlatformConfig), len(l.onChange))
 			copy(callbacks, l.onChange)
 			l.mu.Unlock()
@@ -57,24 +61,32 @@ func (l *ConfigLoader) Load() error {
 		return err
 	}
 
-	// Parse YAML - this overlays onto the defaults
-	// Fields not specified in file keep their compiled default values
-	if err := yaml.Unmarshal(data, config); err != nil {
-		return err
+	// A Helm values file carries the platform config under platformConfig
+	source := "configmap"
+	converted, ok, err := FromHelmValues(data)
+	if err != nil {
+		return fmt.Errorf("helm values: %w", err)
+	}
+	if ok {
+		data, source = converted, "configmap (helm values)"
 	}
 
-	// Validate the merged config
-	if err := config.Validate(); err != nil {
+	// Parse YAML strictly - this overlays onto the defaults and validates
+	// the result. Fields not specified in file keep their compiled default
+	// values; unknown fields are errors.
+	expanded, err := configschema.DecodeExpanded(data, config)
+	if err != nil {
 		return err
 	}
 
 	// Update current config (thread-safe)
 	l.mu.Lock()
 	l.currentConfig = config
+	l.expanded = expanded
 	l.mu.Unlock()
 
 	log.Info("Platform config loaded successfully from file")
-	logConfig(config, "configmap")
+	logConfig(config, source)
 
 	// Snapshot callbacks under lock, then invoke outside lock
 	// so callbacks can safely call Get() without deadlock.
@@ -99,6 +111,14 @@ func (l *ConfigLoader) Get() *PlatformConfig {
 	return l.currentConfig.DeepCopy()
 }
 
+// ExpandedValues returns the values ${VAR} expansion put into the current
+// config, which may be secrets and must not be published.
+func (l *ConfigLoader) ExpandedValues() []string {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	return append([]string(nil), l.expanded...)
+}
+
 // Watch starts watching the config file for changes
 func (l *ConfigLoader) Watch(ctx context.Context) error {
 	// Watch the directory, not the file directly
@@ -194,11 +214,27 @@ func logConfig(cfg *PlatformConfig, source string) {
 		"clientRegistration", cfg.Images.ClientRegistration,
 		"pullPolicy", cfg.Images.PullPolicy,
 	)
+	for _, pin := range cfg.Images.Pins {
+		log.Info("[config] image pin",
+			"name", pin.Name,
+			"namespaceSelector", pin.NamespaceSelector,
+			"envoyProxy", pin.EnvoyProxy,
+			"proxyInit", pin.ProxyInit,
+			"spiffeHelper", pin.SpiffeHelper,
+			"clientRegistration", pin.ClientRegistration,
+			"expires", pin.Expires,
+			"stale", pin.Stale(time.Now()),
+		)
+	}
 	log.Info("[config] proxy",
 		"port", cfg.Proxy.Port,
 		"uid", cfg.Proxy.UID,
 		"inboundProxyPort", cfg.Proxy.InboundProxyPort,
 		"adminPort", cfg.Proxy.AdminPort,
+		"probeMode", cfg.Proxy.ProbeMode,
+		"initSecurity", cfg.Proxy.InitSecurity,
+		"initUID", cfg.Proxy.InitUID,
+		"iptablesBackend", cfg.Proxy.IptablesBackend,
 	)
 	log.Info("[config] resources.envoyProxy",
 		"requests", cfg.Resources.EnvoyProxy.Requests,
@@ -230,5 +266,39 @@ func logConfig(cfg *PlatformConfig, source string) {
 		"spiffeHelper.enabled", cfg.Sidecars.SpiffeHelper.Enabled,
 		"clientRegistration.enabled", cfg.Sidecars.ClientRegistration.Enabled,
 	)
+	log.Info("[config] namespaces",
+		"selector", cfg.Namespaces.Selector,
+	)
+	log.Info("[config] clientRegistration",
+		"credentialStore", cfg.ClientRegistration.CredentialStore,
+	)
+	log.Info("[config] podLimits",
+		"maxContainers", cfg.PodLimits.MaxContainers,
+		"maxRequests", cfg.PodLimits.MaxRequests,
+		"action", cfg.PodLimits.Action,
+	)
+	log.Info("[config] scheduling",
+		"envoyProxy.architectures", cfg.Scheduling.EnvoyProxy.Architectures,
+		"proxyInit.architectures", cfg.Scheduling.ProxyInit.Architectures,
+		"spiffeHelper.architectures", cfg.Scheduling.SpiffeHelper.Architectures,
+		"clientRegistration.architectures", cfg.Scheduling.ClientRegistration.Architectures,
+	)
+	log.Info("[config] trustBundle",
+		"configMap", cfg.TrustBundle.ConfigMap,
+		"key", cfg.TrustBundle.Key,
+	)
+	log.Info("[config] overrides",
+		"clientRegistration.allowedImages", cfg.Overrides.ClientRegistration.AllowedImages,
+		"clientRegistration.maxResources", cfg.Overrides.ClientRegistration.MaxResources,
+	)
+	for _, sink := range cfg.Audit.Sinks {
+		log.Info("[config] audit sink",
+			"name", sink.Name,
+			"type", sink.Type,
+			"url", sink.URL,
+			"brokers", sink.Brokers,
+			"topic", sink.Topic,
+		)
+	}
 	log.Info("=============================================")
 }
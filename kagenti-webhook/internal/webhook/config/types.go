@@ -2,8 +2,15 @@ package config
 
 import (
 	"fmt"
+	"net/url"
+	"path"
+	"strings"
+	"time"
 
 	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/validation"
 )
 
 // PlatformConfig represents the complete platform configuration
@@ -14,7 +21,233 @@ type PlatformConfig struct {
 	TokenExchange TokenExchangeDefaults `json:"tokenExchange" yaml:"tokenExchange"`
 	Spiffe        SpiffeConfig          `json:"spiffe" yaml:"spiffe"`
 	Observability ObservabilityConfig   `json:"observability" yaml:"observability"`
+	Logging       LoggingConfig         `json:"logging" yaml:"logging"`
 	Sidecars      SidecarDefaults       `json:"sidecars" yaml:"sidecars"`
+	Audit         AuditConfig           `json:"audit" yaml:"audit"`
+	Namespaces    NamespaceConfig       `json:"namespaces" yaml:"namespaces"`
+	// ClientRegistration configures where registered client credentials live.
+	ClientRegistration ClientRegistrationConfig `json:"clientRegistration" yaml:"clientRegistration"`
+	// Overrides bounds the per-resource sidecar overrides workloads may declare.
+	Overrides OverridePolicy `json:"overrides" yaml:"overrides"`
+	// TrustBundle names extra CAs mounted into the sidecars that call the IdP
+	// and targets.
+	TrustBundle TrustBundleConfig `json:"trustBundle" yaml:"trustBundle"`
+	// PodNamespaces decides how pods with hostNetwork or
+	// shareProcessNamespace are injected.
+	PodNamespaces PodNamespacesPolicy `json:"podNamespaces" yaml:"podNamespaces"`
+	// PodLimits bounds the size of pods after injection.
+	PodLimits PodLimitsPolicy `json:"podLimits" yaml:"podLimits"`
+	// Scheduling holds the node requirements of the sidecar images.
+	Scheduling SchedulingConfig `json:"scheduling" yaml:"scheduling"`
+}
+
+// SchedulingConfig lists what nodes each sidecar's image needs, e.g. an
+// envoy build only published for amd64. The requirements of the sidecars
+// injected are added to the pod, so it is not scheduled where an image
+// cannot run (ImagePullBackOff on arm64 nodes); pods whose own constraints
+// contradict them are rejected.
+type SchedulingConfig struct {
+	EnvoyProxy         SidecarScheduling `json:"envoyProxy" yaml:"envoyProxy"`
+	ProxyInit          SidecarScheduling `json:"proxyInit" yaml:"proxyInit"`
+	SpiffeHelper       SidecarScheduling `json:"spiffeHelper" yaml:"spiffeHelper"`
+	ClientRegistration SidecarScheduling `json:"clientRegistration" yaml:"clientRegistration"`
+}
+
+// SidecarScheduling is the node requirements of one sidecar image.
+type SidecarScheduling struct {
+	// Architectures the image is built for (kubernetes.io/arch values, e.g.
+	// amd64); empty runs anywhere.
+	Architectures []string `json:"architectures,omitempty" yaml:"architectures,omitempty"`
+	// NodeSelector is node labels the image needs.
+	NodeSelector map[string]string `json:"nodeSelector,omitempty" yaml:"nodeSelector,omitempty"`
+	// Tolerations let pods onto the nodes the image needs, e.g. a tainted
+	// amd64 pool.
+	Tolerations []corev1.Toleration `json:"tolerations,omitempty" yaml:"tolerations,omitempty"`
+}
+
+func (s SidecarScheduling) deepCopy() SidecarScheduling {
+	out := SidecarScheduling{Architectures: append([]string(nil), s.Architectures...)}
+	if s.NodeSelector != nil {
+		out.NodeSelector = make(map[string]string, len(s.NodeSelector))
+		for k, v := range s.NodeSelector {
+			out.NodeSelector[k] = v
+		}
+	}
+	for _, t := range s.Tolerations {
+		out.Tolerations = append(out.Tolerations, *t.DeepCopy())
+	}
+	return out
+}
+
+func (s SidecarScheduling) validate(field string) error {
+	for _, arch := range s.Architectures {
+		if errs := validation.IsValidLabelValue(arch); arch == "" || len(errs) > 0 {
+			return fmt.Errorf("%s.architectures: invalid architecture %q", field, arch)
+		}
+	}
+	for k, v := range s.NodeSelector {
+		if errs := validation.IsQualifiedName(k); len(errs) > 0 {
+			return fmt.Errorf("%s.nodeSelector: invalid key %q: %s", field, k, strings.Join(errs, ", "))
+		}
+		if errs := validation.IsValidLabelValue(v); len(errs) > 0 {
+			return fmt.Errorf("%s.nodeSelector: invalid value %q: %s", field, v, strings.Join(errs, ", "))
+		}
+	}
+	for i, t := range s.Tolerations {
+		switch t.Operator {
+		case "", corev1.TolerationOpEqual:
+		case corev1.TolerationOpExists:
+			if t.Value != "" {
+				return fmt.Errorf("%s.tolerations[%d]: value must be empty with operator Exists", field, i)
+			}
+		default:
+			return fmt.Errorf("%s.tolerations[%d]: operator must be Equal or Exists", field, i)
+		}
+	}
+	return nil
+}
+
+// PodLimitsPolicy bounds injected pods, so the sidecars do not push a pod
+// past what small nodes or namespace quotas allow and it is not evicted or
+// left pending by surprise. Zero values are unlimited.
+type PodLimitsPolicy struct {
+	// MaxContainers caps the pod's containers, init containers included.
+	MaxContainers int `json:"maxContainers,omitempty" yaml:"maxContainers,omitempty"`
+	// MaxRequests caps the pod's effective resource requests, as the
+	// scheduler computes them (e.g. cpu: "2", memory: 4Gi). Resources not
+	// listed are unlimited.
+	MaxRequests corev1.ResourceList `json:"maxRequests,omitempty" yaml:"maxRequests,omitempty"`
+	// Action is "reject" (default when empty): admission is denied, or
+	// "warn": the pod is injected with an admission warning.
+	Action string `json:"action,omitempty" yaml:"action,omitempty"`
+}
+
+// PodNamespacesPolicy handles pods whose namespaces break the sidecars'
+// isolation. In a hostNetwork pod, proxy-init's iptables rules would capture
+// the node's traffic; with shareProcessNamespace, app containers can read the
+// sidecars' files, including client credentials, through /proc.
+type PodNamespacesPolicy struct {
+	// HostNetwork is "reject" (default when empty): admission is denied, or
+	// "no-interception": the sidecars are injected without proxy-init, so
+	// the app must send its traffic through envoy-proxy itself. envoy-proxy
+	// then binds the node's ports: they are declared as host ports, and a pod
+	// whose containers already use one of them is denied.
+	HostNetwork string `json:"hostNetwork,omitempty" yaml:"hostNetwork,omitempty"`
+	// ShareProcessNamespace is "warn" (default when empty): the pod is
+	// injected with an admission warning, or "reject".
+	ShareProcessNamespace string `json:"shareProcessNamespace,omitempty" yaml:"shareProcessNamespace,omitempty"`
+}
+
+// TrustBundleConfig names a ConfigMap holding a PEM CA bundle (the SPIRE
+// bundle, a corporate CA, ...) that is mounted into envoy-proxy and
+// client-registration, so they verify IdP and target TLS without the CAs
+// being baked into their images. The ConfigMap must exist in every injected
+// workload's namespace (e.g. distributed by trust-manager).
+type TrustBundleConfig struct {
+	// ConfigMap is the ConfigMap name; empty (default) mounts nothing.
+	ConfigMap string `json:"configMap,omitempty" yaml:"configMap,omitempty"`
+	// Key is the ConfigMap key holding the bundle (default "ca.crt").
+	Key string `json:"key,omitempty" yaml:"key,omitempty"`
+}
+
+// OverridePolicy lists which sidecars may be overridden per workload, and
+// within which bounds. Nothing may be overridden by default.
+type OverridePolicy struct {
+	ClientRegistration ContainerOverridePolicy `json:"clientRegistration" yaml:"clientRegistration"`
+}
+
+// ContainerOverridePolicy bounds the overrides of one sidecar container.
+type ContainerOverridePolicy struct {
+	// AllowedImages are path.Match patterns (e.g. "ghcr.io/kagenti/*") an
+	// image override must match. Empty forbids image overrides.
+	AllowedImages []string `json:"allowedImages,omitempty" yaml:"allowedImages,omitempty"`
+	// MaxResources caps each overridable resource, for requests and limits
+	// alike. Resources not listed cannot be overridden.
+	MaxResources corev1.ResourceList `json:"maxResources,omitempty" yaml:"maxResources,omitempty"`
+}
+
+// ClientRegistrationConfig configures the client-registration sidecar.
+type ClientRegistrationConfig struct {
+	// CredentialStore is "emptyDir" (default when empty): the credentials are
+	// files in the pod's shared-data volume, lost on restart. With "secret"
+	// they are stored in a Secret owned by the MCPServer and mounted into its
+	// containers; MCPServers only.
+	CredentialStore string `json:"credentialStore,omitempty" yaml:"credentialStore,omitempty"`
+	// WaitForRegistration runs spiffe-helper and client-registration as
+	// native sidecars, so the MCP server container only starts once its
+	// OAuth client is registered. Needs Kubernetes 1.29+; MCPServers only.
+	WaitForRegistration bool `json:"waitForRegistration,omitempty" yaml:"waitForRegistration,omitempty"`
+	// Realms register the clients of some namespaces in their own Keycloak
+	// realm instead of the one of the environments ConfigMap; MCPServers
+	// only. An MCPServer may pick one by name with the
+	// kagenti.io/keycloak-realm annotation; otherwise the first realm whose
+	// selector matches its namespace applies.
+	Realms []KeycloakRealm `json:"realms,omitempty" yaml:"realms,omitempty"`
+}
+
+// KeycloakRealm is a Keycloak realm of one tenant.
+type KeycloakRealm struct {
+	// Name identifies the realm in the kagenti.io/keycloak-realm annotation.
+	Name string `json:"name" yaml:"name"`
+	// NamespaceSelector selects the tenant's namespaces, in kubectl -l
+	// syntax. Empty applies the realm only to MCPServers naming it.
+	NamespaceSelector string `json:"namespaceSelector,omitempty" yaml:"namespaceSelector,omitempty"`
+	// URL is Keycloak's base URL, e.g. http://keycloak.tenant-a:8080.
+	URL string `json:"url" yaml:"url"`
+	// Realm is the realm clients are registered in.
+	Realm string `json:"realm" yaml:"realm"`
+	// Issuer of the realm's tokens, if Keycloak is reached under another URL
+	// by clients (default <url>/realms/<realm>).
+	Issuer string `json:"issuer,omitempty" yaml:"issuer,omitempty"`
+}
+
+// RealmFor returns the realm named name or, if name is empty, the first
+// realm whose selector matches nsLabels. It returns nil if none applies and
+// an error if name is not configured.
+func (c ClientRegistrationConfig) RealmFor(name string, nsLabels map[string]string) (*KeycloakRealm, error) {
+	for i := range c.Realms {
+		r := &c.Realms[i]
+		if name != "" {
+			if r.Name == name {
+				return r, nil
+			}
+			continue
+		}
+		if r.NamespaceSelector == "" {
+			continue
+		}
+		selector, err := labels.Parse(r.NamespaceSelector)
+		if err == nil && selector.Matches(labels.Set(nsLabels)) {
+			return r, nil
+		}
+	}
+	if name != "" {
+		return nil, fmt.Errorf("keycloak realm %q is not configured", name)
+	}
+	return nil, nil
+}
+
+// TokenURL returns the realm's token endpoint.
+func (r *KeycloakRealm) TokenURL() string {
+	return strings.TrimSuffix(r.URL, "/") + "/realms/" + r.Realm + "/protocol/openid-connect/token"
+}
+
+// IssuerURL returns the issuer of the realm's tokens.
+func (r *KeycloakRealm) IssuerURL() string {
+	if r.Issuer != "" {
+		return r.Issuer
+	}
+	return strings.TrimSuffix(r.URL, "/") + "/realms/" + r.Realm
+}
+
+// NamespaceConfig controls which namespaces count as opted in to injection,
+// in addition to those labelled kagenti-enabled: "true" or "enabled".
+type NamespaceConfig struct {
+	// Selector is an optional label selector expression in kubectl -l syntax
+	// (e.g. "team in (payments,search),env!=dev"). Matching namespaces are
+	// opted in without the kagenti-enabled label; kagenti-enabled: "false"
+	// or "disabled" still opts a namespace out.
+	Selector string `json:"selector,omitempty" yaml:"selector,omitempty"`
 }
 
 type ImageConfig struct {
@@ -23,6 +256,67 @@ type ImageConfig struct {
 	SpiffeHelper       string            `json:"spiffeHelper" yaml:"spiffeHelper"`
 	ClientRegistration string            `json:"clientRegistration" yaml:"clientRegistration"`
 	PullPolicy         corev1.PullPolicy `json:"pullPolicy" yaml:"pullPolicy"`
+	// Pins override the images above in the namespaces of one environment.
+	// The first pin whose selector matches a namespace applies.
+	Pins []ImagePin `json:"pins,omitempty" yaml:"pins,omitempty"`
+}
+
+// ImagePin pins sidecar images in the namespaces of one environment, e.g. to
+// hold production on a tested release while other environments follow the
+// defaults. A pin past its expiry still applies, but every injection with it
+// is reported (metric, Event, admission warning) until it is bumped or removed.
+type ImagePin struct {
+	// Name identifies the pin in metrics and Events, e.g. "prod".
+	Name string `json:"name" yaml:"name"`
+	// NamespaceSelector selects the environment's namespaces, in kubectl -l
+	// syntax (e.g. "env=prod").
+	NamespaceSelector string `json:"namespaceSelector" yaml:"namespaceSelector"`
+	// Images that are empty keep the default image.
+	EnvoyProxy         string `json:"envoyProxy,omitempty" yaml:"envoyProxy,omitempty"`
+	ProxyInit          string `json:"proxyInit,omitempty" yaml:"proxyInit,omitempty"`
+	SpiffeHelper       string `json:"spiffeHelper,omitempty" yaml:"spiffeHelper,omitempty"`
+	ClientRegistration string `json:"clientRegistration,omitempty" yaml:"clientRegistration,omitempty"`
+	// Expires is when the pin is due for review (RFC 3339); nil never
+	// expires.
+	Expires *metav1.Time `json:"expires,omitempty" yaml:"expires,omitempty"`
+}
+
+// PinFor returns the pin applying to a namespace with nsLabels, or nil.
+// Selectors are checked by Validate, so one that fails to parse never matches.
+func (c ImageConfig) PinFor(nsLabels map[string]string) *ImagePin {
+	for i := range c.Pins {
+		selector, err := labels.Parse(c.Pins[i].NamespaceSelector)
+		if err == nil && selector.Matches(labels.Set(nsLabels)) {
+			return &c.Pins[i]
+		}
+	}
+	return nil
+}
+
+// Pinned returns c with the images the pin sets replaced.
+func (c ImageConfig) Pinned(pin *ImagePin) ImageConfig {
+	if pin == nil {
+		return c
+	}
+	for _, image := range []struct {
+		dst *string
+		src string
+	}{
+		{&c.EnvoyProxy, pin.EnvoyProxy},
+		{&c.ProxyInit, pin.ProxyInit},
+		{&c.SpiffeHelper, pin.SpiffeHelper},
+		{&c.ClientRegistration, pin.ClientRegistration},
+	} {
+		if image.src != "" {
+			*image.dst = image.src
+		}
+	}
+	return c
+}
+
+// Stale reports whether the pin has expired at now.
+func (p *ImagePin) Stale(now time.Time) bool {
+	return p.Expires != nil && !now.Before(p.Expires.Time)
 }
 
 type ProxyConfig struct {
@@ -30,8 +324,62 @@ type ProxyConfig struct {
 	UID              int64 `json:"uid" yaml:"uid"`
 	InboundProxyPort int32 `json:"inboundProxyPort" yaml:"inboundProxyPort"`
 	AdminPort        int32 `json:"adminPort" yaml:"adminPort"`
+	// ProbeMode keeps kubelet probes of app containers working behind inbound
+	// interception: "" (off), "allow-paths" or "exclude-ports".
+	ProbeMode string `json:"probeMode,omitempty" yaml:"probeMode,omitempty"`
+	// InitSecurity selects proxy-init's security context: "privileged"
+	// (default when empty) or "minimal" (only NET_ADMIN/NET_RAW, InitUID,
+	// read-only root filesystem).
+	InitSecurity string `json:"initSecurity,omitempty" yaml:"initSecurity,omitempty"`
+	// InitUID is the non-root UID proxy-init runs as in minimal mode. Keep in
+	// sync with AuthBridge/AuthProxy/Dockerfile.init.
+	InitUID int64 `json:"initUID,omitempty" yaml:"initUID,omitempty"`
+	// IptablesBackend forces proxy-init's iptables backend: "" (auto-detect),
+	// "legacy" or "nft".
+	IptablesBackend string `json:"iptablesBackend,omitempty" yaml:"iptablesBackend,omitempty"`
 }
 
+// Probe handling modes for ProxyConfig.ProbeMode.
+const (
+	// ProbeModeAllowPaths lets probes go through the proxy; the inbound
+	// ext_proc skips token validation for the exact probe port and path.
+	ProbeModeAllowPaths = "allow-paths"
+	// ProbeModeExcludePorts excludes probe ports from inbound redirection in
+	// iptables. All traffic on those ports then bypasses the proxy.
+	ProbeModeExcludePorts = "exclude-ports"
+)
+
+// proxy-init security modes for ProxyConfig.InitSecurity.
+const (
+	ProxyInitPrivileged = "privileged"
+	ProxyInitMinimal    = "minimal"
+)
+
+// Credential stores for ClientRegistrationConfig.CredentialStore.
+const (
+	CredentialStoreEmptyDir = "emptyDir"
+	CredentialStoreSecret   = "secret"
+)
+
+// Actions for PodNamespacesPolicy.
+const (
+	PodNamespacesReject         = "reject"
+	PodNamespacesNoInterception = "no-interception"
+	PodNamespacesWarn           = "warn"
+)
+
+// Actions for PodLimitsPolicy.
+const (
+	PodLimitsReject = "reject"
+	PodLimitsWarn   = "warn"
+)
+
+// iptables backends for ProxyConfig.IptablesBackend.
+const (
+	IptablesLegacy = "legacy"
+	IptablesNft    = "nft"
+)
+
 type ResourcesConfig struct {
 	EnvoyProxy         corev1.ResourceRequirements `json:"envoyProxy" yaml:"envoyProxy"`
 	ProxyInit          corev1.ResourceRequirements `json:"proxyInit" yaml:"proxyInit"`
@@ -57,6 +405,59 @@ type ObservabilityConfig struct {
 	TracingBackend string `json:"tracingBackend" yaml:"tracingBackend"`
 }
 
+// LoggingConfig sets how each sidecar logs and reports its termination.
+type LoggingConfig struct {
+	EnvoyProxy         SidecarLogging `json:"envoyProxy" yaml:"envoyProxy"`
+	ProxyInit          SidecarLogging `json:"proxyInit" yaml:"proxyInit"`
+	SpiffeHelper       SidecarLogging `json:"spiffeHelper" yaml:"spiffeHelper"`
+	ClientRegistration SidecarLogging `json:"clientRegistration" yaml:"clientRegistration"`
+}
+
+// SidecarLogging configures the logs of one sidecar container.
+type SidecarLogging struct {
+	// Level overrides observability.logLevel for this sidecar. Level and
+	// Format are only read by envoy-proxy.
+	Level string `json:"level,omitempty" yaml:"level,omitempty"`
+	// Format is the stdout log format, "json" or "text"; empty keeps the
+	// image's default.
+	Format string `json:"format,omitempty" yaml:"format,omitempty"`
+	// TerminationMessagePolicy is "File" or "FallbackToLogsOnError". With
+	// the latter, a container that fails without writing
+	// /dev/termination-log reports the tail of its logs in kubectl describe.
+	TerminationMessagePolicy corev1.TerminationMessagePolicy `json:"terminationMessagePolicy,omitempty" yaml:"terminationMessagePolicy,omitempty"`
+}
+
+// Log formats for SidecarLogging.Format.
+const (
+	LogFormatJSON = "json"
+	LogFormatText = "text"
+)
+
+// AuditConfig lists external sinks that receive every injection decision.
+type AuditConfig struct {
+	Sinks []AuditSinkConfig `json:"sinks,omitempty" yaml:"sinks,omitempty"`
+}
+
+// AuditSinkConfig configures one decision sink. Type selects which of the
+// remaining fields apply.
+type AuditSinkConfig struct {
+	Name string `json:"name" yaml:"name"`
+	// Type is "http" or "kafka"
+	Type string `json:"type" yaml:"type"`
+	// Timeout bounds a single publish (default 5s)
+	Timeout metav1.Duration `json:"timeout,omitempty" yaml:"timeout,omitempty"`
+
+	// HTTP sink: decisions are POSTed as JSON to URL. TokenEnv names an
+	// environment variable of the webhook pod holding a bearer token, so the
+	// credential never appears in the ConfigMap.
+	URL      string `json:"url,omitempty" yaml:"url,omitempty"`
+	TokenEnv string `json:"tokenEnv,omitempty" yaml:"tokenEnv,omitempty"`
+
+	// Kafka sink: decisions are written to Topic, keyed by namespace/workload.
+	Brokers []string `json:"brokers,omitempty" yaml:"brokers,omitempty"`
+	Topic   string   `json:"topic,omitempty" yaml:"topic,omitempty"`
+}
+
 // SidecarDefaults controls per-sidecar enable/disable at the platform level.
 // This is the lowest-priority layer in the injection precedence chain.
 type SidecarDefaults struct {
@@ -81,6 +482,47 @@ func (c *PlatformConfig) DeepCopy() *PlatformConfig {
 		copy(result.TokenExchange.DefaultScopes, c.TokenExchange.DefaultScopes)
 	}
 
+	if c.Audit.Sinks != nil {
+		result.Audit.Sinks = make([]AuditSinkConfig, len(c.Audit.Sinks))
+		for i, sink := range c.Audit.Sinks {
+			result.Audit.Sinks[i] = sink
+			if sink.Brokers != nil {
+				result.Audit.Sinks[i].Brokers = append([]string(nil), sink.Brokers...)
+			}
+		}
+	}
+
+	if c.Images.Pins != nil {
+		result.Images.Pins = make([]ImagePin, len(c.Images.Pins))
+		for i, pin := range c.Images.Pins {
+			result.Images.Pins[i] = pin
+			if pin.Expires != nil {
+				result.Images.Pins[i].Expires = pin.Expires.DeepCopy()
+			}
+		}
+	}
+
+	if c.ClientRegistration.Realms != nil {
+		result.ClientRegistration.Realms = append([]KeycloakRealm(nil), c.ClientRegistration.Realms...)
+	}
+
+	if c.Overrides.ClientRegistration.AllowedImages != nil {
+		result.Overrides.ClientRegistration.AllowedImages = append([]string(nil), c.Overrides.ClientRegistration.AllowedImages...)
+	}
+	if c.Overrides.ClientRegistration.MaxResources != nil {
+		result.Overrides.ClientRegistration.MaxResources = c.Overrides.ClientRegistration.MaxResources.DeepCopy()
+	}
+
+	if c.PodLimits.MaxRequests != nil {
+		result.PodLimits.MaxRequests = c.PodLimits.MaxRequests.DeepCopy()
+	}
+	result.Scheduling = SchedulingConfig{
+		EnvoyProxy:         c.Scheduling.EnvoyProxy.deepCopy(),
+		ProxyInit:          c.Scheduling.ProxyInit.deepCopy(),
+		SpiffeHelper:       c.Scheduling.SpiffeHelper.deepCopy(),
+		ClientRegistration: c.Scheduling.ClientRegistration.deepCopy(),
+	}
+
 	// Deep copy ResourceRequirements — ResourceList is a map that would be shared
 	result.Resources.EnvoyProxy = deepCopyResourceRequirements(c.Resources.EnvoyProxy)
 	result.Resources.ProxyInit = deepCopyResourceRequirements(c.Resources.ProxyInit)
@@ -118,6 +560,25 @@ func (c *PlatformConfig) Validate() error {
 	if c.Proxy.AdminPort < 1024 || c.Proxy.AdminPort > 65535 {
 		return fmt.Errorf("proxy.adminPort must be between 1024 and 65535")
 	}
+	switch c.Proxy.ProbeMode {
+	case "", ProbeModeAllowPaths, ProbeModeExcludePorts:
+	default:
+		return fmt.Errorf("proxy.probeMode must be empty, %s or %s", ProbeModeAllowPaths, ProbeModeExcludePorts)
+	}
+	switch c.Proxy.InitSecurity {
+	case "", ProxyInitPrivileged:
+	case ProxyInitMinimal:
+		if c.Proxy.InitUID <= 0 {
+			return fmt.Errorf("proxy.initUID must be a non-root UID when proxy.initSecurity is %s", ProxyInitMinimal)
+		}
+	default:
+		return fmt.Errorf("proxy.initSecurity must be empty, %s or %s", ProxyInitPrivileged, ProxyInitMinimal)
+	}
+	switch c.Proxy.IptablesBackend {
+	case "", IptablesLegacy, IptablesNft:
+	default:
+		return fmt.Errorf("proxy.iptablesBackend must be empty, %s or %s", IptablesLegacy, IptablesNft)
+	}
 	if c.Images.EnvoyProxy == "" {
 		return fmt.Errorf("images.envoyProxy is required")
 	}
@@ -130,5 +591,190 @@ func (c *PlatformConfig) Validate() error {
 	if c.Images.ClientRegistration == "" {
 		return fmt.Errorf("images.clientRegistration is required")
 	}
+	pinNames := make(map[string]bool, len(c.Images.Pins))
+	for i, pin := range c.Images.Pins {
+		if pin.Name == "" || pinNames[pin.Name] {
+			return fmt.Errorf("images.pins[%d].name must be set and unique", i)
+		}
+		pinNames[pin.Name] = true
+		if pin.NamespaceSelector == "" {
+			return fmt.Errorf("images.pins[%d].namespaceSelector is required", i)
+		}
+		if _, err := labels.Parse(pin.NamespaceSelector); err != nil {
+			return fmt.Errorf("images.pins[%d].namespaceSelector: %w", i, err)
+		}
+		if pin.EnvoyProxy == "" && pin.ProxyInit == "" && pin.SpiffeHelper == "" && pin.ClientRegistration == "" {
+			return fmt.Errorf("images.pins[%d] pins no image", i)
+		}
+	}
+	switch c.ClientRegistration.CredentialStore {
+	case "", CredentialStoreEmptyDir, CredentialStoreSecret:
+	default:
+		return fmt.Errorf("clientRegistration.credentialStore must be empty, %s or %s", CredentialStoreEmptyDir, CredentialStoreSecret)
+	}
+	realmNames := make(map[string]bool, len(c.ClientRegistration.Realms))
+	for i, realm := range c.ClientRegistration.Realms {
+		if realm.Name == "" || realmNames[realm.Name] {
+			return fmt.Errorf("clientRegistration.realms[%d].name must be set and unique", i)
+		}
+		realmNames[realm.Name] = true
+		if _, err := labels.Parse(realm.NamespaceSelector); err != nil {
+			return fmt.Errorf("clientRegistration.realms[%d].namespaceSelector: %w", i, err)
+		}
+		if u, err := url.Parse(realm.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("clientRegistration.realms[%d].url must be an http or https URL", i)
+		}
+		if realm.Realm == "" || strings.ContainsAny(realm.Realm, "/?#") {
+			return fmt.Errorf("clientRegistration.realms[%d].realm must be set and not contain /, ? or #", i)
+		}
+	}
+	switch c.PodNamespaces.HostNetwork {
+	case "", PodNamespacesReject, PodNamespacesNoInterception:
+	default:
+		return fmt.Errorf("podNamespaces.hostNetwork must be empty, %s or %s", PodNamespacesReject, PodNamespacesNoInterception)
+	}
+	switch c.PodNamespaces.ShareProcessNamespace {
+	case "", PodNamespacesWarn, PodNamespacesReject:
+	default:
+		return fmt.Errorf("podNamespaces.shareProcessNamespace must be empty, %s or %s", PodNamespacesWarn, PodNamespacesReject)
+	}
+	switch c.PodLimits.Action {
+	case "", PodLimitsReject, PodLimitsWarn:
+	default:
+		return fmt.Errorf("podLimits.action must be empty, %s or %s", PodLimitsReject, PodLimitsWarn)
+	}
+	if c.PodLimits.MaxContainers < 0 {
+		return fmt.Errorf("podLimits.maxContainers must not be negative")
+	}
+	if c.TrustBundle.ConfigMap != "" {
+		if errs := validation.IsDNS1123Subdomain(c.TrustBundle.ConfigMap); len(errs) > 0 {
+			return fmt.Errorf("trustBundle.configMap: %s", strings.Join(errs, ", "))
+		}
+		if errs := validation.IsConfigMapKey(c.TrustBundle.Key); len(errs) > 0 {
+			return fmt.Errorf("trustBundle.key: %s", strings.Join(errs, ", "))
+		}
+	}
+	if c.Namespaces.Selector != "" {
+		if _, err := labels.Parse(c.Namespaces.Selector); err != nil {
+			return fmt.Errorf("namespaces.selector: %w", err)
+		}
+	}
+	for _, pattern := range c.Overrides.ClientRegistration.AllowedImages {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("overrides.clientRegistration.allowedImages: invalid pattern %q: %w", pattern, err)
+		}
+	}
+	if err := c.validateIdentityNaming(); err != nil {
+		return err
+	}
+	if c.Observability.LogLevel != "" && !validLogLevels[c.Observability.LogLevel] {
+		return fmt.Errorf("observability.logLevel must be one of trace, debug, info, warn, error, critical, off")
+	}
+	for _, sidecar := range []struct {
+		name    string
+		logging SidecarLogging
+	}{
+		{"envoyProxy", c.Logging.EnvoyProxy},
+		{"proxyInit", c.Logging.ProxyInit},
+		{"spiffeHelper", c.Logging.SpiffeHelper},
+		{"clientRegistration", c.Logging.ClientRegistration},
+	} {
+		if err := sidecar.logging.validate("logging." + sidecar.name); err != nil {
+			return err
+		}
+	}
+	for _, sidecar := range []struct {
+		name       string
+		scheduling SidecarScheduling
+	}{
+		{"envoyProxy", c.Scheduling.EnvoyProxy},
+		{"proxyInit", c.Scheduling.ProxyInit},
+		{"spiffeHelper", c.Scheduling.SpiffeHelper},
+		{"clientRegistration", c.Scheduling.ClientRegistration},
+	} {
+		if err := sidecar.scheduling.validate("scheduling." + sidecar.name); err != nil {
+			return err
+		}
+	}
+	for i, sink := range c.Audit.Sinks {
+		switch sink.Type {
+		case "http":
+			if sink.URL == "" {
+				return fmt.Errorf("audit.sinks[%d].url is required for http sinks", i)
+			}
+		case "kafka":
+			if len(sink.Brokers) == 0 || sink.Topic == "" {
+				return fmt.Errorf("audit.sinks[%d].brokers and topic are required for kafka sinks", i)
+			}
+		default:
+			return fmt.Errorf("audit.sinks[%d].type must be http or kafka", i)
+		}
+	}
+	return nil
+}
+
+func (l SidecarLogging) validate(field string) error {
+	if l.Level != "" && !validLogLevels[l.Level] {
+		return fmt.Errorf("%s.level must be one of trace, debug, info, warn, error, critical, off", field)
+	}
+	switch l.Format {
+	case "", LogFormatJSON, LogFormatText:
+	default:
+		return fmt.Errorf("%s.format must be empty, %s or %s", field, LogFormatJSON, LogFormatText)
+	}
+	switch l.TerminationMessagePolicy {
+	case "", corev1.TerminationMessageReadFile, corev1.TerminationMessageFallbackToLogsOnError:
+	default:
+		return fmt.Errorf("%s.terminationMessagePolicy must be empty, %s or %s", field,
+			corev1.TerminationMessageReadFile, corev1.TerminationMessageFallbackToLogsOnError)
+	}
 	return nil
 }
+
+// validateIdentityNaming checks that the SPIFFE IDs named in the config
+// belong to spiffe.trustDomain. Client IDs registered with SPIRE are the
+// workloads' SPIFFE IDs, so an audience in another trust domain would never
+// match a client registered in this cluster.
+func (c *PlatformConfig) validateIdentityNaming() error {
+	td := c.Spiffe.TrustDomain
+	if td == "" {
+		return fmt.Errorf("spiffe.trustDomain is required")
+	}
+	if !validTrustDomain(td) {
+		return fmt.Errorf("spiffe.trustDomain %q is not a valid trust domain: use lowercase letters, digits, '.', '-' and '_' without a scheme", td)
+	}
+	if aud := c.TokenExchange.DefaultAudience; strings.HasPrefix(aud, "spiffe://") {
+		u, err := url.Parse(aud)
+		if err != nil {
+			return fmt.Errorf("tokenExchange.defaultAudience: %w", err)
+		}
+		if u.Host != td {
+			return fmt.Errorf("tokenExchange.defaultAudience %q is in trust domain %q, but spiffe.trustDomain is %q", aud, u.Host, td)
+		}
+	}
+	return nil
+}
+
+// validTrustDomain reports whether td is a SPIFFE trust domain name.
+func validTrustDomain(td string) bool {
+	for _, r := range td {
+		switch {
+		case r >= 'a' && r <= 'z', r >= '0' && r <= '9', r == '.', r == '-', r == '_':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// validLogLevels are the levels accepted by every injected sidecar
+// (they map directly onto Envoy's --log-level).
+var validLogLevels = map[string]bool{
+	"trace":    true,
+	"debug":    true,
+	"info":     true,
+	"warn":     true,
+	"error":    true,
+	"critical": true,
+	"off":      true,
+}
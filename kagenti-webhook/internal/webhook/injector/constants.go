@@ -9,6 +9,7 @@ const (
 	LabelSpiffeHelperInject       = "kagenti.io/spiffe-helper-inject"
 	LabelClientRegistrationInject = "kagenti.io/client-registration-inject"
 
-	// Namespace label for injection opt-in (used by precedence evaluator)
+	// Namespace label for injection opt-in (used by precedence evaluator).
+	// See NamespaceOptedIn for the accepted values.
 	LabelNamespaceInject = "kagenti-enabled"
 )
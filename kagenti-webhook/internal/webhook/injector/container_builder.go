@@ -57,6 +57,8 @@ func (b *ContainerBuilder) BuildSpiffeHelperContainer() corev1.Container {
 		Image:           b.cfg.Images.SpiffeHelper,
 		ImagePullPolicy: b.cfg.Images.PullPolicy,
 		Resources:       b.cfg.Resources.SpiffeHelper,
+		// spiffe-helper takes no logging settings from the environment
+		TerminationMessagePolicy: b.cfg.Logging.SpiffeHelper.TerminationMessagePolicy,
 		Command: []string{
 			"/spiffe-helper",
 			"-config=/etc/spiffe-helper/helper.conf",
@@ -242,8 +244,9 @@ tail -f /dev/null
 			"-c",
 			command,
 		},
-		Env:          env,
-		VolumeMounts: volumeMounts,
+		Env:                      env,
+		VolumeMounts:             volumeMounts,
+		TerminationMessagePolicy: b.cfg.Logging.ClientRegistration.TerminationMessagePolicy,
 		SecurityContext: &corev1.SecurityContext{
 			RunAsUser:    ptr.To(int64(ClientRegistrationUID)),
 			RunAsGroup:   ptr.To(int64(ClientRegistrationGID)),
@@ -252,6 +255,32 @@ tail -f /dev/null
 	}
 }
 
+// envoyProxyPorts returns the ports envoy-proxy listens on.
+func (b *ContainerBuilder) envoyProxyPorts() []corev1.ContainerPort {
+	return []corev1.ContainerPort{
+		{
+			Name:          "envoy-outbound",
+			ContainerPort: b.cfg.Proxy.Port,
+			Protocol:      corev1.ProtocolTCP,
+		},
+		{
+			Name:          "envoy-inbound",
+			ContainerPort: b.cfg.Proxy.InboundProxyPort,
+			Protocol:      corev1.ProtocolTCP,
+		},
+		{
+			Name:          "envoy-admin",
+			ContainerPort: b.cfg.Proxy.AdminPort,
+			Protocol:      corev1.ProtocolTCP,
+		},
+		{
+			Name:          "ext-proc",
+			ContainerPort: 9090,
+			Protocol:      corev1.ProtocolTCP,
+		},
+	}
+}
+
 // BuildEnvoyProxyContainer creates the envoy-proxy sidecar container
 // This container intercepts inbound traffic (JWT validation) and outbound traffic (token exchange) via ext-proc
 func (b *ContainerBuilder) BuildEnvoyProxyContainer() corev1.Container {
@@ -262,29 +291,8 @@ func (b *ContainerBuilder) BuildEnvoyProxyContainer() corev1.Container {
 		Image:           b.cfg.Images.EnvoyProxy,
 		ImagePullPolicy: b.cfg.Images.PullPolicy,
 		Resources:       b.cfg.Resources.EnvoyProxy,
-		Ports: []corev1.ContainerPort{
-			{
-				Name:          "envoy-outbound",
-				ContainerPort: b.cfg.Proxy.Port,
-				Protocol:      corev1.ProtocolTCP,
-			},
-			{
-				Name:          "envoy-inbound",
-				ContainerPort: b.cfg.Proxy.InboundProxyPort,
-				Protocol:      corev1.ProtocolTCP,
-			},
-			{
-				Name:          "envoy-admin",
-				ContainerPort: b.cfg.Proxy.AdminPort,
-				Protocol:      corev1.ProtocolTCP,
-			},
-			{
-				Name:          "ext-proc",
-				ContainerPort: 9090,
-				Protocol:      corev1.ProtocolTCP,
-			},
-		},
-		Env: []corev1.EnvVar{
+		Ports:           b.envoyProxyPorts(),
+		Env: append([]corev1.EnvVar{
 			{
 				Name: "TOKEN_URL",
 				ValueFrom: &corev1.EnvVarSource{
@@ -353,7 +361,8 @@ func (b *ContainerBuilder) BuildEnvoyProxyContainer() corev1.Container {
 				Name:  "CLIENT_SECRET_FILE",
 				Value: "/shared/client-secret.txt",
 			},
-		},
+		}, b.loggingEnv(b.cfg.Logging.EnvoyProxy)...),
+		TerminationMessagePolicy: b.cfg.Logging.EnvoyProxy.TerminationMessagePolicy,
 		SecurityContext: &corev1.SecurityContext{
 			RunAsUser:  ptr.To(b.cfg.Proxy.UID),
 			RunAsGroup: ptr.To(b.cfg.Proxy.UID),
@@ -373,10 +382,36 @@ func (b *ContainerBuilder) BuildEnvoyProxyContainer() corev1.Container {
 	}
 }
 
+// loggingEnv translates observability.logLevel and a sidecar's logging
+// settings into the LOG_LEVEL and LOG_FORMAT read by the envoy-proxy
+// sidecar's entrypoint and ext proc. The sidecar's level takes precedence
+// over observability.logLevel; both variables are omitted when unset.
+func (b *ContainerBuilder) loggingEnv(logging config.SidecarLogging) []corev1.EnvVar {
+	var env []corev1.EnvVar
+	level := b.cfg.Observability.LogLevel
+	if logging.Level != "" {
+		level = logging.Level
+	}
+	if level != "" {
+		env = append(env, corev1.EnvVar{
+			Name:  "LOG_LEVEL",
+			Value: level,
+		})
+	}
+	if logging.Format != "" {
+		env = append(env, corev1.EnvVar{
+			Name:  "LOG_FORMAT",
+			Value: logging.Format,
+		})
+	}
+	return env
+}
+
 // BuildProxyInitContainer creates the init container that sets up iptables
 // to redirect outbound traffic to the Envoy proxy.
 //
-// SECURITY NOTE: This init container requires elevated privileges:
+// SECURITY NOTE: By default (proxy.initSecurity "privileged") this init
+// container requires elevated privileges:
 //   - RunAsUser: 0 (root) - Required to modify network namespace iptables rules
 //   - RunAsNonRoot: false - Explicitly allows root execution
 //   - Privileged: true - Required for iptables manipulation and sysctl commands
@@ -393,17 +428,23 @@ func (b *ContainerBuilder) BuildEnvoyProxyContainer() corev1.Container {
 //   - The container image should be regularly updated and scanned for vulnerabilities
 //   - Consider using a distroless or minimal base image for the proxy-init container
 //
+// With proxy.initSecurity "minimal" the container instead runs as the
+// non-root proxy.initUID with only NET_ADMIN and NET_RAW and a read-only root
+// filesystem; see minimalProxyInitSecurityContext.
+//
 // Alternative approaches (not currently implemented):
 //   - CNI plugin: Configure iptables at pod network setup time (requires cluster-level changes)
 //   - Istio CNI: Similar approach used by Istio to avoid privileged init containers
 func (b *ContainerBuilder) BuildProxyInitContainer() corev1.Container {
 	builderLog.Info("building ProxyInit Container")
 
-	return corev1.Container{
+	c := corev1.Container{
 		Name:            ProxyInitContainerName,
 		Image:           b.cfg.Images.ProxyInit,
 		ImagePullPolicy: b.cfg.Images.PullPolicy,
 		Resources:       b.cfg.Resources.ProxyInit,
+		// init-iptables.sh takes no logging settings from the environment
+		TerminationMessagePolicy: b.cfg.Logging.ProxyInit.TerminationMessagePolicy,
 		Env: []corev1.EnvVar{
 			{
 				Name:  "PROXY_PORT",
@@ -428,6 +469,42 @@ func (b *ContainerBuilder) BuildProxyInitContainer() corev1.Container {
 			Privileged:   ptr.To(true),
 		},
 	}
+
+	if backend := b.cfg.Proxy.IptablesBackend; backend != "" {
+		// init-iptables.sh skips backend auto-detection when IPTABLES_CMD is set
+		c.Env = append(c.Env, corev1.EnvVar{Name: "IPTABLES_CMD", Value: "iptables-" + backend})
+	}
+	if b.cfg.Proxy.InitSecurity == config.ProxyInitMinimal {
+		c.SecurityContext = minimalProxyInitSecurityContext(b.cfg.Proxy.InitUID)
+		// iptables-legacy takes a lock under /run, which is read-only here, and
+		// the route_localnet sysctl cannot be set, which init-iptables.sh only
+		// tolerates in minimal mode
+		c.Env = append(c.Env,
+			corev1.EnvVar{Name: "XTABLES_LOCKFILE", Value: "/dev/shm/xtables.lock"},
+			corev1.EnvVar{Name: "PROXY_INIT_MINIMAL", Value: "1"})
+	}
+	return c
+}
+
+// minimalProxyInitSecurityContext grants proxy-init only what iptables needs.
+// A non-root process only gets NET_ADMIN/NET_RAW through the file
+// capabilities set on the iptables binaries in the proxy-init image, which
+// the kernel ignores under no_new_privs; hence AllowPrivilegeEscalation.
+// The sysctl for Istio ambient coexistence (route_localnet) cannot be set in
+// this mode.
+func minimalProxyInitSecurityContext(uid int64) *corev1.SecurityContext {
+	return &corev1.SecurityContext{
+		RunAsUser:                ptr.To(uid),
+		RunAsGroup:               ptr.To(uid),
+		RunAsNonRoot:             ptr.To(true),
+		Privileged:               ptr.To(false),
+		AllowPrivilegeEscalation: ptr.To(true),
+		ReadOnlyRootFilesystem:   ptr.To(true),
+		Capabilities: &corev1.Capabilities{
+			Add:  []corev1.Capability{"NET_ADMIN", "NET_RAW"},
+			Drop: []corev1.Capability{"ALL"},
+		},
+	}
 }
 
 // Backward-compatible package-level wrappers using compiled defaults.
@@ -0,0 +1,139 @@
+package injector
+
+import (
+	"testing"
+
+	"github.com/kagenti/kagenti-extensions/kagenti-webhook/internal/webhook/config"
+	corev1 "k8s.io/api/core/v1"
+)
+
+func envValue(env []corev1.EnvVar, name string) (string, bool) {
+	for _, e := range env {
+		if e.Name == name {
+			return e.Value, true
+		}
+	}
+	return "", false
+}
+
+func TestContainerBuilder_ObservabilityEnv(t *testing.T) {
+	tests := []struct {
+		name      string
+		obs       config.ObservabilityConfig
+		wantLevel string
+	}{
+		{name: "defaults", obs: config.CompiledDefaults().Observability, wantLevel: "info"},
+		{name: "debug", obs: config.ObservabilityConfig{LogLevel: "debug", EnableTracing: true, TracingBackend: "otlp"}, wantLevel: "debug"},
+		{name: "unset", obs: config.ObservabilityConfig{EnableMetrics: true}},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg := config.CompiledDefaults()
+			cfg.Observability = tc.obs
+			builder := NewContainerBuilder(cfg)
+
+			envoy := builder.BuildEnvoyProxyContainer()
+			got, ok := envValue(envoy.Env, "LOG_LEVEL")
+			if got != tc.wantLevel || ok != (tc.wantLevel != "") {
+				t.Errorf("envoy-proxy LOG_LEVEL = %q (set=%t), want %q", got, ok, tc.wantLevel)
+			}
+			// Nothing reads these; they must not suggest metrics or tracing can be switched
+			registration := builder.BuildClientRegistrationContainerWithSpireOption("agent", "team1", false)
+			for _, c := range []corev1.Container{envoy, registration} {
+				for _, name := range []string{"ENABLE_METRICS", "ENABLE_TRACING", "TRACING_BACKEND"} {
+					if _, ok := envValue(c.Env, name); ok {
+						t.Errorf("%s: %s should not be set", c.Name, name)
+					}
+				}
+			}
+			if _, ok := envValue(registration.Env, "LOG_LEVEL"); ok {
+				t.Error("client-registration does not read LOG_LEVEL; it should not be set")
+			}
+		})
+	}
+}
+
+func TestContainerBuilder_ProxyInitSecurity(t *testing.T) {
+	t.Run("privileged by default", func(t *testing.T) {
+		c := NewContainerBuilder(nil).BuildProxyInitContainer()
+		if sc := c.SecurityContext; sc.Privileged == nil || !*sc.Privileged || *sc.RunAsUser != 0 {
+			t.Errorf("expected privileged root container, got %+v", sc)
+		}
+		if _, ok := envValue(c.Env, "IPTABLES_CMD"); ok {
+			t.Error("IPTABLES_CMD should not be set without proxy.iptablesBackend")
+		}
+		if _, ok := envValue(c.Env, "PROXY_INIT_MINIMAL"); ok {
+			t.Error("PROXY_INIT_MINIMAL should only be set in minimal mode")
+		}
+	})
+
+	t.Run("minimal", func(t *testing.T) {
+		cfg := config.CompiledDefaults()
+		cfg.Proxy.InitSecurity = config.ProxyInitMinimal
+		cfg.Proxy.IptablesBackend = config.IptablesNft
+		c := NewContainerBuilder(cfg).BuildProxyInitContainer()
+
+		sc := c.SecurityContext
+		if *sc.Privileged || *sc.RunAsUser != cfg.Proxy.InitUID || !*sc.RunAsNonRoot || !*sc.ReadOnlyRootFilesystem {
+			t.Errorf("unexpected security context %+v", sc)
+		}
+		if len(sc.Capabilities.Add) != 2 || sc.Capabilities.Add[0] != "NET_ADMIN" || sc.Capabilities.Add[1] != "NET_RAW" {
+			t.Errorf("capabilities.add = %v, want [NET_ADMIN NET_RAW]", sc.Capabilities.Add)
+		}
+		if len(sc.Capabilities.Drop) != 1 || sc.Capabilities.Drop[0] != "ALL" {
+			t.Errorf("capabilities.drop = %v, want [ALL]", sc.Capabilities.Drop)
+		}
+		if got, _ := envValue(c.Env, "IPTABLES_CMD"); got != "iptables-nft" {
+			t.Errorf("IPTABLES_CMD = %q, want iptables-nft", got)
+		}
+		if _, ok := envValue(c.Env, "XTABLES_LOCKFILE"); !ok {
+			t.Error("XTABLES_LOCKFILE should point outside the read-only root filesystem")
+		}
+		if got, _ := envValue(c.Env, "PROXY_INIT_MINIMAL"); got != "1" {
+			t.Errorf("PROXY_INIT_MINIMAL = %q, want 1", got)
+		}
+	})
+}
+
+func TestContainerBuilder_Logging(t *testing.T) {
+	t.Run("defaults", func(t *testing.T) {
+		builder := NewContainerBuilder(nil)
+		for _, c := range []corev1.Container{
+			builder.BuildEnvoyProxyContainer(),
+			builder.BuildProxyInitContainer(),
+			builder.BuildSpiffeHelperContainer(),
+			builder.BuildClientRegistrationContainerWithSpireOption("agent", "team1", true),
+		} {
+			if c.TerminationMessagePolicy != corev1.TerminationMessageFallbackToLogsOnError {
+				t.Errorf("%s: terminationMessagePolicy = %q, want FallbackToLogsOnError", c.Name, c.TerminationMessagePolicy)
+			}
+			if _, ok := envValue(c.Env, "LOG_FORMAT"); ok {
+				t.Errorf("%s: LOG_FORMAT should not be set", c.Name)
+			}
+		}
+	})
+
+	t.Run("per sidecar", func(t *testing.T) {
+		cfg := config.CompiledDefaults()
+		cfg.Logging.EnvoyProxy = config.SidecarLogging{Level: "debug", Format: config.LogFormatText}
+		cfg.Logging.ClientRegistration.TerminationMessagePolicy = corev1.TerminationMessageReadFile
+		builder := NewContainerBuilder(cfg)
+
+		envoy := builder.BuildEnvoyProxyContainer()
+		if got, _ := envValue(envoy.Env, "LOG_LEVEL"); got != "debug" {
+			t.Errorf("envoy-proxy LOG_LEVEL = %q, want debug", got)
+		}
+		if got, _ := envValue(envoy.Env, "LOG_FORMAT"); got != "text" {
+			t.Errorf("envoy-proxy LOG_FORMAT = %q, want text", got)
+		}
+		if envoy.TerminationMessagePolicy != "" {
+			t.Errorf("envoy-proxy terminationMessagePolicy = %q, want unset", envoy.TerminationMessagePolicy)
+		}
+
+		registration := builder.BuildClientRegistrationContainerWithSpireOption("agent", "team1", false)
+		if registration.TerminationMessagePolicy != corev1.TerminationMessageReadFile {
+			t.Errorf("client-registration terminationMessagePolicy = %q, want File", registration.TerminationMessagePolicy)
+		}
+	})
+}
@@ -0,0 +1,129 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package injector
+
+import (
+	"fmt"
+	"path"
+
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/yaml"
+
+	"github.com/kagenti/kagenti-extensions/kagenti-webhook/internal/webhook/config"
+)
+
+// Annotations a resource (e.g. an MCPServer) may set to override the injected
+// client-registration container, within the platform's OverridePolicy.
+const (
+	// AnnotationClientRegistrationImage replaces the container image.
+	AnnotationClientRegistrationImage = "kagenti.io/client-registration-image"
+	// AnnotationClientRegistrationResources holds ResourceRequirements in
+	// JSON or YAML, e.g. {"limits":{"memory":"512Mi"}}. Listed quantities
+	// replace the platform defaults; others are kept.
+	AnnotationClientRegistrationResources = "kagenti.io/client-registration-resources"
+)
+
+// ApplyClientRegistrationOverrides applies the client-registration override
+// annotations to the injected container. An override outside the policy is
+// an error, so the resource is rejected instead of silently getting the
+// defaults. Pod specs without a client-registration container are unchanged.
+func ApplyClientRegistrationOverrides(podSpec *corev1.PodSpec, annotations map[string]string, policy config.ContainerOverridePolicy) error {
+	image, hasImage := annotations[AnnotationClientRegistrationImage]
+	resources, hasResources := annotations[AnnotationClientRegistrationResources]
+	if !hasImage && !hasResources {
+		return nil
+	}
+	var container *corev1.Container
+	for i := range podSpec.Containers {
+		if podSpec.Containers[i].Name == ClientRegistrationContainerName {
+			container = &podSpec.Containers[i]
+		}
+	}
+	if container == nil {
+		return nil
+	}
+
+	if hasImage {
+		if err := checkImageAllowed(image, policy.AllowedImages); err != nil {
+			return fmt.Errorf("%s: %w", AnnotationClientRegistrationImage, err)
+		}
+		container.Image = image
+	}
+
+	if hasResources {
+		var override corev1.ResourceRequirements
+		if err := yaml.UnmarshalStrict([]byte(resources), &override); err != nil {
+			return fmt.Errorf("%s: %w", AnnotationClientRegistrationResources, err)
+		}
+		if err := checkResourcesAllowed(override, policy.MaxResources); err != nil {
+			return fmt.Errorf("%s: %w", AnnotationClientRegistrationResources, err)
+		}
+		merged := container.Resources.DeepCopy()
+		merged.Requests = mergeResourceList(merged.Requests, override.Requests)
+		merged.Limits = mergeResourceList(merged.Limits, override.Limits)
+		for name, request := range merged.Requests {
+			if limit, ok := merged.Limits[name]; ok && request.Cmp(limit) > 0 {
+				return fmt.Errorf("%s: %s request %s exceeds its limit %s", AnnotationClientRegistrationResources, name, request.String(), limit.String())
+			}
+		}
+		container.Resources = *merged
+	}
+
+	mutatorLog.Info("Applied client-registration overrides", "image", container.Image,
+		"requests", container.Resources.Requests, "limits", container.Resources.Limits)
+	return nil
+}
+
+func checkImageAllowed(image string, allowed []string) error {
+	if image == "" {
+		return fmt.Errorf("image must not be empty")
+	}
+	for _, pattern := range allowed {
+		if ok, _ := path.Match(pattern, image); ok {
+			return nil
+		}
+	}
+	return fmt.Errorf("image %q is not allowed by overrides.clientRegistration.allowedImages", image)
+}
+
+func checkResourcesAllowed(override corev1.ResourceRequirements, max corev1.ResourceList) error {
+	for _, list := range []corev1.ResourceList{override.Requests, override.Limits} {
+		for name, q := range list {
+			bound, ok := max[name]
+			if !ok {
+				return fmt.Errorf("%s cannot be overridden (not in overrides.clientRegistration.maxResources)", name)
+			}
+			if q.Cmp(bound) > 0 {
+				return fmt.Errorf("%s %s exceeds the maximum %s", name, q.String(), bound.String())
+			}
+		}
+	}
+	return nil
+}
+
+func mergeResourceList(base, override corev1.ResourceList) corev1.ResourceList {
+	if len(override) == 0 {
+		return base
+	}
+	if base == nil {
+		base = make(corev1.ResourceList, len(override))
+	}
+	for name, q := range override {
+		base[name] = q
+	}
+	return base
+}
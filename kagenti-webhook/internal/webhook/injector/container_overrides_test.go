@@ -0,0 +1,141 @@
+package injector
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/kagenti/kagenti-extensions/kagenti-webhook/internal/webhook/config"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+func TestApplyClientRegistrationOverrides(t *testing.T) {
+	policy := config.ContainerOverridePolicy{
+		AllowedImages: []string{"ghcr.io/kagenti/*"},
+		MaxResources: corev1.ResourceList{
+			corev1.ResourceCPU:    resource.MustParse("1"),
+			corev1.ResourceMemory: resource.MustParse("1Gi"),
+		},
+	}
+
+	tests := []struct {
+		name        string
+		annotations map[string]string
+		policy      config.ContainerOverridePolicy
+		wantErr     string
+		wantImage   string
+		wantMemory  string // limit
+		wantCPUReq  string
+	}{
+		{name: "no overrides", policy: policy, wantMemory: "128Mi", wantCPUReq: "50m"},
+		{
+			name:        "allowed image",
+			annotations: map[string]string{AnnotationClientRegistrationImage: "ghcr.io/kagenti/client-registration:slow-idp"},
+			policy:      policy,
+			wantImage:   "ghcr.io/kagenti/client-registration:slow-idp",
+			wantMemory:  "128Mi",
+			wantCPUReq:  "50m",
+		},
+		{
+			name:        "image outside policy",
+			annotations: map[string]string{AnnotationClientRegistrationImage: "docker.io/evil/registration:latest"},
+			policy:      policy,
+			wantErr:     "not allowed",
+		},
+		{
+			name:        "image overrides forbidden by default",
+			annotations: map[string]string{AnnotationClientRegistrationImage: "ghcr.io/kagenti/client-registration:dev"},
+			wantErr:     "not allowed",
+		},
+		{
+			name:        "resources merged with defaults",
+			annotations: map[string]string{AnnotationClientRegistrationResources: `{"limits":{"memory":"512Mi"}}`},
+			policy:      policy,
+			wantMemory:  "512Mi",
+			wantCPUReq:  "50m",
+		},
+		{
+			name:        "resources as YAML",
+			annotations: map[string]string{AnnotationClientRegistrationResources: "requests:\n  cpu: 200m\nlimits:\n  cpu: 500m\n"},
+			policy:      policy,
+			wantMemory:  "128Mi",
+			wantCPUReq:  "200m",
+		},
+		{
+			name:        "above maximum",
+			annotations: map[string]string{AnnotationClientRegistrationResources: `{"limits":{"memory":"2Gi"}}`},
+			policy:      policy,
+			wantErr:     "exceeds the maximum",
+		},
+		{
+			name:        "resource not overridable",
+			annotations: map[string]string{AnnotationClientRegistrationResources: `{"limits":{"ephemeral-storage":"1Gi"}}`},
+			policy:      policy,
+			wantErr:     "cannot be overridden",
+		},
+		{
+			name:        "request above resulting limit",
+			annotations: map[string]string{AnnotationClientRegistrationResources: `{"requests":{"cpu":"500m"}}`},
+			policy:      policy,
+			wantErr:     "exceeds its limit",
+		},
+		{
+			name:        "malformed",
+			annotations: map[string]string{AnnotationClientRegistrationResources: `{"limit":{}}`},
+			policy:      policy,
+			wantErr:     AnnotationClientRegistrationResources,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			builder := NewContainerBuilder(config.CompiledDefaults())
+			podSpec := &corev1.PodSpec{Containers: []corev1.Container{
+				{Name: "mcp"},
+				builder.BuildClientRegistrationContainerWithSpireOption("fetch", "team1", false),
+			}}
+			defaultImage := podSpec.Containers[1].Image
+
+			err := ApplyClientRegistrationOverrides(podSpec, tt.annotations, tt.policy)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("error = %v, want it to contain %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			c := podSpec.Containers[1]
+			wantImage := tt.wantImage
+			if wantImage == "" {
+				wantImage = defaultImage
+			}
+			if c.Image != wantImage {
+				t.Errorf("image = %q, want %q", c.Image, wantImage)
+			}
+			if got := c.Resources.Limits.Memory().String(); got != tt.wantMemory {
+				t.Errorf("memory limit = %s, want %s", got, tt.wantMemory)
+			}
+			if got := c.Resources.Requests.Cpu().String(); got != tt.wantCPUReq {
+				t.Errorf("cpu request = %s, want %s", got, tt.wantCPUReq)
+			}
+		})
+	}
+}
+
+func TestApplyClientRegistrationOverrides_DoesNotShareDefaults(t *testing.T) {
+	cfg := config.CompiledDefaults()
+	cfg.Overrides.ClientRegistration.MaxResources = corev1.ResourceList{corev1.ResourceMemory: resource.MustParse("1Gi")}
+	builder := NewContainerBuilder(cfg)
+	podSpec := &corev1.PodSpec{Containers: []corev1.Container{builder.BuildClientRegistrationContainerWithSpireOption("fetch", "team1", false)}}
+
+	annotations := map[string]string{AnnotationClientRegistrationResources: `{"limits":{"memory":"512Mi"}}`}
+	if err := ApplyClientRegistrationOverrides(podSpec, annotations, cfg.Overrides.ClientRegistration); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := cfg.Resources.ClientRegistration.Limits.Memory().String(); got != "128Mi" {
+		t.Errorf("platform default changed to %s", got)
+	}
+}
@@ -0,0 +1,133 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package injector
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/utils/ptr"
+)
+
+const (
+	// ClientCredentialsVolumeName is the Secret volume holding the registered
+	// client credentials in the "secret" credential store mode.
+	ClientCredentialsVolumeName = "client-credentials"
+	// ClientCredentialsMountPath is where that Secret is mounted.
+	ClientCredentialsMountPath = "/var/run/kagenti/client-credentials"
+	// Secret keys, also the file names under ClientCredentialsMountPath
+	ClientIDKey     = "client-id.txt"
+	ClientSecretKey = "client-secret.txt"
+)
+
+// CredentialsOwner identifies the resource owning the credentials Secret.
+type CredentialsOwner struct {
+	APIVersion string
+	Kind       string
+	// Resource is the plural resource name used to look the owner up, e.g.
+	// "mcpservers".
+	Resource string
+	Name     string
+}
+
+// ClientCredentialsSecretName returns the name of the Secret storing the
+// registered client credentials of the named resource.
+func ClientCredentialsSecretName(ownerName string) string {
+	return ownerName + "-kagenti-client"
+}
+
+// UseCredentialsSecret switches an injected pod spec from the shared-data
+// emptyDir to a credentials Secret: client-registration writes the Secret
+// (owned by owner), and it and envoy-proxy mount it read-only, envoy-proxy
+// reading its client ID and secret from there. The workload's own containers
+// do not get the client secret. The Secret volume
+// is optional so pods start before the first registration has finished.
+// Pod specs without a client-registration container are left unchanged.
+func UseCredentialsSecret(podSpec *corev1.PodSpec, owner CredentialsOwner) {
+	if !containerExists(podSpec.Containers, ClientRegistrationContainerName) {
+		return
+	}
+	secretName := ClientCredentialsSecretName(owner.Name)
+
+	if !volumeExists(podSpec.Volumes, ClientCredentialsVolumeName) {
+		podSpec.Volumes = append(podSpec.Volumes, corev1.Volume{
+			Name: ClientCredentialsVolumeName,
+			VolumeSource: corev1.VolumeSource{
+				Secret: &corev1.SecretVolumeSource{
+					SecretName: secretName,
+					Optional:   ptr.To(true),
+				},
+			},
+		})
+	}
+
+	for i := range podSpec.Containers {
+		c := &podSpec.Containers[i]
+		switch c.Name {
+		case ClientRegistrationContainerName:
+			c.Env = setEnv(c.Env,
+				corev1.EnvVar{Name: "CREDENTIALS_SECRET_NAME", Value: secretName},
+				corev1.EnvVar{Name: "CREDENTIALS_SECRET_NAMESPACE", ValueFrom: &corev1.EnvVarSource{
+					FieldRef: &corev1.ObjectFieldSelector{FieldPath: "metadata.namespace"},
+				}},
+				corev1.EnvVar{Name: "CREDENTIALS_OWNER_API_VERSION", Value: owner.APIVersion},
+				corev1.EnvVar{Name: "CREDENTIALS_OWNER_KIND", Value: owner.Kind},
+				corev1.EnvVar{Name: "CREDENTIALS_OWNER_RESOURCE", Value: owner.Resource},
+				corev1.EnvVar{Name: "CREDENTIALS_OWNER_NAME", Value: owner.Name},
+			)
+		case EnvoyProxyContainerName:
+			c.Env = setEnv(c.Env,
+				corev1.EnvVar{Name: "CLIENT_ID_FILE", Value: ClientCredentialsMountPath + "/" + ClientIDKey},
+				corev1.EnvVar{Name: "CLIENT_SECRET_FILE", Value: ClientCredentialsMountPath + "/" + ClientSecretKey},
+			)
+		default:
+			continue
+		}
+		if !volumeMountExists(c.VolumeMounts, ClientCredentialsVolumeName) {
+			c.VolumeMounts = append(c.VolumeMounts, corev1.VolumeMount{
+				Name:      ClientCredentialsVolumeName,
+				MountPath: ClientCredentialsMountPath,
+				ReadOnly:  true,
+			})
+		}
+	}
+}
+
+// setEnv sets each variable, replacing an existing one of the same name.
+func setEnv(env []corev1.EnvVar, vars ...corev1.EnvVar) []corev1.EnvVar {
+	for _, v := range vars {
+		replaced := false
+		for i := range env {
+			if env[i].Name == v.Name {
+				env[i] = v
+				replaced = true
+				break
+			}
+		}
+		if !replaced {
+			env = append(env, v)
+		}
+	}
+	return env
+}
+
+func volumeMountExists(mounts []corev1.VolumeMount, name string) bool {
+	for _, m := range mounts {
+		if m.Name == name {
+			return true
+		}
+	}
+	return false
+}
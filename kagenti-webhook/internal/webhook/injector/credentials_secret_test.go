@@ -0,0 +1,77 @@
+package injector
+
+import (
+	"testing"
+
+	"github.com/kagenti/kagenti-extensions/kagenti-webhook/internal/webhook/config"
+	corev1 "k8s.io/api/core/v1"
+)
+
+func TestUseCredentialsSecret(t *testing.T) {
+	builder := NewContainerBuilder(config.CompiledDefaults())
+	podSpec := &corev1.PodSpec{
+		Containers: []corev1.Container{
+			{Name: "mcp"},
+			builder.BuildClientRegistrationContainerWithSpireOption("fetch", "team1", false),
+			builder.BuildEnvoyProxyContainer(),
+		},
+		Volumes: BuildRequiredVolumesNoSpire(),
+	}
+	owner := CredentialsOwner{APIVersion: "toolhive.stacklok.dev/v1alpha1", Kind: "MCPServer", Resource: "mcpservers", Name: "fetch"}
+
+	UseCredentialsSecret(podSpec, owner)
+	UseCredentialsSecret(podSpec, owner) // idempotent
+
+	var secretVolumes int
+	for _, v := range podSpec.Volumes {
+		if v.Name == ClientCredentialsVolumeName {
+			secretVolumes++
+			if v.Secret == nil || v.Secret.SecretName != "fetch-kagenti-client" {
+				t.Errorf("credentials volume = %+v, want Secret fetch-kagenti-client", v.VolumeSource)
+			}
+		}
+	}
+	if secretVolumes != 1 {
+		t.Errorf("got %d credentials volumes, want 1", secretVolumes)
+	}
+
+	for _, c := range podSpec.Containers {
+		mounts := 0
+		for _, m := range c.VolumeMounts {
+			if m.Name == ClientCredentialsVolumeName {
+				mounts++
+			}
+		}
+		switch c.Name {
+		case ClientRegistrationContainerName:
+			if mounts != 1 {
+				t.Errorf("client-registration has %d credentials mounts, want 1", mounts)
+			}
+			if v, _ := envValue(c.Env, "CREDENTIALS_SECRET_NAME"); v != "fetch-kagenti-client" {
+				t.Errorf("CREDENTIALS_SECRET_NAME = %q", v)
+			}
+			if v, _ := envValue(c.Env, "CREDENTIALS_OWNER_RESOURCE"); v != "mcpservers" {
+				t.Errorf("CREDENTIALS_OWNER_RESOURCE = %q", v)
+			}
+		case EnvoyProxyContainerName:
+			if v, _ := envValue(c.Env, "CLIENT_SECRET_FILE"); v != ClientCredentialsMountPath+"/client-secret.txt" {
+				t.Errorf("CLIENT_SECRET_FILE = %q", v)
+			}
+			if mounts != 1 {
+				t.Errorf("envoy-proxy has %d credentials mounts, want 1", mounts)
+			}
+		default:
+			if mounts != 0 {
+				t.Errorf("container %s mounts the client credentials; only the sidecars may", c.Name)
+			}
+		}
+	}
+}
+
+func TestUseCredentialsSecret_NoClientRegistration(t *testing.T) {
+	podSpec := &corev1.PodSpec{Containers: []corev1.Container{{Name: "mcp"}}}
+	UseCredentialsSecret(podSpec, CredentialsOwner{Name: "fetch"})
+	if len(podSpec.Volumes) != 0 || len(podSpec.Containers[0].VolumeMounts) != 0 {
+		t.Errorf("pod spec changed without client-registration: %+v", podSpec)
+	}
+}
@@ -0,0 +1,92 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package injector
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+
+	"github.com/kagenti/kagenti-extensions/kagenti-webhook/internal/webhook/config"
+)
+
+var (
+	imagePinExpiry = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "kagenti_webhook_image_pin_expiry_timestamp_seconds",
+		Help: "Expiry of each image pin with one, as a Unix timestamp.",
+	}, []string{"pin"})
+	staleImagePinInjections = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "kagenti_webhook_stale_image_pin_injections_total",
+		Help: "Injections that used an image pin past its expiry, by pin and namespace.",
+	}, []string{"pin", "namespace"})
+)
+
+func init() {
+	metrics.Registry.MustRegister(imagePinExpiry, staleImagePinInjections)
+}
+
+// now is the clock pin expiry is checked against; tests override it.
+var now = time.Now
+
+// ExportImagePins publishes the expiry of the configured pins. Call it with
+// every loaded config.
+func ExportImagePins(pins []config.ImagePin) {
+	imagePinExpiry.Reset()
+	for _, pin := range pins {
+		if pin.Expires != nil {
+			imagePinExpiry.WithLabelValues(pin.Name).Set(float64(pin.Expires.Unix()))
+		}
+	}
+}
+
+// pinnedConfig returns cfg with the images of the pin matching nsLabels, and
+// counts injections with a stale pin.
+func pinnedConfig(cfg *config.PlatformConfig, namespace string, nsLabels map[string]string) *config.PlatformConfig {
+	pin := cfg.Images.PinFor(nsLabels)
+	if pin == nil {
+		return cfg
+	}
+	pinned := *cfg
+	pinned.Images = cfg.Images.Pinned(pin)
+	if pin.Stale(now()) {
+		staleImagePinInjections.WithLabelValues(pin.Name, namespace).Inc()
+		mutatorLog.Info("Injecting with a stale image pin", "pin", pin.Name, "namespace", namespace, "expires", pin.Expires)
+	} else {
+		mutatorLog.Info("Injecting with image pin", "pin", pin.Name, "namespace", namespace)
+	}
+	return &pinned
+}
+
+// CheckImagePin returns a warning when the sidecars injected into namespace
+// use a pin past its expiry, or "" when they don't.
+func (m *PodMutator) CheckImagePin(ctx context.Context, namespace string) (string, error) {
+	ns := &corev1.Namespace{}
+	if err := m.Client.Get(ctx, client.ObjectKey{Name: namespace}, ns); err != nil {
+		return "", fmt.Errorf("failed to fetch namespace: %w", err)
+	}
+	pin := m.GetPlatformConfig().Images.PinFor(ns.Labels)
+	if pin == nil || !pin.Stale(now()) {
+		return "", nil
+	}
+	return fmt.Sprintf("sidecar images are pinned by %q, which expired on %s; update or remove the pin in the webhook config",
+		pin.Name, pin.Expires.UTC().Format(time.RFC3339)), nil
+}
@@ -0,0 +1,89 @@
+package injector
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kagenti/kagenti-extensions/kagenti-webhook/internal/webhook/config"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func pinnedTestConfig(expires time.Time) *config.PlatformConfig {
+	cfg := config.CompiledDefaults()
+	cfg.Images.Pins = []config.ImagePin{
+		{Name: "prod", NamespaceSelector: "env=prod", EnvoyProxy: "ghcr.io/kagenti/envoy-with-processor:v0.4.2",
+			Expires: &metav1.Time{Time: expires}},
+		{Name: "all", NamespaceSelector: "env", ClientRegistration: "ghcr.io/kagenti/client-registration:v0.4.0"},
+	}
+	return cfg
+}
+
+func TestInjectAuthBridge_ImagePin(t *testing.T) {
+	cfg := pinnedTestConfig(time.Now().Add(24 * time.Hour))
+	objs := []client.Object{
+		&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "prod", Labels: map[string]string{"kagenti-enabled": "true", "env": "prod"}}},
+		&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "dev", Labels: map[string]string{"kagenti-enabled": "true"}}},
+	}
+	m := NewPodMutator(fake.NewClientBuilder().WithObjects(objs...).Build(), true,
+		func() *config.PlatformConfig { return cfg }, config.DefaultFeatureGates)
+
+	images := func(namespace string) map[string]string {
+		podSpec := &corev1.PodSpec{Containers: []corev1.Container{{Name: "app"}}}
+		if _, err := m.InjectAuthBridge(context.Background(), podSpec, namespace, "weather", map[string]string{KagentiTypeLabel: KagentiTypeAgent}); err != nil {
+			t.Fatal(err)
+		}
+		out := map[string]string{}
+		for _, c := range append(podSpec.Containers, podSpec.InitContainers...) {
+			out[c.Name] = c.Image
+		}
+		return out
+	}
+
+	// The first matching pin applies, and only to the images it sets
+	prod := images("prod")
+	if prod[EnvoyProxyContainerName] != "ghcr.io/kagenti/envoy-with-processor:v0.4.2" {
+		t.Errorf("prod envoy-proxy image = %q", prod[EnvoyProxyContainerName])
+	}
+	if prod[ClientRegistrationContainerName] != cfg.Images.ClientRegistration {
+		t.Errorf("prod client-registration image = %q, want the default", prod[ClientRegistrationContainerName])
+	}
+	dev := images("dev")
+	if dev[EnvoyProxyContainerName] != cfg.Images.EnvoyProxy {
+		t.Errorf("dev envoy-proxy image = %q, want the default", dev[EnvoyProxyContainerName])
+	}
+
+	if warning, err := m.CheckImagePin(context.Background(), "prod"); err != nil || warning != "" {
+		t.Errorf("CheckImagePin() = %q, %v for a current pin", warning, err)
+	}
+}
+
+func TestCheckImagePin_Stale(t *testing.T) {
+	cfg := pinnedTestConfig(time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC))
+	ns := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "prod", Labels: map[string]string{"env": "prod"}}}
+	m := &PodMutator{
+		Client:            fake.NewClientBuilder().WithObjects(ns).Build(),
+		GetPlatformConfig: func() *config.PlatformConfig { return cfg },
+	}
+
+	warning, err := m.CheckImagePin(context.Background(), "prod")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(warning, `"prod"`) || !strings.Contains(warning, "2025-01-01T00:00:00Z") {
+		t.Errorf("warning = %q, want the pin name and expiry", warning)
+	}
+
+	// A stale pin keeps applying
+	pinned := pinnedConfig(cfg, "prod", ns.Labels)
+	if pinned.Images.EnvoyProxy != "ghcr.io/kagenti/envoy-with-processor:v0.4.2" {
+		t.Errorf("stale pin not applied: %q", pinned.Images.EnvoyProxy)
+	}
+	if cfg.Images.EnvoyProxy == pinned.Images.EnvoyProxy {
+		t.Error("pinning modified the shared config")
+	}
+}
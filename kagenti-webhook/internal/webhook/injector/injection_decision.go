@@ -19,3 +19,17 @@ type InjectionDecision struct {
 func (d InjectionDecision) AnyInjected() bool {
 	return d.EnvoyProxy.Inject || d.SpiffeHelper.Inject || d.ClientRegistration.Inject
 }
+
+// Rejection is returned by InjectAuthBridge for a workload a platform config
+// policy refuses to inject; admission is denied with its message.
+type Rejection interface {
+	error
+	// Reason names the rejecting policy, e.g. "pod-limits".
+	Reason() string
+}
+
+// Rejected returns the decision with no sidecar injected because of r.
+func (d InjectionDecision) Rejected(r Rejection) InjectionDecision {
+	rejected := SidecarDecision{Inject: false, Reason: r.Error(), Layer: r.Reason()}
+	return InjectionDecision{EnvoyProxy: rejected, ProxyInit: rejected, SpiffeHelper: rejected, ClientRegistration: rejected}
+}
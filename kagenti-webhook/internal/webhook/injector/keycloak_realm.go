@@ -0,0 +1,76 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package injector
+
+import (
+	"context"
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/kagenti/kagenti-extensions/kagenti-webhook/internal/webhook/config"
+)
+
+// AnnotationKeycloakRealm names the platform-configured Keycloak realm a
+// resource (e.g. an MCPServer) registers its client in, overriding the
+// realm selected by namespace.
+const AnnotationKeycloakRealm = "kagenti.io/keycloak-realm"
+
+// KeycloakRealmFor returns the realm of a resource in namespace with
+// annotations, or nil when the environments ConfigMap's realm applies. Naming
+// a realm that is not configured is an error.
+func (m *PodMutator) KeycloakRealmFor(ctx context.Context, namespace string, annotations map[string]string) (*config.KeycloakRealm, error) {
+	cfg := m.GetPlatformConfig().ClientRegistration
+	if len(cfg.Realms) == 0 {
+		if name := annotations[AnnotationKeycloakRealm]; name != "" {
+			return nil, fmt.Errorf("%s: keycloak realm %q is not configured", AnnotationKeycloakRealm, name)
+		}
+		return nil, nil
+	}
+	ns := &corev1.Namespace{}
+	if err := m.Client.Get(ctx, client.ObjectKey{Name: namespace}, ns); err != nil {
+		return nil, fmt.Errorf("failed to fetch namespace: %w", err)
+	}
+	realm, err := cfg.RealmFor(annotations[AnnotationKeycloakRealm], ns.Labels)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", AnnotationKeycloakRealm, err)
+	}
+	return realm, nil
+}
+
+// UseKeycloakRealm points an injected pod spec at realm: client-registration
+// registers the client there, and envoy-proxy exchanges and validates tokens
+// with it. The values replace the environments and authbridge-config
+// ConfigMap references.
+func UseKeycloakRealm(podSpec *corev1.PodSpec, realm *config.KeycloakRealm) {
+	for i := range podSpec.Containers {
+		c := &podSpec.Containers[i]
+		switch c.Name {
+		case ClientRegistrationContainerName:
+			c.Env = setEnv(c.Env,
+				corev1.EnvVar{Name: "KEYCLOAK_URL", Value: realm.URL},
+				corev1.EnvVar{Name: "KEYCLOAK_REALM", Value: realm.Realm},
+			)
+		case EnvoyProxyContainerName:
+			c.Env = setEnv(c.Env,
+				corev1.EnvVar{Name: "TOKEN_URL", Value: realm.TokenURL()},
+				corev1.EnvVar{Name: "ISSUER", Value: realm.IssuerURL()},
+			)
+		}
+	}
+}
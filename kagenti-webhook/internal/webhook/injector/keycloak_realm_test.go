@@ -0,0 +1,99 @@
+package injector
+
+import (
+	"context"
+	"testing"
+
+	"github.com/kagenti/kagenti-extensions/kagenti-webhook/internal/webhook/config"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestKeycloakRealmFor(t *testing.T) {
+	cfg := config.CompiledDefaults()
+	cfg.ClientRegistration.Realms = []config.KeycloakRealm{
+		{Name: "shared", URL: "http://keycloak:8080", Realm: "shared"},
+		{Name: "tenant-a", NamespaceSelector: "tenant=a", URL: "http://keycloak-a:8080", Realm: "a"},
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("Validate: %v", err)
+	}
+	c := fake.NewClientBuilder().WithObjects(
+		&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "team-a", Labels: map[string]string{"tenant": "a"}}},
+		&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "team-b", Labels: map[string]string{"tenant": "b"}}},
+	).Build()
+	m := NewPodMutator(c, true, func() *config.PlatformConfig { return cfg }, config.DefaultFeatureGates)
+
+	tests := []struct {
+		name        string
+		namespace   string
+		annotations map[string]string
+		want        string
+		wantErr     bool
+	}{
+		{name: "selected by namespace", namespace: "team-a", want: "a"},
+		{name: "no match", namespace: "team-b"},
+		{name: "annotation wins", namespace: "team-a", annotations: map[string]string{AnnotationKeycloakRealm: "shared"}, want: "shared"},
+		{name: "unknown annotation", namespace: "team-b", annotations: map[string]string{AnnotationKeycloakRealm: "tenant-c"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			realm, err := m.KeycloakRealmFor(context.Background(), tt.namespace, tt.annotations)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("expected error, got realm %+v", realm)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("KeycloakRealmFor: %v", err)
+			}
+			got := ""
+			if realm != nil {
+				got = realm.Realm
+			}
+			if got != tt.want {
+				t.Errorf("realm = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestUseKeycloakRealm(t *testing.T) {
+	builder := NewContainerBuilder(config.CompiledDefaults())
+	podSpec := corev1.PodSpec{Containers: []corev1.Container{
+		{Name: "mcp"},
+		builder.BuildClientRegistrationContainerWithSpireOption("fetch", "team-a", true),
+		builder.BuildEnvoyProxyContainer(),
+	}}
+	UseKeycloakRealm(&podSpec, &config.KeycloakRealm{URL: "http://keycloak-a:8080/", Realm: "a"})
+
+	want := map[string]map[string]string{
+		ClientRegistrationContainerName: {"KEYCLOAK_URL": "http://keycloak-a:8080/", "KEYCLOAK_REALM": "a"},
+		EnvoyProxyContainerName: {
+			"TOKEN_URL": "http://keycloak-a:8080/realms/a/protocol/openid-connect/token",
+			"ISSUER":    "http://keycloak-a:8080/realms/a",
+		},
+	}
+	for container, vars := range want {
+		c := findContainer(podSpec.Containers, container)
+		for name, value := range vars {
+			var found *corev1.EnvVar
+			for i := range c.Env {
+				if c.Env[i].Name == name {
+					if found != nil {
+						t.Errorf("%s: %s set twice", container, name)
+					}
+					found = &c.Env[i]
+				}
+			}
+			if found == nil || found.Value != value || found.ValueFrom != nil {
+				t.Errorf("%s: %s = %+v, want %q", container, name, found, value)
+			}
+		}
+	}
+	if len(podSpec.Containers[0].Env) != 0 {
+		t.Errorf("app container env changed: %v", podSpec.Containers[0].Env)
+	}
+}
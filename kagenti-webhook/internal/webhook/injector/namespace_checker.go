@@ -19,13 +19,42 @@ package injector
 import (
 	"context"
 
+	"github.com/kagenti/kagenti-extensions/kagenti-webhook/internal/webhook/config"
 	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	logf "sigs.k8s.io/controller-runtime/pkg/log"
 )
 
 var nsLog = logf.Log.WithName("namespace-checker")
 
+// Values of the kagenti-enabled namespace label that opt a namespace in or out.
+var (
+	namespaceOptInValues  = map[string]bool{"true": true, "enabled": true}
+	namespaceOptOutValues = map[string]bool{"false": true, "disabled": true}
+)
+
+// NamespaceOptedIn reports whether a namespace with nsLabels is opted in to
+// injection: kagenti-enabled is "true" or "enabled", or the namespace matches
+// the platform's namespaces.selector. An explicit kagenti-enabled "false" or
+// "disabled" always opts out.
+func NamespaceOptedIn(nsLabels map[string]string, cfg *config.PlatformConfig) bool {
+	value := nsLabels[LabelNamespaceInject]
+	if namespaceOptInValues[value] {
+		return true
+	}
+	if namespaceOptOutValues[value] || cfg == nil || cfg.Namespaces.Selector == "" {
+		return false
+	}
+	selector, err := labels.Parse(cfg.Namespaces.Selector)
+	if err != nil {
+		// Validated when the config is loaded
+		nsLog.Error(err, "Invalid namespace selector", "selector", cfg.Namespaces.Selector)
+		return false
+	}
+	return selector.Matches(labels.Set(nsLabels))
+}
+
 // DEPRECATED, used by Agent and MCPServer CRs. Remove CheckNamespaceInjectionEnabled after both CRs are deleted and use IsNamespaceInjectionEnabled instead.
 
 // checks if a namespace has injection enabled via labels or annotations
@@ -42,8 +71,8 @@ func CheckNamespaceInjectionEnabled(ctx context.Context, k8sClient client.Client
 
 	// Check NS label (e.g., kagenti-enabled: "true")
 	if namespace.Labels != nil {
-		if namespace.Labels[labelKey] == "true" {
-			nsLog.Info("Namespace injection enabled via label", "namespace", namespaceName, "labelKey", labelKey, "labelValue", "true")
+		if value := namespace.Labels[labelKey]; namespaceOptInValues[value] {
+			nsLog.Info("Namespace injection enabled via label", "namespace", namespaceName, "labelKey", labelKey, "labelValue", value)
 			return true, nil
 		}
 	}
@@ -60,9 +89,9 @@ func CheckNamespaceInjectionEnabled(ctx context.Context, k8sClient client.Client
 	return false, nil
 }
 
-// checks if a namespace has injection enabled via labels or annotations
-func IsNamespaceInjectionEnabled(ctx context.Context, k8sClient client.Client, namespaceName, labelKey string) (bool, error) {
-	nsLog.Info("Checking namespace injection settings", "namespace", namespaceName, "labelKey", labelKey)
+// checks if a namespace is opted in to injection (see NamespaceOptedIn)
+func IsNamespaceInjectionEnabled(ctx context.Context, k8sClient client.Client, namespaceName string, cfg *config.PlatformConfig) (bool, error) {
+	nsLog.Info("Checking namespace injection settings", "namespace", namespaceName)
 
 	namespace := &corev1.Namespace{}
 	if err := k8sClient.Get(ctx, client.ObjectKey{Name: namespaceName}, namespace); err != nil {
@@ -72,12 +101,9 @@ func IsNamespaceInjectionEnabled(ctx context.Context, k8sClient client.Client, n
 
 	nsLog.Info("Namespace fetched", "namespace", namespaceName, "labels", namespace.Labels, "annotations", namespace.Annotations)
 
-	// Check NS label (e.g., kagenti-enabled: "true")
-	if namespace.Labels != nil {
-		if namespace.Labels[labelKey] == "true" {
-			nsLog.Info("Namespace injection enabled via label", "namespace", namespaceName, "labelKey", labelKey, "labelValue", "true")
-			return true, nil
-		}
+	if NamespaceOptedIn(namespace.Labels, cfg) {
+		nsLog.Info("Namespace injection enabled", "namespace", namespaceName)
+		return true, nil
 	}
 
 	nsLog.Info("Namespace injection not enabled", "namespace", namespaceName)
@@ -0,0 +1,36 @@
+package injector
+
+import (
+	"testing"
+
+	"github.com/kagenti/kagenti-extensions/kagenti-webhook/internal/webhook/config"
+)
+
+func TestNamespaceOptedIn(t *testing.T) {
+	withSelector := config.CompiledDefaults()
+	withSelector.Namespaces.Selector = "team in (payments,search),env!=dev"
+
+	tests := []struct {
+		name   string
+		labels map[string]string
+		cfg    *config.PlatformConfig
+		want   bool
+	}{
+		{name: "true", labels: map[string]string{"kagenti-enabled": "true"}, want: true},
+		{name: "enabled", labels: map[string]string{"kagenti-enabled": "enabled"}, want: true},
+		{name: "other value", labels: map[string]string{"kagenti-enabled": "yes"}, want: false},
+		{name: "no label", labels: nil, want: false},
+		{name: "selector match", labels: map[string]string{"team": "payments"}, cfg: withSelector, want: true},
+		{name: "selector mismatch", labels: map[string]string{"team": "payments", "env": "dev"}, cfg: withSelector, want: false},
+		{name: "explicit opt-out wins over selector", labels: map[string]string{"team": "search", "kagenti-enabled": "false"}, cfg: withSelector, want: false},
+		{name: "label without selector match", labels: map[string]string{"kagenti-enabled": "true", "env": "dev"}, cfg: withSelector, want: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := NamespaceOptedIn(tt.labels, tt.cfg); got != tt.want {
+				t.Errorf("NamespaceOptedIn(%v) = %t, want %t", tt.labels, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,128 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package injector
+
+import (
+	"slices"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// AnnotationInjectedSidecars marks the pod template with the sidecars and init
+// containers the webhook manages, sorted and comma-separated. Tools diffing
+// the applied spec against the live one (e.g. GitOps controllers) can use it
+// to ignore webhook-managed fields.
+const AnnotationInjectedSidecars = "kagenti.io/injected-sidecars"
+
+// managedContainers and managedVolumes are the names the webhook injects.
+// Anything else in the pod spec belongs to the user and is never reordered.
+var (
+	managedContainers = []string{
+		EnvoyProxyContainerName,
+		ProxyInitContainerName,
+		SpiffeHelperContainerName,
+		ClientRegistrationContainerName,
+	}
+	managedVolumes = []string{
+		"shared-data",
+		"spire-agent-socket",
+		"spiffe-helper-config",
+		"svid-output",
+		"envoy-config",
+		ClientCredentialsVolumeName,
+		TrustBundleVolumeName,
+	}
+	// managedInitOrder is the start order of managed init containers:
+	// GateOnRegistration runs spiffe-helper and client-registration as
+	// native sidecars, and client-registration needs spiffe-helper's SVID.
+	managedInitOrder = []string{
+		ProxyInitContainerName,
+		SpiffeHelperContainerName,
+		ClientRegistrationContainerName,
+	}
+)
+
+// NormalizeInjectedPodTemplate brings the webhook-managed parts of a pod
+// template into a canonical form, so defaulting the same object again (as on
+// every GitOps re-apply) yields byte-identical output regardless of which
+// sidecars were already present:
+//   - user containers and volumes keep their order, followed by the managed
+//     ones sorted by name (init containers in start order);
+//   - env and volume mounts of managed containers are sorted by name;
+//   - AnnotationInjectedSidecars lists the managed containers present.
+//
+// Injected env vars never reference each other via $(VAR), so sorting them
+// does not change their values.
+func NormalizeInjectedPodTemplate(template *corev1.PodTemplateSpec) {
+	spec := &template.Spec
+	spec.Containers = sortManagedContainers(spec.Containers, strings.Compare)
+	spec.InitContainers = sortManagedContainers(spec.InitContainers, func(a, b string) int {
+		return slices.Index(managedInitOrder, a) - slices.Index(managedInitOrder, b)
+	})
+	spec.Volumes = sortManaged(spec.Volumes, func(v corev1.Volume) string { return v.Name }, managedVolumes, strings.Compare)
+
+	var injected []string
+	for _, containers := range [][]corev1.Container{spec.Containers, spec.InitContainers} {
+		for _, c := range containers {
+			if slices.Contains(managedContainers, c.Name) {
+				injected = append(injected, c.Name)
+			}
+		}
+	}
+	if len(injected) == 0 {
+		if template.Annotations != nil {
+			delete(template.Annotations, AnnotationInjectedSidecars)
+		}
+		return
+	}
+	slices.Sort(injected)
+	metav1.SetMetaDataAnnotation(&template.ObjectMeta, AnnotationInjectedSidecars, strings.Join(injected, ","))
+}
+
+func sortManagedContainers(containers []corev1.Container, cmp func(a, b string) int) []corev1.Container {
+	containers = sortManaged(containers, func(c corev1.Container) string { return c.Name }, managedContainers, cmp)
+	for i := range containers {
+		c := &containers[i]
+		if !slices.Contains(managedContainers, c.Name) {
+			continue
+		}
+		slices.SortStableFunc(c.Env, func(a, b corev1.EnvVar) int { return strings.Compare(a.Name, b.Name) })
+		slices.SortStableFunc(c.VolumeMounts, func(a, b corev1.VolumeMount) int { return strings.Compare(a.Name, b.Name) })
+	}
+	return containers
+}
+
+// sortManaged moves the items whose name is in managed after all other items,
+// sorted by name with cmp. The relative order of the other items is kept.
+func sortManaged[T any](items []T, name func(T) string, managed []string, cmp func(a, b string) int) []T {
+	if len(items) == 0 {
+		return items
+	}
+	out := make([]T, 0, len(items))
+	var owned []T
+	for _, item := range items {
+		if slices.Contains(managed, name(item)) {
+			owned = append(owned, item)
+		} else {
+			out = append(out, item)
+		}
+	}
+	slices.SortStableFunc(owned, func(a, b T) int { return cmp(name(a), name(b)) })
+	return append(out, owned...)
+}
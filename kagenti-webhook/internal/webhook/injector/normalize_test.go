@@ -0,0 +1,72 @@
+package injector
+
+import (
+	"testing"
+
+	"github.com/kagenti/kagenti-extensions/kagenti-webhook/internal/webhook/config"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+)
+
+func containerNames(containers []corev1.Container) []string {
+	names := make([]string, 0, len(containers))
+	for _, c := range containers {
+		names = append(names, c.Name)
+	}
+	return names
+}
+
+func TestNormalizeInjectedPodTemplate(t *testing.T) {
+	builder := NewContainerBuilder(config.CompiledDefaults())
+	envoy := builder.BuildEnvoyProxyContainer()
+	envoy.Env = append([]corev1.EnvVar{{Name: "ZZZ", Value: "last"}}, envoy.Env...)
+
+	template := &corev1.PodTemplateSpec{Spec: corev1.PodSpec{
+		Containers: []corev1.Container{
+			envoy,
+			{Name: "mcp", Env: []corev1.EnvVar{{Name: "B"}, {Name: "A"}}},
+			builder.BuildClientRegistrationContainerWithSpireOption("fetch", "team1", false),
+			{Name: "logger"},
+		},
+		Volumes: append(BuildRequiredVolumesNoSpire(), corev1.Volume{Name: "data"}),
+	}}
+
+	NormalizeInjectedPodTemplate(template)
+
+	want := []string{"mcp", "logger", EnvoyProxyContainerName, ClientRegistrationContainerName}
+	if got := containerNames(template.Spec.Containers); !equality.Semantic.DeepEqual(got, want) {
+		t.Errorf("containers = %v, want %v", got, want)
+	}
+	if got := template.Spec.Volumes[0].Name; got != "data" {
+		t.Errorf("first volume = %q, want the user volume first", got)
+	}
+	if env := template.Spec.Containers[0].Env; env[0].Name != "B" {
+		t.Errorf("user container env reordered: %v", env)
+	}
+	envoyEnv := template.Spec.Containers[2].Env
+	if envoyEnv[len(envoyEnv)-1].Name != "ZZZ" {
+		t.Errorf("envoy env not sorted: %v", envoyEnv)
+	}
+	wantMarker := EnvoyProxyContainerName + "," + ClientRegistrationContainerName
+	if got := template.Annotations[AnnotationInjectedSidecars]; got != wantMarker {
+		t.Errorf("%s = %q, want %q", AnnotationInjectedSidecars, got, wantMarker)
+	}
+
+	// A second pass changes nothing
+	again := template.DeepCopy()
+	NormalizeInjectedPodTemplate(again)
+	if !equality.Semantic.DeepEqual(again, template) {
+		t.Error("NormalizeInjectedPodTemplate is not idempotent")
+	}
+}
+
+func TestNormalizeInjectedPodTemplate_NothingInjected(t *testing.T) {
+	template := &corev1.PodTemplateSpec{Spec: corev1.PodSpec{Containers: []corev1.Container{{Name: "mcp"}}}}
+	template.Annotations = map[string]string{AnnotationInjectedSidecars: EnvoyProxyContainerName}
+
+	NormalizeInjectedPodTemplate(template)
+
+	if _, ok := template.Annotations[AnnotationInjectedSidecars]; ok {
+		t.Error("stale marker kept on a template without sidecars")
+	}
+}
@@ -0,0 +1,118 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package injector
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+
+	"github.com/kagenti/kagenti-extensions/kagenti-webhook/internal/webhook/config"
+)
+
+// PodLimitsRejection is the Rejection of a pod that would exceed the
+// podLimits policy once injected.
+type PodLimitsRejection struct {
+	Reasons []string
+}
+
+func (e *PodLimitsRejection) Reason() string {
+	return "pod-limits"
+}
+
+func (e *PodLimitsRejection) Error() string {
+	return "AuthBridge cannot be injected: " + strings.Join(e.Reasons, "; ") +
+		" (podLimits of the platform config)"
+}
+
+// checkPodLimits returns why an injected pod exceeds policy, if it does.
+func checkPodLimits(podSpec *corev1.PodSpec, policy config.PodLimitsPolicy) []string {
+	var reasons []string
+	if containers := len(podSpec.Containers) + len(podSpec.InitContainers); policy.MaxContainers > 0 && containers > policy.MaxContainers {
+		reasons = append(reasons, fmt.Sprintf("the pod would have %d containers, more than %d", containers, policy.MaxContainers))
+	}
+	requests := PodRequests(podSpec)
+	names := make([]string, 0, len(policy.MaxRequests))
+	for name := range policy.MaxRequests {
+		names = append(names, string(name))
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		limit := policy.MaxRequests[corev1.ResourceName(name)]
+		if request, ok := requests[corev1.ResourceName(name)]; ok && request.Cmp(limit) > 0 {
+			reasons = append(reasons, fmt.Sprintf("the pod would request %s %s, more than %s", request.String(), name, limit.String()))
+		}
+	}
+	return reasons
+}
+
+// PodLimitsWarnings returns the admission warnings for an injected pod that
+// exceeds the podLimits policy with action warn.
+func PodLimitsWarnings(podSpec *corev1.PodSpec, policy config.PodLimitsPolicy) []string {
+	if policy.Action != config.PodLimitsWarn {
+		return nil
+	}
+	var warnings []string
+	for _, reason := range checkPodLimits(podSpec, policy) {
+		warnings = append(warnings, reason+" (podLimits of the platform config)")
+	}
+	return warnings
+}
+
+// PodRequests returns the effective resource requests of a pod, as the
+// scheduler computes them: the larger of the containers' total, native
+// sidecars (init containers with restartPolicy Always) included, and each
+// other init container's own requests plus those of the sidecars started
+// before it. Pod overhead is not included.
+func PodRequests(podSpec *corev1.PodSpec) corev1.ResourceList {
+	total := corev1.ResourceList{}
+	for _, c := range podSpec.Containers {
+		addRequests(total, c.Resources.Requests)
+	}
+	sidecars := corev1.ResourceList{}
+	initPeak := corev1.ResourceList{}
+	for _, c := range podSpec.InitContainers {
+		if c.RestartPolicy != nil && *c.RestartPolicy == corev1.ContainerRestartPolicyAlways {
+			addRequests(sidecars, c.Resources.Requests)
+			addRequests(total, c.Resources.Requests)
+			continue
+		}
+		running := sidecars.DeepCopy()
+		addRequests(running, c.Resources.Requests)
+		for name, quantity := range running {
+			if peak, ok := initPeak[name]; !ok || quantity.Cmp(peak) > 0 {
+				initPeak[name] = quantity
+			}
+		}
+	}
+	for name, quantity := range initPeak {
+		if sum, ok := total[name]; !ok || quantity.Cmp(sum) > 0 {
+			total[name] = quantity
+		}
+	}
+	return total
+}
+
+func addRequests(dst, src corev1.ResourceList) {
+	for name, quantity := range src {
+		sum := dst[name]
+		sum.Add(quantity)
+		dst[name] = sum
+	}
+}
@@ -0,0 +1,117 @@
+package injector
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/kagenti/kagenti-extensions/kagenti-webhook/internal/webhook/config"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestInjectAuthBridge_PodLimits(t *testing.T) {
+	app := corev1.Container{Name: "app", Resources: corev1.ResourceRequirements{
+		Requests: corev1.ResourceList{corev1.ResourceMemory: resource.MustParse("1Gi")},
+	}}
+	tests := []struct {
+		name         string
+		policy       config.PodLimitsPolicy
+		wantRejected bool
+		wantWarnings int
+	}{
+		{name: "unlimited"},
+		{name: "within limits", policy: config.PodLimitsPolicy{
+			MaxContainers: 10,
+			MaxRequests:   corev1.ResourceList{corev1.ResourceMemory: resource.MustParse("4Gi")},
+		}},
+		{name: "too many containers", policy: config.PodLimitsPolicy{MaxContainers: 2}, wantRejected: true},
+		{name: "too much memory", policy: config.PodLimitsPolicy{
+			MaxRequests: corev1.ResourceList{corev1.ResourceMemory: resource.MustParse("1Gi")},
+		}, wantRejected: true},
+		{name: "warned", policy: config.PodLimitsPolicy{
+			MaxContainers: 2,
+			MaxRequests:   corev1.ResourceList{corev1.ResourceMemory: resource.MustParse("1Gi")},
+			Action:        config.PodLimitsWarn,
+		}, wantWarnings: 2},
+	}
+	ns := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "team1", Labels: map[string]string{"kagenti-enabled": "true"}}}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := config.CompiledDefaults()
+			cfg.PodLimits = tt.policy
+			m := NewPodMutator(fake.NewClientBuilder().WithObjects(ns).Build(), true,
+				func() *config.PlatformConfig { return cfg }, config.DefaultFeatureGates)
+
+			podSpec := corev1.PodSpec{Containers: []corev1.Container{app}}
+			mutated, err := m.InjectAuthBridge(context.Background(), &podSpec, "team1", "weather", map[string]string{KagentiTypeLabel: KagentiTypeAgent})
+
+			var rejection *PodLimitsRejection
+			if tt.wantRejected {
+				if !errors.As(err, &rejection) || mutated {
+					t.Fatalf("mutated = %t, err = %v, want a rejection", mutated, err)
+				}
+				if len(podSpec.Containers) != 1 || len(podSpec.InitContainers) != 0 || len(podSpec.Volumes) != 0 {
+					t.Errorf("rejected pod was modified: %+v", podSpec)
+				}
+				return
+			}
+			if err != nil || !mutated {
+				t.Fatalf("mutated = %t, err = %v", mutated, err)
+			}
+			if got := PodLimitsWarnings(&podSpec, cfg.PodLimits); len(got) != tt.wantWarnings {
+				t.Errorf("warnings = %q, want %d", got, tt.wantWarnings)
+			}
+		})
+	}
+}
+
+func TestPodRequests(t *testing.T) {
+	container := func(cpu string, restartAlways bool) corev1.Container {
+		c := corev1.Container{Resources: corev1.ResourceRequirements{
+			Requests: corev1.ResourceList{corev1.ResourceCPU: resource.MustParse(cpu)},
+		}}
+		if restartAlways {
+			c.RestartPolicy = ptr.To(corev1.ContainerRestartPolicyAlways)
+		}
+		return c
+	}
+	tests := []struct {
+		name    string
+		podSpec corev1.PodSpec
+		want    string
+	}{
+		{
+			name:    "containers add up",
+			podSpec: corev1.PodSpec{Containers: []corev1.Container{container("100m", false), container("250m", false)}},
+			want:    "350m",
+		},
+		{
+			name: "native sidecars run alongside the containers",
+			podSpec: corev1.PodSpec{
+				InitContainers: []corev1.Container{container("50m", true)},
+				Containers:     []corev1.Container{container("100m", false)},
+			},
+			want: "150m",
+		},
+		{
+			name: "a large init container dominates",
+			podSpec: corev1.PodSpec{
+				InitContainers: []corev1.Container{container("50m", true), container("500m", false)},
+				Containers:     []corev1.Container{container("100m", false)},
+			},
+			want: "550m",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := PodRequests(&tt.podSpec)[corev1.ResourceCPU]
+			if want := resource.MustParse(tt.want); got.Cmp(want) != 0 {
+				t.Errorf("cpu = %s, want %s", got.String(), tt.want)
+			}
+		})
+	}
+}
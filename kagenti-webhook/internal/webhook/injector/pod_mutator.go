@@ -66,6 +66,23 @@ type PodMutator struct {
 	// Getter functions for hot-reloadable config (used by precedence evaluator)
 	GetPlatformConfig func() *config.PlatformConfig
 	GetFeatureGates   func() *config.FeatureGates
+	// DecisionPublisher, when set, receives every AuthBridge injection decision
+	DecisionPublisher DecisionPublisher
+	// TokenExchanges, when set, supplies the TokenExchange bindings whose
+	// overrides form layer 5 of the precedence chain; nil skips that layer.
+	// Not yet set in production: there is no TokenExchange CRD to list.
+	TokenExchanges TokenExchangeLister
+}
+
+// TokenExchangeLister lists the TokenExchange bindings of a namespace.
+type TokenExchangeLister interface {
+	ListTokenExchangeBindings(ctx context.Context, namespace string) ([]TokenExchangeBinding, error)
+}
+
+// DecisionPublisher records injection decisions outside the webhook (e.g. audit sinks).
+// Implementations must not block.
+type DecisionPublisher interface {
+	PublishDecision(namespace, workload string, labels map[string]string, decision InjectionDecision)
 }
 
 func NewPodMutator(
@@ -86,6 +103,26 @@ func NewPodMutator(
 	}
 }
 
+// tokenExchangeOverrides returns the overrides of the TokenExchange binding
+// that applies to the workload, or nil when none does or no lister is set.
+func (m *PodMutator) tokenExchangeOverrides(ctx context.Context, namespace, workload string, labels map[string]string) (*TokenExchangeOverrides, error) {
+	if m.TokenExchanges == nil {
+		return nil, nil
+	}
+	bindings, err := m.TokenExchanges.ListTokenExchangeBindings(ctx, namespace)
+	if err != nil {
+		return nil, err
+	}
+	overrides, binding, err := ResolveTokenExchangeOverrides(bindings, namespace, workload, labels)
+	if err != nil {
+		return nil, err
+	}
+	if overrides != nil {
+		mutatorLog.Info("TokenExchange applies", "namespace", namespace, "crName", workload, "tokenExchange", binding)
+	}
+	return overrides, nil
+}
+
 // DEPRECATED, used by Agent and MCPServer CRs. Remove ShouldMutate after both CRs are deleted and use InjectAuthBridge instead.
 
 // main entry point for pod mutations
@@ -154,9 +191,30 @@ func (m *PodMutator) InjectAuthBridge(ctx context.Context, podSpec *corev1.PodSp
 	currentConfig := m.GetPlatformConfig()
 	currentGates := m.GetFeatureGates()
 
+	overrides, err := m.tokenExchangeOverrides(ctx, namespace, crName, labels)
+	if err != nil {
+		mutatorLog.Error(err, "Failed to resolve TokenExchange overrides", "namespace", namespace, "crName", crName)
+		return false, fmt.Errorf("failed to resolve TokenExchange overrides: %w", err)
+	}
+
 	// Evaluate the precedence chain
 	evaluator := NewPrecedenceEvaluator(currentGates, currentConfig)
-	decision := evaluator.Evaluate(ns.Labels, labels, nil)
+	decision := evaluator.Evaluate(ns.Labels, labels, overrides)
+
+	// hostNetwork and shareProcessNamespace pods are rejected or adapted
+	if decision.AnyInjected() {
+		var sidecarPorts []corev1.ContainerPort
+		if decision.EnvoyProxy.Inject && !containerExists(podSpec.Containers, EnvoyProxyContainerName) {
+			sidecarPorts = NewContainerBuilder(currentConfig).envoyProxyPorts()
+		}
+		skipProxyInit, rejection := checkPodNamespaces(podSpec, currentConfig.PodNamespaces, sidecarPorts)
+		if rejection != nil {
+			return false, m.reject(namespace, crName, labels, decision, rejection)
+		}
+		if skipProxyInit && decision.ProxyInit.Inject {
+			decision.ProxyInit = SidecarDecision{Inject: false, Reason: "hostNetwork pod, no interception", Layer: "pod-namespaces"}
+		}
+	}
 
 	// Log each sidecar decision
 	for _, d := range []struct {
@@ -178,11 +236,15 @@ func (m *PodMutator) InjectAuthBridge(ctx context.Context, podSpec *corev1.PodSp
 
 	if !decision.AnyInjected() {
 		mutatorLog.Info("Skipping mutation (no sidecars to inject)", "namespace", namespace, "crName", crName)
+		m.publishDecision(namespace, crName, labels, decision)
 		return false, nil
 	}
 
 	spireEnabled := IsSpireEnabled(labels)
 
+	// Kept to undo the injection if the pod ends up too large
+	original := podSpec.DeepCopy()
+
 	// Initialize slices
 	if podSpec.Containers == nil {
 		podSpec.Containers = []corev1.Container{}
@@ -195,11 +257,16 @@ func (m *PodMutator) InjectAuthBridge(ctx context.Context, podSpec *corev1.PodSp
 	}
 
 	// Build containers using fresh config (picks up hot-reloaded images/resources)
-	builder := NewContainerBuilder(currentConfig)
+	// with the images pinned for the namespace's environment, if any
+	builder := NewContainerBuilder(pinnedConfig(currentConfig, namespace, ns.Labels))
 
 	// Conditionally inject sidecars based on precedence decisions
 	if decision.EnvoyProxy.Inject && !containerExists(podSpec.Containers, EnvoyProxyContainerName) {
-		podSpec.Containers = append(podSpec.Containers, builder.BuildEnvoyProxyContainer())
+		envoy := builder.BuildEnvoyProxyContainer()
+		if podSpec.HostNetwork {
+			bindHostPorts(&envoy)
+		}
+		podSpec.Containers = append(podSpec.Containers, envoy)
 	}
 
 	if decision.ProxyInit.Inject && !containerExists(podSpec.InitContainers, ProxyInitContainerName) {
@@ -214,6 +281,31 @@ func (m *PodMutator) InjectAuthBridge(ctx context.Context, podSpec *corev1.PodSp
 		podSpec.Containers = append(podSpec.Containers, builder.BuildClientRegistrationContainerWithSpireOption(crName, namespace, spireEnabled))
 	}
 
+	// Keep the pod off nodes the sidecar images cannot run on
+	var sidecars []string
+	for _, d := range []struct {
+		name string
+		sd   SidecarDecision
+	}{
+		{EnvoyProxyContainerName, decision.EnvoyProxy},
+		{ProxyInitContainerName, decision.ProxyInit},
+		{SpiffeHelperContainerName, decision.SpiffeHelper},
+		{ClientRegistrationContainerName, decision.ClientRegistration},
+	} {
+		if d.sd.Inject {
+			sidecars = append(sidecars, d.name)
+		}
+	}
+	if rejection := applyScheduling(podSpec, currentConfig.Scheduling, sidecars); rejection != nil {
+		*podSpec = *original
+		return false, m.reject(namespace, crName, labels, decision, rejection)
+	}
+
+	// Keep app probes working once inbound traffic is intercepted
+	applyProbeHandling(podSpec, currentConfig.Proxy.ProbeMode)
+
+	MountTrustBundle(podSpec, currentConfig.TrustBundle)
+
 	// Inject volumes — use SPIRE volumes when spireEnabled because both
 	// spiffe-helper AND client-registration mount svid-output in that mode.
 	var requiredVolumes []corev1.Volume
@@ -228,14 +320,35 @@ func (m *PodMutator) InjectAuthBridge(ctx context.Context, podSpec *corev1.PodSp
 		}
 	}
 
+	// Pods too large once injected are rejected or warned about
+	if reasons := checkPodLimits(podSpec, currentConfig.PodLimits); len(reasons) > 0 && currentConfig.PodLimits.Action != config.PodLimitsWarn {
+		*podSpec = *original
+		return false, m.reject(namespace, crName, labels, decision, &PodLimitsRejection{Reasons: reasons})
+	}
+
 	mutatorLog.Info("Successfully mutated pod spec", "namespace", namespace, "crName", crName,
 		"containers", len(podSpec.Containers),
 		"initContainers", len(podSpec.InitContainers),
 		"volumes", len(podSpec.Volumes),
 		"spireEnabled", spireEnabled)
+	m.publishDecision(namespace, crName, labels, decision)
 	return true, nil
 }
 
+// reject logs and publishes the rejection of a workload and returns it as the
+// error of InjectAuthBridge.
+func (m *PodMutator) reject(namespace, crName string, labels map[string]string, decision InjectionDecision, rejection Rejection) error {
+	mutatorLog.Info("Rejecting injection", "namespace", namespace, "crName", crName, "reason", rejection.Error())
+	m.publishDecision(namespace, crName, labels, decision.Rejected(rejection))
+	return rejection
+}
+
+func (m *PodMutator) publishDecision(namespace, crName string, labels map[string]string, decision InjectionDecision) {
+	if m.DecisionPublisher != nil {
+		m.DecisionPublisher.PublishDecision(namespace, crName, labels, decision)
+	}
+}
+
 // DEPRECATED, used by Agent and MCPServer CRs. Remove ShouldMutate after both CRs are deleted and use NeedsMutation instead.
 
 // determines if pod mutation should occur based on annotations and namespace labels
@@ -300,8 +413,8 @@ func (m *PodMutator) NeedsMutation(ctx context.Context, namespace string, labels
 	}
 
 	// No label - fall back to namespace-level settings
-	mutatorLog.Info("Checking namespace-level injection settings", "namespace", namespace, "label", m.NamespaceLabel)
-	return IsNamespaceInjectionEnabled(ctx, m.Client, namespace, m.NamespaceLabel)
+	mutatorLog.Info("Checking namespace-level injection settings", "namespace", namespace)
+	return IsNamespaceInjectionEnabled(ctx, m.Client, namespace, m.GetPlatformConfig())
 }
 func (m *PodMutator) InjectSidecars(podSpec *corev1.PodSpec, namespace, crName string) error {
 	// Default to SPIRE enabled for backward compatibility
@@ -0,0 +1,134 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package injector
+
+import (
+	"fmt"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+
+	"github.com/kagenti/kagenti-extensions/kagenti-webhook/internal/webhook/config"
+)
+
+// PodNamespacesRejection is the Rejection of a pod by the podNamespaces
+// policy.
+type PodNamespacesRejection struct {
+	Reasons []string
+}
+
+func (e *PodNamespacesRejection) Error() string {
+	return "AuthBridge cannot be injected: " + strings.Join(e.Reasons, "; ")
+}
+
+func (e *PodNamespacesRejection) Reason() string {
+	return "pod-namespaces"
+}
+
+const (
+	hostNetworkReason = "the pod uses hostNetwork, so proxy-init would redirect the node's traffic " +
+		"(set podNamespaces.hostNetwork: no-interception to inject without it)"
+	hostNetworkNoInterceptionWarning = "the pod uses hostNetwork: AuthBridge is injected without proxy-init, " +
+		"so traffic is not intercepted, and envoy-proxy's ports are host ports: the pod only schedules on nodes where they are free"
+	shareProcessNamespaceReason = "the pod sets shareProcessNamespace, so app containers can read " +
+		"the sidecars' client credentials through /proc"
+)
+
+// checkPodNamespaces applies the podNamespaces policy to a pod about to be
+// injected with sidecars listening on sidecarPorts. It returns a
+// *PodNamespacesRejection if the pod is rejected, and otherwise whether
+// proxy-init must be left out. A hostNetwork pod is also rejected when its
+// own containers use one of sidecarPorts, as both would bind the node's port.
+func checkPodNamespaces(podSpec *corev1.PodSpec, policy config.PodNamespacesPolicy, sidecarPorts []corev1.ContainerPort) (skipProxyInit bool, rejection Rejection) {
+	var reasons []string
+	if podSpec.HostNetwork {
+		if policy.HostNetwork == config.PodNamespacesNoInterception {
+			skipProxyInit = true
+			if collisions := hostPortCollisions(podSpec, sidecarPorts); len(collisions) > 0 {
+				reasons = append(reasons, "the pod uses hostNetwork and its containers use the sidecar ports "+
+					strings.Join(collisions, ", ")+" on the node")
+			}
+		} else {
+			reasons = append(reasons, hostNetworkReason)
+		}
+	}
+	if podSpec.ShareProcessNamespace != nil && *podSpec.ShareProcessNamespace &&
+		policy.ShareProcessNamespace == config.PodNamespacesReject {
+		reasons = append(reasons, shareProcessNamespaceReason)
+	}
+	if len(reasons) > 0 {
+		return false, &PodNamespacesRejection{Reasons: reasons}
+	}
+	return skipProxyInit, nil
+}
+
+// hostPortCollisions lists the sidecarPorts that containers of a hostNetwork
+// pod already declare, as "port/protocol (name)".
+func hostPortCollisions(podSpec *corev1.PodSpec, sidecarPorts []corev1.ContainerPort) []string {
+	used := make(map[corev1.ContainerPort]bool)
+	for _, containers := range [][]corev1.Container{podSpec.InitContainers, podSpec.Containers} {
+		for _, c := range containers {
+			for _, p := range c.Ports {
+				used[corev1.ContainerPort{ContainerPort: hostNetworkPort(p), Protocol: portProtocol(p)}] = true
+			}
+		}
+	}
+	var collisions []string
+	for _, p := range sidecarPorts {
+		if used[corev1.ContainerPort{ContainerPort: p.ContainerPort, Protocol: portProtocol(p)}] {
+			collisions = append(collisions, fmt.Sprintf("%d/%s (%s)", p.ContainerPort, portProtocol(p), p.Name))
+		}
+	}
+	return collisions
+}
+
+// hostNetworkPort is the node port p binds in a hostNetwork pod, where host
+// and container ports are the same.
+func hostNetworkPort(p corev1.ContainerPort) int32 {
+	if p.HostPort != 0 {
+		return p.HostPort
+	}
+	return p.ContainerPort
+}
+
+func portProtocol(p corev1.ContainerPort) corev1.Protocol {
+	if p.Protocol == "" {
+		return corev1.ProtocolTCP
+	}
+	return p.Protocol
+}
+
+// bindHostPorts declares the ports of a sidecar in a hostNetwork pod as host
+// ports, so the scheduler only places the pod on nodes where they are free.
+func bindHostPorts(c *corev1.Container) {
+	for i := range c.Ports {
+		c.Ports[i].HostPort = c.Ports[i].ContainerPort
+	}
+}
+
+// PodNamespacesWarnings returns the admission warnings for an injected pod
+// whose namespaces the podNamespaces policy lets through.
+func PodNamespacesWarnings(podSpec *corev1.PodSpec) []string {
+	var warnings []string
+	if podSpec.HostNetwork {
+		warnings = append(warnings, hostNetworkNoInterceptionWarning)
+	}
+	if podSpec.ShareProcessNamespace != nil && *podSpec.ShareProcessNamespace {
+		warnings = append(warnings, shareProcessNamespaceReason)
+	}
+	return warnings
+}
@@ -0,0 +1,98 @@
+package injector
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/kagenti/kagenti-extensions/kagenti-webhook/internal/webhook/config"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestInjectAuthBridge_PodNamespaces(t *testing.T) {
+	tests := []struct {
+		name          string
+		policy        config.PodNamespacesPolicy
+		podSpec       corev1.PodSpec
+		appPorts      []corev1.ContainerPort
+		wantRejected  bool
+		wantProxyInit bool
+		wantHostPorts bool
+		wantWarnings  int
+	}{
+		{name: "plain pod", wantProxyInit: true},
+		{name: "hostNetwork rejected by default", podSpec: corev1.PodSpec{HostNetwork: true}, wantRejected: true},
+		{
+			name:          "hostNetwork without interception",
+			policy:        config.PodNamespacesPolicy{HostNetwork: config.PodNamespacesNoInterception},
+			podSpec:       corev1.PodSpec{HostNetwork: true},
+			appPorts:      []corev1.ContainerPort{{ContainerPort: 8000}, {ContainerPort: 9090, Protocol: corev1.ProtocolUDP}},
+			wantHostPorts: true,
+			wantWarnings:  1,
+		},
+		{
+			name:         "hostNetwork without interception on envoy's port",
+			policy:       config.PodNamespacesPolicy{HostNetwork: config.PodNamespacesNoInterception},
+			podSpec:      corev1.PodSpec{HostNetwork: true},
+			appPorts:     []corev1.ContainerPort{{ContainerPort: 9090}},
+			wantRejected: true,
+		},
+		{
+			name:          "shareProcessNamespace warned by default",
+			podSpec:       corev1.PodSpec{ShareProcessNamespace: ptr.To(true)},
+			wantProxyInit: true,
+			wantWarnings:  1,
+		},
+		{
+			name:         "shareProcessNamespace rejected",
+			policy:       config.PodNamespacesPolicy{ShareProcessNamespace: config.PodNamespacesReject},
+			podSpec:      corev1.PodSpec{ShareProcessNamespace: ptr.To(true)},
+			wantRejected: true,
+		},
+	}
+	ns := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "team1", Labels: map[string]string{"kagenti-enabled": "true"}}}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := config.CompiledDefaults()
+			cfg.PodNamespaces = tt.policy
+			m := NewPodMutator(fake.NewClientBuilder().WithObjects(ns).Build(), true,
+				func() *config.PlatformConfig { return cfg }, config.DefaultFeatureGates)
+
+			podSpec := tt.podSpec
+			podSpec.Containers = []corev1.Container{{Name: "app", Ports: tt.appPorts}}
+			mutated, err := m.InjectAuthBridge(context.Background(), &podSpec, "team1", "weather", map[string]string{KagentiTypeLabel: KagentiTypeAgent})
+
+			var rejection *PodNamespacesRejection
+			if tt.wantRejected {
+				if !errors.As(err, &rejection) || mutated {
+					t.Fatalf("mutated = %t, err = %v, want a rejection", mutated, err)
+				}
+				if len(podSpec.Containers) != 1 {
+					t.Errorf("rejected pod was modified: %v", podSpec.Containers)
+				}
+				return
+			}
+			if err != nil || !mutated {
+				t.Fatalf("mutated = %t, err = %v", mutated, err)
+			}
+			if got := findContainer(podSpec.InitContainers, ProxyInitContainerName) != nil; got != tt.wantProxyInit {
+				t.Errorf("proxy-init injected = %t, want %t", got, tt.wantProxyInit)
+			}
+			envoy := findContainer(podSpec.Containers, EnvoyProxyContainerName)
+			if envoy == nil {
+				t.Fatal("envoy-proxy not injected")
+			}
+			for _, p := range envoy.Ports {
+				if got := p.HostPort == p.ContainerPort; got != tt.wantHostPorts {
+					t.Errorf("envoy-proxy port %s hostPort = %d, want host ports %t", p.Name, p.HostPort, tt.wantHostPorts)
+				}
+			}
+			if got := PodNamespacesWarnings(&podSpec); len(got) != tt.wantWarnings {
+				t.Errorf("warnings = %q, want %d", got, tt.wantWarnings)
+			}
+		})
+	}
+}
@@ -12,7 +12,7 @@ import (
 //  2. Per-sidecar feature gate
 //  3. Namespace label (kagenti-enabled=true)
 //  4. Workload label (kagenti.io/<sidecar>-inject=false)
-//  5. TokenExchange CR override (stub — not yet implemented)
+//  5. TokenExchange CR override (stub — not yet implemented; no lister is set)
 //  6. Platform defaults (sidecars.<sidecar>.enabled)
 type PrecedenceEvaluator struct {
 	featureGates   *config.FeatureGates
@@ -44,7 +44,7 @@ func (e *PrecedenceEvaluator) Evaluate(
 	workloadLabels map[string]string,
 	tokenExchangeOverrides *TokenExchangeOverrides,
 ) InjectionDecision {
-	namespaceOptedIn := namespaceLabels[LabelNamespaceInject] == "true"
+	namespaceOptedIn := NamespaceOptedIn(namespaceLabels, e.platformConfig)
 
 	// Resolve per-sidecar TokenExchange overrides
 	var teEnvoy, teSpiffe, teClientReg *bool
@@ -121,7 +121,7 @@ func (e *PrecedenceEvaluator) evaluateSidecar(
 	if !namespaceOptedIn {
 		return SidecarDecision{
 			Inject: false,
-			Reason: "namespace not opted in (missing " + LabelNamespaceInject + "=true)",
+			Reason: "namespace not opted in (" + LabelNamespaceInject + " not true/enabled and no namespaces.selector match)",
 			Layer:  "namespace",
 		}
 	}
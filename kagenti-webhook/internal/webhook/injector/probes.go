@@ -0,0 +1,174 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package injector
+
+import (
+	"fmt"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+
+	"github.com/kagenti/kagenti-extensions/kagenti-webhook/internal/webhook/config"
+)
+
+const (
+	// InboundProbePathsEnv lists "port:path" pairs the envoy-proxy's inbound
+	// ext_proc lets through without a token (allow-paths mode).
+	InboundProbePathsEnv = "INBOUND_PROBE_PATHS"
+	// InboundPortsExcludeEnv lists ports proxy-init leaves out of inbound
+	// redirection (exclude-ports mode).
+	InboundPortsExcludeEnv = "INBOUND_PORTS_EXCLUDE"
+)
+
+// appProbes collects the probe endpoints of the workload's own containers.
+// HTTP probes contribute "port:path" pairs; TCP and gRPC probes only ports.
+// Probes with an explicit host or an unresolvable named port are skipped.
+func appProbes(podSpec *corev1.PodSpec) (httpPaths []string, ports []int32) {
+	for i := range podSpec.Containers {
+		c := &podSpec.Containers[i]
+		if injectedSidecarNames[c.Name] {
+			continue
+		}
+		for _, probe := range []*corev1.Probe{c.LivenessProbe, c.ReadinessProbe, c.StartupProbe} {
+			if probe == nil {
+				continue
+			}
+			switch {
+			case probe.HTTPGet != nil:
+				if probe.HTTPGet.Host != "" {
+					continue
+				}
+				port, ok := resolveProbePort(c, probe.HTTPGet.Port)
+				if !ok {
+					continue
+				}
+				path := probe.HTTPGet.Path
+				if u, err := url.Parse(path); err == nil {
+					path = u.Path
+				}
+				if path == "" {
+					path = "/"
+				}
+				httpPaths = appendUnique(httpPaths, fmt.Sprintf("%d:%s", port, path))
+				ports = appendUniquePort(ports, port)
+			case probe.TCPSocket != nil:
+				if port, ok := resolveProbePort(c, probe.TCPSocket.Port); ok {
+					ports = appendUniquePort(ports, port)
+				}
+			case probe.GRPC != nil:
+				ports = appendUniquePort(ports, probe.GRPC.Port)
+			}
+		}
+	}
+	return httpPaths, ports
+}
+
+// resolveProbePort resolves numeric and named probe ports against the
+// container's declared ports.
+func resolveProbePort(c *corev1.Container, port intstr.IntOrString) (int32, bool) {
+	if port.Type == intstr.Int {
+		return port.IntVal, port.IntVal > 0
+	}
+	for _, p := range c.Ports {
+		if p.Name == port.StrVal {
+			return p.ContainerPort, true
+		}
+	}
+	if n, err := strconv.Atoi(port.StrVal); err == nil && n > 0 {
+		return int32(n), true
+	}
+	return 0, false
+}
+
+// applyProbeHandling keeps app probes working behind inbound interception,
+// according to the platform's proxy.probeMode. It must run after the
+// envoy-proxy and proxy-init containers were added.
+func applyProbeHandling(podSpec *corev1.PodSpec, mode string) {
+	if mode == "" {
+		return
+	}
+	httpPaths, ports := appProbes(podSpec)
+
+	switch mode {
+	case config.ProbeModeAllowPaths:
+		if len(httpPaths) == 0 {
+			return
+		}
+		if c := findContainer(podSpec.Containers, EnvoyProxyContainerName); c != nil {
+			mergeEnvList(c, InboundProbePathsEnv, httpPaths)
+			mutatorLog.Info("Allowing app probe paths through inbound validation", "paths", httpPaths)
+		}
+	case config.ProbeModeExcludePorts:
+		if len(ports) == 0 {
+			return
+		}
+		values := make([]string, 0, len(ports))
+		for _, p := range ports {
+			values = append(values, strconv.Itoa(int(p)))
+		}
+		if c := findContainer(podSpec.InitContainers, ProxyInitContainerName); c != nil {
+			mergeEnvList(c, InboundPortsExcludeEnv, values)
+			mutatorLog.Info("Excluding app probe ports from inbound redirection", "ports", values)
+		}
+	}
+}
+
+// mergeEnvList adds values to a comma-separated env var, creating it if needed.
+func mergeEnvList(c *corev1.Container, name string, values []string) {
+	for i := range c.Env {
+		if c.Env[i].Name != name {
+			continue
+		}
+		var merged []string
+		if c.Env[i].Value != "" {
+			merged = strings.Split(c.Env[i].Value, ",")
+		}
+		for _, v := range values {
+			merged = appendUnique(merged, v)
+		}
+		c.Env[i].Value = strings.Join(merged, ",")
+		return
+	}
+	c.Env = append(c.Env, corev1.EnvVar{Name: name, Value: strings.Join(values, ",")})
+}
+
+func findContainer(containers []corev1.Container, name string) *corev1.Container {
+	for i := range containers {
+		if containers[i].Name == name {
+			return &containers[i]
+		}
+	}
+	return nil
+}
+
+func appendUnique(list []string, v string) []string {
+	if slices.Contains(list, v) {
+		return list
+	}
+	return append(list, v)
+}
+
+func appendUniquePort(list []int32, v int32) []int32 {
+	if slices.Contains(list, v) {
+		return list
+	}
+	return append(list, v)
+}
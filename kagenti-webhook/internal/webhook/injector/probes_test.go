@@ -0,0 +1,87 @@
+package injector
+
+import (
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+
+	"github.com/kagenti/kagenti-extensions/kagenti-webhook/internal/webhook/config"
+)
+
+func probedPodSpec() *corev1.PodSpec {
+	builder := NewContainerBuilder(nil)
+	return &corev1.PodSpec{
+		InitContainers: []corev1.Container{builder.BuildProxyInitContainer()},
+		Containers: []corev1.Container{
+			{
+				Name:  "app",
+				Ports: []corev1.ContainerPort{{Name: "http", ContainerPort: 8000}},
+				LivenessProbe: &corev1.Probe{ProbeHandler: corev1.ProbeHandler{
+					HTTPGet: &corev1.HTTPGetAction{Path: "/healthz?verbose=1", Port: intstr.FromString("http")},
+				}},
+				ReadinessProbe: &corev1.Probe{ProbeHandler: corev1.ProbeHandler{
+					HTTPGet: &corev1.HTTPGetAction{Path: "/readyz", Port: intstr.FromInt32(8000)},
+				}},
+				StartupProbe: &corev1.Probe{ProbeHandler: corev1.ProbeHandler{
+					TCPSocket: &corev1.TCPSocketAction{Port: intstr.FromInt32(9000)},
+				}},
+			},
+			{
+				Name: "worker",
+				LivenessProbe: &corev1.Probe{ProbeHandler: corev1.ProbeHandler{
+					// Unresolvable named port is skipped
+					HTTPGet: &corev1.HTTPGetAction{Path: "/live", Port: intstr.FromString("missing")},
+				}},
+				ReadinessProbe: &corev1.Probe{ProbeHandler: corev1.ProbeHandler{
+					GRPC: &corev1.GRPCAction{Port: 9090},
+				}},
+			},
+			builder.BuildEnvoyProxyContainer(),
+		},
+	}
+}
+
+func TestApplyProbeHandling(t *testing.T) {
+	tests := []struct {
+		name        string
+		mode        string
+		wantPaths   string
+		wantExclude string
+	}{
+		{name: "off", mode: ""},
+		{name: "allow paths", mode: config.ProbeModeAllowPaths, wantPaths: "8000:/healthz,8000:/readyz"},
+		{name: "exclude ports", mode: config.ProbeModeExcludePorts, wantExclude: "8000,9000,9090"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			podSpec := probedPodSpec()
+			applyProbeHandling(podSpec, tt.mode)
+
+			envoy := findContainer(podSpec.Containers, EnvoyProxyContainerName)
+			paths, _ := envValue(envoy.Env, InboundProbePathsEnv)
+			if paths != tt.wantPaths {
+				t.Errorf("%s = %q, want %q", InboundProbePathsEnv, paths, tt.wantPaths)
+			}
+			proxyInit := findContainer(podSpec.InitContainers, ProxyInitContainerName)
+			exclude, _ := envValue(proxyInit.Env, InboundPortsExcludeEnv)
+			if exclude != tt.wantExclude {
+				t.Errorf("%s = %q, want %q", InboundPortsExcludeEnv, exclude, tt.wantExclude)
+			}
+
+			// The app's probes themselves are never modified
+			if got := podSpec.Containers[0].ReadinessProbe.HTTPGet.Port; got != intstr.FromInt32(8000) {
+				t.Errorf("app probe was modified: %v", got)
+			}
+		})
+	}
+}
+
+func TestMergeEnvList(t *testing.T) {
+	c := &corev1.Container{Env: []corev1.EnvVar{{Name: InboundPortsExcludeEnv, Value: "22,8000"}}}
+	mergeEnvList(c, InboundPortsExcludeEnv, []string{"8000", "9000"})
+	if got, _ := envValue(c.Env, InboundPortsExcludeEnv); got != "22,8000,9000" {
+		t.Errorf("merged value = %q", got)
+	}
+}
@@ -0,0 +1,100 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package injector
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"runtime/debug"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/kagenti/kagenti-extensions/kagenti-webhook/internal/webhook/config"
+)
+
+// AnnotationInjection records on a pod template which webhook build and
+// configuration injected it, so pods generated from the template by an
+// operator (e.g. toolhive's for MCPServers) can be traced back to the
+// defaulting that produced them. Its value is an InjectionRecord as JSON.
+const AnnotationInjection = "kagenti.io/injection"
+
+// WebhookVersion is the webhook's release, set at build time with
+//
+//	-ldflags "-X github.com/kagenti/kagenti-extensions/kagenti-webhook/internal/webhook/injector.WebhookVersion=v0.4.2"
+//
+// When unset, the module version from the build info is used.
+var WebhookVersion = ""
+
+// InjectionRecord is the value of AnnotationInjection.
+type InjectionRecord struct {
+	WebhookVersion string `json:"webhookVersion"`
+	// ConfigHash identifies the platform config and feature gates in effect
+	ConfigHash string `json:"configHash"`
+	// Containers are the injected containers and init containers, sorted
+	Containers []string `json:"containers"`
+}
+
+// webhookVersion returns WebhookVersion, or the main module's version.
+func webhookVersion() string {
+	if WebhookVersion != "" {
+		return WebhookVersion
+	}
+	if info, ok := debug.ReadBuildInfo(); ok && info.Main.Version != "" {
+		return info.Main.Version
+	}
+	return "(devel)"
+}
+
+// ConfigHash returns a short digest of the platform config and feature gates.
+// Equal configurations hash equally across webhook replicas and restarts.
+func ConfigHash(cfg *config.PlatformConfig, gates *config.FeatureGates) string {
+	// Struct fields are encoded in order and map keys sorted, so the
+	// encoding is deterministic
+	data, err := json.Marshal(struct {
+		Config       *config.PlatformConfig `json:"config"`
+		FeatureGates *config.FeatureGates   `json:"featureGates"`
+	}{cfg, gates})
+	if err != nil {
+		return ""
+	}
+	sum := sha256.Sum256(data)
+	return "sha256:" + hex.EncodeToString(sum[:8])
+}
+
+// RecordInjection sets AnnotationInjection on a template normalized by
+// NormalizeInjectedPodTemplate, or removes it if no sidecars were injected.
+func RecordInjection(template *corev1.PodTemplateSpec, cfg *config.PlatformConfig, gates *config.FeatureGates) {
+	injected := template.Annotations[AnnotationInjectedSidecars]
+	if injected == "" {
+		if template.Annotations != nil {
+			delete(template.Annotations, AnnotationInjection)
+		}
+		return
+	}
+	data, err := json.Marshal(InjectionRecord{
+		WebhookVersion: webhookVersion(),
+		ConfigHash:     ConfigHash(cfg, gates),
+		Containers:     strings.Split(injected, ","),
+	})
+	if err != nil {
+		return
+	}
+	metav1.SetMetaDataAnnotation(&template.ObjectMeta, AnnotationInjection, string(data))
+}
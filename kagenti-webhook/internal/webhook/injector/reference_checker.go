@@ -0,0 +1,112 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package injector
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// injectedSidecarNames are the containers whose environment references are
+// verified at admission time.
+var injectedSidecarNames = map[string]bool{
+	EnvoyProxyContainerName:         true,
+	ClientRegistrationContainerName: true,
+	SpiffeHelperContainerName:       true,
+}
+
+// CheckSidecarReferences verifies that every non-optional ConfigMap key
+// referenced by the injected sidecars' env exists in namespace. It returns
+// one human-readable warning per missing ConfigMap or key; lookups that fail
+// for other reasons are returned as an error.
+//
+// A missing reference does not block admission: the pod would otherwise start
+// and fail with CreateContainerConfigError, so surfacing it early is enough.
+func (m *PodMutator) CheckSidecarReferences(ctx context.Context, podSpec *corev1.PodSpec, namespace string) ([]string, error) {
+	// ConfigMap name -> container name -> required keys
+	required := make(map[string]map[string][]string)
+	for _, c := range podSpec.Containers {
+		if !injectedSidecarNames[c.Name] {
+			continue
+		}
+		for _, env := range c.Env {
+			if env.ValueFrom == nil || env.ValueFrom.ConfigMapKeyRef == nil {
+				continue
+			}
+			ref := env.ValueFrom.ConfigMapKeyRef
+			if ref.Optional != nil && *ref.Optional {
+				continue
+			}
+			if required[ref.Name] == nil {
+				required[ref.Name] = make(map[string][]string)
+			}
+			required[ref.Name][c.Name] = append(required[ref.Name][c.Name], ref.Key)
+		}
+	}
+
+	names := make([]string, 0, len(required))
+	for name := range required {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var warnings []string
+	for _, name := range names {
+		containers := sortedKeys(required[name])
+
+		cm := &corev1.ConfigMap{}
+		err := m.Client.Get(ctx, client.ObjectKey{Namespace: namespace, Name: name}, cm)
+		if apierrors.IsNotFound(err) {
+			warnings = append(warnings, fmt.Sprintf(
+				"ConfigMap %q not found in namespace %q; sidecar(s) %v will fail to start until it is created",
+				name, namespace, containers))
+			continue
+		}
+		if err != nil {
+			return warnings, fmt.Errorf("failed to get ConfigMap %s/%s: %w", namespace, name, err)
+		}
+
+		for _, container := range containers {
+			for _, key := range required[name][container] {
+				if _, ok := cm.Data[key]; ok {
+					continue
+				}
+				if _, ok := cm.BinaryData[key]; ok {
+					continue
+				}
+				warnings = append(warnings, fmt.Sprintf(
+					"ConfigMap %s/%s has no key %q required by sidecar %s",
+					namespace, name, key, container))
+			}
+		}
+	}
+	return warnings, nil
+}
+
+func sortedKeys(m map[string][]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,75 @@
+package injector
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func injectedPodSpec() *corev1.PodSpec {
+	builder := NewContainerBuilder(nil)
+	return &corev1.PodSpec{
+		Containers: []corev1.Container{
+			{Name: "app", Env: []corev1.EnvVar{{
+				Name: "APP_ONLY",
+				ValueFrom: &corev1.EnvVarSource{ConfigMapKeyRef: &corev1.ConfigMapKeySelector{
+					LocalObjectReference: corev1.LocalObjectReference{Name: "app-config"},
+					Key:                  "APP_ONLY",
+				}},
+			}}},
+			builder.BuildEnvoyProxyContainer(),
+			builder.BuildClientRegistrationContainerWithSpireOption("agent", "team1", false),
+		},
+	}
+}
+
+func TestCheckSidecarReferences(t *testing.T) {
+	environments := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: "environments", Namespace: "team1"},
+		Data: map[string]string{
+			"KEYCLOAK_REALM":          "demo",
+			"KEYCLOAK_ADMIN_USERNAME": "admin",
+			"KEYCLOAK_ADMIN_PASSWORD": "admin",
+		},
+	}
+	authbridgeConfig := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: "authbridge-config", Namespace: "team1"},
+		Data:       map[string]string{"ISSUER": "http://keycloak/realms/demo"},
+	}
+	partialEnvironments := environments.DeepCopy()
+	delete(partialEnvironments.Data, "KEYCLOAK_ADMIN_PASSWORD")
+
+	tests := []struct {
+		name    string
+		objects []client.Object
+		expect  []string
+	}{
+		{"all present", []client.Object{environments, authbridgeConfig}, nil},
+		{"environments missing", []client.Object{authbridgeConfig}, []string{`ConfigMap "environments" not found`}},
+		{"both missing", nil, []string{`"authbridge-config" not found`, `"environments" not found`}},
+		{"key missing", []client.Object{partialEnvironments, authbridgeConfig}, []string{`no key "KEYCLOAK_ADMIN_PASSWORD"`}},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			m := &PodMutator{Client: fake.NewClientBuilder().WithObjects(tc.objects...).Build()}
+			warnings, err := m.CheckSidecarReferences(context.Background(), injectedPodSpec(), "team1")
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if len(warnings) != len(tc.expect) {
+				t.Fatalf("expected %d warnings, got %v", len(tc.expect), warnings)
+			}
+			for i, want := range tc.expect {
+				if !strings.Contains(warnings[i], want) {
+					t.Errorf("warning %d = %q, want it to contain %q", i, warnings[i], want)
+				}
+			}
+		})
+	}
+}
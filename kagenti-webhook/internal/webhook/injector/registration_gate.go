@@ -0,0 +1,91 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package injector
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/utils/ptr"
+)
+
+// registrationGated are the sidecars run as native sidecars (init containers
+// with restartPolicy Always) to gate the app on client registration, in
+// start order: client-registration waits for spiffe-helper's SVID.
+var registrationGated = []string{SpiffeHelperContainerName, ClientRegistrationContainerName}
+
+// registrationStartupProbe succeeds once client-registration has written the
+// client secret. It allows five minutes per attempt; after that the kubelet
+// restarts client-registration, which registers again.
+func registrationStartupProbe() *corev1.Probe {
+	return &corev1.Probe{
+		ProbeHandler: corev1.ProbeHandler{
+			Exec: &corev1.ExecAction{Command: []string{"test", "-s", "/shared/client-secret.txt"}},
+		},
+		PeriodSeconds:    2,
+		FailureThreshold: 150,
+	}
+}
+
+// GateOnRegistration keeps the app containers from starting until client
+// registration has completed: spiffe-helper and client-registration become
+// native sidecars after the pod's other init containers, and
+// client-registration only counts as started once the client secret exists.
+// Native sidecars need Kubernetes 1.29 or later. Pod specs without a
+// client-registration container are left unchanged.
+func GateOnRegistration(podSpec *corev1.PodSpec) {
+	if !containerExists(podSpec.Containers, ClientRegistrationContainerName) {
+		return
+	}
+	var kept, gated []corev1.Container
+	for _, c := range podSpec.Containers {
+		switch c.Name {
+		case SpiffeHelperContainerName, ClientRegistrationContainerName:
+			gated = append(gated, c)
+		default:
+			kept = append(kept, c)
+		}
+	}
+	podSpec.Containers = kept
+	for _, name := range registrationGated {
+		for _, c := range gated {
+			if c.Name != name {
+				continue
+			}
+			c.RestartPolicy = ptr.To(corev1.ContainerRestartPolicyAlways)
+			if c.Name == ClientRegistrationContainerName {
+				c.StartupProbe = registrationStartupProbe()
+			}
+			podSpec.InitContainers = append(podSpec.InitContainers, c)
+		}
+	}
+}
+
+// UngateRegistration undoes GateOnRegistration, so a pod spec defaulted
+// before can be mutated again like a fresh one.
+func UngateRegistration(podSpec *corev1.PodSpec) {
+	var kept []corev1.Container
+	for _, c := range podSpec.InitContainers {
+		switch c.Name {
+		case SpiffeHelperContainerName, ClientRegistrationContainerName:
+			c.RestartPolicy = nil
+			c.StartupProbe = nil
+			podSpec.Containers = append(podSpec.Containers, c)
+		default:
+			kept = append(kept, c)
+		}
+	}
+	podSpec.InitContainers = kept
+}
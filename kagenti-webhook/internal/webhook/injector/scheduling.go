@@ -0,0 +1,192 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package injector
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+
+	"github.com/kagenti/kagenti-extensions/kagenti-webhook/internal/webhook/config"
+)
+
+// SchedulingRejection is the Rejection of a pod whose own scheduling
+// constraints contradict the nodes the sidecar images need.
+type SchedulingRejection struct {
+	Reasons []string
+}
+
+func (e *SchedulingRejection) Reason() string {
+	return "scheduling"
+}
+
+func (e *SchedulingRejection) Error() string {
+	return "AuthBridge cannot be injected: " + strings.Join(e.Reasons, "; ") +
+		" (scheduling of the platform config)"
+}
+
+// sidecarScheduling returns the scheduling requirements of a sidecar
+// container.
+func sidecarScheduling(policy config.SchedulingConfig, container string) config.SidecarScheduling {
+	switch container {
+	case EnvoyProxyContainerName:
+		return policy.EnvoyProxy
+	case ProxyInitContainerName:
+		return policy.ProxyInit
+	case SpiffeHelperContainerName:
+		return policy.SpiffeHelper
+	case ClientRegistrationContainerName:
+		return policy.ClientRegistration
+	}
+	return config.SidecarScheduling{}
+}
+
+// applyScheduling adds the node requirements of the sidecars injected to the
+// pod: their node selectors, a required node affinity on the architectures
+// all images are built for, and their tolerations. It returns a
+// *SchedulingRejection, leaving the pod unchanged, if the pod's own node
+// selector or affinity rules out every node the images can run on.
+func applyScheduling(podSpec *corev1.PodSpec, policy config.SchedulingConfig, sidecars []string) Rejection {
+	var archs []string
+	archsSet := false
+	selector := map[string]string{}
+	var tolerations []corev1.Toleration
+	var reasons []string
+	for _, sidecar := range sidecars {
+		s := sidecarScheduling(policy, sidecar)
+		if len(s.Architectures) > 0 {
+			if !archsSet {
+				archs, archsSet = slices.Clone(s.Architectures), true
+			} else {
+				archs = slices.DeleteFunc(archs, func(a string) bool { return !slices.Contains(s.Architectures, a) })
+			}
+		}
+		for k, v := range s.NodeSelector {
+			if existing, ok := selector[k]; ok && existing != v {
+				reasons = append(reasons, fmt.Sprintf("the sidecar images need both %s=%s and %s=%s", k, existing, k, v))
+			}
+			selector[k] = v
+		}
+		tolerations = append(tolerations, s.Tolerations...)
+	}
+
+	if archsSet && len(archs) == 0 {
+		reasons = append(reasons, "the sidecar images share no architecture")
+	}
+
+	keys := make([]string, 0, len(selector))
+	for k := range selector {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		if v, ok := podSpec.NodeSelector[k]; ok && v != selector[k] {
+			reasons = append(reasons, fmt.Sprintf("the pod selects nodes with %s=%s, but the sidecar images need %s=%s", k, v, k, selector[k]))
+		}
+	}
+	archSelected := false
+	if len(archs) > 0 {
+		if v, ok := podSpec.NodeSelector[corev1.LabelArchStable]; ok {
+			archSelected = true
+			if !slices.Contains(archs, v) {
+				reasons = append(reasons, fmt.Sprintf("the pod selects %s nodes, but the sidecar images run on %s", v, strings.Join(archs, ", ")))
+			}
+		} else if terms := requiredNodeTerms(podSpec); len(terms) > 0 && !slices.ContainsFunc(terms, func(t corev1.NodeSelectorTerm) bool { return termAllowsArch(t, archs) }) {
+			reasons = append(reasons, fmt.Sprintf("the pod's node affinity only allows architectures the sidecar images, built for %s, do not run on", strings.Join(archs, ", ")))
+		}
+	}
+	if len(reasons) > 0 {
+		return &SchedulingRejection{Reasons: reasons}
+	}
+
+	for _, k := range keys {
+		if podSpec.NodeSelector == nil {
+			podSpec.NodeSelector = map[string]string{}
+		}
+		podSpec.NodeSelector[k] = selector[k]
+	}
+	if len(archs) > 0 && !archSelected {
+		requireArchitectures(podSpec, archs)
+	}
+	for _, t := range tolerations {
+		if !slices.ContainsFunc(podSpec.Tolerations, func(existing corev1.Toleration) bool { return equality.Semantic.DeepEqual(existing, t) }) {
+			podSpec.Tolerations = append(podSpec.Tolerations, t)
+		}
+	}
+	return nil
+}
+
+func requiredNodeTerms(podSpec *corev1.PodSpec) []corev1.NodeSelectorTerm {
+	if podSpec.Affinity == nil || podSpec.Affinity.NodeAffinity == nil ||
+		podSpec.Affinity.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution == nil {
+		return nil
+	}
+	return podSpec.Affinity.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution.NodeSelectorTerms
+}
+
+// termAllowsArch reports whether a node selector term may match nodes of
+// one of archs. Only In and NotIn on kubernetes.io/arch are considered.
+func termAllowsArch(term corev1.NodeSelectorTerm, archs []string) bool {
+	for _, expr := range term.MatchExpressions {
+		if expr.Key != corev1.LabelArchStable {
+			continue
+		}
+		switch expr.Operator {
+		case corev1.NodeSelectorOpIn:
+			if !slices.ContainsFunc(archs, func(a string) bool { return slices.Contains(expr.Values, a) }) {
+				return false
+			}
+		case corev1.NodeSelectorOpNotIn:
+			if !slices.ContainsFunc(archs, func(a string) bool { return !slices.Contains(expr.Values, a) }) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// requireArchitectures restricts the pod to nodes of archs by adding a
+// kubernetes.io/arch requirement to each required node selector term (the
+// terms are ORed, their expressions ANDed), or a term of its own.
+func requireArchitectures(podSpec *corev1.PodSpec, archs []string) {
+	requirement := corev1.NodeSelectorRequirement{
+		Key:      corev1.LabelArchStable,
+		Operator: corev1.NodeSelectorOpIn,
+		Values:   archs,
+	}
+	if podSpec.Affinity == nil {
+		podSpec.Affinity = &corev1.Affinity{}
+	}
+	if podSpec.Affinity.NodeAffinity == nil {
+		podSpec.Affinity.NodeAffinity = &corev1.NodeAffinity{}
+	}
+	required := podSpec.Affinity.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution
+	if required == nil || len(required.NodeSelectorTerms) == 0 {
+		podSpec.Affinity.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution = &corev1.NodeSelector{
+			NodeSelectorTerms: []corev1.NodeSelectorTerm{{MatchExpressions: []corev1.NodeSelectorRequirement{requirement}}},
+		}
+		return
+	}
+	for i := range required.NodeSelectorTerms {
+		term := &required.NodeSelectorTerms[i]
+		term.MatchExpressions = append(term.MatchExpressions, *requirement.DeepCopy())
+	}
+}
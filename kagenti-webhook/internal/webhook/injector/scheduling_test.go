@@ -0,0 +1,162 @@
+package injector
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/kagenti/kagenti-extensions/kagenti-webhook/internal/webhook/config"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func archRequirement(archs ...string) corev1.NodeSelectorRequirement {
+	return corev1.NodeSelectorRequirement{Key: corev1.LabelArchStable, Operator: corev1.NodeSelectorOpIn, Values: archs}
+}
+
+func TestApplyScheduling(t *testing.T) {
+	policy := config.SchedulingConfig{
+		EnvoyProxy: config.SidecarScheduling{
+			Architectures: []string{"amd64", "arm64"},
+			NodeSelector:  map[string]string{"node-pool": "mesh"},
+			Tolerations:   []corev1.Toleration{{Key: "dedicated", Operator: corev1.TolerationOpEqual, Value: "mesh", Effect: corev1.TaintEffectNoSchedule}},
+		},
+		SpiffeHelper: config.SidecarScheduling{Architectures: []string{"amd64"}},
+	}
+	gpuTerm := corev1.NodeSelectorTerm{MatchExpressions: []corev1.NodeSelectorRequirement{{Key: "gpu", Operator: corev1.NodeSelectorOpExists}}}
+	tests := []struct {
+		name         string
+		sidecars     []string
+		podSpec      corev1.PodSpec
+		wantRejected bool
+		want         corev1.PodSpec
+	}{
+		{
+			name:     "architectures are intersected",
+			sidecars: []string{EnvoyProxyContainerName, SpiffeHelperContainerName},
+			want: corev1.PodSpec{
+				NodeSelector: map[string]string{"node-pool": "mesh"},
+				Affinity: &corev1.Affinity{NodeAffinity: &corev1.NodeAffinity{
+					RequiredDuringSchedulingIgnoredDuringExecution: &corev1.NodeSelector{
+						NodeSelectorTerms: []corev1.NodeSelectorTerm{{MatchExpressions: []corev1.NodeSelectorRequirement{archRequirement("amd64")}}},
+					},
+				}},
+				Tolerations: policy.EnvoyProxy.Tolerations,
+			},
+		},
+		{
+			name:     "sidecars not injected do not contribute",
+			sidecars: []string{SpiffeHelperContainerName, ClientRegistrationContainerName},
+			want: corev1.PodSpec{
+				Affinity: &corev1.Affinity{NodeAffinity: &corev1.NodeAffinity{
+					RequiredDuringSchedulingIgnoredDuringExecution: &corev1.NodeSelector{
+						NodeSelectorTerms: []corev1.NodeSelectorTerm{{MatchExpressions: []corev1.NodeSelectorRequirement{archRequirement("amd64")}}},
+					},
+				}},
+			},
+		},
+		{
+			name:     "existing affinity terms get the requirement",
+			sidecars: []string{SpiffeHelperContainerName},
+			podSpec: corev1.PodSpec{Affinity: &corev1.Affinity{NodeAffinity: &corev1.NodeAffinity{
+				RequiredDuringSchedulingIgnoredDuringExecution: &corev1.NodeSelector{NodeSelectorTerms: []corev1.NodeSelectorTerm{gpuTerm}},
+			}}},
+			want: corev1.PodSpec{Affinity: &corev1.Affinity{NodeAffinity: &corev1.NodeAffinity{
+				RequiredDuringSchedulingIgnoredDuringExecution: &corev1.NodeSelector{NodeSelectorTerms: []corev1.NodeSelectorTerm{{
+					MatchExpressions: []corev1.NodeSelectorRequirement{gpuTerm.MatchExpressions[0], archRequirement("amd64")},
+				}}},
+			}}},
+		},
+		{
+			name:     "pod selectors and tolerations are kept",
+			sidecars: []string{EnvoyProxyContainerName},
+			podSpec: corev1.PodSpec{
+				NodeSelector: map[string]string{corev1.LabelArchStable: "arm64", "zone": "a"},
+				Tolerations:  policy.EnvoyProxy.Tolerations,
+			},
+			want: corev1.PodSpec{
+				NodeSelector: map[string]string{corev1.LabelArchStable: "arm64", "zone": "a", "node-pool": "mesh"},
+				Tolerations:  policy.EnvoyProxy.Tolerations,
+			},
+		},
+		{
+			name:         "pod selects another architecture",
+			sidecars:     []string{SpiffeHelperContainerName},
+			podSpec:      corev1.PodSpec{NodeSelector: map[string]string{corev1.LabelArchStable: "arm64"}},
+			wantRejected: true,
+		},
+		{
+			name:     "pod affinity excludes the architectures",
+			sidecars: []string{SpiffeHelperContainerName},
+			podSpec: corev1.PodSpec{Affinity: &corev1.Affinity{NodeAffinity: &corev1.NodeAffinity{
+				RequiredDuringSchedulingIgnoredDuringExecution: &corev1.NodeSelector{NodeSelectorTerms: []corev1.NodeSelectorTerm{{
+					MatchExpressions: []corev1.NodeSelectorRequirement{{Key: corev1.LabelArchStable, Operator: corev1.NodeSelectorOpNotIn, Values: []string{"amd64"}}},
+				}}},
+			}}},
+			wantRejected: true,
+		},
+		{
+			name:         "pod selects another node pool",
+			sidecars:     []string{EnvoyProxyContainerName},
+			podSpec:      corev1.PodSpec{NodeSelector: map[string]string{"node-pool": "batch"}},
+			wantRejected: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			podSpec := *tt.podSpec.DeepCopy()
+			err := applyScheduling(&podSpec, policy, tt.sidecars)
+			if tt.wantRejected {
+				var rejection *SchedulingRejection
+				if !errors.As(err, &rejection) {
+					t.Fatalf("err = %v, want a rejection", err)
+				}
+				if !reflect.DeepEqual(podSpec, tt.podSpec) {
+					t.Errorf("rejected pod was modified: %+v", podSpec)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(podSpec, tt.want) {
+				t.Errorf("pod = %+v, want %+v", podSpec, tt.want)
+			}
+		})
+	}
+}
+
+func TestInjectAuthBridge_SchedulingRejection(t *testing.T) {
+	ns := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "team1", Labels: map[string]string{"kagenti-enabled": "true"}}}
+	cfg := config.CompiledDefaults()
+	cfg.Scheduling.EnvoyProxy.Architectures = []string{"amd64"}
+	m := NewPodMutator(fake.NewClientBuilder().WithObjects(ns).Build(), true,
+		func() *config.PlatformConfig { return cfg }, config.DefaultFeatureGates)
+	var published []InjectionDecision
+	m.DecisionPublisher = decisionRecorder(func(d InjectionDecision) { published = append(published, d) })
+
+	podSpec := corev1.PodSpec{
+		NodeSelector: map[string]string{corev1.LabelArchStable: "s390x"},
+		Containers:   []corev1.Container{{Name: "app"}},
+	}
+	mutated, err := m.InjectAuthBridge(context.Background(), &podSpec, "team1", "weather", map[string]string{KagentiTypeLabel: KagentiTypeAgent})
+	var rejection *SchedulingRejection
+	if !errors.As(err, &rejection) || mutated {
+		t.Fatalf("mutated = %t, err = %v, want a rejection", mutated, err)
+	}
+	if len(podSpec.Containers) != 1 || len(podSpec.InitContainers) != 0 || len(podSpec.Volumes) != 0 {
+		t.Errorf("rejected pod was modified: %+v", podSpec)
+	}
+	if len(published) != 1 || published[0].AnyInjected() || published[0].EnvoyProxy.Layer != "scheduling" {
+		t.Errorf("published decisions = %+v, want the rejection", published)
+	}
+}
+
+// decisionRecorder is a DecisionPublisher calling a function.
+type decisionRecorder func(InjectionDecision)
+
+func (f decisionRecorder) PublishDecision(_, _ string, _ map[string]string, d InjectionDecision) {
+	f(d)
+}
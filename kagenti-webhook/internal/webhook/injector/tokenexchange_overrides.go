@@ -4,8 +4,11 @@ package injector
 // extracted from a TokenExchange CR for a specific workload.
 // nil pointer fields mean "not specified" (fall through to lower layers).
 //
-// This is a stub — TokenExchange CR support is not yet implemented.
-// Pass nil for tokenExchangeOverrides to skip this layer entirely.
+// This is a stub — TokenExchange CR support is not yet implemented. There is
+// no TokenExchange CRD yet, so no TokenExchangeLister is set outside tests and
+// this layer is skipped. The selector matching and overlap validation of
+// tokenexchange_selector.go are ready for the lister and the validating
+// admission handler to use once the CRD lands.
 type TokenExchangeOverrides struct {
 	EnvoyProxy         *bool
 	SpiffeHelper       *bool
@@ -0,0 +1,261 @@
+package injector
+
+import (
+	"fmt"
+	"path"
+	"slices"
+	"sort"
+	"strings"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+// TokenExchangeBinding is the workload-targeting part of a TokenExchange CR:
+// which workloads in its namespace it applies to and the overrides it carries.
+//
+// A binding matches a workload when ALL of the following hold:
+//   - the workload is in the binding's namespace
+//   - Selector is nil or matches the workload (pod template) labels
+//   - NamePatterns is empty or at least one pattern matches the workload name
+//     (path.Match glob syntax, e.g. "weather-*")
+type TokenExchangeBinding struct {
+	Name              string
+	Namespace         string
+	Selector          *metav1.LabelSelector
+	NamePatterns      []string
+	Priority          int32
+	CreationTimestamp metav1.Time
+	Overrides         TokenExchangeOverrides
+}
+
+// Matches reports whether the binding applies to the given workload.
+func (b *TokenExchangeBinding) Matches(namespace, workloadName string, workloadLabels map[string]string) (bool, error) {
+	if b.Namespace != namespace {
+		return false, nil
+	}
+	if b.Selector != nil {
+		selector, err := metav1.LabelSelectorAsSelector(b.Selector)
+		if err != nil {
+			return false, fmt.Errorf("TokenExchange %s/%s: invalid selector: %w", b.Namespace, b.Name, err)
+		}
+		if !selector.Matches(labels.Set(workloadLabels)) {
+			return false, nil
+		}
+	}
+	if len(b.NamePatterns) == 0 {
+		return true, nil
+	}
+	for _, pattern := range b.NamePatterns {
+		ok, err := path.Match(pattern, workloadName)
+		if err != nil {
+			return false, fmt.Errorf("TokenExchange %s/%s: invalid name pattern %q: %w", b.Namespace, b.Name, pattern, err)
+		}
+		if ok {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// specificity ranks how narrowly a binding targets workloads. Exact names
+// beat glob patterns, which beat selector-only bindings; among those, more
+// label requirements are more specific.
+func (b *TokenExchangeBinding) specificity() (nameRank, requirements int) {
+	for _, pattern := range b.NamePatterns {
+		rank := 1
+		if isLiteralPattern(pattern) {
+			rank = 2
+		}
+		// A binding is only as specific as its broadest pattern
+		if nameRank == 0 || rank < nameRank {
+			nameRank = rank
+		}
+	}
+	if b.Selector != nil {
+		requirements = len(b.Selector.MatchLabels) + len(b.Selector.MatchExpressions)
+	}
+	return nameRank, requirements
+}
+
+// outranks reports whether b wins over other when both match a workload.
+// Order: higher Priority, then higher specificity, then older
+// CreationTimestamp, then lexically smaller name.
+func (b *TokenExchangeBinding) outranks(other *TokenExchangeBinding) bool {
+	if b.Priority != other.Priority {
+		return b.Priority > other.Priority
+	}
+	bName, bReqs := b.specificity()
+	oName, oReqs := other.specificity()
+	if bName != oName {
+		return bName > oName
+	}
+	if bReqs != oReqs {
+		return bReqs > oReqs
+	}
+	if !b.CreationTimestamp.Equal(&other.CreationTimestamp) {
+		return b.CreationTimestamp.Before(&other.CreationTimestamp)
+	}
+	return b.Name < other.Name
+}
+
+// ResolveTokenExchangeOverrides selects the binding that applies to a
+// workload and returns its overrides together with the binding name.
+// It returns nil overrides when no binding matches.
+func ResolveTokenExchangeOverrides(
+	bindings []TokenExchangeBinding,
+	namespace, workloadName string,
+	workloadLabels map[string]string,
+) (*TokenExchangeOverrides, string, error) {
+	var winner *TokenExchangeBinding
+	for i := range bindings {
+		b := &bindings[i]
+		ok, err := b.Matches(namespace, workloadName, workloadLabels)
+		if err != nil {
+			return nil, "", err
+		}
+		if ok && (winner == nil || b.outranks(winner)) {
+			winner = b
+		}
+	}
+	if winner == nil {
+		return nil, "", nil
+	}
+	overrides := winner.Overrides
+	return &overrides, winner.Name, nil
+}
+
+// ValidateTokenExchangeBinding rejects a binding that would be ambiguous with
+// an existing one: same namespace, same Priority and same specificity, so the
+// winner would be decided only by creation time, while their selectors and
+// name patterns may target the same workload. The overlap check is
+// conservative — bindings are only treated as disjoint when that is provable
+// from matchLabels, In expressions or literal names. It is meant for the
+// validating admission handler of TokenExchange CRs, which does not exist yet.
+func ValidateTokenExchangeBinding(candidate TokenExchangeBinding, existing []TokenExchangeBinding) error {
+	if candidate.Selector != nil {
+		if _, err := metav1.LabelSelectorAsSelector(candidate.Selector); err != nil {
+			return fmt.Errorf("invalid selector: %w", err)
+		}
+	}
+	for _, pattern := range candidate.NamePatterns {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid name pattern %q: %w", pattern, err)
+		}
+	}
+
+	cName, cReqs := candidate.specificity()
+	var conflicts []string
+	for i := range existing {
+		other := &existing[i]
+		if other.Namespace != candidate.Namespace || other.Name == candidate.Name {
+			continue
+		}
+		if other.Priority != candidate.Priority {
+			continue
+		}
+		oName, oReqs := other.specificity()
+		if oName != cName || oReqs != cReqs {
+			continue
+		}
+		if selectorsMayOverlap(candidate.Selector, other.Selector) &&
+			namePatternsMayOverlap(candidate.NamePatterns, other.NamePatterns) {
+			conflicts = append(conflicts, other.Name)
+		}
+	}
+	if len(conflicts) > 0 {
+		sort.Strings(conflicts)
+		return fmt.Errorf("ambiguous overlap with TokenExchange %s in namespace %s: "+
+			"set a distinct priority or narrow the selector", strings.Join(conflicts, ", "), candidate.Namespace)
+	}
+	return nil
+}
+
+// selectorsMayOverlap returns false only when no label set can satisfy both
+// selectors.
+func selectorsMayOverlap(a, b *metav1.LabelSelector) bool {
+	if a == nil || b == nil {
+		return true
+	}
+	allowedA := allowedValues(a)
+	allowedB := allowedValues(b)
+	for key, valuesA := range allowedA {
+		valuesB, ok := allowedB[key]
+		if !ok {
+			continue
+		}
+		if !intersects(valuesA, valuesB) {
+			return false
+		}
+	}
+	return true
+}
+
+// allowedValues collects, per label key, the set of values a selector accepts
+// through matchLabels and In expressions.
+func allowedValues(s *metav1.LabelSelector) map[string][]string {
+	out := make(map[string][]string)
+	for k, v := range s.MatchLabels {
+		out[k] = []string{v}
+	}
+	for _, expr := range s.MatchExpressions {
+		if expr.Operator != metav1.LabelSelectorOpIn {
+			continue
+		}
+		if existing, ok := out[expr.Key]; ok {
+			var narrowed []string
+			for _, v := range existing {
+				if slices.Contains(expr.Values, v) {
+					narrowed = append(narrowed, v)
+				}
+			}
+			out[expr.Key] = narrowed
+			continue
+		}
+		out[expr.Key] = expr.Values
+	}
+	return out
+}
+
+// namePatternsMayOverlap returns false only when no workload name can match
+// both pattern lists.
+func namePatternsMayOverlap(a, b []string) bool {
+	if len(a) == 0 || len(b) == 0 {
+		return true
+	}
+	for _, pa := range a {
+		for _, pb := range b {
+			switch {
+			case isLiteralPattern(pa) && isLiteralPattern(pb):
+				if pa == pb {
+					return true
+				}
+			case isLiteralPattern(pa):
+				if ok, _ := path.Match(pb, pa); ok {
+					return true
+				}
+			case isLiteralPattern(pb):
+				if ok, _ := path.Match(pa, pb); ok {
+					return true
+				}
+			default:
+				// Two globs: assume they may overlap
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func isLiteralPattern(pattern string) bool {
+	return !strings.ContainsAny(pattern, `*?[\`)
+}
+
+func intersects(a, b []string) bool {
+	for _, v := range a {
+		if slices.Contains(b, v) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,219 @@
+package injector
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kagenti/kagenti-extensions/kagenti-webhook/internal/webhook/config"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func binding(name string, priority int32, selector map[string]string, patterns ...string) TokenExchangeBinding {
+	b := TokenExchangeBinding{
+		Name:              name,
+		Namespace:         "team1",
+		Priority:          priority,
+		NamePatterns:      patterns,
+		CreationTimestamp: metav1.NewTime(time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)),
+		Overrides:         TokenExchangeOverrides{EnvoyProxy: ptr.To(true)},
+	}
+	if selector != nil {
+		b.Selector = &metav1.LabelSelector{MatchLabels: selector}
+	}
+	return b
+}
+
+func TestTokenExchangeBinding_Matches(t *testing.T) {
+	workloadLabels := map[string]string{"app": "weather", "tier": "agent"}
+
+	tests := []struct {
+		name      string
+		binding   TokenExchangeBinding
+		namespace string
+		workload  string
+		expect    bool
+	}{
+		{"namespace only", binding("all", 0, nil), "team1", "weather-agent", true},
+		{"other namespace", binding("all", 0, nil), "team2", "weather-agent", false},
+		{"selector match", binding("sel", 0, map[string]string{"app": "weather"}), "team1", "weather-agent", true},
+		{"selector mismatch", binding("sel", 0, map[string]string{"app": "news"}), "team1", "weather-agent", false},
+		{"glob match", binding("glob", 0, nil, "weather-*"), "team1", "weather-agent", true},
+		{"glob mismatch", binding("glob", 0, nil, "news-*"), "team1", "weather-agent", false},
+		{"any pattern matches", binding("multi", 0, nil, "news-*", "weather-agent"), "team1", "weather-agent", true},
+		{"selector and pattern", binding("both", 0, map[string]string{"tier": "agent"}, "news-*"), "team1", "weather-agent", false},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := tc.binding.Matches(tc.namespace, tc.workload, workloadLabels)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got != tc.expect {
+				t.Errorf("Matches() = %v, want %v", got, tc.expect)
+			}
+		})
+	}
+}
+
+func TestResolveTokenExchangeOverrides(t *testing.T) {
+	workloadLabels := map[string]string{"app": "weather", "tier": "agent"}
+
+	older := binding("older", 0, map[string]string{"app": "weather"})
+	newer := binding("newer", 0, map[string]string{"tier": "agent"})
+	newer.CreationTimestamp = metav1.NewTime(older.CreationTimestamp.Add(time.Hour))
+
+	tests := []struct {
+		name     string
+		bindings []TokenExchangeBinding
+		winner   string
+	}{
+		{"no match", []TokenExchangeBinding{binding("news", 0, map[string]string{"app": "news"})}, ""},
+		{"priority wins", []TokenExchangeBinding{
+			binding("exact", 0, nil, "weather-agent"),
+			binding("high", 10, nil),
+		}, "high"},
+		{"exact name beats glob", []TokenExchangeBinding{
+			binding("glob", 0, nil, "weather-*"),
+			binding("exact", 0, nil, "weather-agent"),
+		}, "exact"},
+		{"glob beats selector-only", []TokenExchangeBinding{
+			binding("selector", 0, map[string]string{"app": "weather", "tier": "agent"}),
+			binding("glob", 0, nil, "weather-*"),
+		}, "glob"},
+		{"more label requirements win", []TokenExchangeBinding{
+			binding("one", 0, map[string]string{"app": "weather"}),
+			binding("two", 0, map[string]string{"app": "weather", "tier": "agent"}),
+		}, "two"},
+		{"oldest wins on tie", []TokenExchangeBinding{newer, older}, "older"},
+		{"name breaks full tie", []TokenExchangeBinding{
+			binding("b", 0, nil),
+			binding("a", 0, nil),
+		}, "a"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			overrides, winner, err := ResolveTokenExchangeOverrides(tc.bindings, "team1", "weather-agent", workloadLabels)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if winner != tc.winner {
+				t.Errorf("winner = %q, want %q", winner, tc.winner)
+			}
+			if (overrides != nil) != (tc.winner != "") {
+				t.Errorf("overrides = %v, want non-nil only when a binding matches", overrides)
+			}
+		})
+	}
+}
+
+func TestValidateTokenExchangeBinding(t *testing.T) {
+	existing := []TokenExchangeBinding{
+		binding("weather", 0, map[string]string{"app": "weather"}),
+		binding("exact", 0, nil, "weather-agent"),
+	}
+
+	tests := []struct {
+		name      string
+		candidate TokenExchangeBinding
+		conflict  string
+	}{
+		{"overlapping selector", binding("agents", 0, map[string]string{"tier": "agent"}), "weather"},
+		{"disjoint selector", binding("news", 0, map[string]string{"app": "news"}), ""},
+		{"different priority", binding("override", 5, map[string]string{"tier": "agent"}), ""},
+		{"different specificity", binding("two", 0, map[string]string{"app": "weather", "tier": "agent"}), ""},
+		{"same exact name", binding("dup", 0, nil, "weather-agent"), "exact"},
+		{"different exact name", binding("other", 0, nil, "news-agent"), ""},
+		{"update of itself", binding("weather", 0, map[string]string{"app": "weather"}), ""},
+		{"other namespace", func() TokenExchangeBinding {
+			b := binding("agents", 0, map[string]string{"tier": "agent"})
+			b.Namespace = "team2"
+			return b
+		}(), ""},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			err := ValidateTokenExchangeBinding(tc.candidate, existing)
+			if tc.conflict == "" {
+				if err != nil {
+					t.Errorf("expected no error, got %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tc.conflict) {
+				t.Errorf("expected conflict with %q, got %v", tc.conflict, err)
+			}
+		})
+	}
+
+	invalid := binding("bad", 0, nil, "weather-[")
+	if err := ValidateTokenExchangeBinding(invalid, nil); err == nil {
+		t.Error("expected error for invalid name pattern")
+	}
+}
+
+// staticTokenExchanges lists fixed bindings, or fails with err.
+type staticTokenExchanges struct {
+	bindings []TokenExchangeBinding
+	err      error
+}
+
+func (s staticTokenExchanges) ListTokenExchangeBindings(context.Context, string) ([]TokenExchangeBinding, error) {
+	return s.bindings, s.err
+}
+
+func TestInjectAuthBridge_TokenExchange(t *testing.T) {
+	noRegistration := binding("no-registration", 0, map[string]string{"app": "weather"})
+	noRegistration.Overrides = TokenExchangeOverrides{ClientRegistration: ptr.To(false)}
+	ns := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "team1", Labels: map[string]string{"kagenti-enabled": "true"}}}
+
+	tests := []struct {
+		name             string
+		lister           TokenExchangeLister
+		labels           map[string]string
+		wantRegistration bool
+		wantErr          bool
+	}{
+		{name: "no lister", labels: map[string]string{"app": "weather"}, wantRegistration: true},
+		{name: "binding matches", lister: staticTokenExchanges{bindings: []TokenExchangeBinding{noRegistration}}, labels: map[string]string{"app": "weather"}},
+		{name: "binding does not match", lister: staticTokenExchanges{bindings: []TokenExchangeBinding{noRegistration}}, labels: map[string]string{"app": "news"}, wantRegistration: true},
+		{name: "listing fails", lister: staticTokenExchanges{err: errors.New("unavailable")}, labels: map[string]string{"app": "weather"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := NewPodMutator(fake.NewClientBuilder().WithObjects(ns).Build(), true,
+				func() *config.PlatformConfig { return config.CompiledDefaults() }, config.DefaultFeatureGates)
+			m.TokenExchanges = tt.lister
+
+			labels := map[string]string{KagentiTypeLabel: KagentiTypeAgent}
+			for k, v := range tt.labels {
+				labels[k] = v
+			}
+			podSpec := corev1.PodSpec{Containers: []corev1.Container{{Name: "app"}}}
+			mutated, err := m.InjectAuthBridge(context.Background(), &podSpec, "team1", "weather", labels)
+			if tt.wantErr {
+				if err == nil || mutated {
+					t.Fatalf("mutated = %t, err = %v, want an error", mutated, err)
+				}
+				return
+			}
+			if err != nil || !mutated {
+				t.Fatalf("mutated = %t, err = %v", mutated, err)
+			}
+			if got := findContainer(podSpec.Containers, ClientRegistrationContainerName) != nil; got != tt.wantRegistration {
+				t.Errorf("client-registration injected = %t, want %t", got, tt.wantRegistration)
+			}
+			if findContainer(podSpec.Containers, EnvoyProxyContainerName) == nil {
+				t.Error("envoy-proxy not injected")
+			}
+		})
+	}
+}
@@ -0,0 +1,78 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package injector
+
+import (
+	"github.com/kagenti/kagenti-extensions/kagenti-webhook/internal/webhook/config"
+	corev1 "k8s.io/api/core/v1"
+)
+
+const (
+	// TrustBundleVolumeName is the ConfigMap volume holding the platform
+	// trust bundle.
+	TrustBundleVolumeName = "trust-bundle"
+	// TrustBundleMountPath is where that ConfigMap is mounted.
+	TrustBundleMountPath = "/etc/kagenti/trust-bundle"
+	// TrustBundleFile is the bundle's path under TrustBundleMountPath,
+	// whatever key it is stored under.
+	TrustBundleFile = TrustBundleMountPath + "/ca.crt"
+)
+
+// MountTrustBundle mounts the trust bundle ConfigMap read-only into the
+// envoy-proxy and client-registration containers and points them at it:
+// envoy-proxy trusts it for token endpoint calls (TOKEN_CA_FILE) and
+// client-registration for its Keycloak calls (TRUST_BUNDLE_FILE). Envoy's own
+// upstream clusters can reference TrustBundleFile in envoy-config. Nothing is
+// changed when no ConfigMap is configured or neither container is present.
+func MountTrustBundle(podSpec *corev1.PodSpec, cfg config.TrustBundleConfig) {
+	if cfg.ConfigMap == "" {
+		return
+	}
+
+	mounted := false
+	for i := range podSpec.Containers {
+		c := &podSpec.Containers[i]
+		switch c.Name {
+		case EnvoyProxyContainerName:
+			c.Env = setEnv(c.Env, corev1.EnvVar{Name: "TOKEN_CA_FILE", Value: TrustBundleFile})
+		case ClientRegistrationContainerName:
+			c.Env = setEnv(c.Env, corev1.EnvVar{Name: "TRUST_BUNDLE_FILE", Value: TrustBundleFile})
+		default:
+			continue
+		}
+		if !volumeMountExists(c.VolumeMounts, TrustBundleVolumeName) {
+			c.VolumeMounts = append(c.VolumeMounts, corev1.VolumeMount{
+				Name:      TrustBundleVolumeName,
+				MountPath: TrustBundleMountPath,
+				ReadOnly:  true,
+			})
+		}
+		mounted = true
+	}
+
+	if mounted && !volumeExists(podSpec.Volumes, TrustBundleVolumeName) {
+		podSpec.Volumes = append(podSpec.Volumes, corev1.Volume{
+			Name: TrustBundleVolumeName,
+			VolumeSource: corev1.VolumeSource{
+				ConfigMap: &corev1.ConfigMapVolumeSource{
+					LocalObjectReference: corev1.LocalObjectReference{Name: cfg.ConfigMap},
+					Items:                []corev1.KeyToPath{{Key: cfg.Key, Path: "ca.crt"}},
+				},
+			},
+		})
+	}
+}
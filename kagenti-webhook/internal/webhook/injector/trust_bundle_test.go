@@ -0,0 +1,87 @@
+package injector
+
+import (
+	"testing"
+
+	"github.com/kagenti/kagenti-extensions/kagenti-webhook/internal/webhook/config"
+	corev1 "k8s.io/api/core/v1"
+)
+
+func TestMountTrustBundle(t *testing.T) {
+	builder := NewContainerBuilder(config.CompiledDefaults())
+	podSpec := &corev1.PodSpec{
+		Containers: []corev1.Container{
+			{Name: "agent"},
+			builder.BuildEnvoyProxyContainer(),
+			builder.BuildSpiffeHelperContainer(),
+			builder.BuildClientRegistrationContainerWithSpireOption("weather", "team1", true),
+		},
+		Volumes: BuildRequiredVolumes(),
+	}
+	cfg := config.TrustBundleConfig{ConfigMap: "corp-ca", Key: "bundle.pem"}
+
+	MountTrustBundle(podSpec, cfg)
+	MountTrustBundle(podSpec, cfg) // idempotent
+
+	var bundleVolumes int
+	for _, v := range podSpec.Volumes {
+		if v.Name != TrustBundleVolumeName {
+			continue
+		}
+		bundleVolumes++
+		if v.ConfigMap == nil || v.ConfigMap.Name != "corp-ca" {
+			t.Fatalf("trust bundle volume = %+v, want ConfigMap corp-ca", v.VolumeSource)
+		}
+		if len(v.ConfigMap.Items) != 1 || v.ConfigMap.Items[0].Key != "bundle.pem" || v.ConfigMap.Items[0].Path != "ca.crt" {
+			t.Errorf("items = %+v, want bundle.pem -> ca.crt", v.ConfigMap.Items)
+		}
+	}
+	if bundleVolumes != 1 {
+		t.Errorf("got %d trust bundle volumes, want 1", bundleVolumes)
+	}
+
+	for _, c := range podSpec.Containers {
+		mounts := 0
+		for _, m := range c.VolumeMounts {
+			if m.Name == TrustBundleVolumeName {
+				mounts++
+				if !m.ReadOnly || m.MountPath != TrustBundleMountPath {
+					t.Errorf("container %s mount = %+v", c.Name, m)
+				}
+			}
+		}
+		want := 0
+		switch c.Name {
+		case EnvoyProxyContainerName:
+			want = 1
+			if v, _ := envValue(c.Env, "TOKEN_CA_FILE"); v != TrustBundleFile {
+				t.Errorf("envoy-proxy TOKEN_CA_FILE = %q", v)
+			}
+		case ClientRegistrationContainerName:
+			want = 1
+			if v, _ := envValue(c.Env, "TRUST_BUNDLE_FILE"); v != TrustBundleFile {
+				t.Errorf("client-registration TRUST_BUNDLE_FILE = %q", v)
+			}
+		}
+		if mounts != want {
+			t.Errorf("container %s has %d trust bundle mounts, want %d", c.Name, mounts, want)
+		}
+	}
+}
+
+func TestMountTrustBundle_NotConfigured(t *testing.T) {
+	builder := NewContainerBuilder(config.CompiledDefaults())
+	podSpec := &corev1.PodSpec{Containers: []corev1.Container{builder.BuildEnvoyProxyContainer()}}
+
+	MountTrustBundle(podSpec, config.CompiledDefaults().TrustBundle)
+	if volumeExists(podSpec.Volumes, TrustBundleVolumeName) || volumeMountExists(podSpec.Containers[0].VolumeMounts, TrustBundleVolumeName) {
+		t.Error("trust bundle mounted without a ConfigMap")
+	}
+
+	// No sidecar to mount it into: no dangling volume either
+	podSpec = &corev1.PodSpec{Containers: []corev1.Container{{Name: "agent"}}}
+	MountTrustBundle(podSpec, config.TrustBundleConfig{ConfigMap: "corp-ca", Key: "ca.crt"})
+	if len(podSpec.Volumes) != 0 {
+		t.Errorf("volumes = %+v, want none", podSpec.Volumes)
+	}
+}
@@ -0,0 +1,265 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package status
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+	"sigs.k8s.io/yaml"
+
+	"github.com/kagenti/kagenti-extensions/kagenti-webhook/internal/webhook/config"
+	"github.com/kagenti/kagenti-extensions/kagenti-webhook/internal/webhook/injector"
+)
+
+var adoptionLog = logf.Log.WithName("adoption-report")
+
+// AdoptionState classifies how far AuthBridge has been rolled out in a namespace.
+type AdoptionState string
+
+const (
+	// AdoptionOptedIn: the namespace is opted in (injector.NamespaceOptedIn)
+	// and every agent/tool pod carries the AuthBridge sidecars.
+	AdoptionOptedIn AdoptionState = "opted-in"
+	// AdoptionPartial: the namespace is opted in but some agent/tool pods run
+	// without sidecars (created before opt-in, or opted out by label).
+	AdoptionPartial AdoptionState = "partially-injected"
+	// AdoptionBlocked: the namespace is opted in but the global kill switch or
+	// the envoy-proxy feature gate prevents injection.
+	AdoptionBlocked AdoptionState = "blocked-by-gate"
+	// AdoptionExcluded: the namespace is not opted in.
+	AdoptionExcluded AdoptionState = "excluded"
+)
+
+// AdoptionStates lists every state, in report order.
+var AdoptionStates = []AdoptionState{AdoptionOptedIn, AdoptionPartial, AdoptionBlocked, AdoptionExcluded}
+
+const (
+	// AdoptionReportConfigMapName is the ConfigMap the report is written to.
+	AdoptionReportConfigMapName = "kagenti-adoption-report"
+	// AdoptionReportKey is the data key of the report ConfigMap.
+	AdoptionReportKey = "report.yaml"
+
+	defaultAdoptionInterval = 5 * time.Minute
+)
+
+var (
+	adoptionNamespaces = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "kagenti_webhook_adoption_namespaces",
+		Help: "Number of namespaces per AuthBridge adoption state.",
+	}, []string{"state"})
+	adoptionNamespaceState = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "kagenti_webhook_adoption_namespace_state",
+		Help: "Adoption state of each namespace that is not excluded (always 1).",
+	}, []string{"namespace", "state"})
+)
+
+func init() {
+	metrics.Registry.MustRegister(adoptionNamespaces, adoptionNamespaceState)
+}
+
+// AdoptionReport lists namespaces by adoption state.
+type AdoptionReport struct {
+	GeneratedAt metav1.Time                `json:"generatedAt"`
+	Namespaces  map[AdoptionState][]string `json:"namespaces"`
+}
+
+// ClassifyNamespace returns the adoption state of ns given its pods.
+// Only agent and tool pods (kagenti.io/type) that are still running count.
+func ClassifyNamespace(ns *corev1.Namespace, pods []corev1.Pod, fg *config.FeatureGates, pc *config.PlatformConfig) AdoptionState {
+	if !injector.NamespaceOptedIn(ns.Labels, pc) {
+		return AdoptionExcluded
+	}
+	decision := injector.NewPrecedenceEvaluator(fg, pc).Evaluate(ns.Labels, nil, nil)
+	if layer := decision.EnvoyProxy.Layer; layer == "global-gate" || layer == "feature-gate" {
+		return AdoptionBlocked
+	}
+	for i := range pods {
+		pod := &pods[i]
+		if !isAgentOrTool(pod.Labels) || pod.Status.Phase == corev1.PodSucceeded || pod.Status.Phase == corev1.PodFailed {
+			continue
+		}
+		if !hasInjectedSidecar(&pod.Spec) {
+			return AdoptionPartial
+		}
+	}
+	return AdoptionOptedIn
+}
+
+func isAgentOrTool(labels map[string]string) bool {
+	t := labels[injector.KagentiTypeLabel]
+	return t == injector.KagentiTypeAgent || t == injector.KagentiTypeTool
+}
+
+func hasInjectedSidecar(spec *corev1.PodSpec) bool {
+	for _, c := range spec.Containers {
+		if isSidecar(c.Name) {
+			return true
+		}
+	}
+	return false
+}
+
+func isSidecar(name string) bool {
+	switch name {
+	case injector.EnvoyProxyContainerName, injector.SpiffeHelperContainerName, injector.ClientRegistrationContainerName:
+		return true
+	}
+	return false
+}
+
+// AdoptionReporter periodically classifies every namespace, exports the
+// result as metrics and, if Namespace is set, writes it as a ConfigMap there.
+// It runs on the leader only.
+type AdoptionReporter struct {
+	// Client should be uncached for pods, like EffectiveConfigReconciler's.
+	Client            client.Client
+	GetPlatformConfig func() *config.PlatformConfig
+	GetFeatureGates   func() *config.FeatureGates
+	// Namespace receives the report ConfigMap; empty for metrics only.
+	Namespace string
+	// Interval between reports; defaults to 5 minutes.
+	Interval time.Duration
+}
+
+// Start implements manager.Runnable.
+func (r *AdoptionReporter) Start(ctx context.Context) error {
+	interval := r.Interval
+	if interval <= 0 {
+		interval = defaultAdoptionInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if err := r.Report(ctx); err != nil {
+			adoptionLog.Error(err, "failed to build adoption report")
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// NeedLeaderElection implements manager.LeaderElectionRunnable.
+func (r *AdoptionReporter) NeedLeaderElection() bool {
+	return true
+}
+
+// Report classifies all namespaces once and publishes the result.
+func (r *AdoptionReporter) Report(ctx context.Context) error {
+	report, err := r.Build(ctx)
+	if err != nil {
+		return err
+	}
+
+	adoptionNamespaceState.Reset()
+	for _, state := range AdoptionStates {
+		adoptionNamespaces.WithLabelValues(string(state)).Set(float64(len(report.Namespaces[state])))
+		// Excluded namespaces are usually the bulk of a cluster; only count them
+		if state == AdoptionExcluded {
+			continue
+		}
+		for _, ns := range report.Namespaces[state] {
+			adoptionNamespaceState.WithLabelValues(ns, string(state)).Set(1)
+		}
+	}
+	adoptionLog.Info("adoption report",
+		"opted-in", len(report.Namespaces[AdoptionOptedIn]),
+		"partially-injected", len(report.Namespaces[AdoptionPartial]),
+		"blocked-by-gate", len(report.Namespaces[AdoptionBlocked]),
+		"excluded", len(report.Namespaces[AdoptionExcluded]))
+
+	if r.Namespace == "" {
+		return nil
+	}
+	return r.writeConfigMap(ctx, report)
+}
+
+// Build classifies every namespace. Pods are only listed for opted-in
+// namespaces that are not blocked by a gate.
+func (r *AdoptionReporter) Build(ctx context.Context) (*AdoptionReport, error) {
+	namespaces := &corev1.NamespaceList{}
+	if err := r.Client.List(ctx, namespaces); err != nil {
+		return nil, fmt.Errorf("list namespaces: %w", err)
+	}
+	fg := r.GetFeatureGates()
+	pc := r.GetPlatformConfig()
+
+	report := &AdoptionReport{
+		GeneratedAt: metav1.Now(),
+		Namespaces:  make(map[AdoptionState][]string),
+	}
+	for i := range namespaces.Items {
+		ns := &namespaces.Items[i]
+		state := ClassifyNamespace(ns, nil, fg, pc)
+		if state == AdoptionOptedIn {
+			pods := &corev1.PodList{}
+			if err := r.Client.List(ctx, pods, client.InNamespace(ns.Name)); err != nil {
+				return nil, fmt.Errorf("list pods in %s: %w", ns.Name, err)
+			}
+			state = ClassifyNamespace(ns, pods.Items, fg, pc)
+		}
+		report.Namespaces[state] = append(report.Namespaces[state], ns.Name)
+	}
+	for _, names := range report.Namespaces {
+		sort.Strings(names)
+	}
+	return report, nil
+}
+
+func (r *AdoptionReporter) writeConfigMap(ctx context.Context, report *AdoptionReport) error {
+	data, err := yaml.Marshal(report)
+	if err != nil {
+		return fmt.Errorf("marshal adoption report: %w", err)
+	}
+	desired := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        AdoptionReportConfigMapName,
+			Namespace:   r.Namespace,
+			Labels:      map[string]string{managedByLabel: managedByValue},
+			Annotations: map[string]string{readOnlyAnnotation: readOnlyNotice},
+		},
+		Data: map[string]string{AdoptionReportKey: string(data)},
+	}
+
+	existing := &corev1.ConfigMap{}
+	err = r.Client.Get(ctx, types.NamespacedName{Namespace: r.Namespace, Name: AdoptionReportConfigMapName}, existing)
+	if apierrors.IsNotFound(err) {
+		return r.Client.Create(ctx, desired)
+	}
+	if err != nil {
+		return err
+	}
+	if existing.Labels[managedByLabel] != managedByValue {
+		adoptionLog.Info("skipping unmanaged ConfigMap with reserved name", "namespace", r.Namespace, "name", AdoptionReportConfigMapName)
+		return nil
+	}
+	existing.Data = desired.Data
+	return r.Client.Update(ctx, existing)
+}
@@ -0,0 +1,109 @@
+package status
+
+import (
+	"context"
+	"slices"
+	"testing"
+
+	"github.com/kagenti/kagenti-extensions/kagenti-webhook/internal/webhook/config"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/yaml"
+)
+
+func pod(ns, name, kagentiType string, containers ...string) *corev1.Pod {
+	p := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Namespace: ns, Name: name, Labels: map[string]string{}}}
+	if kagentiType != "" {
+		p.Labels["kagenti.io/type"] = kagentiType
+	}
+	for _, c := range containers {
+		p.Spec.Containers = append(p.Spec.Containers, corev1.Container{Name: c})
+	}
+	return p
+}
+
+func TestClassifyNamespace(t *testing.T) {
+	optedInNS := namespace("team1", map[string]string{"kagenti-enabled": "true"})
+	injected := *pod("team1", "agent", "agent", "app", "envoy-proxy")
+	notInjected := *pod("team1", "tool", "tool", "app")
+	unrelated := *pod("team1", "db", "", "postgres")
+	finished := *pod("team1", "job", "tool", "app")
+	finished.Status.Phase = corev1.PodSucceeded
+
+	gateOff := config.DefaultFeatureGates()
+	gateOff.EnvoyProxy = false
+	killSwitch := config.DefaultFeatureGates()
+	killSwitch.GlobalEnabled = false
+
+	tests := []struct {
+		name string
+		ns   *corev1.Namespace
+		pods []corev1.Pod
+		fg   *config.FeatureGates
+		want AdoptionState
+	}{
+		{name: "not opted in", ns: namespace("other", nil), pods: []corev1.Pod{notInjected}, want: AdoptionExcluded},
+		{name: "opted out explicitly", ns: namespace("other", map[string]string{"kagenti-enabled": "false"}), want: AdoptionExcluded},
+		{name: "all injected", ns: optedInNS, pods: []corev1.Pod{injected, unrelated, finished}, want: AdoptionOptedIn},
+		{name: "no workloads yet", ns: optedInNS, want: AdoptionOptedIn},
+		{name: "some not injected", ns: optedInNS, pods: []corev1.Pod{injected, notInjected}, want: AdoptionPartial},
+		{name: "envoy-proxy gate off", ns: optedInNS, pods: []corev1.Pod{notInjected}, fg: gateOff, want: AdoptionBlocked},
+		{name: "kill switch", ns: optedInNS, fg: killSwitch, want: AdoptionBlocked},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ClassifyNamespace(tt.ns, tt.pods, tt.fg, nil); got != tt.want {
+				t.Errorf("ClassifyNamespace() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAdoptionReporter_Report(t *testing.T) {
+	objs := []client.Object{
+		namespace("kagenti-system", nil),
+		namespace("team1", map[string]string{"kagenti-enabled": "true"}),
+		namespace("team2", map[string]string{"kagenti-enabled": "true"}),
+		pod("team1", "agent", "agent", "app", "envoy-proxy"),
+		pod("team2", "agent", "agent", "app", "envoy-proxy"),
+		pod("team2", "tool", "tool", "app"),
+	}
+	r := &AdoptionReporter{
+		Client:            fake.NewClientBuilder().WithObjects(objs...).Build(),
+		GetPlatformConfig: config.CompiledDefaults,
+		GetFeatureGates:   config.DefaultFeatureGates,
+		Namespace:         "kagenti-system",
+	}
+	if err := r.Report(context.Background()); err != nil {
+		t.Fatalf("Report: %v", err)
+	}
+
+	cm := &corev1.ConfigMap{}
+	key := types.NamespacedName{Namespace: "kagenti-system", Name: AdoptionReportConfigMapName}
+	if err := r.Client.Get(context.Background(), key, cm); err != nil {
+		t.Fatalf("report ConfigMap not written: %v", err)
+	}
+	var report AdoptionReport
+	if err := yaml.Unmarshal([]byte(cm.Data[AdoptionReportKey]), &report); err != nil {
+		t.Fatalf("unmarshal report: %v", err)
+	}
+	want := map[AdoptionState][]string{
+		AdoptionOptedIn:  {"team1"},
+		AdoptionPartial:  {"team2"},
+		AdoptionExcluded: {"kagenti-system"},
+	}
+	for state, names := range want {
+		if !slices.Equal(report.Namespaces[state], names) {
+			t.Errorf("%s = %v, want %v", state, report.Namespaces[state], names)
+		}
+	}
+
+	// A second run updates the existing ConfigMap in place
+	if err := r.Report(context.Background()); err != nil {
+		t.Fatalf("second Report: %v", err)
+	}
+}
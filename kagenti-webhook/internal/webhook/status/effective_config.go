@@ -0,0 +1,297 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package status publishes the configuration the webhook applies to each
+// opted-in namespace, so namespace owners can inspect it without access to
+// the webhook's own namespace.
+package status
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/kagenti/kagenti-extensions/kagenti-webhook/internal/webhook/config"
+	"github.com/kagenti/kagenti-extensions/kagenti-webhook/internal/webhook/injector"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/source"
+	"sigs.k8s.io/yaml"
+)
+
+var statusLog = logf.Log.WithName("effective-config")
+
+const (
+	// EffectiveConfigMapName is the generated ConfigMap written into every
+	// opted-in namespace.
+	EffectiveConfigMapName = "kagenti-effective-config"
+
+	// Data keys of the generated ConfigMap
+	PlatformConfigKey = "config.yaml"
+	FeatureGatesKey   = "feature-gates.yaml"
+
+	managedByLabel = "app.kubernetes.io/managed-by"
+	managedByValue = "kagenti-webhook"
+
+	readOnlyAnnotation = "kagenti.io/read-only"
+	readOnlyNotice     = "Generated by kagenti-webhook; manual edits are overwritten."
+
+	// redacted replaces values taken from the webhook's environment
+	redacted = "<redacted>"
+)
+
+// EffectiveConfigReconciler keeps the effective-config ConfigMap in sync with
+// the loaded platform config and feature gates for every opted-in namespace
+// (see injector.NamespaceOptedIn), and removes it when a namespace opts out.
+type EffectiveConfigReconciler struct {
+	// Client should be uncached for ConfigMaps so the manager does not start a
+	// cluster-wide ConfigMap informer.
+	Client            client.Client
+	GetPlatformConfig func() *config.PlatformConfig
+	GetFeatureGates   func() *config.FeatureGates
+	// GetExpandedValues returns the values ${VAR} expansion put into the
+	// platform config (see ConfigLoader.ExpandedValues); they are redacted.
+	// Optional.
+	GetExpandedValues func() []string
+
+	resync chan event.GenericEvent
+}
+
+// SetupWithManager registers the reconciler. It watches namespaces whose
+// injection label changes, plus resync events raised by Resync.
+func (r *EffectiveConfigReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	r.resync = make(chan event.GenericEvent, 64)
+
+	optInChanged := predicate.Funcs{
+		CreateFunc: func(e event.CreateEvent) bool {
+			return r.optedIn(e.Object.GetLabels())
+		},
+		UpdateFunc: func(e event.UpdateEvent) bool {
+			return r.optedIn(e.ObjectOld.GetLabels()) != r.optedIn(e.ObjectNew.GetLabels())
+		},
+		// The ConfigMap is garbage collected with the namespace
+		DeleteFunc: func(event.DeleteEvent) bool { return false },
+	}
+
+	return ctrl.NewControllerManagedBy(mgr).
+		Named("effective-config").
+		For(&corev1.Namespace{}, builder.WithPredicates(optInChanged)).
+		WatchesRawSource(source.Channel(r.resync, &handler.EnqueueRequestForObject{})).
+		Complete(r)
+}
+
+// Resync enqueues every opted-in namespace, plus every namespace that still
+// has a published ConfigMap, since a changed namespaces.selector can opt
+// namespaces out. Register it as an OnChange callback on the config and
+// feature gate loaders.
+func (r *EffectiveConfigReconciler) Resync(ctx context.Context) {
+	if r.resync == nil {
+		return
+	}
+	namespaces := &corev1.NamespaceList{}
+	if err := r.Client.List(ctx, namespaces); err != nil {
+		statusLog.Error(err, "failed to list namespaces for resync")
+		return
+	}
+	published := &corev1.ConfigMapList{}
+	if err := r.Client.List(ctx, published, client.MatchingLabels{managedByLabel: managedByValue}); err != nil {
+		statusLog.Error(err, "failed to list published effective configs for resync")
+		return
+	}
+	hasConfigMap := make(map[string]bool, len(published.Items))
+	for _, cm := range published.Items {
+		if cm.Name == EffectiveConfigMapName {
+			hasConfigMap[cm.Namespace] = true
+		}
+	}
+
+	for i := range namespaces.Items {
+		ns := &namespaces.Items[i]
+		if !r.optedIn(ns.Labels) && !hasConfigMap[ns.Name] {
+			continue
+		}
+		select {
+		case r.resync <- event.GenericEvent{Object: ns}:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// Reconcile creates, updates or deletes the effective-config ConfigMap for
+// a single namespace.
+func (r *EffectiveConfigReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	ns := &corev1.Namespace{}
+	if err := r.Client.Get(ctx, types.NamespacedName{Name: req.Name}, ns); err != nil {
+		return ctrl.Result{}, client.IgnoreNotFound(err)
+	}
+	if ns.DeletionTimestamp != nil {
+		return ctrl.Result{}, nil
+	}
+
+	if !r.optedIn(ns.Labels) {
+		return ctrl.Result{}, r.deleteIfManaged(ctx, ns.Name)
+	}
+
+	var expanded []string
+	if r.GetExpandedValues != nil {
+		expanded = r.GetExpandedValues()
+	}
+	desired, err := BuildEffectiveConfigMap(ns.Name, ns.Labels, r.GetPlatformConfig(), r.GetFeatureGates(), expanded)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+
+	existing := &corev1.ConfigMap{}
+	err = r.Client.Get(ctx, client.ObjectKeyFromObject(desired), existing)
+	if apierrors.IsNotFound(err) {
+		statusLog.Info("creating effective config", "namespace", ns.Name)
+		return ctrl.Result{}, r.Client.Create(ctx, desired)
+	}
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	if existing.Labels[managedByLabel] != managedByValue {
+		statusLog.Info("skipping unmanaged ConfigMap with reserved name", "namespace", ns.Name, "name", EffectiveConfigMapName)
+		return ctrl.Result{}, nil
+	}
+
+	existing.Labels = desired.Labels
+	existing.Annotations = desired.Annotations
+	existing.Data = desired.Data
+	return ctrl.Result{}, r.Client.Update(ctx, existing)
+}
+
+func (r *EffectiveConfigReconciler) deleteIfManaged(ctx context.Context, namespace string) error {
+	existing := &corev1.ConfigMap{}
+	err := r.Client.Get(ctx, types.NamespacedName{Namespace: namespace, Name: EffectiveConfigMapName}, existing)
+	if err != nil {
+		return client.IgnoreNotFound(err)
+	}
+	if existing.Labels[managedByLabel] != managedByValue {
+		return nil
+	}
+	statusLog.Info("namespace opted out, deleting effective config", "namespace", namespace)
+	return client.IgnoreNotFound(r.Client.Delete(ctx, existing))
+}
+
+// BuildEffectiveConfigMap renders the platform config and feature gates that
+// apply in namespace, whose labels are nsLabels, as a read-only ConfigMap.
+// String values in expanded are redacted.
+func BuildEffectiveConfigMap(namespace string, nsLabels map[string]string, cfg *config.PlatformConfig, fg *config.FeatureGates, expanded []string) (*corev1.ConfigMap, error) {
+	if cfg == nil {
+		cfg = config.CompiledDefaults()
+	}
+	if fg == nil {
+		fg = config.DefaultFeatureGates()
+	}
+
+	cfgYAML, err := yaml.Marshal(namespaceConfig(cfg, nsLabels))
+	if err != nil {
+		return nil, fmt.Errorf("marshal platform config: %w", err)
+	}
+	if len(expanded) > 0 {
+		if cfgYAML, err = redact(cfgYAML, expanded); err != nil {
+			return nil, fmt.Errorf("redact platform config: %w", err)
+		}
+	}
+	fgYAML, err := yaml.Marshal(fg)
+	if err != nil {
+		return nil, fmt.Errorf("marshal feature gates: %w", err)
+	}
+
+	return &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      EffectiveConfigMapName,
+			Namespace: namespace,
+			Labels: map[string]string{
+				managedByLabel: managedByValue,
+			},
+			Annotations: map[string]string{
+				readOnlyAnnotation: readOnlyNotice,
+			},
+		},
+		Data: map[string]string{
+			PlatformConfigKey: string(cfgYAML),
+			FeatureGatesKey:   string(fgYAML),
+		},
+	}, nil
+}
+
+// namespaceConfig narrows cfg to what applies in a namespace with nsLabels:
+// the images of its pin and its own realm. Other tenants' pins and realms,
+// and the platform's audit sinks, are left out.
+func namespaceConfig(cfg *config.PlatformConfig, nsLabels map[string]string) *config.PlatformConfig {
+	scoped := cfg.DeepCopy()
+
+	pin := scoped.Images.PinFor(nsLabels)
+	scoped.Images = scoped.Images.Pinned(pin)
+	scoped.Images.Pins = nil
+	if pin != nil {
+		scoped.Images.Pins = []config.ImagePin{*pin}
+	}
+
+	scoped.ClientRegistration.Realms = nil
+	if realm, _ := cfg.ClientRegistration.RealmFor("", nsLabels); realm != nil {
+		scoped.ClientRegistration.Realms = []config.KeycloakRealm{*realm}
+	}
+
+	scoped.Audit = config.AuditConfig{}
+	return scoped
+}
+
+// redact replaces the strings of cfgYAML that are one of values.
+func redact(cfgYAML []byte, values []string) ([]byte, error) {
+	secret := make(map[string]bool, len(values))
+	for _, v := range values {
+		secret[v] = true
+	}
+	var doc any
+	if err := yaml.Unmarshal(cfgYAML, &doc); err != nil {
+		return nil, err
+	}
+	var walk func(any) any
+	walk = func(v any) any {
+		switch v := v.(type) {
+		case map[string]any:
+			for k, item := range v {
+				v[k] = walk(item)
+			}
+		case []any:
+			for i, item := range v {
+				v[i] = walk(item)
+			}
+		case string:
+			if secret[v] {
+				return redacted
+			}
+		}
+		return v
+	}
+	return yaml.Marshal(walk(doc))
+}
+
+func (r *EffectiveConfigReconciler) optedIn(labels map[string]string) bool {
+	return injector.NamespaceOptedIn(labels, r.GetPlatformConfig())
+}
@@ -0,0 +1,151 @@
+package status
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/kagenti/kagenti-extensions/kagenti-webhook/internal/webhook/config"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func namespace(name string, labels map[string]string) *corev1.Namespace {
+	return &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: name, Labels: labels}}
+}
+
+func newReconciler(objs ...client.Object) *EffectiveConfigReconciler {
+	cfg := config.CompiledDefaults()
+	cfg.Observability.LogLevel = "debug"
+	fg := config.DefaultFeatureGates()
+	fg.SpiffeHelper = false
+
+	return &EffectiveConfigReconciler{
+		Client:            fake.NewClientBuilder().WithObjects(objs...).Build(),
+		GetPlatformConfig: func() *config.PlatformConfig { return cfg },
+		GetFeatureGates:   func() *config.FeatureGates { return fg },
+	}
+}
+
+func getEffectiveConfig(t *testing.T, r *EffectiveConfigReconciler, ns string) (*corev1.ConfigMap, bool) {
+	t.Helper()
+	cm := &corev1.ConfigMap{}
+	err := r.Client.Get(context.Background(), types.NamespacedName{Namespace: ns, Name: EffectiveConfigMapName}, cm)
+	if apierrors.IsNotFound(err) {
+		return nil, false
+	}
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	return cm, true
+}
+
+func reconcileNamespace(t *testing.T, r *EffectiveConfigReconciler, ns string) {
+	t.Helper()
+	if _, err := r.Reconcile(context.Background(), ctrl.Request{NamespacedName: types.NamespacedName{Name: ns}}); err != nil {
+		t.Fatalf("Reconcile(%s): %v", ns, err)
+	}
+}
+
+func TestReconcile_PublishesForOptedInNamespace(t *testing.T) {
+	r := newReconciler(namespace("team1", map[string]string{"kagenti-enabled": "true"}))
+	reconcileNamespace(t, r, "team1")
+
+	cm, ok := getEffectiveConfig(t, r, "team1")
+	if !ok {
+		t.Fatal("expected effective config ConfigMap to be created")
+	}
+	if !strings.Contains(cm.Data[PlatformConfigKey], "logLevel: debug") {
+		t.Errorf("platform config missing observability settings:\n%s", cm.Data[PlatformConfigKey])
+	}
+	if !strings.Contains(cm.Data[FeatureGatesKey], "spiffeHelper: false") {
+		t.Errorf("feature gates not rendered:\n%s", cm.Data[FeatureGatesKey])
+	}
+
+	// Manual edits are overwritten on the next reconcile
+	cm.Data[PlatformConfigKey] = "tampered"
+	if err := r.Client.Update(context.Background(), cm); err != nil {
+		t.Fatalf("update: %v", err)
+	}
+	reconcileNamespace(t, r, "team1")
+	cm, _ = getEffectiveConfig(t, r, "team1")
+	if cm.Data[PlatformConfigKey] == "tampered" {
+		t.Error("expected manual edit to be reverted")
+	}
+}
+
+func TestBuildEffectiveConfigMap_ScopedToNamespace(t *testing.T) {
+	cfg := config.CompiledDefaults()
+	cfg.ClientRegistration.Realms = []config.KeycloakRealm{
+		{Name: "tenant-a", NamespaceSelector: "tenant=a", URL: "http://keycloak.tenant-a:8080", Realm: "a"},
+		{Name: "tenant-b", NamespaceSelector: "tenant=b", URL: "http://keycloak.tenant-b:8080", Realm: "b"},
+	}
+	cfg.Images.Pins = []config.ImagePin{
+		{Name: "prod-b", NamespaceSelector: "tenant=b", EnvoyProxy: "envoy:pinned-b"},
+		{Name: "prod-a", NamespaceSelector: "tenant=a", EnvoyProxy: "envoy:pinned-a"},
+	}
+	cfg.Audit.Sinks = []config.AuditSinkConfig{{Name: "siem", Type: "http", URL: "https://siem.internal/ingest"}}
+	cfg.TokenExchange.TokenURL = "http://keycloak/token?key=s3cret"
+
+	cm, err := BuildEffectiveConfigMap("team-a", map[string]string{"tenant": "a"}, cfg, nil,
+		[]string{"http://keycloak/token?key=s3cret"})
+	if err != nil {
+		t.Fatalf("BuildEffectiveConfigMap: %v", err)
+	}
+	published := cm.Data[PlatformConfigKey]
+
+	for _, want := range []string{"keycloak.tenant-a", "envoy:pinned-a", "name: prod-a", "tokenUrl: <redacted>"} {
+		if !strings.Contains(published, want) {
+			t.Errorf("published config lacks %q:\n%s", want, published)
+		}
+	}
+	for _, leaked := range []string{"tenant-b", "pinned-b", "siem", "s3cret"} {
+		if strings.Contains(published, leaked) {
+			t.Errorf("published config contains %q:\n%s", leaked, published)
+		}
+	}
+	if len(cfg.Images.Pins) != 2 || len(cfg.ClientRegistration.Realms) != 2 || len(cfg.Audit.Sinks) != 1 {
+		t.Error("BuildEffectiveConfigMap modified the platform config")
+	}
+}
+
+func TestReconcile_SkipsNamespaceNotOptedIn(t *testing.T) {
+	r := newReconciler(namespace("plain", nil))
+	reconcileNamespace(t, r, "plain")
+
+	if _, ok := getEffectiveConfig(t, r, "plain"); ok {
+		t.Error("expected no ConfigMap in namespace without kagenti-enabled label")
+	}
+}
+
+func TestReconcile_DeletesWhenOptedOut(t *testing.T) {
+	managed, err := BuildEffectiveConfigMap("team1", nil, nil, nil, nil)
+	if err != nil {
+		t.Fatalf("BuildEffectiveConfigMap: %v", err)
+	}
+	r := newReconciler(namespace("team1", map[string]string{"kagenti-enabled": "false"}), managed)
+	reconcileNamespace(t, r, "team1")
+
+	if _, ok := getEffectiveConfig(t, r, "team1"); ok {
+		t.Error("expected effective config to be deleted after opt-out")
+	}
+}
+
+func TestReconcile_LeavesUnmanagedConfigMap(t *testing.T) {
+	unmanaged := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: EffectiveConfigMapName, Namespace: "team1"},
+		Data:       map[string]string{"owner": "user"},
+	}
+	r := newReconciler(namespace("team1", map[string]string{"kagenti-enabled": "true"}), unmanaged)
+	reconcileNamespace(t, r, "team1")
+
+	cm, ok := getEffectiveConfig(t, r, "team1")
+	if !ok || cm.Data["owner"] != "user" {
+		t.Errorf("expected user-owned ConfigMap to be left untouched, got %v", cm)
+	}
+}
@@ -0,0 +1,326 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package status
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	agentsv1alpha1 "github.com/kagenti/operator/api/v1alpha1"
+	"github.com/prometheus/client_golang/prometheus"
+	toolhivev1alpha1 "github.com/stacklok/toolhive/cmd/thv-operator/api/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+
+	"github.com/kagenti/kagenti-extensions/kagenti-webhook/internal/webhook/injector"
+)
+
+var migrationLog = logf.Log.WithName("annotation-migration")
+
+// MigrationState tells whether an object using the deprecated kagenti.dev/inject
+// annotation already carries the equivalent labels.
+type MigrationState string
+
+const (
+	// MigrationPending: some equivalent labels are missing; the object still
+	// depends on ShouldMutate.
+	MigrationPending MigrationState = "pending"
+	// MigrationDone: the equivalent labels are set; only the annotation is left
+	// to remove.
+	MigrationDone MigrationState = "migrated"
+)
+
+const defaultMigrationInterval = 10 * time.Minute
+
+var deprecatedAnnotationObjects = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+	Name: "kagenti_webhook_deprecated_annotation_objects",
+	Help: "Number of objects still carrying the deprecated kagenti.dev/inject annotation.",
+}, []string{"kind", "state"})
+
+func init() {
+	metrics.Registry.MustRegister(deprecatedAnnotationObjects)
+}
+
+// DeprecatedUse is one object carrying the deprecated kagenti.dev/inject
+// annotation, with the labels that replace it.
+type DeprecatedUse struct {
+	Kind      string
+	Namespace string
+	Name      string
+	// Value of the deprecated annotation
+	Value string
+	// Missing are the equivalent labels not yet set. For Namespaces they go on
+	// the Namespace, for Agents and MCPServers on spec.podTemplateSpec.
+	Missing map[string]string
+	State   MigrationState
+
+	object client.Object
+}
+
+// equivalentLabels returns the labels replacing a kagenti.dev/inject value
+// on a Namespace ("" kind) or on a CR's pod template of the given workload type.
+func equivalentLabels(value, workloadType string) map[string]string {
+	if workloadType == "" {
+		// Only "true" ever had an effect on a Namespace
+		if value != "true" {
+			return nil
+		}
+		return map[string]string{injector.LabelNamespaceInject: "true"}
+	}
+	labels := map[string]string{injector.KagentiTypeLabel: workloadType}
+	switch value {
+	case "true":
+		labels[injector.AuthBridgeInjectLabel] = injector.AuthBridgeInjectValue
+	case "false":
+		labels[injector.AuthBridgeInjectLabel] = injector.AuthBridgeDisabledValue
+	}
+	return labels
+}
+
+// missingLabels returns the entries of want that are absent from have. Keys
+// set to a different value are left alone: they were chosen deliberately.
+func missingLabels(have, want map[string]string) map[string]string {
+	missing := make(map[string]string)
+	for k, v := range want {
+		if _, ok := have[k]; !ok {
+			missing[k] = v
+		}
+	}
+	return missing
+}
+
+func newDeprecatedUse(kind string, obj client.Object, have map[string]string, workloadType string) DeprecatedUse {
+	value := obj.GetAnnotations()[injector.DefaultCRAnnotation]
+	use := DeprecatedUse{
+		Kind:      kind,
+		Namespace: obj.GetNamespace(),
+		Name:      obj.GetName(),
+		Value:     value,
+		Missing:   missingLabels(have, equivalentLabels(value, workloadType)),
+		State:     MigrationDone,
+		object:    obj,
+	}
+	if len(use.Missing) > 0 {
+		use.State = MigrationPending
+	}
+	return use
+}
+
+// MigrationReporter periodically finds Namespaces, Agents and MCPServers still
+// using the deprecated kagenti.dev/inject annotation, reports them as Events
+// and metrics and, with Apply, writes the equivalent labels. The annotations
+// themselves are never removed. It runs on the leader only.
+type MigrationReporter struct {
+	Client   client.Client
+	Recorder record.EventRecorder
+	// Apply writes the missing labels instead of only reporting them.
+	Apply bool
+	// Interval between scans; defaults to 10 minutes.
+	Interval time.Duration
+}
+
+// Start implements manager.Runnable.
+func (r *MigrationReporter) Start(ctx context.Context) error {
+	interval := r.Interval
+	if interval <= 0 {
+		interval = defaultMigrationInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if err := r.Report(ctx); err != nil {
+			migrationLog.Error(err, "failed to scan for deprecated annotations")
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// NeedLeaderElection implements manager.LeaderElectionRunnable.
+func (r *MigrationReporter) NeedLeaderElection() bool {
+	return true
+}
+
+// Report scans once, migrates pending objects if Apply is set, and publishes
+// the result.
+func (r *MigrationReporter) Report(ctx context.Context) error {
+	uses, err := r.Scan(ctx)
+	if err != nil {
+		return err
+	}
+
+	deprecatedAnnotationObjects.Reset()
+	for i := range uses {
+		use := &uses[i]
+		if use.State == MigrationPending && r.Apply {
+			if err := r.migrate(ctx, use); err != nil {
+				migrationLog.Error(err, "failed to write equivalent labels", "kind", use.Kind, "namespace", use.Namespace, "name", use.Name)
+			} else {
+				use.State = MigrationDone
+				deprecatedAnnotationObjects.WithLabelValues(use.Kind, string(use.State)).Inc()
+				r.event(use.object, corev1.EventTypeNormal, "DeprecatedAnnotationMigrated",
+					fmt.Sprintf("set %s in place of deprecated annotation %s=%q", formatLabels(use.Missing), injector.DefaultCRAnnotation, use.Value))
+				continue
+			}
+		}
+		deprecatedAnnotationObjects.WithLabelValues(use.Kind, string(use.State)).Inc()
+
+		if use.State == MigrationPending {
+			r.event(use.object, corev1.EventTypeWarning, "DeprecatedAnnotation",
+				fmt.Sprintf("annotation %s is deprecated; set %s%s", injector.DefaultCRAnnotation, formatLabels(use.Missing), labelTarget(use.Kind)))
+		} else {
+			r.event(use.object, corev1.EventTypeNormal, "DeprecatedAnnotation",
+				fmt.Sprintf("no equivalent labels missing; annotation %s can be removed", injector.DefaultCRAnnotation))
+		}
+	}
+	migrationLog.Info("deprecated annotation scan", "objects", len(uses), "apply", r.Apply)
+	return nil
+}
+
+// Scan lists every object carrying the deprecated annotation, sorted by kind,
+// namespace and name. Kinds whose CRD is not installed are skipped.
+func (r *MigrationReporter) Scan(ctx context.Context) ([]DeprecatedUse, error) {
+	var uses []DeprecatedUse
+
+	namespaces := &corev1.NamespaceList{}
+	if err := r.Client.List(ctx, namespaces); err != nil {
+		return nil, fmt.Errorf("list namespaces: %w", err)
+	}
+	for i := range namespaces.Items {
+		ns := &namespaces.Items[i]
+		if _, ok := ns.Annotations[injector.DefaultNamespaceAnnotation]; ok {
+			uses = append(uses, newDeprecatedUse("Namespace", ns, ns.Labels, ""))
+		}
+	}
+
+	agents := &agentsv1alpha1.AgentList{}
+	if err := r.list(ctx, agents); err != nil {
+		return nil, err
+	}
+	for i := range agents.Items {
+		agent := &agents.Items[i]
+		if _, ok := agent.Annotations[injector.DefaultCRAnnotation]; ok {
+			uses = append(uses, newDeprecatedUse("Agent", agent, templateLabels(agent.Spec.PodTemplateSpec), injector.KagentiTypeAgent))
+		}
+	}
+
+	servers := &toolhivev1alpha1.MCPServerList{}
+	if err := r.list(ctx, servers); err != nil {
+		return nil, err
+	}
+	for i := range servers.Items {
+		server := &servers.Items[i]
+		if _, ok := server.Annotations[injector.DefaultCRAnnotation]; ok {
+			uses = append(uses, newDeprecatedUse("MCPServer", server, templateLabels(server.Spec.PodTemplateSpec), injector.KagentiTypeTool))
+		}
+	}
+
+	sort.Slice(uses, func(i, j int) bool {
+		a, b := uses[i], uses[j]
+		if a.Kind != b.Kind {
+			return a.Kind < b.Kind
+		}
+		if a.Namespace != b.Namespace {
+			return a.Namespace < b.Namespace
+		}
+		return a.Name < b.Name
+	})
+	return uses, nil
+}
+
+func (r *MigrationReporter) list(ctx context.Context, list client.ObjectList) error {
+	err := r.Client.List(ctx, list)
+	if meta.IsNoMatchError(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("list %T: %w", list, err)
+	}
+	return nil
+}
+
+// migrate merge-patches the missing labels onto the object.
+func (r *MigrationReporter) migrate(ctx context.Context, use *DeprecatedUse) error {
+	var template **corev1.PodTemplateSpec
+	switch obj := use.object.(type) {
+	case *corev1.Namespace:
+		patch := client.MergeFrom(obj.DeepCopy())
+		obj.Labels = withLabels(obj.Labels, use.Missing)
+		return r.Client.Patch(ctx, obj, patch)
+	case *agentsv1alpha1.Agent:
+		template = &obj.Spec.PodTemplateSpec
+	case *toolhivev1alpha1.MCPServer:
+		template = &obj.Spec.PodTemplateSpec
+	default:
+		return fmt.Errorf("unsupported kind %T", use.object)
+	}
+	patch := client.MergeFrom(use.object.DeepCopyObject().(client.Object))
+	if *template == nil {
+		*template = &corev1.PodTemplateSpec{}
+	}
+	(*template).Labels = withLabels((*template).Labels, use.Missing)
+	return r.Client.Patch(ctx, use.object, patch)
+}
+
+func (r *MigrationReporter) event(obj client.Object, eventType, reason, message string) {
+	if r.Recorder != nil {
+		r.Recorder.Event(obj, eventType, reason, message)
+	}
+}
+
+func templateLabels(t *corev1.PodTemplateSpec) map[string]string {
+	if t == nil {
+		return nil
+	}
+	return t.Labels
+}
+
+func withLabels(labels, add map[string]string) map[string]string {
+	if labels == nil {
+		labels = make(map[string]string, len(add))
+	}
+	for k, v := range add {
+		labels[k] = v
+	}
+	return labels
+}
+
+func labelTarget(kind string) string {
+	if kind == "Namespace" {
+		return " on the namespace"
+	}
+	return " on spec.podTemplateSpec"
+}
+
+func formatLabels(labels map[string]string) string {
+	pairs := make([]string, 0, len(labels))
+	for k, v := range labels {
+		pairs = append(pairs, fmt.Sprintf("%s=%s", k, v))
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ",")
+}
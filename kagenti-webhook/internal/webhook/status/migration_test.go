@@ -0,0 +1,134 @@
+package status
+
+import (
+	"context"
+	"maps"
+	"testing"
+
+	agentsv1alpha1 "github.com/kagenti/operator/api/v1alpha1"
+	toolhivev1alpha1 "github.com/stacklok/toolhive/cmd/thv-operator/api/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func newMigrationReporter(t *testing.T, apply bool, objs ...client.Object) (*MigrationReporter, *record.FakeRecorder) {
+	t.Helper()
+	scheme := runtime.NewScheme()
+	for _, add := range []func(*runtime.Scheme) error{clientgoscheme.AddToScheme, agentsv1alpha1.AddToScheme, toolhivev1alpha1.AddToScheme} {
+		if err := add(scheme); err != nil {
+			t.Fatalf("AddToScheme: %v", err)
+		}
+	}
+	recorder := record.NewFakeRecorder(16)
+	return &MigrationReporter{
+		Client:   fake.NewClientBuilder().WithScheme(scheme).WithObjects(objs...).Build(),
+		Recorder: recorder,
+		Apply:    apply,
+	}, recorder
+}
+
+func migrationObjects() []client.Object {
+	annotated := map[string]string{"kagenti.dev/inject": "true"}
+	return []client.Object{
+		&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "team1", Annotations: annotated}},
+		&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "team2"}},
+		&agentsv1alpha1.Agent{ObjectMeta: metav1.ObjectMeta{
+			Namespace: "team1", Name: "weather", Annotations: map[string]string{"kagenti.dev/inject": "false"},
+		}},
+		&toolhivev1alpha1.MCPServer{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "team1", Name: "fetch", Annotations: annotated},
+			Spec: toolhivev1alpha1.MCPServerSpec{PodTemplateSpec: &corev1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{Labels: map[string]string{"kagenti.io/type": "tool", "kagenti.io/inject": "enabled"}},
+			}},
+		},
+	}
+}
+
+func TestMigrationReporter_Scan(t *testing.T) {
+	r, _ := newMigrationReporter(t, false, migrationObjects()...)
+	uses, err := r.Scan(context.Background())
+	if err != nil {
+		t.Fatalf("Scan: %v", err)
+	}
+
+	want := []struct {
+		kind, name string
+		state      MigrationState
+		missing    map[string]string
+	}{
+		{"Agent", "weather", MigrationPending, map[string]string{"kagenti.io/type": "agent", "kagenti.io/inject": "disabled"}},
+		{"MCPServer", "fetch", MigrationDone, map[string]string{}},
+		{"Namespace", "team1", MigrationPending, map[string]string{"kagenti-enabled": "true"}},
+	}
+	if len(uses) != len(want) {
+		t.Fatalf("Scan() returned %d objects, want %d: %+v", len(uses), len(want), uses)
+	}
+	for i, w := range want {
+		got := uses[i]
+		if got.Kind != w.kind || got.Name != w.name || got.State != w.state || !maps.Equal(got.Missing, w.missing) {
+			t.Errorf("uses[%d] = %s/%s %s %v, want %s/%s %s %v", i, got.Kind, got.Name, got.State, got.Missing, w.kind, w.name, w.state, w.missing)
+		}
+	}
+}
+
+func TestMigrationReporter_ReportOnly(t *testing.T) {
+	r, recorder := newMigrationReporter(t, false, migrationObjects()...)
+	if err := r.Report(context.Background()); err != nil {
+		t.Fatalf("Report: %v", err)
+	}
+
+	ns := &corev1.Namespace{}
+	if err := r.Client.Get(context.Background(), types.NamespacedName{Name: "team1"}, ns); err != nil {
+		t.Fatalf("get namespace: %v", err)
+	}
+	if _, ok := ns.Labels["kagenti-enabled"]; ok {
+		t.Error("namespace labelled although Apply is off")
+	}
+	if n := len(recorder.Events); n != 3 {
+		t.Errorf("got %d events, want 3", n)
+	}
+}
+
+func TestMigrationReporter_Apply(t *testing.T) {
+	r, _ := newMigrationReporter(t, true, migrationObjects()...)
+	if err := r.Report(context.Background()); err != nil {
+		t.Fatalf("Report: %v", err)
+	}
+
+	ns := &corev1.Namespace{}
+	if err := r.Client.Get(context.Background(), types.NamespacedName{Name: "team1"}, ns); err != nil {
+		t.Fatalf("get namespace: %v", err)
+	}
+	if ns.Labels["kagenti-enabled"] != "true" {
+		t.Errorf("namespace labels = %v, want kagenti-enabled=true", ns.Labels)
+	}
+	if ns.Annotations["kagenti.dev/inject"] != "true" {
+		t.Error("deprecated annotation must be kept")
+	}
+
+	agent := &agentsv1alpha1.Agent{}
+	if err := r.Client.Get(context.Background(), types.NamespacedName{Namespace: "team1", Name: "weather"}, agent); err != nil {
+		t.Fatalf("get agent: %v", err)
+	}
+	want := map[string]string{"kagenti.io/type": "agent", "kagenti.io/inject": "disabled"}
+	if agent.Spec.PodTemplateSpec == nil || !maps.Equal(agent.Spec.PodTemplateSpec.Labels, want) {
+		t.Errorf("agent pod template = %+v, want labels %v", agent.Spec.PodTemplateSpec, want)
+	}
+
+	// Everything is migrated now
+	uses, err := r.Scan(context.Background())
+	if err != nil {
+		t.Fatalf("Scan: %v", err)
+	}
+	for _, use := range uses {
+		if use.State != MigrationDone {
+			t.Errorf("%s/%s still %s", use.Kind, use.Name, use.State)
+		}
+	}
+}
@@ -0,0 +1,320 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package status
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	autoscalingv2 "k8s.io/api/autoscaling/v2"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+
+	"github.com/kagenti/kagenti-extensions/kagenti-webhook/internal/webhook/config"
+	"github.com/kagenti/kagenti-extensions/kagenti-webhook/internal/webhook/injector"
+)
+
+var sidecarCostLog = logf.Log.WithName("sidecar-cost-report")
+
+// Scopes of a sidecar cost figure.
+const (
+	// CostInjected is what the sidecars running today request.
+	CostInjected = "injected"
+	// CostProjected is what they would request if every agent and tool pod
+	// ran the sidecars the current config injects.
+	CostProjected = "projected"
+	// CostProjectedMaxScale is CostProjected with HPA-scaled workloads at
+	// their maxReplicas.
+	CostProjectedMaxScale = "projected-max-scale"
+)
+
+const defaultSidecarCostInterval = 15 * time.Minute
+
+var sidecarResources = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+	Name: "kagenti_webhook_sidecar_resources",
+	Help: "Aggregate CPU (cores) and memory (bytes) of AuthBridge sidecars per namespace, by scope (injected, projected, projected-max-scale) and type (requests, limits).",
+}, []string{"namespace", "scope", "resource", "type"})
+
+func init() {
+	metrics.Registry.MustRegister(sidecarResources)
+}
+
+// SidecarResources sums the resources of the sidecars of Pods pods.
+type SidecarResources struct {
+	Pods     int                 `json:"pods"`
+	Requests corev1.ResourceList `json:"requests,omitempty"`
+	Limits   corev1.ResourceList `json:"limits,omitempty"`
+}
+
+func (s *SidecarResources) add(requirements corev1.ResourceRequirements, times int64) {
+	s.Requests = addResources(s.Requests, requirements.Requests, times)
+	s.Limits = addResources(s.Limits, requirements.Limits, times)
+}
+
+func (s SidecarResources) requirements() corev1.ResourceRequirements {
+	return corev1.ResourceRequirements{Requests: s.Requests, Limits: s.Limits}
+}
+
+func addResources(dst, src corev1.ResourceList, times int64) corev1.ResourceList {
+	for name, q := range src {
+		if dst == nil {
+			dst = corev1.ResourceList{}
+		}
+		q = q.DeepCopy()
+		q.Mul(times)
+		sum := dst[name]
+		sum.Add(q)
+		dst[name] = sum
+	}
+	return dst
+}
+
+// NamespaceSidecarCost is the sidecar cost of one namespace's agent and tool
+// pods.
+type NamespaceSidecarCost struct {
+	Namespace         string           `json:"namespace"`
+	Injected          SidecarResources `json:"injected"`
+	Projected         SidecarResources `json:"projected"`
+	ProjectedMaxScale SidecarResources `json:"projectedMaxScale"`
+}
+
+// SidecarCostReport lists the sidecar cost of every namespace with agent or
+// tool pods.
+type SidecarCostReport struct {
+	GeneratedAt metav1.Time            `json:"generatedAt"`
+	Namespaces  []NamespaceSidecarCost `json:"namespaces"`
+}
+
+// ComputeSidecarCost returns the sidecar cost of ns given its pods and
+// HorizontalPodAutoscalers. Only running agent and tool pods count, and only
+// sidecar containers: proxy-init runs before the app and is not included.
+//
+// The projection assumes the namespace is opted in and the global kill switch
+// is on; workload opt-outs, per-sidecar feature gates and labels and platform
+// defaults still apply, so it shows what opting the namespace in would cost.
+func ComputeSidecarCost(ns *corev1.Namespace, pods []corev1.Pod, hpas []autoscalingv2.HorizontalPodAutoscaler,
+	fg *config.FeatureGates, pc *config.PlatformConfig) NamespaceSidecarCost {
+	if fg == nil {
+		fg = config.DefaultFeatureGates()
+	}
+	if pc == nil {
+		pc = config.CompiledDefaults()
+	}
+	fg = fg.DeepCopy()
+	fg.GlobalEnabled = true
+	nsLabels := map[string]string{injector.LabelNamespaceInject: "true"}
+	for k, v := range ns.Labels {
+		if k != injector.LabelNamespaceInject {
+			nsLabels[k] = v
+		}
+	}
+	evaluator := injector.NewPrecedenceEvaluator(fg, pc)
+
+	cost := NamespaceSidecarCost{Namespace: ns.Name}
+	// Projected cost and pod count per HPA-scalable workload
+	type scaled struct {
+		pods int
+		cost SidecarResources
+	}
+	workloads := make(map[string]*scaled)
+
+	for i := range pods {
+		pod := &pods[i]
+		if !isAgentOrTool(pod.Labels) || pod.Status.Phase == corev1.PodSucceeded || pod.Status.Phase == corev1.PodFailed {
+			continue
+		}
+
+		if hasInjectedSidecar(&pod.Spec) {
+			cost.Injected.Pods++
+			for _, c := range pod.Spec.Containers {
+				if isSidecar(c.Name) {
+					cost.Injected.add(c.Resources, 1)
+				}
+			}
+		}
+
+		if v, ok := pod.Labels[injector.AuthBridgeInjectLabel]; ok && v != injector.AuthBridgeInjectValue {
+			continue
+		}
+		var podCost SidecarResources
+		decision := evaluator.Evaluate(nsLabels, pod.Labels, nil)
+		if decision.EnvoyProxy.Inject {
+			podCost.add(pc.Resources.EnvoyProxy, 1)
+		}
+		if decision.SpiffeHelper.Inject {
+			podCost.add(pc.Resources.SpiffeHelper, 1)
+		}
+		if decision.ClientRegistration.Inject {
+			podCost.add(pc.Resources.ClientRegistration, 1)
+		}
+		if !decision.AnyInjected() {
+			continue
+		}
+		cost.Projected.Pods++
+		cost.Projected.add(podCost.requirements(), 1)
+
+		if workload := podWorkload(pod); workload != "" {
+			if workloads[workload] == nil {
+				workloads[workload] = &scaled{cost: podCost}
+			}
+			workloads[workload].pods++
+		}
+	}
+
+	// Scale HPA targets from their current replicas to maxReplicas
+	cost.ProjectedMaxScale.Pods = cost.Projected.Pods
+	cost.ProjectedMaxScale.add(cost.Projected.requirements(), 1)
+	for _, hpa := range hpas {
+		ref := hpa.Spec.ScaleTargetRef
+		w := workloads[ref.Kind+"/"+ref.Name]
+		if w == nil || int(hpa.Spec.MaxReplicas) <= w.pods {
+			continue
+		}
+		extra := int64(hpa.Spec.MaxReplicas) - int64(w.pods)
+		cost.ProjectedMaxScale.Pods += int(extra)
+		cost.ProjectedMaxScale.add(w.cost.requirements(), extra)
+	}
+	return cost
+}
+
+// podWorkload returns "Kind/name" of the workload an HPA would scale to
+// change the number of pods like pod: its Deployment (found through the
+// ReplicaSet's pod-template-hash suffix) or StatefulSet.
+func podWorkload(pod *corev1.Pod) string {
+	owner := metav1.GetControllerOf(pod)
+	if owner == nil {
+		return ""
+	}
+	switch owner.Kind {
+	case "ReplicaSet":
+		hash := pod.Labels["pod-template-hash"]
+		if hash == "" || !strings.HasSuffix(owner.Name, "-"+hash) {
+			return "ReplicaSet/" + owner.Name
+		}
+		return "Deployment/" + strings.TrimSuffix(owner.Name, "-"+hash)
+	case "StatefulSet":
+		return "StatefulSet/" + owner.Name
+	}
+	return ""
+}
+
+// BuildSidecarCostReport computes the sidecar cost of every namespace with
+// agent or tool pods.
+func BuildSidecarCostReport(ctx context.Context, c client.Client, fg *config.FeatureGates, pc *config.PlatformConfig) (*SidecarCostReport, error) {
+	namespaces := &corev1.NamespaceList{}
+	if err := c.List(ctx, namespaces); err != nil {
+		return nil, fmt.Errorf("list namespaces: %w", err)
+	}
+	pods := &corev1.PodList{}
+	if err := c.List(ctx, pods); err != nil {
+		return nil, fmt.Errorf("list pods: %w", err)
+	}
+	hpas := &autoscalingv2.HorizontalPodAutoscalerList{}
+	if err := c.List(ctx, hpas); err != nil {
+		return nil, fmt.Errorf("list horizontal pod autoscalers: %w", err)
+	}
+
+	podsByNS := make(map[string][]corev1.Pod)
+	for _, p := range pods.Items {
+		if isAgentOrTool(p.Labels) {
+			podsByNS[p.Namespace] = append(podsByNS[p.Namespace], p)
+		}
+	}
+	hpasByNS := make(map[string][]autoscalingv2.HorizontalPodAutoscaler)
+	for _, h := range hpas.Items {
+		hpasByNS[h.Namespace] = append(hpasByNS[h.Namespace], h)
+	}
+
+	report := &SidecarCostReport{GeneratedAt: metav1.Now()}
+	for i := range namespaces.Items {
+		ns := &namespaces.Items[i]
+		if len(podsByNS[ns.Name]) == 0 {
+			continue
+		}
+		report.Namespaces = append(report.Namespaces, ComputeSidecarCost(ns, podsByNS[ns.Name], hpasByNS[ns.Name], fg, pc))
+	}
+	sort.Slice(report.Namespaces, func(i, j int) bool { return report.Namespaces[i].Namespace < report.Namespaces[j].Namespace })
+	return report, nil
+}
+
+// SidecarCostReporter periodically exports the sidecar cost report as the
+// kagenti_webhook_sidecar_resources metric. It runs on the leader only.
+type SidecarCostReporter struct {
+	// Client should be uncached for pods, like AdoptionReporter's.
+	Client            client.Client
+	GetPlatformConfig func() *config.PlatformConfig
+	GetFeatureGates   func() *config.FeatureGates
+	// Interval between reports; defaults to 15 minutes.
+	Interval time.Duration
+}
+
+// Start implements manager.Runnable.
+func (r *SidecarCostReporter) Start(ctx context.Context) error {
+	interval := r.Interval
+	if interval <= 0 {
+		interval = defaultSidecarCostInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if err := r.Report(ctx); err != nil {
+			sidecarCostLog.Error(err, "failed to build sidecar cost report")
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// NeedLeaderElection implements manager.LeaderElectionRunnable.
+func (r *SidecarCostReporter) NeedLeaderElection() bool {
+	return true
+}
+
+// Report builds the report once and exports it.
+func (r *SidecarCostReporter) Report(ctx context.Context) error {
+	report, err := BuildSidecarCostReport(ctx, r.Client, r.GetFeatureGates(), r.GetPlatformConfig())
+	if err != nil {
+		return err
+	}
+
+	sidecarResources.Reset()
+	for _, ns := range report.Namespaces {
+		for scope, res := range map[string]SidecarResources{
+			CostInjected:          ns.Injected,
+			CostProjected:         ns.Projected,
+			CostProjectedMaxScale: ns.ProjectedMaxScale,
+		} {
+			for _, name := range []corev1.ResourceName{corev1.ResourceCPU, corev1.ResourceMemory} {
+				requests, limits := res.Requests[name], res.Limits[name]
+				sidecarResources.WithLabelValues(ns.Namespace, scope, string(name), "requests").Set(requests.AsApproximateFloat64())
+				sidecarResources.WithLabelValues(ns.Namespace, scope, string(name), "limits").Set(limits.AsApproximateFloat64())
+			}
+		}
+	}
+	sidecarCostLog.Info("sidecar cost report", "namespaces", len(report.Namespaces))
+	return nil
+}
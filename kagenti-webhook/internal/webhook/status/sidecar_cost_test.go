@@ -0,0 +1,118 @@
+package status
+
+import (
+	"context"
+	"testing"
+
+	"github.com/kagenti/kagenti-extensions/kagenti-webhook/internal/webhook/config"
+	autoscalingv2 "k8s.io/api/autoscaling/v2"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func ownedBy(p *corev1.Pod, kind, name, hash string) *corev1.Pod {
+	p.OwnerReferences = []metav1.OwnerReference{{Kind: kind, Name: name, Controller: ptr.To(true)}}
+	if hash != "" {
+		p.Labels["pod-template-hash"] = hash
+	}
+	return p
+}
+
+func hpa(ns, kind, name string, maxReplicas int32) autoscalingv2.HorizontalPodAutoscaler {
+	return autoscalingv2.HorizontalPodAutoscaler{
+		ObjectMeta: metav1.ObjectMeta{Namespace: ns, Name: name},
+		Spec: autoscalingv2.HorizontalPodAutoscalerSpec{
+			ScaleTargetRef: autoscalingv2.CrossVersionObjectReference{Kind: kind, Name: name},
+			MaxReplicas:    maxReplicas,
+		},
+	}
+}
+
+// sum adds the requests of reqs, each counted times times.
+func sum(name corev1.ResourceName, times int64, reqs ...corev1.ResourceRequirements) resource.Quantity {
+	var total resource.Quantity
+	for _, r := range reqs {
+		q := r.Requests[name].DeepCopy()
+		q.Mul(times)
+		total.Add(q)
+	}
+	return total
+}
+
+func TestComputeSidecarCost(t *testing.T) {
+	pc := config.CompiledDefaults()
+	envoy, spiffe, registration := pc.Resources.EnvoyProxy, pc.Resources.SpiffeHelper, pc.Resources.ClientRegistration
+
+	injected := pod("team1", "agent-7d9f-abc", "agent", "app", "envoy-proxy")
+	injected.Spec.Containers[1].Resources = envoy
+	ownedBy(injected, "ReplicaSet", "agent-7d9f", "7d9f")
+	plain := ownedBy(pod("team1", "tool-0", "tool", "app"), "StatefulSet", "tool", "")
+	plain.Labels["kagenti.io/spire"] = "enabled"
+	optedOut := pod("team1", "legacy", "agent", "app")
+	optedOut.Labels["kagenti.io/inject"] = "disabled"
+	unrelated := pod("team1", "db", "", "postgres")
+
+	cost := ComputeSidecarCost(namespace("team1", nil),
+		[]corev1.Pod{*injected, *plain, *optedOut, *unrelated},
+		[]autoscalingv2.HorizontalPodAutoscaler{hpa("team1", "Deployment", "agent", 4), hpa("team1", "Deployment", "other", 10)},
+		nil, pc)
+
+	if cost.Injected.Pods != 1 {
+		t.Errorf("injected pods = %d, want 1", cost.Injected.Pods)
+	}
+	if got, want := cost.Injected.Requests[corev1.ResourceCPU], envoy.Requests[corev1.ResourceCPU]; got.Cmp(want) != 0 {
+		t.Errorf("injected cpu requests = %s, want %s", got.String(), want.String())
+	}
+
+	// The namespace is not opted in: the projection opts it in
+	if cost.Projected.Pods != 2 {
+		t.Errorf("projected pods = %d, want 2", cost.Projected.Pods)
+	}
+	want := sum(corev1.ResourceMemory, 1, envoy, registration, envoy, registration, spiffe)
+	if got := cost.Projected.Requests[corev1.ResourceMemory]; got.Cmp(want) != 0 {
+		t.Errorf("projected memory requests = %s, want %s", got.String(), want.String())
+	}
+
+	// The agent Deployment scales from 1 to 4 pods
+	if cost.ProjectedMaxScale.Pods != 5 {
+		t.Errorf("max-scale pods = %d, want 5", cost.ProjectedMaxScale.Pods)
+	}
+	want = sum(corev1.ResourceCPU, 1, envoy, registration, spiffe)
+	want.Add(sum(corev1.ResourceCPU, 4, envoy, registration))
+	if got := cost.ProjectedMaxScale.Requests[corev1.ResourceCPU]; got.Cmp(want) != 0 {
+		t.Errorf("max-scale cpu requests = %s, want %s", got.String(), want.String())
+	}
+}
+
+func TestSidecarCostReporter_Report(t *testing.T) {
+	objs := []client.Object{
+		namespace("kagenti-system", nil),
+		namespace("team1", map[string]string{"kagenti-enabled": "true"}),
+		namespace("team2", nil),
+		pod("team1", "agent", "agent", "app", "envoy-proxy"),
+		pod("team2", "tool", "tool", "app"),
+		pod("kagenti-system", "webhook", "", "manager"),
+	}
+	r := &SidecarCostReporter{
+		Client:            fake.NewClientBuilder().WithObjects(objs...).Build(),
+		GetPlatformConfig: config.CompiledDefaults,
+		GetFeatureGates:   config.DefaultFeatureGates,
+	}
+	report, err := BuildSidecarCostReport(context.Background(), r.Client, r.GetFeatureGates(), r.GetPlatformConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Namespaces) != 2 || report.Namespaces[0].Namespace != "team1" || report.Namespaces[1].Namespace != "team2" {
+		t.Fatalf("namespaces = %+v, want team1 and team2", report.Namespaces)
+	}
+	if report.Namespaces[1].Injected.Pods != 0 || report.Namespaces[1].Projected.Pods != 1 {
+		t.Errorf("team2 = %+v, want 0 injected and 1 projected pod", report.Namespaces[1])
+	}
+	if err := r.Report(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -19,12 +19,16 @@ package v1alpha1
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"net/http"
 
 	"github.com/kagenti/kagenti-extensions/kagenti-webhook/internal/webhook/injector"
 	appsv1 "k8s.io/api/apps/v1"
 	batchv1 "k8s.io/api/batch/v1"
 	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/record"
 	ctrl "sigs.k8s.io/controller-runtime"
 	logf "sigs.k8s.io/controller-runtime/pkg/log"
 	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
@@ -35,15 +39,17 @@ var authbridgelog = logf.Log.WithName("authbridge-webhook")
 
 // AuthBridgeWebhook handles mutation of workload resources for AuthBridge injection
 type AuthBridgeWebhook struct {
-	Mutator *injector.PodMutator
-	decoder admission.Decoder
+	Mutator  *injector.PodMutator
+	Recorder record.EventRecorder
+	decoder  admission.Decoder
 }
 
 // SetupAuthBridgeWebhookWithManager registers the authbridge webhook with the manager
 func SetupAuthBridgeWebhookWithManager(mgr ctrl.Manager, mutator *injector.PodMutator) error {
 	webhook := &AuthBridgeWebhook{
-		Mutator: mutator,
-		decoder: admission.NewDecoder(mgr.GetScheme()),
+		Mutator:  mutator,
+		Recorder: mgr.GetEventRecorderFor("kagenti-webhook"),
+		decoder:  admission.NewDecoder(mgr.GetScheme()),
 	}
 
 	mgr.GetWebhookServer().Register("/mutate-workloads-authbridge", &admission.Webhook{
@@ -63,7 +69,7 @@ func (w *AuthBridgeWebhook) Handle(ctx context.Context, req admission.Request) a
 
 	var podSpec *corev1.PodSpec
 	var resourceName string
-	var mutatedObj interface{}
+	var mutatedObj runtime.Object
 	var labels map[string]string
 
 	// Extract PodSpec based on resource type
@@ -128,6 +134,8 @@ func (w *AuthBridgeWebhook) Handle(ctx context.Context, req admission.Request) a
 		return admission.Allowed("unsupported kind")
 	}
 
+	var rejection injector.Rejection
+
 	// Check if already injected (idempotency)
 	if w.isAlreadyInjected(podSpec) {
 		authbridgelog.Info("Skipping - sidecars already injected",
@@ -137,7 +145,15 @@ func (w *AuthBridgeWebhook) Handle(ctx context.Context, req admission.Request) a
 		return admission.Allowed("already injected")
 	}
 
-	if mutated, err := w.Mutator.InjectAuthBridge(ctx, podSpec, req.Namespace, resourceName, labels); err != nil {
+	if mutated, err := w.Mutator.InjectAuthBridge(ctx, podSpec, req.Namespace, resourceName, labels); errors.As(err, &rejection) {
+		authbridgelog.Info("Rejecting resource",
+			"kind", req.Kind.Kind,
+			"namespace", req.Namespace,
+			"name", resourceName,
+			"policy", rejection.Reason(),
+			"reason", rejection.Error())
+		return admission.Denied(rejection.Error())
+	} else if err != nil {
 		authbridgelog.Error(err, "Failed to mutate pod spec",
 			"kind", req.Kind.Kind,
 			"namespace", req.Namespace,
@@ -163,7 +179,65 @@ func (w *AuthBridgeWebhook) Handle(ctx context.Context, req admission.Request) a
 		"namespace", req.Namespace,
 		"name", resourceName)
 
-	return admission.PatchResponseFromRaw(req.Object.Raw, marshaledMutated)
+	resp := admission.PatchResponseFromRaw(req.Object.Raw, marshaledMutated)
+	resp.Warnings = w.checkReferences(ctx, podSpec, req.Namespace, mutatedObj)
+	resp.Warnings = append(resp.Warnings, w.checkImagePin(ctx, req.Namespace, mutatedObj)...)
+	resp.Warnings = append(resp.Warnings, injector.PodNamespacesWarnings(podSpec)...)
+	resp.Warnings = append(resp.Warnings, w.checkPodLimits(podSpec, req.Namespace, mutatedObj)...)
+	return resp
+}
+
+// checkReferences warns (admission warning + Event on the workload) about
+// ConfigMaps or keys the injected sidecars need but that are missing in the
+// namespace. Lookup failures are logged and never block admission.
+func (w *AuthBridgeWebhook) checkReferences(ctx context.Context, podSpec *corev1.PodSpec, namespace string, obj runtime.Object) []string {
+	warnings, err := w.Mutator.CheckSidecarReferences(ctx, podSpec, namespace)
+	if err != nil {
+		authbridgelog.Error(err, "Failed to verify sidecar references", "namespace", namespace)
+	}
+	// Objects being created may not carry their namespace yet; the Event
+	// must still land in the workload's namespace.
+	if accessor, err := meta.Accessor(obj); err == nil && accessor.GetNamespace() == "" {
+		accessor.SetNamespace(namespace)
+	}
+	for _, warning := range warnings {
+		authbridgelog.Info("Missing sidecar reference", "namespace", namespace, "warning", warning)
+		if w.Recorder != nil {
+			w.Recorder.Event(obj, corev1.EventTypeWarning, "MissingSidecarReference", warning)
+		}
+	}
+	return warnings
+}
+
+// checkImagePin warns (admission warning + Event on the workload) when the
+// injected images come from a pin past its expiry. Lookup failures are logged
+// and never block admission.
+func (w *AuthBridgeWebhook) checkImagePin(ctx context.Context, namespace string, obj runtime.Object) []string {
+	warning, err := w.Mutator.CheckImagePin(ctx, namespace)
+	if err != nil {
+		authbridgelog.Error(err, "Failed to check image pin", "namespace", namespace)
+	}
+	if warning == "" {
+		return nil
+	}
+	authbridgelog.Info("Stale image pin", "namespace", namespace, "warning", warning)
+	if w.Recorder != nil {
+		w.Recorder.Event(obj, corev1.EventTypeWarning, "StaleImagePin", warning)
+	}
+	return []string{warning}
+}
+
+// checkPodLimits warns (admission warning + Event on the workload) when the
+// injected pod exceeds the podLimits policy and its action is warn.
+func (w *AuthBridgeWebhook) checkPodLimits(podSpec *corev1.PodSpec, namespace string, obj runtime.Object) []string {
+	warnings := injector.PodLimitsWarnings(podSpec, w.Mutator.GetPlatformConfig().PodLimits)
+	for _, warning := range warnings {
+		authbridgelog.Info("Injected pod exceeds limits", "namespace", namespace, "warning", warning)
+		if w.Recorder != nil {
+			w.Recorder.Event(obj, corev1.EventTypeWarning, "PodLimitsExceeded", warning)
+		}
+	}
+	return warnings
 }
 
 func (w *AuthBridgeWebhook) isAlreadyInjected(podSpec *corev1.PodSpec) bool {
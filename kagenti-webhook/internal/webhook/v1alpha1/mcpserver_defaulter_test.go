@@ -0,0 +1,190 @@
+package v1alpha1
+
+import (
+	"context"
+	"encoding/json"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/kagenti/kagenti-extensions/kagenti-webhook/internal/webhook/config"
+	"github.com/kagenti/kagenti-extensions/kagenti-webhook/internal/webhook/injector"
+	toolhivestacklokdevv1alpha1 "github.com/stacklok/toolhive/cmd/thv-operator/api/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func newTestMCPServerDefaulter(t *testing.T, cfg *config.PlatformConfig) *MCPServerCustomDefaulter {
+	t.Helper()
+	scheme := runtime.NewScheme()
+	if err := clientgoscheme.AddToScheme(scheme); err != nil {
+		t.Fatalf("AddToScheme: %v", err)
+	}
+	ns := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{
+		Name:   "team1",
+		Labels: map[string]string{injector.LabelNamespaceInject: "true"},
+	}}
+	c := fake.NewClientBuilder().WithScheme(scheme).WithObjects(ns).Build()
+	mutator := injector.NewPodMutator(c, true,
+		func() *config.PlatformConfig { return cfg },
+		func() *config.FeatureGates { return config.DefaultFeatureGates() },
+	)
+	return &MCPServerCustomDefaulter{Mutator: mutator}
+}
+
+func newTestMCPServer() *toolhivestacklokdevv1alpha1.MCPServer {
+	return &toolhivestacklokdevv1alpha1.MCPServer{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "team1", Name: "fetch"},
+		Spec: toolhivestacklokdevv1alpha1.MCPServerSpec{PodTemplateSpec: &corev1.PodTemplateSpec{
+			Spec: corev1.PodSpec{
+				Containers: []corev1.Container{{Name: "mcp", Image: "ghcr.io/example/fetch:1.0"}},
+				Volumes:    []corev1.Volume{{Name: "cache"}},
+			},
+		}},
+	}
+}
+
+func TestMCPServerDefault_Idempotent(t *testing.T) {
+	secretStore := config.CompiledDefaults()
+	secretStore.ClientRegistration.CredentialStore = config.CredentialStoreSecret
+	gated := config.CompiledDefaults()
+	gated.ClientRegistration.CredentialStore = config.CredentialStoreSecret
+	gated.ClientRegistration.WaitForRegistration = true
+
+	for name, cfg := range map[string]*config.PlatformConfig{
+		"defaults":              config.CompiledDefaults(),
+		"secret store":          secretStore,
+		"wait for registration": gated,
+	} {
+		t.Run(name, func(t *testing.T) {
+			d := newTestMCPServerDefaulter(t, cfg)
+			ctx := context.Background()
+
+			first := newTestMCPServer()
+			if err := d.Default(ctx, first); err != nil {
+				t.Fatalf("Default: %v", err)
+			}
+			if first.Spec.PodTemplateSpec.Annotations[injector.AnnotationInjectedSidecars] == "" {
+				t.Fatal("expected sidecars to be injected")
+			}
+
+			// Defaulting the stored object again is a no-op
+			again := first.DeepCopy()
+			for range 3 {
+				if err := d.Default(ctx, again); err != nil {
+					t.Fatalf("Default: %v", err)
+				}
+			}
+			if !equality.Semantic.DeepEqual(again.Spec, first.Spec) {
+				t.Errorf("repeated Default changed the spec:\n got %+v\nwant %+v", again.Spec, first.Spec)
+			}
+
+			// A re-apply carrying only some of the injected sidecars, in a
+			// different order, converges on the same spec
+			partial := newTestMCPServer()
+			for _, c := range first.Spec.PodTemplateSpec.Spec.Containers {
+				if c.Name == injector.EnvoyProxyContainerName {
+					partial.Spec.PodTemplateSpec.Spec.Containers = append([]corev1.Container{c}, partial.Spec.PodTemplateSpec.Spec.Containers...)
+				}
+			}
+			if err := d.Default(ctx, partial); err != nil {
+				t.Fatalf("Default: %v", err)
+			}
+			if !equality.Semantic.DeepEqual(partial.Spec, first.Spec) {
+				t.Errorf("re-applied spec differs:\n got %+v\nwant %+v", partial.Spec, first.Spec)
+			}
+		})
+	}
+}
+
+func TestMCPServerDefault_WaitForRegistration(t *testing.T) {
+	cfg := config.CompiledDefaults()
+	cfg.ClientRegistration.WaitForRegistration = true
+	d := newTestMCPServerDefaulter(t, cfg)
+
+	server := newTestMCPServer()
+	if err := d.Default(context.Background(), server); err != nil {
+		t.Fatalf("Default: %v", err)
+	}
+	spec := server.Spec.PodTemplateSpec.Spec
+	for _, c := range spec.Containers {
+		if c.Name == injector.ClientRegistrationContainerName || c.Name == injector.SpiffeHelperContainerName {
+			t.Errorf("%s is still a regular container", c.Name)
+		}
+	}
+	var order []string
+	for _, c := range spec.InitContainers {
+		order = append(order, c.Name)
+		switch c.Name {
+		case injector.ClientRegistrationContainerName:
+			if c.StartupProbe == nil {
+				t.Error("client-registration has no startup probe")
+			}
+			fallthrough
+		case injector.SpiffeHelperContainerName:
+			if c.RestartPolicy == nil || *c.RestartPolicy != corev1.ContainerRestartPolicyAlways {
+				t.Errorf("%s is not a native sidecar", c.Name)
+			}
+		}
+	}
+	want := []string{injector.SpiffeHelperContainerName, injector.ClientRegistrationContainerName}
+	if !slices.Equal(order, want) {
+		t.Errorf("init containers = %v, want %v", order, want)
+	}
+
+	// Turning the option off moves the sidecars back
+	cfg.ClientRegistration.WaitForRegistration = false
+	if err := d.Default(context.Background(), server); err != nil {
+		t.Fatalf("Default: %v", err)
+	}
+	if got := server.Spec.PodTemplateSpec.Spec.InitContainers; len(got) != 0 {
+		t.Errorf("init containers after disabling = %d, want none", len(got))
+	}
+}
+
+func TestMCPServerDefault_InjectionRecord(t *testing.T) {
+	cfg := config.CompiledDefaults()
+	d := newTestMCPServerDefaulter(t, cfg)
+
+	server := newTestMCPServer()
+	if err := d.Default(context.Background(), server); err != nil {
+		t.Fatalf("Default: %v", err)
+	}
+	var record injector.InjectionRecord
+	if err := json.Unmarshal([]byte(server.Spec.PodTemplateSpec.Annotations[injector.AnnotationInjection]), &record); err != nil {
+		t.Fatalf("%s: %v", injector.AnnotationInjection, err)
+	}
+	if record.WebhookVersion == "" || record.ConfigHash == "" {
+		t.Errorf("incomplete record %+v", record)
+	}
+	if want := strings.Split(server.Spec.PodTemplateSpec.Annotations[injector.AnnotationInjectedSidecars], ","); !slices.Equal(record.Containers, want) {
+		t.Errorf("containers = %v, want %v", record.Containers, want)
+	}
+
+	// A config change shows in the hash of the next defaulting
+	cfg.Proxy.Port++
+	if err := d.Default(context.Background(), server); err != nil {
+		t.Fatalf("Default: %v", err)
+	}
+	var updated injector.InjectionRecord
+	if err := json.Unmarshal([]byte(server.Spec.PodTemplateSpec.Annotations[injector.AnnotationInjection]), &updated); err != nil {
+		t.Fatalf("%s: %v", injector.AnnotationInjection, err)
+	}
+	if updated.ConfigHash == record.ConfigHash {
+		t.Errorf("config hash %s did not change with the config", updated.ConfigHash)
+	}
+
+	// Opting out removes the record along with the sidecars
+	optedOut := newTestMCPServer()
+	optedOut.Annotations = map[string]string{injector.DefaultCRAnnotation: "false"}
+	if err := d.Default(context.Background(), optedOut); err != nil {
+		t.Fatalf("Default: %v", err)
+	}
+	if _, ok := optedOut.Spec.PodTemplateSpec.Annotations[injector.AnnotationInjection]; ok {
+		t.Errorf("unexpected %s on a pod template without sidecars", injector.AnnotationInjection)
+	}
+}
@@ -20,6 +20,7 @@ import (
 	"context"
 	"fmt"
 
+	"github.com/kagenti/kagenti-extensions/kagenti-webhook/internal/webhook/config"
 	"github.com/kagenti/kagenti-extensions/kagenti-webhook/internal/webhook/injector"
 	toolhivestacklokdevv1alpha1 "github.com/stacklok/toolhive/cmd/thv-operator/api/v1alpha1"
 	corev1 "k8s.io/api/core/v1"
@@ -72,14 +73,59 @@ func (d *MCPServerCustomDefaulter) Default(ctx context.Context, obj runtime.Obje
 		}
 	}
 
+	// Sidecars gated on registration by an earlier defaulting are mutated as
+	// regular containers and gated again below
+	injector.UngateRegistration(&mcpserver.Spec.PodTemplateSpec.Spec)
+
 	// Use shared pod mutator for injection
-	return d.Mutator.MutatePodSpec(
+	if err := d.Mutator.MutatePodSpec(
 		ctx,
 		&mcpserver.Spec.PodTemplateSpec.Spec,
 		mcpserver.Namespace,
 		mcpserver.Name,
 		mcpserver.Annotations,
-	)
+	); err != nil {
+		return err
+	}
+
+	platformConfig := d.Mutator.GetPlatformConfig()
+	if err := injector.ApplyClientRegistrationOverrides(&mcpserver.Spec.PodTemplateSpec.Spec,
+		mcpserver.Annotations, platformConfig.Overrides.ClientRegistration); err != nil {
+		return fmt.Errorf("MCPServer %s/%s: %w", mcpserver.Namespace, mcpserver.Name, err)
+	}
+
+	// Register the client in the tenant's realm on multi-tenant clusters
+	realm, err := d.Mutator.KeycloakRealmFor(ctx, mcpserver.Namespace, mcpserver.Annotations)
+	if err != nil {
+		return fmt.Errorf("MCPServer %s/%s: %w", mcpserver.Namespace, mcpserver.Name, err)
+	}
+	if realm != nil {
+		injector.UseKeycloakRealm(&mcpserver.Spec.PodTemplateSpec.Spec, realm)
+	}
+
+	// Keep registered client credentials in a Secret owned by the MCPServer
+	if platformConfig.ClientRegistration.CredentialStore == config.CredentialStoreSecret {
+		injector.UseCredentialsSecret(&mcpserver.Spec.PodTemplateSpec.Spec, injector.CredentialsOwner{
+			APIVersion: toolhivestacklokdevv1alpha1.GroupVersion.String(),
+			Kind:       "MCPServer",
+			Resource:   "mcpservers",
+			Name:       mcpserver.Name,
+		})
+	}
+
+	// Keep the MCP server from starting before its OAuth client exists
+	if platformConfig.ClientRegistration.WaitForRegistration {
+		injector.GateOnRegistration(&mcpserver.Spec.PodTemplateSpec.Spec)
+	}
+
+	// GitOps tools re-apply the MCPServer constantly; canonical output keeps
+	// repeated defaulting a no-op instead of a stream of reordering diffs
+	injector.NormalizeInjectedPodTemplate(mcpserver.Spec.PodTemplateSpec)
+
+	// Let the pods the toolhive operator generates be traced back to this
+	// defaulting
+	injector.RecordInjection(mcpserver.Spec.PodTemplateSpec, platformConfig, d.Mutator.GetFeatureGates())
+	return nil
 }
 
 // TODO(user): change verbs to "verbs=create;update;delete" if you want to enable deletion validation.
@@ -119,7 +119,7 @@ echo ""
 
 # Step 1: Build and load image
 echo "[1/4] Building Docker image..."
-docker build -f Dockerfile . --tag "${IMAGE_NAME}" --load
+docker build --build-context configschema="${SCRIPT_DIR}/../../configschema" -f Dockerfile . --tag "${IMAGE_NAME}" --load
 
 echo ""
 echo "[2/4] Loading image into kind cluster..."